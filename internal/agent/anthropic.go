@@ -61,6 +61,12 @@ func (a *AnthropicChatAgent) Request(ctx context.Context, params *LLMChatParams,
 
 	endpoint := apiBase + "messages"
 
+	// Check image input against the model's capabilities
+	history, err := checkVisionInput(params.Messages, anthropicModelSupportsVision(a.Model(cfg)), a.Model(cfg))
+	if err != nil {
+		return nil, err
+	}
+
 	// Convert messages to Anthropic format
 	messages := make([]map[string]interface{}, 0)
 	systemPrompt := ""
@@ -71,7 +77,7 @@ func (a *AnthropicChatAgent) Request(ctx context.Context, params *LLMChatParams,
 	}
 
 	// Convert history
-	for _, msg := range params.Messages {
+	for _, msg := range history {
 		if msg.Role == "system" {
 			// Anthropic uses a separate system parameter
 			if content, ok := msg.Content.(string); ok {
@@ -103,16 +109,18 @@ func (a *AnthropicChatAgent) Request(ctx context.Context, params *LLMChatParams,
 					})
 				} else if part.Type == "image" {
 					// Anthropic expects image format
-					imageData := part.Image
-					mediaType := "image/jpeg"
+					img, err := resolveImage(ctx, cfg, part.Image, true)
+					if err != nil {
+						return nil, fmt.Errorf("failed to prepare image: %w", err)
+					}
 
 					// Check if it's a URL or base64
-					if strings.HasPrefix(imageData, "http://") || strings.HasPrefix(imageData, "https://") {
+					if img.URL != "" {
 						contentArray = append(contentArray, map[string]interface{}{
 							"type": "image",
 							"source": map[string]interface{}{
 								"type": "url",
-								"url":  imageData,
+								"url":  img.URL,
 							},
 						})
 					} else {
@@ -120,8 +128,8 @@ func (a *AnthropicChatAgent) Request(ctx context.Context, params *LLMChatParams,
 							"type": "image",
 							"source": map[string]interface{}{
 								"type":       "base64",
-								"media_type": mediaType,
-								"data":       imageData,
+								"media_type": img.MIMEType,
+								"data":       img.Base64(),
 							},
 						})
 					}
@@ -154,6 +162,10 @@ func (a *AnthropicChatAgent) Request(ctx context.Context, params *LLMChatParams,
 		}
 	}
 
+	if params.MaxTokens > 0 {
+		reqBody["max_tokens"] = params.MaxTokens
+	}
+
 	bodyBytes, err := json.Marshal(reqBody)
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal request: %w", err)
@@ -193,7 +205,7 @@ func (a *AnthropicChatAgent) Request(ctx context.Context, params *LLMChatParams,
 
 func (a *AnthropicChatAgent) handleStreamResponse(body io.Reader, onStream ChatStreamTextHandler) (*ChatAgentResponse, error) {
 	var fullText strings.Builder
-	decoder := json.NewDecoder(body)
+	decoder := newStreamDecoder(body)
 
 	for {
 		var event map[string]interface{}
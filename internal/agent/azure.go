@@ -57,18 +57,28 @@ func (a *AzureChatAgent) Request(ctx context.Context, params *LLMChatParams, cfg
 		cfg.AzureAPIVersion,
 	)
 
+	// Check image input against the model's capabilities
+	history, err := checkVisionInput(params.Messages, openAIModelSupportsVision(a.Model(cfg)), a.Model(cfg))
+	if err != nil {
+		return nil, err
+	}
+
 	// Build messages
-	messages := make([]map[string]interface{}, 0, len(params.Messages)+1)
+	messages := make([]map[string]interface{}, 0, len(history)+1)
 	if params.Prompt != "" {
 		messages = append(messages, map[string]interface{}{
 			"role":    "system",
 			"content": params.Prompt,
 		})
 	}
-	for _, msg := range params.Messages {
+	for _, msg := range history {
+		content, err := openAIContent(ctx, cfg, msg.Content, true, false)
+		if err != nil {
+			return nil, fmt.Errorf("failed to prepare image: %w", err)
+		}
 		messages = append(messages, map[string]interface{}{
 			"role":    msg.Role,
-			"content": msg.Content,
+			"content": content,
 		})
 	}
 
@@ -85,6 +95,10 @@ func (a *AzureChatAgent) Request(ctx context.Context, params *LLMChatParams, cfg
 		}
 	}
 
+	if params.MaxTokens > 0 {
+		reqBody["max_tokens"] = params.MaxTokens
+	}
+
 	bodyBytes, err := json.Marshal(reqBody)
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal request: %w", err)
@@ -123,7 +137,7 @@ func (a *AzureChatAgent) Request(ctx context.Context, params *LLMChatParams, cfg
 
 func (a *AzureChatAgent) handleStreamResponse(body io.Reader, onStream ChatStreamTextHandler) (*ChatAgentResponse, error) {
 	var fullText strings.Builder
-	decoder := json.NewDecoder(body)
+	decoder := newStreamDecoder(body)
 
 	for {
 		var line map[string]interface{}
@@ -211,7 +225,11 @@ func (a *AzureImageAgent) ModelList(cfg *config.Config) ([]string, error) {
 	return []string{"dall-e-3", "dall-e-2"}, nil
 }
 
-func (a *AzureImageAgent) Request(ctx context.Context, prompt string, cfg *config.Config) (string, error) {
+func (a *AzureImageAgent) ValidateParams(params *ImageGenParams, cfg *config.Config) error {
+	return validateDallEParams(a.Model(cfg), params, cfg)
+}
+
+func (a *AzureImageAgent) Request(ctx context.Context, params *ImageGenParams, cfg *config.Config) (*ImageGenResponse, error) {
 	// Build Azure OpenAI endpoint for image generation
 	endpoint := fmt.Sprintf("https://%s.openai.azure.com/openai/deployments/%s/images/generations?api-version=%s",
 		cfg.AzureResourceName,
@@ -219,65 +237,10 @@ func (a *AzureImageAgent) Request(ctx context.Context, prompt string, cfg *confi
 		cfg.AzureAPIVersion,
 	)
 
-	// Build request body
-	reqBody := map[string]interface{}{
-		"prompt": prompt,
-		"n":      1,
-		"size":   cfg.DallEImageSize,
-	}
-
-	// DALL-E 3 specific parameters
-	if strings.Contains(a.Model(cfg), "dall-e-3") {
-		reqBody["quality"] = cfg.DallEImageQuality
-		reqBody["style"] = cfg.DallEImageStyle
-	}
-
-	bodyBytes, err := json.Marshal(reqBody)
-	if err != nil {
-		return "", fmt.Errorf("failed to marshal request: %w", err)
+	headers := map[string]string{
+		"api-key": cfg.AzureAPIKey,
 	}
 
-	// Create HTTP request
-	req, err := http.NewRequestWithContext(ctx, "POST", endpoint, bytes.NewReader(bodyBytes))
-	if err != nil {
-		return "", fmt.Errorf("failed to create request: %w", err)
-	}
-
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("api-key", cfg.AzureAPIKey)
-
-	// Send request
-	client := CreateHTTPClient(cfg)
-	resp, err := client.Do(req)
-	if err != nil {
-		return "", fmt.Errorf("failed to send request: %w", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return "", fmt.Errorf("API request failed with status %d: %s", resp.StatusCode, string(body))
-	}
-
-	// Parse response
-	var response struct {
-		Data []struct {
-			URL     string `json:"url"`
-			B64JSON string `json:"b64_json"`
-		} `json:"data"`
-	}
-
-	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
-		return "", fmt.Errorf("failed to decode response: %w", err)
-	}
-
-	if len(response.Data) == 0 {
-		return "", fmt.Errorf("no image data in response")
-	}
-
-	// Return URL or base64 data
-	if response.Data[0].URL != "" {
-		return response.Data[0].URL, nil
-	}
-	return response.Data[0].B64JSON, nil
+	// Azure selects the model through the deployment, so it is not sent in the body
+	return requestDallEImages(ctx, cfg, endpoint, headers, a.Model(cfg), false, params)
 }
@@ -0,0 +1,172 @@
+package agent
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+
+	"github.com/tbxark/ChatGPT-Telegram-Workers/go_version/internal/config"
+	"github.com/tbxark/ChatGPT-Telegram-Workers/go_version/internal/storage"
+)
+
+// CachedChatAgent wraps a ChatAgent with a response cache kept in the storage backend
+// and records per-model usage stats (requests and cache hits).
+// Only stateless requests (a single user message without history) are cached,
+// and requests whose temperature exceeds RESPONSE_CACHE_MAX_TEMPERATURE always bypass the cache.
+type CachedChatAgent struct {
+	ChatAgent
+	db    storage.Storage
+	botID int64
+}
+
+// NewCachedChatAgent creates a caching wrapper around a chat agent
+func NewCachedChatAgent(inner ChatAgent, db storage.Storage, botID int64) *CachedChatAgent {
+	return &CachedChatAgent{
+		ChatAgent: inner,
+		db:        db,
+		botID:     botID,
+	}
+}
+
+func (a *CachedChatAgent) Request(ctx context.Context, params *LLMChatParams, cfg *config.Config, onStream ChatStreamTextHandler) (*ChatAgentResponse, error) {
+	key := ""
+	if cfg.ResponseCacheEnabled {
+		key = responseCacheKey(a.Name(), a.Model(cfg), params, ChatExtraParams(cfg, a.Name()), cfg.ResponseCacheMaxTemperature)
+	}
+
+	if key != "" {
+		text, found, err := a.db.GetCachedResponse(key)
+		if err != nil {
+			slog.Warn("Failed to read response cache", "error", err)
+		} else if found {
+			a.recordUsage(cfg, true)
+			if onStream != nil {
+				if err := onStream(text); err != nil {
+					return nil, fmt.Errorf("stream handler error: %w", err)
+				}
+			}
+			return &ChatAgentResponse{
+				Messages: []HistoryItem{
+					{
+						Role:    "assistant",
+						Content: text,
+					},
+				},
+			}, nil
+		}
+	}
+
+	response, err := a.ChatAgent.Request(ctx, params, cfg, onStream)
+	if err != nil {
+		return nil, err
+	}
+	a.recordUsage(cfg, false)
+
+	if key != "" {
+		if text := responseText(response); text != "" {
+			if err := a.db.SaveCachedResponse(key, text, cfg.ResponseCacheTTL); err != nil {
+				slog.Warn("Failed to save response cache", "error", err)
+			}
+		}
+	}
+
+	return response, nil
+}
+
+// recordUsage updates the usage stats, logging instead of failing the request on error
+func (a *CachedChatAgent) recordUsage(cfg *config.Config, cacheHit bool) {
+	if err := a.db.RecordUsage(a.botID, a.Name(), a.Model(cfg), cacheHit); err != nil {
+		slog.Warn("Failed to record usage", "error", err)
+	}
+}
+
+// ChatExtraParams returns the configured extra request parameters (e.g. sampling settings) of a chat agent
+func ChatExtraParams(cfg *config.Config, provider string) map[string]interface{} {
+	switch provider {
+	case "openai":
+		return cfg.OpenAIAPIExtraParams
+	case "azure":
+		return cfg.AzureChatExtraParams
+	case "workers":
+		return cfg.WorkersChatExtraParams
+	case "gemini":
+		return cfg.GoogleChatExtraParams
+	case "mistral":
+		return cfg.MistralChatExtraParams
+	case "cohere":
+		return cfg.CohereChatExtraParams
+	case "anthropic":
+		return cfg.AnthropicChatExtraParams
+	case "deepseek":
+		return cfg.DeepSeekChatExtraParams
+	case "groq":
+		return cfg.GroqChatExtraParams
+	case "xai":
+		return cfg.XAIChatExtraParams
+	default:
+		return nil
+	}
+}
+
+// responseCacheKey returns the cache key for a request, or an empty string when the request
+// must not be cached (it has history, non-text content, or a temperature above maxTemperature).
+// Requests without an explicit temperature are treated as cacheable.
+func responseCacheKey(provider, model string, params *LLMChatParams, sampling map[string]interface{}, maxTemperature float64) string {
+	if len(params.Messages) != 1 || params.Messages[0].Role != "user" {
+		return ""
+	}
+	message, ok := params.Messages[0].Content.(string)
+	if !ok {
+		return ""
+	}
+	if temperature, ok := samplingTemperature(sampling); ok && temperature > maxTemperature {
+		return ""
+	}
+
+	// json.Marshal sorts map keys, so equal parameters always produce the same key
+	data, err := json.Marshal(struct {
+		Provider string                 `json:"provider"`
+		Model    string                 `json:"model"`
+		Prompt   string                 `json:"prompt"`
+		Message  string                 `json:"message"`
+		Sampling map[string]interface{} `json:"sampling"`
+		Limit    int                    `json:"max_tokens,omitempty"`
+	}{provider, model, params.Prompt, message, sampling, params.MaxTokens})
+	if err != nil {
+		return ""
+	}
+
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// samplingTemperature extracts the temperature from extra params,
+// including Gemini's nested generationConfig
+func samplingTemperature(params map[string]interface{}) (float64, bool) {
+	if temperature, ok := params["temperature"].(float64); ok {
+		return temperature, true
+	}
+	for _, key := range []string{"generationConfig", "generation_config"} {
+		if nested, ok := params[key].(map[string]interface{}); ok {
+			if temperature, ok := nested["temperature"].(float64); ok {
+				return temperature, true
+			}
+		}
+	}
+	return 0, false
+}
+
+// responseText returns the text of the last assistant message in a response
+func responseText(response *ChatAgentResponse) string {
+	for i := len(response.Messages) - 1; i >= 0; i-- {
+		if response.Messages[i].Role != "assistant" {
+			continue
+		}
+		text, _ := response.Messages[i].Content.(string)
+		return text
+	}
+	return ""
+}
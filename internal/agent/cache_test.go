@@ -0,0 +1,229 @@
+package agent
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/tbxark/ChatGPT-Telegram-Workers/go_version/internal/config"
+	"github.com/tbxark/ChatGPT-Telegram-Workers/go_version/internal/storage"
+)
+
+// cacheTestStorage keeps the response cache and usage counters in memory
+type cacheTestStorage struct {
+	storage.Storage
+	cache     map[string]string
+	requests  int
+	cacheHits int
+}
+
+func newCacheTestStorage() *cacheTestStorage {
+	return &cacheTestStorage{cache: make(map[string]string)}
+}
+
+func (s *cacheTestStorage) GetCachedResponse(key string) (string, bool, error) {
+	response, ok := s.cache[key]
+	return response, ok, nil
+}
+
+func (s *cacheTestStorage) SaveCachedResponse(key string, response string, ttl int) error {
+	s.cache[key] = response
+	return nil
+}
+
+func (s *cacheTestStorage) RecordUsage(botID int64, provider, model string, cacheHit bool) error {
+	s.requests++
+	if cacheHit {
+		s.cacheHits++
+	}
+	return nil
+}
+
+func (s *cacheTestStorage) TakeInlineQuota(botID, userID int64, limit int) (bool, error) {
+	return true, nil
+}
+
+func (s *cacheTestStorage) GetUsageStats(botID int64, since time.Time) ([]*storage.UsageStat, error) {
+	return nil, nil
+}
+
+// countingChatAgent returns a fixed reply and counts upstream calls
+type countingChatAgent struct {
+	calls int
+}
+
+func (a *countingChatAgent) Name() string                                   { return "openai" }
+func (a *countingChatAgent) ModelKey() string                               { return "OPENAI_CHAT_MODEL" }
+func (a *countingChatAgent) Enable(cfg *config.Config) bool                 { return true }
+func (a *countingChatAgent) Model(cfg *config.Config) string                { return cfg.OpenAIChatModel }
+func (a *countingChatAgent) ModelList(cfg *config.Config) ([]string, error) { return nil, nil }
+
+func (a *countingChatAgent) Request(ctx context.Context, params *LLMChatParams, cfg *config.Config, onStream ChatStreamTextHandler) (*ChatAgentResponse, error) {
+	a.calls++
+	if onStream != nil {
+		if err := onStream("pong"); err != nil {
+			return nil, err
+		}
+	}
+	return &ChatAgentResponse{Messages: []HistoryItem{{Role: "assistant", Content: "pong"}}}, nil
+}
+
+func newCacheTestConfig() *config.Config {
+	return &config.Config{
+		OpenAIChatModel:             "gpt-4o-mini",
+		ResponseCacheEnabled:        true,
+		ResponseCacheTTL:            60,
+		ResponseCacheMaxTemperature: 0.3,
+	}
+}
+
+func singleMessageParams(text string) *LLMChatParams {
+	return &LLMChatParams{
+		Prompt:   "You are a helpful assistant",
+		Messages: []HistoryItem{{Role: "user", Content: text}},
+	}
+}
+
+func TestCachedChatAgent_HitAndMiss(t *testing.T) {
+	cfg := newCacheTestConfig()
+	db := newCacheTestStorage()
+	inner := &countingChatAgent{}
+	cached := NewCachedChatAgent(inner, db, 1)
+
+	for i := 0; i < 2; i++ {
+		var streamed string
+		resp, err := cached.Request(context.Background(), singleMessageParams("ping"), cfg, func(text string) error {
+			streamed = text
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("Request() error = %v", err)
+		}
+		if got := responseText(resp); got != "pong" {
+			t.Errorf("response = %q, want pong", got)
+		}
+		if streamed != "pong" {
+			t.Errorf("streamed = %q, want pong", streamed)
+		}
+	}
+
+	if inner.calls != 1 {
+		t.Errorf("upstream calls = %d, want 1", inner.calls)
+	}
+	if db.requests != 2 || db.cacheHits != 1 {
+		t.Errorf("usage = %d requests / %d hits, want 2 / 1", db.requests, db.cacheHits)
+	}
+
+	// A different prompt is a different key
+	params := singleMessageParams("ping")
+	params.Prompt = "You are a pirate"
+	if _, err := cached.Request(context.Background(), params, cfg, nil); err != nil {
+		t.Fatalf("Request() error = %v", err)
+	}
+	if inner.calls != 2 {
+		t.Errorf("upstream calls = %d, want 2", inner.calls)
+	}
+}
+
+func TestCachedChatAgent_Bypass(t *testing.T) {
+	tests := []struct {
+		name   string
+		params *LLMChatParams
+		extra  map[string]interface{}
+		enable bool
+	}{
+		{
+			name: "with history",
+			params: &LLMChatParams{Messages: []HistoryItem{
+				{Role: "user", Content: "hi"},
+				{Role: "assistant", Content: "hello"},
+				{Role: "user", Content: "ping"},
+			}},
+			enable: true,
+		},
+		{
+			name:   "high temperature",
+			params: singleMessageParams("ping"),
+			extra:  map[string]interface{}{"temperature": 0.9},
+			enable: true,
+		},
+		{
+			name:   "high gemini temperature",
+			params: singleMessageParams("ping"),
+			extra:  map[string]interface{}{"generationConfig": map[string]interface{}{"temperature": 1.0}},
+			enable: true,
+		},
+		{
+			name: "image content",
+			params: &LLMChatParams{Messages: []HistoryItem{
+				{Role: "user", Content: []ContentPart{{Type: "image", Image: "https://example.com/a.png"}}},
+			}},
+			enable: true,
+		},
+		{
+			name:   "disabled",
+			params: singleMessageParams("ping"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := newCacheTestConfig()
+			cfg.ResponseCacheEnabled = tt.enable
+			cfg.OpenAIAPIExtraParams = tt.extra
+			db := newCacheTestStorage()
+			inner := &countingChatAgent{}
+			cached := NewCachedChatAgent(inner, db, 1)
+
+			for i := 0; i < 2; i++ {
+				if _, err := cached.Request(context.Background(), tt.params, cfg, nil); err != nil {
+					t.Fatalf("Request() error = %v", err)
+				}
+			}
+
+			if inner.calls != 2 {
+				t.Errorf("upstream calls = %d, want 2", inner.calls)
+			}
+			if len(db.cache) != 0 {
+				t.Errorf("cache entries = %d, want 0", len(db.cache))
+			}
+			if db.requests != 2 || db.cacheHits != 0 {
+				t.Errorf("usage = %d requests / %d hits, want 2 / 0", db.requests, db.cacheHits)
+			}
+		})
+	}
+}
+
+func TestResponseCacheKey_SamplingParams(t *testing.T) {
+	params := singleMessageParams("ping")
+
+	low := responseCacheKey("openai", "gpt-4o-mini", params, map[string]interface{}{"temperature": 0.0, "top_p": 1.0}, 0.3)
+	reordered := responseCacheKey("openai", "gpt-4o-mini", params, map[string]interface{}{"top_p": 1.0, "temperature": 0.0}, 0.3)
+	other := responseCacheKey("openai", "gpt-4o-mini", params, map[string]interface{}{"temperature": 0.2}, 0.3)
+	otherModel := responseCacheKey("openai", "gpt-4o", params, map[string]interface{}{"temperature": 0.0, "top_p": 1.0}, 0.3)
+
+	if low == "" {
+		t.Fatal("expected a cache key")
+	}
+	if low != reordered {
+		t.Error("expected the key to be independent of parameter order")
+	}
+	if low == other || low == otherModel {
+		t.Error("expected different sampling params or models to produce different keys")
+	}
+}
+
+func TestResponseCacheKey_MaxTokens(t *testing.T) {
+	params := singleMessageParams("ping")
+	limited := singleMessageParams("ping")
+	limited.MaxTokens = 64
+
+	full := responseCacheKey("openai", "gpt-4o-mini", params, nil, 0.3)
+	short := responseCacheKey("openai", "gpt-4o-mini", limited, nil, 0.3)
+	if full == "" || short == "" {
+		t.Fatal("expected cache keys")
+	}
+	if full == short {
+		t.Error("expected a token limit to produce a different key")
+	}
+}
@@ -68,6 +68,12 @@ func (a *GeminiChatAgent) Request(ctx context.Context, params *LLMChatParams, cf
 		)
 	}
 
+	// Check image input against the model's capabilities
+	history, err := checkVisionInput(params.Messages, geminiModelSupportsVision(a.Model(cfg)), a.Model(cfg))
+	if err != nil {
+		return nil, err
+	}
+
 	// Convert messages to Gemini format
 	contents := make([]map[string]interface{}, 0)
 	systemInstruction := ""
@@ -78,7 +84,7 @@ func (a *GeminiChatAgent) Request(ctx context.Context, params *LLMChatParams, cf
 	}
 
 	// Convert history to Gemini format
-	for _, msg := range params.Messages {
+	for _, msg := range history {
 		role := msg.Role
 		if role == "assistant" {
 			role = "model"
@@ -109,11 +115,15 @@ func (a *GeminiChatAgent) Request(ctx context.Context, params *LLMChatParams, cf
 						"text": part.Text,
 					})
 				} else if part.Type == "image" {
-					// Gemini expects inline_data format
+					// Gemini expects inline_data format, so URLs are downloaded first
+					img, err := resolveImage(ctx, cfg, part.Image, false)
+					if err != nil {
+						return nil, fmt.Errorf("failed to prepare image: %w", err)
+					}
 					parts = append(parts, map[string]interface{}{
 						"inline_data": map[string]interface{}{
-							"mime_type": "image/jpeg",
-							"data":      part.Image,
+							"mime_type": img.MIMEType,
+							"data":      img.Base64(),
 						},
 					})
 				}
@@ -146,6 +156,18 @@ func (a *GeminiChatAgent) Request(ctx context.Context, params *LLMChatParams, cf
 		}
 	}
 
+	if params.MaxTokens > 0 {
+		// Copy generationConfig, which may come from the extra parameters
+		generationConfig := map[string]interface{}{}
+		if extra, ok := reqBody["generationConfig"].(map[string]interface{}); ok {
+			for k, v := range extra {
+				generationConfig[k] = v
+			}
+		}
+		generationConfig["maxOutputTokens"] = params.MaxTokens
+		reqBody["generationConfig"] = generationConfig
+	}
+
 	bodyBytes, err := json.Marshal(reqBody)
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal request: %w", err)
@@ -183,7 +205,7 @@ func (a *GeminiChatAgent) Request(ctx context.Context, params *LLMChatParams, cf
 
 func (a *GeminiChatAgent) handleStreamResponse(body io.Reader, onStream ChatStreamTextHandler) (*ChatAgentResponse, error) {
 	var fullText strings.Builder
-	decoder := json.NewDecoder(body)
+	decoder := newStreamDecoder(body)
 
 	for {
 		var line map[string]interface{}
@@ -0,0 +1,281 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/tbxark/ChatGPT-Telegram-Workers/go_version/internal/config"
+)
+
+// dallE3MaxImages is the maximum number of images generated for a single DALL-E 3 command.
+// DALL-E 3 only accepts n=1, so each image is a separate API call.
+const dallE3MaxImages = 4
+
+// dallE2MaxImages is the maximum n accepted by the DALL-E 2 API
+const dallE2MaxImages = 10
+
+// dallE3AspectRatios maps supported aspect ratios to DALL-E 3 sizes
+var dallE3AspectRatios = map[string]string{
+	"1:1":  "1024x1024",
+	"16:9": "1792x1024",
+	"9:16": "1024x1792",
+}
+
+// dallE2Sizes lists the sizes supported by DALL-E 2
+var dallE2Sizes = []string{"256x256", "512x512", "1024x1024"}
+
+// isDallE3 reports whether the model (or Azure deployment) name refers to DALL-E 3
+func isDallE3(model string) bool {
+	return strings.Contains(model, "dall-e-3")
+}
+
+// validateDallEParams validates params against the limits of the given DALL-E model
+// and fills in defaults from the configuration
+func validateDallEParams(model string, params *ImageGenParams, cfg *config.Config) error {
+	if params.N <= 0 {
+		params.N = 1
+	}
+
+	dallE3 := isDallE3(model)
+
+	maxN := dallE2MaxImages
+	if dallE3 {
+		maxN = dallE3MaxImages
+	}
+	if params.N > maxN {
+		return fmt.Errorf("%s supports at most %d images per request", model, maxN)
+	}
+
+	// Resolve the aspect ratio to a size
+	if params.Size == "" && params.AspectRatio != "" {
+		if dallE3 {
+			size, ok := dallE3AspectRatios[params.AspectRatio]
+			if !ok {
+				return fmt.Errorf("%s does not support aspect ratio %s (supported: 1:1, 16:9, 9:16)", model, params.AspectRatio)
+			}
+			params.Size = size
+		} else if params.AspectRatio == "1:1" {
+			params.Size = "1024x1024"
+		} else {
+			return fmt.Errorf("%s only supports aspect ratio 1:1", model)
+		}
+	}
+	if params.Size == "" {
+		params.Size = cfg.DallEImageSize
+	}
+
+	if dallE3 {
+		if !containsString(mapValues(dallE3AspectRatios), params.Size) {
+			return fmt.Errorf("%s does not support size %s (supported: 1024x1024, 1792x1024, 1024x1792)", model, params.Size)
+		}
+
+		if params.Quality == "" {
+			params.Quality = cfg.DallEImageQuality
+		}
+		if params.Quality != "standard" && params.Quality != "hd" {
+			return fmt.Errorf("%s does not support quality %s (supported: standard, hd)", model, params.Quality)
+		}
+
+		if params.Style == "" {
+			params.Style = cfg.DallEImageStyle
+		}
+		if params.Style != "vivid" && params.Style != "natural" {
+			return fmt.Errorf("%s does not support style %s (supported: vivid, natural)", model, params.Style)
+		}
+		return nil
+	}
+
+	if !containsString(dallE2Sizes, params.Size) {
+		return fmt.Errorf("%s does not support size %s (supported: %s)", model, params.Size, strings.Join(dallE2Sizes, ", "))
+	}
+	if params.Quality != "" || params.Style != "" {
+		return fmt.Errorf("%s does not support quality or style options", model)
+	}
+	return nil
+}
+
+// requestDallEImages generates images from a DALL-E compatible endpoint.
+// DALL-E 3 requests are fanned out into one call per image because the API only accepts n=1.
+func requestDallEImages(ctx context.Context, cfg *config.Config, endpoint string, headers map[string]string, model string, includeModel bool, params *ImageGenParams) (*ImageGenResponse, error) {
+	buildBody := func(n int) map[string]interface{} {
+		body := map[string]interface{}{
+			"prompt": params.Prompt,
+			"n":      n,
+			"size":   params.Size,
+		}
+		if includeModel {
+			body["model"] = model
+		}
+		if isDallE3(model) {
+			body["quality"] = params.Quality
+			body["style"] = params.Style
+		}
+		return body
+	}
+
+	if !isDallE3(model) {
+		return doDallERequest(ctx, cfg, endpoint, headers, buildBody(params.N))
+	}
+
+	results := make([]*ImageGenResponse, params.N)
+	errs := make([]error, params.N)
+	var wg sync.WaitGroup
+	for i := 0; i < params.N; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], errs[i] = doDallERequest(ctx, cfg, endpoint, headers, buildBody(1))
+		}(i)
+	}
+	wg.Wait()
+
+	response := &ImageGenResponse{}
+	for i := range results {
+		if errs[i] != nil {
+			return nil, errs[i]
+		}
+		response.Images = append(response.Images, results[i].Images...)
+		if response.RevisedPrompt == "" {
+			response.RevisedPrompt = results[i].RevisedPrompt
+		}
+	}
+	return response, nil
+}
+
+// doDallERequest performs a single images/generations call
+func doDallERequest(ctx context.Context, cfg *config.Config, endpoint string, headers map[string]string, reqBody map[string]interface{}) (*ImageGenResponse, error) {
+	bodyBytes, err := json.Marshal(reqBody)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	// Create HTTP request
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint, bytes.NewReader(bodyBytes))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	// Send request
+	client := CreateHTTPClient(cfg)
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("API request failed with status %d: %s", resp.StatusCode, string(body))
+	}
+
+	// Parse response
+	var response struct {
+		Data []struct {
+			URL           string `json:"url"`
+			B64JSON       string `json:"b64_json"`
+			RevisedPrompt string `json:"revised_prompt"`
+		} `json:"data"`
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	if len(response.Data) == 0 {
+		return nil, fmt.Errorf("no image data in response")
+	}
+
+	result := &ImageGenResponse{}
+	for _, item := range response.Data {
+		if item.URL != "" {
+			result.Images = append(result.Images, GeneratedImage{URL: item.URL})
+		} else {
+			data, err := base64.StdEncoding.DecodeString(item.B64JSON)
+			if err != nil {
+				return nil, fmt.Errorf("failed to decode image data: %w", err)
+			}
+			result.Images = append(result.Images, GeneratedImage{Data: data})
+		}
+		if result.RevisedPrompt == "" {
+			result.RevisedPrompt = item.RevisedPrompt
+		}
+	}
+
+	return result, nil
+}
+
+// parseImageSize parses a size of the form "WIDTHxHEIGHT"
+func parseImageSize(size string) (int, int, error) {
+	parts := strings.Split(strings.ToLower(size), "x")
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("invalid size %s, expected WIDTHxHEIGHT", size)
+	}
+	width, err := strconv.Atoi(parts[0])
+	if err != nil || width <= 0 {
+		return 0, 0, fmt.Errorf("invalid size %s, expected WIDTHxHEIGHT", size)
+	}
+	height, err := strconv.Atoi(parts[1])
+	if err != nil || height <= 0 {
+		return 0, 0, fmt.Errorf("invalid size %s, expected WIDTHxHEIGHT", size)
+	}
+	return width, height, nil
+}
+
+// aspectRatioToSize converts an aspect ratio of the form "W:H" to pixel dimensions
+// with the longer side equal to longSide, rounded down to a multiple of 64
+func aspectRatioToSize(aspectRatio string, longSide int) (int, int, error) {
+	parts := strings.Split(aspectRatio, ":")
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("invalid aspect ratio %s, expected W:H", aspectRatio)
+	}
+	w, err := strconv.Atoi(parts[0])
+	if err != nil || w <= 0 {
+		return 0, 0, fmt.Errorf("invalid aspect ratio %s, expected W:H", aspectRatio)
+	}
+	h, err := strconv.Atoi(parts[1])
+	if err != nil || h <= 0 {
+		return 0, 0, fmt.Errorf("invalid aspect ratio %s, expected W:H", aspectRatio)
+	}
+
+	if w >= h {
+		return longSide, roundDown64(longSide * h / w), nil
+	}
+	return roundDown64(longSide * w / h), longSide, nil
+}
+
+func roundDown64(v int) int {
+	if v < 64 {
+		return 64
+	}
+	return v / 64 * 64
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+func mapValues(m map[string]string) []string {
+	values := make([]string, 0, len(m))
+	for _, v := range m {
+		values = append(values, v)
+	}
+	return values
+}
@@ -55,18 +55,28 @@ func (a *OpenAIChatAgent) Request(ctx context.Context, params *LLMChatParams, cf
 		apiBase += "/"
 	}
 
+	// Check image input against the model's capabilities
+	history, err := checkVisionInput(params.Messages, openAIModelSupportsVision(a.Model(cfg)), a.Model(cfg))
+	if err != nil {
+		return nil, err
+	}
+
 	// Build messages
-	messages := make([]map[string]interface{}, 0, len(params.Messages)+1)
+	messages := make([]map[string]interface{}, 0, len(history)+1)
 	if params.Prompt != "" {
 		messages = append(messages, map[string]interface{}{
 			"role":    "system",
 			"content": params.Prompt,
 		})
 	}
-	for _, msg := range params.Messages {
+	for _, msg := range history {
+		content, err := openAIContent(ctx, cfg, msg.Content, true, false)
+		if err != nil {
+			return nil, fmt.Errorf("failed to prepare image: %w", err)
+		}
 		messages = append(messages, map[string]interface{}{
 			"role":    msg.Role,
-			"content": msg.Content,
+			"content": content,
 		})
 	}
 
@@ -84,6 +94,10 @@ func (a *OpenAIChatAgent) Request(ctx context.Context, params *LLMChatParams, cf
 		}
 	}
 
+	if params.MaxTokens > 0 {
+		reqBody["max_tokens"] = params.MaxTokens
+	}
+
 	bodyBytes, err := json.Marshal(reqBody)
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal request: %w", err)
@@ -122,7 +136,7 @@ func (a *OpenAIChatAgent) Request(ctx context.Context, params *LLMChatParams, cf
 
 func (a *OpenAIChatAgent) handleStreamResponse(body io.Reader, onStream ChatStreamTextHandler) (*ChatAgentResponse, error) {
 	var fullText strings.Builder
-	decoder := json.NewDecoder(body)
+	decoder := newStreamDecoder(body)
 
 	for {
 		var line map[string]interface{}
@@ -217,69 +231,20 @@ func (a *DallEImageAgent) ModelList(cfg *config.Config) ([]string, error) {
 	return []string{"dall-e-3", "dall-e-2"}, nil
 }
 
-func (a *DallEImageAgent) Request(ctx context.Context, prompt string, cfg *config.Config) (string, error) {
+func (a *DallEImageAgent) ValidateParams(params *ImageGenParams, cfg *config.Config) error {
+	return validateDallEParams(a.Model(cfg), params, cfg)
+}
+
+func (a *DallEImageAgent) Request(ctx context.Context, params *ImageGenParams, cfg *config.Config) (*ImageGenResponse, error) {
 	apiKey := cfg.OpenAIAPIKey[0]
 	apiBase := cfg.OpenAIAPIBase
 	if !strings.HasSuffix(apiBase, "/") {
 		apiBase += "/"
 	}
 
-	// Build request body
-	reqBody := map[string]interface{}{
-		"model":   a.Model(cfg),
-		"prompt":  prompt,
-		"n":       1,
-		"size":    cfg.DallEImageSize,
-		"quality": cfg.DallEImageQuality,
-		"style":   cfg.DallEImageStyle,
-	}
-
-	bodyBytes, err := json.Marshal(reqBody)
-	if err != nil {
-		return "", fmt.Errorf("failed to marshal request: %w", err)
-	}
-
-	// Create HTTP request
-	req, err := http.NewRequestWithContext(ctx, "POST", apiBase+"images/generations", bytes.NewReader(bodyBytes))
-	if err != nil {
-		return "", fmt.Errorf("failed to create request: %w", err)
-	}
-
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+apiKey)
-
-	// Send request
-	client := CreateHTTPClient(cfg)
-	resp, err := client.Do(req)
-	if err != nil {
-		return "", fmt.Errorf("failed to send request: %w", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return "", fmt.Errorf("API request failed with status %d: %s", resp.StatusCode, string(body))
-	}
-
-	// Parse response
-	var response struct {
-		Data []struct {
-			URL     string `json:"url"`
-			B64JSON string `json:"b64_json"`
-		} `json:"data"`
+	headers := map[string]string{
+		"Authorization": "Bearer " + apiKey,
 	}
 
-	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
-		return "", fmt.Errorf("failed to decode response: %w", err)
-	}
-
-	if len(response.Data) == 0 {
-		return "", fmt.Errorf("no image data in response")
-	}
-
-	// Return URL or base64 data
-	if response.Data[0].URL != "" {
-		return response.Data[0].URL, nil
-	}
-	return response.Data[0].B64JSON, nil
+	return requestDallEImages(ctx, cfg, apiBase+"images/generations", headers, a.Model(cfg), true, params)
 }
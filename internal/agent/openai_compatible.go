@@ -31,6 +31,11 @@ type OpenAICompatibleAgent struct {
 	getModelsList  func(*config.Config) string
 	getExtraParams func(*config.Config) map[string]interface{}
 	defaultModels  []string
+
+	// supportsVision reports whether a model accepts image input (nil means text-only)
+	supportsVision func(model string) bool
+	// flatImageURL sends image_url as a plain string instead of {"url": ...}
+	flatImageURL bool
 }
 
 func (a *OpenAICompatibleAgent) Name() string {
@@ -68,18 +73,28 @@ func (a *OpenAICompatibleAgent) Request(ctx context.Context, params *LLMChatPara
 		apiBase += "/"
 	}
 
+	// Check image input against the model's capabilities
+	history, err := checkVisionInput(params.Messages, a.supportsVision != nil && a.supportsVision(a.Model(cfg)), a.Model(cfg))
+	if err != nil {
+		return nil, err
+	}
+
 	// Build messages
-	messages := make([]map[string]interface{}, 0, len(params.Messages)+1)
+	messages := make([]map[string]interface{}, 0, len(history)+1)
 	if params.Prompt != "" {
 		messages = append(messages, map[string]interface{}{
 			"role":    "system",
 			"content": params.Prompt,
 		})
 	}
-	for _, msg := range params.Messages {
+	for _, msg := range history {
+		content, err := openAIContent(ctx, cfg, msg.Content, true, a.flatImageURL)
+		if err != nil {
+			return nil, fmt.Errorf("failed to prepare image: %w", err)
+		}
 		messages = append(messages, map[string]interface{}{
 			"role":    msg.Role,
-			"content": msg.Content,
+			"content": content,
 		})
 	}
 
@@ -98,6 +113,10 @@ func (a *OpenAICompatibleAgent) Request(ctx context.Context, params *LLMChatPara
 		}
 	}
 
+	if params.MaxTokens > 0 {
+		reqBody["max_tokens"] = params.MaxTokens
+	}
+
 	bodyBytes, err := json.Marshal(reqBody)
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal request: %w", err)
@@ -136,7 +155,7 @@ func (a *OpenAICompatibleAgent) Request(ctx context.Context, params *LLMChatPara
 
 func (a *OpenAICompatibleAgent) handleStreamResponse(body io.Reader, onStream ChatStreamTextHandler) (*ChatAgentResponse, error) {
 	var fullText strings.Builder
-	decoder := json.NewDecoder(body)
+	decoder := newStreamDecoder(body)
 
 	for {
 		var line map[string]interface{}
@@ -229,6 +248,12 @@ func NewMistralChatAgent() *MistralChatAgent {
 				return cfg.MistralChatExtraParams
 			},
 			defaultModels: []string{"mistral-large-latest", "mistral-medium-latest", "mistral-small-latest"},
+			supportsVision: func(model string) bool {
+				return strings.Contains(model, "pixtral") ||
+					strings.HasPrefix(model, "mistral-small-latest") || strings.HasPrefix(model, "mistral-small-25") ||
+					strings.HasPrefix(model, "mistral-medium-latest") || strings.HasPrefix(model, "mistral-medium-25")
+			},
+			flatImageURL: true,
 		},
 	}
 }
@@ -262,6 +287,9 @@ func NewCohereChatAgent() *CohereChatAgent {
 				return cfg.CohereChatExtraParams
 			},
 			defaultModels: []string{"command-r-plus", "command-r", "command"},
+			supportsVision: func(model string) bool {
+				return strings.Contains(model, "vision")
+			},
 		},
 	}
 }
@@ -328,6 +356,9 @@ func NewGroqChatAgent() *GroqChatAgent {
 				return cfg.GroqChatExtraParams
 			},
 			defaultModels: []string{"llama-3.1-70b-versatile", "llama-3.1-8b-instant", "mixtral-8x7b-32768"},
+			supportsVision: func(model string) bool {
+				return strings.Contains(model, "vision") || strings.Contains(model, "llama-4")
+			},
 		},
 	}
 }
@@ -361,6 +392,9 @@ func NewXAIChatAgent() *XAIChatAgent {
 				return cfg.XAIChatExtraParams
 			},
 			defaultModels: []string{"grok-2-latest", "grok-2-vision-latest"},
+			supportsVision: func(model string) bool {
+				return strings.Contains(model, "vision") || strings.HasPrefix(model, "grok-4")
+			},
 		},
 	}
 }
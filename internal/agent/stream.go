@@ -0,0 +1,52 @@
+package agent
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"strings"
+)
+
+// streamDecoder decodes JSON events from a streaming response body.
+// It accepts server-sent events ("data: {...}" lines, ended by "data: [DONE]")
+// as well as newline-delimited JSON.
+type streamDecoder struct {
+	reader *bufio.Reader
+	done   bool
+}
+
+// newStreamDecoder creates a decoder for a streaming response body
+func newStreamDecoder(body io.Reader) *streamDecoder {
+	return &streamDecoder{reader: bufio.NewReader(body)}
+}
+
+// Decode reads the next JSON event into v, returning io.EOF at the end of the stream
+func (d *streamDecoder) Decode(v interface{}) error {
+	for !d.done {
+		line, err := d.reader.ReadString('\n')
+		if err != nil {
+			if err != io.EOF {
+				return err
+			}
+			d.done = true
+		}
+
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, ":") ||
+			strings.HasPrefix(line, "event:") || strings.HasPrefix(line, "id:") || strings.HasPrefix(line, "retry:") {
+			continue
+		}
+
+		data := line
+		if strings.HasPrefix(line, "data:") {
+			data = strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		}
+		if data == "[DONE]" {
+			d.done = true
+			break
+		}
+
+		return json.Unmarshal([]byte(data), v)
+	}
+	return io.EOF
+}
@@ -0,0 +1,54 @@
+package agent
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestStreamDecoder(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want []string
+	}{
+		{
+			name: "server-sent events",
+			body: "event: message\ndata: {\"text\":\"a\"}\n\n: keep-alive\ndata: {\"text\":\"b\"}\n\ndata: [DONE]\n\ndata: {\"text\":\"ignored\"}\n",
+			want: []string{"a", "b"},
+		},
+		{
+			name: "newline-delimited JSON",
+			body: "{\"text\":\"a\"}\n{\"text\":\"b\"}",
+			want: []string{"a", "b"},
+		},
+		{
+			name: "empty body",
+			body: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decoder := newStreamDecoder(strings.NewReader(tt.body))
+			var got []string
+			for {
+				var event struct {
+					Text string `json:"text"`
+				}
+				err := decoder.Decode(&event)
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatalf("Decode() error = %v", err)
+				}
+				got = append(got, event.Text)
+			}
+
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("Decode() events = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
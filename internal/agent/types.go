@@ -2,6 +2,7 @@ package agent
 
 import (
 	"context"
+	"strings"
 
 	"github.com/tbxark/ChatGPT-Telegram-Workers/go_version/internal/config"
 )
@@ -21,8 +22,9 @@ type ContentPart struct {
 
 // LLMChatParams contains parameters for a chat completion request
 type LLMChatParams struct {
-	Prompt   string        // System prompt or initial message
-	Messages []HistoryItem // Conversation history
+	Prompt    string        // System prompt or initial message
+	Messages  []HistoryItem // Conversation history
+	MaxTokens int           // Maximum number of tokens to generate, 0 for the provider default
 }
 
 // ChatAgentResponse represents the response from a chat agent
@@ -30,6 +32,51 @@ type ChatAgentResponse struct {
 	Messages []HistoryItem // Response messages
 }
 
+// Text returns the text of the last assistant message, joining the text parts of multi-part content
+func (r *ChatAgentResponse) Text() string {
+	for i := len(r.Messages) - 1; i >= 0; i-- {
+		if r.Messages[i].Role != "assistant" {
+			continue
+		}
+		switch v := r.Messages[i].Content.(type) {
+		case string:
+			return v
+		case []ContentPart:
+			var parts []string
+			for _, part := range v {
+				if part.Type == "text" {
+					parts = append(parts, part.Text)
+				}
+			}
+			return strings.Join(parts, "\n")
+		}
+		return ""
+	}
+	return ""
+}
+
+// ImageGenParams contains parameters for an image generation request
+type ImageGenParams struct {
+	Prompt      string // Image description
+	N           int    // Number of images to generate
+	Size        string // Explicit size, e.g. "1024x1792" (takes precedence over AspectRatio)
+	AspectRatio string // Aspect ratio, e.g. "16:9", resolved to a size by the provider
+	Quality     string // Provider-specific quality, e.g. "standard" or "hd"
+	Style       string // Provider-specific style, e.g. "vivid" or "natural"
+}
+
+// GeneratedImage represents a single generated image
+type GeneratedImage struct {
+	URL  string // Image URL, if the provider returns one
+	Data []byte // Raw image bytes, if the provider returns inline data
+}
+
+// ImageGenResponse represents the response from an image agent
+type ImageGenResponse struct {
+	Images        []GeneratedImage // Generated images
+	RevisedPrompt string           // Prompt as rewritten by the provider (DALL-E 3), if any
+}
+
 // ChatStreamTextHandler is a callback function for streaming text responses
 type ChatStreamTextHandler func(text string) error
 
@@ -72,7 +119,10 @@ type ImageAgent interface {
 	// ModelList returns the list of available models for this agent
 	ModelList(config *config.Config) ([]string, error)
 
-	// Request generates an image based on the prompt
-	// Returns either an image URL or base64-encoded image data
-	Request(ctx context.Context, prompt string, config *config.Config) (string, error)
+	// ValidateParams checks that the requested count, size and options are supported
+	// by this provider and fills in configured defaults for unset fields
+	ValidateParams(params *ImageGenParams, config *config.Config) error
+
+	// Request generates one or more images based on the params
+	Request(ctx context.Context, params *ImageGenParams, config *config.Config) (*ImageGenResponse, error)
 }
@@ -0,0 +1,349 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"io"
+	"net/http"
+	"strings"
+
+	// Register decoders for image.Decode
+	_ "image/gif"
+	_ "image/png"
+
+	"github.com/tbxark/ChatGPT-Telegram-Workers/go_version/internal/config"
+)
+
+// ErrVisionNotSupported is returned when image input is sent to a text-only model
+var ErrVisionNotSupported = errors.New("model does not support image input")
+
+// maxImageDownloadBytes caps the size of images downloaded for inline upload
+const maxImageDownloadBytes = 20 << 20
+
+// ImageInput is an image resolved from a ContentPart, ready to be sent to a provider
+type ImageInput struct {
+	URL      string // Remote URL (only set when the provider accepts URLs and the part is a URL)
+	MIMEType string // Detected MIME type of Data
+	Data     []byte // Raw image bytes
+}
+
+// DataURI returns the image encoded as a data URI
+func (img *ImageInput) DataURI() string {
+	return fmt.Sprintf("data:%s;base64,%s", img.MIMEType, base64.StdEncoding.EncodeToString(img.Data))
+}
+
+// Base64 returns the image data encoded as base64 without a data URI prefix
+func (img *ImageInput) Base64() string {
+	return base64.StdEncoding.EncodeToString(img.Data)
+}
+
+// isImageURL reports whether the image reference is a remote URL
+func isImageURL(image string) bool {
+	return strings.HasPrefix(image, "http://") || strings.HasPrefix(image, "https://")
+}
+
+// hasImageContent reports whether the message content contains an image part
+func hasImageContent(content interface{}) bool {
+	parts, ok := content.([]ContentPart)
+	if !ok {
+		return false
+	}
+	for _, part := range parts {
+		if part.Type == "image" {
+			return true
+		}
+	}
+	return false
+}
+
+// checkVisionInput prepares messages for a model based on its vision support.
+// Text-only models fail with ErrVisionNotSupported when the latest user message has an image;
+// images in older messages are dropped so that earlier turns don't block the conversation.
+func checkVisionInput(messages []HistoryItem, supportsVision bool, model string) ([]HistoryItem, error) {
+	if supportsVision {
+		return messages, nil
+	}
+
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].Role != "user" {
+			continue
+		}
+		if hasImageContent(messages[i].Content) {
+			return nil, fmt.Errorf("%w: %s", ErrVisionNotSupported, model)
+		}
+		break
+	}
+
+	result := make([]HistoryItem, len(messages))
+	for i, msg := range messages {
+		result[i] = msg
+		parts, ok := msg.Content.([]ContentPart)
+		if !ok || !hasImageContent(parts) {
+			continue
+		}
+
+		var texts []string
+		for _, part := range parts {
+			if part.Type == "text" && part.Text != "" {
+				texts = append(texts, part.Text)
+			}
+		}
+		result[i].Content = strings.Join(texts, "\n")
+	}
+	return result, nil
+}
+
+// resolveImage turns an image reference (URL, data URI or raw base64) into an ImageInput.
+// URLs are kept as-is when allowURL is true; otherwise the image is downloaded.
+// Inline images are resized/recompressed to respect the configured vision limits.
+func resolveImage(ctx context.Context, cfg *config.Config, ref string, allowURL bool) (*ImageInput, error) {
+	if isImageURL(ref) {
+		if allowURL {
+			return &ImageInput{URL: ref}, nil
+		}
+		data, mimeType, err := downloadImage(ctx, cfg, ref)
+		if err != nil {
+			return nil, err
+		}
+		return PrepareImageData(data, mimeType, cfg)
+	}
+
+	mimeType := ""
+	encoded := ref
+	if strings.HasPrefix(ref, "data:") {
+		header, payload, ok := strings.Cut(strings.TrimPrefix(ref, "data:"), ",")
+		if !ok {
+			return nil, fmt.Errorf("invalid image data URI")
+		}
+		mimeType, _, _ = strings.Cut(header, ";")
+		encoded = payload
+	}
+
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode image data: %w", err)
+	}
+	return PrepareImageData(data, mimeType, cfg)
+}
+
+// downloadImage fetches an image for providers that only accept inline data
+func downloadImage(ctx context.Context, cfg *config.Config, url string) ([]byte, string, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to create image request: %w", err)
+	}
+
+	resp, err := CreateHTTPClient(cfg).Do(req)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to download image: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("failed to download image: status %d", resp.StatusCode)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxImageDownloadBytes))
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read image data: %w", err)
+	}
+	return data, resp.Header.Get("Content-Type"), nil
+}
+
+// DetectImageMIME detects the MIME type of image data, falling back to the declared type
+func DetectImageMIME(data []byte, declared string) string {
+	detected := http.DetectContentType(data)
+	if strings.HasPrefix(detected, "image/") {
+		return detected
+	}
+	if strings.HasPrefix(declared, "image/") {
+		return declared
+	}
+	return "image/jpeg"
+}
+
+// PrepareImageData detects the MIME type of an image and, when it exceeds
+// VISION_IMAGE_MAX_DIMENSION or VISION_IMAGE_MAX_BYTES, downscales and recompresses it as JPEG.
+// Formats the standard library cannot decode (e.g. WebP) are passed through unchanged.
+func PrepareImageData(data []byte, declaredMIME string, cfg *config.Config) (*ImageInput, error) {
+	mimeType := DetectImageMIME(data, declaredMIME)
+	input := &ImageInput{MIMEType: mimeType, Data: data}
+
+	maxDim := cfg.VisionImageMaxDimension
+	maxBytes := cfg.VisionImageMaxBytes
+
+	imgConfig, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		// Unknown format, let the provider decide
+		return input, nil
+	}
+
+	tooLarge := maxDim > 0 && (imgConfig.Width > maxDim || imgConfig.Height > maxDim)
+	tooHeavy := maxBytes > 0 && len(data) > maxBytes
+	if !tooLarge && !tooHeavy {
+		return input, nil
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return input, nil
+	}
+
+	width, height := imgConfig.Width, imgConfig.Height
+	if tooLarge {
+		width, height = fitWithin(width, height, maxDim)
+	}
+
+	// Shrink until the encoded JPEG fits the byte budget
+	quality := 85
+	for attempt := 0; attempt < 6; attempt++ {
+		resized := img
+		if width != imgConfig.Width || height != imgConfig.Height {
+			resized = downscaleImage(img, width, height)
+		}
+
+		var buf bytes.Buffer
+		if err := jpeg.Encode(&buf, flattenImage(resized), &jpeg.Options{Quality: quality}); err != nil {
+			return nil, fmt.Errorf("failed to encode image: %w", err)
+		}
+		if maxBytes <= 0 || buf.Len() <= maxBytes || width <= 64 || height <= 64 {
+			return &ImageInput{MIMEType: "image/jpeg", Data: buf.Bytes()}, nil
+		}
+
+		if quality > 60 {
+			quality -= 15
+		} else {
+			width, height = width*3/4, height*3/4
+		}
+	}
+
+	return nil, fmt.Errorf("image is too large to upload (limit %d bytes)", maxBytes)
+}
+
+// fitWithin scales width and height so that neither exceeds maxDim, keeping the aspect ratio
+func fitWithin(width, height, maxDim int) (int, int) {
+	if width >= height {
+		return maxDim, max(1, height*maxDim/width)
+	}
+	return max(1, width*maxDim/height), maxDim
+}
+
+// downscaleImage resizes src to width x height by averaging the source pixels covered by each target pixel
+func downscaleImage(src image.Image, width, height int) image.Image {
+	bounds := src.Bounds()
+	srcW, srcH := bounds.Dx(), bounds.Dy()
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+
+	for y := 0; y < height; y++ {
+		y0 := bounds.Min.Y + y*srcH/height
+		y1 := max(y0+1, bounds.Min.Y+(y+1)*srcH/height)
+		for x := 0; x < width; x++ {
+			x0 := bounds.Min.X + x*srcW/width
+			x1 := max(x0+1, bounds.Min.X+(x+1)*srcW/width)
+
+			var r, g, b, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					cr, cg, cb, ca := src.At(sx, sy).RGBA()
+					r, g, b, a = r+uint64(cr), g+uint64(cg), b+uint64(cb), a+uint64(ca)
+					n++
+				}
+			}
+			dst.SetRGBA(x, y, color.RGBA{
+				R: uint8(r / n >> 8),
+				G: uint8(g / n >> 8),
+				B: uint8(b / n >> 8),
+				A: uint8(a / n >> 8),
+			})
+		}
+	}
+	return dst
+}
+
+// flattenImage composites an image onto a white background so transparency survives JPEG encoding
+func flattenImage(src image.Image) image.Image {
+	bounds := src.Bounds()
+	dst := image.NewRGBA(bounds)
+	draw.Draw(dst, bounds, image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.Draw(dst, bounds, src, bounds.Min, draw.Over)
+	return dst
+}
+
+// openAIContent converts message content to the OpenAI chat format.
+// When flatImageURL is true, image_url is sent as a plain string (Mistral style).
+func openAIContent(ctx context.Context, cfg *config.Config, content interface{}, allowURL bool, flatImageURL bool) (interface{}, error) {
+	parts, ok := content.([]ContentPart)
+	if !ok {
+		return content, nil
+	}
+
+	result := make([]map[string]interface{}, 0, len(parts))
+	for _, part := range parts {
+		switch part.Type {
+		case "text":
+			result = append(result, map[string]interface{}{
+				"type": "text",
+				"text": part.Text,
+			})
+		case "image":
+			img, err := resolveImage(ctx, cfg, part.Image, allowURL)
+			if err != nil {
+				return nil, err
+			}
+			url := img.URL
+			if url == "" {
+				url = img.DataURI()
+			}
+
+			var imageURL interface{} = map[string]interface{}{"url": url}
+			if flatImageURL {
+				imageURL = url
+			}
+			result = append(result, map[string]interface{}{
+				"type":      "image_url",
+				"image_url": imageURL,
+			})
+		}
+	}
+	return result, nil
+}
+
+// openAIModelSupportsVision reports whether an OpenAI (or Azure) model accepts images.
+// Unknown names are assumed to support vision because Azure deployments can be named freely.
+func openAIModelSupportsVision(model string) bool {
+	model = strings.ToLower(model)
+	if model == "gpt-4" || strings.HasPrefix(model, "gpt-4-0") || strings.HasPrefix(model, "gpt-4-32k") {
+		return false
+	}
+	for _, textOnly := range []string{"gpt-3.5", "gpt-35", "o1-mini", "o3-mini", "davinci", "babbage"} {
+		if strings.Contains(model, textOnly) {
+			return false
+		}
+	}
+	return true
+}
+
+// geminiModelSupportsVision reports whether a Gemini model accepts images (all but Gemini 1.0 Pro)
+func geminiModelSupportsVision(model string) bool {
+	model = strings.ToLower(model)
+	return model != "gemini-pro" && !strings.HasPrefix(model, "gemini-1.0-pro")
+}
+
+// anthropicModelSupportsVision reports whether a Claude model accepts images (Claude 3 and later)
+func anthropicModelSupportsVision(model string) bool {
+	model = strings.ToLower(model)
+	return !strings.HasPrefix(model, "claude-2") && !strings.HasPrefix(model, "claude-instant")
+}
+
+// workersModelSupportsVision reports whether a Workers AI model accepts images
+func workersModelSupportsVision(model string) bool {
+	model = strings.ToLower(model)
+	return strings.Contains(model, "vision") || strings.Contains(model, "llava") || strings.Contains(model, "uform")
+}
@@ -0,0 +1,194 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+
+	"github.com/tbxark/ChatGPT-Telegram-Workers/go_version/internal/config"
+)
+
+// encodeTestPNG creates a PNG image of the given size
+func encodeTestPNG(t *testing.T, width, height int) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, color.RGBA{R: uint8(x), G: uint8(y), B: 128, A: 255})
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatalf("Failed to encode PNG: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestDetectImageMIME(t *testing.T) {
+	pngData := encodeTestPNG(t, 4, 4)
+
+	if got := DetectImageMIME(pngData, "image/jpeg"); got != "image/png" {
+		t.Errorf("DetectImageMIME() = %q, want image/png", got)
+	}
+	if got := DetectImageMIME([]byte("not an image"), "image/webp"); got != "image/webp" {
+		t.Errorf("DetectImageMIME() = %q, want declared image/webp", got)
+	}
+	if got := DetectImageMIME([]byte("not an image"), "application/octet-stream"); got != "image/jpeg" {
+		t.Errorf("DetectImageMIME() = %q, want fallback image/jpeg", got)
+	}
+}
+
+func TestPrepareImageData_Resize(t *testing.T) {
+	cfg := &config.Config{VisionImageMaxDimension: 100}
+	data := encodeTestPNG(t, 400, 200)
+
+	img, err := PrepareImageData(data, "", cfg)
+	if err != nil {
+		t.Fatalf("PrepareImageData() error = %v", err)
+	}
+	if img.MIMEType != "image/jpeg" {
+		t.Errorf("MIMEType = %q, want image/jpeg", img.MIMEType)
+	}
+
+	decoded, _, err := image.DecodeConfig(bytes.NewReader(img.Data))
+	if err != nil {
+		t.Fatalf("Failed to decode resized image: %v", err)
+	}
+	if decoded.Width != 100 || decoded.Height != 50 {
+		t.Errorf("Resized to %dx%d, want 100x50", decoded.Width, decoded.Height)
+	}
+}
+
+func TestPrepareImageData_PassThrough(t *testing.T) {
+	cfg := &config.Config{VisionImageMaxDimension: 100, VisionImageMaxBytes: 1 << 20}
+	data := encodeTestPNG(t, 50, 50)
+
+	img, err := PrepareImageData(data, "", cfg)
+	if err != nil {
+		t.Fatalf("PrepareImageData() error = %v", err)
+	}
+	if img.MIMEType != "image/png" {
+		t.Errorf("MIMEType = %q, want image/png", img.MIMEType)
+	}
+	if !bytes.Equal(img.Data, data) {
+		t.Error("Small image should be passed through unchanged")
+	}
+}
+
+func TestResolveImage_DataURI(t *testing.T) {
+	cfg := &config.Config{}
+	data := encodeTestPNG(t, 8, 8)
+
+	// A data URI with a wrong declared type is corrected by detection
+	ref := "data:image/jpeg;base64," + base64.StdEncoding.EncodeToString(data)
+	img, err := resolveImage(context.Background(), cfg, ref, true)
+	if err != nil {
+		t.Fatalf("resolveImage() error = %v", err)
+	}
+	if img.MIMEType != "image/png" {
+		t.Errorf("MIMEType = %q, want image/png", img.MIMEType)
+	}
+
+	// URLs are kept when the provider accepts them
+	img, err = resolveImage(context.Background(), cfg, "https://example.com/a.png", true)
+	if err != nil {
+		t.Fatalf("resolveImage() error = %v", err)
+	}
+	if img.URL != "https://example.com/a.png" {
+		t.Errorf("URL = %q, want original URL", img.URL)
+	}
+}
+
+func TestCheckVisionInput(t *testing.T) {
+	withImage := []ContentPart{
+		{Type: "text", Text: "what is this?"},
+		{Type: "image", Image: "https://example.com/a.png"},
+	}
+
+	// Latest user message has an image
+	messages := []HistoryItem{{Role: "user", Content: withImage}}
+	if _, err := checkVisionInput(messages, false, "text-model"); !errors.Is(err, ErrVisionNotSupported) {
+		t.Errorf("Expected ErrVisionNotSupported, got %v", err)
+	}
+	if _, err := checkVisionInput(messages, true, "vision-model"); err != nil {
+		t.Errorf("Unexpected error for vision model: %v", err)
+	}
+
+	// Older images are dropped for text-only models
+	messages = []HistoryItem{
+		{Role: "user", Content: withImage},
+		{Role: "assistant", Content: "a cat"},
+		{Role: "user", Content: "thanks"},
+	}
+	result, err := checkVisionInput(messages, false, "text-model")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if result[0].Content != "what is this?" {
+		t.Errorf("Content = %v, want text only", result[0].Content)
+	}
+}
+
+func TestOpenAIContent(t *testing.T) {
+	cfg := &config.Config{}
+	parts := []ContentPart{
+		{Type: "text", Text: "hello"},
+		{Type: "image", Image: "https://example.com/a.png"},
+	}
+
+	content, err := openAIContent(context.Background(), cfg, parts, true, false)
+	if err != nil {
+		t.Fatalf("openAIContent() error = %v", err)
+	}
+	items := content.([]map[string]interface{})
+	if len(items) != 2 || items[1]["type"] != "image_url" {
+		t.Fatalf("Unexpected content: %v", items)
+	}
+	if url := items[1]["image_url"].(map[string]interface{})["url"]; url != "https://example.com/a.png" {
+		t.Errorf("image_url.url = %v", url)
+	}
+
+	// Mistral style flat image_url
+	content, err = openAIContent(context.Background(), cfg, parts, true, true)
+	if err != nil {
+		t.Fatalf("openAIContent() error = %v", err)
+	}
+	if url := content.([]map[string]interface{})[1]["image_url"]; url != "https://example.com/a.png" {
+		t.Errorf("image_url = %v, want plain string", url)
+	}
+
+	// Plain text passes through
+	if content, _ := openAIContent(context.Background(), cfg, "hi", true, false); content != "hi" {
+		t.Errorf("Expected plain text to pass through, got %v", content)
+	}
+}
+
+func TestModelSupportsVision(t *testing.T) {
+	tests := []struct {
+		name string
+		fn   func(string) bool
+		in   string
+		want bool
+	}{
+		{"openai gpt-4o", openAIModelSupportsVision, "gpt-4o-mini", true},
+		{"openai gpt-3.5", openAIModelSupportsVision, "gpt-3.5-turbo", false},
+		{"openai gpt-4", openAIModelSupportsVision, "gpt-4", false},
+		{"gemini 1.5", geminiModelSupportsVision, "gemini-1.5-flash", true},
+		{"gemini pro", geminiModelSupportsVision, "gemini-pro", false},
+		{"claude 3", anthropicModelSupportsVision, "claude-3-5-sonnet-latest", true},
+		{"claude 2", anthropicModelSupportsVision, "claude-2.1", false},
+		{"workers llama vision", workersModelSupportsVision, "@cf/meta/llama-3.2-11b-vision-instruct", true},
+		{"workers llama", workersModelSupportsVision, "@cf/meta/llama-3.1-8b-instruct", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.fn(tt.in); got != tt.want {
+				t.Errorf("supportsVision(%q) = %v, want %v", tt.in, got, tt.want)
+			}
+		})
+	}
+}
@@ -3,11 +3,13 @@ package agent
 import (
 	"bytes"
 	"context"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
 	"strings"
+	"sync"
 
 	"github.com/tbxark/ChatGPT-Telegram-Workers/go_version/internal/config"
 )
@@ -59,18 +61,40 @@ func (a *WorkersChatAgent) Request(ctx context.Context, params *LLMChatParams, c
 		a.Model(cfg),
 	)
 
+	// Check image input against the model's capabilities
+	history, err := checkVisionInput(params.Messages, workersModelSupportsVision(a.Model(cfg)), a.Model(cfg))
+	if err != nil {
+		return nil, err
+	}
+
 	// Build messages
-	messages := make([]map[string]interface{}, 0, len(params.Messages)+1)
+	// Workers AI vision models take a single image as a separate input, so message
+	// content is flattened to text and the most recent image is sent alongside it
+	var latestImage string
+	messages := make([]map[string]interface{}, 0, len(history)+1)
 	if params.Prompt != "" {
 		messages = append(messages, map[string]interface{}{
 			"role":    "system",
 			"content": params.Prompt,
 		})
 	}
-	for _, msg := range params.Messages {
+	for _, msg := range history {
+		content := msg.Content
+		if parts, ok := msg.Content.([]ContentPart); ok {
+			var texts []string
+			for _, part := range parts {
+				switch part.Type {
+				case "text":
+					texts = append(texts, part.Text)
+				case "image":
+					latestImage = part.Image
+				}
+			}
+			content = strings.Join(texts, "\n")
+		}
 		messages = append(messages, map[string]interface{}{
 			"role":    msg.Role,
-			"content": msg.Content,
+			"content": content,
 		})
 	}
 
@@ -80,6 +104,19 @@ func (a *WorkersChatAgent) Request(ctx context.Context, params *LLMChatParams, c
 		"stream":   onStream != nil,
 	}
 
+	if latestImage != "" {
+		img, err := resolveImage(ctx, cfg, latestImage, false)
+		if err != nil {
+			return nil, fmt.Errorf("failed to prepare image: %w", err)
+		}
+		// Workers AI expects the image as an array of unsigned 8-bit integers
+		imageBytes := make([]int, len(img.Data))
+		for i, b := range img.Data {
+			imageBytes[i] = int(b)
+		}
+		reqBody["image"] = imageBytes
+	}
+
 	// Add extra parameters
 	if cfg.WorkersChatExtraParams != nil {
 		for k, v := range cfg.WorkersChatExtraParams {
@@ -87,6 +124,10 @@ func (a *WorkersChatAgent) Request(ctx context.Context, params *LLMChatParams, c
 		}
 	}
 
+	if params.MaxTokens > 0 {
+		reqBody["max_tokens"] = params.MaxTokens
+	}
+
 	bodyBytes, err := json.Marshal(reqBody)
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal request: %w", err)
@@ -125,7 +166,7 @@ func (a *WorkersChatAgent) Request(ctx context.Context, params *LLMChatParams, c
 
 func (a *WorkersChatAgent) handleStreamResponse(body io.Reader, onStream ChatStreamTextHandler) (*ChatAgentResponse, error) {
 	var fullText strings.Builder
-	decoder := json.NewDecoder(body)
+	decoder := newStreamDecoder(body)
 
 	for {
 		var line map[string]interface{}
@@ -136,13 +177,15 @@ func (a *WorkersChatAgent) handleStreamResponse(body io.Reader, onStream ChatStr
 			return nil, fmt.Errorf("failed to decode stream: %w", err)
 		}
 
-		// Workers AI streaming format
+		// Workers AI streams {"response": "..."} events; older responses wrap them in "result"
+		event := line
 		if result, ok := line["result"].(map[string]interface{}); ok {
-			if response, ok := result["response"].(string); ok {
-				fullText.WriteString(response)
-				if err := onStream(response); err != nil {
-					return nil, fmt.Errorf("stream handler error: %w", err)
-				}
+			event = result
+		}
+		if response, ok := event["response"].(string); ok && response != "" {
+			fullText.WriteString(response)
+			if err := onStream(response); err != nil {
+				return nil, fmt.Errorf("stream handler error: %w", err)
 			}
 		}
 	}
@@ -178,6 +221,9 @@ func (a *WorkersChatAgent) handleNonStreamResponse(body io.Reader) (*ChatAgentRe
 	}, nil
 }
 
+// workersImageMaxImages is the maximum number of images generated for a single request
+const workersImageMaxImages = 4
+
 // WorkersImageAgent implements ImageAgent for Cloudflare Workers AI
 type WorkersImageAgent struct{}
 
@@ -212,7 +258,37 @@ func (a *WorkersImageAgent) ModelList(cfg *config.Config) ([]string, error) {
 	}, nil
 }
 
-func (a *WorkersImageAgent) Request(ctx context.Context, prompt string, cfg *config.Config) (string, error) {
+func (a *WorkersImageAgent) ValidateParams(params *ImageGenParams, cfg *config.Config) error {
+	if params.N <= 0 {
+		params.N = 1
+	}
+	if params.N > workersImageMaxImages {
+		return fmt.Errorf("%s supports at most %d images per request", a.Name(), workersImageMaxImages)
+	}
+	if params.Quality != "" || params.Style != "" {
+		return fmt.Errorf("%s does not support quality or style options", a.Name())
+	}
+
+	// Validate the requested dimensions, or the dimensions derived from the aspect ratio
+	var width, height int
+	var err error
+	if params.Size != "" {
+		width, height, err = parseImageSize(params.Size)
+	} else if params.AspectRatio != "" {
+		width, height, err = aspectRatioToSize(params.AspectRatio, 1024)
+	} else {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if width < 256 || width > 2048 || height < 256 || height > 2048 {
+		return fmt.Errorf("%s supports sizes between 256 and 2048 pixels per side", a.Name())
+	}
+	return nil
+}
+
+func (a *WorkersImageAgent) Request(ctx context.Context, params *ImageGenParams, cfg *config.Config) (*ImageGenResponse, error) {
 	// Build Workers AI endpoint
 	endpoint := fmt.Sprintf("https://api.cloudflare.com/client/v4/accounts/%s/ai/run/%s",
 		cfg.CloudflareAccountID,
@@ -221,18 +297,57 @@ func (a *WorkersImageAgent) Request(ctx context.Context, prompt string, cfg *con
 
 	// Build request body
 	reqBody := map[string]interface{}{
-		"prompt": prompt,
+		"prompt": params.Prompt,
+	}
+
+	var width, height int
+	if params.Size != "" {
+		width, height, _ = parseImageSize(params.Size)
+	} else if params.AspectRatio != "" {
+		width, height, _ = aspectRatioToSize(params.AspectRatio, 1024)
+	}
+	if width > 0 && height > 0 {
+		reqBody["width"] = width
+		reqBody["height"] = height
+	}
+
+	// Workers AI generates one image per call
+	n := params.N
+	if n <= 0 {
+		n = 1
+	}
+	images := make([]GeneratedImage, n)
+	errs := make([]error, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			images[i], errs[i] = a.requestImage(ctx, endpoint, reqBody, cfg)
+		}(i)
 	}
+	wg.Wait()
 
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &ImageGenResponse{Images: images}, nil
+}
+
+// requestImage performs a single generation call
+func (a *WorkersImageAgent) requestImage(ctx context.Context, endpoint string, reqBody map[string]interface{}, cfg *config.Config) (GeneratedImage, error) {
 	bodyBytes, err := json.Marshal(reqBody)
 	if err != nil {
-		return "", fmt.Errorf("failed to marshal request: %w", err)
+		return GeneratedImage{}, fmt.Errorf("failed to marshal request: %w", err)
 	}
 
 	// Create HTTP request
 	req, err := http.NewRequestWithContext(ctx, "POST", endpoint, bytes.NewReader(bodyBytes))
 	if err != nil {
-		return "", fmt.Errorf("failed to create request: %w", err)
+		return GeneratedImage{}, fmt.Errorf("failed to create request: %w", err)
 	}
 
 	req.Header.Set("Content-Type", "application/json")
@@ -242,21 +357,36 @@ func (a *WorkersImageAgent) Request(ctx context.Context, prompt string, cfg *con
 	client := CreateHTTPClient(cfg)
 	resp, err := client.Do(req)
 	if err != nil {
-		return "", fmt.Errorf("failed to send request: %w", err)
+		return GeneratedImage{}, fmt.Errorf("failed to send request: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
-		return "", fmt.Errorf("API request failed with status %d: %s", resp.StatusCode, string(body))
+		return GeneratedImage{}, fmt.Errorf("API request failed with status %d: %s", resp.StatusCode, string(body))
+	}
+
+	// Some models (e.g. flux) return JSON with a base64 image, others return binary image data
+	if strings.HasPrefix(resp.Header.Get("Content-Type"), "application/json") {
+		var response struct {
+			Result struct {
+				Image string `json:"image"`
+			} `json:"result"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+			return GeneratedImage{}, fmt.Errorf("failed to decode response: %w", err)
+		}
+		imageData, err := base64.StdEncoding.DecodeString(response.Result.Image)
+		if err != nil {
+			return GeneratedImage{}, fmt.Errorf("failed to decode image data: %w", err)
+		}
+		return GeneratedImage{Data: imageData}, nil
 	}
 
-	// Workers AI returns binary image data
 	imageData, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return "", fmt.Errorf("failed to read image data: %w", err)
+		return GeneratedImage{}, fmt.Errorf("failed to read image data: %w", err)
 	}
 
-	// Return as base64
-	return string(imageData), nil
+	return GeneratedImage{Data: imageData}, nil
 }
@@ -0,0 +1,32 @@
+package agent
+
+import (
+	"testing"
+
+	"github.com/tbxark/ChatGPT-Telegram-Workers/go_version/internal/config"
+)
+
+func TestWorkersImageAgent_ValidateParams(t *testing.T) {
+	agent := &WorkersImageAgent{}
+	tests := []struct {
+		name    string
+		params  ImageGenParams
+		wantErr bool
+	}{
+		{"default size", ImageGenParams{}, false},
+		{"size in bounds", ImageGenParams{Size: "512x768"}, false},
+		{"size out of bounds", ImageGenParams{Size: "4096x1024"}, true},
+		{"aspect ratio in bounds", ImageGenParams{AspectRatio: "16:9"}, false},
+		{"aspect ratio out of bounds", ImageGenParams{AspectRatio: "16:1"}, true},
+		{"invalid aspect ratio", ImageGenParams{AspectRatio: "wide"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := agent.ValidateParams(&tt.params, &config.Config{})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateParams() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -101,6 +101,25 @@ type Config struct {
 	UpdateBranch           string `env:"UPDATE_BRANCH" default:"master"`
 	ChatCompleteAPITimeout int    `env:"CHAT_COMPLETE_API_TIMEOUT" default:"0"`
 
+	// Response Cache Configuration
+	ResponseCacheEnabled        bool    `env:"RESPONSE_CACHE_ENABLED" default:"false"`
+	ResponseCacheTTL            int     `env:"RESPONSE_CACHE_TTL" default:"86400"`
+	ResponseCacheMaxTemperature float64 `env:"RESPONSE_CACHE_MAX_TEMPERATURE" default:"0.3"`
+
+	// Chat Queue Configuration
+	ChatQueueConcurrency    int `env:"CHAT_QUEUE_CONCURRENCY" default:"8"`
+	ChatQueueMaxPending     int `env:"CHAT_QUEUE_MAX_PENDING" default:"10"`
+	ChatQueueCoalesceWindow int `env:"CHAT_QUEUE_COALESCE_WINDOW" default:"0"`
+	MediaGroupWindow        int `env:"MEDIA_GROUP_WINDOW" default:"1000"`
+
+	// Inline Mode Configuration
+	InlineQueryEnable    bool   `env:"INLINE_QUERY_ENABLE" default:"true"`
+	InlineQueryModel     string `env:"INLINE_QUERY_MODEL"`
+	InlineQueryMaxTokens int    `env:"INLINE_QUERY_MAX_TOKENS" default:"300"`
+	InlineQueryDebounce  int    `env:"INLINE_QUERY_DEBOUNCE" default:"800"`
+	InlineQueryCacheTime int    `env:"INLINE_QUERY_CACHE_TIME" default:"60"`
+	InlineQueryUserLimit int    `env:"INLINE_QUERY_USER_LIMIT" default:"0"`
+
 	// Telegram Configuration
 	TelegramAPIDomain         string   `env:"TELEGRAM_API_DOMAIN" default:"https://api.telegram.org"`
 	TelegramAvailableTokens   []string `env:"TELEGRAM_AVAILABLE_TOKENS" required:"true"`
@@ -108,6 +127,8 @@ type Config struct {
 	TelegramMinStreamInterval int      `env:"TELEGRAM_MIN_STREAM_INTERVAL" default:"0"`
 	TelegramPhotoSizeOffset   int      `env:"TELEGRAM_PHOTO_SIZE_OFFSET" default:"1"`
 	TelegramImageTransferMode string   `env:"TELEGRAM_IMAGE_TRANSFER_MODE" default:"base64"`
+	VisionImageMaxDimension   int      `env:"VISION_IMAGE_MAX_DIMENSION" default:"2048"`
+	VisionImageMaxBytes       int      `env:"VISION_IMAGE_MAX_BYTES" default:"3145728"`
 	ModelListColumns          int      `env:"MODEL_LIST_COLUMNS" default:"1"`
 
 	// Permission Configuration
@@ -121,6 +142,11 @@ type Config struct {
 	GroupChatBotEnable    bool     `env:"GROUP_CHAT_BOT_ENABLE" default:"true"`
 	GroupChatBotShareMode bool     `env:"GROUP_CHAT_BOT_SHARE_MODE" default:"true"`
 
+	// Group Trigger Configuration
+	GroupChatTriggerMode        []string `env:"GROUP_CHAT_TRIGGER_MODE" default:"mention,reply"`
+	GroupChatTriggerKeywords    []string `env:"GROUP_CHAT_TRIGGER_KEYWORDS"`
+	GroupChatTriggerProbability float64  `env:"GROUP_CHAT_TRIGGER_PROBABILITY" default:"0"`
+
 	// History Configuration
 	AutoTrimHistory         bool   `env:"AUTO_TRIM_HISTORY" default:"true"`
 	MaxHistoryLength        int    `env:"MAX_HISTORY_LENGTH" default:"20"`
@@ -132,6 +158,8 @@ type Config struct {
 	ShowReplyButton             bool     `env:"SHOW_REPLY_BUTTON" default:"false"`
 	ExtraMessageContext         bool     `env:"EXTRA_MESSAGE_CONTEXT" default:"false"`
 	ExtraMessageMediaCompatible []string `env:"EXTRA_MESSAGE_MEDIA_COMPATIBLE" default:"image"`
+	ReanswerEditedMessage       bool     `env:"REANSWER_EDITED_MESSAGE" default:"true"`
+	ReplyBranching              bool     `env:"REPLY_BRANCHING" default:"false"`
 
 	// Mode Switches
 	StreamMode bool `env:"STREAM_MODE" default:"true"`
@@ -155,6 +183,17 @@ type Config struct {
 	SummaryThreshold float64 `env:"SUMMARY_THRESHOLD" default:"0.8"`
 	MinRecentPairs   int     `env:"MIN_RECENT_PAIRS" default:"2"`
 
+	// SillyTavern World Info Budget
+	WorldInfoBudget        int `env:"WORLD_INFO_BUDGET" default:"0"`
+	WorldInfoBudgetPercent int `env:"WORLD_INFO_BUDGET_PERCENT" default:"25"`
+
+	// SillyTavern Persona Position
+	PersonaPosition string `env:"PERSONA_POSITION" default:"in_prompt"` // in_prompt, none
+
+	// SillyTavern Character Groups
+	CharacterGroupStrategy   string `env:"CHARACTER_GROUP_STRATEGY" default:"natural"` // natural, list, random
+	CharacterGroupNamePrefix bool   `env:"CHARACTER_GROUP_NAME_PREFIX" default:"true"`
+
 	// Manager Configuration
 	ManagerPort    int  `env:"MANAGER_PORT" default:"8081"`
 	ManagerEnabled bool `env:"MANAGER_ENABLED" default:"true"`
@@ -266,6 +305,25 @@ func LoadConfig() (*Config, error) {
 	cfg.UpdateBranch = getEnvOrDefault("UPDATE_BRANCH", "master")
 	cfg.ChatCompleteAPITimeout = getEnvInt("CHAT_COMPLETE_API_TIMEOUT", 0)
 
+	// Response cache
+	cfg.ResponseCacheEnabled = getEnvBool("RESPONSE_CACHE_ENABLED", false)
+	cfg.ResponseCacheTTL = getEnvInt("RESPONSE_CACHE_TTL", 86400)
+	cfg.ResponseCacheMaxTemperature = getEnvFloat64("RESPONSE_CACHE_MAX_TEMPERATURE", 0.3)
+
+	// Chat queue
+	cfg.ChatQueueConcurrency = getEnvInt("CHAT_QUEUE_CONCURRENCY", 8)
+	cfg.ChatQueueMaxPending = getEnvInt("CHAT_QUEUE_MAX_PENDING", 10)
+	cfg.ChatQueueCoalesceWindow = getEnvInt("CHAT_QUEUE_COALESCE_WINDOW", 0)
+	cfg.MediaGroupWindow = getEnvInt("MEDIA_GROUP_WINDOW", 1000)
+
+	// Inline mode
+	cfg.InlineQueryEnable = getEnvBool("INLINE_QUERY_ENABLE", true)
+	cfg.InlineQueryModel = os.Getenv("INLINE_QUERY_MODEL")
+	cfg.InlineQueryMaxTokens = getEnvInt("INLINE_QUERY_MAX_TOKENS", 300)
+	cfg.InlineQueryDebounce = getEnvInt("INLINE_QUERY_DEBOUNCE", 800)
+	cfg.InlineQueryCacheTime = getEnvInt("INLINE_QUERY_CACHE_TIME", 60)
+	cfg.InlineQueryUserLimit = getEnvInt("INLINE_QUERY_USER_LIMIT", 0)
+
 	// Telegram
 	cfg.TelegramAPIDomain = getEnvOrDefault("TELEGRAM_API_DOMAIN", "https://api.telegram.org")
 	cfg.TelegramAvailableTokens = getEnvSlice("TELEGRAM_AVAILABLE_TOKENS")
@@ -273,6 +331,8 @@ func LoadConfig() (*Config, error) {
 	cfg.TelegramMinStreamInterval = getEnvInt("TELEGRAM_MIN_STREAM_INTERVAL", 0)
 	cfg.TelegramPhotoSizeOffset = getEnvInt("TELEGRAM_PHOTO_SIZE_OFFSET", 1)
 	cfg.TelegramImageTransferMode = getEnvOrDefault("TELEGRAM_IMAGE_TRANSFER_MODE", "base64")
+	cfg.VisionImageMaxDimension = getEnvInt("VISION_IMAGE_MAX_DIMENSION", 2048)
+	cfg.VisionImageMaxBytes = getEnvInt("VISION_IMAGE_MAX_BYTES", 3145728)
 	cfg.ModelListColumns = getEnvInt("MODEL_LIST_COLUMNS", 1)
 
 	// Permissions
@@ -288,6 +348,9 @@ func LoadConfig() (*Config, error) {
 	cfg.ChatGroupWhiteList = getEnvSlice("CHAT_GROUP_WHITE_LIST")
 	cfg.GroupChatBotEnable = getEnvBool("GROUP_CHAT_BOT_ENABLE", true)
 	cfg.GroupChatBotShareMode = getEnvBool("GROUP_CHAT_BOT_SHARE_MODE", true)
+	cfg.GroupChatTriggerMode = toStringList(getEnvSliceOrDefault("GROUP_CHAT_TRIGGER_MODE", []string{GroupTriggerMention, GroupTriggerReply}))
+	cfg.GroupChatTriggerKeywords = toStringList(getEnvSlice("GROUP_CHAT_TRIGGER_KEYWORDS"))
+	cfg.GroupChatTriggerProbability = getEnvFloat64("GROUP_CHAT_TRIGGER_PROBABILITY", 0)
 
 	// History
 	cfg.AutoTrimHistory = getEnvBool("AUTO_TRIM_HISTORY", true)
@@ -300,6 +363,8 @@ func LoadConfig() (*Config, error) {
 	cfg.ShowReplyButton = getEnvBool("SHOW_REPLY_BUTTON", false)
 	cfg.ExtraMessageContext = getEnvBool("EXTRA_MESSAGE_CONTEXT", false)
 	cfg.ExtraMessageMediaCompatible = getEnvSliceOrDefault("EXTRA_MESSAGE_MEDIA_COMPATIBLE", []string{"image"})
+	cfg.ReanswerEditedMessage = getEnvBool("REANSWER_EDITED_MESSAGE", true)
+	cfg.ReplyBranching = getEnvBool("REPLY_BRANCHING", false)
 
 	// Modes
 	cfg.StreamMode = getEnvBool("STREAM_MODE", true)
@@ -323,6 +388,17 @@ func LoadConfig() (*Config, error) {
 	cfg.SummaryThreshold = getEnvFloat64("SUMMARY_THRESHOLD", 0.8)
 	cfg.MinRecentPairs = getEnvInt("MIN_RECENT_PAIRS", 2)
 
+	// SillyTavern World Info Budget
+	cfg.WorldInfoBudget = getEnvInt("WORLD_INFO_BUDGET", 0)
+	cfg.WorldInfoBudgetPercent = getEnvInt("WORLD_INFO_BUDGET_PERCENT", 25)
+
+	// SillyTavern Persona Position
+	cfg.PersonaPosition = getEnvOrDefault("PERSONA_POSITION", "in_prompt")
+
+	// SillyTavern Character Groups
+	cfg.CharacterGroupStrategy = getEnvOrDefault("CHARACTER_GROUP_STRATEGY", "natural")
+	cfg.CharacterGroupNamePrefix = getEnvBool("CHARACTER_GROUP_NAME_PREFIX", true)
+
 	// Manager Configuration
 	cfg.ManagerPort = getEnvInt("MANAGER_PORT", 8081)
 	cfg.ManagerEnabled = getEnvBool("MANAGER_ENABLED", true)
@@ -360,6 +436,59 @@ func Validate(cfg *Config) error {
 		return fmt.Errorf("TELEGRAM_IMAGE_TRANSFER_MODE must be 'url' or 'base64', got '%s'", cfg.TelegramImageTransferMode)
 	}
 
+	// Validate vision image limits (0 disables the limit)
+	if cfg.VisionImageMaxDimension < 0 {
+		return fmt.Errorf("VISION_IMAGE_MAX_DIMENSION must be non-negative, got %d", cfg.VisionImageMaxDimension)
+	}
+	if cfg.VisionImageMaxBytes < 0 {
+		return fmt.Errorf("VISION_IMAGE_MAX_BYTES must be non-negative, got %d", cfg.VisionImageMaxBytes)
+	}
+
+	// Validate response cache
+	if cfg.ResponseCacheEnabled && cfg.ResponseCacheTTL <= 0 {
+		return fmt.Errorf("RESPONSE_CACHE_TTL must be positive, got %d", cfg.ResponseCacheTTL)
+	}
+	if cfg.ResponseCacheMaxTemperature < 0 {
+		return fmt.Errorf("RESPONSE_CACHE_MAX_TEMPERATURE must be non-negative, got %g", cfg.ResponseCacheMaxTemperature)
+	}
+
+	// Validate chat queue (0 disables the limit)
+	if cfg.ChatQueueConcurrency < 0 {
+		return fmt.Errorf("CHAT_QUEUE_CONCURRENCY must be non-negative, got %d", cfg.ChatQueueConcurrency)
+	}
+	if cfg.ChatQueueMaxPending < 0 {
+		return fmt.Errorf("CHAT_QUEUE_MAX_PENDING must be non-negative, got %d", cfg.ChatQueueMaxPending)
+	}
+	if cfg.ChatQueueCoalesceWindow < 0 {
+		return fmt.Errorf("CHAT_QUEUE_COALESCE_WINDOW must be non-negative, got %d", cfg.ChatQueueCoalesceWindow)
+	}
+	if cfg.MediaGroupWindow < 0 {
+		return fmt.Errorf("MEDIA_GROUP_WINDOW must be non-negative, got %d", cfg.MediaGroupWindow)
+	}
+
+	// Validate inline mode (0 disables the token and user limits)
+	if cfg.InlineQueryMaxTokens < 0 {
+		return fmt.Errorf("INLINE_QUERY_MAX_TOKENS must be non-negative, got %d", cfg.InlineQueryMaxTokens)
+	}
+	if cfg.InlineQueryDebounce < 0 {
+		return fmt.Errorf("INLINE_QUERY_DEBOUNCE must be non-negative, got %d", cfg.InlineQueryDebounce)
+	}
+	if cfg.InlineQueryCacheTime < 0 {
+		return fmt.Errorf("INLINE_QUERY_CACHE_TIME must be non-negative, got %d", cfg.InlineQueryCacheTime)
+	}
+	if cfg.InlineQueryUserLimit < 0 {
+		return fmt.Errorf("INLINE_QUERY_USER_LIMIT must be non-negative, got %d", cfg.InlineQueryUserLimit)
+	}
+
+	// Validate group trigger
+	if err := ValidateGroupTrigger(GroupTrigger{
+		Modes:       cfg.GroupChatTriggerMode,
+		Keywords:    cfg.GroupChatTriggerKeywords,
+		Probability: cfg.GroupChatTriggerProbability,
+	}); err != nil {
+		return err
+	}
+
 	// Validate language
 	validLanguages := map[string]bool{
 		"zh-cn":   true,
@@ -384,6 +513,27 @@ func Validate(cfg *Config) error {
 		return fmt.Errorf("MIN_RECENT_PAIRS must be non-negative, got %d", cfg.MinRecentPairs)
 	}
 
+	if cfg.WorldInfoBudget < 0 {
+		return fmt.Errorf("WORLD_INFO_BUDGET must be non-negative, got %d", cfg.WorldInfoBudget)
+	}
+
+	if cfg.WorldInfoBudgetPercent < 0 || cfg.WorldInfoBudgetPercent > 100 {
+		return fmt.Errorf("WORLD_INFO_BUDGET_PERCENT must be between 0 and 100, got %d", cfg.WorldInfoBudgetPercent)
+	}
+
+	// Chats have a single system prompt and no author's note: the persona follows the character or is left out
+	switch cfg.PersonaPosition {
+	case "", "in_prompt", "none":
+	default:
+		return fmt.Errorf("PERSONA_POSITION must be in_prompt or none, got %s", cfg.PersonaPosition)
+	}
+
+	switch cfg.CharacterGroupStrategy {
+	case "", "natural", "list", "random":
+	default:
+		return fmt.Errorf("CHARACTER_GROUP_STRATEGY must be one of natural, list or random, got %s", cfg.CharacterGroupStrategy)
+	}
+
 	// Validate Manager configuration
 	if cfg.ManagerPort < 1 || cfg.ManagerPort > 65535 {
 		return fmt.Errorf("MANAGER_PORT must be between 1 and 65535, got %d", cfg.ManagerPort)
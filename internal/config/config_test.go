@@ -50,6 +50,26 @@ func TestLoadConfig(t *testing.T) {
 		t.Errorf("Expected MinRecentPairs to be 2, got %d", cfg.MinRecentPairs)
 	}
 
+	if cfg.WorldInfoBudget != 0 {
+		t.Errorf("Expected WorldInfoBudget to be 0, got %d", cfg.WorldInfoBudget)
+	}
+
+	if cfg.WorldInfoBudgetPercent != 25 {
+		t.Errorf("Expected WorldInfoBudgetPercent to be 25, got %d", cfg.WorldInfoBudgetPercent)
+	}
+
+	if cfg.PersonaPosition != "in_prompt" {
+		t.Errorf("Expected PersonaPosition to be in_prompt, got %s", cfg.PersonaPosition)
+	}
+
+	if cfg.CharacterGroupStrategy != "natural" {
+		t.Errorf("Expected CharacterGroupStrategy to be natural, got %s", cfg.CharacterGroupStrategy)
+	}
+
+	if !cfg.CharacterGroupNamePrefix {
+		t.Error("Expected CharacterGroupNamePrefix to be true")
+	}
+
 	// Check Manager configuration defaults
 	if cfg.ManagerPort != 8081 {
 		t.Errorf("Expected ManagerPort to be 8081, got %d", cfg.ManagerPort)
@@ -220,6 +240,86 @@ func TestValidate(t *testing.T) {
 			},
 			wantErr: true,
 		},
+		{
+			name: "invalid world info budget",
+			config: &Config{
+				TelegramAvailableTokens:   []string{"123456:ABC"},
+				Port:                      8080,
+				DefaultParseMode:          "Markdown",
+				TelegramImageTransferMode: "base64",
+				Language:                  "zh-cn",
+				MaxContextLength:          8000,
+				SummaryThreshold:          0.8,
+				MinRecentPairs:            2,
+				WorldInfoBudget:           -1,
+				ManagerPort:               8081,
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid world info budget percent",
+			config: &Config{
+				TelegramAvailableTokens:   []string{"123456:ABC"},
+				Port:                      8080,
+				DefaultParseMode:          "Markdown",
+				TelegramImageTransferMode: "base64",
+				Language:                  "zh-cn",
+				MaxContextLength:          8000,
+				SummaryThreshold:          0.8,
+				MinRecentPairs:            2,
+				WorldInfoBudgetPercent:    101,
+				ManagerPort:               8081,
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid persona position",
+			config: &Config{
+				TelegramAvailableTokens:   []string{"123456:ABC"},
+				Port:                      8080,
+				DefaultParseMode:          "Markdown",
+				TelegramImageTransferMode: "base64",
+				Language:                  "zh-cn",
+				MaxContextLength:          8000,
+				SummaryThreshold:          0.8,
+				MinRecentPairs:            2,
+				PersonaPosition:           "top",
+				ManagerPort:               8081,
+			},
+			wantErr: true,
+		},
+		{
+			name: "unsupported persona position",
+			config: &Config{
+				TelegramAvailableTokens:   []string{"123456:ABC"},
+				Port:                      8080,
+				DefaultParseMode:          "Markdown",
+				TelegramImageTransferMode: "base64",
+				Language:                  "zh-cn",
+				MaxContextLength:          8000,
+				SummaryThreshold:          0.8,
+				MinRecentPairs:            2,
+				PersonaPosition:           "at_depth",
+				ManagerPort:               8081,
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid character group strategy",
+			config: &Config{
+				TelegramAvailableTokens:   []string{"123456:ABC"},
+				Port:                      8080,
+				DefaultParseMode:          "Markdown",
+				TelegramImageTransferMode: "base64",
+				Language:                  "zh-cn",
+				MaxContextLength:          8000,
+				SummaryThreshold:          0.8,
+				MinRecentPairs:            2,
+				CharacterGroupStrategy:    "manual",
+				ManagerPort:               8081,
+			},
+			wantErr: true,
+		},
 		{
 			name: "invalid manager port - too low",
 			config: &Config{
@@ -509,6 +509,26 @@ func getGlobalConfigValue(key string, cfg *Config) interface{} {
 		return cfg.GroupChatBotEnable
 	case "GROUP_CHAT_BOT_SHARE_MODE":
 		return cfg.GroupChatBotShareMode
+	case "GROUP_CHAT_TRIGGER_MODE":
+		return cfg.GroupChatTriggerMode
+	case "GROUP_CHAT_TRIGGER_KEYWORDS":
+		return cfg.GroupChatTriggerKeywords
+	case "GROUP_CHAT_TRIGGER_PROBABILITY":
+		return cfg.GroupChatTriggerProbability
+
+	// Inline mode
+	case "INLINE_QUERY_ENABLE":
+		return cfg.InlineQueryEnable
+	case "INLINE_QUERY_MODEL":
+		return cfg.InlineQueryModel
+	case "INLINE_QUERY_MAX_TOKENS":
+		return cfg.InlineQueryMaxTokens
+	case "INLINE_QUERY_DEBOUNCE":
+		return cfg.InlineQueryDebounce
+	case "INLINE_QUERY_CACHE_TIME":
+		return cfg.InlineQueryCacheTime
+	case "INLINE_QUERY_USER_LIMIT":
+		return cfg.InlineQueryUserLimit
 
 	// History
 	case "AUTO_TRIM_HISTORY":
@@ -527,6 +547,10 @@ func getGlobalConfigValue(key string, cfg *Config) interface{} {
 		return cfg.ShowReplyButton
 	case "EXTRA_MESSAGE_CONTEXT":
 		return cfg.ExtraMessageContext
+	case "REANSWER_EDITED_MESSAGE":
+		return cfg.ReanswerEditedMessage
+	case "REPLY_BRANCHING":
+		return cfg.ReplyBranching
 	case "EXTRA_MESSAGE_MEDIA_COMPATIBLE":
 		return cfg.ExtraMessageMediaCompatible
 
@@ -579,10 +603,46 @@ func MergeUserConfig(globalConfig *Config, userConfig *storage.UserConfig) *Conf
 			if str, ok := value.(string); ok {
 				merged.GoogleChatModel = str
 			}
+		case "WORKERS_CHAT_MODEL":
+			if str, ok := value.(string); ok {
+				merged.WorkersChatModel = str
+			}
+		case "MISTRAL_CHAT_MODEL":
+			if str, ok := value.(string); ok {
+				merged.MistralChatModel = str
+			}
+		case "COHERE_CHAT_MODEL":
+			if str, ok := value.(string); ok {
+				merged.CohereChatModel = str
+			}
+		case "ANTHROPIC_CHAT_MODEL":
+			if str, ok := value.(string); ok {
+				merged.AnthropicChatModel = str
+			}
+		case "DEEPSEEK_CHAT_MODEL":
+			if str, ok := value.(string); ok {
+				merged.DeepSeekChatModel = str
+			}
+		case "GROQ_CHAT_MODEL":
+			if str, ok := value.(string); ok {
+				merged.GroqChatModel = str
+			}
+		case "XAI_CHAT_MODEL":
+			if str, ok := value.(string); ok {
+				merged.XAIChatModel = str
+			}
+		case "SYSTEM_INIT_MESSAGE":
+			if str, ok := value.(string); ok {
+				merged.SystemInitMessage = str
+			}
 		case "STREAM_MODE":
 			if b, ok := value.(bool); ok {
 				merged.StreamMode = b
 			}
+		case "CHARACTER_GROUP_STRATEGY":
+			if str, ok := value.(string); ok {
+				merged.CharacterGroupStrategy = str
+			}
 			// Add more cases as needed for other configurable fields
 		}
 	}
@@ -0,0 +1,183 @@
+package config
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/tbxark/ChatGPT-Telegram-Workers/go_version/internal/storage"
+)
+
+// Group trigger modes decide which group messages the bot responds to
+const (
+	GroupTriggerMention = "mention" // The bot is @-mentioned
+	GroupTriggerReply   = "reply"   // The message replies to one of the bot's messages
+	GroupTriggerKeyword = "keyword" // The message contains a keyword or matches a /regex/
+	GroupTriggerRandom  = "random"  // Randomly, with the trigger probability
+	GroupTriggerAlways  = "always"  // Every message
+)
+
+// Group configuration keys of the trigger settings, named after their environment variables
+const (
+	GroupTriggerModeKey        = "GROUP_CHAT_TRIGGER_MODE"
+	GroupTriggerKeywordsKey    = "GROUP_CHAT_TRIGGER_KEYWORDS"
+	GroupTriggerProbabilityKey = "GROUP_CHAT_TRIGGER_PROBABILITY"
+)
+
+// GroupTriggerModes lists all valid group trigger modes
+var GroupTriggerModes = []string{GroupTriggerMention, GroupTriggerReply, GroupTriggerKeyword, GroupTriggerRandom, GroupTriggerAlways}
+
+// GroupTrigger holds the trigger settings of a group
+type GroupTrigger struct {
+	Modes       []string
+	Keywords    []string // Case-insensitive substrings, or regular expressions written as /pattern/
+	Probability float64  // Chance of responding in random mode, between 0 and 1
+}
+
+// GroupSessionContext returns the session context holding the settings of a whole group,
+// regardless of GROUP_CHAT_BOT_SHARE_MODE and forum topics
+func GroupSessionContext(chatID, botID int64) *storage.SessionContext {
+	return NewSessionContext(chatID, botID, nil, nil)
+}
+
+// ResolveGroupTrigger returns the trigger settings of a group:
+// values set in the group configuration override the global configuration
+func ResolveGroupTrigger(cfg *Config, groupConfig *storage.UserConfig) GroupTrigger {
+	trigger := GroupTrigger{
+		Modes:       cfg.GroupChatTriggerMode,
+		Keywords:    cfg.GroupChatTriggerKeywords,
+		Probability: cfg.GroupChatTriggerProbability,
+	}
+	if groupConfig == nil {
+		return trigger
+	}
+
+	if value, ok := groupConfig.Values[GroupTriggerModeKey]; ok {
+		trigger.Modes = toStringList(value)
+	}
+	if value, ok := groupConfig.Values[GroupTriggerKeywordsKey]; ok {
+		trigger.Keywords = toStringList(value)
+	}
+	if value, ok := groupConfig.Values[GroupTriggerProbabilityKey]; ok {
+		switch v := value.(type) {
+		case float64:
+			trigger.Probability = v
+		case string:
+			if p, err := strconv.ParseFloat(strings.TrimSpace(v), 64); err == nil {
+				trigger.Probability = p
+			}
+		}
+	}
+	return trigger
+}
+
+// ValidateGroupTrigger checks the modes, keyword patterns and probability of trigger settings
+func ValidateGroupTrigger(trigger GroupTrigger) error {
+	for _, mode := range trigger.Modes {
+		valid := false
+		for _, known := range GroupTriggerModes {
+			if mode == known {
+				valid = true
+				break
+			}
+		}
+		if !valid {
+			return fmt.Errorf("GROUP_CHAT_TRIGGER_MODE must be a list of %s, got '%s'", strings.Join(GroupTriggerModes, ", "), mode)
+		}
+	}
+	for _, keyword := range trigger.Keywords {
+		if pattern, ok := keywordPattern(keyword); ok {
+			if _, err := regexp.Compile(pattern); err != nil {
+				return fmt.Errorf("GROUP_CHAT_TRIGGER_KEYWORDS has an invalid pattern %s: %w", keyword, err)
+			}
+		}
+	}
+	if trigger.Probability < 0 || trigger.Probability > 1 {
+		return fmt.Errorf("GROUP_CHAT_TRIGGER_PROBABILITY must be between 0.0 and 1.0, got %g", trigger.Probability)
+	}
+	return nil
+}
+
+// Has reports whether the trigger includes the mode
+func (t GroupTrigger) Has(mode string) bool {
+	for _, m := range t.Modes {
+		if m == mode {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchKeyword reports whether text contains one of the keywords or matches one of the patterns
+func (t GroupTrigger) MatchKeyword(text string) bool {
+	lower := strings.ToLower(text)
+	for _, keyword := range t.Keywords {
+		if pattern, ok := keywordPattern(keyword); ok {
+			if re := compileKeyword(pattern); re != nil && re.MatchString(text) {
+				return true
+			}
+			continue
+		}
+		if keyword != "" && strings.Contains(lower, strings.ToLower(keyword)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Roll reports whether a message is answered in random mode
+func (t GroupTrigger) Roll() bool {
+	return t.Probability > 0 && rand.Float64() < t.Probability
+}
+
+// keywordRegexps caches the compiled keyword patterns, nil for invalid ones, so messages don't recompile them
+var keywordRegexps sync.Map
+
+// compileKeyword returns the compiled regular expression of a keyword pattern, or nil when it is invalid
+func compileKeyword(pattern string) *regexp.Regexp {
+	if cached, ok := keywordRegexps.Load(pattern); ok {
+		return cached.(*regexp.Regexp)
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		re = nil
+	}
+	keywordRegexps.Store(pattern, re)
+	return re
+}
+
+// keywordPattern returns the regular expression of a keyword written as /pattern/
+func keywordPattern(keyword string) (string, bool) {
+	if len(keyword) > 2 && strings.HasPrefix(keyword, "/") && strings.HasSuffix(keyword, "/") {
+		return keyword[1 : len(keyword)-1], true
+	}
+	return "", false
+}
+
+// toStringList converts a configuration value to a list of trimmed, non-empty strings
+func toStringList(value interface{}) []string {
+	var items []string
+	switch v := value.(type) {
+	case string:
+		items = strings.Split(v, ",")
+	case []string:
+		items = v
+	case []interface{}:
+		for _, item := range v {
+			if str, ok := item.(string); ok {
+				items = append(items, str)
+			}
+		}
+	}
+
+	list := make([]string, 0, len(items))
+	for _, item := range items {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
@@ -0,0 +1,76 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/tbxark/ChatGPT-Telegram-Workers/go_version/internal/storage"
+)
+
+func TestResolveGroupTrigger(t *testing.T) {
+	cfg := &Config{
+		GroupChatTriggerMode:        []string{GroupTriggerMention, GroupTriggerReply},
+		GroupChatTriggerKeywords:    []string{"bot"},
+		GroupChatTriggerProbability: 0.1,
+	}
+
+	// Without group settings, the global configuration applies
+	trigger := ResolveGroupTrigger(cfg, nil)
+	if !reflect.DeepEqual(trigger.Modes, cfg.GroupChatTriggerMode) || trigger.Probability != 0.1 {
+		t.Errorf("ResolveGroupTrigger() = %+v, want the global settings", trigger)
+	}
+
+	// Group settings override it
+	trigger = ResolveGroupTrigger(cfg, &storage.UserConfig{Values: map[string]interface{}{
+		GroupTriggerModeKey:        " keyword, random ",
+		GroupTriggerKeywordsKey:    []interface{}{"help", "/^hey/"},
+		GroupTriggerProbabilityKey: "0.5",
+	}})
+	want := GroupTrigger{
+		Modes:       []string{GroupTriggerKeyword, GroupTriggerRandom},
+		Keywords:    []string{"help", "/^hey/"},
+		Probability: 0.5,
+	}
+	if !reflect.DeepEqual(trigger, want) {
+		t.Errorf("ResolveGroupTrigger() = %+v, want %+v", trigger, want)
+	}
+}
+
+func TestValidateGroupTrigger(t *testing.T) {
+	tests := []struct {
+		name    string
+		trigger GroupTrigger
+		wantErr bool
+	}{
+		{"valid", GroupTrigger{Modes: GroupTriggerModes, Keywords: []string{"hi", "/^q:/"}, Probability: 0.3}, false},
+		{"no modes", GroupTrigger{}, false},
+		{"unknown mode", GroupTrigger{Modes: []string{"sometimes"}}, true},
+		{"invalid pattern", GroupTrigger{Keywords: []string{"/(/"}}, true},
+		{"probability out of range", GroupTrigger{Probability: 1.5}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateGroupTrigger(tt.trigger)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateGroupTrigger() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestGroupTrigger_MatchKeyword(t *testing.T) {
+	trigger := GroupTrigger{Keywords: []string{"Weather", "/^q:\\s/"}}
+
+	tests := map[string]bool{
+		"how is the weather?": true,
+		"q: what time is it":  true,
+		"faq: nothing":        false,
+		"hello":               false,
+	}
+	for text, want := range tests {
+		if got := trigger.MatchKeyword(text); got != want {
+			t.Errorf("MatchKeyword(%q) = %v, want %v", text, got, want)
+		}
+	}
+}
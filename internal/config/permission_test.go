@@ -3,6 +3,7 @@ package config
 import (
 	"os"
 	"testing"
+	"time"
 
 	"github.com/tbxark/ChatGPT-Telegram-Workers/go_version/internal/storage"
 )
@@ -71,7 +72,7 @@ func (m *MockStorage) CreateCharacterCard(card *storage.CharacterCard) error {
 	return nil
 }
 
-func (m *MockStorage) GetCharacterCard(userID *int64, cardID uint) (*storage.CharacterCard, error) {
+func (m *MockStorage) GetCharacterCard(cardID uint) (*storage.CharacterCard, error) {
 	return nil, nil
 }
 
@@ -83,7 +84,7 @@ func (m *MockStorage) UpdateCharacterCard(card *storage.CharacterCard) error {
 	return nil
 }
 
-func (m *MockStorage) DeleteCharacterCard(userID *int64, cardID uint) error {
+func (m *MockStorage) DeleteCharacterCard(cardID uint) error {
 	return nil
 }
 
@@ -100,7 +101,7 @@ func (m *MockStorage) CreateWorldBook(book *storage.WorldBook) error {
 	return nil
 }
 
-func (m *MockStorage) GetWorldBook(userID *int64, bookID uint) (*storage.WorldBook, error) {
+func (m *MockStorage) GetWorldBook(bookID uint) (*storage.WorldBook, error) {
 	return nil, nil
 }
 
@@ -112,7 +113,7 @@ func (m *MockStorage) UpdateWorldBook(book *storage.WorldBook) error {
 	return nil
 }
 
-func (m *MockStorage) DeleteWorldBook(userID *int64, bookID uint) error {
+func (m *MockStorage) DeleteWorldBook(bookID uint) error {
 	return nil
 }
 
@@ -145,16 +146,20 @@ func (m *MockStorage) DeleteWorldBookEntry(entryID uint) error {
 	return nil
 }
 
+func (m *MockStorage) UpdateWorldBookEntryStatus(entryID uint, enabled bool) error {
+	return nil
+}
+
 // SillyTavern Preset methods
 func (m *MockStorage) CreatePreset(preset *storage.Preset) error {
 	return nil
 }
 
-func (m *MockStorage) GetPreset(userID *int64, presetID uint) (*storage.Preset, error) {
+func (m *MockStorage) GetPreset(presetID uint) (*storage.Preset, error) {
 	return nil, nil
 }
 
-func (m *MockStorage) ListPresets(userID *int64) ([]*storage.Preset, error) {
+func (m *MockStorage) ListPresets(userID *int64, apiType string) ([]*storage.Preset, error) {
 	return []*storage.Preset{}, nil
 }
 
@@ -162,7 +167,7 @@ func (m *MockStorage) UpdatePreset(preset *storage.Preset) error {
 	return nil
 }
 
-func (m *MockStorage) DeletePreset(userID *int64, presetID uint) error {
+func (m *MockStorage) DeletePreset(presetID uint) error {
 	return nil
 }
 
@@ -179,7 +184,7 @@ func (m *MockStorage) CreateRegexPattern(pattern *storage.RegexPattern) error {
 	return nil
 }
 
-func (m *MockStorage) GetRegexPattern(userID *int64, patternID uint) (*storage.RegexPattern, error) {
+func (m *MockStorage) GetRegexPattern(patternID uint) (*storage.RegexPattern, error) {
 	return nil, nil
 }
 
@@ -191,7 +196,11 @@ func (m *MockStorage) UpdateRegexPattern(pattern *storage.RegexPattern) error {
 	return nil
 }
 
-func (m *MockStorage) DeleteRegexPattern(userID *int64, patternID uint) error {
+func (m *MockStorage) DeleteRegexPattern(patternID uint) error {
+	return nil
+}
+
+func (m *MockStorage) UpdateRegexPatternStatus(patternID uint, enabled bool) error {
 	return nil
 }
 
@@ -212,10 +221,106 @@ func (m *MockStorage) CleanupExpiredTokens() error {
 	return nil
 }
 
+func (m *MockStorage) GetCachedResponse(key string) (string, bool, error) {
+	return "", false, nil
+}
+
+func (m *MockStorage) SaveCachedResponse(key string, response string, ttl int) error {
+	return nil
+}
+
+func (m *MockStorage) RecordUsage(botID int64, provider, model string, cacheHit bool) error {
+	return nil
+}
+
+func (m *MockStorage) TakeInlineQuota(botID, userID int64, limit int) (bool, error) {
+	return true, nil
+}
+
+func (m *MockStorage) GetUsageStats(botID int64, since time.Time) ([]*storage.UsageStat, error) {
+	return nil, nil
+}
+
 func (m *MockStorage) DeleteAllChatHistory() error {
 	return nil
 }
 
+func (m *MockStorage) ArchiveChatHistory(ctx *storage.SessionContext) error {
+	return nil
+}
+
+func (m *MockStorage) RestoreConversation(ctx *storage.SessionContext, id uint) error {
+	return nil
+}
+
+func (m *MockStorage) GetConversation(id uint) (*storage.Conversation, error) {
+	return nil, storage.ErrNotFound
+}
+
+func (m *MockStorage) ListConversations(ctx *storage.SessionContext) ([]*storage.Conversation, error) {
+	return nil, nil
+}
+
+func (m *MockStorage) ListUserConversations(userID int64) ([]*storage.Conversation, error) {
+	return nil, nil
+}
+
+func (m *MockStorage) UpdateConversationTitle(id uint, title string) error {
+	return nil
+}
+
+func (m *MockStorage) DeleteConversation(id uint) error {
+	return nil
+}
+
+func (m *MockStorage) ForkChatHistory(ctx *storage.SessionContext, history []storage.HistoryItem) error {
+	return nil
+}
+
+func (m *MockStorage) ListBranches(ctx *storage.SessionContext) ([]*storage.Branch, error) {
+	return nil, nil
+}
+
+func (m *MockStorage) GetWorldInfoEffects(ctx *storage.SessionContext) ([]*storage.WorldInfoEffect, error) {
+	return nil, nil
+}
+
+func (m *MockStorage) SaveWorldInfoEffects(ctx *storage.SessionContext, effects []*storage.WorldInfoEffect) error {
+	return nil
+}
+
+func (m *MockStorage) NextWorldInfoTurn(ctx *storage.SessionContext) (int, error) {
+	return 0, nil
+}
+
+func (m *MockStorage) CreatePersona(persona *storage.Persona) error {
+	return nil
+}
+
+func (m *MockStorage) GetPersona(id uint) (*storage.Persona, error) {
+	return nil, storage.ErrNotFound
+}
+
+func (m *MockStorage) ListPersonas(userID int64) ([]*storage.Persona, error) {
+	return nil, nil
+}
+
+func (m *MockStorage) UpdatePersona(persona *storage.Persona) error {
+	return nil
+}
+
+func (m *MockStorage) DeletePersona(id uint) error {
+	return nil
+}
+
+func (m *MockStorage) GetActivePersona(userID int64) (*storage.Persona, error) {
+	return nil, nil
+}
+
+func (m *MockStorage) ActivatePersona(userID int64, personaID uint) error {
+	return nil
+}
+
 // MockBotAPI is a mock implementation of the bot API for testing
 type MockBotAPI struct {
 	admins map[int64][]storage.ChatMember
@@ -0,0 +1,71 @@
+package config
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/tbxark/ChatGPT-Telegram-Workers/go_version/internal/storage"
+)
+
+// Topic configuration keys of the bindings set with /topic.
+// Model bindings use the model key of the provider, e.g. OPENAI_CHAT_MODEL.
+const (
+	TopicSystemPromptKey  = "SYSTEM_INIT_MESSAGE"
+	TopicCharacterKey     = "CHARACTER_CARD_ID"
+	TopicGroupKey         = "CHARACTER_GROUP"          // Comma-separated character card IDs, in list order
+	TopicGroupStrategyKey = "CHARACTER_GROUP_STRATEGY" // Overrides CHARACTER_GROUP_STRATEGY
+)
+
+// ChatModelKeys lists the configuration keys of the chat models of all providers
+var ChatModelKeys = []string{
+	"OPENAI_CHAT_MODEL",
+	"AZURE_CHAT_MODEL",
+	"WORKERS_CHAT_MODEL",
+	"GOOGLE_CHAT_MODEL",
+	"MISTRAL_CHAT_MODEL",
+	"COHERE_CHAT_MODEL",
+	"ANTHROPIC_CHAT_MODEL",
+	"DEEPSEEK_CHAT_MODEL",
+	"GROQ_CHAT_MODEL",
+	"XAI_CHAT_MODEL",
+}
+
+// TopicSessionContext returns the session context holding the settings of a forum topic,
+// regardless of GROUP_CHAT_BOT_SHARE_MODE. Thread 0, which no topic has, holds the settings
+// of the chat outside of topics.
+func TopicSessionContext(chatID, botID, threadID int64) *storage.SessionContext {
+	return NewSessionContext(chatID, botID, nil, &threadID)
+}
+
+// TopicCharacterID returns the character card bound to a topic, or 0
+func TopicCharacterID(topicConfig *storage.UserConfig) uint {
+	if topicConfig == nil {
+		return 0
+	}
+	switch v := topicConfig.Values[TopicCharacterKey].(type) {
+	case float64:
+		return uint(v)
+	case string:
+		id, err := strconv.ParseUint(strings.TrimSpace(v), 10, 32)
+		if err == nil {
+			return uint(id)
+		}
+	}
+	return 0
+}
+
+// TopicGroupIDs returns the character cards of the group bound to a topic, in list order, or nil
+func TopicGroupIDs(topicConfig *storage.UserConfig) []uint {
+	if topicConfig == nil {
+		return nil
+	}
+	value, _ := topicConfig.Values[TopicGroupKey].(string)
+
+	var ids []uint
+	for _, field := range strings.Split(value, ",") {
+		if id, err := strconv.ParseUint(strings.TrimSpace(field), 10, 32); err == nil && id != 0 {
+			ids = append(ids, uint(id))
+		}
+	}
+	return ids
+}
@@ -0,0 +1,70 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/tbxark/ChatGPT-Telegram-Workers/go_version/internal/storage"
+)
+
+func TestTopicCharacterID(t *testing.T) {
+	tests := []struct {
+		name   string
+		config *storage.UserConfig
+		want   uint
+	}{
+		{"no config", nil, 0},
+		{"unbound", &storage.UserConfig{Values: map[string]interface{}{}}, 0},
+		{"string", &storage.UserConfig{Values: map[string]interface{}{TopicCharacterKey: " 12 "}}, 12},
+		{"number", &storage.UserConfig{Values: map[string]interface{}{TopicCharacterKey: float64(3)}}, 3},
+		{"invalid", &storage.UserConfig{Values: map[string]interface{}{TopicCharacterKey: "alice"}}, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := TopicCharacterID(tt.config); got != tt.want {
+				t.Errorf("TopicCharacterID() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTopicGroupIDs(t *testing.T) {
+	tests := []struct {
+		name   string
+		config *storage.UserConfig
+		want   []uint
+	}{
+		{"no config", nil, nil},
+		{"unbound", &storage.UserConfig{Values: map[string]interface{}{}}, nil},
+		{"list", &storage.UserConfig{Values: map[string]interface{}{TopicGroupKey: "3, 1,2"}}, []uint{3, 1, 2}},
+		{"invalid ids skipped", &storage.UserConfig{Values: map[string]interface{}{TopicGroupKey: "4,bob,,0"}}, []uint{4}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := TopicGroupIDs(tt.config); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("TopicGroupIDs() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMergeUserConfig_TopicBindings(t *testing.T) {
+	global := &Config{SystemInitMessage: "global", AnthropicChatModel: "claude"}
+	merged := MergeUserConfig(global, &storage.UserConfig{Values: map[string]interface{}{
+		TopicSystemPromptKey:   "topic",
+		TopicGroupStrategyKey:  "list",
+		"ANTHROPIC_CHAT_MODEL": "claude-topic",
+	}})
+
+	if merged.SystemInitMessage != "topic" || merged.AnthropicChatModel != "claude-topic" {
+		t.Errorf("MergeUserConfig() = %q, %q, want the topic bindings", merged.SystemInitMessage, merged.AnthropicChatModel)
+	}
+	if merged.CharacterGroupStrategy != "list" {
+		t.Errorf("MergeUserConfig() strategy = %q, want list", merged.CharacterGroupStrategy)
+	}
+	if global.SystemInitMessage != "global" {
+		t.Error("MergeUserConfig() modified the global configuration")
+	}
+}
@@ -10,7 +10,7 @@ func en() *I18n {
 	i.Command.Help.Help = "Get command help"
 	i.Command.Help.New = "Start a new conversation"
 	i.Command.Help.Start = "Get your ID and start a new conversation"
-	i.Command.Help.Img = "Generate an image, the complete command format is `/img image description`, for example `/img beach at moonlight`"
+	i.Command.Help.Img = "Generate images, the complete command format is `/img [options] image description`, for example `/img beach at moonlight`. Options: `--n 4` number of images, `--ar 16:9` aspect ratio, `--size 1024x1024`, `--quality hd`, `--style natural`"
 	i.Command.Help.Version = "Get the current version number to determine whether to update"
 	i.Command.Help.Setenv = "Set user configuration, the complete command format is /setenv KEY=VALUE"
 	i.Command.Help.Setenvs = "Batch set user configurations, the full format of the command is /setenvs {\"KEY1\": \"VALUE1\", \"KEY2\": \"VALUE2\"}"
@@ -20,13 +20,65 @@ func en() *I18n {
 	i.Command.Help.Redo = "Redo the last conversation, /redo with modified content or directly /redo"
 	i.Command.Help.Echo = "Echo the message"
 	i.Command.Help.Models = "switch chat model"
+	i.Command.Help.Chats = "List archived conversations to switch to or delete them"
+	i.Command.Help.Branches = "Show the branches of the conversation to switch between them"
+	i.Command.Help.Trigger = "Set when the bot responds in this group"
+	i.Command.Help.Topic = "Set the model, prompt or character of this topic or chat"
+	i.Command.Help.Persona = "Set the persona characters know you by"
 
 	i.Command.New.NewChatStart = "A new conversation has started"
+	i.Command.Chats.Summary = "Archived conversations, choose one to switch to it:"
+	i.Command.Chats.Empty = "No archived conversations yet, /new archives the current one"
+	i.Command.Chats.Switched = "Switched to conversation: %s"
+	i.Command.Chats.Deleted = "Conversation deleted"
+	i.Command.Branches.Summary = "Branches of this conversation (number of messages), ▶ marks the current one:"
+	i.Command.Branches.Empty = "This conversation has no branches, reply to an earlier answer to start one"
+	i.Command.Branches.Untitled = "Untitled"
+	i.Command.Trigger.GroupsOnly = "/trigger is only available in groups"
+	i.Command.Trigger.Usage = "usage: /trigger [mode <modes> | keywords [<keywords>] | probability <0-1> | reset]"
+	i.Command.Trigger.InvalidProbability = "invalid probability %q"
+	i.Command.Trigger.Updated = "✅ Trigger updated"
+	i.Command.Trigger.Summary = "Group trigger:"
+	i.Command.Trigger.Mode = "Mode"
+	i.Command.Trigger.Keywords = "Keywords"
+	i.Command.Trigger.Probability = "Probability"
+	i.Command.Trigger.Modes = "Modes"
+	i.Command.Trigger.NoModes = "none (commands only)"
+	i.Command.Trigger.None = "none"
+	i.Command.Topic.Usage = "usage: /topic [model <model> | prompt <text> | character <id or name> | group <ids or names, comma-separated> | strategy <natural|list|random> | reset]"
+	i.Command.Topic.Updated = "✅ Topic updated"
+	i.Command.Topic.Summary = "Topic bindings:"
+	i.Command.Topic.Model = "Model"
+	i.Command.Topic.SystemPrompt = "System prompt"
+	i.Command.Topic.Character = "Character"
+	i.Command.Topic.Group = "Group"
+	i.Command.Topic.TurnOrder = "Turn order"
+	i.Command.Topic.Default = "default"
+	i.Command.Topic.None = "none"
+	i.Command.Topic.CharacterNotFound = "character card %q not found"
+	i.Command.Persona.UsersOnly = "/persona is only available to users"
+	i.Command.Persona.Usage = "usage: /persona [add <name>, with the description on the next lines | use <id or name> | delete <id or name> | off]"
+	i.Command.Persona.Updated = "✅ Persona updated"
+	i.Command.Persona.NotFound = "persona %q not found"
+	i.Command.Persona.Active = "Characters know you as %s."
+	i.Command.Persona.Inactive = "No persona is active, characters know you as %s."
+	i.Command.Persona.List = "Personas:"
+
+	i.Chat.VisionNotSupported = "The current model %s does not support images. Switch to a vision model with /models or send text only."
+
+	i.Inline.LimitTitle = "Daily limit reached"
+	i.Inline.LimitText = "You have used your %d inline answers for today"
+	i.Inline.LimitDescription = "Try again tomorrow or chat with the bot directly"
+	i.Inline.Answer = "Answer"
+	i.Inline.ShortAnswer = "Short answer"
+	i.Inline.FullAnswer = "Open full answer"
 
 	i.CallbackQuery.OpenModelList = "Open models list"
 	i.CallbackQuery.SelectProvider = "Select a provider:"
 	i.CallbackQuery.SelectModel = "Choose model:"
 	i.CallbackQuery.ChangeModel = "Change model to "
+	i.CallbackQuery.Regenerate = "Regenerate"
+	i.CallbackQuery.Continue = "Continue"
 
 	return i
 }
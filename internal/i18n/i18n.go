@@ -16,6 +16,11 @@ type HelpI18n struct {
 	Redo     string
 	Models   string
 	Echo     string
+	Chats    string
+	Branches string
+	Trigger  string
+	Topic    string
+	Persona  string
 }
 
 // I18n contains all internationalized strings
@@ -28,12 +33,71 @@ type I18n struct {
 		New  struct {
 			NewChatStart string
 		}
+		Chats struct {
+			Summary  string
+			Empty    string
+			Switched string
+			Deleted  string
+		}
+		Branches struct {
+			Summary  string
+			Empty    string
+			Untitled string
+		}
+		Trigger struct {
+			GroupsOnly         string
+			Usage              string
+			InvalidProbability string
+			Updated            string
+			Summary            string
+			Mode               string
+			Keywords           string
+			Probability        string
+			Modes              string
+			NoModes            string
+			None               string
+		}
+		Topic struct {
+			Usage             string
+			Updated           string
+			Summary           string
+			Model             string
+			SystemPrompt      string
+			Character         string
+			Group             string
+			TurnOrder         string
+			Default           string
+			None              string
+			CharacterNotFound string
+		}
+		Persona struct {
+			UsersOnly string
+			Usage     string
+			Updated   string
+			NotFound  string
+			Active    string
+			Inactive  string
+			List      string
+		}
+	}
+	Chat struct {
+		VisionNotSupported string
+	}
+	Inline struct {
+		LimitTitle       string
+		LimitText        string
+		LimitDescription string
+		Answer           string
+		ShortAnswer      string
+		FullAnswer       string
 	}
 	CallbackQuery struct {
 		OpenModelList  string
 		SelectProvider string
 		SelectModel    string
 		ChangeModel    string
+		Regenerate     string
+		Continue       string
 	}
 }
 
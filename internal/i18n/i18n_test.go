@@ -129,6 +129,11 @@ func TestAllLanguagesHaveRequiredFields(t *testing.T) {
 				t.Error("Command.New.NewChatStart is empty")
 			}
 
+			// Check Chat fields
+			if i18n.Chat.VisionNotSupported == "" {
+				t.Error("Chat.VisionNotSupported is empty")
+			}
+
 			// Check CallbackQuery fields
 			if i18n.CallbackQuery.OpenModelList == "" {
 				t.Error("CallbackQuery.OpenModelList is empty")
@@ -142,6 +147,27 @@ func TestAllLanguagesHaveRequiredFields(t *testing.T) {
 			if i18n.CallbackQuery.ChangeModel == "" {
 				t.Error("CallbackQuery.ChangeModel is empty")
 			}
+			if i18n.CallbackQuery.Regenerate == "" || i18n.CallbackQuery.Continue == "" {
+				t.Error("CallbackQuery reply button labels are empty")
+			}
+			if i18n.Command.Help.Chats == "" || i18n.Command.Chats.Summary == "" || i18n.Command.Chats.Empty == "" {
+				t.Error("Command.Chats texts are empty")
+			}
+			if i18n.Command.Help.Branches == "" || i18n.Command.Branches.Summary == "" || i18n.Command.Branches.Empty == "" {
+				t.Error("Command.Branches texts are empty")
+			}
+			if i18n.Command.Help.Trigger == "" || i18n.Command.Trigger.Usage == "" || i18n.Command.Trigger.Summary == "" || i18n.Command.Trigger.NoModes == "" {
+				t.Error("Command.Trigger texts are empty")
+			}
+			if i18n.Command.Help.Topic == "" || i18n.Command.Topic.Usage == "" || i18n.Command.Topic.Summary == "" || i18n.Command.Topic.CharacterNotFound == "" {
+				t.Error("Command.Topic texts are empty")
+			}
+			if i18n.Command.Help.Persona == "" || i18n.Command.Persona.Usage == "" || i18n.Command.Persona.Active == "" || i18n.Command.Persona.Inactive == "" {
+				t.Error("Command.Persona texts are empty")
+			}
+			if i18n.Inline.LimitTitle == "" || i18n.Inline.LimitText == "" || i18n.Inline.Answer == "" || i18n.Inline.FullAnswer == "" {
+				t.Error("Inline texts are empty")
+			}
 		})
 	}
 }
@@ -10,7 +10,7 @@ func pt() *I18n {
 	i.Command.Help.Help = "Obter ajuda sobre comandos"
 	i.Command.Help.New = "Iniciar uma nova conversa"
 	i.Command.Help.Start = "Obter seu ID e iniciar uma nova conversa"
-	i.Command.Help.Img = "Gerar uma imagem, o formato completo do comando é `/img descrição da imagem`, por exemplo `/img praia ao luar`"
+	i.Command.Help.Img = "Gerar imagens, o formato completo do comando é `/img [opções] descrição da imagem`, por exemplo `/img praia ao luar`. Opções: `--n 4` número de imagens, `--ar 16:9` proporção, `--size 1024x1024`, `--quality hd`, `--style natural`"
 	i.Command.Help.Version = "Obter o número da versão atual para determinar se é necessário atualizar"
 	i.Command.Help.Setenv = "Definir configuração do usuário, o formato completo do comando é /setenv CHAVE=VALOR"
 	i.Command.Help.Setenvs = "Definir configurações do usuário em lote, o formato completo do comando é /setenvs {\"CHAVE1\": \"VALOR1\", \"CHAVE2\": \"VALOR2\"}"
@@ -20,13 +20,65 @@ func pt() *I18n {
 	i.Command.Help.Redo = "Refazer a última conversa, /redo com conteúdo modificado ou diretamente /redo"
 	i.Command.Help.Echo = "Repetir a mensagem"
 	i.Command.Help.Models = "Mudar o modelo de diálogo"
+	i.Command.Help.Chats = "Listar as conversas arquivadas para alternar ou excluí-las"
+	i.Command.Help.Branches = "Mostrar os ramos da conversa para alternar entre eles"
+	i.Command.Help.Trigger = "Definir quando o bot responde neste grupo"
+	i.Command.Help.Topic = "Definir o modelo, o prompt ou o personagem deste tópico ou chat"
+	i.Command.Help.Persona = "Definir a persona pela qual os personagens conhecem você"
 
 	i.Command.New.NewChatStart = "Uma nova conversa foi iniciada"
+	i.Command.Chats.Summary = "Conversas arquivadas, escolha uma para alternar:"
+	i.Command.Chats.Empty = "Ainda não há conversas arquivadas, /new arquiva a conversa atual"
+	i.Command.Chats.Switched = "Conversa alterada para: %s"
+	i.Command.Chats.Deleted = "Conversa excluída"
+	i.Command.Branches.Summary = "Ramos desta conversa (número de mensagens), ▶ marca o atual:"
+	i.Command.Branches.Empty = "Esta conversa não tem ramos, responda a uma resposta anterior para criar um"
+	i.Command.Branches.Untitled = "Sem título"
+	i.Command.Trigger.GroupsOnly = "/trigger só está disponível em grupos"
+	i.Command.Trigger.Usage = "uso: /trigger [mode <modos> | keywords [<palavras-chave>] | probability <0-1> | reset]"
+	i.Command.Trigger.InvalidProbability = "probabilidade inválida %q"
+	i.Command.Trigger.Updated = "✅ Gatilho atualizado"
+	i.Command.Trigger.Summary = "Gatilho do grupo:"
+	i.Command.Trigger.Mode = "Modo"
+	i.Command.Trigger.Keywords = "Palavras-chave"
+	i.Command.Trigger.Probability = "Probabilidade"
+	i.Command.Trigger.Modes = "Modos"
+	i.Command.Trigger.NoModes = "nenhum (apenas comandos)"
+	i.Command.Trigger.None = "nenhuma"
+	i.Command.Topic.Usage = "uso: /topic [model <modelo> | prompt <texto> | character <id ou nome> | group <ids ou nomes, separados por vírgula> | strategy <natural|list|random> | reset]"
+	i.Command.Topic.Updated = "✅ Tópico atualizado"
+	i.Command.Topic.Summary = "Configurações do tópico:"
+	i.Command.Topic.Model = "Modelo"
+	i.Command.Topic.SystemPrompt = "Prompt do sistema"
+	i.Command.Topic.Character = "Personagem"
+	i.Command.Topic.Group = "Grupo"
+	i.Command.Topic.TurnOrder = "Ordem de fala"
+	i.Command.Topic.Default = "padrão"
+	i.Command.Topic.None = "nenhum"
+	i.Command.Topic.CharacterNotFound = "cartão de personagem %q não encontrado"
+	i.Command.Persona.UsersOnly = "/persona está disponível apenas para usuários"
+	i.Command.Persona.Usage = "uso: /persona [add <nome>, com a descrição nas linhas seguintes | use <id ou nome> | delete <id ou nome> | off]"
+	i.Command.Persona.Updated = "✅ Persona atualizada"
+	i.Command.Persona.NotFound = "persona %q não encontrada"
+	i.Command.Persona.Active = "Os personagens conhecem você como %s."
+	i.Command.Persona.Inactive = "Nenhuma persona ativa, os personagens conhecem você como %s."
+	i.Command.Persona.List = "Personas:"
+
+	i.Chat.VisionNotSupported = "O modelo atual %s não suporta imagens. Mude para um modelo com visão usando /models ou envie apenas texto."
+
+	i.Inline.LimitTitle = "Limite diário atingido"
+	i.Inline.LimitText = "Você usou suas %d respostas inline de hoje"
+	i.Inline.LimitDescription = "Tente novamente amanhã ou converse diretamente com o bot"
+	i.Inline.Answer = "Resposta"
+	i.Inline.ShortAnswer = "Resposta curta"
+	i.Inline.FullAnswer = "Abrir resposta completa"
 
 	i.CallbackQuery.OpenModelList = "Abra a lista de modelos"
 	i.CallbackQuery.SelectProvider = "Escolha um fornecedor de modelos.:"
 	i.CallbackQuery.SelectModel = "Escolha um modelo:"
 	i.CallbackQuery.ChangeModel = "O modelo de diálogo já foi modificado para"
+	i.CallbackQuery.Regenerate = "Regenerar"
+	i.CallbackQuery.Continue = "Continuar"
 
 	return i
 }
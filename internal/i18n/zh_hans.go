@@ -10,7 +10,7 @@ func zhHans() *I18n {
 	i.Command.Help.Help = "获取命令帮助"
 	i.Command.Help.New = "发起新的对话"
 	i.Command.Help.Start = "获取你的ID, 并发起新的对话"
-	i.Command.Help.Img = "生成一张图片，命令完整格式为`/img 图片描述`, 例如`/img 月光下的沙滩`"
+	i.Command.Help.Img = "生成图片，命令完整格式为`/img [选项] 图片描述`, 例如`/img 月光下的沙滩`。选项: `--n 4` 图片数量, `--ar 16:9` 宽高比, `--size 1024x1024`, `--quality hd`, `--style natural`"
 	i.Command.Help.Version = "获取当前版本号，判断是否需要更新"
 	i.Command.Help.Setenv = "设置用户配置，命令完整格式为 /setenv KEY=VALUE"
 	i.Command.Help.Setenvs = "批量设置用户配置, 命令完整格式为/setenvs {\"KEY1\": \"VALUE1\", \"KEY2\": \"VALUE2\"}"
@@ -20,13 +20,65 @@ func zhHans() *I18n {
 	i.Command.Help.Redo = "重做上一次的对话, /redo 加修改过的内容或者直接 /redo"
 	i.Command.Help.Echo = "回显消息"
 	i.Command.Help.Models = "切换对话模型"
+	i.Command.Help.Chats = "列出已归档的对话，可切换或删除"
+	i.Command.Help.Branches = "查看当前对话的分支并在分支之间切换"
+	i.Command.Help.Trigger = "设置 Bot 在本群组中何时回复"
+	i.Command.Help.Topic = "设置本话题或本聊天的模型、提示词或角色"
+	i.Command.Help.Persona = "设置角色认识你的人设"
 
 	i.Command.New.NewChatStart = "新的对话已经开始"
+	i.Command.Chats.Summary = "已归档的对话，选择一个以切换："
+	i.Command.Chats.Empty = "还没有已归档的对话，/new 会归档当前对话"
+	i.Command.Chats.Switched = "已切换到对话：%s"
+	i.Command.Chats.Deleted = "对话已删除"
+	i.Command.Branches.Summary = "当前对话的分支（消息数量），▶ 表示当前分支："
+	i.Command.Branches.Empty = "当前对话没有分支，回复较早的一条回答即可创建分支"
+	i.Command.Branches.Untitled = "未命名"
+	i.Command.Trigger.GroupsOnly = "/trigger 仅可在群组中使用"
+	i.Command.Trigger.Usage = "用法：/trigger [mode <模式> | keywords [<关键词>] | probability <0-1> | reset]"
+	i.Command.Trigger.InvalidProbability = "无效的概率 %q"
+	i.Command.Trigger.Updated = "✅ 触发设置已更新"
+	i.Command.Trigger.Summary = "群组触发设置："
+	i.Command.Trigger.Mode = "模式"
+	i.Command.Trigger.Keywords = "关键词"
+	i.Command.Trigger.Probability = "概率"
+	i.Command.Trigger.Modes = "可用模式"
+	i.Command.Trigger.NoModes = "无（仅响应命令）"
+	i.Command.Trigger.None = "无"
+	i.Command.Topic.Usage = "用法：/topic [model <模型> | prompt <文本> | character <ID 或名称> | group <ID 或名称，逗号分隔> | strategy <natural|list|random> | reset]"
+	i.Command.Topic.Updated = "✅ 话题设置已更新"
+	i.Command.Topic.Summary = "话题绑定："
+	i.Command.Topic.Model = "模型"
+	i.Command.Topic.SystemPrompt = "System prompt"
+	i.Command.Topic.Character = "角色"
+	i.Command.Topic.Group = "群聊"
+	i.Command.Topic.TurnOrder = "发言顺序"
+	i.Command.Topic.Default = "默认"
+	i.Command.Topic.None = "无"
+	i.Command.Topic.CharacterNotFound = "未找到角色卡 %q"
+	i.Command.Persona.UsersOnly = "/persona 仅供用户使用"
+	i.Command.Persona.Usage = "用法：/persona [add <名称>，下一行起为描述 | use <ID 或名称> | delete <ID 或名称> | off]"
+	i.Command.Persona.Updated = "✅ 人设已更新"
+	i.Command.Persona.NotFound = "未找到人设 %q"
+	i.Command.Persona.Active = "角色认识的你是 %s。"
+	i.Command.Persona.Inactive = "未启用人设，角色认识的你是 %s。"
+	i.Command.Persona.List = "人设："
+
+	i.Chat.VisionNotSupported = "当前模型 %s 不支持图片输入，请使用 /models 切换到支持视觉的模型，或仅发送文字。"
+
+	i.Inline.LimitTitle = "已达到每日上限"
+	i.Inline.LimitText = "你今天的 %d 次内联回答已用完"
+	i.Inline.LimitDescription = "请明天再试，或直接与 Bot 对话"
+	i.Inline.Answer = "回答"
+	i.Inline.ShortAnswer = "简短回答"
+	i.Inline.FullAnswer = "打开完整回答"
 
 	i.CallbackQuery.OpenModelList = "打开模型列表"
 	i.CallbackQuery.SelectProvider = "选择一个模型提供商:"
 	i.CallbackQuery.SelectModel = "选择一个模型"
 	i.CallbackQuery.ChangeModel = "对话模型已修改至"
+	i.CallbackQuery.Regenerate = "重新生成"
+	i.CallbackQuery.Continue = "继续"
 
 	return i
 }
@@ -10,7 +10,7 @@ func zhHant() *I18n {
 	i.Command.Help.Help = "獲取命令幫助"
 	i.Command.Help.New = "開始一個新對話"
 	i.Command.Help.Start = "獲取您的ID並開始一個新對話"
-	i.Command.Help.Img = "生成圖片，完整命令格式為`/img 圖片描述`，例如`/img 海灘月光`"
+	i.Command.Help.Img = "生成圖片，完整命令格式為`/img [選項] 圖片描述`，例如`/img 海灘月光`。選項：`--n 4` 圖片數量，`--ar 16:9` 寬高比，`--size 1024x1024`，`--quality hd`，`--style natural`"
 	i.Command.Help.Version = "獲取當前版本號確認是否需要更新"
 	i.Command.Help.Setenv = "設置用戶配置，完整命令格式為/setenv KEY=VALUE"
 	i.Command.Help.Setenvs = "批量設置用户配置, 命令完整格式為/setenvs {\"KEY1\": \"VALUE1\", \"KEY2\": \"VALUE2\"}"
@@ -20,13 +20,65 @@ func zhHant() *I18n {
 	i.Command.Help.Redo = "重做上一次的對話 /redo 加修改過的內容或者直接 /redo"
 	i.Command.Help.Echo = "回显消息"
 	i.Command.Help.Models = "切換對話模式"
+	i.Command.Help.Chats = "列出已封存的對話，可切換或刪除"
+	i.Command.Help.Branches = "查看目前對話的分支並在分支之間切換"
+	i.Command.Help.Trigger = "設定 Bot 在本群組中何時回覆"
+	i.Command.Help.Topic = "設定本話題或本聊天的模型、提示詞或角色"
+	i.Command.Help.Persona = "設定角色認識你的人設"
 
 	i.Command.New.NewChatStart = "開始一個新對話"
+	i.Command.Chats.Summary = "已封存的對話，選擇一個以切換："
+	i.Command.Chats.Empty = "還沒有已封存的對話，/new 會封存目前的對話"
+	i.Command.Chats.Switched = "已切換到對話：%s"
+	i.Command.Chats.Deleted = "對話已刪除"
+	i.Command.Branches.Summary = "目前對話的分支（訊息數量），▶ 表示目前分支："
+	i.Command.Branches.Empty = "目前對話沒有分支，回覆較早的一則回答即可建立分支"
+	i.Command.Branches.Untitled = "未命名"
+	i.Command.Trigger.GroupsOnly = "/trigger 僅可在群組中使用"
+	i.Command.Trigger.Usage = "用法：/trigger [mode <模式> | keywords [<關鍵詞>] | probability <0-1> | reset]"
+	i.Command.Trigger.InvalidProbability = "無效的機率 %q"
+	i.Command.Trigger.Updated = "✅ 觸發設定已更新"
+	i.Command.Trigger.Summary = "群組觸發設定："
+	i.Command.Trigger.Mode = "模式"
+	i.Command.Trigger.Keywords = "關鍵詞"
+	i.Command.Trigger.Probability = "機率"
+	i.Command.Trigger.Modes = "可用模式"
+	i.Command.Trigger.NoModes = "無（僅回應指令）"
+	i.Command.Trigger.None = "無"
+	i.Command.Topic.Usage = "用法：/topic [model <模型> | prompt <文字> | character <ID 或名稱> | group <ID 或名稱，逗號分隔> | strategy <natural|list|random> | reset]"
+	i.Command.Topic.Updated = "✅ 話題設定已更新"
+	i.Command.Topic.Summary = "話題綁定："
+	i.Command.Topic.Model = "模型"
+	i.Command.Topic.SystemPrompt = "System prompt"
+	i.Command.Topic.Character = "角色"
+	i.Command.Topic.Group = "群聊"
+	i.Command.Topic.TurnOrder = "發言順序"
+	i.Command.Topic.Default = "預設"
+	i.Command.Topic.None = "無"
+	i.Command.Topic.CharacterNotFound = "找不到角色卡 %q"
+	i.Command.Persona.UsersOnly = "/persona 僅供使用者使用"
+	i.Command.Persona.Usage = "用法：/persona [add <名稱>，下一行起為描述 | use <ID 或名稱> | delete <ID 或名稱> | off]"
+	i.Command.Persona.Updated = "✅ 人設已更新"
+	i.Command.Persona.NotFound = "找不到人設 %q"
+	i.Command.Persona.Active = "角色認識的你是 %s。"
+	i.Command.Persona.Inactive = "未啟用人設，角色認識的你是 %s。"
+	i.Command.Persona.List = "人設："
+
+	i.Chat.VisionNotSupported = "目前模型 %s 不支援圖片輸入，請使用 /models 切換至支援視覺的模型，或僅傳送文字。"
+
+	i.Inline.LimitTitle = "已達到每日上限"
+	i.Inline.LimitText = "你今天的 %d 次內聯回答已用完"
+	i.Inline.LimitDescription = "請明天再試，或直接與 Bot 對話"
+	i.Inline.Answer = "回答"
+	i.Inline.ShortAnswer = "簡短回答"
+	i.Inline.FullAnswer = "開啟完整回答"
 
 	i.CallbackQuery.OpenModelList = "打開模型清單"
 	i.CallbackQuery.SelectProvider = "選擇一個模型供應商:"
 	i.CallbackQuery.SelectModel = "選擇一個模型"
 	i.CallbackQuery.ChangeModel = "對話模型已經修改為"
+	i.CallbackQuery.Regenerate = "重新生成"
+	i.CallbackQuery.Continue = "繼續"
 
 	return i
 }
@@ -0,0 +1,963 @@
+package integration
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/tbxark/ChatGPT-Telegram-Workers/go_version/internal/storage"
+	"github.com/tbxark/ChatGPT-Telegram-Workers/go_version/internal/testutil"
+)
+
+// TestE2E_ChatNonStreaming tests update -> handler -> agent -> Telegram without streaming
+func TestE2E_ChatNonStreaming(t *testing.T) {
+	h := testutil.NewHarness(t, map[string]string{
+		"STREAM_MODE":         "false",
+		"SYSTEM_INIT_MESSAGE": "You are a test bot",
+	})
+	userID := int64(1001)
+
+	h.LLM.Reply("Hello there")
+	h.Send(userID, "hi")
+
+	// The LLM received the system prompt and the user message
+	req, ok := h.LLM.LastRequest()
+	require.True(t, ok)
+	assert.False(t, req.Stream())
+	assert.Equal(t, "/v1/chat/completions", req.Path)
+	messages := req.Messages()
+	require.Len(t, messages, 2)
+	assert.Equal(t, "system", messages[0]["role"])
+	assert.Equal(t, "You are a test bot", messages[0]["content"])
+	assert.Equal(t, "user", messages[1]["role"])
+	assert.Equal(t, "hi", messages[1]["content"])
+
+	// The reply was sent once, without edits
+	sent := h.Bot.Messages(userID)
+	require.Len(t, sent, 1)
+	assert.Equal(t, "Hello there", sent[0].Text)
+	assert.Equal(t, 0, sent[0].Edits)
+	assert.Len(t, h.Bot.Calls("sendChatAction"), 1)
+
+	// The conversation was stored
+	history := h.History(userID)
+	require.Len(t, history, 2)
+	assert.Equal(t, "hi", history[0].Content)
+	assert.Equal(t, "Hello there", history[1].Content)
+}
+
+// TestE2E_ChatStreaming tests that streamed deltas are accumulated into a single edited message
+func TestE2E_ChatStreaming(t *testing.T) {
+	for _, provider := range []string{"openai", "anthropic"} {
+		t.Run(provider, func(t *testing.T) {
+			h := testutil.NewHarness(t, map[string]string{"AI_PROVIDER": provider})
+			userID := int64(1002)
+
+			h.LLM.Enqueue(testutil.FakeLLMReply{Chunks: []string{"Hel", "lo ", "world"}})
+			h.Send(userID, "stream please")
+
+			req, ok := h.LLM.LastRequest()
+			require.True(t, ok)
+			assert.True(t, req.Stream())
+
+			// A single message shows the full text once streaming is done
+			sent := h.Bot.Messages(userID)
+			require.Len(t, sent, 1)
+			assert.Equal(t, "Hello world", sent[0].Text)
+			assert.Empty(t, h.Bot.Calls("sendMessage")[1:], "deltas must edit the first message, not send new ones")
+
+			history := h.History(userID)
+			require.Len(t, history, 2)
+			assert.Equal(t, "Hello world", history[1].Content)
+		})
+	}
+}
+
+// TestE2E_Redo tests that /redo drops the last answer and asks again
+func TestE2E_Redo(t *testing.T) {
+	h := testutil.NewHarness(t, map[string]string{"STREAM_MODE": "false"})
+	userID := int64(1003)
+
+	h.LLM.Reply("first answer", "second answer", "third answer")
+	h.Send(userID, "question")
+	h.Send(userID, "/redo")
+
+	// The redo request contains the original question but not the first answer
+	requests := h.LLM.Requests()
+	require.Len(t, requests, 2)
+	redoMessages := requests[1].Messages()
+	require.Len(t, redoMessages, 1)
+	assert.Equal(t, "question", redoMessages[0]["content"])
+
+	history := h.History(userID)
+	require.Len(t, history, 2)
+	assert.Equal(t, "question", history[0].Content)
+	assert.Equal(t, "second answer", history[1].Content)
+
+	// /redo with text replaces the last question
+	h.Send(userID, "/redo better question")
+	history = h.History(userID)
+	require.Len(t, history, 2)
+	assert.Equal(t, "better question", history[0].Content)
+	assert.Equal(t, "third answer", history[1].Content)
+	assert.Equal(t, 0, h.LLM.Pending())
+}
+
+// TestE2E_GroupConfigPermissions tests that only group admins can change shared configuration
+func TestE2E_GroupConfigPermissions(t *testing.T) {
+	h := testutil.NewHarness(t, map[string]string{"ENABLE_USER_SETTING": "false"})
+	groupID := int64(-100200)
+	adminID := int64(2001)
+	memberID := int64(2002)
+	h.Bot.SetChatAdministrators(groupID, adminID)
+
+	// A regular member is rejected
+	err := h.Dispatch(h.GroupMessage(groupID, memberID, "/setenv SYSTEM_INIT_MESSAGE=pirate"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "unauthorized")
+	assert.Len(t, h.Bot.Calls("getChatAdministrators"), 1)
+
+	// An admin is allowed (the admin list is now served from the cache)
+	err = h.Dispatch(h.GroupMessage(groupID, adminID, "/setenv SYSTEM_INIT_MESSAGE=pirate"))
+	require.NoError(t, err)
+	assert.Len(t, h.Bot.Calls("getChatAdministrators"), 1)
+	assert.Empty(t, h.LLM.Requests())
+}
+
+// TestE2E_WhiteList tests that chats outside the whitelist never reach the LLM
+func TestE2E_WhiteList(t *testing.T) {
+	h := testutil.NewHarness(t, map[string]string{
+		"I_AM_A_GENEROUS_PERSON": "false",
+		"CHAT_WHITE_LIST":        "3001",
+	})
+
+	err := h.Dispatch(h.PrivateMessage(3002, "hello"))
+	require.Error(t, err)
+	assert.True(t, strings.Contains(err.Error(), "unauthorized"))
+	assert.Empty(t, h.LLM.Requests())
+	assert.Empty(t, h.Bot.Calls("sendMessage"))
+
+	h.LLM.Reply("welcome")
+	h.Send(3001, "hello")
+	last, ok := h.Bot.LastMessage(3001)
+	require.True(t, ok)
+	assert.Equal(t, "welcome", last.Text)
+}
+
+// TestE2E_LLMError tests that provider errors surface without sending a reply
+func TestE2E_LLMError(t *testing.T) {
+	h := testutil.NewHarness(t, map[string]string{"STREAM_MODE": "false"})
+	userID := int64(1004)
+
+	h.LLM.Enqueue(testutil.FakeLLMReply{Status: 500})
+	err := h.Dispatch(h.PrivateMessage(userID, "hi"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "status 500")
+	assert.Empty(t, h.Bot.Messages(userID))
+	assert.Empty(t, h.History(userID))
+}
+
+// TestE2E_LongReply tests that replies beyond Telegram's limit continue in further messages
+// and that /redo replaces every part of the previous reply
+func TestE2E_LongReply(t *testing.T) {
+	h := testutil.NewHarness(t, map[string]string{"DEFAULT_PARSE_MODE": "Markdown"})
+	userID := int64(1005)
+
+	paragraph := strings.Repeat("long answer ", 250) // 3000 characters
+	code := "```go\n" + strings.Repeat("fmt.Println(\"hello\")\n", 150) + "```"
+	h.LLM.Enqueue(testutil.FakeLLMReply{Chunks: []string{paragraph, "\n\n", code, "\n\nThe end."}})
+	h.Send(userID, "write a lot")
+
+	sent := h.Bot.Messages(userID)
+	require.Greater(t, len(sent), 1)
+	for _, msg := range sent[1:] {
+		assert.LessOrEqual(t, len([]rune(msg.Text)), 4096)
+		assert.NotContains(t, msg.Text, "```", "Markdown is rendered into entities")
+		assert.Contains(t, msg.Entities, `"type":"pre"`, "the code block continues in every part")
+		assert.Contains(t, msg.Entities, `"language":"go"`)
+	}
+	assert.Equal(t, strings.TrimSpace(paragraph), sent[0].Text)
+	assert.True(t, strings.HasSuffix(sent[len(sent)-1].Text, "The end."))
+
+	// All parts of the reply are recorded in the history
+	history := h.History(userID)
+	require.Len(t, history, 2)
+	require.Len(t, history[1].MessageIDs, len(sent))
+	for i, msg := range sent {
+		assert.Equal(t, msg.MessageID, history[1].MessageIDs[i])
+	}
+
+	// /redo deletes the previous reply once the new answer is shown
+	h.LLM.Reply("short answer")
+	h.Send(userID, "/redo")
+	assert.Len(t, h.Bot.Calls("deleteMessage"), len(sent))
+	remaining := h.Bot.Messages(userID)
+	require.Len(t, remaining, 1)
+	assert.Equal(t, "short answer", remaining[0].Text)
+	assert.Equal(t, []int{remaining[0].MessageID}, h.History(userID)[1].MessageIDs)
+}
+
+// TestE2E_MarkdownEntities tests that model Markdown is sent as entities,
+// and as plain text when Telegram rejects them
+func TestE2E_MarkdownEntities(t *testing.T) {
+	h := testutil.NewHarness(t, map[string]string{"STREAM_MODE": "false", "DEFAULT_PARSE_MODE": "Markdown"})
+	userID := int64(1006)
+
+	h.LLM.Reply("Use **bold** and `code` in snake_case_names")
+	h.Send(userID, "format")
+	last, ok := h.Bot.LastMessage(userID)
+	require.True(t, ok)
+	assert.Equal(t, "Use bold and code in snake_case_names", last.Text)
+	assert.Empty(t, last.ParseMode)
+	assert.JSONEq(t, `[{"type":"bold","offset":4,"length":4},{"type":"code","offset":13,"length":4}]`, last.Entities)
+
+	h.Bot.FailNext("sendMessage", 400, "Bad Request: can't parse entities: unsupported entity", 0)
+	h.LLM.Reply("**again**")
+	h.Send(userID, "format again")
+	last, ok = h.Bot.LastMessage(userID)
+	require.True(t, ok)
+	assert.Equal(t, "again", last.Text)
+	assert.NotContains(t, last.Entities, "bold")
+}
+
+// TestE2E_ConcurrentMessages tests that concurrent messages of a chat are processed one turn at a time
+func TestE2E_ConcurrentMessages(t *testing.T) {
+	h := testutil.NewHarness(t, map[string]string{"STREAM_MODE": "false"})
+	userID := int64(1007)
+
+	const count = 5
+	updates := make([]*tgbotapi.Update, count)
+	for i := range updates {
+		h.LLM.Reply(fmt.Sprintf("answer %d", i))
+		updates[i] = h.PrivateMessage(userID, fmt.Sprintf("question %d", i))
+	}
+
+	var wg sync.WaitGroup
+	for _, update := range updates {
+		wg.Add(1)
+		go func(update *tgbotapi.Update) {
+			defer wg.Done()
+			assert.NoError(t, h.Dispatch(update))
+		}(update)
+	}
+	wg.Wait()
+
+	// Every turn is kept, and each request saw the history of the turns before it
+	history := h.History(userID)
+	require.Len(t, history, 2*count)
+	for i, item := range history {
+		expected := "user"
+		if i%2 == 1 {
+			expected = "assistant"
+		}
+		assert.Equal(t, expected, item.Role)
+	}
+	requests := h.LLM.Requests()
+	require.Len(t, requests, count)
+	for i, req := range requests {
+		assert.Len(t, req.Messages(), 2*i+1)
+	}
+	assert.Len(t, h.Bot.Messages(userID), count)
+}
+
+// TestE2E_GroupTrigger tests that the bot only answers triggered group messages, and that admins can change the trigger
+func TestE2E_GroupTrigger(t *testing.T) {
+	h := testutil.NewHarness(t, map[string]string{"STREAM_MODE": "false"})
+	groupID := int64(-100300)
+	adminID := int64(3001)
+	memberID := int64(3002)
+	h.Bot.SetChatAdministrators(groupID, adminID)
+
+	// Group chatter is ignored
+	require.NoError(t, h.Dispatch(h.GroupMessage(groupID, memberID, "hello everyone")))
+	assert.Empty(t, h.LLM.Requests())
+	assert.Empty(t, h.Bot.Messages(groupID))
+
+	// A mention triggers the bot, and is removed from the prompt
+	h.LLM.Reply("Hi!")
+	require.NoError(t, h.Dispatch(h.GroupMessage(groupID, memberID, "@test_bot say hi")))
+	req, ok := h.LLM.LastRequest()
+	require.True(t, ok)
+	messages := req.Messages()
+	assert.Equal(t, "say hi", messages[len(messages)-1]["content"])
+	assert.Len(t, h.Bot.Messages(groupID), 1)
+
+	// Only admins can change the trigger
+	err := h.Dispatch(h.GroupMessage(groupID, memberID, "/trigger mode always"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "unauthorized")
+	require.NoError(t, h.Dispatch(h.GroupMessage(groupID, adminID, "/trigger mode always")))
+	last, ok := h.Bot.LastMessage(groupID)
+	require.True(t, ok)
+	assert.Contains(t, last.Text, "Mode: always")
+
+	h.LLM.Reply("Hello everyone!")
+	require.NoError(t, h.Dispatch(h.GroupMessage(groupID, memberID, "good morning")))
+	assert.Len(t, h.LLM.Requests(), 2)
+}
+
+// TestE2E_ForumTopics tests that each forum topic has its own replies, history and bindings
+func TestE2E_ForumTopics(t *testing.T) {
+	h := testutil.NewHarness(t, map[string]string{
+		"STREAM_MODE":             "false",
+		"SYSTEM_INIT_MESSAGE":     "You are a test bot",
+		"GROUP_CHAT_TRIGGER_MODE": "always",
+	})
+	groupID := int64(-100400)
+	adminID := int64(4001)
+	memberID := int64(4002)
+	h.Bot.SetChatAdministrators(groupID, adminID)
+
+	// Replies go to the topic of the message, or to General
+	h.LLM.Reply("In topic 5", "In topic 9", "In General")
+	require.NoError(t, h.Dispatch(h.TopicMessage(groupID, 5, memberID, "hello five")))
+	require.NoError(t, h.Dispatch(h.TopicMessage(groupID, 9, memberID, "hello nine")))
+	require.NoError(t, h.Dispatch(h.GroupMessage(groupID, memberID, "hello general")))
+	messages := h.Bot.Messages(groupID)
+	require.Len(t, messages, 3)
+	assert.Equal(t, 5, messages[0].ThreadID)
+	assert.Equal(t, 9, messages[1].ThreadID)
+	assert.Equal(t, 0, messages[2].ThreadID)
+	actions := h.Bot.Calls("sendChatAction")
+	require.Len(t, actions, 3)
+	assert.Equal(t, "5", actions[0].Params["message_thread_id"])
+
+	// Each topic keeps its own history
+	five := h.TopicHistory(groupID, 5)
+	require.Len(t, five, 2)
+	assert.Equal(t, "hello five", five[0].Content)
+	require.Len(t, h.TopicHistory(groupID, 9), 2)
+
+	// Only admins can bind a topic; outside of topics /topic shows the bindings of the chat
+	err := h.Dispatch(h.TopicMessage(groupID, 5, memberID, "/topic prompt You are a pirate"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "unauthorized")
+	require.NoError(t, h.Dispatch(h.GroupMessage(groupID, adminID, "/topic")))
+	last, ok := h.Bot.LastMessage(groupID)
+	require.True(t, ok)
+	assert.Equal(t, 0, last.ThreadID)
+	assert.Contains(t, last.Text, "Topic bindings:")
+
+	require.NoError(t, h.Dispatch(h.TopicMessage(groupID, 5, adminID, "/topic prompt You are a pirate")))
+	require.NoError(t, h.Dispatch(h.TopicMessage(groupID, 5, adminID, "/topic model gpt-4o")))
+	last, ok = h.Bot.LastMessage(groupID)
+	require.True(t, ok)
+	assert.Equal(t, 5, last.ThreadID)
+	assert.Contains(t, last.Text, "Model: gpt-4o")
+	assert.Contains(t, last.Text, "System prompt: You are a pirate")
+
+	h.LLM.Reply("Arr!")
+	require.NoError(t, h.Dispatch(h.TopicMessage(groupID, 5, memberID, "who are you?")))
+	req, ok := h.LLM.LastRequest()
+	require.True(t, ok)
+	assert.Equal(t, "gpt-4o", req.Body["model"])
+	assert.Equal(t, "You are a pirate", req.Messages()[0]["content"])
+
+	// Other topics keep the global configuration
+	h.LLM.Reply("Hello")
+	require.NoError(t, h.Dispatch(h.TopicMessage(groupID, 9, memberID, "who are you?")))
+	req, ok = h.LLM.LastRequest()
+	require.True(t, ok)
+	assert.Equal(t, "gpt-4o-mini", req.Body["model"])
+	assert.Equal(t, "You are a test bot", req.Messages()[0]["content"])
+
+	// A character card replaces the system prompt of the topic
+	require.NoError(t, h.DB.CreateCharacterCard(&storage.CharacterCard{
+		Name: "Alice",
+		Data: `{"spec":"chara_card_v2","spec_version":"2.0","data":{"name":"Alice","description":"Alice is a cheerful librarian."}}`,
+	}))
+	require.NoError(t, h.Dispatch(h.TopicMessage(groupID, 9, adminID, "/topic character alice")))
+	last, ok = h.Bot.LastMessage(groupID)
+	require.True(t, ok)
+	assert.Contains(t, last.Text, "Character: Alice")
+
+	h.LLM.Reply("Welcome to the library")
+	require.NoError(t, h.Dispatch(h.TopicMessage(groupID, 9, memberID, "hi")))
+	req, ok = h.LLM.LastRequest()
+	require.True(t, ok)
+	assert.Contains(t, req.Messages()[0]["content"], "cheerful librarian")
+
+	// Reset restores the global configuration
+	require.NoError(t, h.Dispatch(h.TopicMessage(groupID, 5, adminID, "/topic reset")))
+	h.LLM.Reply("Hello again")
+	require.NoError(t, h.Dispatch(h.TopicMessage(groupID, 5, memberID, "and now?")))
+	req, ok = h.LLM.LastRequest()
+	require.True(t, ok)
+	assert.Equal(t, "gpt-4o-mini", req.Body["model"])
+	assert.Equal(t, "You are a test bot", req.Messages()[0]["content"])
+}
+
+// TestE2E_ChatCharacterGroup tests a character group bound to a whole chat outside of forum topics
+func TestE2E_ChatCharacterGroup(t *testing.T) {
+	h := testutil.NewHarness(t, map[string]string{
+		"STREAM_MODE":              "false",
+		"SYSTEM_INIT_MESSAGE":      "You are a test bot",
+		"GROUP_CHAT_TRIGGER_MODE":  "always",
+		"CHARACTER_GROUP_STRATEGY": "list",
+	})
+	groupID := int64(-100410)
+	adminID := int64(4101)
+	memberID := int64(4102)
+	h.Bot.SetChatAdministrators(groupID, adminID)
+
+	for _, name := range []string{"Alice", "Bob"} {
+		require.NoError(t, h.DB.CreateCharacterCard(&storage.CharacterCard{
+			Name: name,
+			Data: `{"spec":"chara_card_v2","spec_version":"2.0","data":{"name":"` + name + `","description":"` + name + ` works at the library."}}`,
+		}))
+	}
+	require.NoError(t, h.Dispatch(h.GroupMessage(groupID, adminID, "/topic group alice, bob")))
+	last, ok := h.Bot.LastMessage(groupID)
+	require.True(t, ok)
+	assert.Contains(t, last.Text, "Alice (#1), Bob (#2)")
+
+	// Every character replies in turn with its own prompt
+	h.LLM.Reply("Hi from Alice", "Hi from Bob")
+	require.NoError(t, h.Dispatch(h.GroupMessage(groupID, memberID, "hello")))
+	requests := h.LLM.Requests()
+	require.Len(t, requests, 2)
+	assert.Contains(t, requests[0].Messages()[0]["content"], "Alice works at the library.")
+	assert.Contains(t, requests[1].Messages()[0]["content"], "Bob works at the library.")
+	last, ok = h.Bot.LastMessage(groupID)
+	require.True(t, ok)
+	assert.Contains(t, last.Text, "Hi from Bob")
+
+	// Forum topics of the chat keep their own bindings
+	h.LLM.Reply("Hello")
+	require.NoError(t, h.Dispatch(h.TopicMessage(groupID, 5, memberID, "hello")))
+	req, ok := h.LLM.LastRequest()
+	require.True(t, ok)
+	assert.Equal(t, "You are a test bot", req.Messages()[0]["content"])
+}
+
+// TestE2E_CharacterWorldInfo tests that the replies of a bound character are prompted with the world info
+// the conversation triggers, from the user's active world book and the card's character book
+func TestE2E_CharacterWorldInfo(t *testing.T) {
+	h := testutil.NewHarness(t, map[string]string{
+		"STREAM_MODE":         "false",
+		"SYSTEM_INIT_MESSAGE": "You are a test bot",
+	})
+	userID := int64(4201)
+
+	require.NoError(t, h.DB.CreateCharacterCard(&storage.CharacterCard{
+		Name: "Alice",
+		Data: `{"spec":"chara_card_v2","spec_version":"2.0","data":{"name":"Alice","description":"Alice is a cheerful librarian.",` +
+			`"character_book":{"entries":[{"keys":["dragon"],"content":"Dragons sleep under the library.","enabled":true,"insertion_order":100}]}}}`,
+	}))
+	book := &storage.WorldBook{UserID: &userID, Name: "Town", Data: "{}"}
+	require.NoError(t, h.DB.CreateWorldBook(book))
+	require.NoError(t, h.DB.CreateWorldBookEntry(&storage.WorldBookEntry{
+		WorldBookID: book.ID,
+		UID:         "castle",
+		Keys:        `["castle"]`,
+		Content:     "The castle is closed on Sundays.",
+		Position:    "after_char",
+		Enabled:     true,
+	}))
+	require.NoError(t, h.DB.ActivateWorldBook(&userID, book.ID))
+	require.NoError(t, h.Dispatch(h.PrivateMessage(userID, "/topic character alice")))
+
+	h.LLM.Reply("It is quiet")
+	require.NoError(t, h.Dispatch(h.PrivateMessage(userID, "how is the castle?")))
+	req, ok := h.LLM.LastRequest()
+	require.True(t, ok)
+	system := req.Messages()[0]["content"]
+	assert.Contains(t, system, "cheerful librarian")
+	assert.Contains(t, system, "The castle is closed on Sundays.")
+	assert.NotContains(t, system, "Dragons")
+	assert.NotContains(t, system, "You are a test bot")
+
+	h.LLM.Reply("They are asleep")
+	require.NoError(t, h.Dispatch(h.PrivateMessage(userID, "and the dragon?")))
+	req, ok = h.LLM.LastRequest()
+	require.True(t, ok)
+	assert.Contains(t, req.Messages()[0]["content"], "Dragons sleep under the library.")
+}
+
+// inlineResults decodes the results of the answerInlineQuery calls
+func inlineResults(t *testing.T, h *testutil.Harness) [][]map[string]interface{} {
+	t.Helper()
+	var answers [][]map[string]interface{}
+	for _, call := range h.Bot.Calls("answerInlineQuery") {
+		var results []map[string]interface{}
+		require.NoError(t, json.Unmarshal([]byte(call.Params["results"]), &results))
+		answers = append(answers, results)
+	}
+	return answers
+}
+
+// TestE2E_InlineQuery tests inline queries answered with a short completion
+func TestE2E_InlineQuery(t *testing.T) {
+	h := testutil.NewHarness(t, map[string]string{
+		"INLINE_QUERY_MODEL":      "gpt-4o-nano",
+		"INLINE_QUERY_MAX_TOKENS": "128",
+		"INLINE_QUERY_DEBOUNCE":   "0",
+	})
+	userID := int64(5001)
+
+	long := "**Go** is a statically typed language designed at Google. " + strings.Repeat("It compiles fast and has garbage collection. ", 8) +
+		"\n\nIt is popular for servers."
+	h.LLM.Reply(long)
+	require.NoError(t, h.Dispatch(h.InlineQuery(userID, "what is go?")))
+
+	// A short non-streaming completion with the inline model
+	req, ok := h.LLM.LastRequest()
+	require.True(t, ok)
+	assert.False(t, req.Stream())
+	assert.Equal(t, "gpt-4o-nano", req.Body["model"])
+	assert.Equal(t, float64(128), req.Body["max_tokens"])
+
+	// The answer and a shortened answer, rendered into entities
+	answers := inlineResults(t, h)
+	require.Len(t, answers, 1)
+	results := answers[0]
+	require.Len(t, results, 2)
+	assert.Equal(t, "answer", results[0]["id"])
+	content := results[0]["input_message_content"].(map[string]interface{})
+	assert.True(t, strings.HasPrefix(content["message_text"].(string), "Go is a statically typed language"))
+	assert.NotEmpty(t, content["entities"])
+	assert.Equal(t, "short", results[1]["id"])
+	short := results[1]["input_message_content"].(map[string]interface{})["message_text"].(string)
+	assert.True(t, strings.HasSuffix(short, "…"))
+	assert.LessOrEqual(t, len([]rune(short)), 201)
+
+	// Empty queries are answered without a completion
+	require.NoError(t, h.Dispatch(h.InlineQuery(userID, "  ")))
+	assert.Len(t, h.LLM.Requests(), 1)
+	answers = inlineResults(t, h)
+	require.Len(t, answers, 2)
+	assert.Empty(t, answers[1])
+}
+
+// TestE2E_InlineQueryDebounce tests that only the last query of a user typing is answered
+func TestE2E_InlineQueryDebounce(t *testing.T) {
+	h := testutil.NewHarness(t, map[string]string{"INLINE_QUERY_DEBOUNCE": "200"})
+	userID := int64(5002)
+
+	h.LLM.Reply("Paris")
+	first := h.InlineQuery(userID, "capital of fra")
+	second := h.InlineQuery(userID, "capital of france")
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		assert.NoError(t, h.Dispatch(first))
+	}()
+	go func() {
+		defer wg.Done()
+		time.Sleep(50 * time.Millisecond)
+		assert.NoError(t, h.Dispatch(second))
+	}()
+	wg.Wait()
+
+	require.Len(t, h.LLM.Requests(), 1)
+	req, _ := h.LLM.LastRequest()
+	messages := req.Messages()
+	assert.Equal(t, "capital of france", messages[len(messages)-1]["content"])
+	calls := h.Bot.Calls("answerInlineQuery")
+	require.Len(t, calls, 1)
+	assert.Equal(t, second.InlineQuery.ID, calls[0].Params["inline_query_id"])
+}
+
+// TestE2E_InlineQueryLimits tests the whitelist and the daily limit of inline queries
+func TestE2E_InlineQueryLimits(t *testing.T) {
+	allowedID := int64(5003)
+	h := testutil.NewHarness(t, map[string]string{
+		"I_AM_A_GENEROUS_PERSON":  "false",
+		"CHAT_WHITE_LIST":         fmt.Sprintf("%d", allowedID),
+		"INLINE_QUERY_DEBOUNCE":   "0",
+		"INLINE_QUERY_USER_LIMIT": "1",
+	})
+
+	// Users outside the whitelist get no answer
+	err := h.Dispatch(h.InlineQuery(5004, "hello"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "unauthorized")
+	assert.Empty(t, h.LLM.Requests())
+
+	// The daily limit stops completions
+	h.LLM.Reply("Hi!")
+	require.NoError(t, h.Dispatch(h.InlineQuery(allowedID, "hello")))
+	require.NoError(t, h.Dispatch(h.InlineQuery(allowedID, "hello again")))
+	assert.Len(t, h.LLM.Requests(), 1)
+	answers := inlineResults(t, h)
+	require.Len(t, answers, 2)
+	require.Len(t, answers[1], 1)
+	assert.Equal(t, "limit", answers[1][0]["id"])
+}
+
+// TestE2E_ReplyButtons tests the Regenerate, Continue and swipe buttons of bot replies
+func TestE2E_ReplyButtons(t *testing.T) {
+	h := testutil.NewHarness(t, map[string]string{
+		"STREAM_MODE":       "false",
+		"SHOW_REPLY_BUTTON": "true",
+	})
+	userID := int64(1010)
+
+	h.LLM.Reply("first answer", "second answer", " and more", "next answer")
+	h.Send(userID, "question")
+
+	reply, ok := h.Bot.LastMessage(userID)
+	require.True(t, ok)
+	assert.Contains(t, reply.ReplyMarkup, `"rg:"`)
+	assert.Contains(t, reply.ReplyMarkup, `"ct:"`)
+	assert.NotContains(t, reply.ReplyMarkup, "sw:")
+
+	// Regenerate edits the reply to show a new alternative, keeping the previous one
+	require.NoError(t, h.Dispatch(h.CallbackQuery(reply, userID, "rg:")))
+	reply, _ = h.Bot.LastMessage(userID)
+	assert.Equal(t, "second answer", reply.Text)
+	assert.Contains(t, reply.ReplyMarkup, "2/2")
+	history := h.History(userID)
+	require.Len(t, history, 2)
+	assert.Equal(t, "second answer", history[1].Content)
+	assert.Equal(t, []interface{}{"first answer", "second answer"}, history[1].Swipes)
+	assert.Equal(t, 1, history[1].SwipeIndex)
+	assert.Len(t, h.LLM.Requests()[1].Messages(), 1, "the regenerated reply is not part of the prompt")
+
+	// Swiping back shows and selects the first alternative without a request
+	require.NoError(t, h.Dispatch(h.CallbackQuery(reply, userID, "sw:[-1]")))
+	reply, _ = h.Bot.LastMessage(userID)
+	assert.Equal(t, "first answer", reply.Text)
+	assert.Contains(t, reply.ReplyMarkup, "1/2")
+	history = h.History(userID)
+	assert.Equal(t, "first answer", history[1].Content)
+	assert.Equal(t, 0, history[1].SwipeIndex)
+	assert.Len(t, h.LLM.Requests(), 2)
+
+	// Continue appends to the selected alternative
+	require.NoError(t, h.Dispatch(h.CallbackQuery(reply, userID, "ct:")))
+	reply, _ = h.Bot.LastMessage(userID)
+	assert.Equal(t, "first answer and more", reply.Text)
+	continued := h.LLM.Requests()[2].Messages()
+	require.Len(t, continued, 3)
+	assert.Equal(t, "first answer", continued[1]["content"])
+	history = h.History(userID)
+	require.Len(t, history, 2)
+	assert.Equal(t, "first answer and more", history[1].Content)
+	assert.Equal(t, []interface{}{"first answer and more", "second answer"}, history[1].Swipes)
+
+	// The next conversation turn uses the selected alternative, and the buttons move to the new reply
+	h.Send(userID, "next")
+	assert.Equal(t, "first answer and more", h.LLM.Requests()[3].Messages()[1]["content"])
+	old := reply
+	reply, _ = h.Bot.LastMessage(userID)
+	assert.Equal(t, "next answer", reply.Text)
+	assert.Contains(t, reply.ReplyMarkup, `"rg:"`)
+	for _, msg := range h.Bot.Messages(userID) {
+		if msg.MessageID == old.MessageID {
+			assert.NotContains(t, msg.ReplyMarkup, "rg:")
+		}
+	}
+
+	// Buttons of older replies are rejected
+	require.NoError(t, h.Dispatch(h.CallbackQuery(old, userID, "rg:")))
+	answers := h.Bot.Calls("answerCallbackQuery")
+	assert.Contains(t, answers[len(answers)-1].Params["text"], "no longer")
+	assert.Equal(t, 0, h.LLM.Pending())
+}
+
+// TestE2E_ReplyButtonsQueued tests that a message sent while a reply is regenerated waits for it instead of being lost
+func TestE2E_ReplyButtonsQueued(t *testing.T) {
+	h := testutil.NewHarness(t, map[string]string{
+		"STREAM_MODE":       "false",
+		"SHOW_REPLY_BUTTON": "true",
+	})
+	userID := int64(1013)
+
+	h.LLM.Reply("first answer")
+	h.Send(userID, "question")
+	reply, ok := h.Bot.LastMessage(userID)
+	require.True(t, ok)
+
+	h.LLM.Enqueue(
+		testutil.FakeLLMReply{Text: "second answer", Delay: 300 * time.Millisecond},
+		testutil.FakeLLMReply{Text: "next answer"},
+	)
+	regenerate := h.CallbackQuery(reply, userID, "rg:")
+	next := h.PrivateMessage(userID, "next")
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		assert.NoError(t, h.Dispatch(regenerate))
+	}()
+	require.Eventually(t, func() bool { return len(h.LLM.Requests()) == 2 }, time.Second, 5*time.Millisecond)
+	require.NoError(t, h.Dispatch(next))
+	wg.Wait()
+
+	// The message is answered after the regenerated reply, and both are kept
+	requests := h.LLM.Requests()
+	require.Len(t, requests, 3)
+	assert.Equal(t, "second answer", requests[2].Messages()[1]["content"])
+	history := h.History(userID)
+	require.Len(t, history, 4)
+	assert.Equal(t, "second answer", history[1].Content)
+	assert.Equal(t, "next", history[2].Content)
+	assert.Equal(t, "next answer", history[3].Content)
+}
+
+// TestE2E_ReplyButtonsStreaming tests that a streamed continuation is shown after the continued reply
+func TestE2E_ReplyButtonsStreaming(t *testing.T) {
+	h := testutil.NewHarness(t, map[string]string{"SHOW_REPLY_BUTTON": "true"})
+	userID := int64(1011)
+
+	h.LLM.Enqueue(testutil.FakeLLMReply{Chunks: []string{"Once upon", " a time"}})
+	h.Send(userID, "tell a story")
+	reply, ok := h.Bot.LastMessage(userID)
+	require.True(t, ok)
+
+	h.LLM.Enqueue(testutil.FakeLLMReply{Chunks: []string{", there", " was a bot."}})
+	require.NoError(t, h.Dispatch(h.CallbackQuery(reply, userID, "ct:")))
+
+	sent := h.Bot.Messages(userID)
+	require.Len(t, sent, 1)
+	assert.Equal(t, "Once upon a time, there was a bot.", sent[0].Text)
+	assert.Contains(t, sent[0].ReplyMarkup, `"ct:"`)
+	history := h.History(userID)
+	require.Len(t, history, 2)
+	assert.Equal(t, "Once upon a time, there was a bot.", history[1].Content)
+}
+
+// TestE2E_EditedMessage tests that editing the latest prompt re-answers it in place
+func TestE2E_EditedMessage(t *testing.T) {
+	h := testutil.NewHarness(t, map[string]string{"STREAM_MODE": "false"})
+	userID := int64(1012)
+
+	h.LLM.Reply("first answer", "edited answer", "second answer")
+	question := h.PrivateMessage(userID, "question")
+	require.NoError(t, h.Dispatch(question))
+	require.NoError(t, h.Dispatch(h.EditMessage(question, "better question")))
+
+	// The turn is asked again with the edited prompt, and the previous answer is edited
+	requests := h.LLM.Requests()
+	require.Len(t, requests, 2)
+	messages := requests[1].Messages()
+	require.Len(t, messages, 1)
+	assert.Equal(t, "better question", messages[0]["content"])
+
+	sent := h.Bot.Messages(userID)
+	require.Len(t, sent, 1)
+	assert.Equal(t, "edited answer", sent[0].Text)
+	assert.Equal(t, 1, sent[0].Edits)
+
+	history := h.History(userID)
+	require.Len(t, history, 2)
+	assert.Equal(t, "better question", history[0].Content)
+	assert.Equal(t, "edited answer", history[1].Content)
+
+	// Edits of older turns and of commands are ignored
+	h.Send(userID, "another question")
+	require.NoError(t, h.Dispatch(h.EditMessage(question, "rewritten history")))
+	command := h.PrivateMessage(userID, "/help")
+	require.NoError(t, h.Dispatch(h.EditMessage(command, "/help me")))
+	assert.Len(t, h.LLM.Requests(), 3)
+	history = h.History(userID)
+	require.Len(t, history, 4)
+	assert.Equal(t, "better question", history[0].Content)
+	assert.Equal(t, 0, h.LLM.Pending())
+}
+
+// TestE2E_EditedMessageDisabled tests that REANSWER_EDITED_MESSAGE=false ignores edits
+func TestE2E_EditedMessageDisabled(t *testing.T) {
+	h := testutil.NewHarness(t, map[string]string{
+		"STREAM_MODE":             "false",
+		"REANSWER_EDITED_MESSAGE": "false",
+	})
+	userID := int64(1013)
+
+	h.LLM.Reply("answer")
+	question := h.PrivateMessage(userID, "question")
+	require.NoError(t, h.Dispatch(question))
+	require.NoError(t, h.Dispatch(h.EditMessage(question, "better question")))
+
+	assert.Len(t, h.LLM.Requests(), 1)
+	history := h.History(userID)
+	require.Len(t, history, 2)
+	assert.Equal(t, "question", history[0].Content)
+}
+
+// TestE2E_MediaGroup tests that the photos of an album are answered together in a single turn
+func TestE2E_MediaGroup(t *testing.T) {
+	h := testutil.NewHarness(t, map[string]string{
+		"STREAM_MODE":                  "false",
+		"TELEGRAM_IMAGE_TRANSFER_MODE": "url",
+		"MEDIA_GROUP_WINDOW":           "100",
+	})
+	userID := int64(1014)
+
+	h.LLM.Reply("three photos")
+	updates := []*tgbotapi.Update{
+		h.PhotoMessage(userID, "photo-a", "compare these", "album1"),
+		h.PhotoMessage(userID, "photo-b", "", "album1"),
+		h.PhotoMessage(userID, "photo-c", "", "album1"),
+	}
+	var wg sync.WaitGroup
+	for i, update := range updates {
+		wg.Add(1)
+		go func(update *tgbotapi.Update) {
+			defer wg.Done()
+			assert.NoError(t, h.Dispatch(update))
+		}(update)
+		if i == 0 {
+			// The first photo starts the album
+			time.Sleep(20 * time.Millisecond)
+		}
+	}
+	wg.Wait()
+
+	// A single request carries the caption and every photo, in order
+	requests := h.LLM.Requests()
+	require.Len(t, requests, 1)
+	messages := requests[0].Messages()
+	require.Len(t, messages, 1)
+	parts, ok := messages[0]["content"].([]interface{})
+	require.True(t, ok, "content = %v", messages[0]["content"])
+	require.Len(t, parts, 4)
+	assert.Equal(t, "compare these", parts[0].(map[string]interface{})["text"])
+	for i, fileID := range []string{"photo-a", "photo-b", "photo-c"} {
+		assert.Contains(t, fmt.Sprint(parts[i+1]), fileID)
+	}
+
+	sent := h.Bot.Messages(userID)
+	require.Len(t, sent, 1)
+	assert.Equal(t, "three photos", sent[0].Text)
+
+	history := h.History(userID)
+	require.Len(t, history, 2)
+	assert.Len(t, history[0].MessageIDs, 3)
+}
+
+// TestE2E_Conversations tests archiving with /new, listing with /chats and switching or deleting conversations
+func TestE2E_Conversations(t *testing.T) {
+	h := testutil.NewHarness(t, map[string]string{
+		"STREAM_MODE": "false",
+	})
+	userID := int64(1015)
+	sessionCtx := &storage.SessionContext{ChatID: userID, BotID: h.BotID()}
+
+	h.LLM.Reply("answer one", "Weather Talk")
+	h.Send(userID, "first")
+
+	// /new archives the first conversation and titles it in the background
+	h.Send(userID, "/new")
+	var conversations []*storage.Conversation
+	require.Eventually(t, func() bool {
+		var err error
+		conversations, err = h.DB.ListConversations(sessionCtx)
+		return err == nil && len(conversations) == 1 && conversations[0].Title != ""
+	}, time.Second, 5*time.Millisecond)
+	assert.Equal(t, "Weather Talk", conversations[0].Title)
+	first := conversations[0].ID
+	requests := h.LLM.Requests()
+	require.Len(t, requests, 2)
+	titleMessages := requests[1].Messages()
+	require.Len(t, titleMessages, 3)
+	assert.Equal(t, "first", titleMessages[0]["content"])
+
+	// /chats lists the titles without requesting them
+	h.LLM.Reply("answer two")
+	h.Send(userID, "second")
+	h.Send(userID, "/chats")
+	assert.Len(t, h.LLM.Requests(), 3)
+
+	list, ok := h.Bot.LastMessage(userID)
+	require.True(t, ok)
+	assert.Contains(t, list.ReplyMarkup, "Weather Talk")
+	assert.Contains(t, list.ReplyMarkup, fmt.Sprintf("cs:[%d]", first))
+
+	// Switching restores the conversation and archives the current one
+	require.NoError(t, h.Dispatch(h.CallbackQuery(list, userID, fmt.Sprintf("cs:[%d]", first))))
+	list, _ = h.Bot.LastMessage(userID)
+	assert.Contains(t, list.Text, "Weather Talk")
+	assert.NotContains(t, list.ReplyMarkup, "cs:")
+	history := h.History(userID)
+	require.Len(t, history, 2)
+	assert.Equal(t, "first", history[0].Content)
+
+	conversations, err := h.DB.ListConversations(sessionCtx)
+	require.NoError(t, err)
+	require.Len(t, conversations, 1)
+	second := conversations[0].ID
+
+	// Conversations archived by switching are listed by their date
+	h.Send(userID, "/chats")
+	list, _ = h.Bot.LastMessage(userID)
+	assert.Contains(t, list.ReplyMarkup, conversations[0].CreatedAt.Format("2006-01-02 15:04"))
+
+	// Deleting updates the list; titles are only generated when /new archives
+	require.NoError(t, h.Dispatch(h.CallbackQuery(list, userID, fmt.Sprintf("cd:[%d]", second))))
+	list, _ = h.Bot.LastMessage(userID)
+	assert.Contains(t, list.Text, "Conversation deleted")
+	assert.NotContains(t, list.ReplyMarkup, "cd:")
+	conversations, err = h.DB.ListConversations(sessionCtx)
+	require.NoError(t, err)
+	assert.Empty(t, conversations)
+	assert.Len(t, h.LLM.Requests(), 3)
+
+	// Deleted conversations cannot be switched to
+	require.NoError(t, h.Dispatch(h.CallbackQuery(list, userID, fmt.Sprintf("cs:[%d]", second))))
+	answers := h.Bot.Calls("answerCallbackQuery")
+	assert.Contains(t, answers[len(answers)-1].Params["text"], "not found")
+	assert.Equal(t, "first", h.History(userID)[0].Content)
+}
+
+// TestE2E_ReplyBranching tests forking the conversation by replying to an earlier answer and switching back with /branches
+func TestE2E_ReplyBranching(t *testing.T) {
+	h := testutil.NewHarness(t, map[string]string{
+		"STREAM_MODE":     "false",
+		"REPLY_BRANCHING": "true",
+	})
+	userID := int64(1016)
+
+	h.LLM.Reply("answer one", "answer two", "answer three")
+	h.Send(userID, "first")
+	first, ok := h.Bot.LastMessage(userID)
+	require.True(t, ok)
+	h.Send(userID, "second")
+
+	// Replying to the first answer continues from it
+	update := h.PrivateMessage(userID, "another second")
+	update.Message.ReplyToMessage = &tgbotapi.Message{MessageID: first.MessageID, Chat: update.Message.Chat, Text: first.Text}
+	require.NoError(t, h.Dispatch(update))
+
+	messages := h.LLM.Requests()[2].Messages()
+	require.Len(t, messages, 3)
+	assert.Equal(t, "answer one", messages[1]["content"])
+	assert.Equal(t, "another second", messages[2]["content"])
+	history := h.History(userID)
+	require.Len(t, history, 4)
+	assert.Equal(t, "answer three", history[3].Content)
+
+	// /branches shows the original line, which can be switched back to
+	h.Send(userID, "/branches")
+	list, ok := h.Bot.LastMessage(userID)
+	require.True(t, ok)
+	assert.Contains(t, list.Text, "▶ another second (4)")
+	assert.Contains(t, list.Text, "• second (4)")
+	assert.Contains(t, list.ReplyMarkup, "cs:[")
+
+	var markup tgbotapi.InlineKeyboardMarkup
+	require.NoError(t, json.Unmarshal([]byte(list.ReplyMarkup), &markup))
+	require.Len(t, markup.InlineKeyboard, 1)
+	require.NoError(t, h.Dispatch(h.CallbackQuery(list, userID, *markup.InlineKeyboard[0][0].CallbackData)))
+
+	history = h.History(userID)
+	require.Len(t, history, 4)
+	assert.Equal(t, "answer two", history[3].Content)
+
+	// The tree is kept after switching
+	h.Send(userID, "/branches")
+	list, _ = h.Bot.LastMessage(userID)
+	assert.Contains(t, list.Text, "▶ second (4)")
+	assert.Contains(t, list.Text, "• another second (4)")
+}
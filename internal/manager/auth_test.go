@@ -60,6 +60,26 @@ func (m *MockStorage) CleanupExpiredTokens() error {
 	return nil
 }
 
+func (m *MockStorage) GetCachedResponse(key string) (string, bool, error) {
+	return "", false, nil
+}
+
+func (m *MockStorage) SaveCachedResponse(key string, response string, ttl int) error {
+	return nil
+}
+
+func (m *MockStorage) RecordUsage(botID int64, provider, model string, cacheHit bool) error {
+	return nil
+}
+
+func (m *MockStorage) TakeInlineQuota(botID, userID int64, limit int) (bool, error) {
+	return true, nil
+}
+
+func (m *MockStorage) GetUsageStats(botID int64, since time.Time) ([]*storage.UsageStat, error) {
+	return nil, nil
+}
+
 // Implement other required methods as no-ops
 func (m *MockStorage) GetChatHistory(ctx *storage.SessionContext) ([]storage.HistoryItem, error) {
 	return nil, nil
@@ -73,6 +93,63 @@ func (m *MockStorage) DeleteChatHistory(ctx *storage.SessionContext) error {
 func (m *MockStorage) DeleteAllChatHistory() error {
 	return nil
 }
+func (m *MockStorage) ArchiveChatHistory(ctx *storage.SessionContext) error {
+	return nil
+}
+func (m *MockStorage) RestoreConversation(ctx *storage.SessionContext, id uint) error {
+	return nil
+}
+func (m *MockStorage) GetConversation(id uint) (*storage.Conversation, error) {
+	return nil, storage.ErrNotFound
+}
+func (m *MockStorage) ListConversations(ctx *storage.SessionContext) ([]*storage.Conversation, error) {
+	return nil, nil
+}
+func (m *MockStorage) ListUserConversations(userID int64) ([]*storage.Conversation, error) {
+	return nil, nil
+}
+func (m *MockStorage) UpdateConversationTitle(id uint, title string) error {
+	return nil
+}
+func (m *MockStorage) DeleteConversation(id uint) error {
+	return nil
+}
+func (m *MockStorage) ForkChatHistory(ctx *storage.SessionContext, history []storage.HistoryItem) error {
+	return nil
+}
+func (m *MockStorage) ListBranches(ctx *storage.SessionContext) ([]*storage.Branch, error) {
+	return nil, nil
+}
+func (m *MockStorage) GetWorldInfoEffects(ctx *storage.SessionContext) ([]*storage.WorldInfoEffect, error) {
+	return nil, nil
+}
+func (m *MockStorage) SaveWorldInfoEffects(ctx *storage.SessionContext, effects []*storage.WorldInfoEffect) error {
+	return nil
+}
+func (m *MockStorage) NextWorldInfoTurn(ctx *storage.SessionContext) (int, error) {
+	return 0, nil
+}
+func (m *MockStorage) CreatePersona(persona *storage.Persona) error {
+	return nil
+}
+func (m *MockStorage) GetPersona(id uint) (*storage.Persona, error) {
+	return nil, storage.ErrNotFound
+}
+func (m *MockStorage) ListPersonas(userID int64) ([]*storage.Persona, error) {
+	return nil, nil
+}
+func (m *MockStorage) UpdatePersona(persona *storage.Persona) error {
+	return nil
+}
+func (m *MockStorage) DeletePersona(id uint) error {
+	return nil
+}
+func (m *MockStorage) GetActivePersona(userID int64) (*storage.Persona, error) {
+	return nil, nil
+}
+func (m *MockStorage) ActivatePersona(userID int64, personaID uint) error {
+	return nil
+}
 func (m *MockStorage) GetUserConfig(ctx *storage.SessionContext) (*storage.UserConfig, error) {
 	return nil, nil
 }
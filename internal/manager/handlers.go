@@ -2,6 +2,7 @@ package manager
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -31,12 +32,13 @@ type CharacterCardsListResponse struct {
 }
 
 type CharacterCardDetailResponse struct {
-	ID       uint   `json:"id"`
-	Name     string `json:"name"`
-	Avatar   string `json:"avatar,omitempty"`
-	IsActive bool   `json:"is_active"`
-	UserID   *int64 `json:"user_id,omitempty"`
-	Data     string `json:"data"`
+	ID          uint   `json:"id"`
+	Name        string `json:"name"`
+	Avatar      string `json:"avatar,omitempty"`
+	IsActive    bool   `json:"is_active"`
+	UserID      *int64 `json:"user_id,omitempty"`
+	Data        string `json:"data"`
+	WorldBookID *uint  `json:"world_book_id,omitempty"`
 }
 
 type SuccessResponse struct {
@@ -82,7 +84,10 @@ func (s *Server) handleCharactersRoute(w http.ResponseWriter, r *http.Request) {
 	// Route based on method and path
 	switch r.Method {
 	case http.MethodGet:
-		if strings.Contains(r.URL.Path, "/api/manager/characters/") {
+		if strings.HasSuffix(r.URL.Path, "/export") {
+			// GET /api/manager/characters/:id/export
+			s.handleExportCharacter(w, r, userID)
+		} else if strings.Contains(r.URL.Path, "/api/manager/characters/") {
 			// GET /api/manager/characters/:id
 			s.handleGetCharacter(w, r, userID)
 		} else {
@@ -93,6 +98,9 @@ func (s *Server) handleCharactersRoute(w http.ResponseWriter, r *http.Request) {
 		if strings.Contains(r.URL.Path, "/activate") {
 			// POST /api/manager/characters/:id/activate
 			s.handleActivateCharacter(w, r, userID)
+		} else if strings.HasSuffix(r.URL.Path, "/book") {
+			// POST /api/manager/characters/:id/book
+			s.handleConvertCharacterBook(w, r, userID)
 		} else {
 			// POST /api/manager/characters
 			s.handleUploadCharacter(w, r, userID)
@@ -183,12 +191,13 @@ func (s *Server) handleGetCharacter(w http.ResponseWriter, r *http.Request, user
 	}
 
 	writeJSON(w, http.StatusOK, CharacterCardDetailResponse{
-		ID:       card.ID,
-		Name:     card.Name,
-		Avatar:   card.Avatar,
-		IsActive: card.IsActive,
-		UserID:   card.UserID,
-		Data:     card.Data,
+		ID:          card.ID,
+		Name:        card.Name,
+		Avatar:      card.Avatar,
+		IsActive:    card.IsActive,
+		UserID:      card.UserID,
+		Data:        card.Data,
+		WorldBookID: card.WorldBookID,
 	})
 }
 
@@ -221,26 +230,13 @@ func (s *Server) handleUploadCharacter(w http.ResponseWriter, r *http.Request, u
 		return
 	}
 
-	// Parse character card from file
-	var cardData sillytavern.CharacterCardV2
-	if err := json.Unmarshal(fileData, &cardData); err != nil {
-		writeError(w, http.StatusBadRequest, "invalid character card format")
-		return
-	}
-
-	// Validate it's a V2 card
-	if cardData.Spec != "chara_card_v2" {
-		writeError(w, http.StatusBadRequest, "only SillyTavern V2 format is supported")
+	// Parse character card from file: a PNG image, a CHARX archive or JSON
+	card, err := sillytavern.ImportCard(fileData)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid character card format: "+err.Error())
 		return
 	}
-
-	// Create character card
-	card := &storage.CharacterCard{
-		UserID: &userID,
-		Name:   cardData.Data.Name,
-		Avatar: "", // Could extract from cardData if available
-		Data:   string(fileData),
-	}
+	card.UserID = &userID
 
 	if err := s.storage.CreateCharacterCard(card); err != nil {
 		log.Printf("Error creating character card: %v", err)
@@ -303,17 +299,13 @@ func (s *Server) handleUpdateCharacter(w http.ResponseWriter, r *http.Request, u
 		card.Avatar = updateReq.Avatar
 	}
 	if updateReq.Data != "" {
-		// Validate the data is valid JSON
-		var cardData sillytavern.CharacterCardV2
-		if err := json.Unmarshal([]byte(updateReq.Data), &cardData); err != nil {
-			writeError(w, http.StatusBadRequest, "invalid character card data")
-			return
-		}
-		if cardData.Spec != "chara_card_v2" {
-			writeError(w, http.StatusBadRequest, "only SillyTavern V2 format is supported")
+		// Validate the data as an imported card, upgrading V1 cards
+		cardJSON, _, err := sillytavern.NormalizeCardJSON(updateReq.Data)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid character card data: %v", err))
 			return
 		}
-		card.Data = updateReq.Data
+		card.Data = cardJSON
 	}
 
 	if err := s.storage.UpdateCharacterCard(card); err != nil {
@@ -407,3 +399,86 @@ func (s *Server) handleActivateCharacter(w http.ResponseWriter, r *http.Request,
 
 	writeJSON(w, http.StatusOK, SuccessResponse{Success: true, Message: "character card activated"})
 }
+
+// handleConvertCharacterBook converts the character book embedded in a card to a world book linked to the card
+func (s *Server) handleConvertCharacterBook(w http.ResponseWriter, r *http.Request, userID int64) {
+	cardID, err := parseIDFromPath(r.URL.Path, "/api/manager/characters/")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid character id")
+		return
+	}
+
+	card, err := s.storage.GetCharacterCard(cardID)
+	if err != nil {
+		if err == storage.ErrNotFound {
+			writeError(w, http.StatusNotFound, "character card not found")
+		} else {
+			log.Printf("Error getting character card %d: %v", cardID, err)
+			writeError(w, http.StatusInternalServerError, "failed to get character card")
+		}
+		return
+	}
+
+	// Check permission
+	if !s.permission.CanModifyResource(userID, card.UserID) {
+		writeError(w, http.StatusForbidden, "access denied")
+		return
+	}
+
+	book, err := sillytavern.NewCharacterCardManager(s.storage).ConvertCharacterBook(nil, card.ID)
+	if err != nil {
+		if errors.Is(err, sillytavern.ErrNoCharacterBook) {
+			writeError(w, http.StatusBadRequest, "character card has no character book")
+		} else {
+			log.Printf("Error converting character book of card %d: %v", cardID, err)
+			writeError(w, http.StatusInternalServerError, "failed to convert character book")
+		}
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, WorldBookResponse{
+		ID:       book.ID,
+		Name:     book.Name,
+		IsActive: book.IsActive,
+		UserID:   book.UserID,
+	})
+}
+
+// handleExportCharacter exports a character card in the format it was uploaded in, with its linked world book as character book
+func (s *Server) handleExportCharacter(w http.ResponseWriter, r *http.Request, userID int64) {
+	cardID, err := parseIDFromPath(r.URL.Path, "/api/manager/characters/")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid character id")
+		return
+	}
+
+	card, err := s.storage.GetCharacterCard(cardID)
+	if err != nil {
+		if err == storage.ErrNotFound {
+			writeError(w, http.StatusNotFound, "character card not found")
+		} else {
+			log.Printf("Error getting character card %d: %v", cardID, err)
+			writeError(w, http.StatusInternalServerError, "failed to get character card")
+		}
+		return
+	}
+
+	// Check permission
+	if !s.permission.CanAccessResource(userID, card.UserID) {
+		writeError(w, http.StatusForbidden, "access denied")
+		return
+	}
+
+	fileData, err := sillytavern.NewCharacterCardManager(s.storage).ExportCard(nil, card.ID)
+	if err != nil {
+		log.Printf("Error exporting character card %d: %v", cardID, err)
+		writeError(w, http.StatusInternalServerError, "failed to export character card")
+		return
+	}
+
+	format, contentType := sillytavern.CardFileType(card)
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", card.Name+"."+format))
+	w.WriteHeader(http.StatusOK)
+	w.Write(fileData)
+}
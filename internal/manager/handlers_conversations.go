@@ -0,0 +1,154 @@
+package manager
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/tbxark/ChatGPT-Telegram-Workers/go_version/internal/storage"
+)
+
+// Response types for archived conversations
+type ConversationResponse struct {
+	ID        uint      `json:"id"`
+	Title     string    `json:"title"`
+	ChatID    int64     `json:"chat_id"`
+	ThreadID  *int64    `json:"thread_id,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type ConversationsListResponse struct {
+	Conversations []*ConversationResponse `json:"conversations"`
+}
+
+type ConversationDetailResponse struct {
+	ConversationResponse
+	History []storage.HistoryItem `json:"history"`
+}
+
+// handleConversationsRoute routes conversation requests to appropriate handlers
+func (s *Server) handleConversationsRoute(w http.ResponseWriter, r *http.Request) {
+	userID, ok := GetUserIDFromContext(r)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "user id not found in context")
+		return
+	}
+
+	// Route based on method and path
+	switch r.Method {
+	case http.MethodGet:
+		if strings.Contains(r.URL.Path, "/api/manager/conversations/") {
+			// GET /api/manager/conversations/:id
+			s.handleGetConversation(w, r, userID)
+		} else {
+			// GET /api/manager/conversations
+			s.handleListConversations(w, r, userID)
+		}
+	case http.MethodDelete:
+		// DELETE /api/manager/conversations/:id
+		s.handleDeleteConversation(w, r, userID)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+// handleListConversations lists the archived conversations of the user
+func (s *Server) handleListConversations(w http.ResponseWriter, r *http.Request, userID int64) {
+	conversations, err := s.storage.ListUserConversations(userID)
+	if err != nil {
+		log.Printf("Error listing conversations: %v", err)
+		writeError(w, http.StatusInternalServerError, "failed to list conversations")
+		return
+	}
+
+	response := ConversationsListResponse{Conversations: []*ConversationResponse{}}
+	for _, conversation := range conversations {
+		response.Conversations = append(response.Conversations, toConversationResponse(conversation))
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+// handleGetConversation returns an archived conversation with its history
+func (s *Server) handleGetConversation(w http.ResponseWriter, r *http.Request, userID int64) {
+	conversation, ok := s.userConversation(w, r, userID)
+	if !ok {
+		return
+	}
+
+	var history []storage.HistoryItem
+	if err := json.Unmarshal([]byte(conversation.History), &history); err != nil {
+		log.Printf("Error decoding conversation %d: %v", conversation.ID, err)
+		writeError(w, http.StatusInternalServerError, "failed to decode conversation history")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, ConversationDetailResponse{
+		ConversationResponse: *toConversationResponse(conversation),
+		History:              history,
+	})
+}
+
+// handleDeleteConversation deletes an archived conversation
+func (s *Server) handleDeleteConversation(w http.ResponseWriter, r *http.Request, userID int64) {
+	conversation, ok := s.userConversation(w, r, userID)
+	if !ok {
+		return
+	}
+
+	if err := s.storage.DeleteConversation(conversation.ID); err != nil {
+		log.Printf("Error deleting conversation %d: %v", conversation.ID, err)
+		writeError(w, http.StatusInternalServerError, "failed to delete conversation")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, SuccessResponse{Success: true, Message: "conversation deleted"})
+}
+
+// userConversation loads the conversation of the request path, writing an error response
+// unless it exists and belongs to the user
+func (s *Server) userConversation(w http.ResponseWriter, r *http.Request, userID int64) (*storage.Conversation, bool) {
+	conversationID, err := parseIDFromPath(r.URL.Path, "/api/manager/conversations/")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid conversation id")
+		return nil, false
+	}
+
+	conversation, err := s.storage.GetConversation(conversationID)
+	if err != nil {
+		if err == storage.ErrNotFound {
+			writeError(w, http.StatusNotFound, "conversation not found")
+		} else {
+			log.Printf("Error getting conversation %d: %v", conversationID, err)
+			writeError(w, http.StatusInternalServerError, "failed to get conversation")
+		}
+		return nil, false
+	}
+
+	// Conversations of private chats have no user ID, their chat ID is the user's
+	owner := conversation.ChatID
+	if conversation.UserID != nil {
+		owner = *conversation.UserID
+	}
+	if owner != userID {
+		writeError(w, http.StatusForbidden, "access denied")
+		return nil, false
+	}
+
+	return conversation, true
+}
+
+// toConversationResponse converts a conversation to its API representation, without history
+func toConversationResponse(conversation *storage.Conversation) *ConversationResponse {
+	return &ConversationResponse{
+		ID:        conversation.ID,
+		Title:     conversation.Title,
+		ChatID:    conversation.ChatID,
+		ThreadID:  conversation.ThreadID,
+		CreatedAt: conversation.CreatedAt,
+		UpdatedAt: conversation.UpdatedAt,
+	}
+}
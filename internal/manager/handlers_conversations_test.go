@@ -0,0 +1,136 @@
+package manager
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/tbxark/ChatGPT-Telegram-Workers/go_version/internal/config"
+	"github.com/tbxark/ChatGPT-Telegram-Workers/go_version/internal/storage"
+)
+
+// Extended MockStorage for conversation testing
+type MockStorageWithConversations struct {
+	*MockStorage
+	conversations map[uint]*storage.Conversation
+	nextID        uint
+}
+
+func NewMockStorageWithConversations() *MockStorageWithConversations {
+	return &MockStorageWithConversations{
+		MockStorage:   NewMockStorage(),
+		conversations: make(map[uint]*storage.Conversation),
+		nextID:        1,
+	}
+}
+
+func (m *MockStorageWithConversations) add(conversation *storage.Conversation) {
+	conversation.ID = m.nextID
+	m.nextID++
+	m.conversations[conversation.ID] = conversation
+}
+
+func (m *MockStorageWithConversations) GetConversation(id uint) (*storage.Conversation, error) {
+	conversation, exists := m.conversations[id]
+	if !exists {
+		return nil, storage.ErrNotFound
+	}
+	return conversation, nil
+}
+
+func (m *MockStorageWithConversations) ListUserConversations(userID int64) ([]*storage.Conversation, error) {
+	var result []*storage.Conversation
+	for id := uint(1); id < m.nextID; id++ {
+		conversation, exists := m.conversations[id]
+		if !exists {
+			continue
+		}
+		if (conversation.UserID != nil && *conversation.UserID == userID) || (conversation.UserID == nil && conversation.ChatID == userID) {
+			result = append(result, conversation)
+		}
+	}
+	return result, nil
+}
+
+func (m *MockStorageWithConversations) DeleteConversation(id uint) error {
+	if _, exists := m.conversations[id]; !exists {
+		return storage.ErrNotFound
+	}
+	delete(m.conversations, id)
+	return nil
+}
+
+// TestHandleConversations tests browsing and deleting archived conversations
+func TestHandleConversations(t *testing.T) {
+	mockStorage := NewMockStorageWithConversations()
+	cfg := &config.Config{
+		Port:              8080,
+		EnableUserSetting: true,
+	}
+
+	server := New(cfg, mockStorage)
+	userID := int64(12345)
+	otherID := int64(67890)
+
+	private := &storage.Conversation{ChatID: userID, BotID: 1, Title: "Private", History: `[{"role":"user","content":"hi"}]`}
+	group := &storage.Conversation{ChatID: -100, BotID: 1, UserID: &userID, Title: "Group", History: `[]`}
+	other := &storage.Conversation{ChatID: otherID, BotID: 1, Title: "Other", History: `[]`}
+	mockStorage.add(private)
+	mockStorage.add(group)
+	mockStorage.add(other)
+
+	// List only the user's conversations
+	req := httptest.NewRequest("GET", "/api/manager/conversations", nil)
+	w := httptest.NewRecorder()
+	server.handleListConversations(w, req, userID)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+	var list ConversationsListResponse
+	if err := json.NewDecoder(w.Body).Decode(&list); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(list.Conversations) != 2 {
+		t.Fatalf("Expected 2 conversations, got %d", len(list.Conversations))
+	}
+
+	// Get a conversation with its history
+	req = httptest.NewRequest("GET", fmt.Sprintf("/api/manager/conversations/%d", private.ID), nil)
+	w = httptest.NewRecorder()
+	server.handleGetConversation(w, req, userID)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+	var detail ConversationDetailResponse
+	if err := json.NewDecoder(w.Body).Decode(&detail); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if detail.Title != "Private" || len(detail.History) != 1 {
+		t.Errorf("Unexpected conversation: %+v", detail)
+	}
+
+	// Conversations of other users are not accessible
+	req = httptest.NewRequest("GET", fmt.Sprintf("/api/manager/conversations/%d", other.ID), nil)
+	w = httptest.NewRecorder()
+	server.handleGetConversation(w, req, userID)
+
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Expected status 403, got %d", w.Code)
+	}
+
+	// Delete a conversation
+	req = httptest.NewRequest("DELETE", fmt.Sprintf("/api/manager/conversations/%d", group.ID), nil)
+	w = httptest.NewRecorder()
+	server.handleDeleteConversation(w, req, userID)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", w.Code)
+	}
+	if _, err := mockStorage.GetConversation(group.ID); err != storage.ErrNotFound {
+		t.Error("Expected conversation to be deleted")
+	}
+}
@@ -0,0 +1,242 @@
+package manager
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/tbxark/ChatGPT-Telegram-Workers/go_version/internal/storage"
+)
+
+// Response types for personas
+type PersonaResponse struct {
+	ID          uint   `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	IsActive    bool   `json:"is_active"`
+}
+
+type PersonasListResponse struct {
+	Personas []*PersonaResponse `json:"personas"`
+}
+
+// handlePersonasRoute routes persona requests to appropriate handlers
+func (s *Server) handlePersonasRoute(w http.ResponseWriter, r *http.Request) {
+	userID, ok := GetUserIDFromContext(r)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "user id not found in context")
+		return
+	}
+
+	// Route based on method and path
+	switch r.Method {
+	case http.MethodGet:
+		if strings.Contains(r.URL.Path, "/api/manager/personas/") {
+			// GET /api/manager/personas/:id
+			s.handleGetPersona(w, r, userID)
+		} else {
+			// GET /api/manager/personas
+			s.handleListPersonas(w, r, userID)
+		}
+	case http.MethodPost:
+		if strings.HasSuffix(r.URL.Path, "/activate") {
+			// POST /api/manager/personas/:id/activate
+			s.handleActivatePersona(w, r, userID, true)
+		} else if strings.HasSuffix(r.URL.Path, "/deactivate") {
+			// POST /api/manager/personas/:id/deactivate
+			s.handleActivatePersona(w, r, userID, false)
+		} else {
+			// POST /api/manager/personas
+			s.handleCreatePersona(w, r, userID)
+		}
+	case http.MethodPut:
+		// PUT /api/manager/personas/:id
+		s.handleUpdatePersona(w, r, userID)
+	case http.MethodDelete:
+		// DELETE /api/manager/personas/:id
+		s.handleDeletePersona(w, r, userID)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+// handleListPersonas lists the personas of the user
+func (s *Server) handleListPersonas(w http.ResponseWriter, r *http.Request, userID int64) {
+	personas, err := s.storage.ListPersonas(userID)
+	if err != nil {
+		log.Printf("Error listing personas for user %d: %v", userID, err)
+		writeError(w, http.StatusInternalServerError, "failed to list personas")
+		return
+	}
+
+	response := PersonasListResponse{Personas: []*PersonaResponse{}}
+	for _, persona := range personas {
+		response.Personas = append(response.Personas, toPersonaResponse(persona))
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+// handleGetPersona gets a persona of the user
+func (s *Server) handleGetPersona(w http.ResponseWriter, r *http.Request, userID int64) {
+	persona, ok := s.userPersona(w, r, userID)
+	if !ok {
+		return
+	}
+
+	writeJSON(w, http.StatusOK, toPersonaResponse(persona))
+}
+
+// handleCreatePersona creates a new persona of the user
+func (s *Server) handleCreatePersona(w http.ResponseWriter, r *http.Request, userID int64) {
+	// Parse request body
+	var createReq struct {
+		Name        string `json:"name"`
+		Description string `json:"description"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&createReq); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	// Validate required fields
+	if strings.TrimSpace(createReq.Name) == "" {
+		writeError(w, http.StatusBadRequest, "name is required")
+		return
+	}
+
+	persona := &storage.Persona{
+		UserID:      userID,
+		Name:        strings.TrimSpace(createReq.Name),
+		Description: createReq.Description,
+	}
+
+	if err := s.storage.CreatePersona(persona); err != nil {
+		log.Printf("Error creating persona: %v", err)
+		writeError(w, http.StatusInternalServerError, "failed to create persona")
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, toPersonaResponse(persona))
+}
+
+// handleUpdatePersona updates a persona of the user
+func (s *Server) handleUpdatePersona(w http.ResponseWriter, r *http.Request, userID int64) {
+	persona, ok := s.userPersona(w, r, userID)
+	if !ok {
+		return
+	}
+
+	// Parse request body
+	var updateReq struct {
+		Name        *string `json:"name,omitempty"`
+		Description *string `json:"description,omitempty"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&updateReq); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	// Update fields
+	if updateReq.Name != nil {
+		if strings.TrimSpace(*updateReq.Name) == "" {
+			writeError(w, http.StatusBadRequest, "name cannot be empty")
+			return
+		}
+		persona.Name = strings.TrimSpace(*updateReq.Name)
+	}
+	if updateReq.Description != nil {
+		persona.Description = *updateReq.Description
+	}
+
+	if err := s.storage.UpdatePersona(persona); err != nil {
+		log.Printf("Error updating persona %d: %v", persona.ID, err)
+		writeError(w, http.StatusInternalServerError, "failed to update persona")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, toPersonaResponse(persona))
+}
+
+// handleDeletePersona deletes a persona of the user
+func (s *Server) handleDeletePersona(w http.ResponseWriter, r *http.Request, userID int64) {
+	persona, ok := s.userPersona(w, r, userID)
+	if !ok {
+		return
+	}
+
+	if err := s.storage.DeletePersona(persona.ID); err != nil {
+		log.Printf("Error deleting persona %d: %v", persona.ID, err)
+		writeError(w, http.StatusInternalServerError, "failed to delete persona")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, SuccessResponse{Success: true, Message: "persona deleted"})
+}
+
+// handleActivatePersona activates a persona of the user, or deactivates it so that no persona is active
+func (s *Server) handleActivatePersona(w http.ResponseWriter, r *http.Request, userID int64, activate bool) {
+	persona, ok := s.userPersona(w, r, userID)
+	if !ok {
+		return
+	}
+
+	personaID, message := persona.ID, "persona activated"
+	if !activate {
+		if !persona.IsActive {
+			writeJSON(w, http.StatusOK, SuccessResponse{Success: true, Message: "persona is not active"})
+			return
+		}
+		personaID, message = 0, "persona deactivated"
+	}
+
+	if err := s.storage.ActivatePersona(userID, personaID); err != nil {
+		log.Printf("Error activating persona %d: %v", persona.ID, err)
+		writeError(w, http.StatusInternalServerError, "failed to activate persona")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, SuccessResponse{Success: true, Message: message})
+}
+
+// userPersona loads the persona of the request path, writing an error response
+// unless it exists and belongs to the user
+func (s *Server) userPersona(w http.ResponseWriter, r *http.Request, userID int64) (*storage.Persona, bool) {
+	personaID, err := parseIDFromPath(r.URL.Path, "/api/manager/personas/")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid persona id")
+		return nil, false
+	}
+
+	persona, err := s.storage.GetPersona(personaID)
+	if err != nil {
+		if err == storage.ErrNotFound {
+			writeError(w, http.StatusNotFound, "persona not found")
+		} else {
+			log.Printf("Error getting persona %d: %v", personaID, err)
+			writeError(w, http.StatusInternalServerError, "failed to get persona")
+		}
+		return nil, false
+	}
+
+	// Personas are private to their user
+	if persona.UserID != userID {
+		writeError(w, http.StatusForbidden, "access denied")
+		return nil, false
+	}
+
+	return persona, true
+}
+
+// toPersonaResponse converts a persona to its API representation
+func toPersonaResponse(persona *storage.Persona) *PersonaResponse {
+	return &PersonaResponse{
+		ID:          persona.ID,
+		Name:        persona.Name,
+		Description: persona.Description,
+		IsActive:    persona.IsActive,
+	}
+}
@@ -0,0 +1,177 @@
+package manager
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/tbxark/ChatGPT-Telegram-Workers/go_version/internal/config"
+	"github.com/tbxark/ChatGPT-Telegram-Workers/go_version/internal/storage"
+)
+
+// Extended MockStorage for persona testing
+type MockStorageWithPersonas struct {
+	*MockStorage
+	personas map[uint]*storage.Persona
+	nextID   uint
+}
+
+func NewMockStorageWithPersonas() *MockStorageWithPersonas {
+	return &MockStorageWithPersonas{
+		MockStorage: NewMockStorage(),
+		personas:    make(map[uint]*storage.Persona),
+		nextID:      1,
+	}
+}
+
+func (m *MockStorageWithPersonas) CreatePersona(persona *storage.Persona) error {
+	persona.ID = m.nextID
+	m.nextID++
+	m.personas[persona.ID] = persona
+	return nil
+}
+
+func (m *MockStorageWithPersonas) GetPersona(id uint) (*storage.Persona, error) {
+	persona, exists := m.personas[id]
+	if !exists {
+		return nil, storage.ErrNotFound
+	}
+	return persona, nil
+}
+
+func (m *MockStorageWithPersonas) ListPersonas(userID int64) ([]*storage.Persona, error) {
+	var result []*storage.Persona
+	for id := uint(1); id < m.nextID; id++ {
+		if persona, exists := m.personas[id]; exists && persona.UserID == userID {
+			result = append(result, persona)
+		}
+	}
+	return result, nil
+}
+
+func (m *MockStorageWithPersonas) UpdatePersona(persona *storage.Persona) error {
+	m.personas[persona.ID] = persona
+	return nil
+}
+
+func (m *MockStorageWithPersonas) DeletePersona(id uint) error {
+	if _, exists := m.personas[id]; !exists {
+		return storage.ErrNotFound
+	}
+	delete(m.personas, id)
+	return nil
+}
+
+func (m *MockStorageWithPersonas) ActivatePersona(userID int64, personaID uint) error {
+	for _, persona := range m.personas {
+		if persona.UserID == userID {
+			persona.IsActive = persona.ID == personaID
+		}
+	}
+	return nil
+}
+
+// TestHandlePersonas tests creating, updating, activating and deleting personas
+func TestHandlePersonas(t *testing.T) {
+	mockStorage := NewMockStorageWithPersonas()
+	cfg := &config.Config{
+		Port:              8080,
+		EnableUserSetting: true,
+	}
+
+	server := New(cfg, mockStorage)
+	userID := int64(12345)
+	otherID := int64(67890)
+
+	other := &storage.Persona{UserID: otherID, Name: "Other"}
+	mockStorage.CreatePersona(other)
+
+	// Create a persona
+	req := httptest.NewRequest("POST", "/api/manager/personas", strings.NewReader(`{"name":"Arthur","description":"A knight"}`))
+	w := httptest.NewRecorder()
+	server.handleCreatePersona(w, req, userID)
+
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d", w.Code)
+	}
+	var created PersonaResponse
+	if err := json.NewDecoder(w.Body).Decode(&created); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	// A name is required
+	req = httptest.NewRequest("POST", "/api/manager/personas", strings.NewReader(`{"description":"Nameless"}`))
+	w = httptest.NewRecorder()
+	server.handleCreatePersona(w, req, userID)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400, got %d", w.Code)
+	}
+
+	// List only the user's personas
+	req = httptest.NewRequest("GET", "/api/manager/personas", nil)
+	w = httptest.NewRecorder()
+	server.handleListPersonas(w, req, userID)
+
+	var list PersonasListResponse
+	if err := json.NewDecoder(w.Body).Decode(&list); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(list.Personas) != 1 || list.Personas[0].Name != "Arthur" {
+		t.Fatalf("Expected the user's persona only, got %+v", list.Personas)
+	}
+
+	// Update the description, keeping the name
+	req = httptest.NewRequest("PUT", fmt.Sprintf("/api/manager/personas/%d", created.ID), strings.NewReader(`{"description":"A brave knight"}`))
+	w = httptest.NewRecorder()
+	server.handleUpdatePersona(w, req, userID)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+	if persona, _ := mockStorage.GetPersona(created.ID); persona.Name != "Arthur" || persona.Description != "A brave knight" {
+		t.Errorf("Unexpected persona after update: %+v", persona)
+	}
+
+	// Activate then deactivate it
+	req = httptest.NewRequest("POST", fmt.Sprintf("/api/manager/personas/%d/activate", created.ID), nil)
+	w = httptest.NewRecorder()
+	server.handlePersonasRoute(w, req.WithContext(context.WithValue(req.Context(), "userID", userID)))
+
+	if persona, _ := mockStorage.GetPersona(created.ID); w.Code != http.StatusOK || !persona.IsActive {
+		t.Errorf("Expected persona to be activated, got status %d", w.Code)
+	}
+
+	req = httptest.NewRequest("POST", fmt.Sprintf("/api/manager/personas/%d/deactivate", created.ID), nil)
+	w = httptest.NewRecorder()
+	server.handlePersonasRoute(w, req.WithContext(context.WithValue(req.Context(), "userID", userID)))
+
+	if persona, _ := mockStorage.GetPersona(created.ID); w.Code != http.StatusOK || persona.IsActive {
+		t.Errorf("Expected persona to be deactivated, got status %d", w.Code)
+	}
+
+	// Personas of other users are not accessible
+	req = httptest.NewRequest("DELETE", fmt.Sprintf("/api/manager/personas/%d", other.ID), nil)
+	w = httptest.NewRecorder()
+	server.handleDeletePersona(w, req, userID)
+
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Expected status 403, got %d", w.Code)
+	}
+
+	// Delete the persona
+	req = httptest.NewRequest("DELETE", fmt.Sprintf("/api/manager/personas/%d", created.ID), nil)
+	w = httptest.NewRecorder()
+	server.handleDeletePersona(w, req, userID)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", w.Code)
+	}
+	if _, err := mockStorage.GetPersona(created.ID); err != storage.ErrNotFound {
+		t.Error("Expected persona to be deleted")
+	}
+}
@@ -327,6 +327,71 @@ func TestHandleUploadCharacter_InvalidFormat(t *testing.T) {
 	}
 }
 
+// TestHandleUploadCharacter_V1Export tests uploading a V1 JSON card, upgraded to V2 and exported as JSON
+func TestHandleUploadCharacter_V1Export(t *testing.T) {
+	mockStorage := NewMockStorageWithCharacters()
+	cfg := &config.Config{
+		Port:              8080,
+		EnableUserSetting: true,
+	}
+
+	server := New(cfg, mockStorage)
+	userID := int64(12345)
+
+	body := new(bytes.Buffer)
+	writer := multipart.NewWriter(body)
+	part, err := writer.CreateFormFile("file", "old.json")
+	if err != nil {
+		t.Fatalf("Failed to create form file: %v", err)
+	}
+	if _, err := io.WriteString(part, `{"name": "Old Character", "description": "A V1 card", "first_mes": "Hi"}`); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	writer.Close()
+
+	req := httptest.NewRequest("POST", "/api/manager/characters", body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	w := httptest.NewRecorder()
+
+	server.handleUploadCharacter(w, req, userID)
+
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d. Body: %s", w.Code, w.Body.String())
+	}
+	var resp CharacterCardResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	req = httptest.NewRequest("GET", fmt.Sprintf("/api/manager/characters/%d/export", resp.ID), nil)
+	w = httptest.NewRecorder()
+
+	server.handleExportCharacter(w, req, userID)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d. Body: %s", w.Code, w.Body.String())
+	}
+	if contentType := w.Header().Get("Content-Type"); contentType != "application/json" {
+		t.Errorf("Expected JSON content type, got '%s'", contentType)
+	}
+	if disposition := w.Header().Get("Content-Disposition"); disposition != `attachment; filename="Old Character.json"` {
+		t.Errorf("Unexpected content disposition '%s'", disposition)
+	}
+
+	var exported struct {
+		Spec string `json:"spec"`
+		Data struct {
+			Description string `json:"description"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&exported); err != nil {
+		t.Fatalf("Failed to decode exported card: %v", err)
+	}
+	if exported.Spec != "chara_card_v2" || exported.Data.Description != "A V1 card" {
+		t.Errorf("Expected the card upgraded to V2, got %+v", exported)
+	}
+}
+
 // TestHandleUpdateCharacter tests updating a character card
 func TestHandleUpdateCharacter(t *testing.T) {
 	mockStorage := NewMockStorageWithCharacters()
@@ -375,6 +440,53 @@ func TestHandleUpdateCharacter(t *testing.T) {
 	}
 }
 
+// TestHandleUpdateCharacter_Data tests that updated card data is validated like an imported card
+func TestHandleUpdateCharacter_Data(t *testing.T) {
+	mockStorage := NewMockStorageWithCharacters()
+	cfg := &config.Config{
+		Port:              8080,
+		EnableUserSetting: true,
+	}
+
+	server := New(cfg, mockStorage)
+	userID := int64(12345)
+
+	card := &storage.CharacterCard{
+		Name:   "Test Character",
+		Data:   createValidCharacterCardJSON(),
+		UserID: &userID,
+	}
+	mockStorage.CreateCharacterCard(card)
+
+	update := func(data string) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(map[string]string{"data": data})
+		req := httptest.NewRequest("PUT", fmt.Sprintf("/api/manager/characters/%d", card.ID), bytes.NewReader(body))
+		w := httptest.NewRecorder()
+		server.handleUpdateCharacter(w, req, userID)
+		return w
+	}
+
+	// V1 cards are upgraded to V2
+	if w := update(`{"name": "Aria", "description": "A bard"}`); w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var cardData map[string]interface{}
+	if err := json.Unmarshal([]byte(mockStorage.cards[card.ID].Data), &cardData); err != nil {
+		t.Fatalf("Failed to parse the updated data: %v", err)
+	}
+	if cardData["spec"] != "chara_card_v2" {
+		t.Errorf("Expected the V1 card to be upgraded to V2, got spec %v", cardData["spec"])
+	}
+
+	// Cards without a name are rejected
+	if w := update(`{"spec": "chara_card_v2", "spec_version": "2.0", "data": {"name": ""}}`); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for a card without a name, got %d", w.Code)
+	}
+	if w := update(`{"spec": "invalid_spec", "data": {"name": "Aria"}}`); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for an unsupported spec, got %d", w.Code)
+	}
+}
+
 // TestHandleDeleteCharacter tests deleting a character card
 func TestHandleDeleteCharacter(t *testing.T) {
 	mockStorage := NewMockStorageWithCharacters()
@@ -453,6 +565,34 @@ func TestHandleActivateCharacter(t *testing.T) {
 	}
 }
 
+// TestHandleConvertCharacterBook_NoBook tests converting a card without a character book
+func TestHandleConvertCharacterBook_NoBook(t *testing.T) {
+	mockStorage := NewMockStorageWithCharacters()
+	cfg := &config.Config{
+		Port:              8080,
+		EnableUserSetting: true,
+	}
+
+	server := New(cfg, mockStorage)
+	userID := int64(12345)
+
+	card := &storage.CharacterCard{
+		Name:   "Test Character",
+		Data:   createValidCharacterCardJSON(),
+		UserID: &userID,
+	}
+	mockStorage.CreateCharacterCard(card)
+
+	req := httptest.NewRequest("POST", fmt.Sprintf("/api/manager/characters/%d/book", card.ID), nil)
+	w := httptest.NewRecorder()
+
+	server.handleConvertCharacterBook(w, req, userID)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400, got %d", w.Code)
+	}
+}
+
 // TestHandleCharactersRoute_PermissionDenied tests permission checks
 func TestHandleCharactersRoute_PermissionDenied(t *testing.T) {
 	mockStorage := NewMockStorageWithCharacters()
@@ -9,6 +9,7 @@ import (
 	"strconv"
 	"strings"
 
+	"github.com/tbxark/ChatGPT-Telegram-Workers/go_version/internal/sillytavern"
 	"github.com/tbxark/ChatGPT-Telegram-Workers/go_version/internal/storage"
 )
 
@@ -33,18 +34,29 @@ type WorldBookDetailResponse struct {
 }
 
 type WorldBookEntryResponse struct {
-	ID            uint   `json:"id"`
-	UID           string `json:"uid"`
-	Keys          string `json:"keys"`
-	SecondaryKeys string `json:"secondary_keys,omitempty"`
-	Content       string `json:"content"`
-	Comment       string `json:"comment,omitempty"`
-	Constant      bool   `json:"constant"`
-	Selective     bool   `json:"selective"`
-	Order         int    `json:"order"`
-	Position      string `json:"position"`
-	Enabled       bool   `json:"enabled"`
-	Extensions    string `json:"extensions,omitempty"`
+	ID               uint   `json:"id"`
+	UID              string `json:"uid"`
+	Keys             string `json:"keys"`
+	SecondaryKeys    string `json:"secondary_keys,omitempty"`
+	Content          string `json:"content"`
+	Comment          string `json:"comment,omitempty"`
+	Constant         bool   `json:"constant"`
+	Selective        bool   `json:"selective"`
+	Order            int    `json:"order"`
+	Position         string `json:"position"`
+	Depth            int    `json:"depth"`
+	Role             string `json:"role"`
+	Enabled          bool   `json:"enabled"`
+	SelectiveLogic   int    `json:"selective_logic"`
+	Probability      int    `json:"probability"`
+	UseProbability   bool   `json:"use_probability"`
+	ScanDepth        *int   `json:"scan_depth,omitempty"`
+	ExcludeRecursion bool   `json:"exclude_recursion"`
+	PreventRecursion bool   `json:"prevent_recursion"`
+	Sticky           int    `json:"sticky"`
+	Cooldown         int    `json:"cooldown"`
+	Delay            int    `json:"delay"`
+	Extensions       string `json:"extensions,omitempty"`
 }
 
 type WorldBookEntriesListResponse struct {
@@ -63,8 +75,11 @@ func (s *Server) handleWorldBooksRoute(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case http.MethodGet:
 		if strings.Contains(r.URL.Path, "/api/manager/worldbooks/") {
-			// Check if it's an entries endpoint
-			if strings.Contains(r.URL.Path, "/entries") {
+			// Check if it's an export or entries endpoint
+			if strings.HasSuffix(r.URL.Path, "/export") {
+				// GET /api/manager/worldbooks/:id/export
+				s.handleExportWorldBook(w, r, userID)
+			} else if strings.Contains(r.URL.Path, "/entries") {
 				if strings.Contains(r.URL.Path, "/entries/") {
 					// GET /api/manager/worldbooks/:id/entries/:eid - not used in this task
 					writeError(w, http.StatusMethodNotAllowed, "method not allowed")
@@ -188,6 +203,41 @@ func (s *Server) handleGetWorldBook(w http.ResponseWriter, r *http.Request, user
 	})
 }
 
+// handleExportWorldBook exports a world book in the SillyTavern format, with the current state of its entries
+func (s *Server) handleExportWorldBook(w http.ResponseWriter, r *http.Request, userID int64) {
+	bookID, err := parseIDFromPath(r.URL.Path, "/api/manager/worldbooks/")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid world book id")
+		return
+	}
+
+	book, err := s.storage.GetWorldBook(bookID)
+	if err != nil {
+		if err == storage.ErrNotFound {
+			writeError(w, http.StatusNotFound, "world book not found")
+		} else {
+			log.Printf("Error getting world book %d: %v", bookID, err)
+			writeError(w, http.StatusInternalServerError, "failed to get world book")
+		}
+		return
+	}
+
+	// Check permission
+	if !s.permission.CanAccessResource(userID, book.UserID) {
+		writeError(w, http.StatusForbidden, "access denied")
+		return
+	}
+
+	bookData, err := sillytavern.NewWorldBookManager(s.storage).ExportBook(nil, book.ID)
+	if err != nil {
+		log.Printf("Error exporting world book %d: %v", bookID, err)
+		writeError(w, http.StatusInternalServerError, "failed to export world book")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, bookData)
+}
+
 // handleUploadWorldBook uploads a new world book
 func (s *Server) handleUploadWorldBook(w http.ResponseWriter, r *http.Request, userID int64) {
 	// Check if user can modify personal settings
@@ -443,20 +493,7 @@ func (s *Server) handleListWorldBookEntries(w http.ResponseWriter, r *http.Reque
 
 	var entryResponses []*WorldBookEntryResponse
 	for _, entry := range entries {
-		entryResponses = append(entryResponses, &WorldBookEntryResponse{
-			ID:            entry.ID,
-			UID:           entry.UID,
-			Keys:          entry.Keys,
-			SecondaryKeys: entry.SecondaryKeys,
-			Content:       entry.Content,
-			Comment:       entry.Comment,
-			Constant:      entry.Constant,
-			Selective:     entry.Selective,
-			Order:         entry.Order,
-			Position:      entry.Position,
-			Enabled:       entry.Enabled,
-			Extensions:    entry.Extensions,
-		})
+		entryResponses = append(entryResponses, toWorldBookEntryResponse(entry))
 	}
 
 	writeJSON(w, http.StatusOK, WorldBookEntriesListResponse{Entries: entryResponses})
@@ -521,15 +558,26 @@ func (s *Server) handleUpdateWorldBookEntry(w http.ResponseWriter, r *http.Reque
 
 	// Parse request body
 	var updateReq struct {
-		Keys          string `json:"keys,omitempty"`
-		SecondaryKeys string `json:"secondary_keys,omitempty"`
-		Content       string `json:"content,omitempty"`
-		Comment       string `json:"comment,omitempty"`
-		Constant      *bool  `json:"constant,omitempty"`
-		Selective     *bool  `json:"selective,omitempty"`
-		Order         *int   `json:"order,omitempty"`
-		Position      string `json:"position,omitempty"`
-		Extensions    string `json:"extensions,omitempty"`
+		Keys             string `json:"keys,omitempty"`
+		SecondaryKeys    string `json:"secondary_keys,omitempty"`
+		Content          string `json:"content,omitempty"`
+		Comment          string `json:"comment,omitempty"`
+		Constant         *bool  `json:"constant,omitempty"`
+		Selective        *bool  `json:"selective,omitempty"`
+		Order            *int   `json:"order,omitempty"`
+		Position         string `json:"position,omitempty"`
+		Depth            *int   `json:"depth,omitempty"`
+		Role             string `json:"role,omitempty"`
+		SelectiveLogic   *int   `json:"selective_logic,omitempty"`
+		Probability      *int   `json:"probability,omitempty"`
+		UseProbability   *bool  `json:"use_probability,omitempty"`
+		ScanDepth        *int   `json:"scan_depth,omitempty"`
+		ExcludeRecursion *bool  `json:"exclude_recursion,omitempty"`
+		PreventRecursion *bool  `json:"prevent_recursion,omitempty"`
+		Sticky           *int   `json:"sticky,omitempty"`
+		Cooldown         *int   `json:"cooldown,omitempty"`
+		Delay            *int   `json:"delay,omitempty"`
+		Extensions       string `json:"extensions,omitempty"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&updateReq); err != nil {
@@ -562,6 +610,39 @@ func (s *Server) handleUpdateWorldBookEntry(w http.ResponseWriter, r *http.Reque
 	if updateReq.Position != "" {
 		entry.Position = updateReq.Position
 	}
+	if updateReq.Depth != nil {
+		entry.Depth = *updateReq.Depth
+	}
+	if updateReq.Role != "" {
+		entry.Role = updateReq.Role
+	}
+	if updateReq.SelectiveLogic != nil {
+		entry.SelectiveLogic = *updateReq.SelectiveLogic
+	}
+	if updateReq.Probability != nil {
+		entry.Probability = *updateReq.Probability
+	}
+	if updateReq.UseProbability != nil {
+		entry.UseProbability = *updateReq.UseProbability
+	}
+	if updateReq.ScanDepth != nil {
+		entry.ScanDepth = updateReq.ScanDepth
+	}
+	if updateReq.ExcludeRecursion != nil {
+		entry.ExcludeRecursion = *updateReq.ExcludeRecursion
+	}
+	if updateReq.PreventRecursion != nil {
+		entry.PreventRecursion = *updateReq.PreventRecursion
+	}
+	if updateReq.Sticky != nil {
+		entry.Sticky = *updateReq.Sticky
+	}
+	if updateReq.Cooldown != nil {
+		entry.Cooldown = *updateReq.Cooldown
+	}
+	if updateReq.Delay != nil {
+		entry.Delay = *updateReq.Delay
+	}
 	if updateReq.Extensions != "" {
 		entry.Extensions = updateReq.Extensions
 	}
@@ -572,20 +653,7 @@ func (s *Server) handleUpdateWorldBookEntry(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	writeJSON(w, http.StatusOK, WorldBookEntryResponse{
-		ID:            entry.ID,
-		UID:           entry.UID,
-		Keys:          entry.Keys,
-		SecondaryKeys: entry.SecondaryKeys,
-		Content:       entry.Content,
-		Comment:       entry.Comment,
-		Constant:      entry.Constant,
-		Selective:     entry.Selective,
-		Order:         entry.Order,
-		Position:      entry.Position,
-		Enabled:       entry.Enabled,
-		Extensions:    entry.Extensions,
-	})
+	writeJSON(w, http.StatusOK, toWorldBookEntryResponse(entry))
 }
 
 // handleToggleWorldBookEntry toggles the enabled status of a world book entry
@@ -657,3 +725,32 @@ func (s *Server) handleToggleWorldBookEntry(w http.ResponseWriter, r *http.Reque
 		Message: fmt.Sprintf("entry status toggled to %v", !entry.Enabled),
 	})
 }
+
+// toWorldBookEntryResponse converts a world book entry to its API representation
+func toWorldBookEntryResponse(entry *storage.WorldBookEntry) *WorldBookEntryResponse {
+	return &WorldBookEntryResponse{
+		ID:               entry.ID,
+		UID:              entry.UID,
+		Keys:             entry.Keys,
+		SecondaryKeys:    entry.SecondaryKeys,
+		Content:          entry.Content,
+		Comment:          entry.Comment,
+		Constant:         entry.Constant,
+		Selective:        entry.Selective,
+		Order:            entry.Order,
+		Position:         entry.Position,
+		Depth:            entry.Depth,
+		Role:             entry.Role,
+		Enabled:          entry.Enabled,
+		SelectiveLogic:   entry.SelectiveLogic,
+		Probability:      entry.Probability,
+		UseProbability:   entry.UseProbability,
+		ScanDepth:        entry.ScanDepth,
+		ExcludeRecursion: entry.ExcludeRecursion,
+		PreventRecursion: entry.PreventRecursion,
+		Sticky:           entry.Sticky,
+		Cooldown:         entry.Cooldown,
+		Delay:            entry.Delay,
+		Extensions:       entry.Extensions,
+	}
+}
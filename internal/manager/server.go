@@ -47,6 +47,14 @@ func (s *Server) RegisterRoutes(mux *http.ServeMux) {
 	mux.HandleFunc("/api/manager/regex", s.withAuth(s.handleRegexRoute))
 	mux.HandleFunc("/api/manager/regex/", s.withAuth(s.handleRegexRoute))
 
+	// Conversation endpoints - archived conversations of the user
+	mux.HandleFunc("/api/manager/conversations", s.withAuth(s.handleConversationsRoute))
+	mux.HandleFunc("/api/manager/conversations/", s.withAuth(s.handleConversationsRoute))
+
+	// Persona endpoints - personas of the user
+	mux.HandleFunc("/api/manager/personas", s.withAuth(s.handlePersonasRoute))
+	mux.HandleFunc("/api/manager/personas/", s.withAuth(s.handlePersonasRoute))
+
 	log.Println("Manager routes registered")
 }
 
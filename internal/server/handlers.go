@@ -336,7 +336,7 @@ func (s *Server) getCommandScopes() map[string][]tgbotapi.BotCommand {
 
 	// Register clear_all command (admin only)
 	registry.RegisterAll(
-		command.NewClearAllCommand(s.config),
+		command.NewClearAllChatCommand(s.config, permChecker),
 	)
 	log.Printf("Admin command registered: /clear_all_chat")
 
@@ -11,7 +11,9 @@ import (
 )
 
 // mockStorage is a mock implementation of storage.Storage for testing
-type mockStorage struct{}
+type mockStorage struct {
+	storage.Storage
+}
 
 func (m *mockStorage) GetChatHistory(ctx *storage.SessionContext) ([]storage.HistoryItem, error) {
 	return []storage.HistoryItem{}, nil
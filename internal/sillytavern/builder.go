@@ -1,8 +1,12 @@
 package sillytavern
 
 import (
+	"fmt"
 	"log"
+	"slices"
+	"strings"
 
+	"github.com/tbxark/ChatGPT-Telegram-Workers/go_version/internal/config"
 	"github.com/tbxark/ChatGPT-Telegram-Workers/go_version/internal/storage"
 )
 
@@ -12,6 +16,47 @@ type RequestBuilder struct {
 	worldBookManager *WorldBookManager
 	presetManager    *PresetManager
 	regexProcessor   *RegexProcessor
+	worldInfoConfig  *WorldInfoConfig
+}
+
+// WorldInfoConfig holds configuration for world info, example dialogue and persona injection
+type WorldInfoConfig struct {
+	Budget           int     // Maximum tokens of the triggered entries, 0 for no limit
+	AuthorsNoteDepth int     // Messages from the end of the chat the author's note is inserted at
+	TokensPerChar    float64 // Estimated tokens per character (for rough estimation)
+	ContextSize      int     // Maximum tokens of the prompt, example dialogues only fill what is left; 0 for no limit
+	PersonaPosition  string  // Position of the persona description, one of the PersonaPosition constants
+	PersonaDepth     int     // Messages from the end of the chat the persona description is inserted at, for at_depth
+}
+
+// DefaultWorldInfoConfig returns default configuration
+func DefaultWorldInfoConfig() *WorldInfoConfig {
+	return &WorldInfoConfig{
+		Budget:           2000, // 25% of the default MAX_CONTEXT_LENGTH
+		AuthorsNoteDepth: 4,
+		TokensPerChar:    0.25,
+		ContextSize:      8000, // The default MAX_CONTEXT_LENGTH
+		PersonaPosition:  PersonaPositionPrompt,
+		PersonaDepth:     2,
+	}
+}
+
+// NewWorldInfoConfig creates the world info configuration of the bot configuration.
+// The budget is the smaller of WORLD_INFO_BUDGET and WORLD_INFO_BUDGET_PERCENT of MAX_CONTEXT_LENGTH, when set.
+func NewWorldInfoConfig(cfg *config.Config) *WorldInfoConfig {
+	worldInfoConfig := DefaultWorldInfoConfig()
+	worldInfoConfig.ContextSize = cfg.MaxContextLength
+	if cfg.PersonaPosition != "" {
+		worldInfoConfig.PersonaPosition = cfg.PersonaPosition
+	}
+	worldInfoConfig.Budget = cfg.WorldInfoBudget
+	if cfg.WorldInfoBudgetPercent > 0 {
+		percentBudget := cfg.MaxContextLength * cfg.WorldInfoBudgetPercent / 100
+		if worldInfoConfig.Budget == 0 || percentBudget < worldInfoConfig.Budget {
+			worldInfoConfig.Budget = percentBudget
+		}
+	}
+	return worldInfoConfig
 }
 
 // NewRequestBuilder creates a new RequestBuilder with all dependencies
@@ -26,15 +71,30 @@ func NewRequestBuilder(
 		worldBookManager: worldBookManager,
 		presetManager:    presetManager,
 		regexProcessor:   regexProcessor,
+		worldInfoConfig:  DefaultWorldInfoConfig(),
 	}
 }
 
+// SetWorldInfoConfig sets the world info budget and author's note depth
+func (b *RequestBuilder) SetWorldInfoConfig(worldInfoConfig *WorldInfoConfig) {
+	if worldInfoConfig == nil {
+		worldInfoConfig = DefaultWorldInfoConfig()
+	}
+	b.worldInfoConfig = worldInfoConfig
+}
+
 // BuildContext contains the context needed to build a request
 type BuildContext struct {
-	UserID       *int64                // User ID for loading user-specific configurations
-	History      []storage.HistoryItem // Conversation history
-	CurrentInput string                // Current user input
-	APIType      string                // API type (e.g., "openai", "anthropic")
+	UserID       *int64                  // User ID for loading user-specific configurations
+	History      []storage.HistoryItem   // Conversation history
+	CurrentInput string                  // Current user input
+	APIType      string                  // API type (e.g., "openai", "anthropic")
+	AuthorsNote  string                  // Author's note inserted near the end of the chat
+	Session      *storage.SessionContext // Session tracking the timed world info effects, optional
+	UserName     string                  // Name of the user for {{user}}, DefaultUserName if empty
+	Persona      *storage.Persona        // Active persona of the user, optional; its name replaces UserName
+	Character    *storage.CharacterCard  // Character card played instead of the user's active card, optional
+	Group        string                  // Names of the characters of a group chat for {{group}}, optional
 }
 
 // AIRequest represents an AI request in OpenAI format (intermediate representation)
@@ -61,11 +121,35 @@ type Message struct {
 func (b *RequestBuilder) BuildRequest(ctx *BuildContext) (*AIRequest, error) {
 	log.Printf("[RequestBuilder] Starting request build for user: %v, API type: %s", ctx.UserID, ctx.APIType)
 
-	// 1. Apply input regex transformations
+	// 1. Load the character card of the chat, or else the active character card
+	var characterData *CharacterCardV2
+	var activeCard *storage.CharacterCard
+	if ctx.Character != nil && b.characterManager != nil {
+		activeCard = ctx.Character
+		log.Printf("[RequestBuilder] Loaded character card: %s (ID: %d)", activeCard.Name, activeCard.ID)
+		characterData, _ = b.characterManager.ParseCardData(activeCard.Data)
+	} else if b.characterManager != nil {
+		card, err := b.characterManager.GetActiveCard(ctx.UserID)
+		if err == nil && card != nil {
+			activeCard = card
+			log.Printf("[RequestBuilder] Loaded active character card: %s (ID: %d)", card.Name, card.ID)
+			// Parse character data
+			characterData, _ = b.characterManager.ParseCardData(card.Data)
+		} else if err != nil {
+			log.Printf("[RequestBuilder] No active character card found: %v", err)
+		}
+	}
+
+	macros := NewMacroContext(characterData, ctx.UserName, ctx.History)
+	macros.SetPersona(ctx.Persona)
+	macros.Group = ctx.Group
+	persona := b.personaPlacement(PersonaDescription(ctx.Persona, macros))
+
+	// 2. Apply input regex transformations, expanding the macros of their replacements
 	processedInput := ctx.CurrentInput
 	if b.regexProcessor != nil {
 		var err error
-		processedInput, err = b.regexProcessor.ProcessInput(ctx.UserID, ctx.CurrentInput)
+		processedInput, err = b.regexProcessor.ProcessInputWithMacros(ctx.UserID, ctx.CurrentInput, macros)
 		if err != nil {
 			log.Printf("[RequestBuilder] Error applying input regex: %v", err)
 			// Log error but continue with original input
@@ -75,32 +159,23 @@ func (b *RequestBuilder) BuildRequest(ctx *BuildContext) (*AIRequest, error) {
 		}
 	}
 
-	// 2. Load active character card
-	var characterData *CharacterCardV2
-	if b.characterManager != nil {
-		card, err := b.characterManager.GetActiveCard(ctx.UserID)
-		if err == nil && card != nil {
-			log.Printf("[RequestBuilder] Loaded active character card: %s (ID: %d)", card.Name, card.ID)
-			// Parse character data
-			characterData, _ = b.characterManager.ParseCardData(card.Data)
-		} else if err != nil {
-			log.Printf("[RequestBuilder] No active character card found: %v", err)
-		}
-	}
-
-	// 3. Load active world book
-	var worldBook *storage.WorldBook
+	// 3. Load active world book, merged with the character book of the active card
+	var worldInfoEntries []*storage.WorldBookEntry
 	var triggeredEntries []*storage.WorldBookEntry
 	if b.worldBookManager != nil {
 		book, err := b.worldBookManager.GetActiveBook(ctx.UserID)
 		if err == nil && book != nil {
-			worldBook = book
 			log.Printf("[RequestBuilder] Loaded active world book: %s (ID: %d)", book.Name, book.ID)
+			worldInfoEntries, err = b.worldBookManager.ListEntries(book.ID)
+			if err != nil {
+				log.Printf("[RequestBuilder] Error loading world book entries: %v", err)
+			}
 		} else if err != nil {
 			log.Printf("[RequestBuilder] No active world book found: %v", err)
 		}
-	}
 
+		worldInfoEntries = append(worldInfoEntries, b.characterBookEntries(activeCard, characterData, book)...)
+	}
 	// 4. Load active preset
 	var presetData *PresetData
 	if b.presetManager != nil && ctx.APIType != "" {
@@ -119,43 +194,94 @@ func (b *RequestBuilder) BuildRequest(ctx *BuildContext) (*AIRequest, error) {
 		Messages: []Message{},
 	}
 
-	// 6. Build system prompt from character card
-	systemPrompt := b.buildSystemPrompt(characterData)
-	if systemPrompt != "" {
-		request.Messages = append(request.Messages, Message{
-			Role:    "system",
-			Content: systemPrompt,
+	// 6. Trigger world book entries within the world info budget
+	if len(worldInfoEntries) > 0 {
+		var err error
+		// Only the entries within the budget start their timed effects
+		triggeredEntries, err = b.worldBookManager.TriggerMergedEntries(ctx.Session, worldInfoEntries, ctx.History, func(triggered []*storage.WorldBookEntry) []*storage.WorldBookEntry {
+			return b.applyWorldInfoBudget(expandEntryMacros(triggered, macros))
 		})
-		log.Printf("[RequestBuilder] Added system prompt from character card (%d chars)", len(systemPrompt))
-	}
-
-	// 7. Inject world book entries
-	history := ctx.History
-	if worldBook != nil {
-		// Get triggered entries for logging
-		triggeredEntries, _ = b.worldBookManager.TriggerEntries(worldBook.ID, ctx.History)
+		if err != nil {
+			log.Printf("[RequestBuilder] Error triggering world book entries: %v", err)
+		}
 		if len(triggeredEntries) > 0 {
 			log.Printf("[RequestBuilder] Triggered %d world book entries:", len(triggeredEntries))
 			for _, entry := range triggeredEntries {
 				log.Printf("  - Entry UID: %s, Position: %s, Order: %d", entry.UID, entry.Position, entry.Order)
 			}
 		}
-		history = b.injectWorldBookEntries(worldBook, ctx.History)
 	}
+	positions := groupWorldInfo(triggeredEntries)
+
+	// 7. Convert history to messages with role alternation, then insert the author's note and at-depth entries.
+	// The persona description is part of the author's note or an at-depth entry at those positions, and the
+	// preset prompts with an absolute position are injected at their depth.
+	var prompts []PresetPrompt
+	if presetData != nil {
+		prompts = presetData.OrderedPrompts()
+	}
+	messages := b.enforceRoleAlternation(ctx.History, processedInput)
+	authorsNote := joinPromptParts(persona[PersonaPositionANTop], macros.Expand(ctx.AuthorsNote), persona[PersonaPositionANBottom])
+	depthEntries := append([]*storage.WorldBookEntry(nil), triggeredEntries...)
+	if description := persona[PersonaPositionAtDepth]; description != "" {
+		depthEntries = append(depthEntries, &storage.WorldBookEntry{
+			Content:  description,
+			Position: PositionAtDepth,
+			Depth:    b.personaDepth(),
+			Role:     "system",
+		})
+	}
+	depthEntries = append(depthEntries, presetDepthEntries(prompts, macros)...)
+	messages = b.injectAtDepth(messages, depthEntries, positions, authorsNote)
+
+	// 8. Assemble the prompts of the preset in prompt manager order, when it has some
+	if len(prompts) > 0 {
+		request.Messages = b.presetMessages(prompts, characterData, macros, positions, persona, messages)
+		log.Printf("[RequestBuilder] Assembled %d preset prompts in prompt manager order", len(prompts))
+	} else {
+		// 9. Otherwise build the system prompt from character card, surrounded by the world book entries of its positions,
+		// followed by the example dialogues of the character card that fit in the rest of the context and the entries
+		// after them
+		systemPrompt := joinPromptParts(
+			positions[PositionBeforeChar],
+			macros.Expand(b.buildSystemPrompt(characterData)),
+			positions[PositionAfterChar],
+			persona[PersonaPositionPrompt],
+			positions[PositionBeforeExample],
+		)
+		if systemPrompt != "" {
+			request.Messages = append(request.Messages, Message{
+				Role:    "system",
+				Content: systemPrompt,
+			})
+			log.Printf("[RequestBuilder] Added system prompt from character card (%d chars)", len(systemPrompt))
+		}
+
+		after := positions[PositionAfterExample]
+		if characterData != nil {
+			prompt := append(append([]Message(nil), request.Messages...), messages...)
+			if after != "" {
+				prompt = append(prompt, Message{Role: "system", Content: after})
+			}
+			request.Messages = append(request.Messages, b.exampleMessages(characterData, macros, prompt)...)
+		}
+		if after != "" {
+			request.Messages = append(request.Messages, Message{Role: "system", Content: after})
+		}
 
-	// 8. Convert history to messages with role alternation
-	messages := b.enforceRoleAlternation(history, processedInput)
-	request.Messages = append(request.Messages, messages...)
+		request.Messages = append(request.Messages, messages...)
+	}
 	log.Printf("[RequestBuilder] Built %d messages with strict role alternation", len(messages))
 
-	// 9. Apply preset parameters
+	// 10. Apply preset parameters
 	if presetData != nil {
 		b.applyPresetParameters(request, presetData)
+		request.StopSequences = expandAllMacros(request.StopSequences, macros)
 		log.Printf("[RequestBuilder] Applied preset parameters: temp=%.2f, top_p=%.2f, max_tokens=%d",
 			request.Temperature, request.TopP, request.MaxTokens)
 	}
 
-	// 10. Log final message sequence
+	// 11. Log final message sequence
 	log.Printf("[RequestBuilder] Final message sequence:")
 	for i, msg := range request.Messages {
 		contentPreview := msg.Content
@@ -169,8 +295,148 @@ func (b *RequestBuilder) BuildRequest(ctx *BuildContext) (*AIRequest, error) {
 	return request, nil
 }
 
+// characterBookEntries returns the entries of the character book of the active card: the world book converted
+// from it when there is one, unless it is already the active world book, or else the book embedded in the card
+func (b *RequestBuilder) characterBookEntries(card *storage.CharacterCard, characterData *CharacterCardV2, activeBook *storage.WorldBook) []*storage.WorldBookEntry {
+	if card == nil {
+		return nil
+	}
+
+	if card.WorldBookID != nil {
+		if activeBook != nil && activeBook.ID == *card.WorldBookID {
+			return nil
+		}
+		entries, err := b.worldBookManager.ListEntries(*card.WorldBookID)
+		if err == nil && len(entries) > 0 {
+			log.Printf("[RequestBuilder] Loaded character world book (ID: %d)", *card.WorldBookID)
+			return entries
+		}
+		log.Printf("[RequestBuilder] Character world book unavailable, using the embedded character book: %v", err)
+	}
+
+	if characterData == nil || characterData.Data.CharacterBook == nil {
+		return nil
+	}
+	log.Printf("[RequestBuilder] Loaded embedded character book (%d entries)", len(characterData.Data.CharacterBook.Entries))
+	return CharacterBookEntries(characterData.Data.CharacterBook, fmt.Sprintf("card-%d-", card.ID))
+}
+
+// presetMessages assembles the messages of the prompts of a preset in their order. The chat messages are placed at
+// the chat history marker, or at the end when the order leaves it out; the example dialogues that fit in the context
+// left by the other messages are placed at their marker, surrounded by the world book entries of their positions.
+func (b *RequestBuilder) presetMessages(prompts []PresetPrompt, characterData *CharacterCardV2, macros *MacroContext, positions, persona map[string]string, chat []Message) []Message {
+	var messages []Message
+	examplesIndex := -1
+	chatPlaced := false
+	for _, prompt := range prompts {
+		switch {
+		case prompt.Identifier == PromptChatHistory:
+			for _, message := range chat {
+				messages = appendMerged(messages, message)
+			}
+			chatPlaced = true
+		case prompt.Identifier == PromptDialogueExamples:
+			examplesIndex = len(messages)
+		case prompt.InjectionPosition == PromptInjectionAbsolute && !prompt.Marker:
+			// Injected between the chat messages
+		default:
+			content := strings.TrimSpace(macros.Expand(presetPromptContent(prompt, characterData, positions, persona)))
+			if content != "" {
+				messages = appendMerged(messages, Message{Role: promptRole(prompt.Role), Content: content})
+			}
+		}
+	}
+	if !chatPlaced {
+		for _, message := range chat {
+			messages = appendMerged(messages, message)
+		}
+	}
+
+	if examplesIndex < 0 {
+		return messages
+	}
+	var examples []Message
+	if before := positions[PositionBeforeExample]; before != "" {
+		examples = append(examples, Message{Role: "system", Content: before})
+	}
+	if characterData != nil {
+		examples = append(examples, b.exampleMessages(characterData, macros, messages)...)
+	}
+	if after := positions[PositionAfterExample]; after != "" {
+		examples = append(examples, Message{Role: "system", Content: after})
+	}
+	return slices.Insert(messages, examplesIndex, examples...)
+}
+
+// personaPlacement maps the configured position of the persona description to the description,
+// or returns an empty map when it has no position or no description
+func (b *RequestBuilder) personaPlacement(description string) map[string]string {
+	position := PersonaPositionPrompt
+	if b.worldInfoConfig != nil && b.worldInfoConfig.PersonaPosition != "" {
+		position = b.worldInfoConfig.PersonaPosition
+	}
+	if description == "" || position == PersonaPositionNone {
+		return map[string]string{}
+	}
+	log.Printf("[RequestBuilder] Added persona description at %s", position)
+	return map[string]string{position: description}
+}
+
+// personaDepth returns the depth of the persona description for the at_depth position
+func (b *RequestBuilder) personaDepth() int {
+	if b.worldInfoConfig == nil {
+		return DefaultWorldInfoConfig().PersonaDepth
+	}
+	return b.worldInfoConfig.PersonaDepth
+}
+
+// exampleMessages returns the example dialogues of a character as messages, each dialogue after an
+// [Example Chat] separator, keeping the first dialogues that fit in the context left by the prompt messages
+func (b *RequestBuilder) exampleMessages(characterData *CharacterCardV2, macros *MacroContext, prompt []Message) []Message {
+	dialogues := ParseExampleDialogues(characterData.Data.MesExample, macros)
+	if len(dialogues) == 0 {
+		return nil
+	}
+
+	worldInfoConfig := b.worldInfoConfig
+	if worldInfoConfig == nil {
+		worldInfoConfig = DefaultWorldInfoConfig()
+	}
+	if worldInfoConfig.ContextSize > 0 {
+		budget := worldInfoConfig.ContextSize
+		for _, message := range prompt {
+			budget -= int(float64(len(message.Content)) * worldInfoConfig.TokensPerChar)
+		}
+		kept := LimitExampleDialogues(dialogues, budget, worldInfoConfig.TokensPerChar)
+		if len(kept) < len(dialogues) {
+			log.Printf("[RequestBuilder] Context budget exceeded, dropped %d example dialogues", len(dialogues)-len(kept))
+		}
+		dialogues = kept
+	}
+	if len(dialogues) == 0 {
+		return nil
+	}
+
+	var messages []Message
+	for _, dialogue := range dialogues {
+		messages = append(messages, Message{Role: "system", Content: exampleChatSeparator})
+		for _, message := range dialogue {
+			messages = appendMerged(messages, message)
+		}
+	}
+	messages = append(messages, Message{Role: "system", Content: newChatSeparator})
+	log.Printf("[RequestBuilder] Added %d example dialogues", len(dialogues))
+	return messages
+}
+
 // buildSystemPrompt constructs the system prompt from character card data
 func (b *RequestBuilder) buildSystemPrompt(characterData *CharacterCardV2) string {
+	return BuildCharacterPrompt(characterData)
+}
+
+// BuildCharacterPrompt constructs a system prompt from character card data:
+// its system_prompt, or its description, personality and scenario
+func BuildCharacterPrompt(characterData *CharacterCardV2) string {
 	if characterData == nil {
 		return ""
 	}
@@ -201,81 +467,165 @@ func (b *RequestBuilder) buildSystemPrompt(characterData *CharacterCardV2) strin
 	return prompt
 }
 
-// injectWorldBookEntries injects world book entries into the history
-// This scans the history for trigger keywords and injects matching entries
-func (b *RequestBuilder) injectWorldBookEntries(worldBook *storage.WorldBook, history []storage.HistoryItem) []storage.HistoryItem {
-	// Get triggered entries
-	triggeredEntries, err := b.worldBookManager.TriggerEntries(worldBook.ID, history)
-	if err != nil || len(triggeredEntries) == 0 {
-		return history
+// applyWorldInfoBudget keeps the triggered entries, highest order first, until the world info budget is spent;
+// like SillyTavern, the lowest order entries are dropped first. The kept entries stay in insertion order.
+func (b *RequestBuilder) applyWorldInfoBudget(entries []*storage.WorldBookEntry) []*storage.WorldBookEntry {
+	if b.worldInfoConfig == nil || b.worldInfoConfig.Budget <= 0 {
+		return entries
 	}
 
-	// Separate entries by position
-	beforeCharEntries := make([]*storage.WorldBookEntry, 0)
-	afterCharEntries := make([]*storage.WorldBookEntry, 0)
+	byPriority := slices.Clone(entries)
+	slices.SortStableFunc(byPriority, func(a, b *storage.WorldBookEntry) int {
+		return b.Order - a.Order
+	})
+
+	kept := make(map[*storage.WorldBookEntry]bool, len(entries))
+	tokens := 0
+	for i, entry := range byPriority {
+		tokens += int(float64(len(entry.Content)) * b.worldInfoConfig.TokensPerChar)
+		if tokens > b.worldInfoConfig.Budget {
+			log.Printf("[RequestBuilder] World info budget of %d tokens exceeded, dropped %d entries", b.worldInfoConfig.Budget, len(entries)-i)
+			break
+		}
+		kept[entry] = true
+	}
+	if len(kept) == len(entries) {
+		return entries
+	}
 
-	for _, entry := range triggeredEntries {
-		if entry.Position == "before_char" {
-			beforeCharEntries = append(beforeCharEntries, entry)
-		} else {
-			afterCharEntries = append(afterCharEntries, entry)
+	var result []*storage.WorldBookEntry
+	for _, entry := range entries {
+		if kept[entry] {
+			result = append(result, entry)
 		}
 	}
+	return result
+}
+
+// expandEntryMacros returns copies of the triggered entries with the macros of their content expanded
+func expandEntryMacros(entries []*storage.WorldBookEntry, macros *MacroContext) []*storage.WorldBookEntry {
+	expanded := make([]*storage.WorldBookEntry, len(entries))
+	for i, entry := range entries {
+		entryCopy := *entry
+		entryCopy.Content = macros.Expand(entry.Content)
+		expanded[i] = &entryCopy
+	}
+	return expanded
+}
 
-	// Build new history with injected entries
-	newHistory := make([]storage.HistoryItem, 0, len(history)+len(triggeredEntries))
+// expandAllMacros returns a copy of the texts with their macros expanded
+func expandAllMacros(texts []string, macros *MacroContext) []string {
+	if texts == nil {
+		return nil
+	}
+	expanded := make([]string, len(texts))
+	for i, text := range texts {
+		expanded[i] = macros.Expand(text)
+	}
+	return expanded
+}
 
-	// Add before_char entries at the beginning (after system messages)
-	systemMessageCount := 0
-	for i, item := range history {
-		if item.Role == "system" || item.Role == "summary" {
-			newHistory = append(newHistory, item)
-			systemMessageCount = i + 1
-		} else {
-			break
+// groupWorldInfo joins the content of the triggered entries of each position, except at_depth entries
+func groupWorldInfo(entries []*storage.WorldBookEntry) map[string]string {
+	contents := make(map[string][]string)
+	for _, entry := range entries {
+		position := entry.Position
+		if _, ok := worldInfoPositions[position]; !ok {
+			position = PositionAfterChar
+		}
+		if position != PositionAtDepth {
+			contents[position] = append(contents[position], entry.Content)
 		}
 	}
 
-	// Inject before_char entries
-	for _, entry := range beforeCharEntries {
-		newHistory = append(newHistory, storage.HistoryItem{
-			Role:    "system",
-			Content: entry.Content,
-		})
+	positions := make(map[string]string, len(contents))
+	for position, parts := range contents {
+		positions[position] = strings.Join(parts, "\n")
 	}
+	return positions
+}
 
-	// Add the rest of the history
-	newHistory = append(newHistory, history[systemMessageCount:]...)
+// worldInfoPositions are the known positions of world book entries
+var worldInfoPositions = map[string]bool{
+	PositionBeforeChar:    true,
+	PositionAfterChar:     true,
+	PositionBeforeExample: true,
+	PositionAfterExample:  true,
+	PositionANTop:         true,
+	PositionANBottom:      true,
+	PositionAtDepth:       true,
+}
 
-	// Inject after_char entries at the end (before the current user message)
-	if len(afterCharEntries) > 0 {
-		// Find the last position before user messages
-		insertPos := len(newHistory)
-		for i := len(newHistory) - 1; i >= 0; i-- {
-			if newHistory[i].Role != "user" {
-				insertPos = i + 1
-				break
-			}
+// joinPromptParts joins the non-empty parts of a prompt with blank lines
+func joinPromptParts(parts ...string) string {
+	var nonEmpty []string
+	for _, part := range parts {
+		if part = strings.TrimSpace(part); part != "" {
+			nonEmpty = append(nonEmpty, part)
 		}
+	}
+	return strings.Join(nonEmpty, "\n\n")
+}
 
-		// Insert after_char entries
-		afterEntries := make([]storage.HistoryItem, 0, len(afterCharEntries))
-		for _, entry := range afterCharEntries {
-			afterEntries = append(afterEntries, storage.HistoryItem{
-				Role:    "system",
-				Content: entry.Content,
-			})
+// injectAtDepth inserts the author's note, surrounded by its world book entries, and the at_depth entries
+// between the chat messages. Depth 0 is after the last message, depth 1 before it, and so on.
+func (b *RequestBuilder) injectAtDepth(messages []Message, entries []*storage.WorldBookEntry, positions map[string]string, authorsNote string) []Message {
+	insertions := make(map[int][]Message)
+	insert := func(depth int, message Message) {
+		index := len(messages) - depth
+		if index < 0 {
+			index = 0
 		}
+		if index > len(messages) {
+			index = len(messages)
+		}
+		insertions[index] = append(insertions[index], message)
+	}
+
+	// The author's note is a system message at its depth
+	if note := joinPromptParts(positions[PositionANTop], authorsNote, positions[PositionANBottom]); note != "" {
+		depth := DefaultWorldInfoConfig().AuthorsNoteDepth
+		if b.worldInfoConfig != nil {
+			depth = b.worldInfoConfig.AuthorsNoteDepth
+		}
+		insert(depth, Message{Role: "system", Content: note})
+	}
+
+	for _, entry := range entries {
+		if entry.Position != PositionAtDepth {
+			continue
+		}
+		role := entry.Role
+		if role != "user" && role != "assistant" {
+			role = "system"
+		}
+		insert(entry.Depth, Message{Role: role, Content: entry.Content})
+	}
 
-		// Rebuild history with injected entries
-		result := make([]storage.HistoryItem, 0, len(newHistory)+len(afterEntries))
-		result = append(result, newHistory[:insertPos]...)
-		result = append(result, afterEntries...)
-		result = append(result, newHistory[insertPos:]...)
-		newHistory = result
+	if len(insertions) == 0 {
+		return messages
 	}
 
-	return newHistory
+	// Inserted user and assistant messages are merged with their neighbours of the same role
+	result := make([]Message, 0, len(messages)+len(insertions))
+	for i := 0; i <= len(messages); i++ {
+		for _, message := range insertions[i] {
+			result = appendMerged(result, message)
+		}
+		if i < len(messages) {
+			result = appendMerged(result, messages[i])
+		}
+	}
+	return result
+}
+
+// appendMerged appends a message, merging it into the last message when both are user or assistant messages of the same role
+func appendMerged(messages []Message, message Message) []Message {
+	if n := len(messages); n > 0 && message.Role != "system" && messages[n-1].Role == message.Role {
+		messages[n-1].Content += "\n\n" + message.Content
+		return messages
+	}
+	return append(messages, message)
 }
 
 // enforceRoleAlternation ensures strict user/assistant role alternation
@@ -365,7 +715,7 @@ func (b *RequestBuilder) enforceRoleAlternation(history []storage.HistoryItem, c
 		}
 
 		// Ensure we don't have more than one consecutive message of the same role
-		if i == len(messages)-1 {
+		if i == len(messages)-1 && currentInput != "" {
 			// Last message must be from user
 			if result[len(result)-1].Role != "user" {
 				result = append(result, Message{
@@ -2,10 +2,12 @@ package sillytavern
 
 import (
 	"encoding/json"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"github.com/tbxark/ChatGPT-Telegram-Workers/go_version/internal/config"
 	"github.com/tbxark/ChatGPT-Telegram-Workers/go_version/internal/storage"
 )
 
@@ -304,3 +306,396 @@ func TestRequestBuilder_WithPreset(t *testing.T) {
 	assert.Equal(t, 0.8, request.Temperature)
 	assert.Equal(t, 1024, request.MaxTokens)
 }
+
+func TestRequestBuilder_WorldInfoPositions(t *testing.T) {
+	cardData := CharacterCardV2{
+		Spec:        "chara_card_v2",
+		SpecVersion: "2.0",
+		Data: CharacterCardV2Data{
+			Name:         "TestBot",
+			SystemPrompt: "You are a test bot.",
+		},
+	}
+	cardJSON, _ := json.Marshal(cardData)
+
+	entry := func(uid, position string, order int) *storage.WorldBookEntry {
+		return &storage.WorldBookEntry{UID: uid, Keys: `["dragon"]`, Content: uid, Position: position, Order: order, Enabled: true}
+	}
+	depthEntry := entry("depth", PositionAtDepth, 7)
+	depthEntry.Depth = 1
+	assistantEntry := entry("assistant", PositionAtDepth, 8)
+	assistantEntry.Role = "assistant"
+	assistantEntry.Depth = 2
+
+	mock := &mockStorage{
+		activeCard: &storage.CharacterCard{ID: 1, Name: "TestBot", Data: string(cardJSON)},
+		activeBook: &storage.WorldBook{ID: 1, Name: "World"},
+		bookEntries: []*storage.WorldBookEntry{
+			entry("before_char", PositionBeforeChar, 1),
+			entry("after_char", PositionAfterChar, 2),
+			entry("before_example", PositionBeforeExample, 3),
+			entry("after_example", PositionAfterExample, 4),
+			entry("an_top", PositionANTop, 5),
+			entry("an_bottom", PositionANBottom, 6),
+			depthEntry,
+			assistantEntry,
+		},
+	}
+	builder := NewRequestBuilder(NewCharacterCardManager(mock), NewWorldBookManager(mock), nil, nil)
+	builder.SetWorldInfoConfig(&WorldInfoConfig{AuthorsNoteDepth: 3})
+
+	request, err := builder.BuildRequest(&BuildContext{
+		History: []storage.HistoryItem{
+			{Role: "user", Content: "Tell me about the dragon"},
+			{Role: "assistant", Content: "It sleeps."},
+		},
+		CurrentInput: "Where?",
+		AuthorsNote:  "Keep it short.",
+	})
+	require.NoError(t, err)
+
+	roles := make([]string, len(request.Messages))
+	contents := make([]string, len(request.Messages))
+	for i, msg := range request.Messages {
+		roles[i] = msg.Role
+		contents[i] = msg.Content
+	}
+	assert.Equal(t, []string{"system", "system", "system", "user", "assistant", "system", "user"}, roles)
+	assert.Equal(t, []string{
+		"before_char\n\nYou are a test bot.\n\nafter_char\n\nbefore_example",
+		"after_example",
+		"an_top\n\nKeep it short.\n\nan_bottom",
+		"Tell me about the dragon",
+		"assistant\n\nIt sleeps.",
+		"depth",
+		"Where?",
+	}, contents)
+}
+
+func TestRequestBuilder_CharacterBook(t *testing.T) {
+	cardData := CharacterCardV2{
+		Spec:        "chara_card_v2",
+		SpecVersion: "2.0",
+		Data: CharacterCardV2Data{
+			Name:         "TestBot",
+			SystemPrompt: "You are a test bot.",
+			CharacterBook: &CharacterBook{
+				Entries: []CharacterBookEntry{
+					{Keys: []string{"dragon"}, Content: "card lore", Enabled: true, InsertionOrder: 2, Position: PositionAfterChar},
+					{Keys: []string{"castle"}, Content: "castle lore", Enabled: true, InsertionOrder: 3, Position: PositionAfterChar},
+				},
+			},
+		},
+	}
+	cardJSON, _ := json.Marshal(cardData)
+
+	mock := &mockStorage{
+		activeCard: &storage.CharacterCard{ID: 1, Name: "TestBot", Data: string(cardJSON)},
+		activeBook: &storage.WorldBook{ID: 1, Name: "World"},
+		bookEntries: []*storage.WorldBookEntry{
+			{UID: "world", Keys: `["dragon"]`, Content: "world lore", Position: PositionBeforeChar, Order: 1, Enabled: true},
+		},
+	}
+	builder := NewRequestBuilder(NewCharacterCardManager(mock), NewWorldBookManager(mock), nil, nil)
+
+	request, err := builder.BuildRequest(&BuildContext{
+		History:      []storage.HistoryItem{{Role: "user", Content: "a dragon"}},
+		CurrentInput: "hello",
+	})
+	require.NoError(t, err)
+
+	// The embedded entries are merged with the entries of the active world book
+	require.NotEmpty(t, request.Messages)
+	assert.Equal(t, "world lore\n\nYou are a test bot.\n\ncard lore", request.Messages[0].Content)
+}
+
+func TestRequestBuilder_ExampleDialogues(t *testing.T) {
+	cardData := CharacterCardV2{
+		Spec:        "chara_card_v2",
+		SpecVersion: "2.0",
+		Data: CharacterCardV2Data{
+			Name:         "Aria",
+			SystemPrompt: "You are {{char}}.",
+			MesExample:   "<START>\n{{user}}: Hi\n{{char}}: Hello, {{user}}!\n<START>\n{{user}}: " + strings.Repeat("x", 400),
+		},
+	}
+	cardJSON, _ := json.Marshal(cardData)
+
+	mock := &mockStorage{
+		activeCard: &storage.CharacterCard{ID: 1, Name: "Aria", Data: string(cardJSON)},
+	}
+	builder := NewRequestBuilder(NewCharacterCardManager(mock), nil, nil, nil)
+
+	// The second dialogue does not fit in the context left by the prompt
+	builder.SetWorldInfoConfig(&WorldInfoConfig{TokensPerChar: 0.25, ContextSize: 50})
+
+	request, err := builder.BuildRequest(&BuildContext{
+		CurrentInput: "hello",
+		UserName:     "Bob",
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, []Message{
+		{Role: "system", Content: "You are Aria."},
+		{Role: "system", Content: "[Example Chat]"},
+		{Role: "user", Content: "Hi"},
+		{Role: "assistant", Content: "Hello, Bob!"},
+		{Role: "system", Content: "[Start a new Chat]"},
+		{Role: "user", Content: "hello"},
+	}, request.Messages)
+}
+
+func TestRequestBuilder_Character(t *testing.T) {
+	cardJSON := func(name string) string {
+		data, _ := json.Marshal(CharacterCardV2{
+			Spec:        "chara_card_v2",
+			SpecVersion: "2.0",
+			Data:        CharacterCardV2Data{Name: name, SystemPrompt: "You are {{char}}, with {{group}}."},
+		})
+		return string(data)
+	}
+	mock := &mockStorage{
+		activeCard: &storage.CharacterCard{ID: 1, Name: "Aria", Data: cardJSON("Aria")},
+	}
+	builder := NewRequestBuilder(NewCharacterCardManager(mock), nil, nil, nil)
+
+	// The character of the chat replaces the active card, and a history ending with a reply gets no user message
+	request, err := builder.BuildRequest(&BuildContext{
+		History: []storage.HistoryItem{
+			{Role: "user", Content: "Hi"},
+			{Role: "assistant", Content: "Aria: Hello"},
+		},
+		Character: &storage.CharacterCard{ID: 2, Name: "Cleo", Data: cardJSON("Cleo")},
+		Group:     "Aria, Cleo",
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, []Message{
+		{Role: "system", Content: "You are Cleo, with Aria, Cleo."},
+		{Role: "user", Content: "Hi"},
+		{Role: "assistant", Content: "Aria: Hello"},
+	}, request.Messages)
+}
+
+func TestRequestBuilder_ExampleWorldInfo(t *testing.T) {
+	cardData := CharacterCardV2{
+		Spec:        "chara_card_v2",
+		SpecVersion: "2.0",
+		Data: CharacterCardV2Data{
+			Name:         "Aria",
+			SystemPrompt: "You are {{char}}.",
+			MesExample:   "<START>\n{{user}}: Hi\n{{char}}: Hello!",
+		},
+	}
+	cardJSON, _ := json.Marshal(cardData)
+
+	mock := &mockStorage{
+		activeCard: &storage.CharacterCard{ID: 1, Name: "Aria", Data: string(cardJSON)},
+		activeBook: &storage.WorldBook{ID: 1, Name: "World"},
+		bookEntries: []*storage.WorldBookEntry{
+			{UID: "after", Content: "after the examples", Constant: true, Position: PositionAfterExample, Enabled: true},
+			{UID: "before", Content: "before the examples", Constant: true, Position: PositionBeforeExample, Enabled: true},
+		},
+	}
+	builder := NewRequestBuilder(NewCharacterCardManager(mock), NewWorldBookManager(mock), nil, nil)
+
+	request, err := builder.BuildRequest(&BuildContext{CurrentInput: "hello", UserName: "Bob"})
+	require.NoError(t, err)
+
+	// The entries surround the example dialogues, like in prompt manager order
+	assert.Equal(t, []Message{
+		{Role: "system", Content: "You are Aria.\n\nbefore the examples"},
+		{Role: "system", Content: "[Example Chat]"},
+		{Role: "user", Content: "Hi"},
+		{Role: "assistant", Content: "Hello!"},
+		{Role: "system", Content: "[Start a new Chat]"},
+		{Role: "system", Content: "after the examples"},
+		{Role: "user", Content: "hello"},
+	}, request.Messages)
+}
+
+func TestRequestBuilder_WorldInfoBudget(t *testing.T) {
+	mock := &mockStorage{
+		activeBook: &storage.WorldBook{ID: 1, Name: "World"},
+		bookEntries: []*storage.WorldBookEntry{
+			{UID: "high", Keys: `["dragon"]`, Content: strings.Repeat("h", 40), Order: 300, Enabled: true},
+			{UID: "low", Keys: `["dragon"]`, Content: strings.Repeat("l", 40), Order: 100, Enabled: true},
+			{UID: "medium", Keys: `["dragon"]`, Content: strings.Repeat("m", 40), Order: 200, Enabled: true},
+		},
+	}
+	builder := NewRequestBuilder(nil, NewWorldBookManager(mock), nil, nil)
+	builder.SetWorldInfoConfig(&WorldInfoConfig{Budget: 25, TokensPerChar: 0.25})
+
+	request, err := builder.BuildRequest(&BuildContext{
+		History:      []storage.HistoryItem{{Role: "user", Content: "a dragon"}},
+		CurrentInput: "hello",
+	})
+	require.NoError(t, err)
+
+	// Each entry costs 10 tokens: the lowest order entry does not fit, the others are inserted in ascending order
+	require.NotEmpty(t, request.Messages)
+	assert.Equal(t, "system", request.Messages[0].Role)
+	assert.Equal(t, strings.Repeat("m", 40)+"\n"+strings.Repeat("h", 40), request.Messages[0].Content)
+}
+
+func TestRequestBuilder_Persona(t *testing.T) {
+	cardData := CharacterCardV2{
+		Spec:        "chara_card_v2",
+		SpecVersion: "2.0",
+		Data: CharacterCardV2Data{
+			Name:         "Aria",
+			SystemPrompt: "You are {{char}}, talking to {{user}}.",
+		},
+	}
+	cardJSON, _ := json.Marshal(cardData)
+	persona := &storage.Persona{Name: "Arthur", Description: "{{user}} is a knight."}
+	history := []storage.HistoryItem{
+		{Role: "user", Content: "Hi"},
+		{Role: "assistant", Content: "Hello"},
+	}
+
+	tests := []struct {
+		name     string
+		position string
+		expected []Message
+	}{
+		{"in prompt", PersonaPositionPrompt, []Message{
+			{Role: "system", Content: "You are Aria, talking to Arthur.\n\nArthur is a knight."},
+			{Role: "user", Content: "Hi"},
+			{Role: "assistant", Content: "Hello"},
+			{Role: "user", Content: "Who am I?"},
+		}},
+		{"author's note top", PersonaPositionANTop, []Message{
+			{Role: "system", Content: "You are Aria, talking to Arthur."},
+			{Role: "user", Content: "Hi"},
+			{Role: "assistant", Content: "Hello"},
+			{Role: "system", Content: "Arthur is a knight.\n\nStay in character."},
+			{Role: "user", Content: "Who am I?"},
+		}},
+		{"author's note bottom", PersonaPositionANBottom, []Message{
+			{Role: "system", Content: "You are Aria, talking to Arthur."},
+			{Role: "user", Content: "Hi"},
+			{Role: "assistant", Content: "Hello"},
+			{Role: "system", Content: "Stay in character.\n\nArthur is a knight."},
+			{Role: "user", Content: "Who am I?"},
+		}},
+		{"at depth", PersonaPositionAtDepth, []Message{
+			{Role: "system", Content: "You are Aria, talking to Arthur."},
+			{Role: "user", Content: "Hi"},
+			{Role: "system", Content: "Arthur is a knight."},
+			{Role: "assistant", Content: "Hello"},
+			{Role: "system", Content: "Stay in character."},
+			{Role: "user", Content: "Who am I?"},
+		}},
+		{"none", PersonaPositionNone, []Message{
+			{Role: "system", Content: "You are Aria, talking to Arthur."},
+			{Role: "user", Content: "Hi"},
+			{Role: "assistant", Content: "Hello"},
+			{Role: "user", Content: "Who am I?"},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := &mockStorage{
+				activeCard: &storage.CharacterCard{ID: 1, Name: "Aria", Data: string(cardJSON)},
+			}
+			builder := NewRequestBuilder(NewCharacterCardManager(mock), nil, nil, nil)
+			builder.SetWorldInfoConfig(&WorldInfoConfig{AuthorsNoteDepth: 1, PersonaPosition: tt.position, PersonaDepth: 2})
+
+			authorsNote := "Stay in character."
+			if tt.position == PersonaPositionPrompt || tt.position == PersonaPositionNone {
+				authorsNote = ""
+			}
+			request, err := builder.BuildRequest(&BuildContext{
+				History:      history,
+				CurrentInput: "Who am I?",
+				AuthorsNote:  authorsNote,
+				UserName:     "Bob",
+				Persona:      persona,
+			})
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, request.Messages)
+		})
+	}
+}
+
+func TestNewWorldInfoConfig(t *testing.T) {
+	tests := []struct {
+		name     string
+		budget   int
+		percent  int
+		expected int
+	}{
+		{"percent only", 0, 25, 2000},
+		{"tokens only", 1000, 0, 1000},
+		{"smaller tokens", 1000, 25, 1000},
+		{"smaller percent", 3000, 25, 2000},
+		{"unlimited", 0, 0, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			worldInfoConfig := NewWorldInfoConfig(&config.Config{
+				MaxContextLength:       8000,
+				WorldInfoBudget:        tt.budget,
+				WorldInfoBudgetPercent: tt.percent,
+			})
+			assert.Equal(t, tt.expected, worldInfoConfig.Budget)
+			assert.Equal(t, 8000, worldInfoConfig.ContextSize)
+			assert.Equal(t, PersonaPositionPrompt, worldInfoConfig.PersonaPosition)
+		})
+	}
+}
+
+func TestRequestBuilder_PresetPromptOrder(t *testing.T) {
+	cardData := CharacterCardV2{
+		Spec:        "chara_card_v2",
+		SpecVersion: "2.0",
+		Data: CharacterCardV2Data{
+			Name:                    "Aria",
+			Description:             "{{char}} is a bard.",
+			MesExample:              "<START>\n{{user}}: Hi\n{{char}}: Hello!",
+			PostHistoryInstructions: "{{original}} Sing often.",
+		},
+	}
+	cardJSON, _ := json.Marshal(cardData)
+
+	mock := &mockStorage{
+		activeCard: &storage.CharacterCard{ID: 1, Name: "Aria", Data: string(cardJSON)},
+		activeBook: &storage.WorldBook{ID: 1, Name: "World"},
+		bookEntries: []*storage.WorldBookEntry{
+			{UID: "lore", Keys: `["dragon"]`, Content: "Dragons are real.", Position: PositionBeforeChar, Enabled: true},
+		},
+		activePreset: &storage.Preset{ID: 1, Name: "ST", APIType: "openai", Data: testPresetJSON},
+	}
+	builder := NewRequestBuilder(NewCharacterCardManager(mock), NewWorldBookManager(mock), NewPresetManager(mock), nil)
+
+	request, err := builder.BuildRequest(&BuildContext{
+		History:      []storage.HistoryItem{{Role: "user", Content: "a dragon"}, {Role: "assistant", Content: "Where?"}},
+		CurrentInput: "there",
+		APIType:      "openai",
+		UserName:     "Bob",
+		Persona:      &storage.Persona{Name: "Bob", Description: "{{user}} is a knight."},
+	})
+	require.NoError(t, err)
+
+	// The card has no system prompt, so the preset's main prompt is kept; the post-history instructions override
+	// the preset's. The absolute prompt is merged into the user message at its depth.
+	assert.Equal(t, []Message{
+		{Role: "system", Content: "Dragons are real."},
+		{Role: "system", Content: "Write Aria's next reply."},
+		{Role: "system", Content: "Aria is a bard."},
+		{Role: "system", Content: "Bob is a knight."},
+		{Role: "system", Content: "[Example Chat]"},
+		{Role: "user", Content: "Hi"},
+		{Role: "assistant", Content: "Hello!"},
+		{Role: "system", Content: "[Start a new Chat]"},
+		{Role: "assistant", Content: "Understood."},
+		{Role: "user", Content: "a dragon"},
+		{Role: "assistant", Content: "Where?"},
+		{Role: "user", Content: "Remember the Aria rules.\n\nthere"},
+		{Role: "system", Content: "Stay in character. Sing often."},
+	}, request.Messages)
+	assert.Equal(t, 0.9, request.Temperature)
+}
@@ -0,0 +1,352 @@
+package sillytavern
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/tbxark/ChatGPT-Telegram-Workers/go_version/internal/storage"
+)
+
+// File formats of character cards, a card is exported in the format it was imported from
+const (
+	CardFormatPNG   = "png"
+	CardFormatJSON  = "json"
+	CardFormatCHARX = "charx"
+)
+
+// charxCardPath is the path of the card JSON in a CHARX archive
+const charxCardPath = "card.json"
+
+// Limits of the files extracted from a CHARX archive, checked before any is read
+const (
+	maxCHARXFileSize  = 32 * 1024 * 1024 // Size of a file
+	maxCHARXTotalSize = 64 * 1024 * 1024 // Total size of the files
+	maxCHARXFiles     = 256              // Number of files
+)
+
+// zipSignature starts every zip archive, such as CHARX cards
+var zipSignature = []byte("PK\x03\x04")
+
+// cardV1 is a TavernAI V1 character card, whose fields are at the top level of the JSON
+type cardV1 struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Personality string `json:"personality"`
+	Scenario    string `json:"scenario"`
+	FirstMes    string `json:"first_mes"`
+	MesExample  string `json:"mes_example"`
+
+	// Fields added by SillyTavern to V1 cards
+	CreatorComment string      `json:"creatorcomment"`
+	Tags           []string    `json:"tags"`
+	Talkativeness  interface{} `json:"talkativeness"`
+	Fav            interface{} `json:"fav"`
+}
+
+// ImportCard parses a character card file, detecting its format: a PNG image, a CHARX archive,
+// or a JSON card. V1 cards are upgraded to V2. The card is not saved.
+func ImportCard(fileData []byte) (*storage.CharacterCard, error) {
+	switch {
+	case bytes.HasPrefix(fileData, pngSignature):
+		return NewPNGParser().ParseCharacterCardFromPNG(fileData)
+	case bytes.HasPrefix(fileData, zipSignature):
+		return parseCHARX(fileData)
+	}
+
+	cardJSON, cardData, err := NormalizeCardJSON(string(fileData))
+	if err != nil {
+		return nil, err
+	}
+	return &storage.CharacterCard{
+		Name:   cardData.Data.Name,
+		Data:   cardJSON,
+		Format: CardFormatJSON,
+	}, nil
+}
+
+// CardFileType returns the file format a card is exported to, and its content type.
+// Cards saved before their format was recorded are PNG images when they have a PNG avatar.
+func CardFileType(card *storage.CharacterCard) (string, string) {
+	format := card.Format
+	if format == "" {
+		format = CardFormatJSON
+		if avatarPNG(card.Avatar) != nil {
+			format = CardFormatPNG
+		}
+	}
+
+	switch format {
+	case CardFormatPNG:
+		return format, "image/png"
+	case CardFormatCHARX:
+		return format, "application/zip"
+	default:
+		return CardFormatJSON, "application/json"
+	}
+}
+
+// exportCardFile writes a card in its file format
+func exportCardFile(card *storage.CharacterCard) ([]byte, error) {
+	switch format, _ := CardFileType(card); format {
+	case CardFormatPNG:
+		return NewPNGParser().ExportCardToPNG(card)
+	case CardFormatCHARX:
+		return writeCHARX(card)
+	default:
+		return []byte(card.Data), nil
+	}
+}
+
+// NormalizeCardJSON validates the JSON of a V2 or V3 card, upgrading V1 cards to V2.
+// It returns the JSON to store and the parsed card.
+func NormalizeCardJSON(cardJSON string) (string, *CharacterCardV2, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(cardJSON), &fields); err != nil {
+		return "", nil, fmt.Errorf("invalid character card JSON: %w", err)
+	}
+
+	// V1 cards have no spec
+	if _, ok := fields["spec"]; !ok {
+		upgraded, err := UpgradeCardV1(cardJSON)
+		if err != nil {
+			return "", nil, err
+		}
+		cardJSON = upgraded
+	}
+
+	var cardData CharacterCardV2
+	if err := json.Unmarshal([]byte(cardJSON), &cardData); err != nil {
+		return "", nil, fmt.Errorf("invalid character card JSON: %w", err)
+	}
+	if !IsSupportedCardSpec(cardData.Spec) {
+		return "", nil, fmt.Errorf("unsupported character card spec %q", cardData.Spec)
+	}
+	if cardData.Data.Name == "" {
+		return "", nil, errors.New("character name is required")
+	}
+
+	return cardJSON, &cardData, nil
+}
+
+// UpgradeCardV1 converts a V1 card to the V2 format, as SillyTavern does
+func UpgradeCardV1(cardJSON string) (string, error) {
+	var card cardV1
+	if err := json.Unmarshal([]byte(cardJSON), &card); err != nil {
+		return "", fmt.Errorf("invalid V1 character card: %w", err)
+	}
+	if card.Name == "" {
+		return "", errors.New("invalid V1 character card: name is missing")
+	}
+
+	extensions := map[string]interface{}{}
+	if card.Talkativeness != nil {
+		extensions["talkativeness"] = card.Talkativeness
+	}
+	if card.Fav != nil {
+		extensions["fav"] = card.Fav
+	}
+	tags := card.Tags
+	if tags == nil {
+		tags = []string{}
+	}
+
+	upgraded, err := json.Marshal(CharacterCardV2{
+		Spec:        SpecV2,
+		SpecVersion: "2.0",
+		Data: CharacterCardV2Data{
+			Name:               card.Name,
+			Description:        card.Description,
+			Personality:        card.Personality,
+			Scenario:           card.Scenario,
+			FirstMes:           card.FirstMes,
+			MesExample:         card.MesExample,
+			CreatorNotes:       card.CreatorComment,
+			AlternateGreetings: []string{},
+			Tags:               tags,
+			Extensions:         extensions,
+		},
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal character card data: %w", err)
+	}
+	return string(upgraded), nil
+}
+
+// downgradeCardV3 labels the JSON of a V3 card as V2, for readers of the "chara" PNG chunk.
+// V3 only adds fields to V2, which older readers ignore.
+func downgradeCardV3(cardJSON string) (string, error) {
+	var card map[string]interface{}
+	if err := json.Unmarshal([]byte(cardJSON), &card); err != nil {
+		return "", fmt.Errorf("failed to parse character card data: %w", err)
+	}
+	card["spec"] = SpecV2
+	card["spec_version"] = "2.0"
+
+	downgraded, err := json.Marshal(card)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal character card data: %w", err)
+	}
+	return string(downgraded), nil
+}
+
+// parseCHARX parses a CHARX archive: a zip of the card JSON, card.json, and of the files of its assets.
+// The files are kept with the card, the main icon being its avatar.
+func parseCHARX(fileData []byte) (*storage.CharacterCard, error) {
+	archive, err := zip.NewReader(bytes.NewReader(fileData), int64(len(fileData)))
+	if err != nil {
+		return nil, fmt.Errorf("invalid CHARX archive: %w", err)
+	}
+	if err := checkCHARXSize(archive); err != nil {
+		return nil, err
+	}
+
+	var cardJSON string
+	assets := map[string]string{}
+	for _, file := range archive.File {
+		if file.FileInfo().IsDir() {
+			continue
+		}
+		content, err := readZipFile(file)
+		if err != nil {
+			return nil, err
+		}
+		if file.Name == charxCardPath {
+			cardJSON = string(content)
+		} else {
+			assets[file.Name] = base64.StdEncoding.EncodeToString(content)
+		}
+	}
+	if cardJSON == "" {
+		return nil, errors.New("invalid CHARX archive: card.json not found")
+	}
+
+	cardJSON, cardData, err := NormalizeCardJSON(cardJSON)
+	if err != nil {
+		return nil, err
+	}
+
+	card := &storage.CharacterCard{
+		Name:   cardData.Data.Name,
+		Data:   cardJSON,
+		Format: CardFormatCHARX,
+	}
+	if len(assets) > 0 {
+		assetsJSON, err := json.Marshal(assets)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal card assets: %w", err)
+		}
+		card.Assets = string(assetsJSON)
+	}
+	if path := mainIconPath(cardData.Data.Assets); path != "" {
+		card.Avatar = assets[path]
+	}
+
+	return card, nil
+}
+
+// checkCHARXSize rejects archives with too many files or too large once extracted, from the sizes
+// of their headers. Reading a file fails when it is larger than its header says.
+func checkCHARXSize(archive *zip.Reader) error {
+	if len(archive.File) > maxCHARXFiles {
+		return fmt.Errorf("CHARX archive has too many files (%d, at most %d)", len(archive.File), maxCHARXFiles)
+	}
+	var total uint64
+	for _, file := range archive.File {
+		total += file.UncompressedSize64
+		if total > maxCHARXTotalSize {
+			return fmt.Errorf("CHARX archive is too large once extracted (at most %d MB)", maxCHARXTotalSize/1024/1024)
+		}
+	}
+	return nil
+}
+
+// readZipFile reads a file of a CHARX archive
+func readZipFile(file *zip.File) ([]byte, error) {
+	reader, err := file.Open()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s in CHARX archive: %w", file.Name, err)
+	}
+	defer reader.Close()
+
+	content, err := io.ReadAll(io.LimitReader(reader, maxCHARXFileSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s in CHARX archive: %w", file.Name, err)
+	}
+	if len(content) > maxCHARXFileSize {
+		return nil, fmt.Errorf("%s in CHARX archive is too large", file.Name)
+	}
+	return content, nil
+}
+
+// writeCHARX writes a card and the files of its assets to a CHARX archive
+func writeCHARX(card *storage.CharacterCard) ([]byte, error) {
+	assets := map[string]string{}
+	if card.Assets != "" {
+		if err := json.Unmarshal([]byte(card.Assets), &assets); err != nil {
+			return nil, fmt.Errorf("failed to parse card assets: %w", err)
+		}
+	}
+	paths := make([]string, 0, len(assets))
+	for path := range assets {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	var out bytes.Buffer
+	archive := zip.NewWriter(&out)
+	files := append([]string{charxCardPath}, paths...)
+	for _, path := range files {
+		content := []byte(card.Data)
+		if path != charxCardPath {
+			decoded, err := base64.StdEncoding.DecodeString(assets[path])
+			if err != nil {
+				return nil, fmt.Errorf("failed to decode card asset %s: %w", path, err)
+			}
+			content = decoded
+		}
+
+		writer, err := archive.Create(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to write CHARX archive: %w", err)
+		}
+		if _, err := writer.Write(content); err != nil {
+			return nil, fmt.Errorf("failed to write CHARX archive: %w", err)
+		}
+	}
+	if err := archive.Close(); err != nil {
+		return nil, fmt.Errorf("failed to write CHARX archive: %w", err)
+	}
+	return out.Bytes(), nil
+}
+
+// mainIconPath returns the path in the CHARX archive of the main icon of a card, or an empty string
+func mainIconPath(assets []CardAsset) string {
+	var path string
+	for _, asset := range assets {
+		if asset.Type != "icon" {
+			continue
+		}
+		// The spec spells the scheme "embeded"
+		embedded, ok := strings.CutPrefix(asset.URI, "embeded://")
+		if !ok {
+			embedded, ok = strings.CutPrefix(asset.URI, "embedded://")
+		}
+		if !ok {
+			continue
+		}
+		if asset.Name == "main" {
+			return embedded
+		}
+		if path == "" {
+			path = embedded
+		}
+	}
+	return path
+}
@@ -0,0 +1,281 @@
+package sillytavern
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tbxark/ChatGPT-Telegram-Workers/go_version/internal/storage"
+)
+
+// testCardV3JSON is a V3 card with a string entry ID, a regex lorebook entry and V3 fields
+const testCardV3JSON = `{
+	"spec": "chara_card_v3",
+	"spec_version": "3.0",
+	"data": {
+		"name": "Aria",
+		"nickname": "Ari",
+		"description": "A bard.",
+		"first_mes": "Hello!",
+		"group_only_greetings": ["Hello everyone!"],
+		"creation_date": 1700000000,
+		"assets": [{"type": "icon", "uri": "embeded://assets/icon/main.png", "name": "main", "ext": "png"}],
+		"character_book": {
+			"entries": [
+				{"id": "lute", "keys": ["lutes?"], "content": "Aria plays the lute.", "enabled": true, "insertion_order": 1, "use_regex": true, "extensions": {}},
+				{"id": 7, "keys": ["song"], "content": "Aria sings.", "enabled": true, "insertion_order": 2, "extensions": {}}
+			],
+			"extensions": {}
+		},
+		"extensions": {}
+	}
+}`
+
+// testPNG returns a 1x1 PNG image
+func testPNG(t *testing.T) []byte {
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 1, 1))))
+	return buf.Bytes()
+}
+
+// pngTextChunks returns the decoded tEXt chunks of a PNG image by keyword
+func pngTextChunks(t *testing.T, imageData []byte) map[string]string {
+	chunks := map[string]string{}
+	rest := imageData[len(pngSignature):]
+	for len(rest) >= 12 {
+		length := int(rest[0])<<24 | int(rest[1])<<16 | int(rest[2])<<8 | int(rest[3])
+		if string(rest[4:8]) == "tEXt" {
+			keyword, text, _ := bytes.Cut(rest[8:8+length], []byte{0})
+			decoded, err := base64.StdEncoding.DecodeString(string(text))
+			require.NoError(t, err)
+			chunks[string(keyword)] = string(decoded)
+		}
+		rest = rest[12+length:]
+	}
+	return chunks
+}
+
+func TestParseCardData_V3(t *testing.T) {
+	cardData, err := NewCharacterCardManager(nil).ParseCardData(testCardV3JSON)
+	require.NoError(t, err)
+
+	assert.Equal(t, SpecV3, cardData.Spec)
+	assert.Equal(t, "Ari", cardData.Data.Nickname)
+	assert.Equal(t, []string{"Hello everyone!"}, cardData.Data.GroupOnlyGreetings)
+	assert.Equal(t, int64(1700000000), cardData.Data.CreationDate)
+	require.Len(t, cardData.Data.Assets, 1)
+	assert.Equal(t, "embeded://assets/icon/main.png", cardData.Data.Assets[0].URI)
+
+	book := cardData.Data.CharacterBook
+	require.NotNil(t, book)
+	assert.Equal(t, CharacterBookEntryID("lute"), book.Entries[0].ID)
+	assert.Equal(t, CharacterBookEntryID("7"), book.Entries[1].ID)
+
+	// Regex keys are converted to /pattern/flags world book keys, case-insensitive by default
+	entries := CharacterBookEntries(book, "")
+	require.Len(t, entries, 2)
+	var keys []string
+	require.NoError(t, json.Unmarshal([]byte(entries[0].Keys), &keys))
+	assert.Equal(t, []string{"/lutes?/i"}, keys)
+
+	// Numeric IDs are written back as numbers
+	entryJSON, err := json.Marshal(book.Entries[1])
+	require.NoError(t, err)
+	assert.Contains(t, string(entryJSON), `"id":7,`)
+
+	// The nickname is used for {{char}}
+	assert.Equal(t, "Ari", NewMacroContext(cardData, "Bob", nil).Char)
+}
+
+func TestImportCard_JSONV1(t *testing.T) {
+	card, err := ImportCard([]byte(`{"name": "Old", "description": "An old card.", "first_mes": "Hi {{user}}", "creatorcomment": "Notes", "talkativeness": "0.5"}`))
+	require.NoError(t, err)
+
+	assert.Equal(t, "Old", card.Name)
+	assert.Equal(t, CardFormatJSON, card.Format)
+
+	cardData, err := NewCharacterCardManager(nil).ParseCardData(card.Data)
+	require.NoError(t, err)
+	assert.Equal(t, SpecV2, cardData.Spec)
+	assert.Equal(t, "2.0", cardData.SpecVersion)
+	assert.Equal(t, "An old card.", cardData.Data.Description)
+	assert.Equal(t, "Hi {{user}}", cardData.Data.FirstMes)
+	assert.Equal(t, "Notes", cardData.Data.CreatorNotes)
+	assert.Equal(t, "0.5", cardData.Data.Extensions["talkativeness"])
+
+	// JSON without a name is not a card
+	_, err = ImportCard([]byte(`{"description": "Nameless"}`))
+	assert.Error(t, err)
+
+	// Neither are unknown specs
+	_, err = ImportCard([]byte(`{"spec": "chara_card_v9", "data": {"name": "Future"}}`))
+	assert.Error(t, err)
+}
+
+func TestImportCard_PNGV3(t *testing.T) {
+	card := &storage.CharacterCard{
+		Data:   testCardV3JSON,
+		Avatar: base64.StdEncoding.EncodeToString(testPNG(t)),
+	}
+	imageData, err := NewPNGParser().ExportCardToPNG(card)
+	require.NoError(t, err)
+
+	// V3 cards are written to the ccv3 chunk, with a V2 copy for older readers
+	chunks := pngTextChunks(t, imageData)
+	assert.JSONEq(t, testCardV3JSON, chunks["ccv3"])
+	var v2 CharacterCardV2
+	require.NoError(t, json.Unmarshal([]byte(chunks["chara"]), &v2))
+	assert.Equal(t, SpecV2, v2.Spec)
+	assert.Equal(t, "Ari", v2.Data.Nickname)
+
+	// The ccv3 chunk is preferred
+	imported, err := ImportCard(imageData)
+	require.NoError(t, err)
+	assert.Equal(t, "Aria", imported.Name)
+	assert.Equal(t, CardFormatPNG, imported.Format)
+	assert.JSONEq(t, testCardV3JSON, imported.Data)
+
+	// Exporting a V2 card again drops the ccv3 chunk
+	v2Card := &storage.CharacterCard{Data: chunks["chara"], Avatar: imported.Avatar}
+	reexported, err := NewPNGParser().ExportCardToPNG(v2Card)
+	require.NoError(t, err)
+	chunks = pngTextChunks(t, reexported)
+	assert.NotContains(t, chunks, "ccv3")
+	assert.Contains(t, chunks, "chara")
+}
+
+func TestImportCard_CHARX(t *testing.T) {
+	icon := testPNG(t)
+
+	var archive bytes.Buffer
+	writer := zip.NewWriter(&archive)
+	for path, content := range map[string][]byte{
+		"card.json":                  []byte(testCardV3JSON),
+		"assets/icon/main.png":       icon,
+		"assets/other/notes.txt":     []byte("notes"),
+		"module.risum":               {1, 2, 3},
+		"assets/emotion/happy.webp":  {4, 5},
+		"assets/background/room.png": icon,
+	} {
+		file, err := writer.Create(path)
+		require.NoError(t, err)
+		_, err = file.Write(content)
+		require.NoError(t, err)
+	}
+	require.NoError(t, writer.Close())
+
+	card, err := ImportCard(archive.Bytes())
+	require.NoError(t, err)
+	assert.Equal(t, "Aria", card.Name)
+	assert.Equal(t, CardFormatCHARX, card.Format)
+	assert.Equal(t, base64.StdEncoding.EncodeToString(icon), card.Avatar)
+
+	// The card is exported as a CHARX archive with its assets
+	mock := NewMockStorageWithWorldBook()
+	manager := NewCharacterCardManager(mock)
+	require.NoError(t, manager.SaveCard(card))
+
+	fileData, err := manager.ExportCard(nil, card.ID)
+	require.NoError(t, err)
+	format, contentType := CardFileType(card)
+	assert.Equal(t, CardFormatCHARX, format)
+	assert.Equal(t, "application/zip", contentType)
+
+	exported, err := zip.NewReader(bytes.NewReader(fileData), int64(len(fileData)))
+	require.NoError(t, err)
+	files := map[string][]byte{}
+	for _, file := range exported.File {
+		reader, err := file.Open()
+		require.NoError(t, err)
+		files[file.Name], err = io.ReadAll(reader)
+		require.NoError(t, err)
+		reader.Close()
+	}
+	assert.Len(t, files, 6)
+	assert.JSONEq(t, testCardV3JSON, string(files["card.json"]))
+	assert.Equal(t, icon, files["assets/icon/main.png"])
+	assert.Equal(t, []byte{1, 2, 3}, files["module.risum"])
+
+	// Archives without a card are rejected
+	archive.Reset()
+	writer = zip.NewWriter(&archive)
+	_, err = writer.Create("assets/icon/main.png")
+	require.NoError(t, err)
+	require.NoError(t, writer.Close())
+	_, err = ImportCard(archive.Bytes())
+	assert.Error(t, err)
+}
+
+func TestImportCard_CHARXLimits(t *testing.T) {
+	build := func(t *testing.T, add func(writer *zip.Writer)) []byte {
+		var archive bytes.Buffer
+		writer := zip.NewWriter(&archive)
+		file, err := writer.Create("card.json")
+		require.NoError(t, err)
+		_, err = file.Write([]byte(testCardV3JSON))
+		require.NoError(t, err)
+		add(writer)
+		require.NoError(t, writer.Close())
+		return archive.Bytes()
+	}
+
+	// Too many files
+	fileData := build(t, func(writer *zip.Writer) {
+		for i := 0; i < maxCHARXFiles; i++ {
+			_, err := writer.Create(fmt.Sprintf("assets/other/%d.txt", i))
+			require.NoError(t, err)
+		}
+	})
+	_, err := ImportCard(fileData)
+	assert.ErrorContains(t, err, "too many files")
+
+	// Too large once extracted, from the sizes of the headers
+	fileData = build(t, func(writer *zip.Writer) {
+		for i := 0; i < 3; i++ {
+			file, err := writer.CreateRaw(&zip.FileHeader{
+				Name:               fmt.Sprintf("assets/other/%d.bin", i),
+				Method:             zip.Store,
+				CompressedSize64:   1,
+				UncompressedSize64: maxCHARXFileSize - 1,
+			})
+			require.NoError(t, err)
+			_, err = file.Write([]byte{0})
+			require.NoError(t, err)
+		}
+	})
+	_, err = ImportCard(fileData)
+	assert.ErrorContains(t, err, "too large")
+}
+
+func TestCardFileType(t *testing.T) {
+	avatar := base64.StdEncoding.EncodeToString(testPNG(t))
+
+	tests := []struct {
+		name        string
+		card        *storage.CharacterCard
+		format      string
+		contentType string
+	}{
+		{"png", &storage.CharacterCard{Format: CardFormatPNG}, CardFormatPNG, "image/png"},
+		{"json", &storage.CharacterCard{Format: CardFormatJSON, Avatar: avatar}, CardFormatJSON, "application/json"},
+		{"charx", &storage.CharacterCard{Format: CardFormatCHARX}, CardFormatCHARX, "application/zip"},
+		{"legacy with PNG avatar", &storage.CharacterCard{Avatar: "data:image/png;base64," + avatar}, CardFormatPNG, "image/png"},
+		{"legacy without avatar", &storage.CharacterCard{Avatar: "avatar.png"}, CardFormatJSON, "application/json"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			format, contentType := CardFileType(tt.card)
+			assert.Equal(t, tt.format, format)
+			assert.Equal(t, tt.contentType, contentType)
+		})
+	}
+}
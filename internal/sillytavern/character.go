@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"strconv"
 
 	"github.com/tbxark/ChatGPT-Telegram-Workers/go_version/internal/storage"
 )
@@ -20,7 +21,14 @@ func NewCharacterCardManager(storage storage.Storage) *CharacterCardManager {
 	}
 }
 
-// CharacterCardV2 represents the SillyTavern V2 character card format
+// Specs of the supported character card formats
+const (
+	SpecV2 = "chara_card_v2"
+	SpecV3 = "chara_card_v3"
+)
+
+// CharacterCardV2 represents the SillyTavern V2 character card format.
+// V3 cards, a superset of V2, are parsed into it too.
 type CharacterCardV2 struct {
 	Spec        string              `json:"spec"`
 	SpecVersion string              `json:"spec_version"`
@@ -44,20 +52,86 @@ type CharacterCardV2Data struct {
 	Creator                  string                 `json:"creator"`
 	CharacterVersion         string                 `json:"character_version"`
 	Extensions               map[string]interface{} `json:"extensions"`
+
+	// Character Card V3 fields
+	Nickname                 string            `json:"nickname,omitempty"`                   // Name used for {{char}} instead of the name
+	CreatorNotesMultilingual map[string]string `json:"creator_notes_multilingual,omitempty"` // Creator notes by language code
+	Source                   []string          `json:"source,omitempty"`                     // Where the card comes from
+	GroupOnlyGreetings       []string          `json:"group_only_greetings,omitempty"`       // Greetings only used in group chats
+	CreationDate             int64             `json:"creation_date,omitempty"`              // Unix timestamp in seconds
+	ModificationDate         int64             `json:"modification_date,omitempty"`          // Unix timestamp in seconds
+	Assets                   []CardAsset       `json:"assets,omitempty"`                     // Images and other files of the card
+}
+
+// CardAsset is an asset of a V3 character card. Its URI is a URL, a data URI, embeded:// followed by
+// the path of the asset in a CHARX archive, or ccdefault: for the default asset, such as the PNG of the card.
+type CardAsset struct {
+	Type string `json:"type"` // icon, background, user_icon, emotion or a custom type
+	URI  string `json:"uri"`
+	Name string `json:"name"` // "main" for the main asset of its type
+	Ext  string `json:"ext"`  // File extension, without the dot
 }
 
 // CharacterBook represents the embedded world book in a character card
 type CharacterBook struct {
-	Entries []CharacterBookEntry `json:"entries"`
+	Name              string                 `json:"name,omitempty"`
+	Description       string                 `json:"description,omitempty"`
+	ScanDepth         *int                   `json:"scan_depth,omitempty"`
+	TokenBudget       int                    `json:"token_budget,omitempty"`
+	RecursiveScanning bool                   `json:"recursive_scanning,omitempty"`
+	Extensions        map[string]interface{} `json:"extensions"`
+	Entries           []CharacterBookEntry   `json:"entries"`
 }
 
 // CharacterBookEntry represents a single entry in the character book
+// SillyTavern keeps the settings the V2 spec lacks in its extensions
 type CharacterBookEntry struct {
-	Keys           []string `json:"keys"`
-	Content        string   `json:"content"`
-	Enabled        bool     `json:"enabled"`
-	InsertionOrder int      `json:"insertion_order"`
-	Position       string   `json:"position"`
+	ID             CharacterBookEntryID   `json:"id"`
+	Keys           []string               `json:"keys"`
+	SecondaryKeys  []string               `json:"secondary_keys,omitempty"`
+	Comment        string                 `json:"comment,omitempty"`
+	Name           string                 `json:"name,omitempty"`
+	Content        string                 `json:"content"`
+	Constant       bool                   `json:"constant,omitempty"`
+	Selective      bool                   `json:"selective,omitempty"`
+	Enabled        bool                   `json:"enabled"`
+	InsertionOrder int                    `json:"insertion_order"`
+	Priority       int                    `json:"priority,omitempty"`
+	CaseSensitive  *bool                  `json:"case_sensitive,omitempty"`
+	UseRegex       bool                   `json:"use_regex"` // Keys are regular expressions, in V3 cards
+	Position       string                 `json:"position"`
+	Extensions     map[string]interface{} `json:"extensions"`
+}
+
+// CharacterBookEntryID is the ID of a character book entry: a number in V2 cards, a number or a string in V3 cards
+type CharacterBookEntryID string
+
+// MarshalJSON writes numeric IDs as numbers and other IDs as strings
+func (id CharacterBookEntryID) MarshalJSON() ([]byte, error) {
+	if _, err := strconv.ParseInt(string(id), 10, 64); err == nil {
+		return []byte(id), nil
+	}
+	return json.Marshal(string(id))
+}
+
+// UnmarshalJSON reads a number or a string ID
+func (id *CharacterBookEntryID) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err == nil {
+		*id = CharacterBookEntryID(text)
+		return nil
+	}
+	var number json.Number
+	if err := json.Unmarshal(data, &number); err != nil {
+		return fmt.Errorf("invalid character book entry id: %s", data)
+	}
+	*id = CharacterBookEntryID(number.String())
+	return nil
+}
+
+// IsSupportedCardSpec reports whether the spec is one of the supported character card formats, V2 or V3
+func IsSupportedCardSpec(spec string) bool {
+	return spec == SpecV2 || spec == SpecV3
 }
 
 // LoadCard loads a character card by ID
@@ -83,9 +157,9 @@ func (m *CharacterCardManager) SaveCard(card *storage.CharacterCard) error {
 		return fmt.Errorf("invalid character card data: %w", err)
 	}
 
-	// Validate it's a V2 card
-	if cardData.Spec != "chara_card_v2" {
-		return errors.New("only SillyTavern V2 format is supported")
+	// Validate it's a V2 or V3 card
+	if !IsSupportedCardSpec(cardData.Spec) {
+		return errors.New("only SillyTavern V2 and V3 formats are supported")
 	}
 
 	// Update the name field from the data
@@ -152,9 +226,9 @@ func (m *CharacterCardManager) ParseCardData(data string) (*CharacterCardV2, err
 		return nil, fmt.Errorf("failed to parse character card data: %w", err)
 	}
 
-	// Validate it's a V2 card
-	if cardData.Spec != "chara_card_v2" {
-		return nil, errors.New("only SillyTavern V2 format is supported")
+	// Validate it's a V2 or V3 card
+	if !IsSupportedCardSpec(cardData.Spec) {
+		return nil, errors.New("only SillyTavern V2 and V3 formats are supported")
 	}
 
 	return &cardData, nil
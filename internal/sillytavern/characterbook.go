@@ -0,0 +1,304 @@
+package sillytavern
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/tbxark/ChatGPT-Telegram-Workers/go_version/internal/storage"
+)
+
+// ErrNoCharacterBook is returned when converting the character book of a card without one
+var ErrNoCharacterBook = errors.New("character card has no character book")
+
+// CharacterBookEntries converts the entries of a character book embedded in a card to world book entries,
+// triggered in memory alongside the entries of the active world book. Their UIDs, their index with the prefix,
+// key their timed effects.
+func CharacterBookEntries(book *CharacterBook, uidPrefix string) []*storage.WorldBookEntry {
+	if book == nil {
+		return nil
+	}
+
+	manager := &WorldBookManager{}
+	bookData := book.ToWorldBookData("", uidPrefix)
+	entries := make([]*storage.WorldBookEntry, 0, len(book.Entries))
+	for _, uid := range sortedEntryUIDs(bookData) {
+		entries = append(entries, manager.convertToStorageEntry(0, bookData.Entries[uid]))
+	}
+	return entries
+}
+
+// ToWorldBookData converts a character book to the world book format. The UIDs of the entries
+// are their index with the prefix; the book's scan depth applies to entries without their own.
+func (b *CharacterBook) ToWorldBookData(name, uidPrefix string) *WorldBookData {
+	bookData := &WorldBookData{
+		Name:       name,
+		Entries:    make(map[string]WorldBookEntryData, len(b.Entries)),
+		Extensions: b.Extensions,
+	}
+	for i, entry := range b.Entries {
+		data := entry.toWorldBookEntryData(uidPrefix + strconv.Itoa(i))
+		if data.ScanDepth == nil && b.ScanDepth != nil {
+			scanDepth := *b.ScanDepth
+			data.ScanDepth = &scanDepth
+		}
+		bookData.Entries[data.UID] = data
+	}
+	return bookData
+}
+
+// toWorldBookEntryData converts a character book entry, reading SillyTavern's settings from its extensions
+func (e CharacterBookEntry) toWorldBookEntryData(uid string) WorldBookEntryData {
+	comment := e.Comment
+	if comment == "" {
+		comment = e.Name
+	}
+
+	keys, secondaryKeys := e.Keys, e.SecondaryKeys
+	if e.UseRegex {
+		// World book keys are regular expressions when written as /pattern/flags
+		caseSensitive := e.CaseSensitive != nil && *e.CaseSensitive
+		keys, secondaryKeys = regexKeys(keys, caseSensitive), regexKeys(secondaryKeys, caseSensitive)
+	}
+
+	data := WorldBookEntryData{
+		UID:          uid,
+		Key:          keys,
+		KeySecondary: secondaryKeys,
+		Comment:      comment,
+		Content:      e.Content,
+		Constant:     e.Constant,
+		Selective:    e.Selective,
+		Order:        e.InsertionOrder,
+		Disable:      !e.Enabled,
+		Extensions:   e.Extensions,
+	}
+
+	// Cards from other tools only have the before_char and after_char positions of the spec
+	if position, ok := extensionInt(e.Extensions, "position"); ok {
+		data.Position = position
+	} else if e.Position == PositionBeforeChar {
+		data.Position = 0
+	} else {
+		data.Position = 1
+	}
+
+	data.Depth = 4
+	if depth, ok := extensionInt(e.Extensions, "depth"); ok {
+		data.Depth = depth
+	}
+	if scanDepth, ok := extensionInt(e.Extensions, "scan_depth"); ok {
+		data.ScanDepth = &scanDepth
+	}
+	data.Role, _ = extensionInt(e.Extensions, "role")
+	data.SelectiveLogic, _ = extensionInt(e.Extensions, "selectiveLogic")
+	data.Probability, _ = extensionInt(e.Extensions, "probability")
+	data.UseProbability, _ = e.Extensions["useProbability"].(bool)
+	data.ExcludeRecursion, _ = e.Extensions["exclude_recursion"].(bool)
+	data.PreventRecursion, _ = e.Extensions["prevent_recursion"].(bool)
+	data.Sticky, _ = extensionInt(e.Extensions, "sticky")
+	data.Cooldown, _ = extensionInt(e.Extensions, "cooldown")
+	data.Delay, _ = extensionInt(e.Extensions, "delay")
+
+	return data
+}
+
+// regexKeys writes the regular expression keys of a V3 entry as /pattern/flags world book keys,
+// case-insensitive unless the entry is case-sensitive
+func regexKeys(keys []string, caseSensitive bool) []string {
+	if keys == nil {
+		return nil
+	}
+	flags := "i"
+	if caseSensitive {
+		flags = ""
+	}
+	converted := make([]string, len(keys))
+	for i, key := range keys {
+		if regexKeyPattern.MatchString(key) {
+			converted[i] = key
+		} else {
+			converted[i] = "/" + key + "/" + flags
+		}
+	}
+	return converted
+}
+
+// NewCharacterBook converts a world book to a character book to embed in a card,
+// keeping SillyTavern's settings in the extensions of its entries
+func NewCharacterBook(bookData *WorldBookData) *CharacterBook {
+	book := &CharacterBook{
+		Name:       bookData.Name,
+		Extensions: bookData.Extensions,
+		Entries:    make([]CharacterBookEntry, 0, len(bookData.Entries)),
+	}
+	if book.Extensions == nil {
+		book.Extensions = map[string]interface{}{}
+	}
+
+	for i, uid := range sortedEntryUIDs(bookData) {
+		data := bookData.Entries[uid]
+
+		extensions := make(map[string]interface{}, len(data.Extensions)+12)
+		for key, value := range data.Extensions {
+			extensions[key] = value
+		}
+		extensions["position"] = data.Position
+		extensions["depth"] = data.Depth
+		extensions["role"] = data.Role
+		extensions["selectiveLogic"] = data.SelectiveLogic
+		extensions["probability"] = data.Probability
+		extensions["useProbability"] = data.UseProbability
+		extensions["exclude_recursion"] = data.ExcludeRecursion
+		extensions["prevent_recursion"] = data.PreventRecursion
+		extensions["scan_depth"] = data.ScanDepth
+		extensions["sticky"] = data.Sticky
+		extensions["cooldown"] = data.Cooldown
+		extensions["delay"] = data.Delay
+
+		position := PositionAfterChar
+		if data.Position == 0 {
+			position = PositionBeforeChar
+		}
+		keys := data.Key
+		if keys == nil {
+			keys = []string{}
+		}
+
+		book.Entries = append(book.Entries, CharacterBookEntry{
+			ID:             CharacterBookEntryID(strconv.Itoa(i)),
+			Keys:           keys,
+			SecondaryKeys:  data.KeySecondary,
+			Comment:        data.Comment,
+			Content:        data.Content,
+			Constant:       data.Constant,
+			Selective:      data.Selective,
+			Enabled:        !data.Disable,
+			InsertionOrder: data.Order,
+			Position:       position,
+			Extensions:     extensions,
+		})
+	}
+	return book
+}
+
+// ConvertCharacterBook saves the character book embedded in a card as a standalone world book.
+// The world book is linked to the card: it is used in place of the embedded book and exported with the card.
+func (m *CharacterCardManager) ConvertCharacterBook(userID *int64, cardID uint) (*storage.WorldBook, error) {
+	card, err := m.LoadCard(userID, cardID)
+	if err != nil {
+		return nil, err
+	}
+	cardData, err := m.ParseCardData(card.Data)
+	if err != nil {
+		return nil, err
+	}
+	characterBook := cardData.Data.CharacterBook
+	if characterBook == nil || len(characterBook.Entries) == 0 {
+		return nil, ErrNoCharacterBook
+	}
+
+	name := characterBook.Name
+	if name == "" {
+		name = cardData.Data.Name
+	}
+
+	// Entry UIDs are unique across all world books
+	uidPrefix := fmt.Sprintf("card-%d-%d-", card.ID, time.Now().UnixNano())
+	bookJSON, err := json.Marshal(characterBook.ToWorldBookData(name, uidPrefix))
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal world book: %w", err)
+	}
+
+	book := &storage.WorldBook{
+		UserID: card.UserID,
+		Data:   string(bookJSON),
+	}
+	if err := NewWorldBookManager(m.storage).SaveBook(book); err != nil {
+		return nil, err
+	}
+
+	card.WorldBookID = &book.ID
+	if err := m.storage.UpdateCharacterCard(card); err != nil {
+		return nil, fmt.Errorf("failed to link world book to character card: %w", err)
+	}
+
+	return book, nil
+}
+
+// ExportCard exports a character card to the file format it was imported from, see CardFileType.
+// A linked world book is embedded as its character book.
+func (m *CharacterCardManager) ExportCard(userID *int64, cardID uint) ([]byte, error) {
+	card, err := m.LoadCard(userID, cardID)
+	if err != nil {
+		return nil, err
+	}
+
+	exported := *card
+	if card.WorldBookID != nil {
+		bookData, err := NewWorldBookManager(m.storage).ExportBook(nil, *card.WorldBookID)
+		switch {
+		case err == nil:
+			exported.Data, err = embedCharacterBook(card.Data, NewCharacterBook(bookData))
+			if err != nil {
+				return nil, err
+			}
+		case errors.Is(err, storage.ErrNotFound):
+			// The linked world book was deleted, the embedded book is exported as it is
+		default:
+			return nil, fmt.Errorf("failed to export character book: %w", err)
+		}
+	}
+
+	return exportCardFile(&exported)
+}
+
+// embedCharacterBook replaces the character book of the card JSON, keeping its other fields as they are
+func embedCharacterBook(cardJSON string, book *CharacterBook) (string, error) {
+	var card map[string]interface{}
+	if err := json.Unmarshal([]byte(cardJSON), &card); err != nil {
+		return "", fmt.Errorf("failed to parse character card data: %w", err)
+	}
+	data, ok := card["data"].(map[string]interface{})
+	if !ok {
+		return "", errors.New("character card has no data")
+	}
+	data["character_book"] = book
+
+	updated, err := json.Marshal(card)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal character card data: %w", err)
+	}
+	return string(updated), nil
+}
+
+// sortedEntryUIDs returns the UIDs of the entries of a world book by order, then UID
+func sortedEntryUIDs(bookData *WorldBookData) []string {
+	uids := make([]string, 0, len(bookData.Entries))
+	for uid := range bookData.Entries {
+		uids = append(uids, uid)
+	}
+	sort.Slice(uids, func(i, j int) bool {
+		a, b := bookData.Entries[uids[i]], bookData.Entries[uids[j]]
+		if a.Order != b.Order {
+			return a.Order < b.Order
+		}
+		return uids[i] < uids[j]
+	})
+	return uids
+}
+
+// extensionInt reads a number from the extensions of a character book entry
+func extensionInt(extensions map[string]interface{}, key string) (int, bool) {
+	switch v := extensions[key].(type) {
+	case float64:
+		return int(v), true
+	case int:
+		return v, true
+	default:
+		return 0, false
+	}
+}
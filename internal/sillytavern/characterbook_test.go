@@ -0,0 +1,173 @@
+package sillytavern
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"image"
+	"image/png"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tbxark/ChatGPT-Telegram-Workers/go_version/internal/storage"
+)
+
+// testCharacterBook returns a character book with a spec entry and an entry with SillyTavern extensions
+func testCharacterBook() *CharacterBook {
+	scanDepth := 2
+	return &CharacterBook{
+		Name:      "Lore",
+		ScanDepth: &scanDepth,
+		Entries: []CharacterBookEntry{
+			{
+				Keys:           []string{"dragon"},
+				Content:        "Dragons breathe fire.",
+				Enabled:        true,
+				InsertionOrder: 10,
+				Position:       PositionBeforeChar,
+			},
+			{
+				Keys:           []string{"castle"},
+				SecondaryKeys:  []string{"king"},
+				Name:           "Castle",
+				Content:        "The castle stands on a hill.",
+				Selective:      true,
+				Enabled:        false,
+				InsertionOrder: 20,
+				Position:       PositionAfterChar,
+				Extensions: map[string]interface{}{
+					"position":       float64(4),
+					"depth":          float64(2),
+					"role":           float64(1),
+					"selectiveLogic": float64(SelectiveNotAny),
+					"sticky":         float64(3),
+					"custom":         "kept",
+				},
+			},
+		},
+	}
+}
+
+func TestCharacterBook_ToWorldBookData(t *testing.T) {
+	bookData := testCharacterBook().ToWorldBookData("Lore", "card-")
+
+	require.Len(t, bookData.Entries, 2)
+
+	dragon := bookData.Entries["card-0"]
+	assert.Equal(t, []string{"dragon"}, dragon.Key)
+	assert.Equal(t, 0, dragon.Position)
+	assert.Equal(t, 4, dragon.Depth)
+	assert.Equal(t, 10, dragon.Order)
+	assert.False(t, dragon.Disable)
+	require.NotNil(t, dragon.ScanDepth)
+	assert.Equal(t, 2, *dragon.ScanDepth)
+
+	castle := bookData.Entries["card-1"]
+	assert.Equal(t, "Castle", castle.Comment)
+	assert.Equal(t, []string{"king"}, castle.KeySecondary)
+	assert.Equal(t, 4, castle.Position)
+	assert.Equal(t, 2, castle.Depth)
+	assert.Equal(t, 1, castle.Role)
+	assert.Equal(t, SelectiveNotAny, castle.SelectiveLogic)
+	assert.Equal(t, 3, castle.Sticky)
+	assert.True(t, castle.Disable)
+}
+
+func TestNewCharacterBook_Roundtrip(t *testing.T) {
+	bookData := testCharacterBook().ToWorldBookData("Lore", "card-")
+
+	bookJSON, err := json.Marshal(NewCharacterBook(bookData))
+	require.NoError(t, err)
+
+	var book CharacterBook
+	require.NoError(t, json.Unmarshal(bookJSON, &book))
+	require.Len(t, book.Entries, 2)
+	assert.Equal(t, "Lore", book.Name)
+	assert.Equal(t, PositionBeforeChar, book.Entries[0].Position)
+	assert.Equal(t, PositionAfterChar, book.Entries[1].Position)
+	assert.Equal(t, "kept", book.Entries[1].Extensions["custom"])
+
+	// The settings come back from the extensions of the entries
+	roundtrip := book.ToWorldBookData("Lore", "card-")
+	for uid, entry := range roundtrip.Entries {
+		original := bookData.Entries[uid]
+		original.Extensions, entry.Extensions = nil, nil
+		assert.Equal(t, original, entry, uid)
+	}
+}
+
+func TestCharacterCardManager_ConvertCharacterBook(t *testing.T) {
+	mock := NewMockStorageWithWorldBook()
+	manager := NewCharacterCardManager(mock)
+
+	cardJSON, _ := json.Marshal(CharacterCardV2{
+		Spec:        "chara_card_v2",
+		SpecVersion: "2.0",
+		Data:        CharacterCardV2Data{Name: "Knight", CharacterBook: testCharacterBook()},
+	})
+	card := &storage.CharacterCard{Data: string(cardJSON)}
+	require.NoError(t, manager.SaveCard(card))
+
+	book, err := manager.ConvertCharacterBook(nil, card.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "Lore", book.Name)
+
+	linked, err := manager.LoadCard(nil, card.ID)
+	require.NoError(t, err)
+	require.NotNil(t, linked.WorldBookID)
+	assert.Equal(t, book.ID, *linked.WorldBookID)
+
+	entries, err := mock.ListWorldBookEntries(book.ID)
+	require.NoError(t, err)
+	assert.Len(t, entries, 2)
+
+	// A card without a character book cannot be converted
+	emptyJSON, _ := json.Marshal(CharacterCardV2{Spec: "chara_card_v2", SpecVersion: "2.0", Data: CharacterCardV2Data{Name: "Empty"}})
+	empty := &storage.CharacterCard{Data: string(emptyJSON)}
+	require.NoError(t, manager.SaveCard(empty))
+	_, err = manager.ConvertCharacterBook(nil, empty.ID)
+	assert.ErrorIs(t, err, ErrNoCharacterBook)
+}
+
+func TestCharacterCardManager_ExportCard(t *testing.T) {
+	mock := NewMockStorageWithWorldBook()
+	manager := NewCharacterCardManager(mock)
+
+	var avatar bytes.Buffer
+	require.NoError(t, png.Encode(&avatar, image.NewRGBA(image.Rect(0, 0, 1, 1))))
+
+	cardJSON, _ := json.Marshal(CharacterCardV2{
+		Spec:        "chara_card_v2",
+		SpecVersion: "2.0",
+		Data:        CharacterCardV2Data{Name: "Knight", CharacterBook: testCharacterBook()},
+	})
+	card := &storage.CharacterCard{
+		Data:   string(cardJSON),
+		Avatar: "data:image/png;base64," + base64.StdEncoding.EncodeToString(avatar.Bytes()),
+	}
+	require.NoError(t, manager.SaveCard(card))
+
+	book, err := manager.ConvertCharacterBook(nil, card.ID)
+	require.NoError(t, err)
+
+	// Edits to the linked world book are exported with the card
+	entries, err := mock.ListWorldBookEntries(book.ID)
+	require.NoError(t, err)
+	for _, entry := range entries {
+		entry.Content = "Edited: " + entry.Content
+	}
+
+	imageData, err := manager.ExportCard(nil, card.ID)
+	require.NoError(t, err)
+
+	exported, err := NewPNGParser().ParseCharacterCardFromPNG(imageData)
+	require.NoError(t, err)
+	assert.Equal(t, "Knight", exported.Name)
+
+	cardData, err := manager.ParseCardData(exported.Data)
+	require.NoError(t, err)
+	require.NotNil(t, cardData.Data.CharacterBook)
+	require.Len(t, cardData.Data.CharacterBook.Entries, 2)
+	assert.Equal(t, "Edited: Dragons breathe fire.", cardData.Data.CharacterBook.Entries[0].Content)
+}
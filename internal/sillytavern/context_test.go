@@ -3,6 +3,7 @@ package sillytavern
 import (
 	"context"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/tbxark/ChatGPT-Telegram-Workers/go_version/internal/agent"
@@ -186,9 +187,86 @@ func (m *MockContextStorage) DeleteLoginToken(userID int64) error {
 func (m *MockContextStorage) CleanupExpiredTokens() error {
 	return nil
 }
+
+func (m *MockContextStorage) GetCachedResponse(key string) (string, bool, error) {
+	return "", false, nil
+}
+
+func (m *MockContextStorage) SaveCachedResponse(key string, response string, ttl int) error {
+	return nil
+}
+
+func (m *MockContextStorage) RecordUsage(botID int64, provider, model string, cacheHit bool) error {
+	return nil
+}
+
+func (m *MockContextStorage) TakeInlineQuota(botID, userID int64, limit int) (bool, error) {
+	return true, nil
+}
+
+func (m *MockContextStorage) GetUsageStats(botID int64, since time.Time) ([]*storage.UsageStat, error) {
+	return nil, nil
+}
 func (m *MockContextStorage) DeleteAllChatHistory() error {
 	return nil
 }
+func (m *MockContextStorage) ArchiveChatHistory(ctx *storage.SessionContext) error {
+	return nil
+}
+func (m *MockContextStorage) RestoreConversation(ctx *storage.SessionContext, id uint) error {
+	return nil
+}
+func (m *MockContextStorage) GetConversation(id uint) (*storage.Conversation, error) {
+	return nil, storage.ErrNotFound
+}
+func (m *MockContextStorage) ListConversations(ctx *storage.SessionContext) ([]*storage.Conversation, error) {
+	return nil, nil
+}
+func (m *MockContextStorage) ListUserConversations(userID int64) ([]*storage.Conversation, error) {
+	return nil, nil
+}
+func (m *MockContextStorage) UpdateConversationTitle(id uint, title string) error {
+	return nil
+}
+func (m *MockContextStorage) DeleteConversation(id uint) error {
+	return nil
+}
+func (m *MockContextStorage) ForkChatHistory(ctx *storage.SessionContext, history []storage.HistoryItem) error {
+	return nil
+}
+func (m *MockContextStorage) ListBranches(ctx *storage.SessionContext) ([]*storage.Branch, error) {
+	return nil, nil
+}
+func (m *MockContextStorage) GetWorldInfoEffects(ctx *storage.SessionContext) ([]*storage.WorldInfoEffect, error) {
+	return nil, nil
+}
+func (m *MockContextStorage) SaveWorldInfoEffects(ctx *storage.SessionContext, effects []*storage.WorldInfoEffect) error {
+	return nil
+}
+func (m *MockContextStorage) NextWorldInfoTurn(ctx *storage.SessionContext) (int, error) {
+	return 0, nil
+}
+func (m *MockContextStorage) CreatePersona(persona *storage.Persona) error {
+	return nil
+}
+func (m *MockContextStorage) GetPersona(id uint) (*storage.Persona, error) {
+	return nil, storage.ErrNotFound
+}
+func (m *MockContextStorage) ListPersonas(userID int64) ([]*storage.Persona, error) {
+	return nil, nil
+}
+func (m *MockContextStorage) UpdatePersona(persona *storage.Persona) error {
+	return nil
+}
+func (m *MockContextStorage) DeletePersona(id uint) error {
+	return nil
+}
+func (m *MockContextStorage) GetActivePersona(userID int64) (*storage.Persona, error) {
+	return nil, nil
+}
+func (m *MockContextStorage) ActivatePersona(userID int64, personaID uint) error {
+	return nil
+}
 func (m *MockContextStorage) CleanupExpired() error {
 	return nil
 }
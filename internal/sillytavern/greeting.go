@@ -0,0 +1,112 @@
+package sillytavern
+
+import (
+	"regexp"
+	"strings"
+)
+
+// DefaultUserName is the name of the user in character messages when it is unknown
+const DefaultUserName = "User"
+
+// Separators of the example dialogues in the prompt, as sent by SillyTavern
+const (
+	exampleChatSeparator = "[Example Chat]"
+	newChatSeparator     = "[Start a new Chat]"
+)
+
+// exampleSpeakerPattern matches the speaker prefix of a line of an example dialogue
+var exampleSpeakerPattern = regexp.MustCompile(`(?i)^\s*(\{\{user\}\}|<user>|\{\{char\}\}|<bot>)\s*:\s*`)
+
+// CharacterGreetings returns the greetings of a character: its first message then its alternate greetings,
+// with their macros expanded
+func CharacterGreetings(characterData *CharacterCardV2, macros *MacroContext) []string {
+	if characterData == nil {
+		return nil
+	}
+
+	var greetings []string
+	for _, greeting := range append([]string{characterData.Data.FirstMes}, characterData.Data.AlternateGreetings...) {
+		if greeting = strings.TrimSpace(greeting); greeting != "" {
+			greetings = append(greetings, macros.Expand(greeting))
+		}
+	}
+	return greetings
+}
+
+// ParseExampleDialogues parses the mes_example of a character into its example dialogues.
+// Dialogues are delimited by <START> lines; their lines start a user message with {{user}}:
+// and an assistant message with {{char}}:, other lines continue the current message. Macros of the
+// messages are expanded.
+func ParseExampleDialogues(mesExample string, macros *MacroContext) [][]Message {
+	var dialogues [][]Message
+	var dialogue []Message
+	flush := func() {
+		if len(dialogue) > 0 {
+			dialogues = append(dialogues, dialogue)
+			dialogue = nil
+		}
+	}
+
+	for _, line := range strings.Split(strings.ReplaceAll(mesExample, "\r\n", "\n"), "\n") {
+		if strings.EqualFold(strings.TrimSpace(line), "<START>") {
+			flush()
+			continue
+		}
+
+		if match := exampleSpeakerPattern.FindStringSubmatch(line); match != nil {
+			role := "assistant"
+			if speaker := strings.ToLower(match[1]); speaker == "{{user}}" || speaker == "<user>" {
+				role = "user"
+			}
+			dialogue = append(dialogue, Message{Role: role, Content: line[len(match[0]):]})
+			continue
+		}
+
+		// Text before the first speaker of a dialogue is ignored
+		if len(dialogue) > 0 {
+			last := &dialogue[len(dialogue)-1]
+			last.Content += "\n" + line
+		}
+	}
+	flush()
+
+	for _, dialogue := range dialogues {
+		for i := range dialogue {
+			dialogue[i].Content = strings.TrimSpace(macros.Expand(dialogue[i].Content))
+		}
+	}
+	return dialogues
+}
+
+// LimitExampleDialogues keeps the first example dialogues that fit in the budget of tokens
+func LimitExampleDialogues(dialogues [][]Message, budget int, tokensPerChar float64) [][]Message {
+	tokens := 0
+	for i, dialogue := range dialogues {
+		for _, message := range dialogue {
+			tokens += int(float64(len(message.Content)) * tokensPerChar)
+		}
+		if tokens > budget {
+			return dialogues[:i]
+		}
+	}
+	return dialogues
+}
+
+// FormatExampleDialogues formats example dialogues as text, for prompts made of a single system message
+func FormatExampleDialogues(dialogues [][]Message, charName, userName string) string {
+	var sb strings.Builder
+	for _, dialogue := range dialogues {
+		if sb.Len() > 0 {
+			sb.WriteString("\n\n")
+		}
+		sb.WriteString(exampleChatSeparator)
+		for _, message := range dialogue {
+			name := charName
+			if message.Role == "user" {
+				name = userName
+			}
+			sb.WriteString("\n" + name + ": " + message.Content)
+		}
+	}
+	return sb.String()
+}
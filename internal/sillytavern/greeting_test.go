@@ -0,0 +1,65 @@
+package sillytavern
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCharacterGreetings(t *testing.T) {
+	characterData := &CharacterCardV2{
+		Data: CharacterCardV2Data{
+			Name:               "Aria",
+			FirstMes:           "Hello {{user}}, I am {{char}}.",
+			AlternateGreetings: []string{"", "  <USER>! It's <BOT>.  "},
+		},
+	}
+
+	assert.Equal(t, []string{"Hello Bob, I am Aria.", "Bob! It's Aria."}, CharacterGreetings(characterData, NewMacroContext(characterData, "Bob", nil)))
+	assert.Equal(t, []string{"Hello User, I am Aria.", "User! It's Aria."}, CharacterGreetings(characterData, NewMacroContext(characterData, "", nil)))
+	assert.Nil(t, CharacterGreetings(nil, NewMacroContext(nil, "Bob", nil)))
+}
+
+func TestParseExampleDialogues(t *testing.T) {
+	mesExample := "<START>\n{{user}}: Hi there\n{{char}}: Hello, {{user}}!\nHow are you?\n" +
+		"<START>\r\nintroduction text\r\n<USER>: Who are you?\r\n<BOT>: I am {{char}}.\r\n{{char}}: Nice to meet you."
+
+	macros := &MacroContext{User: "Bob", Char: "Aria"}
+	dialogues := ParseExampleDialogues(mesExample, macros)
+	require.Len(t, dialogues, 2)
+	assert.Equal(t, []Message{
+		{Role: "user", Content: "Hi there"},
+		{Role: "assistant", Content: "Hello, Bob!\nHow are you?"},
+	}, dialogues[0])
+	assert.Equal(t, []Message{
+		{Role: "user", Content: "Who are you?"},
+		{Role: "assistant", Content: "I am Aria."},
+		{Role: "assistant", Content: "Nice to meet you."},
+	}, dialogues[1])
+
+	assert.Empty(t, ParseExampleDialogues("", macros))
+}
+
+func TestLimitExampleDialogues(t *testing.T) {
+	dialogues := [][]Message{
+		{{Role: "user", Content: "aaaa"}, {Role: "assistant", Content: "bbbb"}}, // 2 tokens
+		{{Role: "user", Content: "cccccccc"}},                                   // 2 tokens
+		{{Role: "user", Content: "dddd"}},                                       // 1 token
+	}
+
+	assert.Len(t, LimitExampleDialogues(dialogues, 5, 0.25), 3)
+	assert.Len(t, LimitExampleDialogues(dialogues, 4, 0.25), 2)
+	assert.Len(t, LimitExampleDialogues(dialogues, 3, 0.25), 1)
+	assert.Empty(t, LimitExampleDialogues(dialogues, 0, 0.25))
+}
+
+func TestFormatExampleDialogues(t *testing.T) {
+	dialogues := [][]Message{
+		{{Role: "user", Content: "Hi"}, {Role: "assistant", Content: "Hello"}},
+		{{Role: "user", Content: "Bye"}},
+	}
+
+	assert.Equal(t, "[Example Chat]\nBob: Hi\nAria: Hello\n\n[Example Chat]\nBob: Bye", FormatExampleDialogues(dialogues, "Aria", "Bob"))
+	assert.Empty(t, FormatExampleDialogues(nil, "Aria", "Bob"))
+}
@@ -0,0 +1,123 @@
+package sillytavern
+
+import (
+	"math/rand"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Turn-order strategies of character groups, choosing the characters replying to a user message
+const (
+	GroupStrategyNatural = "natural" // Characters mentioned by the message, then characters drawn by their talkativeness
+	GroupStrategyList    = "list"    // Every character, in list order
+	GroupStrategyRandom  = "random"  // A single random character
+)
+
+// DefaultTalkativeness is the chance of a character to reply unprompted in natural order
+const DefaultTalkativeness = 0.5
+
+// groupNudgePrompt asks the model to reply as the speaking character only, as SillyTavern does
+const groupNudgePrompt = "[Write the next reply only as {{char}}.]"
+
+// wordPattern matches the words of messages and character names
+var wordPattern = regexp.MustCompile(`[\p{L}\p{N}]+`)
+
+// SelectGroupSpeakers returns the indexes of the group members replying to a user message, in reply order.
+// In natural order, the members mentioned by the message reply first, in mention order, then the other
+// members reply with the chance of their talkativeness; a random member replies when none does.
+func SelectGroupSpeakers(members []*CharacterCardV2, strategy, message string, random *rand.Rand) []int {
+	if len(members) == 0 {
+		return nil
+	}
+	if random == nil {
+		random = rand.New(rand.NewSource(time.Now().UnixNano()))
+	}
+
+	switch strategy {
+	case GroupStrategyList:
+		speakers := make([]int, len(members))
+		for i := range members {
+			speakers[i] = i
+		}
+		return speakers
+	case GroupStrategyRandom:
+		return []int{random.Intn(len(members))}
+	}
+
+	var speakers []int
+	for _, word := range wordPattern.FindAllString(strings.ToLower(message), -1) {
+		for i, member := range members {
+			if !slices.Contains(speakers, i) && slices.Contains(nameWords(member), word) {
+				speakers = append(speakers, i)
+			}
+		}
+	}
+	for _, i := range random.Perm(len(members)) {
+		if !slices.Contains(speakers, i) && random.Float64() < Talkativeness(members[i]) {
+			speakers = append(speakers, i)
+		}
+	}
+	if len(speakers) == 0 {
+		speakers = []int{random.Intn(len(members))}
+	}
+	return speakers
+}
+
+// nameWords returns the lowercase words of the name and nickname of a character
+func nameWords(characterData *CharacterCardV2) []string {
+	names := strings.ToLower(characterData.Data.Name + " " + characterData.Data.Nickname)
+	return wordPattern.FindAllString(names, -1)
+}
+
+// Talkativeness returns the chance of a character to reply unprompted in a group, from 0 to 1,
+// read from the talkativeness extension SillyTavern saves in cards
+func Talkativeness(characterData *CharacterCardV2) float64 {
+	talkativeness := DefaultTalkativeness
+	switch v := characterData.Data.Extensions["talkativeness"].(type) {
+	case float64:
+		talkativeness = v
+	case string:
+		if parsed, err := strconv.ParseFloat(strings.TrimSpace(v), 64); err == nil {
+			talkativeness = parsed
+		}
+	}
+	return min(max(talkativeness, 0), 1)
+}
+
+// GroupNudge returns the instruction to reply as the speaking character of a group, with its macros expanded
+func GroupNudge(macros *MacroContext) string {
+	return macros.Expand(groupNudgePrompt)
+}
+
+// GroupGreetings returns the greetings of a character in a group chat: its greetings, then its
+// group-only greetings, with their macros expanded
+func GroupGreetings(characterData *CharacterCardV2, macros *MacroContext) []string {
+	greetings := CharacterGreetings(characterData, macros)
+	if characterData == nil {
+		return greetings
+	}
+	for _, greeting := range characterData.Data.GroupOnlyGreetings {
+		if greeting = strings.TrimSpace(greeting); greeting != "" {
+			greetings = append(greetings, macros.Expand(greeting))
+		}
+	}
+	return greetings
+}
+
+// SpeakerMessage prefixes the text of a group chat message with the name of its speaker,
+// telling the model who said what
+func SpeakerMessage(name, text string) string {
+	return name + ": " + text
+}
+
+// StripSpeakerName removes the name of the speaker the model may start its reply with
+func StripSpeakerName(text, name string) string {
+	trimmed := strings.TrimLeft(text, " \t\n")
+	if len(trimmed) > len(name) && strings.EqualFold(trimmed[:len(name)], name) && trimmed[len(name)] == ':' {
+		return strings.TrimLeft(trimmed[len(name)+1:], " \t\n")
+	}
+	return text
+}
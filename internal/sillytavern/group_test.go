@@ -0,0 +1,68 @@
+package sillytavern
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// testGroupMembers returns a group of three characters; Bob never talks unprompted and Cleo always does
+func testGroupMembers() []*CharacterCardV2 {
+	return []*CharacterCardV2{
+		{Data: CharacterCardV2Data{Name: "Aria Swift", Extensions: map[string]interface{}{"talkativeness": "0"}}},
+		{Data: CharacterCardV2Data{Name: "Bob", Nickname: "Bobby", Extensions: map[string]interface{}{"talkativeness": float64(0)}}},
+		{Data: CharacterCardV2Data{Name: "Cleo", Extensions: map[string]interface{}{"talkativeness": "1"}}},
+	}
+}
+
+func TestSelectGroupSpeakers(t *testing.T) {
+	members := testGroupMembers()
+	random := rand.New(rand.NewSource(1))
+
+	// Mentioned members reply first, in mention order, then the talkative ones
+	assert.Equal(t, []int{1, 0, 2}, SelectGroupSpeakers(members, GroupStrategyNatural, "Hey bobby, and you swift?", random))
+	assert.Equal(t, []int{2}, SelectGroupSpeakers(members, GroupStrategyNatural, "Hello there", random))
+	assert.Equal(t, []int{2}, SelectGroupSpeakers(members, "", "Cleo!", random))
+
+	// A random member replies when nobody is mentioned nor talkative
+	quiet := members[:2]
+	speakers := SelectGroupSpeakers(quiet, GroupStrategyNatural, "Hello there", random)
+	assert.Len(t, speakers, 1)
+	assert.Contains(t, []int{0, 1}, speakers[0])
+
+	assert.Equal(t, []int{0, 1, 2}, SelectGroupSpeakers(members, GroupStrategyList, "Bob?", random))
+
+	speakers = SelectGroupSpeakers(members, GroupStrategyRandom, "Bob?", random)
+	assert.Len(t, speakers, 1)
+
+	assert.Nil(t, SelectGroupSpeakers(nil, GroupStrategyList, "Bob?", random))
+}
+
+func TestTalkativeness(t *testing.T) {
+	assert.Equal(t, DefaultTalkativeness, Talkativeness(&CharacterCardV2{}))
+	assert.Equal(t, 0.8, Talkativeness(&CharacterCardV2{Data: CharacterCardV2Data{Extensions: map[string]interface{}{"talkativeness": "0.8"}}}))
+	assert.Equal(t, 1.0, Talkativeness(&CharacterCardV2{Data: CharacterCardV2Data{Extensions: map[string]interface{}{"talkativeness": float64(3)}}}))
+}
+
+func TestGroupGreetings(t *testing.T) {
+	characterData := &CharacterCardV2{Data: CharacterCardV2Data{
+		Name:               "Aria",
+		FirstMes:           "Hi {{user}}",
+		GroupOnlyGreetings: []string{"Hello {{group}}", " "},
+	}}
+	macros := NewMacroContext(characterData, "Bob", nil)
+	macros.Group = "Aria, Cleo"
+
+	assert.Equal(t, []string{"Hi Bob", "Hello Aria, Cleo"}, GroupGreetings(characterData, macros))
+	assert.Equal(t, []string{"Hi Bob"}, CharacterGreetings(characterData, macros))
+	assert.Equal(t, "[Write the next reply only as Aria.]", GroupNudge(macros))
+}
+
+func TestStripSpeakerName(t *testing.T) {
+	assert.Equal(t, "Hello!", StripSpeakerName("Aria: Hello!", "Aria"))
+	assert.Equal(t, "Hello!", StripSpeakerName("\naria:\nHello!", "Aria"))
+	assert.Equal(t, "Arianna: Hello!", StripSpeakerName("Arianna: Hello!", "Aria"))
+	assert.Equal(t, "Hello Aria: hi", StripSpeakerName("Hello Aria: hi", "Aria"))
+	assert.Equal(t, "Aria: Hello", SpeakerMessage("Aria", "Hello"))
+}
@@ -0,0 +1,281 @@
+package sillytavern
+
+import (
+	"fmt"
+	"math/rand"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tbxark/ChatGPT-Telegram-Workers/go_version/internal/storage"
+)
+
+// MacroContext holds the values of the SillyTavern macros expanded in prompts, such as {{char}} and {{user}}
+type MacroContext struct {
+	User        string                // {{user}}, the display name of the user
+	Char        string                // {{char}}, the name of the character
+	Persona     string                // {{persona}}, the description of the user's persona
+	Description string                // {{description}} of the character
+	Personality string                // {{personality}} of the character
+	Scenario    string                // {{scenario}} of the character
+	Group       string                // {{group}}, the names of the characters of a group chat, comma-separated
+	History     []storage.HistoryItem // Chat for {{lastMessage}}, {{lastUserMessage}}, {{lastCharMessage}} and {{idle_duration}}
+	Now         time.Time             // Time of {{time}}, {{date}} and {{weekday}}, the current time if zero
+	Random      *rand.Rand            // Source of {{random}}, {{pick}} and {{roll}}, time-seeded if nil
+}
+
+// NewMacroContext creates the macro context of a chat with a character; characterData may be nil
+func NewMacroContext(characterData *CharacterCardV2, userName string, history []storage.HistoryItem) *MacroContext {
+	if userName == "" {
+		userName = DefaultUserName
+	}
+	macros := &MacroContext{
+		User:    userName,
+		History: history,
+	}
+	if characterData != nil {
+		macros.Char = characterData.Data.Name
+		if characterData.Data.Nickname != "" {
+			// V3 cards may give a nickname for {{char}}
+			macros.Char = characterData.Data.Nickname
+		}
+		macros.Description = characterData.Data.Description
+		macros.Personality = characterData.Data.Personality
+		macros.Scenario = characterData.Data.Scenario
+	}
+	return macros
+}
+
+// macroPattern matches a {{macro}}, with its arguments, or a legacy <USER>, <BOT> or <CHAR> placeholder
+var macroPattern = regexp.MustCompile(`\{\{([^{}]*)\}\}|(?i:<(?:user|bot|char)>)`)
+
+// rollPattern matches the dice of {{roll}}: 1d20, d6, 2d6+3 or 20
+var rollPattern = regexp.MustCompile(`^(\d*)d(\d+)([+-]\d+)?$|^(\d+)$`)
+
+// Expand replaces the macros of the text; unknown macros are kept as they are
+func (c *MacroContext) Expand(text string) string {
+	return c.expand(text, nil)
+}
+
+// expand replaces the macros of the text, escaping their values when escape is not nil
+func (c *MacroContext) expand(text string, escape func(string) string) string {
+	if c == nil || !strings.ContainsAny(text, "{<") {
+		return text
+	}
+
+	now := c.Now
+	if now.IsZero() {
+		now = time.Now()
+	}
+	random := c.Random
+	if random == nil {
+		random = rand.New(rand.NewSource(time.Now().UnixNano()))
+	}
+
+	return macroPattern.ReplaceAllStringFunc(text, func(match string) string {
+		var value string
+		var ok bool
+		if strings.HasPrefix(match, "{{") {
+			value, ok = c.macro(strings.TrimSpace(match[2:len(match)-2]), now, random)
+		} else if strings.EqualFold(match, "<user>") {
+			value, ok = c.User, true
+		} else {
+			value, ok = c.Char, true
+		}
+
+		if !ok {
+			return match
+		}
+		if escape != nil {
+			return escape(value)
+		}
+		return value
+	})
+}
+
+// macro returns the value of a macro, given without its braces
+func (c *MacroContext) macro(macro string, now time.Time, random *rand.Rand) (string, bool) {
+	name, args, hasArgs := strings.Cut(macro, ":")
+	name = strings.ToLower(strings.TrimSpace(name))
+
+	if strings.HasPrefix(name, "//") {
+		// {{// comment}} is removed
+		return "", true
+	}
+
+	switch name {
+	case "user":
+		return c.User, true
+	case "char":
+		return c.Char, true
+	case "group", "charifnotgroup":
+		// Outside of group chats, the character alone
+		if c.Group != "" {
+			return c.Group, true
+		}
+		return c.Char, true
+	case "persona":
+		return c.Persona, true
+	case "description":
+		return c.Description, true
+	case "personality":
+		return c.Personality, true
+	case "scenario":
+		return c.Scenario, true
+	case "newline":
+		return "\n", true
+	case "noop":
+		return "", true
+	case "time":
+		return now.Format("3:04 PM"), true
+	case "date":
+		return now.Format("January 2, 2006"), true
+	case "weekday":
+		return now.Format("Monday"), true
+	case "isotime":
+		return now.Format("15:04"), true
+	case "isodate":
+		return now.Format("2006-01-02"), true
+	case "idle_duration":
+		return c.idleDuration(now), true
+	case "lastmessage":
+		return lastMessageText(c.History, ""), true
+	case "lastusermessage":
+		return lastMessageText(c.History, "user"), true
+	case "lastcharmessage":
+		return lastMessageText(c.History, "assistant"), true
+	case "random", "pick":
+		if !hasArgs {
+			return "", false
+		}
+		options := macroOptions(args)
+		if len(options) == 0 {
+			return "", true
+		}
+		return options[random.Intn(len(options))], true
+	case "roll":
+		if !hasArgs {
+			return "", false
+		}
+		return roll(strings.TrimSpace(args), random)
+	}
+
+	// {{time_UTC+2}} is the time at an UTC offset
+	if offset, found := strings.CutPrefix(name, "time_utc"); found {
+		hours, err := strconv.Atoi(offset)
+		if err != nil {
+			return "", false
+		}
+		return now.UTC().Add(time.Duration(hours) * time.Hour).Format("3:04 PM"), true
+	}
+
+	return "", false
+}
+
+// macroOptions splits the options of {{random}}: random::a::b, or the legacy random:a,b
+func macroOptions(args string) []string {
+	var options []string
+	if strings.HasPrefix(args, ":") {
+		options = strings.Split(args[1:], "::")
+	} else {
+		options = strings.Split(args, ",")
+	}
+
+	trimmed := options[:0]
+	for _, option := range options {
+		trimmed = append(trimmed, strings.TrimSpace(option))
+	}
+	return trimmed
+}
+
+// roll rolls the dice of {{roll}}
+func roll(dice string, random *rand.Rand) (string, bool) {
+	match := rollPattern.FindStringSubmatch(strings.ToLower(strings.TrimPrefix(dice, ":")))
+	if match == nil {
+		return "", false
+	}
+
+	count, sides, modifier := 1, 0, 0
+	if match[4] != "" {
+		sides, _ = strconv.Atoi(match[4])
+	} else {
+		if match[1] != "" {
+			count, _ = strconv.Atoi(match[1])
+		}
+		sides, _ = strconv.Atoi(match[2])
+		if match[3] != "" {
+			modifier, _ = strconv.Atoi(match[3])
+		}
+	}
+	if sides < 1 || count < 1 || count > 100 {
+		return "", false
+	}
+
+	total := modifier
+	for i := 0; i < count; i++ {
+		total += random.Intn(sides) + 1
+	}
+	return strconv.Itoa(total), true
+}
+
+// idleDuration describes the time since the last user message, like "5 minutes"
+func (c *MacroContext) idleDuration(now time.Time) string {
+	for i := len(c.History) - 1; i >= 0; i-- {
+		item := c.History[i]
+		if item.Role == "user" && item.Timestamp > 0 {
+			return humanizeDuration(now.Sub(time.Unix(item.Timestamp, 0)))
+		}
+	}
+	return "just now"
+}
+
+// humanizeDuration describes a duration with its largest unit
+func humanizeDuration(d time.Duration) string {
+	units := []struct {
+		name     string
+		duration time.Duration
+	}{
+		{"year", 365 * 24 * time.Hour},
+		{"month", 30 * 24 * time.Hour},
+		{"day", 24 * time.Hour},
+		{"hour", time.Hour},
+		{"minute", time.Minute},
+	}
+	for _, unit := range units {
+		if n := int(d / unit.duration); n >= 1 {
+			if n == 1 {
+				return "a " + unit.name
+			}
+			return fmt.Sprintf("%d %ss", n, unit.name)
+		}
+	}
+	return "a few seconds"
+}
+
+// lastMessageText returns the text of the last chat message of the role, or of any role when empty
+func lastMessageText(history []storage.HistoryItem, role string) string {
+	for i := len(history) - 1; i >= 0; i-- {
+		item := history[i]
+		if item.Role != "user" && item.Role != "assistant" {
+			continue
+		}
+		if role != "" && item.Role != role {
+			continue
+		}
+		switch content := item.Content.(type) {
+		case string:
+			return content
+		case []storage.ContentPart:
+			var parts []string
+			for _, part := range content {
+				if part.Type == "text" {
+					parts = append(parts, part.Text)
+				}
+			}
+			return strings.Join(parts, "\n")
+		}
+		return ""
+	}
+	return ""
+}
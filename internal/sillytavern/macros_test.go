@@ -0,0 +1,116 @@
+package sillytavern
+
+import (
+	"math/rand"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tbxark/ChatGPT-Telegram-Workers/go_version/internal/storage"
+)
+
+func TestNewMacroContext(t *testing.T) {
+	characterData := &CharacterCardV2{
+		Data: CharacterCardV2Data{
+			Name:        "Aria",
+			Description: "A dragon",
+			Personality: "Curious",
+			Scenario:    "A cave",
+		},
+	}
+
+	macros := NewMacroContext(characterData, "", nil)
+	assert.Equal(t, DefaultUserName, macros.User)
+	assert.Equal(t, "Aria", macros.Char)
+	assert.Equal(t, "Aria is A dragon, Curious, in A cave", macros.Expand("{{char}} is {{description}}, {{personality}}, in {{scenario}}"))
+}
+
+func TestMacroContext_Names(t *testing.T) {
+	macros := &MacroContext{User: "Bob", Char: "Aria", Persona: "A knight"}
+
+	assert.Equal(t, "Bob meets Aria", macros.Expand("{{user}} meets {{char}}"))
+	assert.Equal(t, "Bob meets Aria", macros.Expand("{{ USER }} meets {{Char}}"))
+	assert.Equal(t, "Bob meets Aria and Aria", macros.Expand("<USER> meets <BOT> and <char>"))
+	assert.Equal(t, "Bob is A knight", macros.Expand("{{user}} is {{persona}}"))
+	assert.Equal(t, "a\nb", macros.Expand("a{{newline}}b{{noop}}"))
+	assert.Equal(t, "Hello ", macros.Expand("Hello {{// to be removed}}"))
+	assert.Equal(t, "Aria", macros.Expand("{{group}}"))
+
+	macros.Group = "Aria, Cleo"
+	assert.Equal(t, "Aria, Cleo and Aria, Cleo", macros.Expand("{{group}} and {{charIfNotGroup}}"))
+}
+
+func TestMacroContext_UnknownKept(t *testing.T) {
+	macros := &MacroContext{User: "Bob"}
+
+	assert.Equal(t, "{{unknown}} {{random}} {{roll:abc}} Bob", macros.Expand("{{unknown}} {{random}} {{roll:abc}} {{user}}"))
+	assert.Equal(t, "no macros", macros.Expand("no macros"))
+
+	var nilMacros *MacroContext
+	assert.Equal(t, "{{user}}", nilMacros.Expand("{{user}}"))
+}
+
+func TestMacroContext_Time(t *testing.T) {
+	macros := &MacroContext{Now: time.Date(2024, time.March, 5, 14, 7, 0, 0, time.UTC)}
+
+	assert.Equal(t, "2:07 PM", macros.Expand("{{time}}"))
+	assert.Equal(t, "March 5, 2024", macros.Expand("{{date}}"))
+	assert.Equal(t, "Tuesday", macros.Expand("{{weekday}}"))
+	assert.Equal(t, "14:07", macros.Expand("{{isotime}}"))
+	assert.Equal(t, "2024-03-05", macros.Expand("{{isodate}}"))
+	assert.Equal(t, "4:07 PM", macros.Expand("{{time_UTC+2}}"))
+	assert.Equal(t, "9:07 AM", macros.Expand("{{time_UTC-5}}"))
+}
+
+func TestMacroContext_Random(t *testing.T) {
+	macros := &MacroContext{Random: rand.New(rand.NewSource(1))}
+
+	for i := 0; i < 20; i++ {
+		assert.Contains(t, []string{"red", "green", "blue"}, macros.Expand("{{random::red::green::blue}}"))
+		assert.Contains(t, []string{"red", "green"}, macros.Expand("{{random:red, green}}"))
+		assert.Contains(t, []string{"a", "b"}, macros.Expand("{{pick::a::b}}"))
+
+		value, err := strconv.Atoi(macros.Expand("{{roll:1d20}}"))
+		require.NoError(t, err)
+		assert.True(t, value >= 1 && value <= 20)
+
+		value, err = strconv.Atoi(macros.Expand("{{roll:2d6+3}}"))
+		require.NoError(t, err)
+		assert.True(t, value >= 5 && value <= 15)
+
+		value, err = strconv.Atoi(macros.Expand("{{roll:6}}"))
+		require.NoError(t, err)
+		assert.True(t, value >= 1 && value <= 6)
+	}
+}
+
+func TestMacroContext_History(t *testing.T) {
+	now := time.Date(2024, time.March, 5, 14, 0, 0, 0, time.UTC)
+	macros := &MacroContext{
+		Now: now,
+		History: []storage.HistoryItem{
+			{Role: "user", Content: "Hi", Timestamp: now.Add(-5 * time.Minute).Unix()},
+			{Role: "assistant", Content: "Hello"},
+			{Role: "user", Content: []storage.ContentPart{{Type: "text", Text: "Look"}, {Type: "image_url"}}},
+			{Role: "system", Content: "ignored"},
+		},
+	}
+
+	assert.Equal(t, "Look", macros.Expand("{{lastMessage}}"))
+	assert.Equal(t, "Look", macros.Expand("{{lastUserMessage}}"))
+	assert.Equal(t, "Hello", macros.Expand("{{lastCharMessage}}"))
+	assert.Equal(t, "5 minutes", macros.Expand("{{idle_duration}}"))
+
+	empty := &MacroContext{}
+	assert.Equal(t, "just now", empty.Expand("{{idle_duration}}"))
+	assert.Equal(t, "", empty.Expand("{{lastMessage}}"))
+}
+
+func TestHumanizeDuration(t *testing.T) {
+	assert.Equal(t, "a few seconds", humanizeDuration(30*time.Second))
+	assert.Equal(t, "a minute", humanizeDuration(time.Minute))
+	assert.Equal(t, "3 hours", humanizeDuration(3*time.Hour+20*time.Minute))
+	assert.Equal(t, "2 days", humanizeDuration(50*time.Hour))
+}
@@ -3,9 +3,11 @@ package sillytavern
 import (
 	"bytes"
 	"encoding/base64"
+	"encoding/binary"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"hash/crc32"
 	"image/png"
 	"io"
 	"strings"
@@ -13,6 +15,9 @@ import (
 	"github.com/tbxark/ChatGPT-Telegram-Workers/go_version/internal/storage"
 )
 
+// pngSignature starts every PNG image
+var pngSignature = []byte{137, 80, 78, 71, 13, 10, 26, 10}
+
 // PNGParser handles parsing of SillyTavern character cards from PNG images
 type PNGParser struct{}
 
@@ -22,7 +27,8 @@ func NewPNGParser() *PNGParser {
 }
 
 // ParseCharacterCardFromPNG extracts character card data from a PNG image
-// SillyTavern stores character card data in PNG tEXt chunks with key "chara"
+// SillyTavern stores character card data in PNG tEXt chunks with key "chara", and V3 cards
+// in a "ccv3" chunk as well. V1 cards are upgraded to V2.
 func (p *PNGParser) ParseCharacterCardFromPNG(imageData []byte) (*storage.CharacterCard, error) {
 	reader := bytes.NewReader(imageData)
 
@@ -36,20 +42,15 @@ func (p *PNGParser) ParseCharacterCardFromPNG(imageData []byte) (*storage.Charac
 	reader.Seek(0, io.SeekStart)
 
 	// Extract character data from PNG chunks
-	cardJSON, err := p.extractCharaChunk(reader)
+	chunkJSON, err := p.extractCharaChunk(reader)
 	if err != nil {
 		return nil, fmt.Errorf("failed to extract character data: %w", err)
 	}
 
 	// Validate the character card format
-	var cardData CharacterCardV2
-	if err := json.Unmarshal([]byte(cardJSON), &cardData); err != nil {
-		return nil, fmt.Errorf("invalid character card JSON: %w", err)
-	}
-
-	// Validate it's a V2 card
-	if cardData.Spec != "chara_card_v2" {
-		return nil, errors.New("only SillyTavern V2 format is supported")
+	cardJSON, cardData, err := NormalizeCardJSON(chunkJSON)
+	if err != nil {
+		return nil, err
 	}
 
 	// Create the character card model
@@ -57,12 +58,13 @@ func (p *PNGParser) ParseCharacterCardFromPNG(imageData []byte) (*storage.Charac
 		Name:   cardData.Data.Name,
 		Avatar: base64.StdEncoding.EncodeToString(imageData),
 		Data:   cardJSON,
+		Format: CardFormatPNG,
 	}
 
 	return card, nil
 }
 
-// extractCharaChunk extracts the "chara" tEXt chunk from a PNG image
+// extractCharaChunk extracts the card data of a PNG image: its "ccv3" tEXt chunk, or else its "chara" chunk
 func (p *PNGParser) extractCharaChunk(reader io.Reader) (string, error) {
 	// Read PNG signature
 	signature := make([]byte, 8)
@@ -71,18 +73,19 @@ func (p *PNGParser) extractCharaChunk(reader io.Reader) (string, error) {
 	}
 
 	// Verify PNG signature
-	expectedSig := []byte{137, 80, 78, 71, 13, 10, 26, 10}
-	if !bytes.Equal(signature, expectedSig) {
+	if !bytes.Equal(signature, pngSignature) {
 		return "", errors.New("invalid PNG signature")
 	}
 
-	// Read chunks until we find "tEXt" with key "chara"
+	// Read chunks until the end of the image, the V3 chunk is preferred
+	var chara string
+	found := false
 	for {
 		// Read chunk length (4 bytes)
 		lengthBytes := make([]byte, 4)
 		if _, err := io.ReadFull(reader, lengthBytes); err != nil {
 			if err == io.EOF {
-				return "", errors.New("character data not found in PNG")
+				break
 			}
 			return "", fmt.Errorf("failed to read chunk length: %w", err)
 		}
@@ -119,23 +122,35 @@ func (p *PNGParser) extractCharaChunk(reader io.Reader) (string, error) {
 			keyword := string(chunkData[:nullIndex])
 			text := chunkData[nullIndex+1:]
 
-			// Check if this is the "chara" chunk
+			// Check if this is the "ccv3" or "chara" chunk
+			if keyword == "ccv3" {
+				return decodeCharaText(text), nil
+			}
 			if keyword == "chara" {
-				// The text might be base64 encoded
-				decoded, err := base64.StdEncoding.DecodeString(string(text))
-				if err != nil {
-					// If it's not base64, use it as-is
-					return string(text), nil
-				}
-				return string(decoded), nil
+				chara, found = decodeCharaText(text), true
 			}
 		}
 
 		// Check for IEND chunk (end of PNG)
 		if string(chunkType) == "IEND" {
-			return "", errors.New("character data not found in PNG")
+			break
 		}
 	}
+
+	if !found {
+		return "", errors.New("character data not found in PNG")
+	}
+	return chara, nil
+}
+
+// decodeCharaText decodes the text of a card chunk, which might be base64 encoded
+func decodeCharaText(text []byte) string {
+	decoded, err := base64.StdEncoding.DecodeString(string(text))
+	if err != nil {
+		// If it's not base64, use it as-is
+		return string(text)
+	}
+	return string(decoded)
 }
 
 // ValidateCharacterCardV2 validates a character card in V2 format
@@ -184,27 +199,21 @@ func (m *CharacterCardManager) UploadCard(userID *int64, imageData []byte) (*sto
 	return card, nil
 }
 
-// UploadCardFromJSON uploads a character card from raw JSON data
+// UploadCardFromJSON uploads a character card from raw JSON data, upgrading V1 cards to V2
 func (m *CharacterCardManager) UploadCardFromJSON(userID *int64, cardJSON string, avatarBase64 string) (*storage.CharacterCard, error) {
-	parser := NewPNGParser()
-
 	// Validate the JSON
-	if err := parser.ValidateCharacterCardV2(cardJSON); err != nil {
+	cardJSON, cardData, err := NormalizeCardJSON(cardJSON)
+	if err != nil {
 		return nil, fmt.Errorf("invalid character card: %w", err)
 	}
 
-	// Parse to get the name
-	var cardData CharacterCardV2
-	if err := json.Unmarshal([]byte(cardJSON), &cardData); err != nil {
-		return nil, fmt.Errorf("failed to parse JSON: %w", err)
-	}
-
 	// Create the card
 	card := &storage.CharacterCard{
 		UserID: userID,
 		Name:   cardData.Data.Name,
 		Avatar: avatarBase64,
 		Data:   cardJSON,
+		Format: CardFormatJSON,
 	}
 
 	// Save the card
@@ -215,27 +224,85 @@ func (m *CharacterCardManager) UploadCardFromJSON(userID *int64, cardJSON string
 	return card, nil
 }
 
-// ExportCardToPNG exports a character card to PNG format (creates a simple PNG with tEXt chunk)
+// ExportCardToPNG exports a character card to PNG format, writing the card data to the "chara" tEXt chunk of its avatar.
+// V3 cards are written to a "ccv3" chunk, with a V2 copy in the "chara" chunk for older readers.
 func (p *PNGParser) ExportCardToPNG(card *storage.CharacterCard) ([]byte, error) {
-	// If the card already has an avatar, decode and use it
-	if card.Avatar != "" && strings.HasPrefix(card.Avatar, "data:image/png;base64,") {
-		// Extract base64 data
-		base64Data := strings.TrimPrefix(card.Avatar, "data:image/png;base64,")
-		imageData, err := base64.StdEncoding.DecodeString(base64Data)
-		if err == nil {
-			return imageData, nil
+	// If no valid avatar, return error (we need the original PNG to preserve it)
+	imageData := avatarPNG(card.Avatar)
+	if imageData == nil {
+		return nil, errors.New("cannot export card without original PNG avatar data")
+	}
+
+	chunks := map[string]string{"chara": card.Data}
+	var cardData CharacterCardV2
+	if err := json.Unmarshal([]byte(card.Data), &cardData); err == nil && cardData.Spec == SpecV3 {
+		v2JSON, err := downgradeCardV3(card.Data)
+		if err != nil {
+			return nil, err
 		}
-	} else if card.Avatar != "" {
-		// Try direct base64 decode
-		imageData, err := base64.StdEncoding.DecodeString(card.Avatar)
-		if err == nil {
-			// Verify it's a valid PNG
-			if bytes.HasPrefix(imageData, []byte{137, 80, 78, 71, 13, 10, 26, 10}) {
-				return imageData, nil
+		chunks = map[string]string{"chara": v2JSON, "ccv3": card.Data}
+	}
+
+	return p.writeCharaChunk(imageData, chunks)
+}
+
+// avatarPNG decodes a base64 avatar, optionally a data URI, returning nil unless it is a PNG image
+func avatarPNG(avatar string) []byte {
+	decoded, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(avatar, "data:image/png;base64,"))
+	if avatar == "" || err != nil || !bytes.HasPrefix(decoded, pngSignature) {
+		return nil
+	}
+	return decoded
+}
+
+// writeCharaChunk replaces the "chara" and "ccv3" tEXt chunks of a PNG image with the base64 encoded card JSON
+// of the chunks, by keyword
+func (p *PNGParser) writeCharaChunk(imageData []byte, chunks map[string]string) ([]byte, error) {
+	var out bytes.Buffer
+	out.Write(pngSignature)
+
+	rest := imageData[len(pngSignature):]
+	for len(rest) >= 12 {
+		length := binary.BigEndian.Uint32(rest[:4])
+		if uint64(len(rest)) < 12+uint64(length) {
+			break
+		}
+		chunk := rest[:12+length]
+		chunkType := string(chunk[4:8])
+		chunkData := chunk[8 : 8+length]
+		rest = rest[12+length:]
+
+		if chunkType == "tEXt" && (bytes.HasPrefix(chunkData, []byte("chara\x00")) || bytes.HasPrefix(chunkData, []byte("ccv3\x00"))) {
+			continue
+		}
+		if chunkType == "IEND" {
+			for _, keyword := range []string{"chara", "ccv3"} {
+				if cardJSON, ok := chunks[keyword]; ok {
+					text := append([]byte(keyword+"\x00"), base64.StdEncoding.EncodeToString([]byte(cardJSON))...)
+					writePNGChunk(&out, "tEXt", text)
+				}
 			}
+			out.Write(chunk)
+			return out.Bytes(), nil
 		}
+		out.Write(chunk)
 	}
 
-	// If no valid avatar, return error (we need the original PNG to preserve it)
-	return nil, errors.New("cannot export card without original PNG avatar data")
+	return nil, errors.New("invalid PNG: IEND chunk not found")
+}
+
+// writePNGChunk writes a PNG chunk with its length and CRC
+func writePNGChunk(out *bytes.Buffer, chunkType string, data []byte) {
+	var header [4]byte
+	binary.BigEndian.PutUint32(header[:], uint32(len(data)))
+	out.Write(header[:])
+
+	crc := crc32.NewIEEE()
+	crc.Write([]byte(chunkType))
+	crc.Write(data)
+
+	out.WriteString(chunkType)
+	out.Write(data)
+	binary.BigEndian.PutUint32(header[:], crc.Sum32())
+	out.Write(header[:])
 }
@@ -0,0 +1,33 @@
+package sillytavern
+
+import (
+	"github.com/tbxark/ChatGPT-Telegram-Workers/go_version/internal/storage"
+)
+
+// Positions of the persona description in the prompt, as in SillyTavern
+const (
+	PersonaPositionPrompt   = "in_prompt" // In the system prompt, after the character
+	PersonaPositionANTop    = "an_top"    // Above the author's note
+	PersonaPositionANBottom = "an_bottom" // Below the author's note
+	PersonaPositionAtDepth  = "at_depth"  // System message at a depth among the chat messages
+	PersonaPositionNone     = "none"      // Only used by the {{persona}} macro
+)
+
+// SetPersona makes the persona the user of the macros: its name is {{user}} and its description {{persona}}
+func (c *MacroContext) SetPersona(persona *storage.Persona) {
+	if c == nil || persona == nil {
+		return
+	}
+	if persona.Name != "" {
+		c.User = persona.Name
+	}
+	c.Persona = persona.Description
+}
+
+// PersonaDescription returns the description of a persona with its macros expanded, or an empty string
+func PersonaDescription(persona *storage.Persona, macros *MacroContext) string {
+	if persona == nil {
+		return ""
+	}
+	return macros.Expand(persona.Description)
+}
@@ -33,6 +33,10 @@ type PresetData struct {
 	StopSequences      []string `json:"stop_sequences,omitempty"`
 	// Additional provider-specific parameters can be stored in extensions
 	Extensions         map[string]interface{} `json:"extensions,omitempty"`
+
+	// Prompts and prompt order of SillyTavern's prompt manager, assembling the messages of requests
+	Prompts     []PresetPrompt `json:"prompts,omitempty"`
+	PromptOrder []PromptOrder  `json:"prompt_order,omitempty"`
 }
 
 // LoadPreset loads a preset by ID
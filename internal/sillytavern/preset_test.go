@@ -3,6 +3,7 @@ package sillytavern
 import (
 	"encoding/json"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/tbxark/ChatGPT-Telegram-Workers/go_version/internal/storage"
@@ -188,9 +189,67 @@ func (m *mockPresetStorage) ValidateLoginToken(userID int64, token string) (bool
 }
 func (m *mockPresetStorage) DeleteLoginToken(userID int64) error { return nil }
 func (m *mockPresetStorage) CleanupExpiredTokens() error         { return nil }
-func (m *mockPresetStorage) DeleteAllChatHistory() error         { return nil }
-func (m *mockPresetStorage) CleanupExpired() error               { return nil }
-func (m *mockPresetStorage) Close() error                        { return nil }
+func (m *mockPresetStorage) GetCachedResponse(key string) (string, bool, error) { return "", false, nil }
+func (m *mockPresetStorage) SaveCachedResponse(key string, response string, ttl int) error { return nil }
+func (m *mockPresetStorage) RecordUsage(botID int64, provider, model string, cacheHit bool) error { return nil }
+func (m *mockPresetStorage) TakeInlineQuota(botID, userID int64, limit int) (bool, error) { return true, nil }
+func (m *mockPresetStorage) GetUsageStats(botID int64, since time.Time) ([]*storage.UsageStat, error) {
+	return nil, nil
+}
+func (m *mockPresetStorage) DeleteAllChatHistory() error                          { return nil }
+func (m *mockPresetStorage) ArchiveChatHistory(ctx *storage.SessionContext) error { return nil }
+func (m *mockPresetStorage) RestoreConversation(ctx *storage.SessionContext, id uint) error {
+	return nil
+}
+func (m *mockPresetStorage) GetConversation(id uint) (*storage.Conversation, error) {
+	return nil, storage.ErrNotFound
+}
+func (m *mockPresetStorage) ListConversations(ctx *storage.SessionContext) ([]*storage.Conversation, error) {
+	return nil, nil
+}
+func (m *mockPresetStorage) ListUserConversations(userID int64) ([]*storage.Conversation, error) {
+	return nil, nil
+}
+func (m *mockPresetStorage) UpdateConversationTitle(id uint, title string) error { return nil }
+func (m *mockPresetStorage) DeleteConversation(id uint) error                    { return nil }
+func (m *mockPresetStorage) ForkChatHistory(ctx *storage.SessionContext, history []storage.HistoryItem) error {
+	return nil
+}
+func (m *mockPresetStorage) ListBranches(ctx *storage.SessionContext) ([]*storage.Branch, error) {
+	return nil, nil
+}
+func (m *mockPresetStorage) GetWorldInfoEffects(ctx *storage.SessionContext) ([]*storage.WorldInfoEffect, error) {
+	return nil, nil
+}
+func (m *mockPresetStorage) SaveWorldInfoEffects(ctx *storage.SessionContext, effects []*storage.WorldInfoEffect) error {
+	return nil
+}
+func (m *mockPresetStorage) NextWorldInfoTurn(ctx *storage.SessionContext) (int, error) {
+	return 0, nil
+}
+func (m *mockPresetStorage) CreatePersona(persona *storage.Persona) error {
+	return nil
+}
+func (m *mockPresetStorage) GetPersona(id uint) (*storage.Persona, error) {
+	return nil, storage.ErrNotFound
+}
+func (m *mockPresetStorage) ListPersonas(userID int64) ([]*storage.Persona, error) {
+	return nil, nil
+}
+func (m *mockPresetStorage) UpdatePersona(persona *storage.Persona) error {
+	return nil
+}
+func (m *mockPresetStorage) DeletePersona(id uint) error {
+	return nil
+}
+func (m *mockPresetStorage) GetActivePersona(userID int64) (*storage.Persona, error) {
+	return nil, nil
+}
+func (m *mockPresetStorage) ActivatePersona(userID int64, personaID uint) error {
+	return nil
+}
+func (m *mockPresetStorage) CleanupExpired() error                               { return nil }
+func (m *mockPresetStorage) Close() error                                        { return nil }
 
 func TestPresetManager_SaveAndLoad(t *testing.T) {
 	mockStorage := newMockPresetStorage()
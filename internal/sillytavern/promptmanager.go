@@ -0,0 +1,178 @@
+package sillytavern
+
+import (
+	"log"
+	"strings"
+
+	"github.com/tbxark/ChatGPT-Telegram-Workers/go_version/internal/storage"
+)
+
+// Identifiers of the built-in prompts of SillyTavern's prompt manager
+const (
+	PromptMain               = "main"
+	PromptNSFW               = "nsfw"
+	PromptJailbreak          = "jailbreak" // Post-history instructions
+	PromptEnhanceDefinitions = "enhanceDefinitions"
+	PromptCharDescription    = "charDescription"
+	PromptCharPersonality    = "charPersonality"
+	PromptScenario           = "scenario"
+	PromptPersonaDescription = "personaDescription"
+	PromptWorldInfoBefore    = "worldInfoBefore"
+	PromptWorldInfoAfter     = "worldInfoAfter"
+	PromptDialogueExamples   = "dialogueExamples"
+	PromptChatHistory        = "chatHistory"
+)
+
+// Injection positions of preset prompts
+const (
+	PromptInjectionRelative = 0 // In prompt order
+	PromptInjectionAbsolute = 1 // Between the chat messages, at the injection depth
+)
+
+// promptOrderGlobalID is the character ID of the prompt order SillyTavern applies to every character
+const promptOrderGlobalID = 100001
+
+// PresetPrompt is a prompt of a SillyTavern chat completion preset: a built-in prompt, a marker filled
+// with the character, world info or chat, or a custom prompt
+type PresetPrompt struct {
+	Identifier        string `json:"identifier"`
+	Name              string `json:"name,omitempty"`
+	Role              string `json:"role,omitempty"`
+	Content           string `json:"content,omitempty"`
+	SystemPrompt      bool   `json:"system_prompt,omitempty"`
+	Marker            bool   `json:"marker,omitempty"`
+	Enabled           *bool  `json:"enabled,omitempty"`
+	InjectionPosition int    `json:"injection_position,omitempty"`
+	InjectionDepth    int    `json:"injection_depth,omitempty"`
+	ForbidOverrides   bool   `json:"forbid_overrides,omitempty"`
+}
+
+// PromptOrder is the order and the toggles of the prompts of a preset for a character
+type PromptOrder struct {
+	CharacterID int64              `json:"character_id"`
+	Order       []PromptOrderEntry `json:"order"`
+}
+
+// PromptOrderEntry enables or disables a prompt at its place in the order
+type PromptOrderEntry struct {
+	Identifier string `json:"identifier"`
+	Enabled    bool   `json:"enabled"`
+}
+
+// OrderedPrompts returns the enabled prompts of the preset in the order of its prompt manager: the global prompt order,
+// or else the first one, or else the order of the prompts themselves. It returns nil when the preset has no prompts.
+func (p *PresetData) OrderedPrompts() []PresetPrompt {
+	if len(p.Prompts) == 0 {
+		return nil
+	}
+
+	var order *PromptOrder
+	for i := range p.PromptOrder {
+		if order == nil || p.PromptOrder[i].CharacterID == promptOrderGlobalID {
+			order = &p.PromptOrder[i]
+		}
+	}
+
+	var prompts []PresetPrompt
+	if order == nil {
+		for _, prompt := range p.Prompts {
+			if prompt.Enabled == nil || *prompt.Enabled {
+				prompts = append(prompts, prompt)
+			}
+		}
+		return prompts
+	}
+
+	byIdentifier := make(map[string]PresetPrompt, len(p.Prompts))
+	for _, prompt := range p.Prompts {
+		byIdentifier[prompt.Identifier] = prompt
+	}
+	for _, entry := range order.Order {
+		prompt, ok := byIdentifier[entry.Identifier]
+		if !ok {
+			log.Printf("[PromptManager] Prompt %s of the prompt order not found in the preset", entry.Identifier)
+			continue
+		}
+		if entry.Enabled {
+			prompts = append(prompts, prompt)
+		}
+	}
+	return prompts
+}
+
+// promptRole returns the role of the messages of a prompt, system unless it is user or assistant
+func promptRole(role string) string {
+	if role == "user" || role == "assistant" {
+		return role
+	}
+	return "system"
+}
+
+// presetDepthEntries returns the prompts injected at a depth of the chat as at_depth entries, with their macros expanded
+func presetDepthEntries(prompts []PresetPrompt, macros *MacroContext) []*storage.WorldBookEntry {
+	var entries []*storage.WorldBookEntry
+	for _, prompt := range prompts {
+		if prompt.InjectionPosition != PromptInjectionAbsolute || prompt.Marker {
+			continue
+		}
+		if content := strings.TrimSpace(macros.Expand(prompt.Content)); content != "" {
+			entries = append(entries, &storage.WorldBookEntry{
+				UID:      prompt.Identifier,
+				Content:  content,
+				Position: PositionAtDepth,
+				Depth:    prompt.InjectionDepth,
+				Role:     promptRole(prompt.Role),
+			})
+		}
+	}
+	return entries
+}
+
+// presetPromptContent returns the content of a prompt placed in prompt order. Markers are filled with the character
+// card, the triggered world info and the persona description; the main prompt and the post-history instructions are
+// overridden by the card's, which can include the preset's with {{original}}, unless the preset forbids it.
+func presetPromptContent(prompt PresetPrompt, characterData *CharacterCardV2, positions, persona map[string]string) string {
+	var card CharacterCardV2Data
+	if characterData != nil {
+		card = characterData.Data
+	}
+
+	switch prompt.Identifier {
+	case PromptMain:
+		return overridePrompt(prompt, card.SystemPrompt)
+	case PromptJailbreak:
+		return overridePrompt(prompt, card.PostHistoryInstructions)
+	case PromptCharDescription:
+		return card.Description
+	case PromptCharPersonality:
+		if card.Personality == "" {
+			return ""
+		}
+		return "Personality: " + card.Personality
+	case PromptScenario:
+		if card.Scenario == "" {
+			return ""
+		}
+		return "Scenario: " + card.Scenario
+	case PromptPersonaDescription:
+		return persona[PersonaPositionPrompt]
+	case PromptWorldInfoBefore:
+		return positions[PositionBeforeChar]
+	case PromptWorldInfoAfter:
+		return positions[PositionAfterChar]
+	}
+
+	// Markers of features this bot does not have are left empty
+	if prompt.Marker {
+		return ""
+	}
+	return prompt.Content
+}
+
+// overridePrompt returns the card's prompt in place of the preset's, when the card has one and the preset allows it
+func overridePrompt(prompt PresetPrompt, cardPrompt string) string {
+	if strings.TrimSpace(cardPrompt) == "" || prompt.ForbidOverrides {
+		return prompt.Content
+	}
+	return strings.ReplaceAll(cardPrompt, "{{original}}", prompt.Content)
+}
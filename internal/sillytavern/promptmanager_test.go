@@ -0,0 +1,72 @@
+package sillytavern
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testPresetJSON is a SillyTavern chat completion preset with a character-specific and a global prompt order
+const testPresetJSON = `{
+	"temperature": 0.9,
+	"prompts": [
+		{"identifier": "main", "name": "Main Prompt", "system_prompt": true, "role": "system", "content": "Write {{char}}'s next reply."},
+		{"identifier": "nsfw", "name": "NSFW Prompt", "system_prompt": true, "role": "system", "content": "Anything goes."},
+		{"identifier": "jailbreak", "name": "Post-History Instructions", "system_prompt": true, "role": "system", "content": "Stay in character."},
+		{"identifier": "chatHistory", "name": "Chat History", "system_prompt": true, "marker": true},
+		{"identifier": "dialogueExamples", "name": "Chat Examples", "system_prompt": true, "marker": true},
+		{"identifier": "worldInfoBefore", "name": "World Info (before)", "system_prompt": true, "marker": true},
+		{"identifier": "charDescription", "name": "Char Description", "system_prompt": true, "marker": true},
+		{"identifier": "personaDescription", "name": "Persona Description", "system_prompt": true, "marker": true},
+		{"identifier": "3f1c", "name": "Reminder", "role": "user", "content": "Remember the {{char}} rules.", "injection_position": 1, "injection_depth": 1},
+		{"identifier": "9b2e", "name": "Style", "role": "assistant", "content": "Understood.", "enabled": false}
+	],
+	"prompt_order": [
+		{"character_id": 100000, "order": [{"identifier": "main", "enabled": true}]},
+		{"character_id": 100001, "order": [
+			{"identifier": "worldInfoBefore", "enabled": true},
+			{"identifier": "main", "enabled": true},
+			{"identifier": "nsfw", "enabled": false},
+			{"identifier": "charDescription", "enabled": true},
+			{"identifier": "personaDescription", "enabled": true},
+			{"identifier": "dialogueExamples", "enabled": true},
+			{"identifier": "9b2e", "enabled": true},
+			{"identifier": "chatHistory", "enabled": true},
+			{"identifier": "3f1c", "enabled": true},
+			{"identifier": "jailbreak", "enabled": true},
+			{"identifier": "missing", "enabled": true}
+		]}
+	]
+}`
+
+func TestPresetData_OrderedPrompts(t *testing.T) {
+	presetData, err := NewPresetManager(nil).ParsePresetData(testPresetJSON)
+	require.NoError(t, err)
+
+	// The global prompt order is used, leaving out the disabled and unknown prompts
+	var identifiers []string
+	for _, prompt := range presetData.OrderedPrompts() {
+		identifiers = append(identifiers, prompt.Identifier)
+	}
+	assert.Equal(t, []string{"worldInfoBefore", "main", "charDescription", "personaDescription", "dialogueExamples", "9b2e", "chatHistory", "3f1c", "jailbreak"}, identifiers)
+
+	// Without a prompt order, the prompts are used in their own order with their own toggles
+	presetData.PromptOrder = nil
+	prompts := presetData.OrderedPrompts()
+	assert.Len(t, prompts, 9)
+	assert.Equal(t, "main", prompts[0].Identifier)
+
+	assert.Nil(t, (&PresetData{Temperature: 0.5}).OrderedPrompts())
+}
+
+func TestOverridePrompt(t *testing.T) {
+	prompt := PresetPrompt{Identifier: PromptMain, Content: "Be helpful."}
+
+	assert.Equal(t, "Be helpful.", overridePrompt(prompt, " "))
+	assert.Equal(t, "You are Aria.", overridePrompt(prompt, "You are Aria."))
+	assert.Equal(t, "Be helpful. You are Aria.", overridePrompt(prompt, "{{original}} You are Aria."))
+
+	prompt.ForbidOverrides = true
+	assert.Equal(t, "Be helpful.", overridePrompt(prompt, "You are Aria."))
+}
@@ -25,26 +25,37 @@ func NewRegexProcessor(storage storage.Storage) *RegexProcessor {
 
 // ProcessInput applies input regex patterns to the text
 func (p *RegexProcessor) ProcessInput(userID *int64, text string) (string, error) {
+	return p.ProcessInputWithMacros(userID, text, nil)
+}
+
+// ProcessInputWithMacros applies input regex patterns to the text, expanding the macros of their replacements
+func (p *RegexProcessor) ProcessInputWithMacros(userID *int64, text string, macros *MacroContext) (string, error) {
 	patterns, err := p.storage.ListRegexPatterns(userID, "input")
 	if err != nil {
 		return text, fmt.Errorf("failed to list input patterns: %w", err)
 	}
 
-	return p.applyPatterns(patterns, text)
+	return p.applyPatterns(patterns, text, macros)
 }
 
 // ProcessOutput applies output regex patterns to the text
 func (p *RegexProcessor) ProcessOutput(userID *int64, text string) (string, error) {
+	return p.ProcessOutputWithMacros(userID, text, nil)
+}
+
+// ProcessOutputWithMacros applies output regex patterns to the text, expanding the macros of their replacements
+func (p *RegexProcessor) ProcessOutputWithMacros(userID *int64, text string, macros *MacroContext) (string, error) {
 	patterns, err := p.storage.ListRegexPatterns(userID, "output")
 	if err != nil {
 		return text, fmt.Errorf("failed to list output patterns: %w", err)
 	}
 
-	return p.applyPatterns(patterns, text)
+	return p.applyPatterns(patterns, text, macros)
 }
 
-// applyPatterns applies a list of regex patterns to text in order
-func (p *RegexProcessor) applyPatterns(patterns []*storage.RegexPattern, text string) (string, error) {
+// applyPatterns applies a list of regex patterns to text in order.
+// Macro values in the replacements are escaped, so a $ in them is not taken for a capture group.
+func (p *RegexProcessor) applyPatterns(patterns []*storage.RegexPattern, text string, macros *MacroContext) (string, error) {
 	// Filter enabled patterns
 	enabledPatterns := make([]*storage.RegexPattern, 0)
 	for _, pattern := range patterns {
@@ -73,7 +84,10 @@ func (p *RegexProcessor) applyPatterns(patterns []*storage.RegexPattern, text st
 			continue
 		}
 
-		result = re.ReplaceAllString(result, pattern.Replace)
+		replace := macros.expand(pattern.Replace, func(value string) string {
+			return strings.ReplaceAll(value, "$", "$$")
+		})
+		result = re.ReplaceAllString(result, replace)
 	}
 
 	return result, nil
@@ -2,6 +2,7 @@ package sillytavern
 
 import (
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/tbxark/ChatGPT-Telegram-Workers/go_version/internal/storage"
@@ -156,11 +157,73 @@ func (m *mockRegexStorage) GetLoginToken(userID int64) (*storage.LoginToken, err
 func (m *mockRegexStorage) ValidateLoginToken(userID int64, token string) (bool, error) {
 	return false, nil
 }
-func (m *mockRegexStorage) DeleteLoginToken(userID int64) error { return nil }
-func (m *mockRegexStorage) CleanupExpiredTokens() error         { return nil }
-func (m *mockRegexStorage) DeleteAllChatHistory() error         { return nil }
-func (m *mockRegexStorage) CleanupExpired() error               { return nil }
-func (m *mockRegexStorage) Close() error                        { return nil }
+func (m *mockRegexStorage) DeleteLoginToken(userID int64) error                           { return nil }
+func (m *mockRegexStorage) CleanupExpiredTokens() error                                   { return nil }
+func (m *mockRegexStorage) GetCachedResponse(key string) (string, bool, error)            { return "", false, nil }
+func (m *mockRegexStorage) SaveCachedResponse(key string, response string, ttl int) error { return nil }
+func (m *mockRegexStorage) RecordUsage(botID int64, provider, model string, cacheHit bool) error {
+	return nil
+}
+func (m *mockRegexStorage) TakeInlineQuota(botID, userID int64, limit int) (bool, error) {
+	return true, nil
+}
+func (m *mockRegexStorage) GetUsageStats(botID int64, since time.Time) ([]*storage.UsageStat, error) {
+	return nil, nil
+}
+func (m *mockRegexStorage) DeleteAllChatHistory() error                          { return nil }
+func (m *mockRegexStorage) ArchiveChatHistory(ctx *storage.SessionContext) error { return nil }
+func (m *mockRegexStorage) RestoreConversation(ctx *storage.SessionContext, id uint) error {
+	return nil
+}
+func (m *mockRegexStorage) GetConversation(id uint) (*storage.Conversation, error) {
+	return nil, storage.ErrNotFound
+}
+func (m *mockRegexStorage) ListConversations(ctx *storage.SessionContext) ([]*storage.Conversation, error) {
+	return nil, nil
+}
+func (m *mockRegexStorage) ListUserConversations(userID int64) ([]*storage.Conversation, error) {
+	return nil, nil
+}
+func (m *mockRegexStorage) UpdateConversationTitle(id uint, title string) error { return nil }
+func (m *mockRegexStorage) DeleteConversation(id uint) error                    { return nil }
+func (m *mockRegexStorage) ForkChatHistory(ctx *storage.SessionContext, history []storage.HistoryItem) error {
+	return nil
+}
+func (m *mockRegexStorage) ListBranches(ctx *storage.SessionContext) ([]*storage.Branch, error) {
+	return nil, nil
+}
+func (m *mockRegexStorage) GetWorldInfoEffects(ctx *storage.SessionContext) ([]*storage.WorldInfoEffect, error) {
+	return nil, nil
+}
+func (m *mockRegexStorage) SaveWorldInfoEffects(ctx *storage.SessionContext, effects []*storage.WorldInfoEffect) error {
+	return nil
+}
+func (m *mockRegexStorage) NextWorldInfoTurn(ctx *storage.SessionContext) (int, error) {
+	return 0, nil
+}
+func (m *mockRegexStorage) CreatePersona(persona *storage.Persona) error {
+	return nil
+}
+func (m *mockRegexStorage) GetPersona(id uint) (*storage.Persona, error) {
+	return nil, storage.ErrNotFound
+}
+func (m *mockRegexStorage) ListPersonas(userID int64) ([]*storage.Persona, error) {
+	return nil, nil
+}
+func (m *mockRegexStorage) UpdatePersona(persona *storage.Persona) error {
+	return nil
+}
+func (m *mockRegexStorage) DeletePersona(id uint) error {
+	return nil
+}
+func (m *mockRegexStorage) GetActivePersona(userID int64) (*storage.Persona, error) {
+	return nil, nil
+}
+func (m *mockRegexStorage) ActivatePersona(userID int64, personaID uint) error {
+	return nil
+}
+func (m *mockRegexStorage) CleanupExpired() error { return nil }
+func (m *mockRegexStorage) Close() error          { return nil }
 
 func TestRegexProcessor_ProcessInput(t *testing.T) {
 	mockStorage := newMockRegexStorage()
@@ -210,6 +273,30 @@ func TestRegexProcessor_ProcessOutput(t *testing.T) {
 	assert.Equal(t, "bye world", result)
 }
 
+func TestRegexProcessor_ProcessOutputWithMacros(t *testing.T) {
+	mockStorage := newMockRegexStorage()
+	processor := NewRegexProcessor(mockStorage)
+
+	userID := int64(123)
+
+	// Macros of the replacement are expanded, their values are not read as capture groups
+	pattern := &storage.RegexPattern{
+		UserID:  &userID,
+		Name:    "Sign",
+		Pattern: "(bye)",
+		Replace: "$1 from {{char}} to {{user}}",
+		Type:    "output",
+		Order:   1,
+		Enabled: true,
+	}
+	mockStorage.CreateRegexPattern(pattern)
+
+	macros := &MacroContext{User: "Bob", Char: "$1 Aria"}
+	result, err := processor.ProcessOutputWithMacros(&userID, "bye", macros)
+	assert.NoError(t, err)
+	assert.Equal(t, "bye from $1 Aria to Bob", result)
+}
+
 func TestRegexProcessor_MultiplePatterns(t *testing.T) {
 	mockStorage := newMockRegexStorage()
 	processor := NewRegexProcessor(mockStorage)
@@ -4,24 +4,76 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"math/rand"
 	"regexp"
+	"sort"
 	"strings"
+	"sync"
 
 	"github.com/tbxark/ChatGPT-Telegram-Workers/go_version/internal/storage"
 )
 
+// Selective logic of the secondary keys of an entry, as numbered by SillyTavern
+const (
+	SelectiveAndAny = 0 // Any secondary key matches
+	SelectiveNotAll = 1 // Not all secondary keys match
+	SelectiveNotAny = 2 // No secondary key matches
+	SelectiveAndAll = 3 // All secondary keys match
+)
+
+// Positions of world book entries in the prompt
+const (
+	PositionBeforeChar    = "before_char"    // Before the character definition
+	PositionAfterChar     = "after_char"     // After the character definition
+	PositionBeforeExample = "before_example" // Before the example messages
+	PositionAfterExample  = "after_example"  // After the example messages
+	PositionANTop         = "an_top"         // Above the author's note
+	PositionANBottom      = "an_bottom"      // Below the author's note
+	PositionAtDepth       = "at_depth"       // Among the chat messages, Depth messages from the end
+)
+
+// entryPositions maps the numeric positions of SillyTavern to their names
+var entryPositions = map[int]string{
+	0: PositionBeforeChar,
+	1: PositionAfterChar,
+	2: PositionANTop,
+	3: PositionANBottom,
+	4: PositionAtDepth,
+	5: PositionBeforeExample,
+	6: PositionAfterExample,
+}
+
+// DefaultWorldBookMaxRecursion is the default number of recursive scans over the content of activated entries
+const DefaultWorldBookMaxRecursion = 3
+
 // WorldBookManager manages SillyTavern world books
 type WorldBookManager struct {
 	storage storage.Storage
+
+	// ScanDepth is the number of last messages scanned for keys by entries without their own scan depth,
+	// 0 scans the whole history
+	ScanDepth int
+
+	// MaxRecursion limits the recursive scans over the content of activated entries, 0 disables recursion
+	MaxRecursion int
+
+	random *rand.Rand
 }
 
 // NewWorldBookManager creates a new WorldBookManager
 func NewWorldBookManager(storage storage.Storage) *WorldBookManager {
 	return &WorldBookManager{
-		storage: storage,
+		storage:      storage,
+		MaxRecursion: DefaultWorldBookMaxRecursion,
 	}
 }
 
+// SetRandomSource sets the source of the probability rolls, so that tests can seed it.
+// The seeded source must not be shared between goroutines.
+func (m *WorldBookManager) SetRandomSource(source rand.Source) {
+	m.random = rand.New(source)
+}
+
 // WorldBookData represents the SillyTavern world book format
 type WorldBookData struct {
 	Name       string                       `json:"name"`
@@ -39,13 +91,19 @@ type WorldBookEntryData struct {
 	Constant          bool                   `json:"constant"`
 	Selective         bool                   `json:"selective"`
 	Order             int                    `json:"order"`
-	Position          int                    `json:"position"` // 0 = before_char, 1 = after_char
+	Position          int                    `json:"position"` // 0 = before_char, 1 = after_char, 2 = an_top, 3 = an_bottom, 4 = at_depth, 5 = before_example, 6 = after_example
 	Disable           bool                   `json:"disable"`
 	ExcludeRecursion  bool                   `json:"excludeRecursion,omitempty"`
 	Probability       int                    `json:"probability,omitempty"`
 	UseProbability    bool                   `json:"useProbability,omitempty"`
-	Depth             int                    `json:"depth,omitempty"`
+	Depth             int                    `json:"depth,omitempty"`     // Insertion depth, for at_depth
+	ScanDepth         *int                   `json:"scanDepth,omitempty"` // Number of last messages scanned, nil uses the global scan depth
 	SelectiveLogic    int                    `json:"selectiveLogic,omitempty"`
+	Role              int                    `json:"role,omitempty"` // 0 = system, 1 = user, 2 = assistant, for at_depth
+	PreventRecursion  bool                   `json:"preventRecursion,omitempty"`
+	Sticky            int                    `json:"sticky,omitempty"`   // Messages the entry stays active after activation
+	Cooldown          int                    `json:"cooldown,omitempty"` // Messages the entry cannot activate after being active
+	Delay             int                    `json:"delay,omitempty"`    // Messages the chat needs before the entry can activate
 	Extensions        map[string]interface{} `json:"extensions,omitempty"`
 }
 
@@ -166,30 +224,124 @@ func (m *WorldBookManager) convertToStorageEntry(bookID uint, data WorldBookEntr
 	secondaryKeysJSON, _ := json.Marshal(data.KeySecondary)
 	extensionsJSON, _ := json.Marshal(data.Extensions)
 
-	// Convert position int to string
-	position := "after_char"
-	if data.Position == 0 {
-		position = "before_char"
+	// Convert position and role ints to strings
+	position, ok := entryPositions[data.Position]
+	if !ok {
+		position = PositionAfterChar
+	}
+	role := "system"
+	switch data.Role {
+	case 1:
+		role = "user"
+	case 2:
+		role = "assistant"
 	}
 
 	return &storage.WorldBookEntry{
-		WorldBookID:   bookID,
-		UID:           data.UID,
-		Keys:          string(keysJSON),
-		SecondaryKeys: string(secondaryKeysJSON),
-		Content:       data.Content,
-		Comment:       data.Comment,
-		Constant:      data.Constant,
-		Selective:     data.Selective,
-		Order:         data.Order,
-		Position:      position,
-		Enabled:       !data.Disable,
-		Extensions:    string(extensionsJSON),
+		WorldBookID:      bookID,
+		UID:              data.UID,
+		Keys:             string(keysJSON),
+		SecondaryKeys:    string(secondaryKeysJSON),
+		Content:          data.Content,
+		Comment:          data.Comment,
+		Constant:         data.Constant,
+		Selective:        data.Selective,
+		Order:            data.Order,
+		Position:         position,
+		Depth:            data.Depth,
+		Role:             role,
+		Enabled:          !data.Disable,
+		SelectiveLogic:   data.SelectiveLogic,
+		Probability:      data.Probability,
+		UseProbability:   data.UseProbability,
+		ScanDepth:        data.ScanDepth,
+		ExcludeRecursion: data.ExcludeRecursion,
+		PreventRecursion: data.PreventRecursion,
+		Sticky:           data.Sticky,
+		Cooldown:         data.Cooldown,
+		Delay:            data.Delay,
+		Extensions:       string(extensionsJSON),
 	}
 }
 
+// convertToEntryData converts storage.WorldBookEntry back to WorldBookEntryData
+func (m *WorldBookManager) convertToEntryData(entry *storage.WorldBookEntry) WorldBookEntryData {
+	var keys, secondaryKeys []string
+	_ = json.Unmarshal([]byte(entry.Keys), &keys)
+	_ = json.Unmarshal([]byte(entry.SecondaryKeys), &secondaryKeys)
+	var extensions map[string]interface{}
+	_ = json.Unmarshal([]byte(entry.Extensions), &extensions)
+
+	// Convert position and role strings to ints
+	position := 1
+	for number, name := range entryPositions {
+		if name == entry.Position {
+			position = number
+		}
+	}
+	role := 0
+	switch entry.Role {
+	case "user":
+		role = 1
+	case "assistant":
+		role = 2
+	}
+
+	return WorldBookEntryData{
+		UID:              entry.UID,
+		Key:              keys,
+		KeySecondary:     secondaryKeys,
+		Comment:          entry.Comment,
+		Content:          entry.Content,
+		Constant:         entry.Constant,
+		Selective:        entry.Selective,
+		Order:            entry.Order,
+		Position:         position,
+		Disable:          !entry.Enabled,
+		ExcludeRecursion: entry.ExcludeRecursion,
+		Probability:      entry.Probability,
+		UseProbability:   entry.UseProbability,
+		Depth:            entry.Depth,
+		ScanDepth:        entry.ScanDepth,
+		SelectiveLogic:   entry.SelectiveLogic,
+		Role:             role,
+		PreventRecursion: entry.PreventRecursion,
+		Sticky:           entry.Sticky,
+		Cooldown:         entry.Cooldown,
+		Delay:            entry.Delay,
+		Extensions:       extensions,
+	}
+}
+
+// ExportBook exports a world book in the SillyTavern format, with its entries as currently stored
+func (m *WorldBookManager) ExportBook(userID *int64, bookID uint) (*WorldBookData, error) {
+	book, err := m.LoadBook(userID, bookID)
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := m.storage.ListWorldBookEntries(book.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list world book entries: %w", err)
+	}
+
+	bookData := &WorldBookData{
+		Name:    book.Name,
+		Entries: make(map[string]WorldBookEntryData, len(entries)),
+	}
+	if original, err := m.ParseBookData(book.Data); err == nil {
+		bookData.Extensions = original.Extensions
+	}
+	for _, entry := range entries {
+		bookData.Entries[entry.UID] = m.convertToEntryData(entry)
+	}
+
+	return bookData, nil
+}
+
 // TriggerEntries finds world book entries that should be triggered based on message content
-// This implements the core world book logic: keyword matching, priority sorting, etc.
+// This implements SillyTavern's activation logic: keyword matching over the last messages of the scan depth,
+// selective logic of the secondary keys, probability rolls, recursion and priority sorting
 func (m *WorldBookManager) TriggerEntries(bookID uint, messages []storage.HistoryItem) ([]*storage.WorldBookEntry, error) {
 	// Get all entries for this book
 	entries, err := m.storage.ListWorldBookEntries(bookID)
@@ -197,111 +349,380 @@ func (m *WorldBookManager) TriggerEntries(bookID uint, messages []storage.Histor
 		return nil, fmt.Errorf("failed to list world book entries: %w", err)
 	}
 
-	// Combine all message content into a single string for matching
-	var messageText strings.Builder
-	for _, msg := range messages {
-		if contentStr, ok := msg.Content.(string); ok {
-			messageText.WriteString(contentStr)
-			messageText.WriteString(" ")
-		}
+	return m.triggerEntries(entries, messages, nil), nil
+}
+
+// TriggerSessionEntries finds the triggered world book entries like TriggerEntries,
+// applying and updating the sticky and cooldown effects of the session
+func (m *WorldBookManager) TriggerSessionEntries(ctx *storage.SessionContext, bookID uint, messages []storage.HistoryItem) ([]*storage.WorldBookEntry, error) {
+	entries, err := m.storage.ListWorldBookEntries(bookID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list world book entries: %w", err)
 	}
-	combinedText := strings.ToLower(messageText.String())
 
-	var triggered []*storage.WorldBookEntry
+	return m.TriggerMergedEntries(ctx, entries, messages, nil)
+}
 
-	for _, entry := range entries {
-		// Skip disabled entries
-		if !entry.Enabled {
-			continue
-		}
+// TriggerMergedEntries finds the triggered entries among the entries of several books, such as the active
+// world book and the character book of the active card. Without a session no timed effects apply;
+// entries that are neither stored nor have a UID never have timed effects. Each call is a turn of the session,
+// the clock of its timed effects, and an empty chat drops the effects of the previous one.
+// The keep function, when not nil, selects the triggered entries that are inserted, such as those within
+// the world info budget; only these start their timed effects and are returned.
+func (m *WorldBookManager) TriggerMergedEntries(ctx *storage.SessionContext, entries []*storage.WorldBookEntry, messages []storage.HistoryItem, keep func([]*storage.WorldBookEntry) []*storage.WorldBookEntry) ([]*storage.WorldBookEntry, error) {
+	if keep == nil {
+		keep = func(triggered []*storage.WorldBookEntry) []*storage.WorldBookEntry { return triggered }
+	}
+	if ctx == nil {
+		return keep(m.triggerEntries(entries, messages, nil)), nil
+	}
 
-		// Constant entries are always included
-		if entry.Constant {
-			triggered = append(triggered, entry)
-			continue
+	turn, err := m.storage.NextWorldInfoTurn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to advance world info turn: %w", err)
+	}
+	var stored []*storage.WorldInfoEffect
+	if len(messages) > 0 {
+		stored, err = m.storage.GetWorldInfoEffects(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get world info effects: %w", err)
 		}
+	}
+
+	effects := newTimedEffects(stored, entries, turn)
+	triggered := keep(m.triggerEntries(entries, messages, effects))
+	effects.start(triggered)
+
+	if err := m.storage.SaveWorldInfoEffects(ctx, effects.effects); err != nil {
+		return nil, fmt.Errorf("failed to save world info effects: %w", err)
+	}
+	return triggered, nil
+}
+
+// ListEntries lists the entries of a world book
+func (m *WorldBookManager) ListEntries(bookID uint) ([]*storage.WorldBookEntry, error) {
+	entries, err := m.storage.ListWorldBookEntries(bookID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list world book entries: %w", err)
+	}
+	return entries, nil
+}
 
-		// Parse keys from JSON
-		var keys []string
-		if err := json.Unmarshal([]byte(entry.Keys), &keys); err != nil {
-			continue // Skip entries with invalid keys
+// triggerEntries runs the activation logic over the entries of a book; effects is nil without a session
+func (m *WorldBookManager) triggerEntries(entries []*storage.WorldBookEntry, messages []storage.HistoryItem, effects *timedEffects) []*storage.WorldBookEntry {
+	// Scanned text by scan depth, built when first needed
+	scanTexts := make(map[int]keyText)
+	scanText := func(entry *storage.WorldBookEntry) keyText {
+		depth := m.ScanDepth
+		if entry.ScanDepth != nil {
+			depth = *entry.ScanDepth
+		}
+		text, ok := scanTexts[depth]
+		if !ok {
+			text = newKeyText(messagesText(messages, depth))
+			scanTexts[depth] = text
 		}
+		return text
+	}
 
-		// Check if any key matches
-		matched := false
-		for _, key := range keys {
-			key = strings.ToLower(strings.TrimSpace(key))
-			if key == "" {
+	var triggered []*storage.WorldBookEntry
+	done := make(map[*storage.WorldBookEntry]bool) // Activated or failed their probability roll
+	var recursionText strings.Builder
+
+	for pass := 0; pass <= m.MaxRecursion; pass++ {
+		var activated []*storage.WorldBookEntry
+		for _, entry := range entries {
+			// Skip disabled entries and entries already decided
+			if !entry.Enabled || done[entry] {
 				continue
 			}
 
-			// Try as regex first (if it looks like a regex pattern)
-			if strings.HasPrefix(key, "/") && strings.HasSuffix(key, "/") {
-				// Extract regex pattern (remove slashes)
-				pattern := key[1 : len(key)-1]
-				if re, err := regexp.Compile(pattern); err == nil {
-					if re.MatchString(combinedText) {
-						matched = true
-						break
-					}
+			// Delayed entries wait for the chat to be long enough, cooling down entries for their cooldown to end
+			if len(messages) < entry.Delay {
+				continue
+			}
+			sticky := effects.active(entry, effectSticky)
+			if !sticky && effects.active(entry, effectCooldown) {
+				continue
+			}
+
+			if pass == 0 {
+				// Constant and sticky entries are always included
+				if !entry.Constant && !sticky && !m.matchEntry(entry, scanText(entry)) {
+					continue
 				}
 			} else {
-				// Simple substring match
-				if strings.Contains(combinedText, key) {
-					matched = true
-					break
+				// Recursive scans add the content of the entries activated by the previous scan
+				if entry.Constant || entry.ExcludeRecursion || !m.matchEntry(entry, newKeyText(scanText(entry).text+" "+recursionText.String())) {
+					continue
 				}
 			}
+
+			done[entry] = true
+			if sticky || m.rollProbability(entry) {
+				activated = append(activated, entry)
+			}
 		}
 
-		// If selective mode, also check secondary keys
-		if entry.Selective && !matched {
-			var secondaryKeys []string
-			if entry.SecondaryKeys != "" {
-				if err := json.Unmarshal([]byte(entry.SecondaryKeys), &secondaryKeys); err == nil {
-					for _, key := range secondaryKeys {
-						key = strings.ToLower(strings.TrimSpace(key))
-						if key == "" {
-							continue
-						}
-
-						// Try as regex first
-						if strings.HasPrefix(key, "/") && strings.HasSuffix(key, "/") {
-							pattern := key[1 : len(key)-1]
-							if re, err := regexp.Compile(pattern); err == nil {
-								if re.MatchString(combinedText) {
-									matched = true
-									break
-								}
-							}
-						} else {
-							// Simple substring match
-							if strings.Contains(combinedText, key) {
-								matched = true
-								break
-							}
-						}
-					}
-				}
+		triggered = append(triggered, activated...)
+
+		// Only the content of the new entries can activate further entries
+		recursionText.Reset()
+		for _, entry := range activated {
+			if !entry.PreventRecursion {
+				recursionText.WriteString(entry.Content)
+				recursionText.WriteString(" ")
 			}
 		}
+		if recursionText.Len() == 0 {
+			break
+		}
+	}
+
+	// Sort by order, the insertion order of the entries
+	// Higher order values have higher priority and are inserted closer to the chat
+	sort.SliceStable(triggered, func(i, j int) bool {
+		return triggered[i].Order < triggered[j].Order
+	})
+
+	return triggered
+}
+
+// Types of timed world info effects
+const (
+	effectSticky   = "sticky"
+	effectCooldown = "cooldown"
+)
+
+// timedEffects are the sticky and cooldown effects of a session at its current turn
+type timedEffects struct {
+	turn    int
+	effects []*storage.WorldInfoEffect
+}
+
+// effectKey identifies the entry of a timed effect: stored entries by their ID,
+// entries that are not stored, such as those of an embedded character book, by their UID
+type effectKey struct {
+	id  uint
+	uid string
+}
+
+// entryEffectKey returns the key of the timed effects of an entry, zero when it cannot have any
+func entryEffectKey(entry *storage.WorldBookEntry) effectKey {
+	if entry.ID != 0 {
+		return effectKey{id: entry.ID}
+	}
+	return effectKey{uid: entry.UID}
+}
+
+// newEffect returns an effect of the type for the entry with the key
+func newEffect(key effectKey, effectType string, start, end int) *storage.WorldInfoEffect {
+	return &storage.WorldInfoEffect{
+		EntryID:  key.id,
+		EntryUID: key.uid,
+		Type:     effectType,
+		Start:    start,
+		End:      end,
+	}
+}
+
+// newTimedEffects keeps the stored effects lasting at the turn. Ended sticky effects
+// start the cooldown of their entry.
+func newTimedEffects(stored []*storage.WorldInfoEffect, entries []*storage.WorldBookEntry, turn int) *timedEffects {
+	cooldowns := make(map[effectKey]int, len(entries))
+	for _, entry := range entries {
+		cooldowns[entryEffectKey(entry)] = entry.Cooldown
+	}
+
+	t := &timedEffects{turn: turn}
+	for _, effect := range stored {
+		if effect.End > turn {
+			t.effects = append(t.effects, effect)
+			continue
+		}
+		key := effectKey{id: effect.EntryID, uid: effect.EntryUID}
+		if cooldown := cooldowns[key]; effect.Type == effectSticky && effect.End+cooldown > turn {
+			t.effects = append(t.effects, newEffect(key, effectCooldown, effect.End, effect.End+cooldown))
+		}
+	}
+	return t
+}
 
-		if matched {
-			triggered = append(triggered, entry)
+// active reports whether an effect of the type applies to an entry
+func (t *timedEffects) active(entry *storage.WorldBookEntry, effectType string) bool {
+	key := entryEffectKey(entry)
+	if t == nil || key == (effectKey{}) {
+		return false
+	}
+	for _, effect := range t.effects {
+		if effect.EntryID == key.id && effect.EntryUID == key.uid && effect.Type == effectType {
+			return true
 		}
 	}
+	return false
+}
 
-	// Sort by order (priority)
-	// Lower order values have higher priority
-	for i := 0; i < len(triggered); i++ {
-		for j := i + 1; j < len(triggered); j++ {
-			if triggered[i].Order > triggered[j].Order {
-				triggered[i], triggered[j] = triggered[j], triggered[i]
-			}
+// start starts the effects of the triggered entries: sticky entries stay active, the others cool down
+func (t *timedEffects) start(entries []*storage.WorldBookEntry) {
+	for _, entry := range entries {
+		key := entryEffectKey(entry)
+		if key == (effectKey{}) || t.active(entry, effectSticky) {
+			continue
+		}
+		if entry.Sticky > 0 {
+			t.effects = append(t.effects, newEffect(key, effectSticky, t.turn, t.turn+entry.Sticky))
+		} else if entry.Cooldown > 0 {
+			t.effects = append(t.effects, newEffect(key, effectCooldown, t.turn, t.turn+entry.Cooldown))
 		}
 	}
+}
 
-	return triggered, nil
+// matchEntry reports whether the text activates an entry: any of its keys match,
+// and for selective entries its secondary keys satisfy the selective logic
+func (m *WorldBookManager) matchEntry(entry *storage.WorldBookEntry, text keyText) bool {
+	if !matchAnyKey(parseKeys(entry.Keys), text) {
+		return false
+	}
+
+	secondaryKeys := parseKeys(entry.SecondaryKeys)
+	if !entry.Selective || len(secondaryKeys) == 0 {
+		return true
+	}
+
+	matched := 0
+	for _, key := range secondaryKeys {
+		if matchKey(key, text) {
+			matched++
+		}
+	}
+
+	switch entry.SelectiveLogic {
+	case SelectiveNotAll:
+		return matched < len(secondaryKeys)
+	case SelectiveNotAny:
+		return matched == 0
+	case SelectiveAndAll:
+		return matched == len(secondaryKeys)
+	default:
+		return matched > 0
+	}
+}
+
+// rollProbability reports whether an activated entry passes its probability roll
+func (m *WorldBookManager) rollProbability(entry *storage.WorldBookEntry) bool {
+	if !entry.UseProbability || entry.Probability >= 100 {
+		return true
+	}
+
+	var roll int
+	if m.random != nil {
+		roll = m.random.Intn(100)
+	} else {
+		roll = rand.Intn(100)
+	}
+	return roll < entry.Probability
+}
+
+// messagesText joins the content of the last depth messages for key matching,
+// all messages when depth is 0 or less
+func messagesText(messages []storage.HistoryItem, depth int) string {
+	if depth > 0 && depth < len(messages) {
+		messages = messages[len(messages)-depth:]
+	}
+
+	var messageText strings.Builder
+	for _, msg := range messages {
+		if contentStr, ok := msg.Content.(string); ok {
+			messageText.WriteString(contentStr)
+			messageText.WriteString(" ")
+		}
+	}
+	return messageText.String()
+}
+
+// keyText is a scanned text with its lowercase form: regex keys match the text as written,
+// plain keys match the lowercase text
+type keyText struct {
+	text  string
+	lower string
+}
+
+// newKeyText returns the scanned text and its lowercase form
+func newKeyText(text string) keyText {
+	return keyText{text: text, lower: strings.ToLower(text)}
+}
+
+// parseKeys parses the JSON keys of an entry, trimmed and without empty keys
+func parseKeys(data string) []string {
+	var keys []string
+	if data == "" {
+		return nil
+	}
+	if err := json.Unmarshal([]byte(data), &keys); err != nil {
+		return nil // Entries with invalid keys never match
+	}
+
+	result := make([]string, 0, len(keys))
+	for _, key := range keys {
+		key = strings.TrimSpace(key)
+		if key != "" {
+			result = append(result, key)
+		}
+	}
+	return result
+}
+
+// matchAnyKey reports whether any of the keys matches the text
+func matchAnyKey(keys []string, text keyText) bool {
+	for _, key := range keys {
+		if matchKey(key, text) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchKey matches a key against the text: as a regex when written as /pattern/flags, case-sensitive
+// unless its flags include i, and otherwise as a case-insensitive substring
+func matchKey(key string, text keyText) bool {
+	if re, ok := keyRegexp(key); ok {
+		return re != nil && re.MatchString(text.text)
+	}
+	return strings.Contains(text.lower, strings.ToLower(key))
+}
+
+// regexKeyPattern matches the keys written as /pattern/flags, with JavaScript's flags like SillyTavern
+var regexKeyPattern = regexp.MustCompile(`^/(.+)/([dgimsuvy]*)$`)
+
+// keyRegexps caches the compiled regex keys, nil for invalid ones, so scans don't recompile them
+var keyRegexps sync.Map
+
+// keyRegexp returns the compiled regular expression of a key written as /pattern/flags, or nil when it is invalid.
+// The i, m and s flags apply; the others do not change whether the key matches.
+func keyRegexp(key string) (*regexp.Regexp, bool) {
+	match := regexKeyPattern.FindStringSubmatch(key)
+	if match == nil {
+		return nil, false
+	}
+	if cached, ok := keyRegexps.Load(key); ok {
+		return cached.(*regexp.Regexp), true
+	}
+
+	pattern, flags := match[1], ""
+	for _, flag := range "ims" {
+		if strings.ContainsRune(match[2], flag) {
+			flags += string(flag)
+		}
+	}
+	if flags != "" {
+		pattern = "(?" + flags + ")" + pattern
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		re = nil
+	}
+	keyRegexps.Store(key, re)
+	return re, true
 }
 
 // UpdateEntryStatus updates the enabled status of a world book entry
@@ -2,6 +2,7 @@ package sillytavern
 
 import (
 	"encoding/json"
+	"math/rand"
 	"testing"
 
 	"github.com/tbxark/ChatGPT-Telegram-Workers/go_version/internal/storage"
@@ -15,6 +16,8 @@ type MockStorageWithWorldBook struct {
 	nextBookID  uint
 	nextEntryID uint
 	activeBooks map[int64]uint // userID -> bookID
+	effects     []*storage.WorldInfoEffect
+	turn        int
 }
 
 func NewMockStorageWithWorldBook() *MockStorageWithWorldBook {
@@ -108,6 +111,20 @@ func (m *MockStorageWithWorldBook) GetActiveWorldBook(userID *int64) (*storage.W
 	return m.GetWorldBook(activeID)
 }
 
+func (m *MockStorageWithWorldBook) GetWorldInfoEffects(ctx *storage.SessionContext) ([]*storage.WorldInfoEffect, error) {
+	return m.effects, nil
+}
+
+func (m *MockStorageWithWorldBook) SaveWorldInfoEffects(ctx *storage.SessionContext, effects []*storage.WorldInfoEffect) error {
+	m.effects = effects
+	return nil
+}
+
+func (m *MockStorageWithWorldBook) NextWorldInfoTurn(ctx *storage.SessionContext) (int, error) {
+	m.turn++
+	return m.turn, nil
+}
+
 func (m *MockStorageWithWorldBook) CreateWorldBookEntry(entry *storage.WorldBookEntry) error {
 	entry.ID = m.nextEntryID
 	m.nextEntryID++
@@ -669,3 +686,360 @@ func TestWorldBookManager_UpdateEntry(t *testing.T) {
 		t.Errorf("Expected updated content, got '%s'", updatedEntry.Content)
 	}
 }
+
+// saveTestBook saves a world book with the given entries and returns its ID
+func TestWorldBookManager_TriggerEntries_RegexCase(t *testing.T) {
+	manager := NewWorldBookManager(NewMockStorageWithWorldBook())
+
+	bookID := saveTestBook(t, manager, map[string]WorldBookEntryData{
+		"name":    {UID: "name", Key: []string{"/\\bAria\\b/"}, Content: "Aria is a bard."},
+		"ignored": {UID: "ignored", Key: []string{"/^ARIA/i"}, Content: "Aria is here."},
+		"class":   {UID: "class", Key: []string{"/\\S+@\\S+/"}, Content: "An address."},
+		"plain":   {UID: "plain", Key: []string{"Lute"}, Content: "A lute."},
+	})
+	manager.MaxRecursion = 0
+
+	// Regex keys match the text as written, unless their flags ignore the case; plain keys ignore the case
+	uids := triggeredUIDs(t, manager, bookID, "aria plays the lute")
+	if !uids["ignored"] || !uids["plain"] || len(uids) != 2 {
+		t.Errorf("Expected ignored and plain to be triggered, got %v", uids)
+	}
+	uids = triggeredUIDs(t, manager, bookID, "Aria mails aria@example.com")
+	if !uids["name"] || !uids["ignored"] || !uids["class"] || len(uids) != 3 {
+		t.Errorf("Expected name, ignored and class to be triggered, got %v", uids)
+	}
+}
+
+func saveTestBook(t *testing.T, manager *WorldBookManager, entries map[string]WorldBookEntryData) uint {
+	t.Helper()
+
+	bookJSON, _ := json.Marshal(WorldBookData{Name: "Test World", Entries: entries})
+	book := &storage.WorldBook{Data: string(bookJSON)}
+	if err := manager.SaveBook(book); err != nil {
+		t.Fatalf("Failed to save book: %v", err)
+	}
+	return book.ID
+}
+
+// triggeredUIDs returns the UIDs of the entries triggered by the messages
+func triggeredUIDs(t *testing.T, manager *WorldBookManager, bookID uint, messages ...string) map[string]bool {
+	t.Helper()
+
+	var history []storage.HistoryItem
+	for _, message := range messages {
+		history = append(history, storage.HistoryItem{Role: "user", Content: message})
+	}
+	triggered, err := manager.TriggerEntries(bookID, history)
+	if err != nil {
+		t.Fatalf("Failed to trigger entries: %v", err)
+	}
+
+	uids := make(map[string]bool)
+	for _, entry := range triggered {
+		uids[entry.UID] = true
+	}
+	return uids
+}
+
+func TestWorldBookManager_TriggerEntries_SelectiveLogic(t *testing.T) {
+	manager := NewWorldBookManager(NewMockStorageWithWorldBook())
+
+	entry := func(uid string, logic int) WorldBookEntryData {
+		return WorldBookEntryData{
+			UID:            uid,
+			Key:            []string{"dragon"},
+			KeySecondary:   []string{"fire", "ice"},
+			Content:        uid,
+			Selective:      true,
+			SelectiveLogic: logic,
+		}
+	}
+	bookID := saveTestBook(t, manager, map[string]WorldBookEntryData{
+		"and_any": entry("and_any", SelectiveAndAny),
+		"not_all": entry("not_all", SelectiveNotAll),
+		"not_any": entry("not_any", SelectiveNotAny),
+		"and_all": entry("and_all", SelectiveAndAll),
+	})
+
+	tests := []struct {
+		message  string
+		expected []string
+	}{
+		{"a dragon", []string{"not_all", "not_any"}},
+		{"a fire dragon", []string{"and_any", "not_all"}},
+		{"a fire and ice dragon", []string{"and_any", "and_all"}},
+		{"fire and ice", nil}, // Secondary keys alone never activate an entry
+	}
+
+	for _, tt := range tests {
+		uids := triggeredUIDs(t, manager, bookID, tt.message)
+		if len(uids) != len(tt.expected) {
+			t.Errorf("%q: expected %v, got %v", tt.message, tt.expected, uids)
+			continue
+		}
+		for _, uid := range tt.expected {
+			if !uids[uid] {
+				t.Errorf("%q: expected %s to be triggered, got %v", tt.message, uid, uids)
+			}
+		}
+	}
+}
+
+func TestWorldBookManager_TriggerEntries_Probability(t *testing.T) {
+	manager := NewWorldBookManager(NewMockStorageWithWorldBook())
+	manager.SetRandomSource(rand.NewSource(1))
+
+	bookID := saveTestBook(t, manager, map[string]WorldBookEntryData{
+		"never":  {UID: "never", Key: []string{"dragon"}, Content: "never", UseProbability: true, Probability: 0},
+		"always": {UID: "always", Key: []string{"dragon"}, Content: "always", UseProbability: true, Probability: 100},
+		"half":   {UID: "half", Key: []string{"dragon"}, Content: "half", UseProbability: true, Probability: 50},
+		"unused": {UID: "unused", Key: []string{"dragon"}, Content: "unused", Probability: 0},
+	})
+
+	half := 0
+	for i := 0; i < 200; i++ {
+		uids := triggeredUIDs(t, manager, bookID, "a dragon")
+		if uids["never"] {
+			t.Fatal("Entry with probability 0 should never be triggered")
+		}
+		if !uids["always"] || !uids["unused"] {
+			t.Fatalf("Entries with probability 100 or without probability should always be triggered, got %v", uids)
+		}
+		if uids["half"] {
+			half++
+		}
+	}
+	if half < 60 || half > 140 {
+		t.Errorf("Expected entry with probability 50 to be triggered about half of the time, got %d/200", half)
+	}
+}
+
+func TestWorldBookManager_TriggerEntries_ScanDepth(t *testing.T) {
+	manager := NewWorldBookManager(NewMockStorageWithWorldBook())
+
+	one := 1
+	bookID := saveTestBook(t, manager, map[string]WorldBookEntryData{
+		"global": {UID: "global", Key: []string{"dragon"}, Content: "global"},
+		"recent": {UID: "recent", Key: []string{"dragon"}, Content: "recent", ScanDepth: &one},
+	})
+
+	// Without scan depth the whole history is scanned
+	uids := triggeredUIDs(t, manager, bookID, "a dragon", "a cat", "a dog")
+	if !uids["global"] || uids["recent"] {
+		t.Errorf("Expected only the entry without scan depth to be triggered, got %v", uids)
+	}
+
+	// The global scan depth applies to entries without their own
+	manager.ScanDepth = 2
+	uids = triggeredUIDs(t, manager, bookID, "a dragon", "a cat", "a dog")
+	if len(uids) != 0 {
+		t.Errorf("Expected no entries to be triggered, got %v", uids)
+	}
+	uids = triggeredUIDs(t, manager, bookID, "a cat", "a dragon", "a dog")
+	if !uids["global"] || uids["recent"] {
+		t.Errorf("Expected only the entry using the global scan depth to be triggered, got %v", uids)
+	}
+	uids = triggeredUIDs(t, manager, bookID, "a cat", "a dog", "a dragon")
+	if !uids["global"] || !uids["recent"] {
+		t.Errorf("Expected both entries to be triggered, got %v", uids)
+	}
+}
+
+func TestWorldBookManager_TriggerEntries_Recursion(t *testing.T) {
+	manager := NewWorldBookManager(NewMockStorageWithWorldBook())
+
+	bookID := saveTestBook(t, manager, map[string]WorldBookEntryData{
+		"kingdom":  {UID: "kingdom", Key: []string{"kingdom"}, Content: "The kingdom is ruled by the queen."},
+		"queen":    {UID: "queen", Key: []string{"queen"}, Content: "The queen owns a dragon."},
+		"dragon":   {UID: "dragon", Key: []string{"dragon"}, Content: "The dragon guards a castle."},
+		"castle":   {UID: "castle", Key: []string{"castle"}, Content: "The castle is old.", ExcludeRecursion: true},
+		"prevents": {UID: "prevents", Key: []string{"sword"}, Content: "The sword belongs to the queen.", PreventRecursion: true},
+	})
+
+	// Entries activate each other up to the recursion limit, except excluded entries
+	uids := triggeredUIDs(t, manager, bookID, "Tell me about the kingdom")
+	if !uids["kingdom"] || !uids["queen"] || !uids["dragon"] || uids["castle"] {
+		t.Errorf("Expected kingdom, queen and dragon to be triggered, got %v", uids)
+	}
+
+	// Excluded entries are still activated by the messages
+	uids = triggeredUIDs(t, manager, bookID, "Tell me about the castle")
+	if !uids["castle"] || len(uids) != 1 {
+		t.Errorf("Expected only castle to be triggered, got %v", uids)
+	}
+
+	// The content of entries preventing recursion activates nothing
+	uids = triggeredUIDs(t, manager, bookID, "Tell me about the sword")
+	if !uids["prevents"] || len(uids) != 1 {
+		t.Errorf("Expected only the sword entry to be triggered, got %v", uids)
+	}
+
+	// The recursion limit stops the chain
+	manager.MaxRecursion = 1
+	uids = triggeredUIDs(t, manager, bookID, "Tell me about the kingdom")
+	if !uids["kingdom"] || !uids["queen"] || uids["dragon"] {
+		t.Errorf("Expected kingdom and queen to be triggered, got %v", uids)
+	}
+
+	// Recursion can be disabled
+	manager.MaxRecursion = 0
+	uids = triggeredUIDs(t, manager, bookID, "Tell me about the kingdom")
+	if !uids["kingdom"] || len(uids) != 1 {
+		t.Errorf("Expected only kingdom to be triggered, got %v", uids)
+	}
+}
+
+func TestWorldBookManager_TriggerSessionEntries_TimedEffects(t *testing.T) {
+	mockStorage := NewMockStorageWithWorldBook()
+	manager := NewWorldBookManager(mockStorage)
+
+	bookID := saveTestBook(t, manager, map[string]WorldBookEntryData{
+		"sticky":   {UID: "sticky", Key: []string{"dragon"}, Content: "sticky", Sticky: 4, Cooldown: 2},
+		"cooldown": {UID: "cooldown", Key: []string{"dragon"}, Content: "cooldown", Cooldown: 4},
+		"delay":    {UID: "delay", Key: []string{"dragon"}, Content: "delay", Delay: 3},
+	})
+	session := &storage.SessionContext{ChatID: 1, BotID: 2}
+	manager.ScanDepth = 1
+
+	// Each turn adds a message to a history capped at 3 messages
+	var history []storage.HistoryItem
+	trigger := func(text string) map[string]bool {
+		history = append(history, storage.HistoryItem{Role: "user", Content: text})
+		if len(history) > 3 {
+			history = history[len(history)-3:]
+		}
+		triggered, err := manager.TriggerSessionEntries(session, bookID, history)
+		if err != nil {
+			t.Fatalf("Failed to trigger entries: %v", err)
+		}
+		uids := make(map[string]bool)
+		for _, entry := range triggered {
+			uids[entry.UID] = true
+		}
+		return uids
+	}
+
+	turns := []struct {
+		text string
+		want map[string]bool
+	}{
+		{"a dragon", map[string]bool{"sticky": true, "cooldown": true}}, // Turn 1: delay waits for 3 messages
+		{"hello", map[string]bool{"sticky": true}},                      // Turn 2: sticky without keys, cooldown cooling down
+		{"hello", map[string]bool{"sticky": true}},                      // Turn 3
+		{"hello", map[string]bool{"sticky": true}},                      // Turn 4: the history is capped, the turns go on
+		{"hello", map[string]bool{}},                                    // Turn 5: sticky ended, cooling down until 7
+		{"a dragon", map[string]bool{"cooldown": true, "delay": true}},  // Turn 6
+		{"a dragon", map[string]bool{"sticky": true, "delay": true}},    // Turn 7: cooldown cooling down until 10
+	}
+	for i, turn := range turns {
+		got := trigger(turn.text)
+		if len(got) != len(turn.want) {
+			t.Errorf("Turn %d: expected %v, got %v", i+1, turn.want, got)
+			continue
+		}
+		for uid := range turn.want {
+			if !got[uid] {
+				t.Errorf("Turn %d: expected %v, got %v", i+1, turn.want, got)
+			}
+		}
+	}
+
+	// A cleared chat drops the effects of the previous one
+	history = nil
+	got, err := manager.TriggerSessionEntries(session, bookID, history)
+	if err != nil {
+		t.Fatalf("Failed to trigger entries: %v", err)
+	}
+	if len(got) != 0 {
+		t.Errorf("Expected no entries after clearing the chat, got %v", got)
+	}
+	if len(mockStorage.effects) != 0 {
+		t.Errorf("Expected the effects to be dropped, got %d", len(mockStorage.effects))
+	}
+}
+
+func TestWorldBookManager_TriggerMergedEntries_TimedEffects(t *testing.T) {
+	mockStorage := NewMockStorageWithWorldBook()
+	manager := NewWorldBookManager(mockStorage)
+
+	// Entries of an embedded character book are not stored: their UIDs key their effects
+	entries := CharacterBookEntries(&CharacterBook{Entries: []CharacterBookEntry{
+		{Keys: []string{"dragon"}, Content: "kept", Enabled: true, InsertionOrder: 2, Extensions: map[string]interface{}{"sticky": 2}},
+		{Keys: []string{"dragon"}, Content: "dropped", Enabled: true, InsertionOrder: 1, Extensions: map[string]interface{}{"sticky": 2}},
+	}}, "card-1-")
+	session := &storage.SessionContext{ChatID: 1, BotID: 2}
+	manager.ScanDepth = 1
+
+	// Only the kept entries start their effects
+	keep := func(triggered []*storage.WorldBookEntry) []*storage.WorldBookEntry {
+		var kept []*storage.WorldBookEntry
+		for _, entry := range triggered {
+			if entry.Content == "kept" {
+				kept = append(kept, entry)
+			}
+		}
+		return kept
+	}
+
+	history := []storage.HistoryItem{{Role: "user", Content: "a dragon"}}
+	triggered, err := manager.TriggerMergedEntries(session, entries, history, keep)
+	if err != nil {
+		t.Fatalf("Failed to trigger entries: %v", err)
+	}
+	if len(triggered) != 1 || triggered[0].Content != "kept" {
+		t.Fatalf("Expected only the kept entry, got %v", triggered)
+	}
+	if len(mockStorage.effects) != 1 || mockStorage.effects[0].EntryUID != "card-1-0" {
+		t.Fatalf("Expected a sticky effect of the kept entry only, got %v", mockStorage.effects)
+	}
+
+	// The kept entry stays active without its keys
+	history = append(history, storage.HistoryItem{Role: "user", Content: "hello"})
+	triggered, err = manager.TriggerMergedEntries(session, entries, history, nil)
+	if err != nil {
+		t.Fatalf("Failed to trigger entries: %v", err)
+	}
+	if len(triggered) != 1 || triggered[0].UID != "card-1-0" {
+		t.Errorf("Expected the sticky entry, got %v", triggered)
+	}
+}
+
+func TestWorldBookManager_ExportBook(t *testing.T) {
+	mockStorage := NewMockStorageWithWorldBook()
+	manager := NewWorldBookManager(mockStorage)
+
+	two := 2
+	original := WorldBookEntryData{
+		UID:            "entry1",
+		Key:            []string{"dragon"},
+		KeySecondary:   []string{"fire"},
+		Content:        "Dragons breathe fire.",
+		Selective:      true,
+		SelectiveLogic: SelectiveAndAll,
+		Order:          100,
+		Position:       4,
+		Depth:          2,
+		Role:           2,
+		ScanDepth:      &two,
+		Probability:    50,
+		UseProbability: true,
+		Sticky:         3,
+		Cooldown:       2,
+		Delay:          1,
+	}
+	bookID := saveTestBook(t, manager, map[string]WorldBookEntryData{"entry1": original})
+
+	exported, err := manager.ExportBook(nil, bookID)
+	if err != nil {
+		t.Fatalf("Failed to export book: %v", err)
+	}
+	entry, ok := exported.Entries["entry1"]
+	if !ok {
+		t.Fatalf("Expected entry1 to be exported, got %v", exported.Entries)
+	}
+	originalJSON, _ := json.Marshal(original)
+	entryJSON, _ := json.Marshal(entry)
+	if string(originalJSON) != string(entryJSON) {
+		t.Errorf("Expected exported entry %s, got %s", originalJSON, entryJSON)
+	}
+}
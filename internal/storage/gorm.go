@@ -1,6 +1,8 @@
 package storage
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -44,15 +46,22 @@ func NewStorage(dsn string, dbPath string) (Storage, error) {
 	// GORM handles schema creation safely without SQL injection risks
 	if err := db.AutoMigrate(
 		&ChatHistory{},
+		&Conversation{},
 		&UserConfiguration{},
 		&MessageIDs{},
 		&GroupAdmins{},
 		&CharacterCard{},
 		&WorldBook{},
 		&WorldBookEntry{},
+		&WorldInfoEffect{},
+		&WorldInfoTurn{},
 		&Preset{},
 		&RegexPattern{},
+		&Persona{},
 		&LoginToken{},
+		&ResponseCache{},
+		&UsageStat{},
+		&InlineUsage{},
 	); err != nil {
 		return nil, fmt.Errorf("failed to migrate database schema: %w", err)
 	}
@@ -107,7 +116,12 @@ func openSQLite(dbPath string) (*gorm.DB, error) {
 // buildSessionQuery creates a GORM query for session context
 // Uses GORM's Where method which automatically parameterizes all values
 func (s *GORMStorage) buildSessionQuery(ctx *SessionContext) *gorm.DB {
-	query := s.db.Where("chat_id = ? AND bot_id = ?", ctx.ChatID, ctx.BotID)
+	return sessionQuery(s.db, ctx)
+}
+
+// sessionQuery scopes a query (or transaction) to the session context
+func sessionQuery(db *gorm.DB, ctx *SessionContext) *gorm.DB {
+	query := db.Where("chat_id = ? AND bot_id = ?", ctx.ChatID, ctx.BotID)
 
 	if ctx.UserID != nil {
 		query = query.Where("user_id = ?", *ctx.UserID)
@@ -185,6 +199,318 @@ func (s *GORMStorage) DeleteChatHistory(ctx *SessionContext) error {
 	return nil
 }
 
+// DeleteAllChatHistory deletes the chat history of every session
+// Uses GORM's parameterized queries to prevent SQL injection
+func (s *GORMStorage) DeleteAllChatHistory() error {
+	result := s.db.Session(&gorm.Session{AllowGlobalUpdate: true}).Delete(&ChatHistory{})
+	if result.Error != nil {
+		return fmt.Errorf("failed to delete all chat history: %w", result.Error)
+	}
+	return nil
+}
+
+// Conversation Operations
+
+// ArchiveChatHistory moves the chat history of a session to a new archived conversation,
+// leaving the session with an empty history. Empty histories are not archived.
+// Uses GORM's parameterized queries to prevent SQL injection
+func (s *GORMStorage) ArchiveChatHistory(ctx *SessionContext) error {
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		return archiveChatHistory(tx, ctx)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to archive chat history: %w", err)
+	}
+	return nil
+}
+
+// archiveChatHistory archives the chat history of a session within a transaction
+func archiveChatHistory(tx *gorm.DB, ctx *SessionContext) error {
+	var record ChatHistory
+	result := sessionQuery(tx, ctx).First(&record)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return result.Error
+	}
+
+	var history []HistoryItem
+	if err := json.Unmarshal([]byte(record.History), &history); err != nil {
+		return fmt.Errorf("failed to unmarshal history: %w", err)
+	}
+	if len(history) > 0 {
+		conversation := Conversation{
+			ChatID:    record.ChatID,
+			BotID:     record.BotID,
+			UserID:    record.UserID,
+			ThreadID:  record.ThreadID,
+			Title:     record.Title,
+			BranchKey: record.BranchKey,
+			ParentKey: record.ParentKey,
+			History:   record.History,
+		}
+		if err := tx.Create(&conversation).Error; err != nil {
+			return err
+		}
+	}
+
+	return tx.Delete(&record).Error
+}
+
+// RestoreConversation makes an archived conversation of a session its chat history again,
+// archiving the current chat history in its place
+// Uses GORM's parameterized queries to prevent SQL injection
+func (s *GORMStorage) RestoreConversation(ctx *SessionContext, id uint) error {
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var conversation Conversation
+		result := sessionQuery(tx, ctx).Where("id = ?", id).First(&conversation)
+		if result.Error != nil {
+			if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+				return ErrNotFound
+			}
+			return result.Error
+		}
+
+		if err := archiveChatHistory(tx, ctx); err != nil {
+			return err
+		}
+
+		record := ChatHistory{
+			ChatID:    ctx.ChatID,
+			BotID:     ctx.BotID,
+			UserID:    ctx.UserID,
+			ThreadID:  ctx.ThreadID,
+			Title:     conversation.Title,
+			BranchKey: conversation.BranchKey,
+			ParentKey: conversation.ParentKey,
+			History:   conversation.History,
+		}
+		if err := tx.Create(&record).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&conversation).Error
+	})
+	if errors.Is(err, ErrNotFound) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to restore conversation: %w", err)
+	}
+	return nil
+}
+
+// ForkChatHistory starts a branch of the chat history of a session with the given history,
+// archiving the current chat history as the branch's parent
+// Uses GORM's parameterized queries to prevent SQL injection
+func (s *GORMStorage) ForkChatHistory(ctx *SessionContext, history []HistoryItem) error {
+	historyJSON, err := json.Marshal(history)
+	if err != nil {
+		return fmt.Errorf("failed to marshal history: %w", err)
+	}
+	key, err := newBranchKey()
+	if err != nil {
+		return fmt.Errorf("failed to fork chat history: %w", err)
+	}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		branch := ChatHistory{
+			ChatID:    ctx.ChatID,
+			BotID:     ctx.BotID,
+			UserID:    ctx.UserID,
+			ThreadID:  ctx.ThreadID,
+			BranchKey: key,
+			History:   string(historyJSON),
+		}
+
+		var record ChatHistory
+		result := sessionQuery(tx, ctx).First(&record)
+		if result.Error != nil && !errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return result.Error
+		}
+		if result.Error == nil {
+			// The parent needs a key to be found from its branches
+			if record.BranchKey == "" {
+				parentKey, err := newBranchKey()
+				if err != nil {
+					return err
+				}
+				if err := tx.Model(&record).Update("branch_key", parentKey).Error; err != nil {
+					return err
+				}
+				record.BranchKey = parentKey
+			}
+			branch.ParentKey = record.BranchKey
+			if err := archiveChatHistory(tx, ctx); err != nil {
+				return err
+			}
+		}
+
+		return tx.Create(&branch).Error
+	})
+	if err != nil {
+		return fmt.Errorf("failed to fork chat history: %w", err)
+	}
+	return nil
+}
+
+// ListBranches lists the branch tree of the current conversation of a session: the current
+// conversation and the archived conversations connected to it by forks.
+// A conversation that was never forked has no branches.
+// Uses GORM's parameterized queries to prevent SQL injection
+func (s *GORMStorage) ListBranches(ctx *SessionContext) ([]*Branch, error) {
+	var record ChatHistory
+	result := s.buildSessionQuery(ctx).First(&record)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to list branches: %w", result.Error)
+	}
+	if record.BranchKey == "" {
+		return nil, nil
+	}
+
+	var conversations []*Conversation
+	result = s.buildSessionQuery(ctx).Where("branch_key <> ''").Order("created_at ASC, id ASC").Find(&conversations)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to list branches: %w", result.Error)
+	}
+
+	current := &Branch{
+		Key:       record.BranchKey,
+		ParentKey: record.ParentKey,
+		Title:     record.Title,
+		Current:   true,
+		UpdatedAt: record.UpdatedAt,
+	}
+	current.Messages, current.Prompt = summarizeHistory(record.History)
+	branches := []*Branch{current}
+	for _, conversation := range conversations {
+		branch := &Branch{
+			ID:        conversation.ID,
+			Key:       conversation.BranchKey,
+			ParentKey: conversation.ParentKey,
+			Title:     conversation.Title,
+			UpdatedAt: conversation.UpdatedAt,
+		}
+		branch.Messages, branch.Prompt = summarizeHistory(conversation.History)
+		branches = append(branches, branch)
+	}
+
+	// Keep the branches connected to the current conversation
+	connected := map[string]bool{record.BranchKey: true}
+	for changed := true; changed; {
+		changed = false
+		for _, branch := range branches {
+			if connected[branch.Key] {
+				if branch.ParentKey != "" && !connected[branch.ParentKey] {
+					connected[branch.ParentKey] = true
+					changed = true
+				}
+			} else if connected[branch.ParentKey] {
+				connected[branch.Key] = true
+				changed = true
+			}
+		}
+	}
+	tree := branches[:0]
+	for _, branch := range branches {
+		if connected[branch.Key] {
+			tree = append(tree, branch)
+		}
+	}
+	return tree, nil
+}
+
+// newBranchKey generates a random branch key
+func newBranchKey() (string, error) {
+	bytes := make([]byte, 8)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", fmt.Errorf("failed to generate branch key: %w", err)
+	}
+	return hex.EncodeToString(bytes), nil
+}
+
+// summarizeHistory returns the number of items of a JSON history and the text of its last user message
+func summarizeHistory(historyJSON string) (int, string) {
+	var history []HistoryItem
+	if err := json.Unmarshal([]byte(historyJSON), &history); err != nil {
+		return 0, ""
+	}
+	for i := len(history) - 1; i >= 0; i-- {
+		if text, ok := history[i].Content.(string); ok && history[i].Role == "user" {
+			return len(history), text
+		}
+	}
+	return len(history), ""
+}
+
+// GetConversation retrieves an archived conversation by ID
+// Uses GORM's parameterized queries to prevent SQL injection
+func (s *GORMStorage) GetConversation(id uint) (*Conversation, error) {
+	var conversation Conversation
+	result := s.db.First(&conversation, id)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to get conversation: %w", result.Error)
+	}
+	return &conversation, nil
+}
+
+// ListConversations lists the archived conversations of a session, most recent first
+// Uses GORM's parameterized queries to prevent SQL injection
+func (s *GORMStorage) ListConversations(ctx *SessionContext) ([]*Conversation, error) {
+	var conversations []*Conversation
+	result := s.buildSessionQuery(ctx).Order("updated_at DESC, id DESC").Find(&conversations)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to list conversations: %w", result.Error)
+	}
+	return conversations, nil
+}
+
+// ListUserConversations lists the archived conversations of a user, from their private chat
+// and their personal sessions in groups, most recent first
+// Uses GORM's parameterized queries to prevent SQL injection
+func (s *GORMStorage) ListUserConversations(userID int64) ([]*Conversation, error) {
+	var conversations []*Conversation
+	result := s.db.Where("user_id = ? OR (user_id IS NULL AND chat_id = ?)", userID, userID).
+		Order("updated_at DESC, id DESC").
+		Find(&conversations)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to list user conversations: %w", result.Error)
+	}
+	return conversations, nil
+}
+
+// UpdateConversationTitle updates the title of an archived conversation
+// Uses GORM's parameterized queries to prevent SQL injection
+func (s *GORMStorage) UpdateConversationTitle(id uint, title string) error {
+	result := s.db.Model(&Conversation{}).Where("id = ?", id).Update("title", title)
+	if result.Error != nil {
+		return fmt.Errorf("failed to update conversation title: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// DeleteConversation deletes an archived conversation by ID
+// Uses GORM's parameterized queries to prevent SQL injection
+func (s *GORMStorage) DeleteConversation(id uint) error {
+	result := s.db.Delete(&Conversation{}, id)
+	if result.Error != nil {
+		return fmt.Errorf("failed to delete conversation: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
 // GetUserConfig retrieves the user configuration for a session
 // Uses GORM's parameterized queries to prevent SQL injection
 func (s *GORMStorage) GetUserConfig(ctx *SessionContext) (*UserConfig, error) {
@@ -362,6 +688,18 @@ func (s *GORMStorage) CleanupExpired() error {
 		return fmt.Errorf("failed to cleanup expired tokens: %w", err)
 	}
 
+	// Delete expired cached responses
+	result = s.db.Where("expires_at < ?", time.Now()).Delete(&ResponseCache{})
+	if result.Error != nil {
+		return fmt.Errorf("failed to cleanup expired response cache: %w", result.Error)
+	}
+
+	// Delete the inline usage counters of previous days
+	result = s.db.Where("date < ?", time.Now().UTC().Format("2006-01-02")).Delete(&InlineUsage{})
+	if result.Error != nil {
+		return fmt.Errorf("failed to cleanup inline usage: %w", result.Error)
+	}
+
 	return nil
 }
 
@@ -654,6 +992,67 @@ func (s *GORMStorage) DeleteWorldBookEntry(id uint) error {
 	return nil
 }
 
+// GetWorldInfoEffects retrieves the timed world info effects of a session
+func (s *GORMStorage) GetWorldInfoEffects(ctx *SessionContext) ([]*WorldInfoEffect, error) {
+	var effects []*WorldInfoEffect
+	result := sessionQuery(s.db, ctx).Order("id ASC").Find(&effects)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to get world info effects: %w", result.Error)
+	}
+	return effects, nil
+}
+
+// SaveWorldInfoEffects replaces the timed world info effects of a session
+func (s *GORMStorage) SaveWorldInfoEffects(ctx *SessionContext, effects []*WorldInfoEffect) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := sessionQuery(tx, ctx).Delete(&WorldInfoEffect{}).Error; err != nil {
+			return fmt.Errorf("failed to delete world info effects: %w", err)
+		}
+		if len(effects) == 0 {
+			return nil
+		}
+
+		for _, effect := range effects {
+			effect.ID = 0
+			effect.ChatID = ctx.ChatID
+			effect.BotID = ctx.BotID
+			effect.UserID = ctx.UserID
+			effect.ThreadID = ctx.ThreadID
+		}
+		if err := tx.Create(&effects).Error; err != nil {
+			return fmt.Errorf("failed to save world info effects: %w", err)
+		}
+		return nil
+	})
+}
+
+// NextWorldInfoTurn advances the turn counter of a session and returns the new turn, 1 for its first turn
+func (s *GORMStorage) NextWorldInfoTurn(ctx *SessionContext) (int, error) {
+	var turn WorldInfoTurn
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		result := sessionQuery(tx, ctx).First(&turn)
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			turn = WorldInfoTurn{
+				ChatID:   ctx.ChatID,
+				BotID:    ctx.BotID,
+				UserID:   ctx.UserID,
+				ThreadID: ctx.ThreadID,
+				Turn:     1,
+			}
+			return tx.Create(&turn).Error
+		}
+		if result.Error != nil {
+			return result.Error
+		}
+		turn.Turn++
+		return tx.Model(&turn).Update("turn", turn.Turn).Error
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to advance world info turn: %w", err)
+	}
+	return turn.Turn, nil
+}
+
 // Preset Operations
 
 // CreatePreset creates a new preset
@@ -854,6 +1253,103 @@ func (s *GORMStorage) DeleteRegexPattern(id uint) error {
 	return nil
 }
 
+// Persona Operations
+
+// CreatePersona creates a new persona
+// Uses GORM's parameterized queries to prevent SQL injection
+func (s *GORMStorage) CreatePersona(persona *Persona) error {
+	result := s.db.Create(persona)
+	if result.Error != nil {
+		return fmt.Errorf("failed to create persona: %w", result.Error)
+	}
+	return nil
+}
+
+// GetPersona retrieves a persona by ID
+// Uses GORM's parameterized queries to prevent SQL injection
+func (s *GORMStorage) GetPersona(id uint) (*Persona, error) {
+	var persona Persona
+	result := s.db.First(&persona, id)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to get persona: %w", result.Error)
+	}
+	return &persona, nil
+}
+
+// ListPersonas lists the personas of a user
+// Uses GORM's parameterized queries to prevent SQL injection
+func (s *GORMStorage) ListPersonas(userID int64) ([]*Persona, error) {
+	var personas []*Persona
+	result := s.db.Where("user_id = ?", userID).Order("created_at ASC").Find(&personas)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to list personas: %w", result.Error)
+	}
+	return personas, nil
+}
+
+// UpdatePersona updates an existing persona
+// Uses GORM's parameterized queries to prevent SQL injection
+func (s *GORMStorage) UpdatePersona(persona *Persona) error {
+	result := s.db.Save(persona)
+	if result.Error != nil {
+		return fmt.Errorf("failed to update persona: %w", result.Error)
+	}
+	return nil
+}
+
+// DeletePersona deletes a persona by ID
+// Uses GORM's parameterized queries to prevent SQL injection
+func (s *GORMStorage) DeletePersona(id uint) error {
+	result := s.db.Delete(&Persona{}, id)
+	if result.Error != nil {
+		return fmt.Errorf("failed to delete persona: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// GetActivePersona retrieves the active persona of a user, or nil when there is none
+// Uses GORM's parameterized queries to prevent SQL injection
+func (s *GORMStorage) GetActivePersona(userID int64) (*Persona, error) {
+	var persona Persona
+	result := s.db.Where("user_id = ? AND is_active = ?", userID, true).First(&persona)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, nil // No active persona
+		}
+		return nil, fmt.Errorf("failed to get active persona: %w", result.Error)
+	}
+	return &persona, nil
+}
+
+// ActivatePersona activates a persona of a user and deactivates the others;
+// persona ID 0 deactivates all the personas of the user
+// Uses transaction to ensure atomicity and GORM's parameterized queries
+func (s *GORMStorage) ActivatePersona(userID int64, personaID uint) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&Persona{}).Where("user_id = ?", userID).Update("is_active", false).Error; err != nil {
+			return fmt.Errorf("failed to deactivate personas: %w", err)
+		}
+		if personaID == 0 {
+			return nil
+		}
+
+		result := tx.Model(&Persona{}).Where("id = ? AND user_id = ?", personaID, userID).Update("is_active", true)
+		if result.Error != nil {
+			return fmt.Errorf("failed to activate persona: %w", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return ErrNotFound
+		}
+		return nil
+	})
+}
+
 // Login Token Operations
 
 // CreateLoginToken creates a new login token
@@ -905,6 +1401,116 @@ func (s *GORMStorage) CleanupExpiredTokens() error {
 	return nil
 }
 
+// Response Cache Operations
+
+// GetCachedResponse retrieves a non-expired cached response by key
+// Uses GORM's parameterized queries to prevent SQL injection
+func (s *GORMStorage) GetCachedResponse(key string) (string, bool, error) {
+	var record ResponseCache
+	result := s.db.Where("cache_key = ? AND expires_at > ?", key, time.Now()).First(&record)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return "", false, nil
+		}
+		return "", false, fmt.Errorf("failed to get cached response: %w", result.Error)
+	}
+	return record.Response, true, nil
+}
+
+// SaveCachedResponse stores a response under the given key with TTL (in seconds)
+// Uses GORM's parameterized queries to prevent SQL injection
+func (s *GORMStorage) SaveCachedResponse(key string, response string, ttl int) error {
+	expiresAt := time.Now().Add(time.Duration(ttl) * time.Second)
+
+	record := ResponseCache{
+		CacheKey:  key,
+		Response:  response,
+		ExpiresAt: expiresAt,
+	}
+
+	result := s.db.Where("cache_key = ?", key).Assign(ResponseCache{
+		Response:  response,
+		ExpiresAt: expiresAt,
+		UpdatedAt: time.Now(),
+	}).FirstOrCreate(&record)
+
+	if result.Error != nil {
+		return fmt.Errorf("failed to save cached response: %w", result.Error)
+	}
+	return nil
+}
+
+// Usage Stats Operations
+
+// RecordUsage increments today's request counter (and cache hit counter on a hit)
+// for the given bot, provider and model
+// Uses GORM's parameterized queries to prevent SQL injection
+func (s *GORMStorage) RecordUsage(botID int64, provider, model string, cacheHit bool) error {
+	record := UsageStat{
+		BotID:    botID,
+		Date:     time.Now().UTC().Format("2006-01-02"),
+		Provider: provider,
+		Model:    model,
+	}
+
+	result := s.db.Where("bot_id = ? AND date = ? AND provider = ? AND model = ?",
+		record.BotID, record.Date, record.Provider, record.Model).FirstOrCreate(&record)
+	if result.Error != nil {
+		return fmt.Errorf("failed to record usage: %w", result.Error)
+	}
+
+	updates := map[string]interface{}{
+		"requests": gorm.Expr("requests + ?", 1),
+	}
+	if cacheHit {
+		updates["cache_hits"] = gorm.Expr("cache_hits + ?", 1)
+	}
+
+	result = s.db.Model(&UsageStat{}).Where("id = ?", record.ID).Updates(updates)
+	if result.Error != nil {
+		return fmt.Errorf("failed to record usage: %w", result.Error)
+	}
+	return nil
+}
+
+// GetUsageStats retrieves usage counters of a bot since the given day, ordered by date
+// Uses GORM's parameterized queries to prevent SQL injection
+func (s *GORMStorage) GetUsageStats(botID int64, since time.Time) ([]*UsageStat, error) {
+	var stats []*UsageStat
+	result := s.db.Where("bot_id = ? AND date >= ?", botID, since.UTC().Format("2006-01-02")).
+		Order("date ASC, provider ASC, model ASC").
+		Find(&stats)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to get usage stats: %w", result.Error)
+	}
+	return stats, nil
+}
+
+// TakeInlineQuota increments today's inline completion counter of a user unless it reached the limit,
+// reporting whether the completion is allowed
+// Uses GORM's parameterized queries to prevent SQL injection
+func (s *GORMStorage) TakeInlineQuota(botID, userID int64, limit int) (bool, error) {
+	record := InlineUsage{
+		BotID:  botID,
+		UserID: userID,
+		Date:   time.Now().UTC().Format("2006-01-02"),
+	}
+
+	result := s.db.Where("bot_id = ? AND user_id = ? AND date = ?",
+		record.BotID, record.UserID, record.Date).FirstOrCreate(&record)
+	if result.Error != nil {
+		return false, fmt.Errorf("failed to take inline quota: %w", result.Error)
+	}
+
+	// The counter only moves while under the limit, so concurrent queries cannot exceed it
+	result = s.db.Model(&InlineUsage{}).Where("id = ? AND count < ?", record.ID, limit).
+		Update("count", gorm.Expr("count + ?", 1))
+	if result.Error != nil {
+		return false, fmt.Errorf("failed to take inline quota: %w", result.Error)
+	}
+	return result.RowsAffected > 0, nil
+}
+
 // Close closes the database connection
 func (s *GORMStorage) Close() error {
 	sqlDB, err := s.db.DB()
@@ -203,6 +203,91 @@ func TestGORMStorage_Preset(t *testing.T) {
 	}
 }
 
+// TestGORMStorage_Persona tests persona CRUD operations and activation
+func TestGORMStorage_Persona(t *testing.T) {
+	dbPath := "./test_persona.db"
+	defer os.Remove(dbPath)
+
+	storage, err := NewStorage("", dbPath)
+	if err != nil {
+		t.Fatalf("Failed to create storage: %v", err)
+	}
+	defer storage.Close()
+
+	userID := int64(789)
+	otherID := int64(790)
+
+	knight := &Persona{UserID: userID, Name: "Arthur", Description: "A knight"}
+	mage := &Persona{UserID: userID, Name: "Merlin", Description: "A mage"}
+	other := &Persona{UserID: otherID, Name: "Other"}
+	for _, persona := range []*Persona{knight, mage, other} {
+		if err := storage.CreatePersona(persona); err != nil {
+			t.Fatalf("Failed to create persona: %v", err)
+		}
+	}
+
+	// Test List only returns the user's personas
+	personas, err := storage.ListPersonas(userID)
+	if err != nil {
+		t.Fatalf("Failed to list personas: %v", err)
+	}
+	if len(personas) != 2 {
+		t.Errorf("Expected 2 personas, got %d", len(personas))
+	}
+
+	// No persona is active until one is activated
+	active, err := storage.GetActivePersona(userID)
+	if err != nil || active != nil {
+		t.Errorf("Expected no active persona, got %v, %v", active, err)
+	}
+
+	// Test Activate deactivates the other personas of the user
+	if err := storage.ActivatePersona(userID, knight.ID); err != nil {
+		t.Fatalf("Failed to activate persona: %v", err)
+	}
+	if err := storage.ActivatePersona(userID, mage.ID); err != nil {
+		t.Fatalf("Failed to activate persona: %v", err)
+	}
+	active, err = storage.GetActivePersona(userID)
+	if err != nil || active == nil || active.ID != mage.ID {
+		t.Errorf("Expected persona %d to be active, got %v, %v", mage.ID, active, err)
+	}
+
+	// Personas of other users cannot be activated
+	if err := storage.ActivatePersona(userID, other.ID); err != ErrNotFound {
+		t.Errorf("Expected ErrNotFound activating another user's persona, got %v", err)
+	}
+
+	// Test Activate with ID 0 deactivates all personas
+	if err := storage.ActivatePersona(userID, 0); err != nil {
+		t.Fatalf("Failed to deactivate personas: %v", err)
+	}
+	if active, _ := storage.GetActivePersona(userID); active != nil {
+		t.Errorf("Expected no active persona, got %v", active)
+	}
+
+	// Test Update
+	knight.Description = "A brave knight"
+	if err := storage.UpdatePersona(knight); err != nil {
+		t.Fatalf("Failed to update persona: %v", err)
+	}
+	loaded, err := storage.GetPersona(knight.ID)
+	if err != nil {
+		t.Fatalf("Failed to get persona: %v", err)
+	}
+	if loaded.Description != "A brave knight" {
+		t.Errorf("Expected updated description, got %q", loaded.Description)
+	}
+
+	// Test Delete
+	if err := storage.DeletePersona(knight.ID); err != nil {
+		t.Fatalf("Failed to delete persona: %v", err)
+	}
+	if _, err := storage.GetPersona(knight.ID); err != ErrNotFound {
+		t.Errorf("Expected ErrNotFound after delete, got %v", err)
+	}
+}
+
 // TestGORMStorage_RegexPattern tests regex pattern CRUD operations
 func TestGORMStorage_RegexPattern(t *testing.T) {
 	dbPath := "./test_regex.db"
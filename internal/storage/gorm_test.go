@@ -241,6 +241,365 @@ func TestGORMStorage_CleanupExpired(t *testing.T) {
 	}
 }
 
+// TestGORMStorage_ResponseCache tests response cache operations
+func TestGORMStorage_ResponseCache(t *testing.T) {
+	tmpFile := "./test_response_cache.db"
+	defer os.Remove(tmpFile)
+
+	storage, err := NewStorage("", tmpFile)
+	if err != nil {
+		t.Fatalf("Failed to create storage: %v", err)
+	}
+	defer storage.Close()
+
+	// Missing key is a miss, not an error
+	_, found, err := storage.GetCachedResponse("missing")
+	if err != nil {
+		t.Fatalf("Failed to get cached response: %v", err)
+	}
+	if found {
+		t.Error("Expected cache miss for unknown key")
+	}
+
+	// Save and read back
+	if err := storage.SaveCachedResponse("key1", "hello", 3600); err != nil {
+		t.Fatalf("Failed to save cached response: %v", err)
+	}
+	response, found, err := storage.GetCachedResponse("key1")
+	if err != nil {
+		t.Fatalf("Failed to get cached response: %v", err)
+	}
+	if !found || response != "hello" {
+		t.Errorf("Expected cached response 'hello', got %q (found=%v)", response, found)
+	}
+
+	// Saving again overwrites the response
+	if err := storage.SaveCachedResponse("key1", "world", 3600); err != nil {
+		t.Fatalf("Failed to overwrite cached response: %v", err)
+	}
+	response, _, _ = storage.GetCachedResponse("key1")
+	if response != "world" {
+		t.Errorf("Expected overwritten response 'world', got %q", response)
+	}
+
+	// Expired entries are not returned and are removed by cleanup
+	if err := storage.SaveCachedResponse("key2", "stale", -1); err != nil {
+		t.Fatalf("Failed to save cached response: %v", err)
+	}
+	if _, found, _ := storage.GetCachedResponse("key2"); found {
+		t.Error("Expected expired cache entry to be a miss")
+	}
+	if err := storage.CleanupExpired(); err != nil {
+		t.Fatalf("Failed to cleanup: %v", err)
+	}
+	var count int64
+	storage.(*GORMStorage).db.Model(&ResponseCache{}).Where("cache_key = ?", "key2").Count(&count)
+	if count != 0 {
+		t.Errorf("Expected expired cache entry to be deleted, found %d", count)
+	}
+}
+
+// TestGORMStorage_UsageStats tests usage counters
+func TestGORMStorage_UsageStats(t *testing.T) {
+	tmpFile := "./test_usage_stats.db"
+	defer os.Remove(tmpFile)
+
+	storage, err := NewStorage("", tmpFile)
+	if err != nil {
+		t.Fatalf("Failed to create storage: %v", err)
+	}
+	defer storage.Close()
+
+	botID := int64(42)
+	for _, hit := range []bool{false, true, true} {
+		if err := storage.RecordUsage(botID, "openai", "gpt-4o-mini", hit); err != nil {
+			t.Fatalf("Failed to record usage: %v", err)
+		}
+	}
+	if err := storage.RecordUsage(botID, "anthropic", "claude-3-5-haiku-latest", false); err != nil {
+		t.Fatalf("Failed to record usage: %v", err)
+	}
+	if err := storage.RecordUsage(botID+1, "openai", "gpt-4o-mini", false); err != nil {
+		t.Fatalf("Failed to record usage: %v", err)
+	}
+
+	stats, err := storage.GetUsageStats(botID, time.Now())
+	if err != nil {
+		t.Fatalf("Failed to get usage stats: %v", err)
+	}
+	if len(stats) != 2 {
+		t.Fatalf("Expected 2 usage rows, got %d", len(stats))
+	}
+
+	// Ordered by provider
+	if stats[0].Provider != "anthropic" || stats[0].Requests != 1 || stats[0].CacheHits != 0 {
+		t.Errorf("Unexpected anthropic stats: %+v", stats[0])
+	}
+	if stats[1].Provider != "openai" || stats[1].Requests != 3 || stats[1].CacheHits != 2 {
+		t.Errorf("Unexpected openai stats: %+v", stats[1])
+	}
+
+	// Nothing recorded in the future
+	stats, err = storage.GetUsageStats(botID, time.Now().Add(48*time.Hour))
+	if err != nil {
+		t.Fatalf("Failed to get usage stats: %v", err)
+	}
+	if len(stats) != 0 {
+		t.Errorf("Expected no usage rows, got %d", len(stats))
+	}
+}
+
+// TestGORMStorage_TakeInlineQuota tests the persisted inline query quota
+func TestGORMStorage_TakeInlineQuota(t *testing.T) {
+	tmpFile := "./test_inline_quota.db"
+	defer os.Remove(tmpFile)
+
+	storage, err := NewStorage("", tmpFile)
+	if err != nil {
+		t.Fatalf("Failed to create storage: %v", err)
+	}
+	defer storage.Close()
+
+	botID, userID := int64(42), int64(7)
+	for i := 0; i < 2; i++ {
+		allowed, err := storage.TakeInlineQuota(botID, userID, 2)
+		if err != nil {
+			t.Fatalf("Failed to take inline quota: %v", err)
+		}
+		if !allowed {
+			t.Fatalf("Expected completion %d to be allowed", i+1)
+		}
+	}
+	if allowed, _ := storage.TakeInlineQuota(botID, userID, 2); allowed {
+		t.Error("Expected the completion beyond the limit to be refused")
+	}
+	if allowed, _ := storage.TakeInlineQuota(botID, userID+1, 2); !allowed {
+		t.Error("Expected another user's completion to be allowed")
+	}
+
+	// The counters of previous days are cleaned up
+	storage.(*GORMStorage).db.Model(&InlineUsage{}).Where("user_id = ?", userID).Update("date", "2000-01-01")
+	if err := storage.CleanupExpired(); err != nil {
+		t.Fatalf("Failed to cleanup: %v", err)
+	}
+	if allowed, _ := storage.TakeInlineQuota(botID, userID, 2); !allowed {
+		t.Error("Expected the quota to be reset on a new day")
+	}
+}
+
+// TestGORMStorage_Conversations tests archiving, restoring and deleting conversations
+func TestGORMStorage_Conversations(t *testing.T) {
+	tmpFile := "./test_conversations.db"
+	defer os.Remove(tmpFile)
+
+	storage, err := NewStorage("", tmpFile)
+	if err != nil {
+		t.Fatalf("Failed to create storage: %v", err)
+	}
+	defer storage.Close()
+
+	ctx := &SessionContext{ChatID: 123, BotID: 456}
+	other := &SessionContext{ChatID: 789, BotID: 456}
+
+	// Archiving an empty session keeps nothing
+	if err := storage.ArchiveChatHistory(ctx); err != nil {
+		t.Fatalf("Failed to archive empty history: %v", err)
+	}
+	conversations, err := storage.ListConversations(ctx)
+	if err != nil {
+		t.Fatalf("Failed to list conversations: %v", err)
+	}
+	if len(conversations) != 0 {
+		t.Fatalf("Expected no conversations, got %d", len(conversations))
+	}
+
+	// Archive a first conversation and start a second one
+	first := []HistoryItem{{Role: "user", Content: "first"}, {Role: "assistant", Content: "one"}}
+	if err := storage.SaveChatHistory(ctx, first); err != nil {
+		t.Fatalf("Failed to save history: %v", err)
+	}
+	if err := storage.ArchiveChatHistory(ctx); err != nil {
+		t.Fatalf("Failed to archive history: %v", err)
+	}
+	history, err := storage.GetChatHistory(ctx)
+	if err != nil {
+		t.Fatalf("Failed to get history: %v", err)
+	}
+	if len(history) != 0 {
+		t.Errorf("Expected empty history after archiving, got %d items", len(history))
+	}
+
+	conversations, err = storage.ListConversations(ctx)
+	if err != nil {
+		t.Fatalf("Failed to list conversations: %v", err)
+	}
+	if len(conversations) != 1 {
+		t.Fatalf("Expected 1 conversation, got %d", len(conversations))
+	}
+	if others, _ := storage.ListConversations(other); len(others) != 0 {
+		t.Errorf("Expected no conversations in another session, got %d", len(others))
+	}
+	id := conversations[0].ID
+	if err := storage.UpdateConversationTitle(id, "First"); err != nil {
+		t.Fatalf("Failed to update title: %v", err)
+	}
+
+	second := []HistoryItem{{Role: "user", Content: "second"}}
+	if err := storage.SaveChatHistory(ctx, second); err != nil {
+		t.Fatalf("Failed to save history: %v", err)
+	}
+
+	// Conversations can only be restored in their own session
+	if err := storage.RestoreConversation(other, id); err != ErrNotFound {
+		t.Errorf("Expected ErrNotFound restoring in another session, got %v", err)
+	}
+
+	// Restoring swaps the conversation with the current history
+	if err := storage.RestoreConversation(ctx, id); err != nil {
+		t.Fatalf("Failed to restore conversation: %v", err)
+	}
+	history, err = storage.GetChatHistory(ctx)
+	if err != nil {
+		t.Fatalf("Failed to get history: %v", err)
+	}
+	if len(history) != 2 || history[0].Content != "first" {
+		t.Errorf("Expected the first conversation to be restored, got %+v", history)
+	}
+	conversations, err = storage.ListConversations(ctx)
+	if err != nil {
+		t.Fatalf("Failed to list conversations: %v", err)
+	}
+	if len(conversations) != 1 || conversations[0].ID == id {
+		t.Fatalf("Expected only the second conversation to be archived, got %+v", conversations)
+	}
+
+	// The title is kept when the conversation is archived again
+	if err := storage.ArchiveChatHistory(ctx); err != nil {
+		t.Fatalf("Failed to archive history: %v", err)
+	}
+	conversations, err = storage.ListConversations(ctx)
+	if err != nil {
+		t.Fatalf("Failed to list conversations: %v", err)
+	}
+	if len(conversations) != 2 || conversations[0].Title != "First" {
+		t.Fatalf("Expected the first conversation to be archived with its title, got %+v", conversations)
+	}
+
+	// Private chat conversations belong to the user
+	userConversations, err := storage.ListUserConversations(123)
+	if err != nil {
+		t.Fatalf("Failed to list user conversations: %v", err)
+	}
+	if len(userConversations) != 2 {
+		t.Errorf("Expected 2 user conversations, got %d", len(userConversations))
+	}
+
+	if err := storage.DeleteConversation(conversations[1].ID); err != nil {
+		t.Fatalf("Failed to delete conversation: %v", err)
+	}
+	if err := storage.DeleteConversation(conversations[1].ID); err != ErrNotFound {
+		t.Errorf("Expected ErrNotFound deleting twice, got %v", err)
+	}
+	if _, err := storage.GetConversation(conversations[1].ID); err != ErrNotFound {
+		t.Errorf("Expected ErrNotFound for a deleted conversation, got %v", err)
+	}
+	conversation, err := storage.GetConversation(conversations[0].ID)
+	if err != nil {
+		t.Fatalf("Failed to get conversation: %v", err)
+	}
+	if conversation.Title != "First" {
+		t.Errorf("Expected title First, got %q", conversation.Title)
+	}
+}
+
+// TestGORMStorage_Branches tests forking chat histories and listing the branch tree
+func TestGORMStorage_Branches(t *testing.T) {
+	tmpFile := "./test_branches.db"
+	defer os.Remove(tmpFile)
+
+	storage, err := NewStorage("", tmpFile)
+	if err != nil {
+		t.Fatalf("Failed to create storage: %v", err)
+	}
+	defer storage.Close()
+
+	ctx := &SessionContext{ChatID: 123, BotID: 456}
+
+	main := []HistoryItem{
+		{Role: "user", Content: "a"}, {Role: "assistant", Content: "b"},
+		{Role: "user", Content: "c"}, {Role: "assistant", Content: "d"},
+	}
+	if err := storage.SaveChatHistory(ctx, main); err != nil {
+		t.Fatalf("Failed to save history: %v", err)
+	}
+
+	// A conversation that was never forked has no branches
+	branches, err := storage.ListBranches(ctx)
+	if err != nil {
+		t.Fatalf("Failed to list branches: %v", err)
+	}
+	if len(branches) != 0 {
+		t.Fatalf("Expected no branches, got %d", len(branches))
+	}
+
+	// An unrelated archived conversation is not part of the tree
+	if err := storage.SaveChatHistory(ctx, []HistoryItem{{Role: "user", Content: "other"}}); err != nil {
+		t.Fatalf("Failed to save history: %v", err)
+	}
+	if err := storage.ArchiveChatHistory(ctx); err != nil {
+		t.Fatalf("Failed to archive history: %v", err)
+	}
+	if err := storage.SaveChatHistory(ctx, main); err != nil {
+		t.Fatalf("Failed to save history: %v", err)
+	}
+
+	// Fork twice from the first reply
+	for i := 0; i < 2; i++ {
+		if err := storage.ForkChatHistory(ctx, main[:2]); err != nil {
+			t.Fatalf("Failed to fork history: %v", err)
+		}
+		if i == 0 {
+			history, err := storage.GetChatHistory(ctx)
+			if err != nil {
+				t.Fatalf("Failed to get history: %v", err)
+			}
+			if len(history) != 2 {
+				t.Fatalf("Expected the branch history, got %d items", len(history))
+			}
+		}
+	}
+
+	branches, err = storage.ListBranches(ctx)
+	if err != nil {
+		t.Fatalf("Failed to list branches: %v", err)
+	}
+	if len(branches) != 3 {
+		t.Fatalf("Expected 3 branches, got %d", len(branches))
+	}
+	current, root, first := branches[0], branches[1], branches[2]
+	if !current.Current || current.ID != 0 || current.Messages != 2 || current.Prompt != "a" {
+		t.Errorf("Unexpected current branch: %+v", current)
+	}
+	if root.ParentKey != "" || root.Messages != 4 || root.Prompt != "c" || root.ID == 0 {
+		t.Errorf("Unexpected root branch: %+v", root)
+	}
+	if first.ParentKey != root.Key || current.ParentKey != first.Key {
+		t.Errorf("Expected root -> first branch -> current, got %+v %+v %+v", root, first, current)
+	}
+
+	// Restoring the root keeps the tree
+	if err := storage.RestoreConversation(ctx, root.ID); err != nil {
+		t.Fatalf("Failed to restore conversation: %v", err)
+	}
+	branches, err = storage.ListBranches(ctx)
+	if err != nil {
+		t.Fatalf("Failed to list branches: %v", err)
+	}
+	if len(branches) != 3 || !branches[0].Current || branches[0].Key != root.Key {
+		t.Errorf("Expected the root to be current in the same tree, got %+v", branches)
+	}
+}
+
 // TestGORMStorage_SessionContext tests session context handling
 func TestGORMStorage_SessionContext(t *testing.T) {
 	tmpFile := "./test_session.db"
@@ -296,3 +655,94 @@ func TestGORMStorage_SessionContext(t *testing.T) {
 		t.Error("Expected separate histories for different contexts")
 	}
 }
+
+// TestGORMStorage_NextWorldInfoTurn tests that the world info turn counter counts per session
+func TestGORMStorage_NextWorldInfoTurn(t *testing.T) {
+	tmpFile := "./test_world_info_turns.db"
+	defer os.Remove(tmpFile)
+
+	storage, err := NewStorage("", tmpFile)
+	if err != nil {
+		t.Fatalf("Failed to create storage: %v", err)
+	}
+	defer storage.Close()
+
+	threadID := int64(7)
+	ctx := &SessionContext{ChatID: 123, BotID: 456}
+	topic := &SessionContext{ChatID: 123, BotID: 456, ThreadID: &threadID}
+
+	for want := 1; want <= 3; want++ {
+		turn, err := storage.NextWorldInfoTurn(ctx)
+		if err != nil {
+			t.Fatalf("Failed to advance turn: %v", err)
+		}
+		if turn != want {
+			t.Errorf("Expected turn %d, got %d", want, turn)
+		}
+	}
+
+	// Each session has its own counter
+	turn, err := storage.NextWorldInfoTurn(topic)
+	if err != nil {
+		t.Fatalf("Failed to advance turn: %v", err)
+	}
+	if turn != 1 {
+		t.Errorf("Expected turn 1 for another session, got %d", turn)
+	}
+}
+
+// TestGORMStorage_WorldInfoEffects tests that the timed world info effects are kept per session
+func TestGORMStorage_WorldInfoEffects(t *testing.T) {
+	tmpFile := "./test_world_info_effects.db"
+	defer os.Remove(tmpFile)
+
+	storage, err := NewStorage("", tmpFile)
+	if err != nil {
+		t.Fatalf("Failed to create storage: %v", err)
+	}
+	defer storage.Close()
+
+	userID := int64(789)
+	ctx := &SessionContext{ChatID: 123, BotID: 456}
+	other := &SessionContext{ChatID: 123, BotID: 456, UserID: &userID}
+
+	effects := []*WorldInfoEffect{
+		{EntryID: 1, Type: "sticky", Start: 2, End: 5},
+		{EntryID: 2, Type: "cooldown", Start: 2, End: 4},
+	}
+	if err := storage.SaveWorldInfoEffects(ctx, effects); err != nil {
+		t.Fatalf("Failed to save effects: %v", err)
+	}
+	if err := storage.SaveWorldInfoEffects(other, []*WorldInfoEffect{{EntryID: 3, Type: "sticky", Start: 0, End: 2}}); err != nil {
+		t.Fatalf("Failed to save effects: %v", err)
+	}
+
+	loaded, err := storage.GetWorldInfoEffects(ctx)
+	if err != nil {
+		t.Fatalf("Failed to get effects: %v", err)
+	}
+	if len(loaded) != 2 || loaded[0].EntryID != 1 || loaded[0].End != 5 || loaded[1].Type != "cooldown" {
+		t.Fatalf("Unexpected effects: %+v", loaded)
+	}
+
+	// Saving replaces the effects of the session only
+	if err := storage.SaveWorldInfoEffects(ctx, loaded[:1]); err != nil {
+		t.Fatalf("Failed to save effects: %v", err)
+	}
+	loaded, _ = storage.GetWorldInfoEffects(ctx)
+	if len(loaded) != 1 || loaded[0].EntryID != 1 {
+		t.Errorf("Expected the sticky effect only, got %+v", loaded)
+	}
+	loaded, _ = storage.GetWorldInfoEffects(other)
+	if len(loaded) != 1 || loaded[0].EntryID != 3 {
+		t.Errorf("Expected the effect of the other session to be kept, got %+v", loaded)
+	}
+
+	if err := storage.SaveWorldInfoEffects(ctx, nil); err != nil {
+		t.Fatalf("Failed to clear effects: %v", err)
+	}
+	loaded, _ = storage.GetWorldInfoEffects(ctx)
+	if len(loaded) != 0 {
+		t.Errorf("Expected no effects, got %+v", loaded)
+	}
+}
@@ -20,6 +20,13 @@ type ChatHistory struct {
 	UserID   *int64 `gorm:"index:idx_chat_history_session,priority:3"` // Nullable for shared mode
 	ThreadID *int64 `gorm:"index:idx_chat_history_session,priority:4"` // Nullable for non-forum chats
 
+	// Title of a restored conversation, kept when it is archived again
+	Title string `gorm:"size:255"`
+
+	// Branch tree: the conversation's key and the key of the conversation it was forked from
+	BranchKey string `gorm:"size:32;index"`
+	ParentKey string `gorm:"size:32"`
+
 	// Data stored as JSON text
 	History string `gorm:"type:text;not null"`
 }
@@ -29,6 +36,36 @@ func (ChatHistory) TableName() string {
 	return "chat_histories"
 }
 
+// Conversation represents an archived conversation of a session
+// GORM will automatically handle SQL injection prevention through parameterized queries
+type Conversation struct {
+	ID        uint      `gorm:"primarykey"`
+	CreatedAt time.Time `gorm:"index"`
+	UpdatedAt time.Time
+	DeletedAt gorm.DeletedAt `gorm:"index"`
+
+	// Session identifiers, the same as the ChatHistory the conversation was archived from
+	ChatID   int64  `gorm:"not null;index:idx_conversation_session,priority:1"`
+	BotID    int64  `gorm:"not null;index:idx_conversation_session,priority:2"`
+	UserID   *int64 `gorm:"index:idx_conversation_session,priority:3"`
+	ThreadID *int64 `gorm:"index:idx_conversation_session,priority:4"`
+
+	// Title generated from the conversation when it is archived by /new or /start, empty until then
+	Title string `gorm:"size:255"`
+
+	// Branch tree, the same as the ChatHistory the conversation was archived from
+	BranchKey string `gorm:"size:32;index"`
+	ParentKey string `gorm:"size:32"`
+
+	// Data stored as JSON text
+	History string `gorm:"type:text;not null"`
+}
+
+// TableName specifies the table name for Conversation
+func (Conversation) TableName() string {
+	return "conversations"
+}
+
 // UserConfiguration represents the user configuration table
 // GORM will automatically handle SQL injection prevention through parameterized queries
 type UserConfiguration struct {
@@ -113,9 +150,17 @@ type CharacterCard struct {
 	Name   string `gorm:"not null;index"`
 	Avatar string `gorm:"type:text"` // Avatar URL or base64
 
-	// SillyTavern V2 format data
+	// SillyTavern V2 or V3 format data
 	Data string `gorm:"type:text;not null"` // JSON format
 
+	// File format the card was imported from and is exported to: png, json or charx
+	Format string
+	// Files embedded in a CHARX card: JSON object of their path in the archive to their base64 content
+	Assets string `gorm:"type:text"`
+
+	// World book converted from the embedded character book, used in its place
+	WorldBookID *uint `gorm:"index"`
+
 	// Status
 	IsActive bool `gorm:"default:false;index"`
 }
@@ -173,9 +218,24 @@ type WorldBookEntry struct {
 	Constant  bool   `gorm:"default:false"`
 	Selective bool   `gorm:"default:false"`
 	Order     int    `gorm:"default:100"`
-	Position  string `gorm:"default:'after_char'"` // before_char, after_char
+	Position  string `gorm:"default:'after_char'"` // before_char, after_char, before_example, after_example, an_top, an_bottom, at_depth
+	Depth     int    `gorm:"default:0"`            // Messages from the end of the chat, for at_depth
+	Role      string `gorm:"default:'system'"`     // system, user, assistant, for at_depth
 	Enabled   bool   `gorm:"default:true;index"`
 
+	// Activation
+	SelectiveLogic   int  `gorm:"default:0"`     // 0 = AND ANY, 1 = NOT ALL, 2 = NOT ANY, 3 = AND ALL
+	Probability      int  `gorm:"default:0"`     // Chance of activation in percent
+	UseProbability   bool `gorm:"default:false"` // Whether Probability applies
+	ScanDepth        *int // Number of last messages scanned for keys, nil uses the global scan depth
+	ExcludeRecursion bool `gorm:"default:false"` // Not activated by the content of other entries
+	PreventRecursion bool `gorm:"default:false"` // Content does not activate other entries
+
+	// Timed effects, in number of chat messages
+	Sticky   int `gorm:"default:0"` // Stays active after activation
+	Cooldown int `gorm:"default:0"` // Cannot activate again after being active
+	Delay    int `gorm:"default:0"` // Cannot activate before the chat has as many messages
+
 	// Extensions
 	Extensions string `gorm:"type:text"` // JSON format
 }
@@ -185,6 +245,53 @@ func (WorldBookEntry) TableName() string {
 	return "world_book_entries"
 }
 
+// WorldInfoEffect is a sticky or cooldown effect of a world book entry in a session.
+// Its start and end are turns of the session's WorldInfoTurn: the effect lasts until turn End.
+type WorldInfoEffect struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+
+	// Session identifiers
+	ChatID   int64  `gorm:"not null;index:idx_world_info_effect_session,priority:1"`
+	BotID    int64  `gorm:"not null;index:idx_world_info_effect_session,priority:2"`
+	UserID   *int64 `gorm:"index:idx_world_info_effect_session,priority:3"`
+	ThreadID *int64 `gorm:"index:idx_world_info_effect_session,priority:4"`
+
+	// Effect
+	EntryID  uint   `gorm:"not null"`
+	EntryUID string `gorm:"size:255"`         // UID of entries that are not stored, with a zero EntryID
+	Type     string `gorm:"size:16;not null"` // sticky, cooldown
+	Start    int    `gorm:"not null"`
+	End      int    `gorm:"not null"`
+}
+
+// TableName specifies the table name for WorldInfoEffect
+func (WorldInfoEffect) TableName() string {
+	return "world_info_effects"
+}
+
+// WorldInfoTurn counts the turns of a session, the clock of its timed world info effects.
+// Unlike the length of the chat history, which is capped and shrinks on /redo or edits, it only increases.
+type WorldInfoTurn struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+
+	// Session identifiers
+	ChatID   int64  `gorm:"not null;index:idx_world_info_turn_session,priority:1"`
+	BotID    int64  `gorm:"not null;index:idx_world_info_turn_session,priority:2"`
+	UserID   *int64 `gorm:"index:idx_world_info_turn_session,priority:3"`
+	ThreadID *int64 `gorm:"index:idx_world_info_turn_session,priority:4"`
+
+	Turn int `gorm:"not null"`
+}
+
+// TableName specifies the table name for WorldInfoTurn
+func (WorldInfoTurn) TableName() string {
+	return "world_info_turns"
+}
+
 // Preset represents a SillyTavern preset
 // GORM will automatically handle SQL injection prevention through parameterized queries
 type Preset struct {
@@ -239,6 +346,30 @@ func (RegexPattern) TableName() string {
 	return "regex_patterns"
 }
 
+// Persona represents a user persona: the name and description of the user that characters know about
+// GORM will automatically handle SQL injection prevention through parameterized queries
+type Persona struct {
+	ID        uint      `gorm:"primarykey"`
+	CreatedAt time.Time `gorm:"index"`
+	UpdatedAt time.Time
+	DeletedAt gorm.DeletedAt `gorm:"index"`
+
+	// Owner information
+	UserID int64 `gorm:"not null;index"` // Telegram user ID
+
+	// Persona data
+	Name        string `gorm:"not null"`
+	Description string `gorm:"type:text"`
+
+	// Status
+	IsActive bool `gorm:"default:false;index"`
+}
+
+// TableName specifies the table name for Persona
+func (Persona) TableName() string {
+	return "personas"
+}
+
 // LoginToken represents a temporary login token for web manager
 // GORM will automatically handle SQL injection prevention through parameterized queries
 type LoginToken struct {
@@ -260,3 +391,68 @@ type LoginToken struct {
 func (LoginToken) TableName() string {
 	return "login_tokens"
 }
+
+// ResponseCache represents a cached LLM response for an identical prompt
+// GORM will automatically handle SQL injection prevention through parameterized queries
+type ResponseCache struct {
+	ID        uint      `gorm:"primarykey"`
+	CreatedAt time.Time `gorm:"index"`
+	UpdatedAt time.Time
+
+	// Cache key (hash of provider, model, prompt and sampling parameters)
+	CacheKey string `gorm:"size:64;not null;uniqueIndex"`
+
+	// Cached response text
+	Response string `gorm:"type:text;not null"`
+
+	// Expiration
+	ExpiresAt time.Time `gorm:"not null;index"`
+}
+
+// TableName specifies the table name for ResponseCache
+func (ResponseCache) TableName() string {
+	return "response_cache"
+}
+
+// UsageStat represents daily LLM request counters per bot, provider and model
+// GORM will automatically handle SQL injection prevention through parameterized queries
+type UsageStat struct {
+	ID        uint      `gorm:"primarykey"`
+	CreatedAt time.Time `gorm:"index"`
+	UpdatedAt time.Time
+
+	// Counter dimensions
+	BotID    int64  `gorm:"not null;uniqueIndex:idx_usage_stat"`
+	Date     string `gorm:"size:10;not null;uniqueIndex:idx_usage_stat"` // YYYY-MM-DD (UTC)
+	Provider string `gorm:"size:64;not null;uniqueIndex:idx_usage_stat"`
+	Model    string `gorm:"size:128;not null;uniqueIndex:idx_usage_stat"`
+
+	// Counters
+	Requests  int64 `gorm:"not null;default:0"`
+	CacheHits int64 `gorm:"not null;default:0"`
+}
+
+// TableName specifies the table name for UsageStat
+func (UsageStat) TableName() string {
+	return "usage_stats"
+}
+
+// InlineUsage represents the daily inline query completion counter of a user, for INLINE_QUERY_USER_LIMIT
+type InlineUsage struct {
+	ID        uint      `gorm:"primarykey"`
+	CreatedAt time.Time `gorm:"index"`
+	UpdatedAt time.Time
+
+	// Counter dimensions
+	BotID  int64  `gorm:"not null;uniqueIndex:idx_inline_usage"`
+	UserID int64  `gorm:"not null;uniqueIndex:idx_inline_usage"`
+	Date   string `gorm:"size:10;not null;uniqueIndex:idx_inline_usage"` // YYYY-MM-DD (UTC)
+
+	// Counter
+	Count int `gorm:"not null;default:0"`
+}
+
+// TableName specifies the table name for InlineUsage
+func (InlineUsage) TableName() string {
+	return "inline_usages"
+}
@@ -41,6 +41,16 @@ func TestSillyTavernModels_TableNames(t *testing.T) {
 			model:     LoginToken{},
 			wantTable: "login_tokens",
 		},
+		{
+			name:      "ResponseCache",
+			model:     ResponseCache{},
+			wantTable: "response_cache",
+		},
+		{
+			name:      "UsageStat",
+			model:     UsageStat{},
+			wantTable: "usage_stats",
+		},
 	}
 
 	for _, tt := range tests {
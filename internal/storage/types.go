@@ -1,6 +1,9 @@
 package storage
 
-import "errors"
+import (
+	"errors"
+	"time"
+)
 
 // Common errors
 var (
@@ -17,10 +20,14 @@ type SessionContext struct {
 
 // HistoryItem represents a single message in the conversation history
 type HistoryItem struct {
-	Role      string      `json:"role"`               // "user", "assistant", "system", "summary"
-	Content   interface{} `json:"content"`            // string or []ContentPart
-	Timestamp int64       `json:"timestamp,omitempty"` // Unix timestamp
-	Truncated bool        `json:"truncated,omitempty"` // Marks if this is a truncation point from /clear
+	Role       string        `json:"role"`                  // "user", "assistant", "system", "summary"
+	Content    interface{}   `json:"content"`               // string or []ContentPart
+	Timestamp  int64         `json:"timestamp,omitempty"`   // Unix timestamp
+	Truncated  bool          `json:"truncated,omitempty"`   // Marks if this is a truncation point from /clear
+	MessageIDs []int         `json:"message_ids,omitempty"` // Telegram messages showing an assistant reply
+	Swipes     []interface{} `json:"swipes,omitempty"`      // Alternative assistant replies of the turn, Content is the selected one
+	SwipeIndex int           `json:"swipe_id,omitempty"`    // Index of the selected alternative in Swipes
+	Name       string        `json:"name,omitempty"`        // Character speaking an assistant reply of a character group
 }
 
 // ContentPart represents a part of a message (text or image)
@@ -30,6 +37,19 @@ type ContentPart struct {
 	Image string `json:"image,omitempty"` // URL or base64
 }
 
+// Branch is a conversation of a branch tree: the current conversation of a session
+// or one of its archived conversations
+type Branch struct {
+	ID        uint   // Archived conversation ID, 0 for the current conversation
+	Key       string // Branch key of the conversation
+	ParentKey string // Branch key of the conversation it was forked from, empty for the root
+	Title     string
+	Messages  int    // Number of history items
+	Prompt    string // Text of the last user message
+	Current   bool
+	UpdatedAt time.Time
+}
+
 // UserConfig represents user-specific configuration
 type UserConfig struct {
 	DefineKeys []string               `json:"DEFINE_KEYS"`
@@ -53,6 +73,18 @@ type Storage interface {
 	GetChatHistory(ctx *SessionContext) ([]HistoryItem, error)
 	SaveChatHistory(ctx *SessionContext, history []HistoryItem) error
 	DeleteChatHistory(ctx *SessionContext) error
+	DeleteAllChatHistory() error
+
+	// Conversation Operations
+	ArchiveChatHistory(ctx *SessionContext) error
+	RestoreConversation(ctx *SessionContext, id uint) error
+	GetConversation(id uint) (*Conversation, error)
+	ListConversations(ctx *SessionContext) ([]*Conversation, error)
+	ListUserConversations(userID int64) ([]*Conversation, error)
+	UpdateConversationTitle(id uint, title string) error
+	DeleteConversation(id uint) error
+	ForkChatHistory(ctx *SessionContext, history []HistoryItem) error
+	ListBranches(ctx *SessionContext) ([]*Branch, error)
 
 	// User Config Operations
 	GetUserConfig(ctx *SessionContext) (*UserConfig, error)
@@ -90,6 +122,9 @@ type Storage interface {
 	ListWorldBookEntries(worldBookID uint) ([]*WorldBookEntry, error)
 	UpdateWorldBookEntry(entry *WorldBookEntry) error
 	DeleteWorldBookEntry(id uint) error
+	GetWorldInfoEffects(ctx *SessionContext) ([]*WorldInfoEffect, error)
+	SaveWorldInfoEffects(ctx *SessionContext, effects []*WorldInfoEffect) error
+	NextWorldInfoTurn(ctx *SessionContext) (int, error)
 
 	// Preset Operations
 	CreatePreset(preset *Preset) error
@@ -108,6 +143,15 @@ type Storage interface {
 	DeleteRegexPattern(id uint) error
 	UpdateRegexPatternStatus(id uint, enabled bool) error
 
+	// Persona Operations
+	CreatePersona(persona *Persona) error
+	GetPersona(id uint) (*Persona, error)
+	ListPersonas(userID int64) ([]*Persona, error)
+	UpdatePersona(persona *Persona) error
+	DeletePersona(id uint) error
+	GetActivePersona(userID int64) (*Persona, error)
+	ActivatePersona(userID int64, personaID uint) error
+
 	// Login Token Operations
 	CreateLoginToken(token *LoginToken) error
 	ValidateLoginToken(userID int64, token string) (bool, error)
@@ -115,6 +159,15 @@ type Storage interface {
 	CleanupExpiredTokens() error
 	UpdateWorldBookEntryStatus(id uint, enabled bool) error
 
+	// Response Cache Operations
+	GetCachedResponse(key string) (string, bool, error)
+	SaveCachedResponse(key string, response string, ttl int) error
+
+	// Usage Stats Operations
+	RecordUsage(botID int64, provider, model string, cacheHit bool) error
+	GetUsageStats(botID int64, since time.Time) ([]*UsageStat, error)
+	TakeInlineQuota(botID, userID int64, limit int) (bool, error)
+
 	// Maintenance
 	CleanupExpired() error
 	Close() error
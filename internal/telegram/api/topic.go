@@ -0,0 +1,259 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// telegram-bot-api v5.5.1 predates forum topics: it drops message_thread_id when decoding
+// messages and can't send it. Topics are tracked here by chat and message ID, and
+// InThread adds the parameter to outgoing requests.
+
+// maxTopicMessages bounds the number of messages whose topic is remembered
+const maxTopicMessages = 10000
+
+type topicKey struct {
+	chatID    int64
+	messageID int
+}
+
+// topicRegistry remembers the forum topic of recently received messages
+type topicRegistry struct {
+	mu      sync.Mutex
+	threads map[topicKey]int
+	order   []topicKey
+}
+
+var topics = &topicRegistry{threads: make(map[topicKey]int)}
+
+func (r *topicRegistry) set(key topicKey, threadID int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.threads[key]; !ok {
+		if len(r.order) >= maxTopicMessages {
+			delete(r.threads, r.order[0])
+			r.order = r.order[1:]
+		}
+		r.order = append(r.order, key)
+	}
+	r.threads[key] = threadID
+}
+
+func (r *topicRegistry) get(key topicKey) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.threads[key]
+}
+
+// SetMessageThreadID records the forum topic a message was sent in
+func SetMessageThreadID(message *tgbotapi.Message, threadID int) {
+	if message == nil || message.Chat == nil || threadID == 0 {
+		return
+	}
+	topics.set(topicKey{message.Chat.ID, message.MessageID}, threadID)
+}
+
+// MessageThreadID returns the forum topic a message was sent in, or 0 outside of topics
+func MessageThreadID(message *tgbotapi.Message) int {
+	if message == nil || message.Chat == nil {
+		return 0
+	}
+	return topics.get(topicKey{message.Chat.ID, message.MessageID})
+}
+
+// topicMessage holds the message fields that telegram-bot-api doesn't decode
+type topicMessage struct {
+	MessageID int `json:"message_id"`
+	Chat      struct {
+		ID int64 `json:"id"`
+	} `json:"chat"`
+	MessageThreadID int           `json:"message_thread_id"`
+	IsTopicMessage  bool          `json:"is_topic_message"`
+	ReplyToMessage  *topicMessage `json:"reply_to_message"`
+}
+
+// record remembers the topic of the message and of the message it replies to
+func (m *topicMessage) record() {
+	if m == nil {
+		return
+	}
+	if m.IsTopicMessage && m.MessageThreadID != 0 {
+		topics.set(topicKey{m.Chat.ID, m.MessageID}, m.MessageThreadID)
+	}
+	m.ReplyToMessage.record()
+}
+
+// DecodeUpdate decodes an update received from Telegram, recording the forum topic of its messages
+func DecodeUpdate(data []byte) (*tgbotapi.Update, error) {
+	var update tgbotapi.Update
+	if err := json.Unmarshal(data, &update); err != nil {
+		return nil, fmt.Errorf("failed to decode update: %w", err)
+	}
+
+	var raw struct {
+		Message           *topicMessage `json:"message"`
+		EditedMessage     *topicMessage `json:"edited_message"`
+		ChannelPost       *topicMessage `json:"channel_post"`
+		EditedChannelPost *topicMessage `json:"edited_channel_post"`
+		CallbackQuery     *struct {
+			Message *topicMessage `json:"message"`
+		} `json:"callback_query"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("failed to decode update: %w", err)
+	}
+	raw.Message.record()
+	raw.EditedMessage.record()
+	raw.ChannelPost.record()
+	raw.EditedChannelPost.record()
+	if raw.CallbackQuery != nil {
+		raw.CallbackQuery.Message.record()
+	}
+
+	return &update, nil
+}
+
+// threadMethods are the Bot API methods accepting message_thread_id
+var threadMethods = map[string]bool{
+	"sendMessage":    true,
+	"sendPhoto":      true,
+	"sendAudio":      true,
+	"sendDocument":   true,
+	"sendVideo":      true,
+	"sendAnimation":  true,
+	"sendVoice":      true,
+	"sendVideoNote":  true,
+	"sendMediaGroup": true,
+	"sendLocation":   true,
+	"sendVenue":      true,
+	"sendContact":    true,
+	"sendPoll":       true,
+	"sendDice":       true,
+	"sendSticker":    true,
+	"sendChatAction": true,
+	"copyMessage":    true,
+	"forwardMessage": true,
+}
+
+// InThread returns a copy of the client whose messages are sent to a forum topic.
+// A threadID of 0 returns the client itself.
+func (c *Client) InThread(threadID int) *Client {
+	if threadID == 0 || c.BotAPI == nil {
+		return c
+	}
+	base := c.BotAPI.Client
+	if tc, ok := base.(*threadHTTPClient); ok {
+		if tc.threadID == threadID {
+			return c
+		}
+		base = tc.base
+	}
+
+	bot := *c.BotAPI
+	bot.Client = &threadHTTPClient{base: base, threadID: threadID}
+	return &Client{BotAPI: &bot, apiDomain: c.apiDomain}
+}
+
+// ThreadID returns the forum topic the client sends to, or 0
+func (c *Client) ThreadID() int {
+	if c.BotAPI == nil {
+		return 0
+	}
+	if tc, ok := c.BotAPI.Client.(*threadHTTPClient); ok {
+		return tc.threadID
+	}
+	return 0
+}
+
+// threadHTTPClient adds message_thread_id to the requests of send methods
+type threadHTTPClient struct {
+	base     tgbotapi.HTTPClient
+	threadID int
+}
+
+func (c *threadHTTPClient) Do(req *http.Request) (*http.Response, error) {
+	if !threadMethods[path.Base(req.URL.Path)] || req.Body == nil {
+		return c.base.Do(req)
+	}
+
+	threadID := strconv.Itoa(c.threadID)
+	mediaType, params, _ := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	switch {
+	case mediaType == "application/x-www-form-urlencoded":
+		data, err := io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read request body: %w", err)
+		}
+		values, err := url.ParseQuery(string(data))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse request body: %w", err)
+		}
+		if values.Get("message_thread_id") == "" {
+			values.Set("message_thread_id", threadID)
+		}
+		body := values.Encode()
+		req.Body = io.NopCloser(strings.NewReader(body))
+		req.ContentLength = int64(len(body))
+		req.GetBody = func() (io.ReadCloser, error) {
+			return io.NopCloser(strings.NewReader(body)), nil
+		}
+	case strings.HasPrefix(mediaType, "multipart/"):
+		req.Body = addMultipartField(req.Body, params["boundary"], "message_thread_id", threadID)
+		req.ContentLength = -1
+		req.GetBody = nil
+	}
+	return c.base.Do(req)
+}
+
+// addMultipartField streams a multipart body with an extra field written before its parts
+func addMultipartField(body io.ReadCloser, boundary, name, value string) io.ReadCloser {
+	pr, pw := io.Pipe()
+	go func() {
+		defer body.Close()
+		reader := multipart.NewReader(body, boundary)
+		writer := multipart.NewWriter(pw)
+		if err := writer.SetBoundary(boundary); err != nil {
+			pw.CloseWithError(err)
+			return
+		}
+		if err := writer.WriteField(name, value); err != nil {
+			pw.CloseWithError(err)
+			return
+		}
+		for {
+			part, err := reader.NextRawPart()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				pw.CloseWithError(err)
+				return
+			}
+			if part.FormName() == name {
+				continue
+			}
+			dst, err := writer.CreatePart(part.Header)
+			if err == nil {
+				_, err = io.Copy(dst, part)
+			}
+			if err != nil {
+				pw.CloseWithError(err)
+				return
+			}
+		}
+		pw.CloseWithError(writer.Close())
+	}()
+	return pr
+}
@@ -0,0 +1,103 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"reflect"
+	"sync"
+	"testing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+func TestDecodeUpdate_RecordsTopic(t *testing.T) {
+	data := []byte(`{"update_id":1,"message":{"message_id":10,"message_thread_id":5,"is_topic_message":true,
+		"chat":{"id":-1001,"type":"supergroup","is_forum":true},"text":"hi",
+		"reply_to_message":{"message_id":5,"message_thread_id":5,"is_topic_message":true,"chat":{"id":-1001,"type":"supergroup"}}}}`)
+
+	update, err := DecodeUpdate(data)
+	if err != nil {
+		t.Fatalf("DecodeUpdate() error = %v", err)
+	}
+	if update.Message == nil || update.Message.Text != "hi" {
+		t.Fatalf("DecodeUpdate() message = %+v", update.Message)
+	}
+	if got := MessageThreadID(update.Message); got != 5 {
+		t.Errorf("MessageThreadID() = %d, want 5", got)
+	}
+	if got := MessageThreadID(update.Message.ReplyToMessage); got != 5 {
+		t.Errorf("MessageThreadID(reply) = %d, want 5", got)
+	}
+}
+
+func TestDecodeUpdate_ReplyThreadOutsideTopics(t *testing.T) {
+	// message_thread_id without is_topic_message is a reply thread, not a forum topic
+	data := []byte(`{"update_id":2,"message":{"message_id":11,"message_thread_id":3,
+		"chat":{"id":-1002,"type":"supergroup"},"text":"hi"}}`)
+
+	update, err := DecodeUpdate(data)
+	if err != nil {
+		t.Fatalf("DecodeUpdate() error = %v", err)
+	}
+	if got := MessageThreadID(update.Message); got != 0 {
+		t.Errorf("MessageThreadID() = %d, want 0", got)
+	}
+}
+
+// recordingServer records the method and message_thread_id parameter of each Bot API call
+func recordingServer(t *testing.T) (*httptest.Server, func() []string) {
+	var mu sync.Mutex
+	var calls []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseMultipartForm(1 << 20); err != nil {
+			r.ParseForm()
+		}
+		mu.Lock()
+		calls = append(calls, path.Base(r.URL.Path)+":"+r.FormValue("message_thread_id"))
+		mu.Unlock()
+		w.Write([]byte(`{"ok":true,"result":{"message_id":1,"chat":{"id":1}}}`))
+	}))
+	t.Cleanup(server.Close)
+	return server, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return calls
+	}
+}
+
+func TestClient_InThread(t *testing.T) {
+	server, calls := recordingServer(t)
+	client, err := NewClient("123:token", server.URL)
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+
+	topic := client.InThread(7)
+	if topic.ThreadID() != 7 || client.ThreadID() != 0 {
+		t.Fatalf("ThreadID() = %d and %d, want 7 and 0", topic.ThreadID(), client.ThreadID())
+	}
+	if client.InThread(0) != client || topic.InThread(7) != topic {
+		t.Error("InThread() should return the client itself when the topic doesn't change")
+	}
+
+	if _, err := topic.Send(tgbotapi.NewMessage(1, "hello")); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	photo := tgbotapi.NewPhoto(1, tgbotapi.FileBytes{Name: "a.png", Bytes: []byte("png")})
+	photo.Caption = "caption"
+	if _, err := topic.Send(photo); err != nil {
+		t.Fatalf("Send(photo) error = %v", err)
+	}
+	if _, err := topic.Request(tgbotapi.NewEditMessageText(1, 1, "edited")); err != nil {
+		t.Fatalf("Request(edit) error = %v", err)
+	}
+	if _, err := client.Send(tgbotapi.NewMessage(1, "general")); err != nil {
+		t.Fatalf("Send(general) error = %v", err)
+	}
+
+	want := []string{"sendMessage:7", "sendPhoto:7", "editMessageText:", "sendMessage:"}
+	if got := calls(); !reflect.DeepEqual(got, want) {
+		t.Errorf("calls = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,134 @@
+package command
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/tbxark/ChatGPT-Telegram-Workers/go_version/internal/config"
+	"github.com/tbxark/ChatGPT-Telegram-Workers/go_version/internal/i18n"
+	"github.com/tbxark/ChatGPT-Telegram-Workers/go_version/internal/storage"
+	"github.com/tbxark/ChatGPT-Telegram-Workers/go_version/internal/telegram/api"
+	"github.com/tbxark/ChatGPT-Telegram-Workers/go_version/internal/telegram/sender"
+)
+
+// BranchesCommand implements the /branches command
+// Shows the branch tree of the current conversation, with buttons switching to the other branches
+type BranchesCommand struct {
+	config *config.Config
+	i18n   *i18n.I18n
+}
+
+// NewBranchesCommand creates a new /branches command
+func NewBranchesCommand(cfg *config.Config, i18n *i18n.I18n) *BranchesCommand {
+	return &BranchesCommand{
+		config: cfg,
+		i18n:   i18n,
+	}
+}
+
+func (c *BranchesCommand) Name() string {
+	return "branches"
+}
+
+func (c *BranchesCommand) Description(lang string) string {
+	i18n := i18n.LoadI18n(lang)
+	return i18n.Command.Help.Branches
+}
+
+func (c *BranchesCommand) Scopes() []string {
+	return []string{"all_private_chats", "all_group_chats", "all_chat_administrators"}
+}
+
+func (c *BranchesCommand) NeedAuth() AuthChecker {
+	return NoAuthRequired
+}
+
+func (c *BranchesCommand) Handle(message *tgbotapi.Message, args string, ctx *config.WorkerContext) error {
+	client, ok := ctx.Bot.(*api.Client)
+	if !ok || client == nil {
+		return fmt.Errorf("bot client not available")
+	}
+	msgSender := sender.NewReplySender(client, message)
+
+	sessionCtx := NewSessionContext(message, ctx.ShareContext.BotID, c.config.GroupChatBotShareMode)
+	branches, err := ctx.DB.ListBranches(sessionCtx)
+	if err != nil {
+		return fmt.Errorf("failed to list branches: %w", err)
+	}
+	if len(branches) < 2 {
+		return msgSender.SendPlainText(c.i18n.Command.Branches.Empty)
+	}
+
+	// The tree is shown in the text; the buttons switch to the other branches
+	var lines []string
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for _, node := range branchTree(branches) {
+		label := c.branchLabel(node.branch)
+		indent := strings.Repeat("    ", node.depth)
+		if node.branch.Current {
+			lines = append(lines, indent+"▶ "+label)
+			continue
+		}
+		lines = append(lines, indent+"• "+label)
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(label, fmt.Sprintf("%s[%d]", ConversationSwitchPrefix, node.branch.ID)),
+		))
+	}
+
+	text := c.i18n.Command.Branches.Summary + "\n\n" + strings.Join(lines, "\n")
+	if err := msgSender.SendMessageWithKeyboard(text, tgbotapi.NewInlineKeyboardMarkup(rows...), ""); err != nil {
+		return fmt.Errorf("failed to send branches: %w", err)
+	}
+	return nil
+}
+
+// branchLabel returns the title and length of a branch; untitled branches show their last prompt
+func (c *BranchesCommand) branchLabel(branch *storage.Branch) string {
+	title := branch.Title
+	if title == "" {
+		title = truncateTitle(strings.Join(strings.Fields(branch.Prompt), " "))
+	}
+	if title == "" {
+		title = c.i18n.Command.Branches.Untitled
+	}
+	return fmt.Sprintf("%s (%d)", title, branch.Messages)
+}
+
+// branchNode is a branch at its depth in the tree
+type branchNode struct {
+	branch *storage.Branch
+	depth  int
+}
+
+// branchTree orders branches depth-first from the root, older branches first
+func branchTree(branches []*storage.Branch) []branchNode {
+	keys := make(map[string]bool, len(branches))
+	for _, branch := range branches {
+		keys[branch.Key] = true
+	}
+	children := make(map[string][]*storage.Branch)
+	var roots []*storage.Branch
+	for _, branch := range branches {
+		if branch.ParentKey == "" || !keys[branch.ParentKey] {
+			roots = append(roots, branch)
+		} else {
+			children[branch.ParentKey] = append(children[branch.ParentKey], branch)
+		}
+	}
+
+	var nodes []branchNode
+	var visit func(branches []*storage.Branch, depth int)
+	visit = func(branches []*storage.Branch, depth int) {
+		sort.SliceStable(branches, func(i, j int) bool {
+			return branches[i].UpdatedAt.Before(branches[j].UpdatedAt)
+		})
+		for _, branch := range branches {
+			nodes = append(nodes, branchNode{branch: branch, depth: depth})
+			visit(children[branch.Key], depth+1)
+		}
+	}
+	visit(roots, 0)
+	return nodes
+}
@@ -0,0 +1,32 @@
+package command
+
+import (
+	"testing"
+	"time"
+
+	"github.com/tbxark/ChatGPT-Telegram-Workers/go_version/internal/storage"
+)
+
+func TestBranchTree(t *testing.T) {
+	now := time.Now()
+	branches := []*storage.Branch{
+		{Key: "c", ParentKey: "a", Current: true, UpdatedAt: now},
+		{ID: 1, Key: "a", UpdatedAt: now.Add(-3 * time.Minute)},
+		{ID: 2, Key: "b", ParentKey: "a", UpdatedAt: now.Add(-2 * time.Minute)},
+		{ID: 3, Key: "d", ParentKey: "b", UpdatedAt: now.Add(-time.Minute)},
+	}
+
+	nodes := branchTree(branches)
+	want := []struct {
+		key   string
+		depth int
+	}{{"a", 0}, {"b", 1}, {"d", 2}, {"c", 1}}
+	if len(nodes) != len(want) {
+		t.Fatalf("Expected %d nodes, got %d", len(want), len(nodes))
+	}
+	for i, w := range want {
+		if nodes[i].branch.Key != w.key || nodes[i].depth != w.depth {
+			t.Errorf("Node %d: expected %s at depth %d, got %s at depth %d", i, w.key, w.depth, nodes[i].branch.Key, nodes[i].depth)
+		}
+	}
+}
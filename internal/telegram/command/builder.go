@@ -15,6 +15,8 @@ func BuildCommandRegistry(cfg *config.Config, i18n *i18n.I18n) *Registry {
 	registry.Register(NewStartCommand(cfg, i18n))
 	registry.Register(NewNewCommand(cfg, i18n))
 	registry.Register(NewRedoCommand(cfg, i18n))
+	registry.Register(NewChatsCommand(cfg, i18n))
+	registry.Register(NewBranchesCommand(cfg, i18n))
 
 	// Register help command (needs registry reference)
 	helpCmd := NewHelpCommand(cfg, i18n, registry)
@@ -25,6 +27,9 @@ func BuildCommandRegistry(cfg *config.Config, i18n *i18n.I18n) *Registry {
 	registry.Register(NewSetenvsCommand(cfg, i18n))
 	registry.Register(NewDelenvCommand(cfg, i18n))
 	registry.Register(NewClearenvCommand(cfg, i18n))
+	registry.Register(NewTriggerCommand(cfg, i18n))
+	registry.Register(NewTopicCommand(cfg, i18n))
+	registry.Register(NewPersonaCommand(cfg, i18n))
 
 	// Register system/debug commands
 	registry.Register(NewSystemCommand(cfg, i18n))
@@ -0,0 +1,78 @@
+package command
+
+import (
+	"html"
+	"log/slog"
+	"strings"
+
+	"github.com/tbxark/ChatGPT-Telegram-Workers/go_version/internal/config"
+	"github.com/tbxark/ChatGPT-Telegram-Workers/go_version/internal/sillytavern"
+	"github.com/tbxark/ChatGPT-Telegram-Workers/go_version/internal/storage"
+	"github.com/tbxark/ChatGPT-Telegram-Workers/go_version/internal/telegram/markdown"
+)
+
+// GroupMember is a character of the group bound to a forum topic or a chat with /topic group
+type GroupMember struct {
+	ID   uint
+	Data *sillytavern.CharacterCardV2
+}
+
+// Name returns the name of the character, which its replies are recorded under
+func (m GroupMember) Name() string {
+	return m.Data.Data.Name
+}
+
+// GroupMembers loads the character cards of a group in list order, leaving out the cards that cannot be loaded
+func GroupMembers(db storage.Storage, ids []uint) []GroupMember {
+	manager := sillytavern.NewCharacterCardManager(db)
+	members := make([]GroupMember, 0, len(ids))
+	for _, id := range ids {
+		card, err := db.GetCharacterCard(id)
+		if err != nil {
+			slog.Warn("Failed to load group character card", "card_id", id, "error", err)
+			continue
+		}
+		characterData, err := manager.ParseCardData(card.Data)
+		if err != nil {
+			slog.Warn("Invalid group character card", "card_id", id, "error", err)
+			continue
+		}
+		members = append(members, GroupMember{ID: id, Data: characterData})
+	}
+	return members
+}
+
+// FindGroupMember finds a member of a group by name, or returns nil
+func FindGroupMember(members []GroupMember, name string) *GroupMember {
+	for i := range members {
+		if members[i].Name() == name {
+			return &members[i]
+		}
+	}
+	return nil
+}
+
+// GroupNames returns the names of the members of a group, comma-separated, for the {{group}} macro
+func GroupNames(members []GroupMember) string {
+	names := make([]string, len(members))
+	for i, member := range members {
+		names[i] = member.Name()
+	}
+	return strings.Join(names, ", ")
+}
+
+// GroupNamePrefix returns the name of a character shown in bold before its messages in a group chat,
+// or an empty string when CHARACTER_GROUP_NAME_PREFIX is off
+func GroupNamePrefix(cfg *config.Config, name string) string {
+	if !cfg.CharacterGroupNamePrefix || name == "" {
+		return ""
+	}
+	switch cfg.DefaultParseMode {
+	case "HTML":
+		return "<b>" + html.EscapeString(name) + "</b>: "
+	case "Markdown":
+		return "**" + markdown.Escape(name) + "**: "
+	default:
+		return name + ": "
+	}
+}
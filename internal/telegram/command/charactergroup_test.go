@@ -0,0 +1,45 @@
+package command
+
+import (
+	"testing"
+
+	"github.com/tbxark/ChatGPT-Telegram-Workers/go_version/internal/config"
+	"github.com/tbxark/ChatGPT-Telegram-Workers/go_version/internal/sillytavern"
+)
+
+func TestGroupNamePrefix(t *testing.T) {
+	tests := []struct {
+		parseMode string
+		enabled   bool
+		want      string
+	}{
+		{"HTML", true, "<b>Aria &amp; Co.</b>: "},
+		{"Markdown", true, "**Aria \\& Co\\.**: "},
+		{"", true, "Aria & Co.: "},
+		{"HTML", false, ""},
+	}
+
+	for _, tt := range tests {
+		cfg := &config.Config{DefaultParseMode: tt.parseMode, CharacterGroupNamePrefix: tt.enabled}
+		if got := GroupNamePrefix(cfg, "Aria & Co."); got != tt.want {
+			t.Errorf("GroupNamePrefix(%q, %v) = %q, want %q", tt.parseMode, tt.enabled, got, tt.want)
+		}
+	}
+}
+
+func TestGroupMemberLookup(t *testing.T) {
+	members := []GroupMember{
+		{ID: 1, Data: &sillytavern.CharacterCardV2{Data: sillytavern.CharacterCardV2Data{Name: "Aria"}}},
+		{ID: 2, Data: &sillytavern.CharacterCardV2{Data: sillytavern.CharacterCardV2Data{Name: "Cleo"}}},
+	}
+
+	if names := GroupNames(members); names != "Aria, Cleo" {
+		t.Errorf("GroupNames() = %q, want %q", names, "Aria, Cleo")
+	}
+	if member := FindGroupMember(members, "Cleo"); member == nil || member.ID != 2 {
+		t.Errorf("FindGroupMember(Cleo) = %v, want the member with ID 2", member)
+	}
+	if member := FindGroupMember(members, "Bob"); member != nil {
+		t.Errorf("FindGroupMember(Bob) = %v, want nil", member)
+	}
+}
@@ -0,0 +1,248 @@
+package command
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/tbxark/ChatGPT-Telegram-Workers/go_version/internal/agent"
+	"github.com/tbxark/ChatGPT-Telegram-Workers/go_version/internal/config"
+	"github.com/tbxark/ChatGPT-Telegram-Workers/go_version/internal/i18n"
+	"github.com/tbxark/ChatGPT-Telegram-Workers/go_version/internal/storage"
+	"github.com/tbxark/ChatGPT-Telegram-Workers/go_version/internal/telegram/api"
+	"github.com/tbxark/ChatGPT-Telegram-Workers/go_version/internal/telegram/sender"
+)
+
+// Callback data prefixes of the /chats buttons, followed by the conversation ID as [id]
+const (
+	ConversationSwitchPrefix = "cs:"
+	ConversationDeletePrefix = "cd:"
+)
+
+const (
+	// maxListedConversations is the number of most recent conversations listed by /chats
+	maxListedConversations = 10
+
+	// titleContextMessages is the number of first messages of a conversation its title is generated from
+	titleContextMessages = 6
+
+	// titleMaxTokens limits the length of generated conversation titles
+	titleMaxTokens = 32
+
+	// titleTimeout bounds the request of a conversation title
+	titleTimeout = 30 * time.Second
+
+	// titlePrompt asks the model for the title of the conversation before it
+	titlePrompt = "Write a short title of at most six words for the conversation above, in its language. Reply with the title only, without quotes."
+)
+
+// ChatsCommand implements the /chats command
+// Lists the archived conversations of the session to switch to or delete them
+type ChatsCommand struct {
+	config *config.Config
+	i18n   *i18n.I18n
+}
+
+// NewChatsCommand creates a new /chats command
+func NewChatsCommand(cfg *config.Config, i18n *i18n.I18n) *ChatsCommand {
+	return &ChatsCommand{
+		config: cfg,
+		i18n:   i18n,
+	}
+}
+
+func (c *ChatsCommand) Name() string {
+	return "chats"
+}
+
+func (c *ChatsCommand) Description(lang string) string {
+	i18n := i18n.LoadI18n(lang)
+	return i18n.Command.Help.Chats
+}
+
+func (c *ChatsCommand) Scopes() []string {
+	return []string{"all_private_chats", "all_group_chats", "all_chat_administrators"}
+}
+
+func (c *ChatsCommand) NeedAuth() AuthChecker {
+	return NoAuthRequired
+}
+
+func (c *ChatsCommand) Handle(message *tgbotapi.Message, args string, ctx *config.WorkerContext) error {
+	client, ok := ctx.Bot.(*api.Client)
+	if !ok || client == nil {
+		return fmt.Errorf("bot client not available")
+	}
+	msgSender := sender.NewReplySender(client, message)
+
+	sessionCtx := NewSessionContext(message, ctx.ShareContext.BotID, c.config.GroupChatBotShareMode)
+	if err := ctx.LoadUserConfig(sessionCtx); err != nil {
+		slog.Error("Failed to load user config", "error", err)
+	}
+
+	conversations, err := ctx.DB.ListConversations(sessionCtx)
+	if err != nil {
+		return fmt.Errorf("failed to list conversations: %w", err)
+	}
+	if len(conversations) > maxListedConversations {
+		conversations = conversations[:maxListedConversations]
+	}
+
+	text, keyboard := ConversationList(conversations, c.i18n)
+	if keyboard == nil {
+		return msgSender.SendPlainText(text)
+	}
+	if err := msgSender.SendMessageWithKeyboard(text, *keyboard, ""); err != nil {
+		return fmt.Errorf("failed to send conversation list: %w", err)
+	}
+	return nil
+}
+
+// titleArchivedConversation generates the title of the conversation a session was just archived to, in the
+// background: /chats lists the conversation by its archive date until it has a title
+func titleArchivedConversation(sessionCtx *storage.SessionContext, ctx *config.WorkerContext, cfg *config.Config) {
+	conversations, err := ctx.DB.ListConversations(sessionCtx)
+	if err != nil {
+		slog.Warn("Failed to list conversations", "error", err)
+		return
+	}
+	if len(conversations) == 0 || conversations[0].Title != "" {
+		return
+	}
+	conversation := conversations[0]
+
+	db := ctx.DB
+	userConfig := ctx.UserConfig
+	if userConfig != nil {
+		cfg = config.MergeUserConfig(cfg, userConfig)
+	}
+	go func() {
+		title, err := generateTitle(conversation, cfg, userConfig)
+		if err != nil {
+			slog.Warn("Failed to generate conversation title", "error", err, "conversation", conversation.ID)
+			return
+		}
+		if err := db.UpdateConversationTitle(conversation.ID, title); err != nil {
+			slog.Warn("Failed to save conversation title", "error", err, "conversation", conversation.ID)
+		}
+	}()
+}
+
+// generateTitle asks the chat model for a short title of a conversation
+func generateTitle(conversation *storage.Conversation, cfg *config.Config, userConfig *storage.UserConfig) (string, error) {
+	history, err := conversationHistory(conversation)
+	if err != nil {
+		return "", err
+	}
+
+	var messages []agent.HistoryItem
+	for _, item := range history {
+		if item.Role != "user" && item.Role != "assistant" {
+			continue
+		}
+		if text := historyText(item.Content); text != "" {
+			messages = append(messages, agent.HistoryItem{Role: item.Role, Content: text})
+		}
+		if len(messages) == titleContextMessages {
+			break
+		}
+	}
+	if len(messages) == 0 {
+		return "", fmt.Errorf("conversation has no text")
+	}
+	messages = append(messages, agent.HistoryItem{Role: "user", Content: titlePrompt})
+
+	chatAgent, err := agent.LoadChatLLM(cfg, userConfig)
+	if err != nil {
+		return "", fmt.Errorf("failed to load chat agent: %w", err)
+	}
+
+	params := &agent.LLMChatParams{
+		Messages:  messages,
+		MaxTokens: titleMaxTokens,
+	}
+	requestCtx, cancel := context.WithTimeout(context.Background(), titleTimeout)
+	defer cancel()
+	response, err := chatAgent.Request(requestCtx, params, cfg, nil)
+	if err != nil {
+		return "", err
+	}
+
+	title := strings.Trim(strings.TrimSpace(response.Text()), "\"'“”「」")
+	if title == "" {
+		return "", fmt.Errorf("empty title")
+	}
+	return truncateTitle(title), nil
+}
+
+// ConversationList creates the text and buttons of the /chats list of the most recent conversations.
+// The keyboard is nil when there are no conversations.
+func ConversationList(conversations []*storage.Conversation, texts *i18n.I18n) (string, *tgbotapi.InlineKeyboardMarkup) {
+	if len(conversations) == 0 {
+		return texts.Command.Chats.Empty, nil
+	}
+	if len(conversations) > maxListedConversations {
+		conversations = conversations[:maxListedConversations]
+	}
+
+	rows := make([][]tgbotapi.InlineKeyboardButton, 0, len(conversations))
+	for _, conversation := range conversations {
+		id := fmt.Sprintf("[%d]", conversation.ID)
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("💬 "+ConversationTitle(conversation), ConversationSwitchPrefix+id),
+			tgbotapi.NewInlineKeyboardButtonData("🗑", ConversationDeletePrefix+id),
+		))
+	}
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(rows...)
+	return texts.Command.Chats.Summary, &keyboard
+}
+
+// ConversationTitle returns the title of a conversation, or its archive date until it has one
+func ConversationTitle(conversation *storage.Conversation) string {
+	if conversation.Title != "" {
+		return conversation.Title
+	}
+	return conversation.CreatedAt.Format("2006-01-02 15:04")
+}
+
+// conversationHistory decodes the history of an archived conversation
+func conversationHistory(conversation *storage.Conversation) ([]storage.HistoryItem, error) {
+	var history []storage.HistoryItem
+	if err := json.Unmarshal([]byte(conversation.History), &history); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal history: %w", err)
+	}
+	return history, nil
+}
+
+// historyText returns the text of the content of a history item, without its images
+func historyText(content interface{}) string {
+	switch v := content.(type) {
+	case string:
+		return v
+	case []interface{}:
+		var parts []string
+		for _, part := range v {
+			if m, ok := part.(map[string]interface{}); ok && m["type"] == "text" {
+				if text, ok := m["text"].(string); ok {
+					parts = append(parts, text)
+				}
+			}
+		}
+		return strings.Join(parts, "\n")
+	default:
+		return ""
+	}
+}
+
+// truncateTitle limits a title to the length of a button label
+func truncateTitle(title string) string {
+	const maxRunes = 48
+	if runes := []rune(title); len(runes) > maxRunes {
+		return string(runes[:maxRunes-1]) + "…"
+	}
+	return title
+}
@@ -0,0 +1,60 @@
+package command
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/tbxark/ChatGPT-Telegram-Workers/go_version/internal/i18n"
+	"github.com/tbxark/ChatGPT-Telegram-Workers/go_version/internal/storage"
+)
+
+func TestConversationList(t *testing.T) {
+	texts := i18n.LoadI18n("en")
+
+	text, keyboard := ConversationList(nil, texts)
+	if keyboard != nil || text != texts.Command.Chats.Empty {
+		t.Errorf("Expected the empty text without buttons, got %q", text)
+	}
+
+	var conversations []*storage.Conversation
+	for id := uint(1); id <= maxListedConversations+2; id++ {
+		conversations = append(conversations, &storage.Conversation{ID: id, Title: fmt.Sprintf("Chat %d", id)})
+	}
+	text, keyboard = ConversationList(conversations, texts)
+	if keyboard == nil || text != texts.Command.Chats.Summary {
+		t.Fatalf("Expected the summary with buttons, got %q", text)
+	}
+	if len(keyboard.InlineKeyboard) != maxListedConversations {
+		t.Fatalf("Expected %d rows, got %d", maxListedConversations, len(keyboard.InlineKeyboard))
+	}
+	row := keyboard.InlineKeyboard[0]
+	if row[0].Text != "💬 Chat 1" || *row[0].CallbackData != "cs:[1]" || *row[1].CallbackData != "cd:[1]" {
+		t.Errorf("Unexpected buttons: %q %q", row[0].Text, *row[0].CallbackData)
+	}
+}
+
+func TestHistoryText(t *testing.T) {
+	if got := historyText("hello"); got != "hello" {
+		t.Errorf("Expected hello, got %q", got)
+	}
+
+	parts := []interface{}{
+		map[string]interface{}{"type": "text", "text": "look"},
+		map[string]interface{}{"type": "image", "image": "https://example.com/a.jpg"},
+	}
+	if got := historyText(parts); got != "look" {
+		t.Errorf("Expected the text part only, got %q", got)
+	}
+}
+
+func TestTruncateTitle(t *testing.T) {
+	if got := truncateTitle("Short"); got != "Short" {
+		t.Errorf("Expected Short, got %q", got)
+	}
+
+	got := truncateTitle(strings.Repeat("標", 60))
+	if len([]rune(got)) != 48 || !strings.HasSuffix(got, "…") {
+		t.Errorf("Expected a 48 rune title ending with an ellipsis, got %q", got)
+	}
+}
@@ -57,7 +57,7 @@ func (c *ClearCommand) Handle(message *tgbotapi.Message, args string, ctx *confi
 	msg.ParseMode = c.config.DefaultParseMode
 
 	// Get bot instance
-	bot, ok := ctx.Bot.(*tgbotapi.BotAPI)
+	bot, ok := botAPI(ctx)
 	if !ok || bot == nil {
 		return fmt.Errorf("bot instance not available")
 	}
@@ -53,7 +53,7 @@ func (c *ClearAllChatCommand) NeedAuth() AuthChecker {
 
 func (c *ClearAllChatCommand) Handle(message *tgbotapi.Message, args string, ctx *config.WorkerContext) error {
 	// Get bot instance
-	bot, ok := ctx.Bot.(*tgbotapi.BotAPI)
+	bot, ok := botAPI(ctx)
 	if !ok || bot == nil {
 		return fmt.Errorf("bot instance not available")
 	}
@@ -76,12 +76,12 @@ func (c *SetenvCommand) Handle(message *tgbotapi.Message, args string, ctx *conf
 	}
 
 	// Send confirmation
-	text := fmt.Sprintf("?Configuration updated:\n`%s` = `%s`", key, value)
+	text := fmt.Sprintf("✅ Configuration updated:\n`%s` = `%s`", key, value)
 	msg := tgbotapi.NewMessage(message.Chat.ID, text)
 	msg.ParseMode = c.config.DefaultParseMode
 
 	// Get bot instance
-	bot, ok := ctx.Bot.(*tgbotapi.BotAPI)
+	bot, ok := botAPI(ctx)
 	if !ok || bot == nil {
 		return fmt.Errorf("bot instance not available")
 	}
@@ -165,13 +165,13 @@ func (c *SetenvsCommand) Handle(message *tgbotapi.Message, args string, ctx *con
 	// Build response
 	var sb strings.Builder
 	if len(updated) > 0 {
-		sb.WriteString("?Configuration updated:\n")
+		sb.WriteString("✅ Configuration updated:\n")
 		for _, key := range updated {
 			sb.WriteString(fmt.Sprintf("- `%s`\n", key))
 		}
 	}
 	if len(errors) > 0 {
-		sb.WriteString("\n?Errors:\n")
+		sb.WriteString("\n❌ Errors:\n")
 		for _, err := range errors {
 			sb.WriteString(fmt.Sprintf("- %s\n", err))
 		}
@@ -181,7 +181,7 @@ func (c *SetenvsCommand) Handle(message *tgbotapi.Message, args string, ctx *con
 	msg.ParseMode = c.config.DefaultParseMode
 
 	// Get bot instance
-	bot, ok := ctx.Bot.(*tgbotapi.BotAPI)
+	bot, ok := botAPI(ctx)
 	if !ok || bot == nil {
 		return fmt.Errorf("bot instance not available")
 	}
@@ -252,12 +252,12 @@ func (c *DelenvCommand) Handle(message *tgbotapi.Message, args string, ctx *conf
 	}
 
 	// Send confirmation
-	text := fmt.Sprintf("?Configuration deleted:\n`%s`", key)
+	text := fmt.Sprintf("✅ Configuration deleted:\n`%s`", key)
 	msg := tgbotapi.NewMessage(message.Chat.ID, text)
 	msg.ParseMode = c.config.DefaultParseMode
 
 	// Get bot instance
-	bot, ok := ctx.Bot.(*tgbotapi.BotAPI)
+	bot, ok := botAPI(ctx)
 	if !ok || bot == nil {
 		return fmt.Errorf("bot instance not available")
 	}
@@ -318,12 +318,12 @@ func (c *ClearenvCommand) Handle(message *tgbotapi.Message, args string, ctx *co
 	}
 
 	// Send confirmation
-	text := "?All user configuration cleared (locked keys preserved)"
+	text := "✅ All user configuration cleared (locked keys preserved)"
 	msg := tgbotapi.NewMessage(message.Chat.ID, text)
 	msg.ParseMode = c.config.DefaultParseMode
 
 	// Get bot instance
-	bot, ok := ctx.Bot.(*tgbotapi.BotAPI)
+	bot, ok := botAPI(ctx)
 	if !ok || bot == nil {
 		return fmt.Errorf("bot instance not available")
 	}
@@ -5,10 +5,13 @@ import (
 	"fmt"
 	"runtime"
 	"strings"
+	"time"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 	"github.com/tbxark/ChatGPT-Telegram-Workers/go_version/internal/config"
 	"github.com/tbxark/ChatGPT-Telegram-Workers/go_version/internal/i18n"
+	"github.com/tbxark/ChatGPT-Telegram-Workers/go_version/internal/storage"
+	"github.com/tbxark/ChatGPT-Telegram-Workers/go_version/internal/telegram/queue"
 )
 
 // SystemCommand implements the /system command
@@ -45,7 +48,7 @@ func (c *SystemCommand) NeedAuth() AuthChecker {
 func (c *SystemCommand) Handle(message *tgbotapi.Message, args string, ctx *config.WorkerContext) error {
 	var sb strings.Builder
 
-	sb.WriteString("🖥?System Information\n\n")
+	sb.WriteString("🖥️ System Information\n\n")
 
 	// Basic info
 	sb.WriteString("**Runtime:**\n")
@@ -62,8 +65,19 @@ func (c *SystemCommand) Handle(message *tgbotapi.Message, args string, ctx *conf
 	sb.WriteString(fmt.Sprintf("- Stream Mode: `%v`\n", c.config.StreamMode))
 	sb.WriteString(fmt.Sprintf("- Safe Mode: `%v`\n", c.config.SafeMode))
 	sb.WriteString(fmt.Sprintf("- Debug Mode: `%v`\n", c.config.DebugMode))
+	sb.WriteString(fmt.Sprintf("- Response Cache: `%v`\n", c.config.ResponseCacheEnabled))
 	sb.WriteString("\n")
 
+	// Usage stats
+	if ctx.DB != nil {
+		writeUsageStats(&sb, ctx.DB, ctx.ShareContext.BotID)
+	}
+
+	// Chat queue back-pressure
+	if stats, ok := ctx.Context["queue_stats"].(queue.Stats); ok {
+		writeQueueStats(&sb, stats)
+	}
+
 	// Additional info in DEV_MODE
 	if c.config.DevMode {
 		sb.WriteString("**Development Mode Info:**\n")
@@ -87,7 +101,7 @@ func (c *SystemCommand) Handle(message *tgbotapi.Message, args string, ctx *conf
 	msg.ParseMode = c.config.DefaultParseMode
 
 	// Get bot instance
-	bot, ok := ctx.Bot.(*tgbotapi.BotAPI)
+	bot, ok := botAPI(ctx)
 	if !ok || bot == nil {
 		return fmt.Errorf("bot instance not available")
 	}
@@ -99,6 +113,57 @@ func (c *SystemCommand) Handle(message *tgbotapi.Message, args string, ctx *conf
 	return nil
 }
 
+// writeQueueStats appends the chat queue metrics
+func writeQueueStats(sb *strings.Builder, stats queue.Stats) {
+	concurrency := "unlimited"
+	if stats.Concurrency > 0 {
+		concurrency = fmt.Sprintf("%d", stats.Concurrency)
+	}
+
+	sb.WriteString("**Chat Queue:**\n")
+	sb.WriteString(fmt.Sprintf("- Active Sessions: `%d` / `%s`\n", stats.Active, concurrency))
+	sb.WriteString(fmt.Sprintf("- Pending Messages: `%d`\n", stats.Pending))
+	sb.WriteString(fmt.Sprintf("- Processed: `%d`, Coalesced: `%d`, Rejected: `%d`\n", stats.Processed, stats.Coalesced, stats.Rejected))
+	sb.WriteString(fmt.Sprintf("- Wait: avg `%s`, max `%s`\n", stats.AvgWait.Round(time.Millisecond), stats.MaxWait.Round(time.Millisecond)))
+	sb.WriteString("\n")
+}
+
+// usageStatsDays is the number of days (including today) covered by /system usage stats
+const usageStatsDays = 7
+
+// writeUsageStats appends per-model request and cache hit totals for the last usageStatsDays days
+func writeUsageStats(sb *strings.Builder, db storage.Storage, botID int64) {
+	stats, err := db.GetUsageStats(botID, time.Now().AddDate(0, 0, -(usageStatsDays-1)))
+	if err != nil || len(stats) == 0 {
+		return
+	}
+
+	type usageTotal struct {
+		key       string
+		requests  int64
+		cacheHits int64
+	}
+	var totals []*usageTotal
+	index := make(map[string]*usageTotal)
+	for _, stat := range stats {
+		key := stat.Provider + "/" + stat.Model
+		total, ok := index[key]
+		if !ok {
+			total = &usageTotal{key: key}
+			index[key] = total
+			totals = append(totals, total)
+		}
+		total.requests += stat.Requests
+		total.cacheHits += stat.CacheHits
+	}
+
+	sb.WriteString(fmt.Sprintf("**Usage (last %d days):**\n", usageStatsDays))
+	for _, total := range totals {
+		sb.WriteString(fmt.Sprintf("- `%s`: %d requests, %d cache hits\n", total.key, total.requests, total.cacheHits))
+	}
+	sb.WriteString("\n")
+}
+
 // EchoCommand implements the /echo command (for debugging)
 type EchoCommand struct {
 	config *config.Config
@@ -150,7 +215,7 @@ func (c *EchoCommand) Handle(message *tgbotapi.Message, args string, ctx *config
 	msg.ParseMode = "Markdown"
 
 	// Get bot instance
-	bot, ok := ctx.Bot.(*tgbotapi.BotAPI)
+	bot, ok := botAPI(ctx)
 	if !ok || bot == nil {
 		return fmt.Errorf("bot instance not available")
 	}
@@ -0,0 +1,147 @@
+package command
+
+import (
+	"fmt"
+	"math/rand"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/tbxark/ChatGPT-Telegram-Workers/go_version/internal/config"
+	"github.com/tbxark/ChatGPT-Telegram-Workers/go_version/internal/sillytavern"
+	"github.com/tbxark/ChatGPT-Telegram-Workers/go_version/internal/storage"
+	"github.com/tbxark/ChatGPT-Telegram-Workers/go_version/internal/telegram/api"
+	"github.com/tbxark/ChatGPT-Telegram-Workers/go_version/internal/telegram/sender"
+)
+
+// ReplySwipePrefix is the callback data prefix of the buttons paging between the alternatives
+// of a reply, followed by the direction, [-1] or [1]
+const ReplySwipePrefix = "sw:"
+
+// SwipeRow creates the ◀ n/m ▶ buttons of a reply with several alternatives, or nil
+func SwipeRow(reply storage.HistoryItem) []tgbotapi.InlineKeyboardButton {
+	count := len(reply.Swipes)
+	if count < 2 {
+		return nil
+	}
+
+	var row []tgbotapi.InlineKeyboardButton
+	if reply.SwipeIndex > 0 {
+		row = append(row, tgbotapi.NewInlineKeyboardButtonData("◀", ReplySwipePrefix+"[-1]"))
+	}
+	counter := fmt.Sprintf("%d/%d", reply.SwipeIndex+1, count)
+	row = append(row, tgbotapi.NewInlineKeyboardButtonData(counter, ReplySwipePrefix+"[0]"))
+	if reply.SwipeIndex < count-1 {
+		row = append(row, tgbotapi.NewInlineKeyboardButtonData("▶", ReplySwipePrefix+"[1]"))
+	}
+	return row
+}
+
+// GreetingKeyboard creates the buttons of a character greeting, which can only be swiped
+// through the alternate greetings, or nil for a single greeting
+func GreetingKeyboard(greeting storage.HistoryItem) *tgbotapi.InlineKeyboardMarkup {
+	row := SwipeRow(greeting)
+	if row == nil {
+		return nil
+	}
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(row)
+	return &keyboard
+}
+
+// sendCharacterGreeting starts the conversation of a forum topic or a chat bound to a character card with
+// the card's first message, recorded as the first assistant turn. Alternate greetings are its swipes.
+// With a character group bound, every character greets in turn.
+// Unbound chats do not greet: only /topic bindings make the chat play a character, the active card of
+// the manager is not part of their prompt.
+func sendCharacterGreeting(message *tgbotapi.Message, sessionCtx *storage.SessionContext, ctx *config.WorkerContext, cfg *config.Config) error {
+	threadID := api.MessageThreadID(message)
+	topicConfig, err := ctx.DB.GetUserConfig(config.TopicSessionContext(message.Chat.ID, ctx.ShareContext.BotID, int64(threadID)))
+	if err != nil {
+		return fmt.Errorf("failed to load topic config: %w", err)
+	}
+	if ids := config.TopicGroupIDs(topicConfig); len(ids) > 0 {
+		return sendGroupGreetings(message, sessionCtx, ctx, cfg, GroupMembers(ctx.DB, ids))
+	}
+	id := config.TopicCharacterID(topicConfig)
+	if id == 0 {
+		return nil
+	}
+
+	card, err := ctx.DB.GetCharacterCard(id)
+	if err != nil {
+		return fmt.Errorf("failed to load character card: %w", err)
+	}
+	characterData, err := sillytavern.NewCharacterCardManager(ctx.DB).ParseCardData(card.Data)
+	if err != nil {
+		return err
+	}
+	macros := sillytavern.NewMacroContext(characterData, UserDisplayName(message.From), nil)
+	macros.SetPersona(ActivePersona(ctx.DB, message.From))
+	greetings := sillytavern.CharacterGreetings(characterData, macros)
+	if len(greetings) == 0 {
+		return nil
+	}
+
+	client, ok := ctx.Bot.(*api.Client)
+	if !ok || client == nil {
+		return fmt.Errorf("bot client not available")
+	}
+
+	greeting := storage.HistoryItem{Role: "assistant", Content: greetings[0]}
+	if len(greetings) > 1 {
+		for _, text := range greetings {
+			greeting.Swipes = append(greeting.Swipes, text)
+		}
+	}
+
+	msgSender := sender.NewReplySender(client, message)
+	msgSender.SetKeyboard(GreetingKeyboard(greeting))
+	if err := msgSender.SendRichText(greetings[0], cfg.DefaultParseMode); err != nil {
+		return fmt.Errorf("failed to send greeting: %w", err)
+	}
+	greeting.MessageIDs = msgSender.MessageIDs()
+
+	if err := ctx.DB.SaveChatHistory(sessionCtx, []storage.HistoryItem{greeting}); err != nil {
+		return fmt.Errorf("failed to save greeting: %w", err)
+	}
+	return nil
+}
+
+// sendGroupGreetings starts the conversation of a character group with a greeting of each character,
+// picked among its greetings and group-only greetings since the greetings of a group cannot be swiped
+func sendGroupGreetings(message *tgbotapi.Message, sessionCtx *storage.SessionContext, ctx *config.WorkerContext, cfg *config.Config, members []GroupMember) error {
+	client, ok := ctx.Bot.(*api.Client)
+	if !ok || client == nil {
+		return fmt.Errorf("bot client not available")
+	}
+
+	persona := ActivePersona(ctx.DB, message.From)
+	var history []storage.HistoryItem
+	for _, member := range members {
+		macros := sillytavern.NewMacroContext(member.Data, UserDisplayName(message.From), nil)
+		macros.SetPersona(persona)
+		macros.Group = GroupNames(members)
+		greetings := sillytavern.GroupGreetings(member.Data, macros)
+		if len(greetings) == 0 {
+			continue
+		}
+
+		greeting := greetings[rand.Intn(len(greetings))]
+		msgSender := sender.NewReplySender(client, message)
+		if err := msgSender.SendRichText(GroupNamePrefix(cfg, member.Name())+greeting, cfg.DefaultParseMode); err != nil {
+			return fmt.Errorf("failed to send greeting: %w", err)
+		}
+		history = append(history, storage.HistoryItem{
+			Role:       "assistant",
+			Content:    greeting,
+			Name:       member.Name(),
+			MessageIDs: msgSender.MessageIDs(),
+		})
+	}
+	if len(history) == 0 {
+		return nil
+	}
+
+	if err := ctx.DB.SaveChatHistory(sessionCtx, history); err != nil {
+		return fmt.Errorf("failed to save greeting: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,32 @@
+package command
+
+import (
+	"testing"
+
+	"github.com/tbxark/ChatGPT-Telegram-Workers/go_version/internal/storage"
+)
+
+func TestGreetingKeyboard(t *testing.T) {
+	greeting := storage.HistoryItem{Role: "assistant", Content: "Hello"}
+	if keyboard := GreetingKeyboard(greeting); keyboard != nil {
+		t.Errorf("GreetingKeyboard() = %v, want nil for a single greeting", keyboard)
+	}
+
+	greeting.Swipes = []interface{}{"Hello", "Hi", "Hey"}
+	greeting.SwipeIndex = 2
+	keyboard := GreetingKeyboard(greeting)
+	if keyboard == nil || len(keyboard.InlineKeyboard) != 1 {
+		t.Fatalf("GreetingKeyboard() = %v, want a single row of swipe buttons", keyboard)
+	}
+
+	var data []string
+	for _, button := range keyboard.InlineKeyboard[0] {
+		data = append(data, *button.CallbackData)
+	}
+	if len(data) != 2 || data[0] != "sw:[-1]" || data[1] != "sw:[0]" {
+		t.Errorf("GreetingKeyboard() buttons = %v, want [sw:[-1] sw:[0]]", data)
+	}
+	if text := keyboard.InlineKeyboard[0][1].Text; text != "3/3" {
+		t.Errorf("GreetingKeyboard() counter = %q, want 3/3", text)
+	}
+}
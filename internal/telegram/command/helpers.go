@@ -1,9 +1,14 @@
 package command
 
 import (
+	"log/slog"
+	"strings"
+
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 	"github.com/tbxark/ChatGPT-Telegram-Workers/go_version/internal/config"
+	"github.com/tbxark/ChatGPT-Telegram-Workers/go_version/internal/sillytavern"
 	"github.com/tbxark/ChatGPT-Telegram-Workers/go_version/internal/storage"
+	"github.com/tbxark/ChatGPT-Telegram-Workers/go_version/internal/telegram/api"
 )
 
 // NewSessionContext creates a SessionContext from a Telegram message
@@ -20,8 +25,55 @@ func NewSessionContext(message *tgbotapi.Message, botID int64, shareMode bool) *
 		userID = &uid
 	}
 
-	// Include thread ID for forum/topic messages
-	// Note: Forum features may not be available in all versions of telegram-bot-api
+	// Each forum topic keeps its own history and configuration
+	if id := api.MessageThreadID(message); id != 0 {
+		tid := int64(id)
+		threadID = &tid
+	}
 
 	return config.NewSessionContextFromChat(chatID, botID, isGroup, shareMode, userID, threadID)
 }
+
+// botAPI returns the Telegram Bot API instance stored in the worker context.
+// The bot is usually an *api.Client, which embeds *tgbotapi.BotAPI.
+func botAPI(ctx *config.WorkerContext) (*tgbotapi.BotAPI, bool) {
+	switch bot := ctx.Bot.(type) {
+	case *api.Client:
+		if bot == nil {
+			return nil, false
+		}
+		return bot.BotAPI, bot.BotAPI != nil
+	case *tgbotapi.BotAPI:
+		return bot, bot != nil
+	default:
+		return nil, false
+	}
+}
+
+// UserDisplayName returns the name a Telegram user is shown with: their first and last name,
+// or their username, or else the default user name of character prompts
+func UserDisplayName(user *tgbotapi.User) string {
+	if user == nil {
+		return sillytavern.DefaultUserName
+	}
+	if name := strings.TrimSpace(user.FirstName + " " + user.LastName); name != "" {
+		return name
+	}
+	if user.UserName != "" {
+		return user.UserName
+	}
+	return sillytavern.DefaultUserName
+}
+
+// ActivePersona returns the persona a Telegram user activated with /persona, or nil
+func ActivePersona(db storage.Storage, user *tgbotapi.User) *storage.Persona {
+	if user == nil || db == nil {
+		return nil
+	}
+	persona, err := db.GetActivePersona(user.ID)
+	if err != nil {
+		slog.Warn("Failed to load active persona", "user_id", user.ID, "error", err)
+		return nil
+	}
+	return persona
+}
@@ -2,10 +2,8 @@ package command
 
 import (
 	"context"
-	"encoding/base64"
 	"fmt"
-	"io"
-	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
@@ -49,9 +47,12 @@ func (c *ImgCommand) NeedAuth() AuthChecker {
 }
 
 func (c *ImgCommand) Handle(message *tgbotapi.Message, args string, ctx *config.WorkerContext) error {
-	// Check if prompt is provided
-	prompt := strings.TrimSpace(args)
-	if prompt == "" {
+	// Parse prompt and generation flags
+	params, err := parseImageArgs(args)
+	if err != nil {
+		return err
+	}
+	if params.Prompt == "" {
 		return fmt.Errorf("please provide an image description, e.g., /img beach at moonlight")
 	}
 
@@ -62,13 +63,7 @@ func (c *ImgCommand) Handle(message *tgbotapi.Message, args string, ctx *config.
 	}
 
 	// Create message sender
-	msgSender := sender.NewMessageSender(client, message.Chat.ID)
-
-	// Send "upload_photo" action
-	if err := msgSender.SendChatAction("upload_photo"); err != nil {
-		// Non-fatal, just log
-		fmt.Printf("Failed to send chat action: %v\n", err)
-	}
+	msgSender := sender.NewReplySender(client, message)
 
 	// Load image generation agent
 	sessionCtx := NewSessionContext(message, ctx.ShareContext.BotID, c.config.GroupChatBotShareMode)
@@ -82,72 +77,98 @@ func (c *ImgCommand) Handle(message *tgbotapi.Message, args string, ctx *config.
 		return fmt.Errorf("no image generation provider available: %w", err)
 	}
 
-	// Generate image with timeout
+	// Check the requested options against the provider's capabilities
+	if err := imageAgent.ValidateParams(params, c.config); err != nil {
+		return fmt.Errorf("invalid image options: %w", err)
+	}
+
+	// Send "upload_photo" action
+	if err := msgSender.SendChatAction("upload_photo"); err != nil {
+		// Non-fatal, just log
+		fmt.Printf("Failed to send chat action: %v\n", err)
+	}
+
+	// Generate images with timeout
 	ctxWithTimeout, cancel := context.WithTimeout(context.Background(), 60*time.Second)
 	defer cancel()
 
-	imageResult, err := imageAgent.Request(ctxWithTimeout, prompt, c.config)
+	result, err := imageAgent.Request(ctxWithTimeout, params, c.config)
 	if err != nil {
 		return fmt.Errorf("failed to generate image: %w", err)
 	}
-
-	// Send the image
-	if err := c.sendImage(msgSender, imageResult); err != nil {
-		return fmt.Errorf("failed to send image: %w", err)
-	}
-
-	return nil
-}
-
-// sendImage sends an image (URL or base64) to the user
-func (c *ImgCommand) sendImage(sender *sender.MessageSender, imageData string) error {
-	// Check if it's a URL or base64
-	if strings.HasPrefix(imageData, "http://") || strings.HasPrefix(imageData, "https://") {
-		// It's a URL - send directly
-		return sender.SendPhoto(imageData)
+	if len(result.Images) == 0 {
+		return fmt.Errorf("failed to generate image: no images returned")
 	}
 
-	// It's base64 - decode and send as bytes
-	// Remove data URL prefix if present
-	if strings.HasPrefix(imageData, "data:image/") {
-		parts := strings.SplitN(imageData, ",", 2)
-		if len(parts) == 2 {
-			imageData = parts[1]
+	// Send the images as an album, with the revised prompt as caption
+	photos := make([]tgbotapi.RequestFileData, 0, len(result.Images))
+	for i, image := range result.Images {
+		if image.URL != "" {
+			photos = append(photos, tgbotapi.FileURL(image.URL))
+		} else {
+			photos = append(photos, tgbotapi.FileBytes{
+				Name:  fmt.Sprintf("image_%d.png", i+1),
+				Bytes: image.Data,
+			})
 		}
 	}
 
-	// Decode base64
-	photoBytes, err := base64.StdEncoding.DecodeString(imageData)
-	if err != nil {
-		// If decoding fails, try to download as URL
-		return c.downloadAndSendImage(sender, imageData)
+	if _, err := msgSender.SendMediaGroup(photos, result.RevisedPrompt); err != nil {
+		return fmt.Errorf("failed to send image: %w", err)
 	}
 
-	// Send as bytes
-	return sender.SendPhotoBytes(photoBytes, "")
+	return nil
 }
 
-// downloadAndSendImage downloads an image from URL and sends it
-func (c *ImgCommand) downloadAndSendImage(sender *sender.MessageSender, imageURL string) error {
-	// Download the image
-	resp, err := http.Get(imageURL)
-	if err != nil {
-		return fmt.Errorf("failed to download image: %w", err)
-	}
-	defer resp.Body.Close()
+// maxImageCount is the upper bound for --n, matching the Telegram media group limit
+const maxImageCount = 10
+
+// parseImageArgs parses /img arguments of the form
+// "[--n 4] [--ar 16:9] [--size 1024x1024] [--quality hd] [--style natural] description".
+// Flags may appear anywhere and also accept the --flag=value form.
+func parseImageArgs(args string) (*agent.ImageGenParams, error) {
+	params := &agent.ImageGenParams{N: 1}
+	var promptParts []string
+
+	fields := strings.Fields(args)
+	for i := 0; i < len(fields); i++ {
+		field := fields[i]
+		if !strings.HasPrefix(field, "--") {
+			promptParts = append(promptParts, field)
+			continue
+		}
 
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("failed to download image: status %d", resp.StatusCode)
-	}
+		name, value, hasValue := strings.Cut(strings.TrimPrefix(field, "--"), "=")
+		if !hasValue {
+			if i+1 >= len(fields) {
+				return nil, fmt.Errorf("missing value for --%s", name)
+			}
+			i++
+			value = fields[i]
+		}
 
-	// Read image data
-	photoBytes, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return fmt.Errorf("failed to read image data: %w", err)
+		switch strings.ToLower(name) {
+		case "n":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 || n > maxImageCount {
+				return nil, fmt.Errorf("--n must be a number between 1 and %d", maxImageCount)
+			}
+			params.N = n
+		case "ar", "aspect":
+			params.AspectRatio = value
+		case "size":
+			params.Size = strings.ToLower(value)
+		case "quality":
+			params.Quality = strings.ToLower(value)
+		case "style":
+			params.Style = strings.ToLower(value)
+		default:
+			return nil, fmt.Errorf("unknown option --%s (supported: --n, --ar, --size, --quality, --style)", name)
+		}
 	}
 
-	// Send as bytes
-	return sender.SendPhotoBytes(photoBytes, "")
+	params.Prompt = strings.Join(promptParts, " ")
+	return params, nil
 }
 
 // ModelsCommand implements the /models command for model switching
@@ -189,7 +210,7 @@ func (c *ModelsCommand) Handle(message *tgbotapi.Message, args string, ctx *conf
 	}
 
 	// Create message sender
-	msgSender := sender.NewMessageSender(client, message.Chat.ID)
+	msgSender := sender.NewReplySender(client, message)
 
 	// Load user config to get current model
 	sessionCtx := NewSessionContext(message, ctx.ShareContext.BotID, c.config.GroupChatBotShareMode)
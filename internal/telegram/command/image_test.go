@@ -114,3 +114,74 @@ func TestImgCommand_Handle_EmptyPrompt(t *testing.T) {
 		t.Error("Expected error for empty prompt, got nil")
 	}
 }
+
+func TestParseImageArgs(t *testing.T) {
+	tests := []struct {
+		name        string
+		args        string
+		wantPrompt  string
+		wantN       int
+		wantAR      string
+		wantSize    string
+		wantQuality string
+		wantStyle   string
+		wantErr     bool
+	}{
+		{name: "prompt only", args: "beach at moonlight", wantPrompt: "beach at moonlight", wantN: 1},
+		{name: "leading flags", args: "--n 4 --ar 16:9 beach at moonlight", wantPrompt: "beach at moonlight", wantN: 4, wantAR: "16:9"},
+		{name: "trailing flags", args: "a red fox --quality HD --style natural", wantPrompt: "a red fox", wantN: 1, wantQuality: "hd", wantStyle: "natural"},
+		{name: "equals form", args: "--n=2 --size=1024x1792 city", wantPrompt: "city", wantN: 2, wantSize: "1024x1792"},
+		{name: "n out of range", args: "--n 11 city", wantErr: true},
+		{name: "n not a number", args: "--n four city", wantErr: true},
+		{name: "missing value", args: "city --ar", wantErr: true},
+		{name: "unknown flag", args: "--seed 42 city", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			params, err := parseImageArgs(tt.args)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("Expected error for args %q, got nil", tt.args)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if params.Prompt != tt.wantPrompt {
+				t.Errorf("Prompt = %q, want %q", params.Prompt, tt.wantPrompt)
+			}
+			if params.N != tt.wantN {
+				t.Errorf("N = %d, want %d", params.N, tt.wantN)
+			}
+			if params.AspectRatio != tt.wantAR {
+				t.Errorf("AspectRatio = %q, want %q", params.AspectRatio, tt.wantAR)
+			}
+			if params.Size != tt.wantSize {
+				t.Errorf("Size = %q, want %q", params.Size, tt.wantSize)
+			}
+			if params.Quality != tt.wantQuality {
+				t.Errorf("Quality = %q, want %q", params.Quality, tt.wantQuality)
+			}
+			if params.Style != tt.wantStyle {
+				t.Errorf("Style = %q, want %q", params.Style, tt.wantStyle)
+			}
+		})
+	}
+}
+
+func TestImgCommand_Handle_FlagsWithoutPrompt(t *testing.T) {
+	cfg := &config.Config{}
+	i18n := i18n.LoadI18n("en")
+	cmd := NewImgCommand(cfg, i18n)
+
+	message := &tgbotapi.Message{
+		Chat: &tgbotapi.Chat{ID: 123},
+		From: &tgbotapi.User{ID: 456},
+	}
+
+	if err := cmd.Handle(message, "--n 2 --ar 16:9", &config.WorkerContext{}); err == nil {
+		t.Error("Expected error when only flags are provided, got nil")
+	}
+}
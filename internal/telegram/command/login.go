@@ -43,10 +43,10 @@ func (c *LoginCommand) NeedAuth() AuthChecker {
 func (c *LoginCommand) Handle(message *tgbotapi.Message, args string, ctx *config.WorkerContext) error {
 	// 1. Check if this is a private chat
 	if !message.Chat.IsPrivate() {
-		msg := tgbotapi.NewMessage(message.Chat.ID, "?此命令仅支持私聊使用")
+		msg := tgbotapi.NewMessage(message.Chat.ID, "❌ 此命令仅支持私聊使用")
 		msg.ParseMode = c.config.DefaultParseMode
 
-		bot, ok := ctx.Bot.(*tgbotapi.BotAPI)
+		bot, ok := botAPI(ctx)
 		if !ok || bot == nil {
 			return fmt.Errorf("bot instance not available")
 		}
@@ -84,7 +84,7 @@ func (c *LoginCommand) Handle(message *tgbotapi.Message, args string, ctx *confi
 			"用户名：`%d`\n"+
 			"密码：`%s`\n"+
 			"有效期：24小时\n\n"+
-			"请使用这些凭证登?Web 管理器?,
+			"请使用这些凭证登录 Web 管理器。",
 		userID,
 		token,
 	)
@@ -92,7 +92,7 @@ func (c *LoginCommand) Handle(message *tgbotapi.Message, args string, ctx *confi
 	msg := tgbotapi.NewMessage(message.Chat.ID, responseText)
 	msg.ParseMode = "Markdown"
 
-	bot, ok := ctx.Bot.(*tgbotapi.BotAPI)
+	bot, ok := botAPI(ctx)
 	if !ok || bot == nil {
 		return fmt.Errorf("bot instance not available")
 	}
@@ -0,0 +1,184 @@
+package command
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/tbxark/ChatGPT-Telegram-Workers/go_version/internal/config"
+	"github.com/tbxark/ChatGPT-Telegram-Workers/go_version/internal/i18n"
+	"github.com/tbxark/ChatGPT-Telegram-Workers/go_version/internal/storage"
+	"github.com/tbxark/ChatGPT-Telegram-Workers/go_version/internal/telegram/api"
+	"github.com/tbxark/ChatGPT-Telegram-Workers/go_version/internal/telegram/sender"
+)
+
+// PersonaCommand implements the /persona command
+// Manages the personas of the user: the name and description characters know them by
+type PersonaCommand struct {
+	config *config.Config
+	i18n   *i18n.I18n
+}
+
+// NewPersonaCommand creates a new /persona command
+func NewPersonaCommand(cfg *config.Config, i18n *i18n.I18n) *PersonaCommand {
+	return &PersonaCommand{
+		config: cfg,
+		i18n:   i18n,
+	}
+}
+
+func (c *PersonaCommand) Name() string {
+	return "persona"
+}
+
+func (c *PersonaCommand) Description(lang string) string {
+	i18n := i18n.LoadI18n(lang)
+	return i18n.Command.Help.Persona
+}
+
+func (c *PersonaCommand) Scopes() []string {
+	return []string{"all_private_chats", "all_group_chats", "all_chat_administrators"}
+}
+
+func (c *PersonaCommand) NeedAuth() AuthChecker {
+	return NoAuthRequired
+}
+
+func (c *PersonaCommand) Handle(message *tgbotapi.Message, args string, ctx *config.WorkerContext) error {
+	if message.From == nil {
+		return fmt.Errorf("%s", c.i18n.Command.Persona.UsersOnly)
+	}
+	userID := message.From.ID
+
+	setting, value := cutSpace(strings.TrimSpace(args))
+	switch strings.ToLower(setting) {
+	case "":
+		personas, err := ctx.DB.ListPersonas(userID)
+		if err != nil {
+			return fmt.Errorf("failed to list personas: %w", err)
+		}
+		return c.reply(message, ctx, DescribePersonas(personas, UserDisplayName(message.From), c.i18n))
+	case "add":
+		name, description, _ := strings.Cut(value, "\n")
+		name = strings.TrimSpace(name)
+		if name == "" {
+			return fmt.Errorf("%s", c.i18n.Command.Persona.Usage)
+		}
+		persona := &storage.Persona{
+			UserID:      userID,
+			Name:        name,
+			Description: strings.TrimSpace(description),
+		}
+		if err := ctx.DB.CreatePersona(persona); err != nil {
+			return fmt.Errorf("failed to create persona: %w", err)
+		}
+		if err := ctx.DB.ActivatePersona(userID, persona.ID); err != nil {
+			return fmt.Errorf("failed to activate persona: %w", err)
+		}
+	case "use", "delete":
+		if value == "" {
+			return fmt.Errorf("%s", c.i18n.Command.Persona.Usage)
+		}
+		personas, err := ctx.DB.ListPersonas(userID)
+		if err != nil {
+			return fmt.Errorf("failed to list personas: %w", err)
+		}
+		persona := FindPersona(personas, strings.TrimSpace(value))
+		if persona == nil {
+			return fmt.Errorf(c.i18n.Command.Persona.NotFound, strings.TrimSpace(value))
+		}
+		if strings.EqualFold(setting, "use") {
+			err = ctx.DB.ActivatePersona(userID, persona.ID)
+		} else {
+			err = ctx.DB.DeletePersona(persona.ID)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to %s persona: %w", strings.ToLower(setting), err)
+		}
+	case "off":
+		if err := ctx.DB.ActivatePersona(userID, 0); err != nil {
+			return fmt.Errorf("failed to deactivate persona: %w", err)
+		}
+	default:
+		return fmt.Errorf("%s", c.i18n.Command.Persona.Usage)
+	}
+
+	personas, err := ctx.DB.ListPersonas(userID)
+	if err != nil {
+		return fmt.Errorf("failed to list personas: %w", err)
+	}
+	return c.reply(message, ctx, c.i18n.Command.Persona.Updated+"\n\n"+DescribePersonas(personas, UserDisplayName(message.From), c.i18n))
+}
+
+// FindPersona finds a persona by ID or name
+func FindPersona(personas []*storage.Persona, value string) *storage.Persona {
+	id, idErr := strconv.ParseUint(strings.TrimPrefix(value, "#"), 10, 32)
+	for _, persona := range personas {
+		if (idErr == nil && persona.ID == uint(id)) || strings.EqualFold(persona.Name, value) {
+			return persona
+		}
+	}
+	return nil
+}
+
+// DescribePersonas formats the personas of a user, ▶ marking the active one
+func DescribePersonas(personas []*storage.Persona, displayName string, texts *i18n.I18n) string {
+	var active *storage.Persona
+	for _, persona := range personas {
+		if persona.IsActive {
+			active = persona
+		}
+	}
+
+	var sb strings.Builder
+	if active != nil {
+		sb.WriteString(fmt.Sprintf(texts.Command.Persona.Active, active.Name))
+	} else {
+		sb.WriteString(fmt.Sprintf(texts.Command.Persona.Inactive, displayName))
+	}
+	if len(personas) == 0 {
+		sb.WriteString("\n\n" + texts.Command.Persona.Usage)
+		return sb.String()
+	}
+
+	sb.WriteString("\n\n" + texts.Command.Persona.List)
+	for _, persona := range personas {
+		marker := "  "
+		if persona.IsActive {
+			marker = "▶ "
+		}
+		description := persona.Description
+		if runes := []rune(description); len(runes) > 100 {
+			description = string(runes[:100]) + "…"
+		}
+		sb.WriteString(fmt.Sprintf("\n%s#%d %s", marker, persona.ID, persona.Name))
+		if description != "" {
+			sb.WriteString(": " + strings.ReplaceAll(description, "\n", " "))
+		}
+	}
+	return sb.String()
+}
+
+// cutSpace cuts the text around its first whitespace, such as the first word of command arguments
+func cutSpace(text string) (string, string) {
+	index := strings.IndexFunc(text, unicode.IsSpace)
+	if index < 0 {
+		return text, ""
+	}
+	return text[:index], strings.TrimLeftFunc(text[index:], func(r rune) bool { return r == ' ' || r == '\t' })
+}
+
+func (c *PersonaCommand) reply(message *tgbotapi.Message, ctx *config.WorkerContext, text string) error {
+	client, ok := ctx.Bot.(*api.Client)
+	if !ok || client == nil {
+		return fmt.Errorf("bot client not available")
+	}
+
+	// Sent as plain text, since descriptions may contain Markdown characters
+	if err := sender.NewReplySender(client, message).SendPlainText(text); err != nil {
+		return fmt.Errorf("failed to send message: %w", err)
+	}
+	return nil
+}
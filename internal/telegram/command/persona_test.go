@@ -0,0 +1,66 @@
+package command
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/tbxark/ChatGPT-Telegram-Workers/go_version/internal/i18n"
+	"github.com/tbxark/ChatGPT-Telegram-Workers/go_version/internal/storage"
+)
+
+func TestFindPersona(t *testing.T) {
+	personas := []*storage.Persona{
+		{ID: 1, Name: "Arthur"},
+		{ID: 2, Name: "Merlin"},
+	}
+
+	tests := []struct {
+		value string
+		want  uint
+	}{
+		{"2", 2},
+		{"#1", 1},
+		{"merlin", 2},
+		{"Lancelot", 0},
+		{"3", 0},
+	}
+	for _, tt := range tests {
+		got := FindPersona(personas, tt.value)
+		if (got == nil && tt.want != 0) || (got != nil && got.ID != tt.want) {
+			t.Errorf("FindPersona(%q) = %v, want ID %d", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestDescribePersonas(t *testing.T) {
+	texts := i18n.LoadI18n("en")
+	text := DescribePersonas(nil, "Bob", texts)
+	if !strings.HasPrefix(text, "No persona is active, characters know you as Bob.") || !strings.Contains(text, texts.Command.Persona.Usage) {
+		t.Errorf("DescribePersonas(nil) = %q, want the display name and usage", text)
+	}
+
+	personas := []*storage.Persona{
+		{ID: 1, Name: "Arthur", Description: "A knight\nof the round table"},
+		{ID: 2, Name: "Merlin", IsActive: true},
+	}
+	want := "Characters know you as Merlin.\n\nPersonas:\n  #1 Arthur: A knight of the round table\n▶ #2 Merlin"
+	if text := DescribePersonas(personas, "Bob", texts); text != want {
+		t.Errorf("DescribePersonas() = %q, want %q", text, want)
+	}
+}
+
+func TestCutSpace(t *testing.T) {
+	tests := []struct {
+		text, first, rest string
+	}{
+		{"", "", ""},
+		{"off", "off", ""},
+		{"use Arthur", "use", "Arthur"},
+		{"add Arthur\nA knight", "add", "Arthur\nA knight"},
+	}
+	for _, tt := range tests {
+		if first, rest := cutSpace(tt.text); first != tt.first || rest != tt.rest {
+			t.Errorf("cutSpace(%q) = %q, %q, want %q, %q", tt.text, first, rest, tt.first, tt.rest)
+		}
+	}
+}
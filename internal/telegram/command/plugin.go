@@ -63,7 +63,7 @@ func (c *PluginCommand) Handle(message *tgbotapi.Message, args string, ctx *conf
 		if !ok || apiClient == nil {
 			return fmt.Errorf("bot client not available")
 		}
-		client = sender.NewMessageSender(apiClient, message.Chat.ID)
+		client = sender.NewReplySender(apiClient, message)
 	}
 
 	s := client
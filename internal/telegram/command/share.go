@@ -43,13 +43,13 @@ func (c *ShareCommand) NeedAuth() AuthChecker {
 
 func (c *ShareCommand) Handle(message *tgbotapi.Message, args string, ctx *config.WorkerContext) error {
 	// Get bot instance
-	bot, ok := ctx.Bot.(*tgbotapi.BotAPI)
+	bot, ok := botAPI(ctx)
 	if !ok || bot == nil {
 		return fmt.Errorf("bot instance not available")
 	}
 
 	// Send "processing" message
-	processingMsg := tgbotapi.NewMessage(message.Chat.ID, "?正在生成分享链接...")
+	processingMsg := tgbotapi.NewMessage(message.Chat.ID, "⏳正在生成分享链接...")
 	processingMsg.ParseMode = c.config.DefaultParseMode
 	sentMsg, err := bot.Send(processingMsg)
 	if err != nil {
@@ -66,7 +66,7 @@ func (c *ShareCommand) Handle(message *tgbotapi.Message, args string, ctx *confi
 		deleteMsg := tgbotapi.NewDeleteMessage(message.Chat.ID, sentMsg.MessageID)
 		bot.Send(deleteMsg)
 
-		errorMsg := tgbotapi.NewMessage(message.Chat.ID, "?获取对话历史失败")
+		errorMsg := tgbotapi.NewMessage(message.Chat.ID, "❌获取对话历史失败")
 		errorMsg.ParseMode = c.config.DefaultParseMode
 		bot.Send(errorMsg)
 		return fmt.Errorf("failed to get full history: %w", err)
@@ -109,7 +109,7 @@ func (c *ShareCommand) Handle(message *tgbotapi.Message, args string, ctx *confi
 		deleteMsg := tgbotapi.NewDeleteMessage(message.Chat.ID, sentMsg.MessageID)
 		bot.Send(deleteMsg)
 
-		errorMsg := tgbotapi.NewMessage(message.Chat.ID, "?没有可分享的对话内容")
+		errorMsg := tgbotapi.NewMessage(message.Chat.ID, "❌没有可分享的对话内容")
 		errorMsg.ParseMode = c.config.DefaultParseMode
 		bot.Send(errorMsg)
 		return nil
@@ -125,7 +125,7 @@ func (c *ShareCommand) Handle(message *tgbotapi.Message, args string, ctx *confi
 		deleteMsg := tgbotapi.NewDeleteMessage(message.Chat.ID, sentMsg.MessageID)
 		bot.Send(deleteMsg)
 
-		errorMsg := tgbotapi.NewMessage(message.Chat.ID, "?创建 Telegraph 客户端失?)
+		errorMsg := tgbotapi.NewMessage(message.Chat.ID, "❌创建 Telegraph 客户端失败")
 		errorMsg.ParseMode = c.config.DefaultParseMode
 		bot.Send(errorMsg)
 		return fmt.Errorf("failed to create Telegraph client: %w", err)
@@ -140,7 +140,7 @@ func (c *ShareCommand) Handle(message *tgbotapi.Message, args string, ctx *confi
 		deleteMsg := tgbotapi.NewDeleteMessage(message.Chat.ID, sentMsg.MessageID)
 		bot.Send(deleteMsg)
 
-		errorMsg := tgbotapi.NewMessage(message.Chat.ID, "?创建 Telegraph 页面失败")
+		errorMsg := tgbotapi.NewMessage(message.Chat.ID, "❌创建 Telegraph 页面失败")
 		errorMsg.ParseMode = c.config.DefaultParseMode
 		bot.Send(errorMsg)
 		return fmt.Errorf("failed to create Telegraph page: %w", err)
@@ -150,7 +150,7 @@ func (c *ShareCommand) Handle(message *tgbotapi.Message, args string, ctx *confi
 	deleteMsg := tgbotapi.NewDeleteMessage(message.Chat.ID, sentMsg.MessageID)
 	bot.Send(deleteMsg)
 
-	responseText := fmt.Sprintf("?对话已分享\n\n🔗 %s", url)
+	responseText := fmt.Sprintf("✅对话已分享\n\n🔗 %s", url)
 	msg := tgbotapi.NewMessage(message.Chat.ID, responseText)
 	msg.ParseMode = c.config.DefaultParseMode
 
@@ -2,6 +2,7 @@ package command
 
 import (
 	"fmt"
+	"log/slog"
 	"strings"
 	"time"
 
@@ -46,11 +47,15 @@ func (c *StartCommand) Handle(message *tgbotapi.Message, args string, ctx *confi
 	chatID := message.Chat.ID
 	userID := message.From.ID
 
-	// Clear history to start new conversation
+	// Archive history to start new conversation
 	sessionCtx := NewSessionContext(message, ctx.ShareContext.BotID, c.config.GroupChatBotShareMode)
-	if err := ctx.DB.DeleteChatHistory(sessionCtx); err != nil {
-		return fmt.Errorf("failed to clear history: %w", err)
+	if err := ctx.DB.ArchiveChatHistory(sessionCtx); err != nil {
+		return fmt.Errorf("failed to archive history: %w", err)
 	}
+	if err := ctx.LoadUserConfig(sessionCtx); err != nil {
+		slog.Error("Failed to load user config", "error", err)
+	}
+	titleArchivedConversation(sessionCtx, ctx, c.config)
 
 	// Send welcome message with chat ID
 	text := fmt.Sprintf("🤖 Welcome!\n\nYour Chat ID: `%d`\nYour User ID: `%d`\n\n%s",
@@ -78,7 +83,7 @@ func (c *StartCommand) Handle(message *tgbotapi.Message, args string, ctx *confi
 	}
 
 	// Get bot instance
-	bot, ok := ctx.Bot.(*tgbotapi.BotAPI)
+	bot, ok := botAPI(ctx)
 	if !ok || bot == nil {
 		return fmt.Errorf("bot instance not available")
 	}
@@ -87,6 +92,11 @@ func (c *StartCommand) Handle(message *tgbotapi.Message, args string, ctx *confi
 		return fmt.Errorf("failed to send message: %w", err)
 	}
 
+	// A topic bound to a character starts with its greeting
+	if err := sendCharacterGreeting(message, sessionCtx, ctx, c.config); err != nil {
+		slog.Warn("Failed to send character greeting", "error", err)
+	}
+
 	return nil
 }
 
@@ -140,7 +150,7 @@ func (c *HelpCommand) Handle(message *tgbotapi.Message, args string, ctx *config
 	msg.ParseMode = c.config.DefaultParseMode
 
 	// Get bot instance
-	bot, ok := ctx.Bot.(*tgbotapi.BotAPI)
+	bot, ok := botAPI(ctx)
 	if !ok || bot == nil {
 		return fmt.Errorf("bot instance not available")
 	}
@@ -184,11 +194,15 @@ func (c *NewCommand) NeedAuth() AuthChecker {
 }
 
 func (c *NewCommand) Handle(message *tgbotapi.Message, args string, ctx *config.WorkerContext) error {
-	// Clear conversation history
+	// Archive the conversation, it stays available in /chats
 	sessionCtx := NewSessionContext(message, ctx.ShareContext.BotID, c.config.GroupChatBotShareMode)
-	if err := ctx.DB.DeleteChatHistory(sessionCtx); err != nil {
-		return fmt.Errorf("failed to clear history: %w", err)
+	if err := ctx.DB.ArchiveChatHistory(sessionCtx); err != nil {
+		return fmt.Errorf("failed to archive history: %w", err)
 	}
+	if err := ctx.LoadUserConfig(sessionCtx); err != nil {
+		slog.Error("Failed to load user config", "error", err)
+	}
+	titleArchivedConversation(sessionCtx, ctx, c.config)
 
 	// Send confirmation
 	msg := tgbotapi.NewMessage(message.Chat.ID, c.i18n.Command.New.NewChatStart)
@@ -213,7 +227,7 @@ func (c *NewCommand) Handle(message *tgbotapi.Message, args string, ctx *config.
 	}
 
 	// Get bot instance
-	bot, ok := ctx.Bot.(*tgbotapi.BotAPI)
+	bot, ok := botAPI(ctx)
 	if !ok || bot == nil {
 		return fmt.Errorf("bot instance not available")
 	}
@@ -222,6 +236,11 @@ func (c *NewCommand) Handle(message *tgbotapi.Message, args string, ctx *config.
 		return fmt.Errorf("failed to send message: %w", err)
 	}
 
+	// A topic bound to a character starts with its greeting
+	if err := sendCharacterGreeting(message, sessionCtx, ctx, c.config); err != nil {
+		slog.Warn("Failed to send character greeting", "error", err)
+	}
+
 	return nil
 }
 
@@ -0,0 +1,237 @@
+package command
+
+import (
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/tbxark/ChatGPT-Telegram-Workers/go_version/internal/agent"
+	"github.com/tbxark/ChatGPT-Telegram-Workers/go_version/internal/config"
+	"github.com/tbxark/ChatGPT-Telegram-Workers/go_version/internal/i18n"
+	"github.com/tbxark/ChatGPT-Telegram-Workers/go_version/internal/sillytavern"
+	"github.com/tbxark/ChatGPT-Telegram-Workers/go_version/internal/storage"
+	"github.com/tbxark/ChatGPT-Telegram-Workers/go_version/internal/telegram/api"
+)
+
+// TopicCommand implements the /topic command
+// Shows or changes the model, system prompt and character card or character group of a forum topic,
+// or of the whole chat outside of topics
+type TopicCommand struct {
+	config *config.Config
+	i18n   *i18n.I18n
+}
+
+// NewTopicCommand creates a new /topic command
+func NewTopicCommand(cfg *config.Config, i18n *i18n.I18n) *TopicCommand {
+	return &TopicCommand{
+		config: cfg,
+		i18n:   i18n,
+	}
+}
+
+func (c *TopicCommand) Name() string {
+	return "topic"
+}
+
+func (c *TopicCommand) Description(lang string) string {
+	i18n := i18n.LoadI18n(lang)
+	return i18n.Command.Help.Topic
+}
+
+func (c *TopicCommand) Scopes() []string {
+	return []string{"all_chat_administrators"}
+}
+
+func (c *TopicCommand) NeedAuth() AuthChecker {
+	return AdminOnly
+}
+
+func (c *TopicCommand) Handle(message *tgbotapi.Message, args string, ctx *config.WorkerContext) error {
+	// Bindings belong to the whole topic, or to the whole chat outside of topics
+	threadID := api.MessageThreadID(message)
+	sessionCtx := config.TopicSessionContext(message.Chat.ID, ctx.ShareContext.BotID, int64(threadID))
+	topicConfig, err := ctx.DB.GetUserConfig(sessionCtx)
+	if err != nil {
+		return fmt.Errorf("failed to load topic config: %w", err)
+	}
+	if topicConfig == nil {
+		topicConfig = &storage.UserConfig{DefineKeys: []string{}}
+	}
+	if topicConfig.Values == nil {
+		topicConfig.Values = make(map[string]interface{})
+	}
+
+	setting, value, _ := strings.Cut(strings.TrimSpace(args), " ")
+	value = strings.TrimSpace(value)
+	switch strings.ToLower(setting) {
+	case "":
+		return c.reply(message, ctx, c.describe(topicConfig, ctx.DB))
+	case "model":
+		if value == "" {
+			return fmt.Errorf("%s", c.i18n.Command.Topic.Usage)
+		}
+		chatAgent, err := agent.LoadChatLLM(config.MergeUserConfig(c.config, topicConfig), nil)
+		if err != nil {
+			return fmt.Errorf("failed to load chat agent: %w", err)
+		}
+		setGroupValue(topicConfig, chatAgent.ModelKey(), value)
+	case "prompt":
+		if value == "" {
+			return fmt.Errorf("%s", c.i18n.Command.Topic.Usage)
+		}
+		setGroupValue(topicConfig, config.TopicSystemPromptKey, value)
+	case "character":
+		if value == "" {
+			return fmt.Errorf("%s", c.i18n.Command.Topic.Usage)
+		}
+		card, err := c.findCard(value, message, ctx.DB)
+		if err != nil {
+			return err
+		}
+		setGroupValue(topicConfig, config.TopicCharacterKey, strconv.FormatUint(uint64(card.ID), 10))
+		deleteGroupValue(topicConfig, config.TopicGroupKey)
+	case "group":
+		var ids []string
+		for _, name := range strings.Split(value, ",") {
+			if name = strings.TrimSpace(name); name == "" {
+				continue
+			}
+			card, err := c.findCard(name, message, ctx.DB)
+			if err != nil {
+				return err
+			}
+			ids = append(ids, strconv.FormatUint(uint64(card.ID), 10))
+		}
+		if len(ids) == 0 {
+			return fmt.Errorf("%s", c.i18n.Command.Topic.Usage)
+		}
+		setGroupValue(topicConfig, config.TopicGroupKey, strings.Join(ids, ","))
+		deleteGroupValue(topicConfig, config.TopicCharacterKey)
+	case "strategy":
+		switch strings.ToLower(value) {
+		case sillytavern.GroupStrategyNatural, sillytavern.GroupStrategyList, sillytavern.GroupStrategyRandom:
+			setGroupValue(topicConfig, config.TopicGroupStrategyKey, strings.ToLower(value))
+		default:
+			return fmt.Errorf("%s", c.i18n.Command.Topic.Usage)
+		}
+	case "reset":
+		keys := append([]string{config.TopicSystemPromptKey, config.TopicCharacterKey, config.TopicGroupKey, config.TopicGroupStrategyKey}, config.ChatModelKeys...)
+		for _, key := range keys {
+			deleteGroupValue(topicConfig, key)
+		}
+	default:
+		return fmt.Errorf("%s", c.i18n.Command.Topic.Usage)
+	}
+
+	if err := ctx.DB.SaveUserConfig(sessionCtx, topicConfig); err != nil {
+		return fmt.Errorf("failed to save topic config: %w", err)
+	}
+
+	if err := c.reply(message, ctx, c.i18n.Command.Topic.Updated+"\n\n"+c.describe(topicConfig, ctx.DB)); err != nil {
+		return err
+	}
+
+	// A new character or group starts a new conversation with its greeting, the previous one stays in /chats
+	if strings.EqualFold(setting, "character") || strings.EqualFold(setting, "group") {
+		chatCtx := NewSessionContext(message, ctx.ShareContext.BotID, c.config.GroupChatBotShareMode)
+		if err := ctx.DB.ArchiveChatHistory(chatCtx); err != nil {
+			return fmt.Errorf("failed to archive history: %w", err)
+		}
+		if err := sendCharacterGreeting(message, chatCtx, ctx, c.config); err != nil {
+			slog.Warn("Failed to send character greeting", "error", err)
+		}
+	}
+	return nil
+}
+
+// findCard finds a character card visible to the admin by ID or name
+func (c *TopicCommand) findCard(value string, message *tgbotapi.Message, db storage.Storage) (*storage.CharacterCard, error) {
+	var userID *int64
+	if message.From != nil {
+		userID = &message.From.ID
+	}
+	cards, err := db.ListCharacterCards(userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list character cards: %w", err)
+	}
+
+	id, idErr := strconv.ParseUint(value, 10, 32)
+	for _, card := range cards {
+		if (idErr == nil && card.ID == uint(id)) || strings.EqualFold(card.Name, value) {
+			if _, err := sillytavern.NewCharacterCardManager(db).ParseCardData(card.Data); err != nil {
+				return nil, fmt.Errorf("invalid character card %s: %w", card.Name, err)
+			}
+			return card, nil
+		}
+	}
+	return nil, fmt.Errorf(c.i18n.Command.Topic.CharacterNotFound, value)
+}
+
+// describe formats the bindings of a topic
+func (c *TopicCommand) describe(topicConfig *storage.UserConfig, db storage.Storage) string {
+	texts := c.i18n.Command.Topic
+	merged := config.MergeUserConfig(c.config, topicConfig)
+
+	model := texts.Default
+	if chatAgent, err := agent.LoadChatLLM(merged, nil); err == nil {
+		model = chatAgent.Model(merged)
+		if _, ok := topicConfig.Values[chatAgent.ModelKey()]; !ok {
+			model += " (" + texts.Default + ")"
+		}
+	}
+
+	prompt := texts.Default
+	if value, ok := topicConfig.Values[config.TopicSystemPromptKey].(string); ok {
+		prompt = value
+		if runes := []rune(prompt); len(runes) > 100 {
+			prompt = string(runes[:100]) + "…"
+		}
+	}
+
+	character := texts.None
+	if id := config.TopicCharacterID(topicConfig); id != 0 {
+		character = fmt.Sprintf("#%d", id)
+		if card, err := db.GetCharacterCard(id); err == nil {
+			character = fmt.Sprintf("%s (#%d)", card.Name, id)
+		}
+	}
+
+	var sb strings.Builder
+	sb.WriteString(texts.Summary + "\n")
+	sb.WriteString(fmt.Sprintf("- %s: %s\n", texts.Model, model))
+	sb.WriteString(fmt.Sprintf("- %s: %s\n", texts.SystemPrompt, prompt))
+	sb.WriteString(fmt.Sprintf("- %s: %s", texts.Character, character))
+	if ids := config.TopicGroupIDs(topicConfig); len(ids) > 0 {
+		var names []string
+		for _, id := range ids {
+			name := fmt.Sprintf("#%d", id)
+			if card, err := db.GetCharacterCard(id); err == nil {
+				name = fmt.Sprintf("%s (#%d)", card.Name, id)
+			}
+			names = append(names, name)
+		}
+		sb.WriteString(fmt.Sprintf("\n- %s: %s", texts.Group, strings.Join(names, ", ")))
+		strategy := merged.CharacterGroupStrategy
+		if strategy == "" {
+			strategy = sillytavern.GroupStrategyNatural
+		}
+		sb.WriteString(fmt.Sprintf("\n- %s: %s", texts.TurnOrder, strategy))
+	}
+	return sb.String()
+}
+
+func (c *TopicCommand) reply(message *tgbotapi.Message, ctx *config.WorkerContext, text string) error {
+	bot, ok := botAPI(ctx)
+	if !ok || bot == nil {
+		return fmt.Errorf("bot instance not available")
+	}
+
+	// Sent as plain text, since prompts may contain Markdown characters
+	msg := tgbotapi.NewMessage(message.Chat.ID, text)
+	if _, err := bot.Send(msg); err != nil {
+		return fmt.Errorf("failed to send message: %w", err)
+	}
+	return nil
+}
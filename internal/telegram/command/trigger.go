@@ -0,0 +1,159 @@
+package command
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/tbxark/ChatGPT-Telegram-Workers/go_version/internal/config"
+	"github.com/tbxark/ChatGPT-Telegram-Workers/go_version/internal/i18n"
+	"github.com/tbxark/ChatGPT-Telegram-Workers/go_version/internal/storage"
+)
+
+// TriggerCommand implements the /trigger command
+// Shows or changes when the bot responds in a group
+type TriggerCommand struct {
+	config *config.Config
+	i18n   *i18n.I18n
+}
+
+// NewTriggerCommand creates a new /trigger command
+func NewTriggerCommand(cfg *config.Config, i18n *i18n.I18n) *TriggerCommand {
+	return &TriggerCommand{
+		config: cfg,
+		i18n:   i18n,
+	}
+}
+
+func (c *TriggerCommand) Name() string {
+	return "trigger"
+}
+
+func (c *TriggerCommand) Description(lang string) string {
+	i18n := i18n.LoadI18n(lang)
+	return i18n.Command.Help.Trigger
+}
+
+func (c *TriggerCommand) Scopes() []string {
+	return []string{"all_chat_administrators"}
+}
+
+func (c *TriggerCommand) NeedAuth() AuthChecker {
+	return AdminOnly
+}
+
+func (c *TriggerCommand) Handle(message *tgbotapi.Message, args string, ctx *config.WorkerContext) error {
+	if !message.Chat.IsGroup() && !message.Chat.IsSuperGroup() {
+		return fmt.Errorf("%s", c.i18n.Command.Trigger.GroupsOnly)
+	}
+
+	// Trigger settings belong to the whole group
+	sessionCtx := config.GroupSessionContext(message.Chat.ID, ctx.ShareContext.BotID)
+	groupConfig, err := ctx.DB.GetUserConfig(sessionCtx)
+	if err != nil {
+		return fmt.Errorf("failed to load group config: %w", err)
+	}
+	if groupConfig == nil {
+		groupConfig = &storage.UserConfig{DefineKeys: []string{}}
+	}
+	if groupConfig.Values == nil {
+		groupConfig.Values = make(map[string]interface{})
+	}
+
+	setting, value, _ := strings.Cut(strings.TrimSpace(args), " ")
+	value = strings.TrimSpace(value)
+	switch strings.ToLower(setting) {
+	case "":
+		return c.reply(message, ctx, c.describe(config.ResolveGroupTrigger(c.config, groupConfig)))
+	case "mode":
+		if value == "" {
+			return fmt.Errorf("%s", c.i18n.Command.Trigger.Usage)
+		}
+		setGroupValue(groupConfig, config.GroupTriggerModeKey, strings.ToLower(value))
+	case "keywords":
+		setGroupValue(groupConfig, config.GroupTriggerKeywordsKey, value)
+	case "probability":
+		if _, err := strconv.ParseFloat(value, 64); err != nil {
+			return fmt.Errorf(c.i18n.Command.Trigger.InvalidProbability+": %s", value, c.i18n.Command.Trigger.Usage)
+		}
+		setGroupValue(groupConfig, config.GroupTriggerProbabilityKey, value)
+	case "reset":
+		for _, key := range []string{config.GroupTriggerModeKey, config.GroupTriggerKeywordsKey, config.GroupTriggerProbabilityKey} {
+			deleteGroupValue(groupConfig, key)
+		}
+	default:
+		return fmt.Errorf("%s", c.i18n.Command.Trigger.Usage)
+	}
+
+	trigger := config.ResolveGroupTrigger(c.config, groupConfig)
+	if err := config.ValidateGroupTrigger(trigger); err != nil {
+		return fmt.Errorf("invalid trigger settings: %w", err)
+	}
+	if err := ctx.DB.SaveUserConfig(sessionCtx, groupConfig); err != nil {
+		return fmt.Errorf("failed to save group config: %w", err)
+	}
+
+	return c.reply(message, ctx, c.i18n.Command.Trigger.Updated+"\n\n"+c.describe(trigger))
+}
+
+// describe formats the trigger settings of a group
+func (c *TriggerCommand) describe(trigger config.GroupTrigger) string {
+	texts := c.i18n.Command.Trigger
+	modes := strings.Join(trigger.Modes, ", ")
+	if modes == "" {
+		modes = texts.NoModes
+	}
+	keywords := strings.Join(trigger.Keywords, ", ")
+	if keywords == "" {
+		keywords = texts.None
+	}
+
+	var sb strings.Builder
+	sb.WriteString(texts.Summary + "\n")
+	sb.WriteString(fmt.Sprintf("- %s: %s\n", texts.Mode, modes))
+	sb.WriteString(fmt.Sprintf("- %s: %s\n", texts.Keywords, keywords))
+	sb.WriteString(fmt.Sprintf("- %s: %g\n", texts.Probability, trigger.Probability))
+	sb.WriteString(fmt.Sprintf("\n%s: %s", texts.Modes, strings.Join(config.GroupTriggerModes, ", ")))
+	return sb.String()
+}
+
+func (c *TriggerCommand) reply(message *tgbotapi.Message, ctx *config.WorkerContext, text string) error {
+	bot, ok := botAPI(ctx)
+	if !ok || bot == nil {
+		return fmt.Errorf("bot instance not available")
+	}
+
+	// Sent as plain text, since keywords may contain Markdown characters
+	msg := tgbotapi.NewMessage(message.Chat.ID, text)
+	if _, err := bot.Send(msg); err != nil {
+		return fmt.Errorf("failed to send message: %w", err)
+	}
+	return nil
+}
+
+// setGroupValue sets a value of a group configuration
+func setGroupValue(groupConfig *storage.UserConfig, key, value string) {
+	found := false
+	for _, k := range groupConfig.DefineKeys {
+		if k == key {
+			found = true
+			break
+		}
+	}
+	if !found {
+		groupConfig.DefineKeys = append(groupConfig.DefineKeys, key)
+	}
+	groupConfig.Values[key] = value
+}
+
+// deleteGroupValue removes a value from a group configuration
+func deleteGroupValue(groupConfig *storage.UserConfig, key string) {
+	delete(groupConfig.Values, key)
+	for i, k := range groupConfig.DefineKeys {
+		if k == key {
+			groupConfig.DefineKeys = append(groupConfig.DefineKeys[:i], groupConfig.DefineKeys[i+1:]...)
+			break
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package handler
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// albumBuffer collects the messages of media groups (albums).
+// Telegram delivers each photo of an album as a separate update with the same MediaGroupID.
+type albumBuffer struct {
+	window time.Duration
+
+	mu     sync.Mutex
+	albums map[string]*album
+}
+
+// album is a media group being collected
+type album struct {
+	messages []*tgbotapi.Message
+	last     time.Time // Arrival of the latest message
+}
+
+// newAlbumBuffer creates a buffer completing an album once no message arrived for window
+func newAlbumBuffer(window time.Duration) *albumBuffer {
+	return &albumBuffer{
+		window: window,
+		albums: make(map[string]*album),
+	}
+}
+
+// add adds a message of a media group. The call adding the first message waits until the album
+// is complete and returns its messages in order; the calls adding the other messages return nil.
+func (b *albumBuffer) add(message *tgbotapi.Message) []*tgbotapi.Message {
+	key := fmt.Sprintf("%d:%s", message.Chat.ID, message.MediaGroupID)
+
+	b.mu.Lock()
+	if a, ok := b.albums[key]; ok {
+		a.messages = append(a.messages, message)
+		a.last = time.Now()
+		b.mu.Unlock()
+		return nil
+	}
+	a := &album{messages: []*tgbotapi.Message{message}, last: time.Now()}
+	b.albums[key] = a
+	b.mu.Unlock()
+
+	wait := b.window
+	for {
+		time.Sleep(wait)
+
+		b.mu.Lock()
+		if wait = b.window - time.Since(a.last); wait <= 0 {
+			delete(b.albums, key)
+			b.mu.Unlock()
+			break
+		}
+		b.mu.Unlock()
+	}
+
+	sort.Slice(a.messages, func(i, j int) bool {
+		return a.messages[i].MessageID < a.messages[j].MessageID
+	})
+	return a.messages
+}
+
+// mergeAlbum returns the message standing for a whole album: the first message,
+// with the captions of all messages. Its photos are read from the album.
+func mergeAlbum(messages []*tgbotapi.Message) *tgbotapi.Message {
+	merged := *messages[0]
+	var captions []string
+	for _, message := range messages {
+		if message.Caption != "" {
+			captions = append(captions, message.Caption)
+		}
+	}
+	merged.Caption = strings.Join(captions, "\n")
+	return &merged
+}
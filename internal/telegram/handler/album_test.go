@@ -0,0 +1,61 @@
+package handler
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+func albumMessage(id int, caption string) *tgbotapi.Message {
+	return &tgbotapi.Message{
+		MessageID:    id,
+		Chat:         &tgbotapi.Chat{ID: 1},
+		MediaGroupID: "album",
+		Caption:      caption,
+		Photo:        []tgbotapi.PhotoSize{{FileID: "photo"}},
+	}
+}
+
+func TestAlbumBuffer(t *testing.T) {
+	buffer := newAlbumBuffer(50 * time.Millisecond)
+
+	results := make([][]*tgbotapi.Message, 3)
+	var wg sync.WaitGroup
+	for i, message := range []*tgbotapi.Message{albumMessage(10, "caption"), albumMessage(12, ""), albumMessage(11, "")} {
+		wg.Add(1)
+		go func(i int, message *tgbotapi.Message) {
+			defer wg.Done()
+			results[i] = buffer.add(message)
+		}(i, message)
+		time.Sleep(10 * time.Millisecond)
+	}
+	wg.Wait()
+
+	// The first message gets the whole album, in message order
+	if len(results[0]) != 3 || results[1] != nil || results[2] != nil {
+		t.Fatalf("add() results = %v", results)
+	}
+	for i, id := range []int{10, 11, 12} {
+		if results[0][i].MessageID != id {
+			t.Errorf("album[%d] = %d, want %d", i, results[0][i].MessageID, id)
+		}
+	}
+
+	// A new album with the same ID starts over
+	if album := buffer.add(albumMessage(13, "")); len(album) != 1 {
+		t.Errorf("add() after completion = %d messages, want 1", len(album))
+	}
+}
+
+func TestMergeAlbum(t *testing.T) {
+	album := []*tgbotapi.Message{albumMessage(1, ""), albumMessage(2, "first"), albumMessage(3, "second")}
+	merged := mergeAlbum(album)
+	if merged.MessageID != 1 || merged.Caption != "first\nsecond" {
+		t.Errorf("mergeAlbum() = message %d with caption %q", merged.MessageID, merged.Caption)
+	}
+	if album[0].Caption != "" {
+		t.Error("mergeAlbum() must not change the album messages")
+	}
+}
@@ -14,6 +14,7 @@ import (
 	"github.com/tbxark/ChatGPT-Telegram-Workers/go_version/internal/storage"
 	"github.com/tbxark/ChatGPT-Telegram-Workers/go_version/internal/telegram/api"
 	"github.com/tbxark/ChatGPT-Telegram-Workers/go_version/internal/telegram/command"
+	"github.com/tbxark/ChatGPT-Telegram-Workers/go_version/internal/telegram/queue"
 )
 
 // CallbackQueryHandler processes callback queries
@@ -46,11 +47,25 @@ func NewCallbackQueryHandler(cfg *config.Config, i18n *i18n.I18n) *CallbackQuery
 		NewModelListHandler(cfg, i18n, "ica:", "ial:", "icm:", false), // Image model list
 		NewModelChangeHandler(cfg, i18n, "cm:", true),                 // Chat model change
 		NewModelChangeHandler(cfg, i18n, "icm:", false),               // Image model change
+		NewReplyButtonHandler(cfg, regeneratePrefix),                  // Regenerate reply
+		NewReplyButtonHandler(cfg, continuePrefix),                    // Continue reply
+		NewReplyButtonHandler(cfg, swipePrefix),                       // Swipe between replies
+		NewConversationHandler(cfg, i18n, "cs:"),                      // Switch conversation
+		NewConversationHandler(cfg, i18n, "cd:"),                      // Delete conversation
 	}
 
 	return h
 }
 
+// SetQueue makes the reply buttons change replies in turn with the messages of their session
+func (h *CallbackQueryHandler) SetQueue(q *queue.SessionQueue) {
+	for _, handler := range h.handlers {
+		if replyHandler, ok := handler.(*ReplyButtonHandler); ok {
+			replyHandler.SetQueue(q)
+		}
+	}
+}
+
 // Handle processes callback queries
 func (h *CallbackQueryHandler) Handle(update *tgbotapi.Update, ctx *config.WorkerContext) error {
 	if update.CallbackQuery == nil {
@@ -69,6 +84,7 @@ func (h *CallbackQueryHandler) Handle(update *tgbotapi.Update, ctx *config.Worke
 	if query.Message == nil {
 		return nil
 	}
+	bindTopic(query.Message, ctx)
 
 	// Find and execute the appropriate handler
 	for _, handler := range h.handlers {
@@ -340,7 +356,7 @@ func (h *ModelListHandler) createKeyboard(models []string, agentName string, pag
 		tgbotapi.NewInlineKeyboardButtonData("<", fmt.Sprintf("%s%s", h.prefix, toJSON([]interface{}{agentName, int(math.Max(0, float64(page-1)))}))),
 		tgbotapi.NewInlineKeyboardButtonData(fmt.Sprintf("%d/%d", page+1, maxPage), fmt.Sprintf("%s%s", h.prefix, toJSON([]interface{}{agentName, page}))),
 		tgbotapi.NewInlineKeyboardButtonData(">", fmt.Sprintf("%s%s", h.prefix, toJSON([]interface{}{agentName, int(math.Min(float64(page+1), float64(maxPage-1)))}))),
-		tgbotapi.NewInlineKeyboardButtonData("?, h.agentListPrefix),
+		tgbotapi.NewInlineKeyboardButtonData("⇤", h.agentListPrefix),
 	}
 	rows = append(rows, navRow)
 
@@ -448,7 +464,7 @@ func (h *ModelChangeHandler) Handle(query *tgbotapi.CallbackQuery, data string,
 
 		if !canModify {
 			// Send error message
-			text := "?User settings are disabled. Only administrators can modify configuration."
+			text := "❌ User settings are disabled. Only administrators can modify configuration."
 			edit := tgbotapi.NewEditMessageText(
 				query.Message.Chat.ID,
 				query.Message.MessageID,
@@ -0,0 +1,97 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/tbxark/ChatGPT-Telegram-Workers/go_version/internal/config"
+	"github.com/tbxark/ChatGPT-Telegram-Workers/go_version/internal/sillytavern"
+	"github.com/tbxark/ChatGPT-Telegram-Workers/go_version/internal/storage"
+	"github.com/tbxark/ChatGPT-Telegram-Workers/go_version/internal/telegram/api"
+	"github.com/tbxark/ChatGPT-Telegram-Workers/go_version/internal/telegram/command"
+	"github.com/tbxark/ChatGPT-Telegram-Workers/go_version/internal/telegram/sender"
+)
+
+// topicGroupMembers loads the characters of the group bound to the forum topic or the chat of a session, or nil
+func topicGroupMembers(sessionCtx *storage.SessionContext, ctx *config.WorkerContext) []command.GroupMember {
+	ids := config.TopicGroupIDs(loadTopicConfig(sessionCtx, ctx))
+	if len(ids) == 0 {
+		return nil
+	}
+	return command.GroupMembers(ctx.DB, ids)
+}
+
+// groupSpeakerPrompt returns the promptFunc of the replies of a group member: the prompt of its character card,
+// asking for a reply as it only
+func groupSpeakerPrompt(member command.GroupMember, members []command.GroupMember, sessionCtx *storage.SessionContext, cfg *config.Config, ctx *config.WorkerContext, user *tgbotapi.User) promptFunc {
+	return characterPrompt(member.ID, command.GroupNames(members), sessionCtx, cfg, ctx, user)
+}
+
+// groupPrompt prefixes the replies of a group chat with the name of their character, for the model to
+// tell the characters apart
+func groupPrompt(history []storage.HistoryItem) []storage.HistoryItem {
+	prompt := make([]storage.HistoryItem, len(history))
+	for i, item := range history {
+		prompt[i] = item
+		if text, ok := item.Content.(string); ok && item.Role == "assistant" && item.Name != "" {
+			prompt[i].Content = sillytavern.SpeakerMessage(item.Name, text)
+		}
+	}
+	return prompt
+}
+
+// groupReplies requests the replies of the group members chosen by the turn-order strategy to the last
+// user message. Each character replies in its own messages, seeing the replies of the previous ones.
+// It returns the replies, and the sender of the last one.
+func groupReplies(message *tgbotapi.Message, sessionCtx *storage.SessionContext, history []storage.HistoryItem, members []command.GroupMember, cfg *config.Config, ctx *config.WorkerContext, client *api.Client) ([]storage.HistoryItem, *sender.MessageSender, error) {
+	cards := make([]*sillytavern.CharacterCardV2, len(members))
+	for i, member := range members {
+		cards[i] = member.Data
+	}
+	text := ""
+	if turn := lastUserIndex(history); turn >= 0 {
+		text = replyText(history[turn].Content)
+	}
+
+	var replies []storage.HistoryItem
+	var msgSender *sender.MessageSender
+	for _, i := range sillytavern.SelectGroupSpeakers(cards, cfg.CharacterGroupStrategy, text, nil) {
+		member := members[i]
+		speakerSender := sender.NewReplySender(client, message)
+		if err := speakerSender.SendChatAction("typing"); err != nil {
+			slog.Warn("Failed to send typing action", "error", err)
+		}
+
+		prompt, speakerCfg := groupSpeakerPrompt(member, members, sessionCtx, cfg, ctx, message.From)(groupPrompt(slices.Concat(history, replies)))
+		response, err := requestCompletionsFromLLM(context.Background(), prompt, speakerCfg, ctx.UserConfig, ctx.DB, ctx.ShareContext.BotID, speakerSender, command.GroupNamePrefix(cfg, member.Name()))
+		if err != nil {
+			if len(replies) > 0 {
+				// The replies already sent are kept
+				slog.Warn("Failed to get group reply", "character", member.Name(), "error", err)
+				break
+			}
+			return nil, nil, err
+		}
+
+		items := convertAgentToStorageHistory(response.Messages)
+		reply := lastAssistantItem(items)
+		if reply == nil {
+			continue
+		}
+		if text, ok := reply.Content.(string); ok {
+			reply.Content = sillytavern.StripSpeakerName(text, member.Name())
+		}
+		reply.Name = member.Name()
+		reply.MessageIDs = speakerSender.MessageIDs()
+		replies = append(replies, items...)
+		msgSender = speakerSender
+	}
+
+	if msgSender == nil {
+		return nil, nil, fmt.Errorf("no reply generated")
+	}
+	return replies, msgSender, nil
+}
@@ -0,0 +1,26 @@
+package handler
+
+import (
+	"testing"
+
+	"github.com/tbxark/ChatGPT-Telegram-Workers/go_version/internal/storage"
+)
+
+func TestGroupPrompt(t *testing.T) {
+	history := []storage.HistoryItem{
+		{Role: "user", Content: "Hello"},
+		{Role: "assistant", Content: "Hi!", Name: "Aria"},
+		{Role: "assistant", Content: "Hey."},
+	}
+
+	prompt := groupPrompt(history)
+	if got := prompt[1].Content; got != "Aria: Hi!" {
+		t.Errorf("groupPrompt() reply = %v, want %q", got, "Aria: Hi!")
+	}
+	if got := prompt[2].Content; got != "Hey." {
+		t.Errorf("groupPrompt() unnamed reply = %v, want it unchanged", got)
+	}
+	if history[1].Content != "Hi!" {
+		t.Errorf("groupPrompt() changed the history: %v", history[1].Content)
+	}
+}
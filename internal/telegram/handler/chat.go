@@ -2,25 +2,27 @@ package handler
 
 import (
 	"context"
-	"encoding/base64"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
 	"net/http"
+	"slices"
 	"strings"
-	"time"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 	"github.com/tbxark/ChatGPT-Telegram-Workers/go_version/internal/agent"
 	"github.com/tbxark/ChatGPT-Telegram-Workers/go_version/internal/config"
+	"github.com/tbxark/ChatGPT-Telegram-Workers/go_version/internal/i18n"
 	"github.com/tbxark/ChatGPT-Telegram-Workers/go_version/internal/storage"
 	"github.com/tbxark/ChatGPT-Telegram-Workers/go_version/internal/telegram/api"
 	"github.com/tbxark/ChatGPT-Telegram-Workers/go_version/internal/telegram/sender"
 )
 
 // extractUserMessageItem extracts a user message from a Telegram message
-// Supports text messages, photo messages, and messages with captions
-func extractUserMessageItem(message *tgbotapi.Message, cfg *config.Config) (storage.HistoryItem, error) {
+// Supports text messages, photo messages, and messages with captions.
+// The photos of an album are read from album, when the message stands for a whole album.
+func extractUserMessageItem(message *tgbotapi.Message, album []*tgbotapi.Message, cfg *config.Config, client *api.Client) (storage.HistoryItem, error) {
 	var contentParts []storage.ContentPart
 
 	// Extract text content
@@ -37,28 +39,20 @@ func extractUserMessageItem(message *tgbotapi.Message, cfg *config.Config) (stor
 		})
 	}
 
-	// Extract photo if present
-	if message.Photo != nil && len(message.Photo) > 0 {
-		photoURL, err := extractPhotoURL(message, cfg)
-		if err != nil {
-			return storage.HistoryItem{}, fmt.Errorf("failed to extract photo: %w", err)
+	// Extract photos if present
+	photoMessages := []*tgbotapi.Message{message}
+	if len(album) > 0 {
+		photoMessages = album
+	}
+	for _, photoMessage := range photoMessages {
+		if len(photoMessage.Photo) == 0 {
+			continue
 		}
-
-		// Convert to base64 if configured
-		imageData := photoURL
-		if cfg.TelegramImageTransferMode == "base64" {
-			base64Data, err := convertImageToBase64(photoURL)
-			if err != nil {
-				slog.Warn("Failed to convert image to base64, using URL", "error", err)
-			} else {
-				imageData = base64Data
-			}
+		imagePart, err := extractImagePart(photoMessage, cfg, client)
+		if err != nil {
+			return storage.HistoryItem{}, err
 		}
-
-		contentParts = append(contentParts, storage.ContentPart{
-			Type:  "image",
-			Image: imageData,
-		})
+		contentParts = append(contentParts, imagePart)
 	}
 
 	// If no content parts, return error
@@ -81,6 +75,35 @@ func extractUserMessageItem(message *tgbotapi.Message, cfg *config.Config) (stor
 	}, nil
 }
 
+// extractImagePart downloads the photo of a message as an image content part
+func extractImagePart(message *tgbotapi.Message, cfg *config.Config, client *api.Client) (storage.ContentPart, error) {
+	fileID, err := extractPhotoURL(message, cfg)
+	if err != nil {
+		return storage.ContentPart{}, fmt.Errorf("failed to extract photo: %w", err)
+	}
+
+	photoURL, err := getPhotoURL(client, fileID)
+	if err != nil {
+		return storage.ContentPart{}, fmt.Errorf("failed to extract photo: %w", err)
+	}
+
+	// Convert to base64 if configured
+	imageData := photoURL
+	if cfg.TelegramImageTransferMode == "base64" {
+		base64Data, err := convertImageToBase64(photoURL, cfg)
+		if err != nil {
+			slog.Warn("Failed to convert image to base64, using URL", "error", err)
+		} else {
+			imageData = base64Data
+		}
+	}
+
+	return storage.ContentPart{
+		Type:  "image",
+		Image: imageData,
+	}, nil
+}
+
 // extractPhotoURL extracts the photo URL from a Telegram message
 func extractPhotoURL(message *tgbotapi.Message, cfg *config.Config) (string, error) {
 	if message.Photo == nil || len(message.Photo) == 0 {
@@ -128,8 +151,9 @@ func getPhotoURL(client *api.Client, fileID string) (string, error) {
 	return url, nil
 }
 
-// convertImageToBase64 downloads an image from URL and converts it to base64
-func convertImageToBase64(imageURL string) (string, error) {
+// convertImageToBase64 downloads an image from URL and converts it to a base64 data URI.
+// Oversize images are resized/recompressed to the configured vision limits.
+func convertImageToBase64(imageURL string, cfg *config.Config) (string, error) {
 	// Download the image
 	resp, err := http.Get(imageURL)
 	if err != nil {
@@ -147,16 +171,13 @@ func convertImageToBase64(imageURL string) (string, error) {
 		return "", fmt.Errorf("failed to read image data: %w", err)
 	}
 
-	// Convert to base64
-	base64Data := base64.StdEncoding.EncodeToString(imageData)
-
-	// Add data URI prefix based on content type
-	contentType := resp.Header.Get("Content-Type")
-	if contentType == "" {
-		contentType = "image/jpeg" // Default
+	// Detect the MIME type from the data (Telegram serves files as application/octet-stream)
+	image, err := agent.PrepareImageData(imageData, resp.Header.Get("Content-Type"), cfg)
+	if err != nil {
+		return "", err
 	}
 
-	return fmt.Sprintf("data:%s;base64,%s", contentType, base64Data), nil
+	return image.DataURI(), nil
 }
 
 // extractExtraContext extracts extra context from replied-to messages
@@ -210,7 +231,7 @@ func extractExtraContext(message *tgbotapi.Message, cfg *config.Config, ctx *con
 				if err == nil {
 					imageData := fullURL
 					if cfg.TelegramImageTransferMode == "base64" {
-						base64Data, err := convertImageToBase64(fullURL)
+						base64Data, err := convertImageToBase64(fullURL, cfg)
 						if err == nil {
 							imageData = base64Data
 						}
@@ -344,12 +365,55 @@ func convertStorageToAgentHistory(items []storage.HistoryItem) []agent.HistoryIt
 	for i, item := range items {
 		result[i] = agent.HistoryItem{
 			Role:    item.Role,
-			Content: item.Content,
+			Content: convertStorageToAgentContent(item.Content),
 		}
 	}
 	return result
 }
 
+// convertStorageToAgentContent converts multi-part content to []agent.ContentPart
+// Content loaded from storage is decoded from JSON as []interface{}, fresh content is []storage.ContentPart
+func convertStorageToAgentContent(content interface{}) interface{} {
+	switch v := content.(type) {
+	case []storage.ContentPart:
+		parts := make([]agent.ContentPart, len(v))
+		for i, part := range v {
+			parts[i] = agent.ContentPart{Type: part.Type, Text: part.Text, Image: part.Image}
+		}
+		return parts
+	case []interface{}:
+		parts := make([]agent.ContentPart, 0, len(v))
+		for _, raw := range v {
+			m, ok := raw.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			part := agent.ContentPart{}
+			part.Type, _ = m["type"].(string)
+			part.Text, _ = m["text"].(string)
+			part.Image, _ = m["image"].(string)
+			parts = append(parts, part)
+		}
+		return parts
+	default:
+		return content
+	}
+}
+
+// sendVisionNotSupported tells the user that the current model cannot read images
+func sendVisionNotSupported(msgSender *sender.MessageSender, cfg *config.Config, userConfig *storage.UserConfig) error {
+	model := ""
+	if chatAgent, err := agent.LoadChatLLM(cfg, userConfig); err == nil {
+		model = chatAgent.Model(cfg)
+	}
+
+	text := fmt.Sprintf(i18n.LoadI18n(cfg.Language).Chat.VisionNotSupported, model)
+	if err := msgSender.SendPlainText(text); err != nil {
+		return fmt.Errorf("failed to send vision error: %w", err)
+	}
+	return nil
+}
+
 // convertAgentToStorageHistory converts agent.HistoryItem to storage.HistoryItem
 func convertAgentToStorageHistory(items []agent.HistoryItem) []storage.HistoryItem {
 	result := make([]storage.HistoryItem, len(items))
@@ -381,6 +445,9 @@ func chatWithMessage(message *tgbotapi.Message, ctx *config.WorkerContext) error
 		// Continue with default config
 	}
 
+	// Forum topics and chats may bind their own model, system prompt and character
+	cfg = applyTopicBindings(cfg, sessionCtx, ctx)
+
 	// Load conversation history
 	history, err := loadHistory(sessionCtx, ctx.DB)
 	if err != nil {
@@ -388,8 +455,10 @@ func chatWithMessage(message *tgbotapi.Message, ctx *config.WorkerContext) error
 		history = []storage.HistoryItem{}
 	}
 
+	// The reply buttons move from the previous reply to the new one
+	previousReplyIDs := lastReplyMessageIDs(history)
+
 	// Check if this is a redo operation
-	var userMessage storage.HistoryItem
 	isRedoMode := false
 	if ctx.Context != nil {
 		if redoMode, ok := ctx.Context["redo_mode"].(bool); ok && redoMode {
@@ -400,8 +469,7 @@ func chatWithMessage(message *tgbotapi.Message, ctx *config.WorkerContext) error
 			if err != nil {
 				return fmt.Errorf("failed to apply redo modifier: %w", err)
 			}
-			history = modifiedHistory
-			userMessage = lastUserMsg
+			history = append(modifiedHistory, lastUserMsg)
 
 			// Clear the redo flags from context
 			delete(ctx.Context, "redo_mode")
@@ -409,16 +477,54 @@ func chatWithMessage(message *tgbotapi.Message, ctx *config.WorkerContext) error
 		}
 	}
 
+	// An edited prompt replaces its turn, as long as it is the latest one:
+	// edits of older messages would rewrite the history the later turns rely on
+	isEditMode := false
+	if editMode, ok := ctx.Context["edit_mode"].(bool); ok && editMode {
+		delete(ctx.Context, "edit_mode")
+		turn := lastUserIndex(history)
+		if turn < 0 || !slices.Contains(history[turn].MessageIDs, message.MessageID) {
+			slog.Debug("Ignoring edit of an older message", "chat_id", message.Chat.ID, "message_id", message.MessageID)
+			return nil
+		}
+		isEditMode = true
+		history = history[:turn]
+	}
+
+	// Replying to an earlier answer forks the conversation from it, the original line is kept as a branch
+	isBranch := false
+	if cfg.ReplyBranching && !isRedoMode && !isEditMode && message.ReplyToMessage != nil {
+		if point := branchPoint(history, message.ReplyToMessage.MessageID); point > 0 {
+			if err := ctx.DB.ForkChatHistory(sessionCtx, history[:point]); err != nil {
+				return fmt.Errorf("failed to fork conversation: %w", err)
+			}
+			history = history[:point]
+			isBranch = true
+		}
+	}
+
 	// If not redo mode, extract user message normally
 	if !isRedoMode {
-		var err error
-		userMessage, err = extractUserMessageItem(message, cfg)
+		album, _ := ctx.Context["media_group"].([]*tgbotapi.Message)
+		delete(ctx.Context, "media_group")
+
+		userMessage, err := extractUserMessageItem(message, album, cfg, client)
 		if err != nil {
 			return fmt.Errorf("failed to extract user message: %w", err)
 		}
+		userMessage.MessageIDs = []int{message.MessageID}
+		for _, albumMessage := range album {
+			if albumMessage.MessageID != message.MessageID {
+				userMessage.MessageIDs = append(userMessage.MessageIDs, albumMessage.MessageID)
+			}
+		}
 
-		// Extract extra context from replied message
-		extraContext := extractExtraContext(message, cfg, ctx)
+		// Extract extra context from replied message (an edit keeps the context of the original turn,
+		// and a branch already continues from the replied message)
+		var extraContext []storage.HistoryItem
+		if !isEditMode && !isBranch {
+			extraContext = extractExtraContext(message, cfg, ctx)
+		}
 
 		// Add extra context if present
 		if len(extraContext) > 0 {
@@ -437,25 +543,76 @@ func chatWithMessage(message *tgbotapi.Message, ctx *config.WorkerContext) error
 		history = replaceImagePlaceholder(history, cfg.HistoryImagePlaceholder)
 	}
 
-	// Create message sender
-	msgSender := sender.NewMessageSender(client, message.Chat.ID)
-	if cfg.TelegramMinStreamInterval > 0 {
-		msgSender.SetMinStreamInterval(time.Duration(cfg.TelegramMinStreamInterval) * time.Millisecond)
-	}
+	// Create message sender (stream updates are throttled by the StreamHandler)
+	msgSender := sender.NewReplySender(client, message)
+
+	// Forum topics bound to a character group get a reply from each character taking its turn
+	members := topicGroupMembers(sessionCtx, ctx)
 
-	// Send typing action
-	if err := msgSender.SendChatAction("typing"); err != nil {
-		slog.Warn("Failed to send typing action", "error", err)
+	// The answer to an edited prompt is shown by editing the previous answer
+	if isEditMode && len(members) == 0 {
+		msgSender.Resume(previousReplyIDs)
 	}
 
-	// Request completion from LLM
-	response, err := requestCompletionsFromLLM(context.Background(), history, cfg, ctx.UserConfig, msgSender)
-	if err != nil {
-		return fmt.Errorf("failed to get LLM response: %w", err)
+	var responseItems []storage.HistoryItem
+	var reply *storage.HistoryItem
+	if len(members) > 0 {
+		// The reply buttons go to the last reply of the group
+		var replySender *sender.MessageSender
+		responseItems, replySender, err = groupReplies(message, sessionCtx, history, members, cfg, ctx, client)
+		if err != nil {
+			if errors.Is(err, agent.ErrVisionNotSupported) {
+				return sendVisionNotSupported(msgSender, cfg, ctx.UserConfig)
+			}
+			return fmt.Errorf("failed to get LLM response: %w", err)
+		}
+		msgSender = replySender
+		reply = lastAssistantItem(responseItems)
+	} else {
+		// Send typing action
+		if err := msgSender.SendChatAction("typing"); err != nil {
+			slog.Warn("Failed to send typing action", "error", err)
+		}
+
+		// Request completion from LLM, prompted by the bound character card if any
+		prompt, promptCfg := characterPrompt(topicCharacterID(sessionCtx, ctx), "", sessionCtx, cfg, ctx, message.From)(history)
+		response, err := requestCompletionsFromLLM(context.Background(), prompt, promptCfg, ctx.UserConfig, ctx.DB, ctx.ShareContext.BotID, msgSender, "")
+		if err != nil {
+			if errors.Is(err, agent.ErrVisionNotSupported) {
+				return sendVisionNotSupported(msgSender, cfg, ctx.UserConfig)
+			}
+			return fmt.Errorf("failed to get LLM response: %w", err)
+		}
+
+		// Convert the response from agent to storage type, remembering which messages show it
+		responseItems = convertAgentToStorageHistory(response.Messages)
+		reply = lastAssistantItem(responseItems)
+		if reply != nil {
+			reply.MessageIDs = msgSender.MessageIDs()
+		}
 	}
 
-	// Add assistant response to history (convert from agent to storage type)
-	history = append(history, convertAgentToStorageHistory(response.Messages)...)
+	// Add assistant response to history
+	history = append(history, responseItems...)
+
+	if len(previousReplyIDs) > 0 {
+		if isRedoMode || (isEditMode && len(members) > 0) {
+			// The new answer replaces the previous reply of a redo, and the previous replies of a group
+			if err := msgSender.DeleteMessages(previousReplyIDs); err != nil {
+				slog.Warn("Failed to delete previous reply", "error", err)
+			}
+		} else if cfg.ShowReplyButton && !isEditMode {
+			// Only the latest reply can be regenerated, continued or swiped
+			if err := msgSender.RemoveKeyboard(previousReplyIDs[len(previousReplyIDs)-1]); err != nil {
+				slog.Warn("Failed to remove reply buttons", "error", err)
+			}
+		}
+	}
+	if cfg.ShowReplyButton && reply != nil && len(reply.MessageIDs) > 0 {
+		if err := msgSender.AttachKeyboard(replyKeyboard(*reply, cfg.Language)); err != nil {
+			slog.Warn("Failed to attach reply buttons", "error", err)
+		}
+	}
 
 	// Trim history again after adding response
 	history = trimHistory(history, cfg)
@@ -469,6 +626,43 @@ func chatWithMessage(message *tgbotapi.Message, ctx *config.WorkerContext) error
 	return nil
 }
 
+// lastUserIndex returns the index of the last user message of the history, or -1
+func lastUserIndex(history []storage.HistoryItem) int {
+	for i := len(history) - 1; i >= 0; i-- {
+		if history[i].Role == "user" {
+			return i
+		}
+	}
+	return -1
+}
+
+// lastReplyMessageIDs returns the Telegram messages of the replies after the last user message
+func lastReplyMessageIDs(history []storage.HistoryItem) []int {
+	var ids []int
+	for i := len(history) - 1; i >= 0 && history[i].Role != "user"; i-- {
+		ids = append(append([]int(nil), history[i].MessageIDs...), ids...)
+	}
+	return ids
+}
+
+// branchPoint returns the length of the history up to the end of the turn answered by the
+// given message, or -1 if no earlier answer is shown by it: replies to the latest answer
+// continue the conversation as usual
+func branchPoint(history []storage.HistoryItem, messageID int) int {
+	for i, item := range history {
+		if item.Role != "assistant" || !slices.Contains(item.MessageIDs, messageID) {
+			continue
+		}
+		for end := i + 1; end < len(history); end++ {
+			if history[end].Role == "user" {
+				return end
+			}
+		}
+		return -1
+	}
+	return -1
+}
+
 // applyRedoModifier modifies the history for the /redo command
 // It removes messages from the end until it finds the last user message,
 // optionally replacing it with new text
@@ -508,13 +702,17 @@ func applyRedoModifier(history []storage.HistoryItem, redoTextRaw interface{}) (
 	return historyCopy, *lastUserMessage, nil
 }
 
-// requestCompletionsFromLLM requests a completion from the configured LLM
+// requestCompletionsFromLLM requests a completion from the configured LLM.
+// The reply shows prefix before the completion, when it continues a previous reply.
 func requestCompletionsFromLLM(
 	ctx context.Context,
 	history []storage.HistoryItem,
 	cfg *config.Config,
 	userConfig *storage.UserConfig,
+	db storage.Storage,
+	botID int64,
 	msgSender *sender.MessageSender,
+	prefix string,
 ) (*agent.ChatAgentResponse, error) {
 	// Load chat agent
 	chatAgent, err := agent.LoadChatLLM(cfg, userConfig)
@@ -522,22 +720,27 @@ func requestCompletionsFromLLM(
 		return nil, fmt.Errorf("failed to load chat agent: %w", err)
 	}
 
+	// Serve identical stateless prompts from the response cache and record usage stats
+	if db != nil {
+		chatAgent = agent.NewCachedChatAgent(chatAgent, db, botID)
+	}
+
 	// Prepare chat parameters (convert storage history to agent history)
 	params := &agent.LLMChatParams{
 		Prompt:   cfg.SystemInitMessage,
 		Messages: convertStorageToAgentHistory(history),
 	}
 
-	// Create stream handler if stream mode is enabled
-	var streamHandler agent.ChatStreamTextHandler
+	// Create stream handler if stream mode is enabled.
+	// It accumulates the streamed deltas and throttles message edits.
+	var streamHandler *StreamHandler
 	if cfg.StreamMode {
-		streamHandler = func(text string) error {
-			return msgSender.SendRichText(text, cfg.DefaultParseMode)
-		}
+		streamHandler = NewStreamHandler(msgSender, cfg)
+		streamHandler.SetPrefix(prefix)
 	}
 
 	// Request completion
-	response, err := chatAgent.Request(ctx, params, cfg, streamHandler)
+	response, err := RequestCompletionWithStream(ctx, chatAgent, params, cfg, streamHandler)
 	if err != nil {
 		return nil, fmt.Errorf("chat agent request failed: %w", err)
 	}
@@ -563,7 +766,7 @@ func requestCompletionsFromLLM(
 				}
 
 				if content != "" {
-					if err := msgSender.SendRichText(content, cfg.DefaultParseMode); err != nil {
+					if err := msgSender.SendRichText(prefix+content, cfg.DefaultParseMode); err != nil {
 						return nil, fmt.Errorf("failed to send response: %w", err)
 					}
 				}
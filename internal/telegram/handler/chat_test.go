@@ -0,0 +1,63 @@
+package handler
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/tbxark/ChatGPT-Telegram-Workers/go_version/internal/agent"
+	"github.com/tbxark/ChatGPT-Telegram-Workers/go_version/internal/storage"
+)
+
+func TestConvertStorageToAgentContent(t *testing.T) {
+	want := []agent.ContentPart{
+		{Type: "text", Text: "what is this?"},
+		{Type: "image", Image: "data:image/png;base64,AAAA"},
+	}
+
+	// Fresh content from extractUserMessageItem
+	fresh := []storage.ContentPart{
+		{Type: "text", Text: "what is this?"},
+		{Type: "image", Image: "data:image/png;base64,AAAA"},
+	}
+	if got := convertStorageToAgentContent(fresh); !reflect.DeepEqual(got, want) {
+		t.Errorf("convertStorageToAgentContent(fresh) = %v, want %v", got, want)
+	}
+
+	// Content decoded from stored JSON
+	stored := []interface{}{
+		map[string]interface{}{"type": "text", "text": "what is this?"},
+		map[string]interface{}{"type": "image", "image": "data:image/png;base64,AAAA"},
+	}
+	if got := convertStorageToAgentContent(stored); !reflect.DeepEqual(got, want) {
+		t.Errorf("convertStorageToAgentContent(stored) = %v, want %v", got, want)
+	}
+
+	// Plain text is unchanged
+	if got := convertStorageToAgentContent("hello"); got != "hello" {
+		t.Errorf("convertStorageToAgentContent(text) = %v, want hello", got)
+	}
+}
+
+func TestBranchPoint(t *testing.T) {
+	history := []storage.HistoryItem{
+		{Role: "user", Content: "a", MessageIDs: []int{1}},
+		{Role: "assistant", Content: "b", MessageIDs: []int{2, 3}},
+		{Role: "user", Content: "c", MessageIDs: []int{4}},
+		{Role: "assistant", Content: "d", MessageIDs: []int{5}},
+	}
+
+	tests := []struct {
+		messageID int
+		want      int
+	}{
+		{messageID: 3, want: 2},  // Earlier answer: fork after its turn
+		{messageID: 5, want: -1}, // Latest answer: no fork
+		{messageID: 1, want: -1}, // User message
+		{messageID: 9, want: -1}, // Unknown message
+	}
+	for _, tt := range tests {
+		if got := branchPoint(history, tt.messageID); got != tt.want {
+			t.Errorf("branchPoint(%d) = %d, want %d", tt.messageID, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/tbxark/ChatGPT-Telegram-Workers/go_version/internal/config"
+	"github.com/tbxark/ChatGPT-Telegram-Workers/go_version/internal/i18n"
+	"github.com/tbxark/ChatGPT-Telegram-Workers/go_version/internal/storage"
+	"github.com/tbxark/ChatGPT-Telegram-Workers/go_version/internal/telegram/api"
+	"github.com/tbxark/ChatGPT-Telegram-Workers/go_version/internal/telegram/command"
+)
+
+// ConversationHandler handles the switch and delete buttons of the /chats list (cs: and cd:)
+type ConversationHandler struct {
+	config *config.Config
+	i18n   *i18n.I18n
+	prefix string
+}
+
+// NewConversationHandler creates a handler for the /chats buttons with the given prefix
+func NewConversationHandler(cfg *config.Config, i18n *i18n.I18n, prefix string) *ConversationHandler {
+	return &ConversationHandler{
+		config: cfg,
+		i18n:   i18n,
+		prefix: prefix,
+	}
+}
+
+func (h *ConversationHandler) Prefix() string {
+	return h.prefix
+}
+
+func (h *ConversationHandler) NeedAuth() command.AuthChecker {
+	return command.NoAuthRequired
+}
+
+func (h *ConversationHandler) Handle(query *tgbotapi.CallbackQuery, data string, ctx *config.WorkerContext) error {
+	client, ok := ctx.Bot.(*api.Client)
+	if !ok || client == nil {
+		return fmt.Errorf("bot client not available")
+	}
+
+	// Parse callback data: [id]
+	params, err := parseCallbackData(data, h.prefix)
+	if err != nil || len(params) < 1 {
+		return fmt.Errorf("invalid callback data format")
+	}
+	id, ok := params[0].(float64)
+	if !ok {
+		return fmt.Errorf("invalid conversation id")
+	}
+
+	// The conversations belong to the session of the user pressing the button
+	message := *query.Message
+	message.From = query.From
+	sessionCtx := NewSessionContext(&message, ctx.ShareContext.BotID, h.config.GroupChatBotShareMode)
+
+	conversation, err := ctx.DB.GetConversation(uint(id))
+	if err != nil || !inSession(conversation, sessionCtx) {
+		return fmt.Errorf("conversation not found")
+	}
+
+	// Editing removes the buttons unless conversations are left to list
+	var edit tgbotapi.EditMessageTextConfig
+	keyboard := &tgbotapi.InlineKeyboardMarkup{InlineKeyboard: [][]tgbotapi.InlineKeyboardButton{}}
+	switch h.prefix {
+	case command.ConversationSwitchPrefix:
+		if err := ctx.DB.RestoreConversation(sessionCtx, conversation.ID); err != nil {
+			if errors.Is(err, storage.ErrNotFound) {
+				return fmt.Errorf("conversation not found")
+			}
+			return err
+		}
+		text := fmt.Sprintf(h.i18n.Command.Chats.Switched, command.ConversationTitle(conversation))
+		edit = tgbotapi.NewEditMessageText(query.Message.Chat.ID, query.Message.MessageID, text)
+		edit.ReplyMarkup = keyboard
+	case command.ConversationDeletePrefix:
+		if err := ctx.DB.DeleteConversation(conversation.ID); err != nil {
+			return err
+		}
+
+		// Show the remaining conversations
+		conversations, err := ctx.DB.ListConversations(sessionCtx)
+		if err != nil {
+			return err
+		}
+		text, list := command.ConversationList(conversations, h.i18n)
+		if list != nil {
+			keyboard = list
+		}
+		edit = tgbotapi.NewEditMessageText(query.Message.Chat.ID, query.Message.MessageID, h.i18n.Command.Chats.Deleted+"\n\n"+text)
+		edit.ReplyMarkup = keyboard
+	default:
+		return fmt.Errorf("unknown conversation button %s", h.prefix)
+	}
+
+	_, err = client.BotAPI.Send(edit)
+	return err
+}
+
+// inSession reports whether an archived conversation belongs to the session
+func inSession(conversation *storage.Conversation, ctx *storage.SessionContext) bool {
+	return conversation.ChatID == ctx.ChatID &&
+		conversation.BotID == ctx.BotID &&
+		equalID(conversation.UserID, ctx.UserID) &&
+		equalID(conversation.ThreadID, ctx.ThreadID)
+}
+
+// equalID compares optional session identifiers
+func equalID(a, b *int64) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return *a == *b
+}
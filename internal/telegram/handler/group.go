@@ -0,0 +1,167 @@
+package handler
+
+import (
+	"errors"
+	"log/slog"
+	"regexp"
+	"strings"
+	"sync"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/tbxark/ChatGPT-Telegram-Workers/go_version/internal/config"
+	"github.com/tbxark/ChatGPT-Telegram-Workers/go_version/internal/telegram/api"
+)
+
+// ErrIgnored stops the message handler chain without reporting an error
+var ErrIgnored = errors.New("message ignored")
+
+// GroupTriggerFilter decides which group messages the bot responds to
+type GroupTriggerFilter struct {
+	config *config.Config
+
+	mu        sync.Mutex
+	usernames map[int64]string          // Usernames fetched with getMe, by bot ID
+	mentions  map[string]*regexp.Regexp // Compiled mention patterns, by username
+}
+
+// NewGroupTriggerFilter creates a new GroupTriggerFilter
+func NewGroupTriggerFilter(cfg *config.Config) *GroupTriggerFilter {
+	return &GroupTriggerFilter{
+		config:    cfg,
+		usernames: make(map[int64]string),
+		mentions:  make(map[string]*regexp.Regexp),
+	}
+}
+
+// Handle ignores group messages that don't trigger the bot, and strips the bot's mention from the prompt
+func (h *GroupTriggerFilter) Handle(message *tgbotapi.Message, ctx *config.WorkerContext) error {
+	if !message.Chat.IsGroup() && !message.Chat.IsSuperGroup() {
+		return nil
+	}
+	if !h.config.GroupChatBotEnable {
+		slog.Debug("Group chat bot disabled, ignoring message", "chat_id", message.Chat.ID)
+		return ErrIgnored
+	}
+
+	botID := ctx.ShareContext.BotID
+	username := h.botUsername(ctx)
+
+	// Commands are always handled, unless they are addressed to another bot
+	if message.IsCommand() {
+		command := message.CommandWithAt()
+		if at := strings.IndexByte(command, '@'); at >= 0 && username != "" && !strings.EqualFold(command[at+1:], username) {
+			return ErrIgnored
+		}
+		return nil
+	}
+
+	trigger := h.groupTrigger(message.Chat.ID, ctx)
+	text := message.Text
+	if text == "" {
+		text = message.Caption
+	}
+	mention := h.mentionPattern(username)
+	mentioned := (mention != nil && mention.MatchString(text)) || hasTextMention(message, botID)
+
+	triggered := trigger.Has(config.GroupTriggerAlways) ||
+		(trigger.Has(config.GroupTriggerMention) && mentioned) ||
+		(trigger.Has(config.GroupTriggerReply) && repliesTo(message, botID)) ||
+		(trigger.Has(config.GroupTriggerKeyword) && trigger.MatchKeyword(text)) ||
+		(trigger.Has(config.GroupTriggerRandom) && trigger.Roll())
+	if !triggered {
+		return ErrIgnored
+	}
+
+	// The mention addresses the bot and is not part of the prompt
+	if mention != nil {
+		message.Text = stripMention(message.Text, mention)
+		message.Caption = stripMention(message.Caption, mention)
+		if message.Text == "" && message.Caption == "" && len(message.Photo) == 0 {
+			return ErrIgnored
+		}
+	}
+	return nil
+}
+
+// groupTrigger loads the trigger settings of a group
+func (h *GroupTriggerFilter) groupTrigger(chatID int64, ctx *config.WorkerContext) config.GroupTrigger {
+	groupConfig, err := ctx.DB.GetUserConfig(config.GroupSessionContext(chatID, ctx.ShareContext.BotID))
+	if err != nil {
+		slog.Warn("Failed to load group config", "chat_id", chatID, "error", err)
+	}
+	return config.ResolveGroupTrigger(h.config, groupConfig)
+}
+
+// botUsername returns the bot's username from TELEGRAM_BOT_NAME, falling back to getMe
+func (h *GroupTriggerFilter) botUsername(ctx *config.WorkerContext) string {
+	for i, token := range h.config.TelegramAvailableTokens {
+		if token == ctx.ShareContext.BotToken && i < len(h.config.TelegramBotName) {
+			return strings.TrimPrefix(strings.TrimSpace(h.config.TelegramBotName[i]), "@")
+		}
+	}
+
+	botID := ctx.ShareContext.BotID
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if username, ok := h.usernames[botID]; ok {
+		return username
+	}
+
+	client, ok := ctx.Bot.(*api.Client)
+	if !ok {
+		return ""
+	}
+	if client.Self.UserName != "" {
+		return client.Self.UserName
+	}
+	me, err := client.GetMe()
+	if err != nil {
+		slog.Warn("Failed to get bot username", "error", err)
+		return ""
+	}
+	h.usernames[botID] = me.UserName
+	return me.UserName
+}
+
+// mentionPattern matches @username, or returns nil when the username is unknown.
+// Patterns are compiled once per username.
+func (h *GroupTriggerFilter) mentionPattern(username string) *regexp.Regexp {
+	if username == "" {
+		return nil
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if mention, ok := h.mentions[username]; ok {
+		return mention
+	}
+	mention := regexp.MustCompile(`(?i)[ \t]*@` + regexp.QuoteMeta(username) + `\b`)
+	h.mentions[username] = mention
+	return mention
+}
+
+// stripMention removes the mentions from text
+func stripMention(text string, mention *regexp.Regexp) string {
+	if text == "" {
+		return text
+	}
+	return strings.TrimSpace(mention.ReplaceAllString(text, ""))
+}
+
+// hasTextMention reports whether the message mentions the bot by name (for bots without a username link)
+func hasTextMention(message *tgbotapi.Message, botID int64) bool {
+	entities := message.Entities
+	if message.Text == "" {
+		entities = message.CaptionEntities
+	}
+	for _, entity := range entities {
+		if entity.Type == "text_mention" && entity.User != nil && entity.User.ID == botID {
+			return true
+		}
+	}
+	return false
+}
+
+// repliesTo reports whether the message replies to a message of the bot
+func repliesTo(message *tgbotapi.Message, botID int64) bool {
+	return message.ReplyToMessage != nil && message.ReplyToMessage.From != nil && message.ReplyToMessage.From.ID == botID
+}
@@ -0,0 +1,219 @@
+package handler
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/tbxark/ChatGPT-Telegram-Workers/go_version/internal/config"
+	"github.com/tbxark/ChatGPT-Telegram-Workers/go_version/internal/storage"
+	"github.com/tbxark/ChatGPT-Telegram-Workers/go_version/internal/telegram/queue"
+)
+
+const testBotID = int64(42)
+
+// groupConfigStorage returns a fixed group configuration
+type groupConfigStorage struct {
+	mockStorage
+	values map[string]interface{}
+}
+
+func (m *groupConfigStorage) GetUserConfig(ctx *storage.SessionContext) (*storage.UserConfig, error) {
+	return &storage.UserConfig{Values: m.values}, nil
+}
+
+func groupMessage(text string) *tgbotapi.Message {
+	message := &tgbotapi.Message{
+		MessageID: 1,
+		From:      &tgbotapi.User{ID: 7},
+		Chat:      &tgbotapi.Chat{ID: -100, Type: "supergroup"},
+		Text:      text,
+	}
+	if len(text) > 0 && text[0] == '/' {
+		length := len(text)
+		for i, r := range text {
+			if r == ' ' {
+				length = i
+				break
+			}
+		}
+		message.Entities = []tgbotapi.MessageEntity{{Type: "bot_command", Offset: 0, Length: length}}
+	}
+	return message
+}
+
+func TestGroupTriggerFilter(t *testing.T) {
+	replyToBot := groupMessage("what about this?")
+	replyToBot.ReplyToMessage = &tgbotapi.Message{From: &tgbotapi.User{ID: testBotID}}
+	private := groupMessage("hello")
+	private.Chat = &tgbotapi.Chat{ID: 7, Type: "private"}
+
+	tests := []struct {
+		name     string
+		cfg      func(cfg *config.Config)
+		group    map[string]interface{}
+		message  *tgbotapi.Message
+		ignored  bool
+		wantText string
+	}{
+		{name: "private chat", message: private, wantText: "hello"},
+		{name: "group chatter", message: groupMessage("hello everyone"), ignored: true},
+		{name: "mention", message: groupMessage("@test_bot tell me a joke"), wantText: "tell me a joke"},
+		{name: "mention inside text", message: groupMessage("hey @Test_Bot, how are you?"), wantText: "hey, how are you?"},
+		{name: "mention of another bot", message: groupMessage("@test_bot_two hi"), ignored: true},
+		{name: "reply to the bot", message: replyToBot, wantText: "what about this?"},
+		{name: "command", message: groupMessage("/help"), wantText: "/help"},
+		{name: "command for this bot", message: groupMessage("/help@test_bot"), wantText: "/help@test_bot"},
+		{name: "command for another bot", message: groupMessage("/help@other_bot"), ignored: true},
+		{
+			name:    "group bot disabled",
+			cfg:     func(cfg *config.Config) { cfg.GroupChatBotEnable = false },
+			message: groupMessage("@test_bot hi"),
+			ignored: true,
+		},
+		{
+			name:     "always",
+			cfg:      func(cfg *config.Config) { cfg.GroupChatTriggerMode = []string{config.GroupTriggerAlways} },
+			message:  groupMessage("hello everyone"),
+			wantText: "hello everyone",
+		},
+		{
+			name: "keyword",
+			cfg: func(cfg *config.Config) {
+				cfg.GroupChatTriggerMode = []string{config.GroupTriggerKeyword}
+				cfg.GroupChatTriggerKeywords = []string{"weather", "/^q:/"}
+			},
+			message:  groupMessage("How is the WEATHER today?"),
+			wantText: "How is the WEATHER today?",
+		},
+		{
+			name: "keyword pattern",
+			cfg: func(cfg *config.Config) {
+				cfg.GroupChatTriggerMode = []string{config.GroupTriggerKeyword}
+				cfg.GroupChatTriggerKeywords = []string{"weather", "/^q:/"}
+			},
+			message:  groupMessage("q: what is 2+2"),
+			wantText: "q: what is 2+2",
+		},
+		{
+			name: "no keyword",
+			cfg: func(cfg *config.Config) {
+				cfg.GroupChatTriggerMode = []string{config.GroupTriggerKeyword}
+				cfg.GroupChatTriggerKeywords = []string{"weather"}
+			},
+			message: groupMessage("@test_bot hi"),
+			ignored: true,
+		},
+		{
+			name: "random",
+			cfg: func(cfg *config.Config) {
+				cfg.GroupChatTriggerMode = []string{config.GroupTriggerRandom}
+				cfg.GroupChatTriggerProbability = 1
+			},
+			message:  groupMessage("hello everyone"),
+			wantText: "hello everyone",
+		},
+		{
+			name:     "group override",
+			group:    map[string]interface{}{config.GroupTriggerModeKey: "reply, always"},
+			message:  groupMessage("hello everyone"),
+			wantText: "hello everyone",
+		},
+		{
+			name:    "group override without mention",
+			group:   map[string]interface{}{config.GroupTriggerModeKey: "reply"},
+			message: groupMessage("@test_bot hi"),
+			ignored: true,
+		},
+		{name: "mention only", message: groupMessage("@test_bot"), ignored: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{
+				TelegramAvailableTokens: []string{"42:token"},
+				TelegramBotName:         []string{"@test_bot"},
+				GroupChatBotEnable:      true,
+				GroupChatTriggerMode:    []string{config.GroupTriggerMention, config.GroupTriggerReply},
+			}
+			if tt.cfg != nil {
+				tt.cfg(cfg)
+			}
+			ctx := &config.WorkerContext{
+				ShareContext: config.ShareContext{BotToken: "42:token", BotID: testBotID},
+				DB:           &groupConfigStorage{values: tt.group},
+			}
+
+			err := NewGroupTriggerFilter(cfg).Handle(tt.message, ctx)
+			if tt.ignored {
+				if !errors.Is(err, ErrIgnored) {
+					t.Errorf("Handle() error = %v, want ErrIgnored", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Handle() error = %v", err)
+			}
+			if tt.message.Text != tt.wantText {
+				t.Errorf("message text = %q, want %q", tt.message.Text, tt.wantText)
+			}
+		})
+	}
+}
+
+func TestUpdate2MessageHandler_IgnoredMessages(t *testing.T) {
+	called := false
+	handler := NewUpdate2MessageHandler([]MessageHandler{
+		MessageHandlerFunc(func(message *tgbotapi.Message, ctx *config.WorkerContext) error {
+			return ErrIgnored
+		}),
+		MessageHandlerFunc(func(message *tgbotapi.Message, ctx *config.WorkerContext) error {
+			called = true
+			return nil
+		}),
+	})
+
+	err := handler.Handle(&tgbotapi.Update{Message: groupMessage("hello")}, &config.WorkerContext{DB: &mockStorage{}})
+	if err != nil {
+		t.Errorf("Handle() error = %v, want nil for an ignored message", err)
+	}
+	if called {
+		t.Error("handlers after an ignored message were called")
+	}
+}
+
+func TestUpdate2MessageHandler_FiltersBeforeQueue(t *testing.T) {
+	var handled []string
+	handler := NewUpdate2MessageHandler([]MessageHandler{
+		MessageHandlerFunc(func(message *tgbotapi.Message, ctx *config.WorkerContext) error {
+			handled = append(handled, message.Text)
+			return nil
+		}),
+	})
+	handler.SetFilters([]MessageHandler{
+		MessageHandlerFunc(func(message *tgbotapi.Message, ctx *config.WorkerContext) error {
+			if message.Text == "chatter" {
+				return ErrIgnored
+			}
+			return nil
+		}),
+	})
+	sessionQueue := queue.NewSessionQueue(0, 0, 10*time.Millisecond)
+	handler.SetQueue(sessionQueue, true)
+
+	ctx := &config.WorkerContext{DB: &mockStorage{}, ShareContext: config.ShareContext{BotID: testBotID}}
+	for _, text := range []string{"chatter", "hello"} {
+		if err := handler.Handle(&tgbotapi.Update{Message: groupMessage(text)}, ctx); err != nil {
+			t.Fatalf("Handle() error = %v", err)
+		}
+	}
+
+	// Ignored messages never wait in the session, so they can't be coalesced into a turn
+	if len(handled) != 1 || handled[0] != "hello" {
+		t.Errorf("handled = %q, want only the triggering message", handled)
+	}
+	if stats := sessionQueue.Stats(); stats.Processed != 1 || stats.Coalesced != 0 {
+		t.Errorf("Stats() = %+v, want 1 processed and none coalesced", stats)
+	}
+}
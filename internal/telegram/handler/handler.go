@@ -1,8 +1,11 @@
 package handler
 
 import (
+	"time"
+
 	"github.com/tbxark/ChatGPT-Telegram-Workers/go_version/internal/config"
 	"github.com/tbxark/ChatGPT-Telegram-Workers/go_version/internal/i18n"
+	"github.com/tbxark/ChatGPT-Telegram-Workers/go_version/internal/telegram/queue"
 )
 
 // BuildUpdateHandlerChain builds the complete update handler chain
@@ -11,23 +14,47 @@ func BuildUpdateHandlerChain(cfg *config.Config, i18n *i18n.I18n, commandRegistr
 	// Build message handler chain
 	messageHandlers := BuildMessageHandlerChain(cfg, commandRegistry)
 
+	// Serialize messages and reply buttons per session, with bounded concurrency across sessions
+	sessionQueue := queue.NewSessionQueue(
+		cfg.ChatQueueConcurrency,
+		cfg.ChatQueueMaxPending,
+		time.Duration(cfg.ChatQueueCoalesceWindow)*time.Millisecond,
+	)
+	messageHandler := NewUpdate2MessageHandler(messageHandlers)
+	messageHandler.SetFilters(BuildMessageFilterChain(cfg))
+	messageHandler.SetQueue(sessionQueue, cfg.GroupChatBotShareMode)
+	messageHandler.SetReanswerEdits(cfg.ReanswerEditedMessage)
+	messageHandler.SetMediaGroupWindow(time.Duration(cfg.MediaGroupWindow) * time.Millisecond)
+
+	callbackHandler := NewCallbackQueryHandler(cfg, i18n)
+	callbackHandler.SetQueue(sessionQueue)
+
 	// Build update handler chain
 	return NewUpdateHandlerChain(
 		NewEnvChecker(),
 		NewWhiteListFilter(cfg, i18n),
-		NewUpdate2MessageHandler(messageHandlers),
-		NewCallbackQueryHandler(cfg, i18n),
+		messageHandler,
+		callbackHandler,
+		NewInlineQueryHandler(cfg, i18n),
 	)
 }
 
-// BuildMessageHandlerChain builds the complete message handler chain
+// BuildMessageFilterChain builds the message handlers that run before a message is queued,
+// so group messages that don't trigger the bot are never queued or coalesced into a turn
+func BuildMessageFilterChain(cfg *config.Config) []MessageHandler {
+	return []MessageHandler{
+		NewSaveLastMessage(cfg),
+		NewGroupTriggerFilter(cfg),
+	}
+}
+
+// BuildMessageHandlerChain builds the message handler chain that processes the queued messages
 // according to the requirements (2.12, 12.3, 12.4)
 func BuildMessageHandlerChain(cfg *config.Config, commandRegistry CommandRegistry) []MessageHandler {
 	cmdHandler := NewCommandHandler(cfg)
 	cmdHandler.SetRegistry(commandRegistry)
 
 	return []MessageHandler{
-		NewSaveLastMessage(cfg),
 		NewOldMessageFilter(cfg),
 		NewMessageFilter(cfg),
 		cmdHandler,
@@ -10,7 +10,9 @@ import (
 )
 
 // mockStorage is a simple mock implementation of storage.Storage for testing
-type mockStorage struct{}
+type mockStorage struct {
+	storage.Storage
+}
 
 func (m *mockStorage) GetChatHistory(ctx *storage.SessionContext) ([]storage.HistoryItem, error) {
 	return []storage.HistoryItem{}, nil
@@ -141,6 +143,12 @@ func TestWhiteListFilter_PrivateChat(t *testing.T) {
 	if err == nil {
 		t.Error("Expected error for non-whitelisted user")
 	}
+
+	// Edited messages are checked like new ones
+	edited := &tgbotapi.Update{EditedMessage: update.Message}
+	if err := filter.Handle(edited, ctx); err == nil {
+		t.Error("Expected error for edited message of non-whitelisted user")
+	}
 }
 
 func TestUpdate2MessageHandler_IgnoreEditedMessages(t *testing.T) {
@@ -286,8 +294,15 @@ func TestBuildHandlerChains(t *testing.T) {
 	}
 
 	// Verify we have the expected number of handlers
-	expectedHandlers := 5 // SaveLastMessage, OldMessageFilter, MessageFilter, CommandHandler, ChatHandler
+	expectedHandlers := 4 // OldMessageFilter, MessageFilter, CommandHandler, ChatHandler
 	if len(messageHandlers) != expectedHandlers {
 		t.Errorf("Expected %d message handlers, got %d", expectedHandlers, len(messageHandlers))
 	}
+
+	// The filters run before messages are queued
+	filters := BuildMessageFilterChain(cfg)
+	expectedFilters := 2 // SaveLastMessage, GroupTriggerFilter
+	if len(filters) != expectedFilters {
+		t.Errorf("Expected %d message filters, got %d", expectedFilters, len(filters))
+	}
 }
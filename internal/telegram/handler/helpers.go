@@ -4,6 +4,7 @@ import (
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 	"github.com/tbxark/ChatGPT-Telegram-Workers/go_version/internal/config"
 	"github.com/tbxark/ChatGPT-Telegram-Workers/go_version/internal/storage"
+	"github.com/tbxark/ChatGPT-Telegram-Workers/go_version/internal/telegram/api"
 )
 
 // NewSessionContext creates a SessionContext from a Telegram message
@@ -20,9 +21,18 @@ func NewSessionContext(message *tgbotapi.Message, botID int64, shareMode bool) *
 		userID = &uid
 	}
 
-	// Include thread ID for forum/topic messages (if supported by API version)
-	// Note: Forum features may not be available in all versions of telegram-bot-api
-	// We'll handle this gracefully by checking if the fields exist
+	// Each forum topic keeps its own history and configuration
+	if id := api.MessageThreadID(message); id != 0 {
+		tid := int64(id)
+		threadID = &tid
+	}
 
 	return config.NewSessionContextFromChat(chatID, botID, isGroup, shareMode, userID, threadID)
 }
+
+// bindTopic sends the replies to a forum topic message to its topic
+func bindTopic(message *tgbotapi.Message, ctx *config.WorkerContext) {
+	if client, ok := ctx.Bot.(*api.Client); ok && client != nil {
+		ctx.Bot = client.InThread(api.MessageThreadID(message))
+	}
+}
@@ -0,0 +1,284 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/tbxark/ChatGPT-Telegram-Workers/go_version/internal/agent"
+	"github.com/tbxark/ChatGPT-Telegram-Workers/go_version/internal/config"
+	"github.com/tbxark/ChatGPT-Telegram-Workers/go_version/internal/i18n"
+	"github.com/tbxark/ChatGPT-Telegram-Workers/go_version/internal/storage"
+	"github.com/tbxark/ChatGPT-Telegram-Workers/go_version/internal/telegram/api"
+	"github.com/tbxark/ChatGPT-Telegram-Workers/go_version/internal/telegram/sender"
+	"github.com/tbxark/ChatGPT-Telegram-Workers/go_version/internal/telegraph"
+)
+
+// shortAnswerLength is the maximum length of the shortened answer, in runes
+const shortAnswerLength = 200
+
+// InlineQueryHandler answers inline queries (@bot question) with a short completion
+type InlineQueryHandler struct {
+	config *config.Config
+	i18n   *i18n.I18n
+
+	mu        sync.Mutex
+	latest    map[int64]string      // Latest inline query ID of each user, for debouncing
+	usage     map[int64]inlineUsage // Completions of each user today, without a database
+	telegraph *telegraph.Client
+}
+
+// inlineUsage counts the inline completions of a user on a day
+type inlineUsage struct {
+	day   string
+	count int
+}
+
+// inlineMessageContent is an input text message content with entities,
+// which telegram-bot-api v5.5.1 doesn't support
+type inlineMessageContent struct {
+	Text      string                   `json:"message_text"`
+	ParseMode string                   `json:"parse_mode,omitempty"`
+	Entities  []tgbotapi.MessageEntity `json:"entities,omitempty"`
+}
+
+// NewInlineQueryHandler creates a new InlineQueryHandler
+func NewInlineQueryHandler(cfg *config.Config, i18n *i18n.I18n) *InlineQueryHandler {
+	return &InlineQueryHandler{
+		config: cfg,
+		i18n:   i18n,
+		latest: make(map[int64]string),
+		usage:  make(map[int64]inlineUsage),
+	}
+}
+
+// Handle answers an inline query once the user stops typing
+func (h *InlineQueryHandler) Handle(update *tgbotapi.Update, ctx *config.WorkerContext) error {
+	query := update.InlineQuery
+	if query == nil || !h.config.InlineQueryEnable {
+		return nil
+	}
+
+	client, ok := ctx.Bot.(*api.Client)
+	if !ok || client == nil {
+		return fmt.Errorf("bot client not available in context")
+	}
+
+	question := strings.TrimSpace(query.Query)
+	if question == "" || query.From == nil {
+		return h.answer(client, query.ID, nil)
+	}
+
+	// Telegram sends a query for every keystroke: only the last one is answered
+	if !h.settle(query.From.ID, query.ID) {
+		slog.Debug("Inline query superseded", "user_id", query.From.ID)
+		return nil
+	}
+
+	if !h.takeQuota(ctx.DB, ctx.ShareContext.BotID, query.From.ID) {
+		text := fmt.Sprintf(h.i18n.Inline.LimitText, h.config.InlineQueryUserLimit)
+		return h.answer(client, query.ID, []interface{}{
+			h.article("limit", h.i18n.Inline.LimitTitle, text, h.i18n.Inline.LimitDescription),
+		})
+	}
+
+	answer, err := h.complete(question, query.From.ID, ctx)
+	if err != nil {
+		return fmt.Errorf("failed to answer inline query: %w", err)
+	}
+	if answer == "" {
+		return h.answer(client, query.ID, nil)
+	}
+
+	results := []interface{}{
+		h.article("answer", h.i18n.Inline.Answer, answer, preview(answer, 100)),
+	}
+	if short := shortenAnswer(answer); short != answer {
+		results = append(results, h.article("short", h.i18n.Inline.ShortAnswer, short, preview(short, 100)))
+	}
+	if url := h.telegraphPage(question, answer); url != "" {
+		full := h.article("full", h.i18n.Inline.FullAnswer, fmt.Sprintf("%s\n\n%s", question, url), url)
+		full.URL = url
+		results = append(results, full)
+	}
+	return h.answer(client, query.ID, results)
+}
+
+// settle waits for the debounce delay and reports whether the query is still the user's latest
+func (h *InlineQueryHandler) settle(userID int64, queryID string) bool {
+	h.mu.Lock()
+	h.latest[userID] = queryID
+	h.mu.Unlock()
+
+	time.Sleep(time.Duration(h.config.InlineQueryDebounce) * time.Millisecond)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.latest[userID] != queryID {
+		return false
+	}
+	delete(h.latest, userID)
+	return true
+}
+
+// takeQuota counts a completion for the user, reporting false when INLINE_QUERY_USER_LIMIT is reached.
+// Counts are kept in the database, surviving restarts, or in memory without one.
+func (h *InlineQueryHandler) takeQuota(db storage.Storage, botID, userID int64) bool {
+	if h.config.InlineQueryUserLimit <= 0 {
+		return true
+	}
+	if db != nil {
+		allowed, err := db.TakeInlineQuota(botID, userID, h.config.InlineQueryUserLimit)
+		if err == nil {
+			return allowed
+		}
+		slog.Warn("Failed to take inline quota, counting in memory", "error", err)
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	today := time.Now().UTC().Format("2006-01-02")
+	usage := h.usage[userID]
+	if usage.day != today {
+		usage = inlineUsage{day: today}
+	}
+	if usage.count >= h.config.InlineQueryUserLimit {
+		return false
+	}
+	usage.count++
+	h.usage[userID] = usage
+	return true
+}
+
+// complete runs a short non-streaming completion with the inline model
+func (h *InlineQueryHandler) complete(question string, userID int64, ctx *config.WorkerContext) (string, error) {
+	// The user's private chat settings apply, as if the question was asked there
+	if err := ctx.LoadUserConfig(config.NewSessionContext(userID, ctx.ShareContext.BotID, nil, nil)); err != nil {
+		slog.Warn("Failed to load user config", "error", err)
+	}
+
+	cfg := h.config
+	chatAgent, err := agent.LoadChatLLM(cfg, ctx.UserConfig)
+	if err != nil {
+		return "", fmt.Errorf("failed to load chat agent: %w", err)
+	}
+	if cfg.InlineQueryModel != "" {
+		cfg = config.MergeUserConfig(cfg, &storage.UserConfig{
+			Values: map[string]interface{}{chatAgent.ModelKey(): cfg.InlineQueryModel},
+		})
+	}
+	if ctx.DB != nil {
+		chatAgent = agent.NewCachedChatAgent(chatAgent, ctx.DB, ctx.ShareContext.BotID)
+	}
+
+	params := &agent.LLMChatParams{
+		Prompt:    cfg.SystemInitMessage,
+		Messages:  []agent.HistoryItem{{Role: "user", Content: question}},
+		MaxTokens: cfg.InlineQueryMaxTokens,
+	}
+	response, err := chatAgent.Request(context.Background(), params, cfg, nil)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(response.Text()), nil
+}
+
+// telegraphPage publishes the question and answer on Telegraph, returning the page URL or ""
+func (h *InlineQueryHandler) telegraphPage(question, answer string) string {
+	if !h.config.TelegraphEnabled {
+		return ""
+	}
+
+	h.mu.Lock()
+	client := h.telegraph
+	h.mu.Unlock()
+	if client == nil {
+		var err error
+		if client, err = telegraph.NewClient(); err != nil {
+			slog.Warn("Failed to create Telegraph client", "error", err)
+			return ""
+		}
+		h.mu.Lock()
+		h.telegraph = client
+		h.mu.Unlock()
+	}
+
+	content := telegraph.FormatConversation([]telegraph.ConversationMessage{
+		{Role: "user", Content: question},
+		{Role: "assistant", Content: answer},
+	})
+	url, err := client.CreatePage(preview(question, 64), content)
+	if err != nil {
+		slog.Warn("Failed to create Telegraph page", "error", err)
+		return ""
+	}
+	return url
+}
+
+// article creates an article result sending text formatted with DEFAULT_PARSE_MODE
+func (h *InlineQueryHandler) article(id, title, text, description string) tgbotapi.InlineQueryResultArticle {
+	text, parseMode, entities := sender.RenderFirstMessage(text, h.config.DefaultParseMode)
+	article := tgbotapi.NewInlineQueryResultArticle(id, title, text)
+	article.Description = description
+	article.InputMessageContent = inlineMessageContent{
+		Text:      text,
+		ParseMode: parseMode,
+		Entities:  entities,
+	}
+	return article
+}
+
+// answer sends the results of an inline query; they are personal, since answers depend on user settings
+func (h *InlineQueryHandler) answer(client *api.Client, queryID string, results []interface{}) error {
+	if results == nil {
+		results = []interface{}{}
+	}
+	_, err := client.Request(tgbotapi.InlineConfig{
+		InlineQueryID: queryID,
+		Results:       results,
+		CacheTime:     h.config.InlineQueryCacheTime,
+		IsPersonal:    true,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to answer inline query: %w", err)
+	}
+	return nil
+}
+
+// shortenAnswer returns the first paragraph of an answer, cut at a word to shortAnswerLength runes
+func shortenAnswer(answer string) string {
+	short := answer
+	if i := strings.Index(short, "\n\n"); i >= 0 {
+		short = short[:i]
+	}
+	short = strings.TrimSpace(short)
+
+	runes := []rune(short)
+	if len(runes) <= shortAnswerLength {
+		return short
+	}
+	cut := shortAnswerLength
+	for i := shortAnswerLength; i > shortAnswerLength/2; i-- {
+		if runes[i] == ' ' || runes[i] == '\n' {
+			cut = i
+			break
+		}
+	}
+	return strings.TrimSpace(string(runes[:cut])) + "…"
+}
+
+// preview returns the first line of text, cut to length runes
+func preview(text string, length int) string {
+	if i := strings.IndexByte(text, '\n'); i >= 0 {
+		text = text[:i]
+	}
+	runes := []rune(strings.TrimSpace(text))
+	if len(runes) <= length {
+		return string(runes)
+	}
+	return string(runes[:length-1]) + "…"
+}
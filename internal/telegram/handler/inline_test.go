@@ -0,0 +1,53 @@
+package handler
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/tbxark/ChatGPT-Telegram-Workers/go_version/internal/config"
+	"github.com/tbxark/ChatGPT-Telegram-Workers/go_version/internal/i18n"
+)
+
+func TestShortenAnswer(t *testing.T) {
+	long := strings.Repeat("word ", 60)
+
+	tests := []struct {
+		name   string
+		answer string
+		want   string
+	}{
+		{"short", "Paris.", "Paris."},
+		{"first paragraph", "Paris.\n\nIt is the capital of France.", "Paris."},
+		{"cut at a word", long, strings.TrimSpace(long[:200]) + "…"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := shortenAnswer(tt.answer); got != tt.want {
+				t.Errorf("shortenAnswer() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInlineQueryHandler_TakeQuota(t *testing.T) {
+	h := NewInlineQueryHandler(&config.Config{InlineQueryUserLimit: 2}, i18n.LoadI18n("en"))
+
+	for i := 0; i < 2; i++ {
+		if !h.takeQuota(nil, testBotID, 1) {
+			t.Fatalf("takeQuota() = false on completion %d, want true", i+1)
+		}
+	}
+	if h.takeQuota(nil, testBotID, 1) {
+		t.Error("takeQuota() = true beyond the limit")
+	}
+	if !h.takeQuota(nil, testBotID, 2) {
+		t.Error("takeQuota() = false for another user")
+	}
+
+	unlimited := NewInlineQueryHandler(&config.Config{}, i18n.LoadI18n("en"))
+	for i := 0; i < 10; i++ {
+		if !unlimited.takeQuota(nil, testBotID, 1) {
+			t.Fatal("takeQuota() = false without a limit")
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package handler
 
 import (
+	"errors"
 	"fmt"
 	"log/slog"
 	"time"
@@ -55,6 +56,11 @@ func (h *OldMessageFilter) Handle(message *tgbotapi.Message, ctx *config.WorkerC
 		return nil
 	}
 
+	// Edits repeat the ID of the message they change
+	if editMode, _ := ctx.Context["edit_mode"].(bool); editMode {
+		return nil
+	}
+
 	sessionCtx := NewSessionContext(message, ctx.ShareContext.BotID, h.config.GroupChatBotShareMode)
 
 	// Get stored message IDs
@@ -231,6 +237,9 @@ func (c *MessageHandlerChain) Handle(message *tgbotapi.Message, ctx *config.Work
 	for _, handler := range c.handlers {
 		if err := handler.Handle(message, ctx); err != nil {
 			// If a handler returns an error, stop the chain
+			if errors.Is(err, ErrIgnored) {
+				return nil
+			}
 			return err
 		}
 	}
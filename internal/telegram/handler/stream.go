@@ -9,6 +9,7 @@ import (
 
 	"github.com/tbxark/ChatGPT-Telegram-Workers/go_version/internal/agent"
 	"github.com/tbxark/ChatGPT-Telegram-Workers/go_version/internal/config"
+	"github.com/tbxark/ChatGPT-Telegram-Workers/go_version/internal/telegram/markdown"
 	"github.com/tbxark/ChatGPT-Telegram-Workers/go_version/internal/telegram/sender"
 )
 
@@ -18,9 +19,11 @@ type StreamHandler struct {
 	config             *config.Config
 	buffer             strings.Builder
 	lastSentText       string
+	lastDisplayed      string
 	minInterval        time.Duration
 	lastUpdateTime     time.Time
 	parseMode          string
+	prefix             string // Text of the reply shown before the streamed text
 	retryCount         int
 	maxRetries         int
 	retryDelay         time.Duration
@@ -50,6 +53,11 @@ func (h *StreamHandler) SetParseMode(mode string) {
 	h.parseMode = mode
 }
 
+// SetPrefix sets the text shown before the streamed text, e.g. the reply being continued
+func (h *StreamHandler) SetPrefix(prefix string) {
+	h.prefix = prefix
+}
+
 // OnStreamText is the callback function for streaming text
 // It accumulates text and sends updates respecting the minimum interval
 func (h *StreamHandler) OnStreamText(text string) error {
@@ -71,25 +79,23 @@ func (h *StreamHandler) OnStreamText(text string) error {
 
 // shouldSendUpdate determines if we should send an update based on timing and content
 func (h *StreamHandler) shouldSendUpdate(currentText string) bool {
-	// Always send if this is the first update
-	if h.lastSentText == "" {
-		return true
-	}
-
 	// Don't send if text hasn't changed
 	if currentText == h.lastSentText {
 		return false
 	}
 
-	// Check minimum interval
-	if h.minInterval > 0 {
+	// Check minimum interval (the first update is sent right away)
+	if h.lastSentText != "" && h.minInterval > 0 {
 		elapsed := time.Since(h.lastUpdateTime)
 		if elapsed < h.minInterval {
 			return false
 		}
 	}
 
-	return true
+	// Don't send if the rendered message would look the same or be empty,
+	// e.g. when only the opening marker of a code block has arrived
+	displayed := h.displayText(currentText)
+	return strings.TrimSpace(displayed) != "" && displayed != h.lastDisplayed
 }
 
 // sendUpdate sends the current text to Telegram with retry logic
@@ -106,14 +112,15 @@ func (h *StreamHandler) sendUpdate(text string) error {
 
 		// Try to send the update
 		if h.parseMode != "" {
-			err = h.sender.SendRichText(text, h.parseMode)
+			err = h.sender.SendRichText(h.prefix+text, h.parseMode)
 		} else {
-			err = h.sender.SendPlainText(text)
+			err = h.sender.SendPlainText(h.prefix + text)
 		}
 
 		if err == nil {
 			// Success
 			h.lastSentText = text
+			h.lastDisplayed = h.displayText(text)
 			h.lastUpdateTime = time.Now()
 			h.retryCount = 0
 			return nil
@@ -134,6 +141,20 @@ func (h *StreamHandler) sendUpdate(text string) error {
 	return fmt.Errorf("max retries exceeded: %w", err)
 }
 
+// displayText returns a representation of the message Telegram shows for text.
+// Telegram trims trailing whitespace, so it is ignored.
+func (h *StreamHandler) displayText(text string) string {
+	if h.parseMode != sender.ParseModeMarkdown {
+		return strings.TrimRight(text, " \n")
+	}
+	plain, entities := markdown.Render(text)
+	plain = strings.TrimRight(plain, " \n")
+	if len(entities) == 0 {
+		return plain
+	}
+	return fmt.Sprintf("%s\x00%v", plain, entities)
+}
+
 // calculateRetryDelay calculates the delay for the next retry using exponential backoff
 func (h *StreamHandler) calculateRetryDelay(attempt int) time.Duration {
 	delay := float64(h.retryDelay) * float64(attempt) * h.retryBackoffFactor
@@ -166,6 +187,7 @@ func (h *StreamHandler) GetFinalText() string {
 func (h *StreamHandler) Reset() {
 	h.buffer.Reset()
 	h.lastSentText = ""
+	h.lastDisplayed = ""
 	h.lastUpdateTime = time.Time{}
 	h.retryCount = 0
 }
@@ -439,3 +439,38 @@ func TestRequestCompletionWithStream_Error(t *testing.T) {
 		t.Errorf("Error should contain 'streaming request failed', got: %v", reqErr)
 	}
 }
+
+func TestStreamHandler_SkipsUnchangedRendering(t *testing.T) {
+	cfg := &config.Config{
+		TelegramMinStreamInterval: 0,
+		DefaultParseMode:          sender.ParseModeMarkdown,
+		StreamMode:                true,
+	}
+	handler := NewStreamHandler(nil, cfg)
+
+	// Nothing visible yet
+	if handler.shouldSendUpdate("```") {
+		t.Error("shouldSendUpdate() = true for text that renders empty")
+	}
+	if !handler.shouldSendUpdate("hello **world**") {
+		t.Error("shouldSendUpdate() = false for the first visible text")
+	}
+
+	handler.lastSentText = "hello **world**"
+	handler.lastDisplayed = handler.displayText(handler.lastSentText)
+
+	// Only the opening marker of a code block arrived
+	if handler.shouldSendUpdate("hello **world**\n```go") {
+		t.Error("shouldSendUpdate() = true although the rendered message is unchanged")
+	}
+	// Code arrived
+	if !handler.shouldSendUpdate("hello **world**\n```go\nfmt") {
+		t.Error("shouldSendUpdate() = false for new visible text")
+	}
+	// Closing bold changes the entities
+	handler.lastSentText = "hello **world"
+	handler.lastDisplayed = handler.displayText(handler.lastSentText)
+	if !handler.shouldSendUpdate("hello **world**") {
+		t.Error("shouldSendUpdate() = false although the formatting changed")
+	}
+}
@@ -0,0 +1,312 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/tbxark/ChatGPT-Telegram-Workers/go_version/internal/agent"
+	"github.com/tbxark/ChatGPT-Telegram-Workers/go_version/internal/config"
+	"github.com/tbxark/ChatGPT-Telegram-Workers/go_version/internal/i18n"
+	"github.com/tbxark/ChatGPT-Telegram-Workers/go_version/internal/sillytavern"
+	"github.com/tbxark/ChatGPT-Telegram-Workers/go_version/internal/storage"
+	"github.com/tbxark/ChatGPT-Telegram-Workers/go_version/internal/telegram/api"
+	"github.com/tbxark/ChatGPT-Telegram-Workers/go_version/internal/telegram/command"
+	"github.com/tbxark/ChatGPT-Telegram-Workers/go_version/internal/telegram/queue"
+	"github.com/tbxark/ChatGPT-Telegram-Workers/go_version/internal/telegram/sender"
+)
+
+// Callback data prefixes of the buttons under bot replies
+const (
+	regeneratePrefix = "rg:"
+	continuePrefix   = "ct:"
+	swipePrefix      = command.ReplySwipePrefix
+)
+
+// continuePrompt asks the model to continue the reply it was cut off in
+const continuePrompt = "Continue your previous reply exactly where it stopped, without repeating any of it."
+
+// replyKeyboard creates the buttons of a reply: ◀/▶ page between its alternatives
+// (SillyTavern-style swipes), Regenerate adds a new alternative and Continue extends it
+func replyKeyboard(reply storage.HistoryItem, lang string) tgbotapi.InlineKeyboardMarkup {
+	texts := i18n.LoadI18n(lang)
+
+	swipeRow := command.SwipeRow(reply)
+
+	rows := [][]tgbotapi.InlineKeyboardButton{}
+	if len(swipeRow) > 0 {
+		rows = append(rows, swipeRow)
+	}
+	rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("🔄 "+texts.CallbackQuery.Regenerate, regeneratePrefix),
+		tgbotapi.NewInlineKeyboardButtonData("➡️ "+texts.CallbackQuery.Continue, continuePrefix),
+	))
+	return tgbotapi.NewInlineKeyboardMarkup(rows...)
+}
+
+// lastAssistantItem returns the last assistant message of items, or nil
+func lastAssistantItem(items []storage.HistoryItem) *storage.HistoryItem {
+	for i := len(items) - 1; i >= 0; i-- {
+		if items[i].Role == "assistant" {
+			return &items[i]
+		}
+	}
+	return nil
+}
+
+// replySwipes returns the alternatives of a reply, which has a single one until it is regenerated
+func replySwipes(reply storage.HistoryItem) []interface{} {
+	if len(reply.Swipes) > 0 {
+		return append([]interface{}(nil), reply.Swipes...)
+	}
+	return []interface{}{reply.Content}
+}
+
+// replyText returns the text of the content of a reply
+func replyText(content interface{}) string {
+	response := &agent.ChatAgentResponse{Messages: []agent.HistoryItem{
+		{Role: "assistant", Content: convertStorageToAgentContent(content)},
+	}}
+	return response.Text()
+}
+
+// ReplyButtonHandler handles the Regenerate, Continue and swipe buttons of bot replies (rg:, ct: and sw:)
+type ReplyButtonHandler struct {
+	config *config.Config
+	prefix string
+	queue  *queue.SessionQueue
+}
+
+// NewReplyButtonHandler creates a handler for the reply buttons with the given prefix
+func NewReplyButtonHandler(cfg *config.Config, prefix string) *ReplyButtonHandler {
+	return &ReplyButtonHandler{
+		config: cfg,
+		prefix: prefix,
+	}
+}
+
+// SetQueue changes replies in turn with the messages of their session
+func (h *ReplyButtonHandler) SetQueue(q *queue.SessionQueue) {
+	h.queue = q
+}
+
+func (h *ReplyButtonHandler) Prefix() string {
+	return h.prefix
+}
+
+func (h *ReplyButtonHandler) NeedAuth() command.AuthChecker {
+	return command.ShareModeGroup
+}
+
+func (h *ReplyButtonHandler) Handle(query *tgbotapi.CallbackQuery, data string, ctx *config.WorkerContext) error {
+	client, ok := ctx.Bot.(*api.Client)
+	if !ok || client == nil {
+		return fmt.Errorf("bot client not available")
+	}
+
+	// The reply belongs to the session of the user pressing the button
+	message := *query.Message
+	message.From = query.From
+	cfg := ctx.Config
+	sessionCtx := NewSessionContext(&message, ctx.ShareContext.BotID, cfg.GroupChatBotShareMode)
+
+	// The reply is changed in turn with the messages of the session, which would otherwise save over each other's history
+	if h.queue == nil {
+		return h.handle(query, data, ctx, client, sessionCtx)
+	}
+	return h.queue.Do(queue.SessionKey(sessionCtx), func() error {
+		return h.handle(query, data, ctx, client, sessionCtx)
+	})
+}
+
+// handle changes the latest reply of the session according to the button
+func (h *ReplyButtonHandler) handle(query *tgbotapi.CallbackQuery, data string, ctx *config.WorkerContext, client *api.Client, sessionCtx *storage.SessionContext) error {
+	cfg := ctx.Config
+	if err := ctx.LoadUserConfig(sessionCtx); err != nil {
+		slog.Error("Failed to load user config", "error", err)
+	}
+	cfg = applyTopicBindings(cfg, sessionCtx, ctx)
+
+	history, err := loadHistory(sessionCtx, ctx.DB)
+	if err != nil {
+		return err
+	}
+
+	// Only the latest reply can be changed
+	if len(history) == 0 || history[len(history)-1].Role != "assistant" || !slices.Contains(lastReplyMessageIDs(history), query.Message.MessageID) {
+		return fmt.Errorf("this reply can no longer be changed")
+	}
+
+	// The latest reply of a character group is shown by its own messages, after the name of its character
+	replyIDs := lastReplyMessageIDs(history)
+	namePrefix := ""
+	prompt := characterPrompt(topicCharacterID(sessionCtx, ctx), "", sessionCtx, cfg, ctx, query.From)
+	if speaker := history[len(history)-1].Name; speaker != "" {
+		replyIDs = history[len(history)-1].MessageIDs
+		members := topicGroupMembers(sessionCtx, ctx)
+		if member := command.FindGroupMember(members, speaker); member != nil {
+			prompt = groupSpeakerPrompt(*member, members, sessionCtx, cfg, ctx, query.From)
+		}
+		namePrefix = command.GroupNamePrefix(cfg, speaker)
+	}
+
+	msgSender := sender.NewReplySender(client, query.Message)
+	msgSender.Resume(replyIDs)
+
+	switch h.prefix {
+	case swipePrefix:
+		params, err := parseCallbackData(data, h.prefix)
+		if err != nil || len(params) < 1 {
+			return fmt.Errorf("invalid callback data format")
+		}
+		direction, _ := params[0].(float64)
+		history, err = h.swipe(history, int(direction), cfg, msgSender, namePrefix)
+		if err != nil {
+			return err
+		}
+	case regeneratePrefix:
+		history, err = h.regenerate(history, cfg, ctx, msgSender, namePrefix, prompt)
+		if err != nil {
+			return err
+		}
+	case continuePrefix:
+		history, err = h.continueReply(history, cfg, ctx, msgSender, namePrefix, prompt)
+		if err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown reply button %s", h.prefix)
+	}
+
+	if err := saveHistory(sessionCtx, ctx.DB, trimHistory(history, cfg)); err != nil {
+		return err
+	}
+	return nil
+}
+
+// swipe shows the previous or next alternative of the latest reply and makes it the canonical one.
+// Replies of a character group are shown after the name prefix of their character.
+func (h *ReplyButtonHandler) swipe(history []storage.HistoryItem, direction int, cfg *config.Config, msgSender *sender.MessageSender, namePrefix string) ([]storage.HistoryItem, error) {
+	reply := &history[len(history)-1]
+	swipes := replySwipes(*reply)
+	index := reply.SwipeIndex + direction
+	if direction == 0 || index < 0 || index >= len(swipes) {
+		return history, nil
+	}
+
+	reply.Swipes = swipes
+	reply.SwipeIndex = index
+	reply.Content = swipes[index]
+
+	// A greeting, before the first user message, can only be swiped
+	keyboard := replyKeyboard(*reply, cfg.Language)
+	if lastUserIndex(history) < 0 {
+		keyboard = *command.GreetingKeyboard(*reply)
+	}
+	msgSender.SetKeyboard(&keyboard)
+	if err := msgSender.SendRichText(namePrefix+replyText(reply.Content), cfg.DefaultParseMode); err != nil {
+		return nil, fmt.Errorf("failed to show reply: %w", err)
+	}
+	reply.MessageIDs = msgSender.MessageIDs()
+	return history, nil
+}
+
+// regenerate requests a new alternative of the latest reply, editing the reply to show it
+func (h *ReplyButtonHandler) regenerate(history []storage.HistoryItem, cfg *config.Config, ctx *config.WorkerContext, msgSender *sender.MessageSender, namePrefix string, promptFn promptFunc) ([]storage.HistoryItem, error) {
+	swipes := replySwipes(history[len(history)-1])
+
+	// The reply is requested again for the conversation up to the last user message,
+	// after the replies of the previous characters of a group
+	turn := lastUserIndex(history)
+	if turn < 0 {
+		return nil, fmt.Errorf("redo message not found")
+	}
+	start := turn + 1
+	speaker := history[len(history)-1].Name
+	if speaker != "" {
+		start = len(history) - 1
+	}
+	prompt := append([]storage.HistoryItem(nil), history[:start]...)
+	if speaker != "" {
+		prompt = groupPrompt(prompt)
+	}
+	prompt = trimHistory(prompt, cfg)
+	if cfg.HistoryImagePlaceholder != "" {
+		prompt = replaceImagePlaceholder(prompt, cfg.HistoryImagePlaceholder)
+	}
+
+	response, err := h.request(prompt, promptFn, ctx, msgSender, namePrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	responseItems := convertAgentToStorageHistory(response.Messages)
+	reply := lastAssistantItem(responseItems)
+	if reply == nil {
+		return nil, fmt.Errorf("no reply generated")
+	}
+	if speaker != "" {
+		if text, ok := reply.Content.(string); ok {
+			reply.Content = sillytavern.StripSpeakerName(text, speaker)
+		}
+		reply.Name = speaker
+	}
+	reply.Swipes = append(swipes, reply.Content)
+	reply.SwipeIndex = len(reply.Swipes) - 1
+	reply.MessageIDs = msgSender.MessageIDs()
+
+	if err := msgSender.AttachKeyboard(replyKeyboard(*reply, cfg.Language)); err != nil {
+		slog.Warn("Failed to attach reply buttons", "error", err)
+	}
+	return append(history[:start], responseItems...), nil
+}
+
+// continueReply asks the model to continue the latest reply, appending the continuation to it
+func (h *ReplyButtonHandler) continueReply(history []storage.HistoryItem, cfg *config.Config, ctx *config.WorkerContext, msgSender *sender.MessageSender, namePrefix string, promptFn promptFunc) ([]storage.HistoryItem, error) {
+	reply := &history[len(history)-1]
+	text, ok := reply.Content.(string)
+	if !ok {
+		return nil, fmt.Errorf("only text replies can be continued")
+	}
+
+	prompt := append(groupPrompt(history), storage.HistoryItem{Role: "user", Content: continuePrompt})
+	prompt = trimHistory(prompt, cfg)
+	if cfg.HistoryImagePlaceholder != "" {
+		prompt = replaceImagePlaceholder(prompt, cfg.HistoryImagePlaceholder)
+	}
+
+	response, err := h.request(prompt, promptFn, ctx, msgSender, namePrefix+text)
+	if err != nil {
+		return nil, err
+	}
+
+	reply.Content = text + response.Text()
+	if len(reply.Swipes) > 0 {
+		reply.Swipes[reply.SwipeIndex] = reply.Content
+	}
+	reply.MessageIDs = msgSender.MessageIDs()
+
+	if err := msgSender.AttachKeyboard(replyKeyboard(*reply, cfg.Language)); err != nil {
+		slog.Warn("Failed to attach reply buttons", "error", err)
+	}
+	return history, nil
+}
+
+// request requests a completion for the reply buttons, bypassing the response cache
+// since a cached answer would only repeat the reply
+func (h *ReplyButtonHandler) request(history []storage.HistoryItem, promptFn promptFunc, ctx *config.WorkerContext, msgSender *sender.MessageSender, prefix string) (*agent.ChatAgentResponse, error) {
+	prompt, cfg := promptFn(history)
+	uncached := *cfg
+	uncached.ResponseCacheEnabled = false
+
+	if err := msgSender.SendChatAction("typing"); err != nil {
+		slog.Warn("Failed to send typing action", "error", err)
+	}
+	response, err := requestCompletionsFromLLM(context.Background(), prompt, &uncached, ctx.UserConfig, ctx.DB, ctx.ShareContext.BotID, msgSender, prefix)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get LLM response: %w", err)
+	}
+	return response, nil
+}
@@ -0,0 +1,77 @@
+package handler
+
+import (
+	"testing"
+
+	"github.com/tbxark/ChatGPT-Telegram-Workers/go_version/internal/storage"
+)
+
+// keyboardData returns the callback data of the buttons of each row
+func keyboardData(reply storage.HistoryItem) [][]string {
+	var rows [][]string
+	for _, row := range replyKeyboard(reply, "en").InlineKeyboard {
+		var data []string
+		for _, button := range row {
+			data = append(data, *button.CallbackData)
+		}
+		rows = append(rows, data)
+	}
+	return rows
+}
+
+func TestReplyKeyboard(t *testing.T) {
+	tests := []struct {
+		name  string
+		reply storage.HistoryItem
+		want  [][]string
+	}{
+		{
+			name:  "single reply",
+			reply: storage.HistoryItem{Role: "assistant", Content: "a"},
+			want:  [][]string{{"rg:", "ct:"}},
+		},
+		{
+			name:  "first of two",
+			reply: storage.HistoryItem{Role: "assistant", Content: "a", Swipes: []interface{}{"a", "b"}},
+			want:  [][]string{{"sw:[0]", "sw:[1]"}, {"rg:", "ct:"}},
+		},
+		{
+			name:  "middle of three",
+			reply: storage.HistoryItem{Role: "assistant", Content: "b", Swipes: []interface{}{"a", "b", "c"}, SwipeIndex: 1},
+			want:  [][]string{{"sw:[-1]", "sw:[0]", "sw:[1]"}, {"rg:", "ct:"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := keyboardData(tt.reply)
+			if len(got) != len(tt.want) {
+				t.Fatalf("replyKeyboard() rows = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if len(got[i]) != len(tt.want[i]) {
+					t.Fatalf("replyKeyboard() rows = %v, want %v", got, tt.want)
+				}
+				for j := range got[i] {
+					if got[i][j] != tt.want[i][j] {
+						t.Errorf("replyKeyboard() rows = %v, want %v", got, tt.want)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestReplySwipes(t *testing.T) {
+	reply := storage.HistoryItem{Role: "assistant", Content: "a"}
+	if got := replySwipes(reply); len(got) != 1 || got[0] != "a" {
+		t.Errorf("replySwipes() = %v, want [a]", got)
+	}
+
+	reply.Swipes = []interface{}{"a", "b"}
+	got := replySwipes(reply)
+	got[0] = "changed"
+	if reply.Swipes[0] != "a" {
+		t.Error("replySwipes() must return a copy")
+	}
+}
@@ -0,0 +1,164 @@
+package handler
+
+import (
+	"log/slog"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/tbxark/ChatGPT-Telegram-Workers/go_version/internal/agent"
+	"github.com/tbxark/ChatGPT-Telegram-Workers/go_version/internal/config"
+	"github.com/tbxark/ChatGPT-Telegram-Workers/go_version/internal/sillytavern"
+	"github.com/tbxark/ChatGPT-Telegram-Workers/go_version/internal/storage"
+	"github.com/tbxark/ChatGPT-Telegram-Workers/go_version/internal/telegram/command"
+)
+
+// applyTopicBindings returns the configuration of a session of a forum topic, or of a chat outside of topics:
+// the model and system prompt bound with /topic override the global configuration.
+// The character card bound with /topic prompts the replies instead, see characterPrompt.
+func applyTopicBindings(cfg *config.Config, sessionCtx *storage.SessionContext, ctx *config.WorkerContext) *config.Config {
+	topicConfig := loadTopicConfig(sessionCtx, ctx)
+	if topicConfig == nil || len(topicConfig.Values) == 0 {
+		return cfg
+	}
+	return config.MergeUserConfig(cfg, topicConfig)
+}
+
+// topicCharacterID returns the character card bound to the forum topic or the chat of a session, or 0
+func topicCharacterID(sessionCtx *storage.SessionContext, ctx *config.WorkerContext) uint {
+	return config.TopicCharacterID(loadTopicConfig(sessionCtx, ctx))
+}
+
+// loadTopicConfig loads the bindings of the forum topic of a session, or of its chat outside of topics
+func loadTopicConfig(sessionCtx *storage.SessionContext, ctx *config.WorkerContext) *storage.UserConfig {
+	if ctx.DB == nil {
+		return nil
+	}
+
+	var threadID int64
+	if sessionCtx.ThreadID != nil {
+		threadID = *sessionCtx.ThreadID
+	}
+	topicConfig, err := ctx.DB.GetUserConfig(config.TopicSessionContext(sessionCtx.ChatID, sessionCtx.BotID, threadID))
+	if err != nil {
+		slog.Warn("Failed to load topic config", "chat_id", sessionCtx.ChatID, "thread_id", threadID, "error", err)
+		return nil
+	}
+	return topicConfig
+}
+
+// promptFunc returns the prompt of a completion for a history, and the configuration to request it with
+type promptFunc func(history []storage.HistoryItem) ([]storage.HistoryItem, *config.Config)
+
+// characterPrompt returns the promptFunc of the replies of a character card. The prompt is built by the SillyTavern
+// request builder: the card, the persona of the user, the example dialogues that fit in the context length and the
+// world info the history triggers, from the user's active world book and the card's character book, laid out by the
+// user's active preset. It includes the system messages, the configuration has no system prompt.
+// The names of the characters of a group chat are its {{group}}, and the prompt asks for a reply of the character only.
+// Without a character card, or when it cannot be loaded, the history is sent with the configured system prompt.
+func characterPrompt(id uint, group string, sessionCtx *storage.SessionContext, cfg *config.Config, ctx *config.WorkerContext, user *tgbotapi.User) promptFunc {
+	return func(history []storage.HistoryItem) ([]storage.HistoryItem, *config.Config) {
+		if id == 0 || ctx.DB == nil {
+			return history, cfg
+		}
+		prompt, err := buildCharacterPrompt(id, group, history, sessionCtx, cfg, ctx, user)
+		if err != nil {
+			slog.Warn("Failed to build character prompt", "card_id", id, "error", err)
+			return history, cfg
+		}
+		promptCfg := *cfg
+		promptCfg.SystemInitMessage = ""
+		return prompt, &promptCfg
+	}
+}
+
+// buildCharacterPrompt builds the prompt of a reply of a character card with the request builder
+func buildCharacterPrompt(id uint, group string, history []storage.HistoryItem, sessionCtx *storage.SessionContext, cfg *config.Config, ctx *config.WorkerContext, user *tgbotapi.User) ([]storage.HistoryItem, error) {
+	card, err := ctx.DB.GetCharacterCard(id)
+	if err != nil {
+		return nil, err
+	}
+	characterManager := sillytavern.NewCharacterCardManager(ctx.DB)
+	characterData, err := characterManager.ParseCardData(card.Data)
+	if err != nil {
+		return nil, err
+	}
+
+	// Presets are chosen by the provider of the chat model
+	apiType := ""
+	if chatAgent, err := agent.LoadChatLLM(cfg, ctx.UserConfig); err == nil {
+		apiType = chatAgent.Name()
+	}
+	var userID *int64
+	if user != nil {
+		userID = &user.ID
+	}
+
+	// The message replied to is the end of the history, where the world info is scanned for
+	builder := sillytavern.NewRequestBuilder(characterManager, sillytavern.NewWorldBookManager(ctx.DB), sillytavern.NewPresetManager(ctx.DB), nil)
+	builder.SetWorldInfoConfig(sillytavern.NewWorldInfoConfig(cfg))
+	request, err := builder.BuildRequest(&sillytavern.BuildContext{
+		UserID:    userID,
+		History:   textHistory(history),
+		APIType:   apiType,
+		Session:   sessionCtx,
+		UserName:  command.UserDisplayName(user),
+		Persona:   command.ActivePersona(ctx.DB, user),
+		Character: card,
+		Group:     group,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	prompt := make([]storage.HistoryItem, len(request.Messages))
+	for i, message := range request.Messages {
+		prompt[i] = storage.HistoryItem{Role: message.Role, Content: message.Content}
+	}
+	if group != "" {
+		nudge := sillytavern.GroupNudge(sillytavern.NewMacroContext(characterData, command.UserDisplayName(user), nil))
+		prompt = append(prompt, storage.HistoryItem{Role: "system", Content: nudge})
+	}
+	return withLastImages(prompt, history), nil
+}
+
+// textHistory returns the history with the text of its multi-part messages, for the request builder
+func textHistory(history []storage.HistoryItem) []storage.HistoryItem {
+	result := make([]storage.HistoryItem, len(history))
+	for i, item := range history {
+		result[i] = item
+		if _, ok := item.Content.(string); !ok {
+			result[i].Content = replyText(item.Content)
+		}
+	}
+	return result
+}
+
+// withLastImages gives the last user message of a prompt the images of the last user message of the history,
+// which the request builder leaves out
+func withLastImages(prompt []storage.HistoryItem, history []storage.HistoryItem) []storage.HistoryItem {
+	turn := lastUserIndex(history)
+	if turn < 0 {
+		return prompt
+	}
+	parts, ok := convertStorageToAgentContent(history[turn].Content).([]agent.ContentPart)
+	if !ok {
+		return prompt
+	}
+	var images []storage.ContentPart
+	for _, part := range parts {
+		if part.Type == "image" {
+			images = append(images, storage.ContentPart{Type: part.Type, Image: part.Image})
+		}
+	}
+	if len(images) == 0 {
+		return prompt
+	}
+
+	for i := len(prompt) - 1; i >= 0; i-- {
+		if prompt[i].Role == "user" {
+			text, _ := prompt[i].Content.(string)
+			prompt[i].Content = append([]storage.ContentPart{{Type: "text", Text: text}}, images...)
+			break
+		}
+	}
+	return prompt
+}
@@ -0,0 +1,47 @@
+package handler
+
+import (
+	"testing"
+
+	"github.com/tbxark/ChatGPT-Telegram-Workers/go_version/internal/config"
+	"github.com/tbxark/ChatGPT-Telegram-Workers/go_version/internal/telegram/api"
+)
+
+func TestNewSessionContext_ForumTopic(t *testing.T) {
+	message := groupMessage("hello")
+	message.MessageID = 501
+	message.Chat.ID = -1005
+
+	sessionCtx := NewSessionContext(message, testBotID, true)
+	if sessionCtx.ThreadID != nil {
+		t.Errorf("ThreadID = %d, want nil outside of topics", *sessionCtx.ThreadID)
+	}
+
+	api.SetMessageThreadID(message, 8)
+	sessionCtx = NewSessionContext(message, testBotID, true)
+	if sessionCtx.ThreadID == nil || *sessionCtx.ThreadID != 8 {
+		t.Fatalf("ThreadID = %v, want 8", sessionCtx.ThreadID)
+	}
+}
+
+func TestBindTopic(t *testing.T) {
+	client, err := api.NewClient("42:token", "")
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	message := groupMessage("hello")
+	message.MessageID = 502
+	message.Chat.ID = -1006
+
+	ctx := &config.WorkerContext{Bot: client}
+	bindTopic(message, ctx)
+	if ctx.Bot != client {
+		t.Error("bindTopic() replaced the client outside of topics")
+	}
+
+	api.SetMessageThreadID(message, 3)
+	bindTopic(message, ctx)
+	if bound, ok := ctx.Bot.(*api.Client); !ok || bound.ThreadID() != 3 {
+		t.Errorf("bindTopic() bot = %v, want a client in topic 3", ctx.Bot)
+	}
+}
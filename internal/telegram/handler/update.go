@@ -1,12 +1,15 @@
 package handler
 
 import (
+	"errors"
 	"fmt"
 	"log/slog"
+	"time"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 	"github.com/tbxark/ChatGPT-Telegram-Workers/go_version/internal/config"
 	"github.com/tbxark/ChatGPT-Telegram-Workers/go_version/internal/i18n"
+	"github.com/tbxark/ChatGPT-Telegram-Workers/go_version/internal/telegram/queue"
 )
 
 // EnvChecker verifies that required environment variables are set
@@ -54,9 +57,15 @@ func (h *WhiteListFilter) Handle(update *tgbotapi.Update, ctx *config.WorkerCont
 	if update.Message != nil {
 		chatID = update.Message.Chat.ID
 		isGroup = update.Message.Chat.IsGroup() || update.Message.Chat.IsSuperGroup()
+	} else if update.EditedMessage != nil {
+		chatID = update.EditedMessage.Chat.ID
+		isGroup = update.EditedMessage.Chat.IsGroup() || update.EditedMessage.Chat.IsSuperGroup()
 	} else if update.CallbackQuery != nil && update.CallbackQuery.Message != nil {
 		chatID = update.CallbackQuery.Message.Chat.ID
 		isGroup = update.CallbackQuery.Message.Chat.IsGroup() || update.CallbackQuery.Message.Chat.IsSuperGroup()
+	} else if update.InlineQuery != nil && update.InlineQuery.From != nil {
+		// Inline queries have no chat: the user is checked like a private chat
+		chatID = update.InlineQuery.From.ID
 	} else {
 		// No chat info, allow by default
 		return nil
@@ -104,6 +113,11 @@ func (h *WhiteListFilter) Handle(update *tgbotapi.Update, ctx *config.WorkerCont
 // Update2MessageHandler converts Update to Message and delegates to message handlers
 type Update2MessageHandler struct {
 	messageHandlers []MessageHandler
+	filters         []MessageHandler
+	queue           *queue.SessionQueue
+	shareMode       bool
+	reanswerEdits   bool
+	albums          *albumBuffer
 }
 
 // NewUpdate2MessageHandler creates a new Update2MessageHandler
@@ -115,29 +129,100 @@ func NewUpdate2MessageHandler(handlers []MessageHandler) *Update2MessageHandler
 
 // Handle processes the update and delegates to message handlers
 func (h *Update2MessageHandler) Handle(update *tgbotapi.Update, ctx *config.WorkerContext) error {
-	// Ignore edited messages (Requirement 2.11)
-	if update.EditedMessage != nil {
-		slog.Debug("Ignoring edited message")
-		return nil
-	}
-
 	// Extract message from update
 	var message *tgbotapi.Message
 	if update.Message != nil {
 		message = update.Message
+	} else if update.EditedMessage != nil {
+		// Edited prompts are answered again with REANSWER_EDITED_MESSAGE;
+		// edited commands and album captions are ignored
+		edited := update.EditedMessage
+		if !h.reanswerEdits || edited.IsCommand() || edited.MediaGroupID != "" || ctx.Context == nil {
+			slog.Debug("Ignoring edited message")
+			return nil
+		}
+		message = update.EditedMessage
+		ctx.Context["edit_mode"] = true
 	} else {
 		// No message to process
 		return nil
 	}
+	bindTopic(message, ctx)
+
+	// The photos of an album are answered together, by the update of its first photo
+	if message.MediaGroupID != "" && h.albums != nil && ctx.Context != nil {
+		album := h.albums.add(message)
+		if album == nil {
+			return nil
+		}
+		message = mergeAlbum(album)
+		ctx.Context["media_group"] = album
+	}
+
+	// Messages the bot doesn't answer are dropped before they can wait in a session or join a turn
+	if ignored, err := runMessageHandlers(h.filters, message, ctx); ignored || err != nil {
+		return err
+	}
+
+	if h.queue == nil {
+		return h.handleMessage(message, ctx)
+	}
+
+	// Process messages of the same session in order, so turns don't overwrite each other's history
+	if ctx.Context != nil {
+		ctx.Context["queue_stats"] = h.queue.Stats()
+	}
+	key := queue.SessionKey(NewSessionContext(message, ctx.ShareContext.BotID, h.shareMode))
+	return h.queue.Submit(key, message, func(message *tgbotapi.Message) error {
+		return h.handleMessage(message, ctx)
+	})
+}
+
+// SetQueue routes messages through a session queue; shareMode must match GROUP_CHAT_BOT_SHARE_MODE
+func (h *Update2MessageHandler) SetQueue(q *queue.SessionQueue, shareMode bool) {
+	h.queue = q
+	h.shareMode = shareMode
+}
+
+// SetFilters sets the message handlers that decide whether a message is answered at all.
+// They run before the message is queued, unlike the message handler chain.
+func (h *Update2MessageHandler) SetFilters(filters []MessageHandler) {
+	h.filters = filters
+}
+
+// SetReanswerEdits makes edited messages go through the handler chain to re-answer the edited prompt
+func (h *Update2MessageHandler) SetReanswerEdits(enabled bool) {
+	h.reanswerEdits = enabled
+}
+
+// SetMediaGroupWindow collects the photos of an album into a single turn, waiting until no photo
+// of the album arrived for window; 0 answers every photo separately
+func (h *Update2MessageHandler) SetMediaGroupWindow(window time.Duration) {
+	h.albums = nil
+	if window > 0 {
+		h.albums = newAlbumBuffer(window)
+	}
+}
+
+// handleMessage processes the message through the message handler chain
+func (h *Update2MessageHandler) handleMessage(message *tgbotapi.Message, ctx *config.WorkerContext) error {
+	_, err := runMessageHandlers(h.messageHandlers, message, ctx)
+	return err
+}
 
-	// Process through message handler chain
-	for _, handler := range h.messageHandlers {
+// runMessageHandlers runs the handlers in order until one fails or ignores the message,
+// reporting whether the message was ignored
+func runMessageHandlers(handlers []MessageHandler, message *tgbotapi.Message, ctx *config.WorkerContext) (bool, error) {
+	for _, handler := range handlers {
 		if err := handler.Handle(message, ctx); err != nil {
-			return err
+			if errors.Is(err, ErrIgnored) {
+				return true, nil
+			}
+			return false, err
 		}
 	}
 
-	return nil
+	return false, nil
 }
 
 // UpdateHandlerChain chains multiple update handlers
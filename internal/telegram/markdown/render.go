@@ -0,0 +1,460 @@
+package markdown
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf16"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Telegram message entity types produced by the renderer
+const (
+	EntityBold          = "bold"
+	EntityItalic        = "italic"
+	EntityStrikethrough = "strikethrough"
+	EntitySpoiler       = "spoiler"
+	EntityCode          = "code"
+	EntityPre           = "pre"
+	EntityTextLink      = "text_link"
+	EntityBlockquote    = "blockquote"
+)
+
+var (
+	fenceOpenPattern  = regexp.MustCompile("^ {0,3}(`{3,}|~{3,})\\s*([^\\s`]*)")
+	headingPattern    = regexp.MustCompile(`^ {0,3}#{1,6}\s+(.*?)(?:\s+#+)?\s*$`)
+	quotePattern      = regexp.MustCompile(`^ {0,3}>\s?(.*)$`)
+	bulletPattern     = regexp.MustCompile(`^(\s*)[-*+]\s+(.*)$`)
+	thematicPattern   = regexp.MustCompile(`^ {0,3}([-*_])(?:\s*([-*_])){2,}\s*$`)
+	linkSchemePattern = regexp.MustCompile(`^(?i)(https?|tg|mailto):`)
+)
+
+// delimiter is an inline emphasis marker and the entity it produces
+type delimiter struct {
+	marker string
+	entity string
+}
+
+// delimiters in the order they are tried; double markers take precedence over single ones
+var delimiters = []delimiter{
+	{"||", EntitySpoiler},
+	{"~~", EntityStrikethrough},
+	{"**", EntityBold},
+	{"__", EntityBold},
+	{"*", EntityItalic},
+	{"_", EntityItalic},
+}
+
+// Render converts CommonMark text written by a model into plain text and Telegram message entities.
+// Headings are rendered bold and bullets as "•". Unmatched markers are kept as literal text
+// and an unterminated code block extends to the end of the text, so partial Markdown
+// can be rendered while a reply is streamed.
+func Render(text string) (string, []tgbotapi.MessageEntity) {
+	r := &renderer{}
+	r.renderBlocks(text)
+
+	sort.SliceStable(r.entities, func(i, j int) bool {
+		if r.entities[i].Offset != r.entities[j].Offset {
+			return r.entities[i].Offset < r.entities[j].Offset
+		}
+		return r.entities[i].Length > r.entities[j].Length
+	})
+	return r.out.String(), r.entities
+}
+
+// Escape backslash-escapes the punctuation of text, for Render to show it literally
+func Escape(text string) string {
+	var sb strings.Builder
+	for _, c := range text {
+		if isASCIIPunct(c) {
+			sb.WriteByte('\\')
+		}
+		sb.WriteRune(c)
+	}
+	return sb.String()
+}
+
+// renderer accumulates the plain text and the entities
+type renderer struct {
+	out      strings.Builder
+	offset   int // Length of out in UTF-16 code units
+	entities []tgbotapi.MessageEntity
+}
+
+// write appends plain text
+func (r *renderer) write(s string) {
+	r.out.WriteString(s)
+	r.offset += utf16Len(s)
+}
+
+// addEntity adds an entity from start to the current offset, skipping empty ones
+func (r *renderer) addEntity(entityType string, start int) *tgbotapi.MessageEntity {
+	if r.offset <= start {
+		return nil
+	}
+	r.entities = append(r.entities, tgbotapi.MessageEntity{Type: entityType, Offset: start, Length: r.offset - start})
+	return &r.entities[len(r.entities)-1]
+}
+
+// renderBlocks renders code blocks, headings, quotes, lists and paragraphs line by line
+func (r *renderer) renderBlocks(text string) {
+	lines := strings.Split(text, "\n")
+	quoteStart := -1
+
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		quote := quotePattern.FindStringSubmatch(line)
+
+		// A blockquote ends before the newline of the first line that is not quoted
+		if quote == nil && quoteStart >= 0 {
+			r.addEntity(EntityBlockquote, quoteStart)
+			quoteStart = -1
+		}
+		if i > 0 {
+			r.write("\n")
+		}
+
+		if fence := fenceOpenPattern.FindStringSubmatch(line); fence != nil {
+			end := len(lines)
+			for j := i + 1; j < len(lines); j++ {
+				if isFenceClose(lines[j], fence[1]) {
+					end = j
+					break
+				}
+			}
+			start := r.offset
+			r.write(strings.Join(lines[i+1:min(end, len(lines))], "\n"))
+			if entity := r.addEntity(EntityPre, start); entity != nil {
+				entity.Language = fence[2]
+			}
+			i = end
+			continue
+		}
+
+		switch {
+		case quote != nil:
+			if quoteStart < 0 {
+				quoteStart = r.offset
+			}
+			r.renderInline([]rune(quote[1]))
+		case headingPattern.MatchString(line):
+			start := r.offset
+			r.renderInline([]rune(headingPattern.FindStringSubmatch(line)[1]))
+			r.addEntity(EntityBold, start)
+		case thematicPattern.MatchString(line) && isThematicBreak(line):
+			r.write("——————")
+		case bulletPattern.MatchString(line):
+			bullet := bulletPattern.FindStringSubmatch(line)
+			r.write(bullet[1] + "• ")
+			r.renderInline([]rune(bullet[2]))
+		default:
+			r.renderInline([]rune(line))
+		}
+	}
+
+	if quoteStart >= 0 {
+		r.addEntity(EntityBlockquote, quoteStart)
+	}
+}
+
+// renderInline renders code spans, links and emphasis
+func (r *renderer) renderInline(s []rune) {
+	for i := 0; i < len(s); {
+		c := s[i]
+
+		switch {
+		case c == '\\' && i+1 < len(s) && isASCIIPunct(s[i+1]):
+			r.write(string(s[i+1]))
+			i += 2
+			continue
+
+		case c == '`':
+			n := runLength(s, i)
+			if end := findCodeSpanEnd(s, i+n, n); end >= 0 {
+				start := r.offset
+				r.write(trimCodeSpan(string(s[i+n : end])))
+				r.addEntity(EntityCode, start)
+				i = end + n
+				continue
+			}
+			r.write(string(s[i : i+n]))
+			i += n
+			continue
+
+		case c == '[' || (c == '!' && i+1 < len(s) && s[i+1] == '['):
+			labelStart := i + 1
+			if c == '!' {
+				labelStart++
+			}
+			if labelEnd, url, end, ok := parseLink(s, labelStart); ok {
+				if linkSchemePattern.MatchString(url) {
+					start := r.offset
+					r.renderInline(s[labelStart:labelEnd])
+					if entity := r.addEntity(EntityTextLink, start); entity != nil {
+						entity.URL = url
+					}
+				} else {
+					r.renderInline(s[labelStart:labelEnd])
+					r.write(" (" + url + ")")
+				}
+				i = end
+				continue
+			}
+
+		case c == '<':
+			// Autolinks are shown as plain URLs, Telegram detects them itself
+			if end := indexRune(s, i+1, '>'); end > 0 && linkSchemePattern.MatchString(string(s[i+1:end])) {
+				r.write(string(s[i+1 : end]))
+				i = end + 1
+				continue
+			}
+
+		case c == '*' || c == '_' || c == '~' || c == '|':
+			if next, ok := r.renderEmphasis(s, i); ok {
+				i = next
+				continue
+			}
+			// An unmatched double marker stays literal as a whole
+			if n := runLength(s, i); n >= 2 {
+				r.write(string(s[i : i+n]))
+				i += n
+				continue
+			}
+		}
+
+		r.write(string(c))
+		i++
+	}
+}
+
+// renderEmphasis renders emphasis opened at i, returning the index after the closing marker
+func (r *renderer) renderEmphasis(s []rune, i int) (int, bool) {
+	run := runLength(s, i)
+	for _, d := range delimiters {
+		marker := []rune(d.marker)
+		if !hasPrefixAt(s, i, marker) {
+			continue
+		}
+		// A double run is only tried as a double marker
+		if len(marker) == 1 && run == 2 {
+			continue
+		}
+		if !isOpener(s, i, marker) {
+			continue
+		}
+		closeAt := findCloser(s, i+len(marker), marker)
+		if closeAt < 0 {
+			continue
+		}
+
+		start := r.offset
+		r.renderInline(s[i+len(marker) : closeAt])
+		r.addEntity(d.entity, start)
+		return closeAt + len(marker), true
+	}
+	return i, false
+}
+
+// isOpener reports whether marker at i can open emphasis
+func isOpener(s []rune, i int, marker []rune) bool {
+	after := i + len(marker)
+	if after >= len(s) || unicode.IsSpace(s[after]) {
+		return false
+	}
+	// Underscores inside words (snake_case) are not emphasis
+	if marker[0] == '_' && i > 0 && isAlnum(s[i-1]) {
+		return false
+	}
+	return true
+}
+
+// findCloser returns the index of the marker closing emphasis whose content starts at from, or -1
+func findCloser(s []rune, from int, marker []rune) int {
+	for k := from; k < len(s); {
+		switch {
+		case s[k] == '\\':
+			k += 2
+			continue
+		case s[k] == '`':
+			n := runLength(s, k)
+			if end := findCodeSpanEnd(s, k+n, n); end >= 0 {
+				k = end + n
+			} else {
+				k += n
+			}
+			continue
+		case s[k] != marker[0]:
+			k++
+			continue
+		}
+
+		run := runLength(s, k)
+		valid := k > from && !unicode.IsSpace(s[k-1]) && run >= len(marker)
+		// A single marker is not closed by a double one
+		if len(marker) == 1 && run == 2 {
+			valid = false
+		}
+		// The closing marker is the end of a longer run, so "***x***" closes bold around "*x*"
+		closeAt := k + run - len(marker)
+		if marker[0] == '_' && closeAt+len(marker) < len(s) && isAlnum(s[closeAt+len(marker)]) {
+			valid = false
+		}
+		if valid {
+			return closeAt
+		}
+		k += run
+	}
+	return -1
+}
+
+// parseLink parses "label](url)" with the label starting at labelStart.
+// It returns the end of the label, the URL and the index after the link.
+func parseLink(s []rune, labelStart int) (int, string, int, bool) {
+	depth := 0
+	labelEnd := -1
+	for k := labelStart; k < len(s); k++ {
+		switch s[k] {
+		case '\\':
+			k++
+		case '[':
+			depth++
+		case ']':
+			if depth == 0 {
+				labelEnd = k
+			}
+			depth--
+		}
+		if labelEnd >= 0 {
+			break
+		}
+	}
+	if labelEnd < 0 || labelEnd+1 >= len(s) || s[labelEnd+1] != '(' {
+		return 0, "", 0, false
+	}
+
+	depth = 0
+	for k := labelEnd + 2; k < len(s); k++ {
+		switch s[k] {
+		case '(':
+			depth++
+		case ')':
+			if depth > 0 {
+				depth--
+				continue
+			}
+			target := strings.TrimSpace(string(s[labelEnd+2 : k]))
+			// Drop an optional title: [label](url "title")
+			if fields := strings.Fields(target); len(fields) > 0 {
+				target = fields[0]
+			}
+			target = strings.TrimSuffix(strings.TrimPrefix(target, "<"), ">")
+			if target == "" {
+				return 0, "", 0, false
+			}
+			return labelEnd, target, k + 1, true
+		}
+	}
+	return 0, "", 0, false
+}
+
+// findCodeSpanEnd returns the index of the backtick run of length n closing a code span, or -1
+func findCodeSpanEnd(s []rune, from int, n int) int {
+	for k := from; k < len(s); {
+		if s[k] != '`' {
+			k++
+			continue
+		}
+		run := runLength(s, k)
+		if run == n {
+			return k
+		}
+		k += run
+	}
+	return -1
+}
+
+// trimCodeSpan strips one space on both sides of a code span, as CommonMark does
+func trimCodeSpan(code string) string {
+	if len(code) >= 2 && code[0] == ' ' && code[len(code)-1] == ' ' && strings.TrimSpace(code) != "" {
+		return code[1 : len(code)-1]
+	}
+	return code
+}
+
+// isFenceClose reports whether line closes a code block opened with fence
+func isFenceClose(line string, fence string) bool {
+	trimmed := strings.TrimSpace(line)
+	if len(trimmed) < len(fence) {
+		return false
+	}
+	return strings.Trim(trimmed, fence[:1]) == ""
+}
+
+// isThematicBreak reports whether a line is a horizontal rule made of a single character
+func isThematicBreak(line string) bool {
+	marker := rune(0)
+	for _, c := range line {
+		if unicode.IsSpace(c) {
+			continue
+		}
+		if marker == 0 {
+			marker = c
+		} else if c != marker {
+			return false
+		}
+	}
+	return true
+}
+
+// runLength returns the number of times s[i] is repeated from i
+func runLength(s []rune, i int) int {
+	n := 1
+	for i+n < len(s) && s[i+n] == s[i] {
+		n++
+	}
+	return n
+}
+
+// hasPrefixAt reports whether s contains prefix at i
+func hasPrefixAt(s []rune, i int, prefix []rune) bool {
+	if i+len(prefix) > len(s) {
+		return false
+	}
+	for k, c := range prefix {
+		if s[i+k] != c {
+			return false
+		}
+	}
+	return true
+}
+
+// indexRune returns the index of the first c in s from index from, or -1
+func indexRune(s []rune, from int, c rune) int {
+	for k := from; k < len(s); k++ {
+		if s[k] == c {
+			return k
+		}
+	}
+	return -1
+}
+
+// isASCIIPunct reports whether c can be escaped with a backslash
+func isASCIIPunct(c rune) bool {
+	return c < unicode.MaxASCII && unicode.IsPunct(c) || strings.ContainsRune("$+<=>^`|~", c)
+}
+
+// isAlnum reports whether c is a letter or a digit
+func isAlnum(c rune) bool {
+	return unicode.IsLetter(c) || unicode.IsDigit(c)
+}
+
+// utf16Len returns the length of text in UTF-16 code units, as counted by Telegram
+func utf16Len(text string) int {
+	n := 0
+	for _, c := range text {
+		n += utf16.RuneLen(c)
+	}
+	return n
+}
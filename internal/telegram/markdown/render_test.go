@@ -0,0 +1,129 @@
+package markdown
+
+import (
+	"reflect"
+	"testing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+func TestRender(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		text     string
+		entities []tgbotapi.MessageEntity
+	}{
+		{
+			name:  "plain text",
+			input: "hello world",
+			text:  "hello world",
+		},
+		{
+			name:     "bold and italic",
+			input:    "**bold** and *italic* and _also_",
+			text:     "bold and italic and also",
+			entities: []tgbotapi.MessageEntity{{Type: EntityBold, Offset: 0, Length: 4}, {Type: EntityItalic, Offset: 9, Length: 6}, {Type: EntityItalic, Offset: 20, Length: 4}},
+		},
+		{
+			name:     "nested emphasis",
+			input:    "***both*** and *a **b** c*",
+			text:     "both and a b c",
+			entities: []tgbotapi.MessageEntity{{Type: EntityItalic, Offset: 0, Length: 4}, {Type: EntityBold, Offset: 0, Length: 4}, {Type: EntityItalic, Offset: 9, Length: 5}, {Type: EntityBold, Offset: 11, Length: 1}},
+		},
+		{
+			name:     "strikethrough and spoiler",
+			input:    "~~old~~ ||secret||",
+			text:     "old secret",
+			entities: []tgbotapi.MessageEntity{{Type: EntityStrikethrough, Offset: 0, Length: 3}, {Type: EntitySpoiler, Offset: 4, Length: 6}},
+		},
+		{
+			name:     "inline code is not parsed",
+			input:    "run `a_b*c*` now",
+			text:     "run a_b*c* now",
+			entities: []tgbotapi.MessageEntity{{Type: EntityCode, Offset: 4, Length: 6}},
+		},
+		{
+			name:     "code block with language",
+			input:    "Example:\n```go\nfmt.Println(\"**\")\n```\nDone",
+			text:     "Example:\nfmt.Println(\"**\")\nDone",
+			entities: []tgbotapi.MessageEntity{{Type: EntityPre, Offset: 9, Length: 17, Language: "go"}},
+		},
+		{
+			name:     "links",
+			input:    "see [the **docs**](https://example.com \"title\") or [local](docs/x.md)",
+			text:     "see the docs or local (docs/x.md)",
+			entities: []tgbotapi.MessageEntity{{Type: EntityTextLink, Offset: 4, Length: 8, URL: "https://example.com"}, {Type: EntityBold, Offset: 8, Length: 4}},
+		},
+		{
+			name:     "blockquote",
+			input:    "> quoted\n> *more*\nafter",
+			text:     "quoted\nmore\nafter",
+			entities: []tgbotapi.MessageEntity{{Type: EntityBlockquote, Offset: 0, Length: 11}, {Type: EntityItalic, Offset: 7, Length: 4}},
+		},
+		{
+			name:     "headings and lists",
+			input:    "## Title\n- one\n* two\n1. three",
+			text:     "Title\n• one\n• two\n1. three",
+			entities: []tgbotapi.MessageEntity{{Type: EntityBold, Offset: 0, Length: 5}},
+		},
+		{
+			name:  "unmatched markers stay literal",
+			input: "2 * 3 = 6, snake_case_name, **open and `tick",
+			text:  "2 * 3 = 6, snake_case_name, **open and `tick",
+		},
+		{
+			name:  "escapes",
+			input: `\*not italic\* and \_x\_`,
+			text:  "*not italic* and _x_",
+		},
+		{
+			name:     "offsets count UTF-16 code units",
+			input:    "😀 **bold**",
+			text:     "😀 bold",
+			entities: []tgbotapi.MessageEntity{{Type: EntityBold, Offset: 3, Length: 4}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			text, entities := Render(tt.input)
+			if text != tt.text {
+				t.Errorf("Render() text = %q, want %q", text, tt.text)
+			}
+			if !reflect.DeepEqual(entities, tt.entities) {
+				t.Errorf("Render() entities = %+v, want %+v", entities, tt.entities)
+			}
+		})
+	}
+}
+
+func TestRender_PartialStream(t *testing.T) {
+	// An unterminated code block extends to the end of the text while streaming
+	text, entities := Render("Code:\n```python\nprint(1)\nprint(")
+	if text != "Code:\nprint(1)\nprint(" {
+		t.Errorf("Render() text = %q", text)
+	}
+	want := []tgbotapi.MessageEntity{{Type: EntityPre, Offset: 6, Length: 15, Language: "python"}}
+	if !reflect.DeepEqual(entities, want) {
+		t.Errorf("Render() entities = %+v, want %+v", entities, want)
+	}
+
+	// A just opened code block has no entity yet
+	text, entities = Render("Code:\n```")
+	if text != "Code:\n" || len(entities) != 0 {
+		t.Errorf("Render() = %q, %+v, want the text before the fence and no entities", text, entities)
+	}
+}
+
+func TestEscape(t *testing.T) {
+	name := "*Aria* [v2] #1_b"
+	text, entities := Render("**" + Escape(name) + "**: hi")
+	if text != name+": hi" {
+		t.Errorf("Render() text = %q, want %q", text, name+": hi")
+	}
+	want := []tgbotapi.MessageEntity{{Type: EntityBold, Offset: 0, Length: 16}}
+	if !reflect.DeepEqual(entities, want) {
+		t.Errorf("Render() entities = %+v, want %+v", entities, want)
+	}
+}
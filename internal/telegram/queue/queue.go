@@ -0,0 +1,256 @@
+package queue
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/tbxark/ChatGPT-Telegram-Workers/go_version/internal/storage"
+)
+
+// ErrQueueFull is returned when a session already has the maximum number of pending messages
+var ErrQueueFull = errors.New("too many pending messages for this chat")
+
+// RunFunc processes one message of a session
+type RunFunc func(message *tgbotapi.Message) error
+
+// job is a message waiting to be processed
+type job struct {
+	message  *tgbotapi.Message
+	run      RunFunc
+	queuedAt time.Time
+	done     chan error
+}
+
+// session holds the pending messages of one session
+type session struct {
+	pending []*job
+	running bool
+}
+
+// SessionQueue processes messages of the same session one at a time and in order,
+// while running at most a fixed number of sessions concurrently
+type SessionQueue struct {
+	maxPending     int
+	coalesceWindow time.Duration
+	slots          chan struct{} // nil when concurrency is unlimited
+
+	mu       sync.Mutex
+	sessions map[string]*session
+
+	active    atomic.Int64
+	processed atomic.Int64
+	coalesced atomic.Int64
+	rejected  atomic.Int64
+	waitTotal atomic.Int64 // nanoseconds
+	waitMax   atomic.Int64 // nanoseconds
+}
+
+// NewSessionQueue creates a new SessionQueue.
+// A maxConcurrency or maxPending of 0 means no limit; a coalesceWindow of 0 disables coalescing.
+func NewSessionQueue(maxConcurrency, maxPending int, coalesceWindow time.Duration) *SessionQueue {
+	q := &SessionQueue{
+		maxPending:     maxPending,
+		coalesceWindow: coalesceWindow,
+		sessions:       make(map[string]*session),
+	}
+	if maxConcurrency > 0 {
+		q.slots = make(chan struct{}, maxConcurrency)
+	}
+	return q
+}
+
+// SessionKey returns the queue key of a session context
+func SessionKey(ctx *storage.SessionContext) string {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("%d:%d", ctx.BotID, ctx.ChatID))
+	if ctx.UserID != nil {
+		sb.WriteString(fmt.Sprintf(":u%d", *ctx.UserID))
+	}
+	if ctx.ThreadID != nil {
+		sb.WriteString(fmt.Sprintf(":t%d", *ctx.ThreadID))
+	}
+	return sb.String()
+}
+
+// Submit queues a message for its session and waits until it has been processed.
+// A message coalesced into an earlier one returns nil once the combined turn is done.
+func (q *SessionQueue) Submit(key string, message *tgbotapi.Message, run RunFunc) error {
+	j := &job{
+		message:  message,
+		run:      run,
+		queuedAt: time.Now(),
+		done:     make(chan error, 1),
+	}
+
+	q.mu.Lock()
+	s, ok := q.sessions[key]
+	if !ok {
+		s = &session{}
+		q.sessions[key] = s
+	}
+	if q.maxPending > 0 && len(s.pending) >= q.maxPending {
+		q.mu.Unlock()
+		q.rejected.Add(1)
+		slog.Warn("Chat queue full, dropping message", "session", key, "pending", q.maxPending)
+		return ErrQueueFull
+	}
+	s.pending = append(s.pending, j)
+	if !s.running {
+		s.running = true
+		go q.drain(key, s)
+	}
+	q.mu.Unlock()
+
+	return <-j.done
+}
+
+// Do runs fn in turn with the messages of a session and waits until it is done. It is
+// meant for work that changes the session outside of a message, such as a reply button,
+// and is never coalesced with the messages around it.
+func (q *SessionQueue) Do(key string, fn func() error) error {
+	return q.Submit(key, nil, func(*tgbotapi.Message) error { return fn() })
+}
+
+// drain processes the pending messages of a session until none are left
+func (q *SessionQueue) drain(key string, s *session) {
+	for {
+		if q.coalesceWindow > 0 {
+			// Give rapid follow-up messages a chance to join this turn
+			time.Sleep(q.coalesceWindow)
+		}
+
+		q.acquire()
+		q.mu.Lock()
+		if len(s.pending) == 0 {
+			s.running = false
+			delete(q.sessions, key)
+			q.mu.Unlock()
+			q.release()
+			return
+		}
+		batch := q.take(s)
+		q.mu.Unlock()
+
+		q.run(batch)
+		q.release()
+	}
+}
+
+// take removes the next job from the session, merged with the consecutive jobs it can be coalesced with:
+// plain text messages of the same sender, so a shared group session never merges users into one turn
+func (q *SessionQueue) take(s *session) []*job {
+	n := 1
+	if first := s.pending[0].message; q.coalesceWindow > 0 && coalescible(first) {
+		for n < len(s.pending) && coalescible(s.pending[n].message) && s.pending[n].message.From.ID == first.From.ID {
+			n++
+		}
+	}
+	batch := s.pending[:n:n]
+	s.pending = s.pending[n:]
+	return batch
+}
+
+// run processes a batch as a single turn and reports the result to every job in it
+func (q *SessionQueue) run(batch []*job) {
+	now := time.Now()
+	for _, j := range batch {
+		q.recordWait(now.Sub(j.queuedAt))
+	}
+
+	first := batch[0]
+	message := first.message
+	if len(batch) > 1 {
+		texts := make([]string, len(batch))
+		for i, j := range batch {
+			texts[i] = j.message.Text
+		}
+		// Reply to the latest message of the turn
+		merged := *batch[len(batch)-1].message
+		merged.Text = strings.Join(texts, "\n")
+		message = &merged
+		q.coalesced.Add(int64(len(batch) - 1))
+		slog.Debug("Coalesced messages into one turn", "count", len(batch), "chat_id", message.Chat.ID)
+	}
+
+	q.active.Add(1)
+	err := first.run(message)
+	q.active.Add(-1)
+	q.processed.Add(1)
+	first.done <- err
+	for _, j := range batch[1:] {
+		j.done <- nil
+	}
+}
+
+// coalescible reports whether a message is plain text from a user that can be merged with its neighbours
+func coalescible(message *tgbotapi.Message) bool {
+	if message == nil || message.From == nil || message.Text == "" || strings.HasPrefix(message.Text, "/") || message.EditDate != 0 {
+		return false
+	}
+	return message.ReplyToMessage == nil && message.Photo == nil && message.Document == nil &&
+		message.Voice == nil && message.Sticker == nil && message.MediaGroupID == ""
+}
+
+func (q *SessionQueue) acquire() {
+	if q.slots != nil {
+		q.slots <- struct{}{}
+	}
+}
+
+func (q *SessionQueue) release() {
+	if q.slots != nil {
+		<-q.slots
+	}
+}
+
+func (q *SessionQueue) recordWait(wait time.Duration) {
+	q.waitTotal.Add(int64(wait))
+	for {
+		current := q.waitMax.Load()
+		if int64(wait) <= current || q.waitMax.CompareAndSwap(current, int64(wait)) {
+			return
+		}
+	}
+}
+
+// Stats is a snapshot of the queue's back-pressure metrics
+type Stats struct {
+	Sessions    int           // Sessions with queued or running messages
+	Active      int           // Sessions currently being processed
+	Pending     int           // Messages waiting to be processed
+	Concurrency int           // Maximum number of sessions processed at once (0 means unlimited)
+	Processed   int64         // Turns processed
+	Coalesced   int64         // Messages merged into an earlier turn
+	Rejected    int64         // Messages dropped because their session's queue was full
+	AvgWait     time.Duration // Average time from submission to processing
+	MaxWait     time.Duration // Longest time from submission to processing
+}
+
+// Stats returns the current queue metrics
+func (q *SessionQueue) Stats() Stats {
+	q.mu.Lock()
+	stats := Stats{Sessions: len(q.sessions)}
+	for _, s := range q.sessions {
+		stats.Pending += len(s.pending)
+	}
+	q.mu.Unlock()
+
+	if q.slots != nil {
+		stats.Concurrency = cap(q.slots)
+	}
+	stats.Active = int(q.active.Load())
+	stats.Processed = q.processed.Load()
+	stats.Coalesced = q.coalesced.Load()
+	stats.Rejected = q.rejected.Load()
+	if waited := stats.Processed + stats.Coalesced; waited > 0 {
+		stats.AvgWait = time.Duration(q.waitTotal.Load() / waited)
+	}
+	stats.MaxWait = time.Duration(q.waitMax.Load())
+	return stats
+}
@@ -0,0 +1,280 @@
+package queue
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/tbxark/ChatGPT-Telegram-Workers/go_version/internal/storage"
+)
+
+func textMessage(id int, text string) *tgbotapi.Message {
+	return &tgbotapi.Message{MessageID: id, Chat: &tgbotapi.Chat{ID: 1}, From: &tgbotapi.User{ID: 7}, Text: text}
+}
+
+func TestSessionQueue_SerializesSession(t *testing.T) {
+	q := NewSessionQueue(4, 0, 0)
+
+	var mu sync.Mutex
+	var order []int
+	var running, overlap atomic.Int32
+	release := make(chan struct{})
+
+	run := func(message *tgbotapi.Message) error {
+		if running.Add(1) > 1 {
+			overlap.Add(1)
+		}
+		if message.MessageID == 1 {
+			<-release
+		}
+		mu.Lock()
+		order = append(order, message.MessageID)
+		mu.Unlock()
+		running.Add(-1)
+		return nil
+	}
+
+	var wg sync.WaitGroup
+	for i := 1; i <= 5; i++ {
+		wg.Add(1)
+		go func(id int) {
+			defer wg.Done()
+			if err := q.Submit("session", textMessage(id, "hi"), run); err != nil {
+				t.Errorf("Submit() error = %v", err)
+			}
+		}(i)
+		// Submit in order while the first message blocks the session
+		waitFor(t, func() bool { return q.Stats().Pending+q.Stats().Active >= i })
+	}
+	close(release)
+	wg.Wait()
+
+	if overlap.Load() != 0 {
+		t.Error("messages of the same session ran concurrently")
+	}
+	for i, id := range order {
+		if id != i+1 {
+			t.Fatalf("messages processed in order %v, want submission order", order)
+		}
+	}
+	if stats := q.Stats(); stats.Processed != 5 || stats.Sessions != 0 {
+		t.Errorf("Stats() = %+v, want 5 processed and no sessions left", stats)
+	}
+}
+
+func TestSessionQueue_BoundsConcurrency(t *testing.T) {
+	q := NewSessionQueue(2, 0, 0)
+
+	var running, peak atomic.Int32
+	release := make(chan struct{})
+	run := func(message *tgbotapi.Message) error {
+		n := running.Add(1)
+		for {
+			current := peak.Load()
+			if n <= current || peak.CompareAndSwap(current, n) {
+				break
+			}
+		}
+		<-release
+		running.Add(-1)
+		return nil
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func(id int) {
+			defer wg.Done()
+			_ = q.Submit(string(rune('a'+id)), textMessage(id, "hi"), run)
+		}(i)
+	}
+	waitFor(t, func() bool { return running.Load() == 2 && q.Stats().Sessions == 5 })
+	if stats := q.Stats(); stats.Active != 2 || stats.Concurrency != 2 {
+		t.Errorf("Stats() = %+v, want 2 active sessions of 2", stats)
+	}
+	close(release)
+	wg.Wait()
+
+	if peak.Load() != 2 {
+		t.Errorf("peak concurrency = %d, want 2", peak.Load())
+	}
+}
+
+func TestSessionQueue_Coalesces(t *testing.T) {
+	q := NewSessionQueue(0, 0, 50*time.Millisecond)
+
+	var mu sync.Mutex
+	var turns []string
+	run := func(message *tgbotapi.Message) error {
+		mu.Lock()
+		turns = append(turns, message.Text)
+		mu.Unlock()
+		return errors.New("turn failed")
+	}
+
+	// Edits are answered on their own
+	edited := textMessage(2, "second, edited")
+	edited.EditDate = 1
+
+	// Messages of another user in a shared session are their own turn
+	other := textMessage(5, "aside")
+	other.From = &tgbotapi.User{ID: 8}
+
+	messages := []*tgbotapi.Message{
+		textMessage(1, "first"),
+		textMessage(2, "second"),
+		other,
+		textMessage(3, "/help"),
+		textMessage(4, "third"),
+		edited,
+	}
+	errs := make([]error, len(messages))
+	var wg sync.WaitGroup
+	for i, message := range messages {
+		wg.Add(1)
+		go func(i int, message *tgbotapi.Message) {
+			defer wg.Done()
+			errs[i] = q.Submit("session", message, run)
+		}(i, message)
+		waitFor(t, func() bool { return q.Stats().Pending == i+1 })
+	}
+	wg.Wait()
+
+	want := []string{"first\nsecond", "aside", "/help", "third", "second, edited"}
+	if len(turns) != len(want) {
+		t.Fatalf("turns = %q, want %q", turns, want)
+	}
+	for i := range want {
+		if turns[i] != want[i] {
+			t.Errorf("turn %d = %q, want %q", i, turns[i], want[i])
+		}
+	}
+
+	// The turn's error is reported to its first message only
+	if errs[0] == nil || errs[1] != nil {
+		t.Errorf("Submit() errors = %v, want an error for the first message only", errs[:2])
+	}
+	if stats := q.Stats(); stats.Processed != 5 || stats.Coalesced != 1 {
+		t.Errorf("Stats() = %+v, want 5 processed and 1 coalesced", stats)
+	}
+}
+
+func TestSessionQueue_Do(t *testing.T) {
+	q := NewSessionQueue(0, 0, 50*time.Millisecond)
+
+	var mu sync.Mutex
+	var turns []string
+	record := func(turn string) {
+		mu.Lock()
+		turns = append(turns, turn)
+		mu.Unlock()
+	}
+	run := func(message *tgbotapi.Message) error {
+		record(message.Text)
+		return nil
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(3)
+	go func() {
+		defer wg.Done()
+		_ = q.Submit("session", textMessage(1, "first"), run)
+	}()
+	waitFor(t, func() bool { return q.Stats().Pending == 1 })
+	go func() {
+		defer wg.Done()
+		if err := q.Do("session", func() error {
+			record("button")
+			return errors.New("button failed")
+		}); err == nil {
+			t.Error("Do() error = nil, want the error of fn")
+		}
+	}()
+	waitFor(t, func() bool { return q.Stats().Pending == 2 })
+	go func() {
+		defer wg.Done()
+		_ = q.Submit("session", textMessage(2, "second"), run)
+	}()
+	wg.Wait()
+
+	// The work runs between the messages, which are not coalesced across it
+	want := []string{"first", "button", "second"}
+	if len(turns) != len(want) {
+		t.Fatalf("turns = %q, want %q", turns, want)
+	}
+	for i := range want {
+		if turns[i] != want[i] {
+			t.Errorf("turn %d = %q, want %q", i, turns[i], want[i])
+		}
+	}
+}
+
+func TestSessionQueue_RejectsWhenFull(t *testing.T) {
+	q := NewSessionQueue(0, 1, 0)
+
+	release := make(chan struct{})
+	started := make(chan struct{})
+	run := func(message *tgbotapi.Message) error {
+		if message.MessageID == 1 {
+			close(started)
+			<-release
+		}
+		return nil
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		_ = q.Submit("session", textMessage(1, "a"), run)
+	}()
+	<-started
+	go func() {
+		defer wg.Done()
+		_ = q.Submit("session", textMessage(2, "b"), run)
+	}()
+	waitFor(t, func() bool { return q.Stats().Pending == 1 })
+
+	if err := q.Submit("session", textMessage(3, "c"), run); !errors.Is(err, ErrQueueFull) {
+		t.Errorf("Submit() error = %v, want ErrQueueFull", err)
+	}
+	// Other sessions are not affected
+	if err := q.Submit("other", textMessage(4, "d"), run); err != nil {
+		t.Errorf("Submit() error = %v for another session", err)
+	}
+
+	close(release)
+	wg.Wait()
+	if stats := q.Stats(); stats.Rejected != 1 || stats.Processed != 3 {
+		t.Errorf("Stats() = %+v, want 1 rejected and 3 processed", stats)
+	}
+}
+
+func TestSessionKey(t *testing.T) {
+	userID, threadID := int64(7), int64(9)
+	keys := map[string]bool{
+		SessionKey(&storage.SessionContext{ChatID: -1, BotID: 2}):                                       true,
+		SessionKey(&storage.SessionContext{ChatID: -1, BotID: 2, UserID: &userID}):                      true,
+		SessionKey(&storage.SessionContext{ChatID: -1, BotID: 2, ThreadID: &threadID}):                  true,
+		SessionKey(&storage.SessionContext{ChatID: -1, BotID: 2, UserID: &userID, ThreadID: &threadID}): true,
+		SessionKey(&storage.SessionContext{ChatID: -1, BotID: 3}):                                       true,
+	}
+	if len(keys) != 5 {
+		t.Errorf("SessionKey() returned %d distinct keys, want 5", len(keys))
+	}
+}
+
+// waitFor polls cond until it holds or the test times out
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met in time")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -0,0 +1,146 @@
+package sender
+
+import (
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/tbxark/ChatGPT-Telegram-Workers/go_version/internal/telegram/markdown"
+)
+
+// ParseModeMarkdown renders CommonMark into message entities instead of using Telegram's legacy Markdown parser
+const ParseModeMarkdown = "Markdown"
+
+// messagePart is the text and formatting of one message of a reply
+type messagePart struct {
+	text      string
+	parseMode string
+	entities  []tgbotapi.MessageEntity
+}
+
+// formatted reports whether the part has any formatting that Telegram could reject
+func (p messagePart) formatted() bool {
+	return p.parseMode != "" || len(p.entities) > 0
+}
+
+// equal reports whether two parts would display the same message
+func (p messagePart) equal(other messagePart) bool {
+	if p.text != other.text || p.parseMode != other.parseMode || len(p.entities) != len(other.entities) {
+		return false
+	}
+	for i := range p.entities {
+		if p.entities[i] != other.entities[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// renderMessage formats text for the parse mode and splits it into messages of at most MaxMessageLength
+func renderMessage(text string, parseMode string) []messagePart {
+	if parseMode == ParseModeMarkdown {
+		plain, entities := markdown.Render(text)
+		return splitEntities(plain, entities, MaxMessageLength)
+	}
+
+	chunks := SplitMessage(text, parseMode, MaxMessageLength)
+	parts := make([]messagePart, len(chunks))
+	for i, chunk := range chunks {
+		parts[i] = messagePart{text: chunk, parseMode: parseMode}
+	}
+	return parts
+}
+
+// RenderFirstMessage formats text like SendRichText and returns the first message of the reply,
+// for content that must fit in a single message such as inline query results
+func RenderFirstMessage(text string, parseMode string) (string, string, []tgbotapi.MessageEntity) {
+	parts := renderMessage(text, parseMode)
+	if len(parts) == 0 {
+		return "", "", nil
+	}
+	return parts[0].text, parts[0].parseMode, parts[0].entities
+}
+
+// splitEntities splits plain text and its entities into messages of at most limit UTF-16 code units.
+// Text is cut at blank lines where possible, then at line breaks, then at whitespace;
+// an entity crossing a cut continues in the next message.
+func splitEntities(text string, entities []tgbotapi.MessageEntity, limit int) []messagePart {
+	runes := []rune(text)
+	offsets := make([]int, len(runes)+1) // UTF-16 offset of each rune
+	for i, r := range runes {
+		offsets[i+1] = offsets[i] + utf16Len(string(r))
+	}
+	if offsets[len(runes)] <= limit {
+		return []messagePart{{text: text, entities: entities}}
+	}
+
+	var parts []messagePart
+	start := 0
+	for start < len(runes) {
+		// Continuations start at the next line
+		for start < len(runes) && runes[start] == '\n' {
+			start++
+		}
+		if start == len(runes) {
+			break
+		}
+
+		end := start
+		for end < len(runes) && offsets[end+1]-offsets[start] <= limit {
+			end++
+		}
+		if end == start {
+			end++ // A single rune longer than the limit
+		}
+		if end < len(runes) {
+			end = cutPoint(runes, start, end)
+		}
+
+		trimmed := end
+		for trimmed > start && (runes[trimmed-1] == '\n' || runes[trimmed-1] == ' ') {
+			trimmed--
+		}
+		if trimmed > start {
+			parts = append(parts, messagePart{
+				text:     string(runes[start:trimmed]),
+				entities: clipEntities(entities, offsets[start], offsets[trimmed]),
+			})
+		}
+		start = end
+	}
+	return parts
+}
+
+// cutPoint returns where to end a message that can hold runes[start:end]:
+// after the last blank line, else after the last line break, else after the last whitespace
+func cutPoint(runes []rune, start, end int) int {
+	for i := end; i > start+1; i-- {
+		if runes[i-1] == '\n' && runes[i-2] == '\n' {
+			return i
+		}
+	}
+	for i := end; i > start; i-- {
+		if runes[i-1] == '\n' {
+			return i
+		}
+	}
+	for i := end; i > start; i-- {
+		if runes[i-1] == ' ' || runes[i-1] == '\t' {
+			return i
+		}
+	}
+	return end
+}
+
+// clipEntities returns the parts of entities within [from, to), relative to from
+func clipEntities(entities []tgbotapi.MessageEntity, from, to int) []tgbotapi.MessageEntity {
+	var clipped []tgbotapi.MessageEntity
+	for _, entity := range entities {
+		start := max(entity.Offset, from)
+		end := min(entity.Offset+entity.Length, to)
+		if end <= start {
+			continue
+		}
+		entity.Offset = start - from
+		entity.Length = end - start
+		clipped = append(clipped, entity)
+	}
+	return clipped
+}
@@ -0,0 +1,75 @@
+package sender
+
+import (
+	"strings"
+	"testing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+func TestRenderMessage(t *testing.T) {
+	parts := renderMessage("**bold** text", ParseModeMarkdown)
+	if len(parts) != 1 {
+		t.Fatalf("renderMessage() returned %d parts, want 1", len(parts))
+	}
+	if parts[0].text != "bold text" || parts[0].parseMode != "" {
+		t.Errorf("renderMessage() = %+v, want rendered text without parse mode", parts[0])
+	}
+	if len(parts[0].entities) != 1 || parts[0].entities[0].Type != "bold" {
+		t.Errorf("renderMessage() entities = %+v, want one bold entity", parts[0].entities)
+	}
+
+	// Other parse modes are passed to Telegram
+	parts = renderMessage("<b>bold</b>", "HTML")
+	if len(parts) != 1 || parts[0].text != "<b>bold</b>" || parts[0].parseMode != "HTML" || parts[0].entities != nil {
+		t.Errorf("renderMessage() = %+v, want the HTML text with parse mode", parts)
+	}
+}
+
+func TestSplitEntities(t *testing.T) {
+	first := strings.Repeat("a", 60)
+	code := strings.Repeat("x", 30) + "\n" + strings.Repeat("y", 30)
+	text := first + "\n\n" + code
+	entities := []tgbotapi.MessageEntity{
+		{Type: "bold", Offset: 0, Length: 5},
+		{Type: "pre", Offset: 62, Length: 61, Language: "go"},
+	}
+
+	parts := splitEntities(text, entities, 80)
+	if len(parts) != 2 {
+		t.Fatalf("splitEntities() returned %d parts, want 2: %+v", len(parts), parts)
+	}
+	if parts[0].text != first {
+		t.Errorf("first part = %q, want the first paragraph", parts[0].text)
+	}
+	if len(parts[0].entities) != 1 || parts[0].entities[0].Type != "bold" {
+		t.Errorf("first part entities = %+v, want the bold entity", parts[0].entities)
+	}
+	if parts[1].text != code {
+		t.Errorf("second part = %q, want the code block", parts[1].text)
+	}
+	want := tgbotapi.MessageEntity{Type: "pre", Offset: 0, Length: 61, Language: "go"}
+	if len(parts[1].entities) != 1 || parts[1].entities[0] != want {
+		t.Errorf("second part entities = %+v, want %+v", parts[1].entities, want)
+	}
+
+	// An entity crossing a cut continues in the next part
+	parts = splitEntities(text, entities, 40)
+	var pre []tgbotapi.MessageEntity
+	for _, part := range parts {
+		if utf16Len(part.text) > 40 {
+			t.Errorf("part %q is longer than 40", part.text)
+		}
+		for _, entity := range part.entities {
+			if entity.Type == "pre" {
+				pre = append(pre, entity)
+				if entity.Offset+entity.Length > utf16Len(part.text) {
+					t.Errorf("entity %+v ends after the part %q", entity, part.text)
+				}
+			}
+		}
+	}
+	if len(pre) != 2 {
+		t.Errorf("code block is split into %d pre entities, want 2", len(pre))
+	}
+}
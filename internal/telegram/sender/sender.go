@@ -2,6 +2,7 @@ package sender
 
 import (
 	"fmt"
+	"strings"
 	"sync"
 	"time"
 
@@ -17,6 +18,13 @@ type MessageSender struct {
 	context   map[string]interface{}
 	mu        sync.Mutex
 
+	// Replies longer than MaxMessageLength continue in further messages
+	continuationIDs []int
+	sentParts       []messagePart // Text last sent to each message of the reply
+
+	// Inline keyboard shown under the last message of the reply
+	keyboard *tgbotapi.InlineKeyboardMarkup
+
 	// Streaming configuration
 	minStreamInterval time.Duration
 	lastUpdateTime    time.Time
@@ -34,6 +42,16 @@ func NewMessageSender(client *api.Client, chatID int64) *MessageSender {
 	}
 }
 
+// NewReplySender creates a MessageSender replying in the chat and forum topic of a message
+func NewReplySender(client *api.Client, message *tgbotapi.Message) *MessageSender {
+	return NewMessageSender(client.InThread(api.MessageThreadID(message)), message.Chat.ID)
+}
+
+// ThreadID returns the forum topic messages are sent to, or 0
+func (s *MessageSender) ThreadID() int {
+	return s.client.ThreadID()
+}
+
 // SetMinStreamInterval sets the minimum interval between stream updates
 func (s *MessageSender) SetMinStreamInterval(interval time.Duration) {
 	s.mu.Lock()
@@ -45,7 +63,61 @@ func (s *MessageSender) SetMinStreamInterval(interval time.Duration) {
 func (s *MessageSender) Update(messageID int) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	s.setMessage(messageID)
+}
+
+// Resume continues an already sent reply: the next SendRichText edits its messages
+func (s *MessageSender) Resume(messageIDs []int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(messageIDs) == 0 {
+		s.setMessage(0)
+		return
+	}
+	s.setMessage(messageIDs[0])
+	s.continuationIDs = append([]int(nil), messageIDs[1:]...)
+}
+
+// SetKeyboard sets the inline keyboard SendRichText shows under the last message of the reply
+func (s *MessageSender) SetKeyboard(keyboard *tgbotapi.InlineKeyboardMarkup) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keyboard = keyboard
+}
+
+// AttachKeyboard shows an inline keyboard under the last message of the sent reply
+func (s *MessageSender) AttachKeyboard(keyboard tgbotapi.InlineKeyboardMarkup) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	messageIDs := s.replyMessageIDs()
+	if len(messageIDs) == 0 {
+		return fmt.Errorf("no message to edit")
+	}
+	s.keyboard = &keyboard
+
+	edit := tgbotapi.NewEditMessageReplyMarkup(s.chatID, messageIDs[len(messageIDs)-1], keyboard)
+	if _, err := s.client.Send(edit); err != nil && !isMessageNotModified(err) {
+		return fmt.Errorf("failed to edit message reply markup: %w", err)
+	}
+	return nil
+}
+
+// RemoveKeyboard removes the inline keyboard of a message, e.g. of a previous reply
+func (s *MessageSender) RemoveKeyboard(messageID int) error {
+	keyboard := tgbotapi.InlineKeyboardMarkup{InlineKeyboard: [][]tgbotapi.InlineKeyboardButton{}}
+	edit := tgbotapi.NewEditMessageReplyMarkup(s.chatID, messageID, keyboard)
+	if _, err := s.client.Send(edit); err != nil && !isMessageNotModified(err) {
+		return fmt.Errorf("failed to remove message reply markup: %w", err)
+	}
+	return nil
+}
+
+// setMessage makes messageID the current message and forgets the previous reply
+func (s *MessageSender) setMessage(messageID int) {
 	s.messageID = messageID
+	s.continuationIDs = nil
+	s.sentParts = nil
 }
 
 // GetMessageID returns the current message ID
@@ -55,6 +127,21 @@ func (s *MessageSender) GetMessageID() int {
 	return s.messageID
 }
 
+// MessageIDs returns the IDs of all messages of the current reply, in order
+func (s *MessageSender) MessageIDs() []int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.replyMessageIDs()
+}
+
+// replyMessageIDs returns the IDs of all messages of the current reply
+func (s *MessageSender) replyMessageIDs() []int {
+	if s.messageID == 0 {
+		return nil
+	}
+	return append([]int{s.messageID}, s.continuationIDs...)
+}
+
 // SetContext sets a context value
 func (s *MessageSender) SetContext(key string, value interface{}) {
 	s.mu.Lock()
@@ -75,7 +162,11 @@ func (s *MessageSender) SendPlainText(text string) error {
 	return s.SendRichText(text, "")
 }
 
-// SendRichText sends a formatted text message with optional parse mode
+// SendRichText sends a formatted text message with optional parse mode.
+// Calling it again updates the sent message. Text longer than MaxMessageLength
+// continues in further messages, and only the messages whose text changed are edited.
+// With ParseModeMarkdown the text is rendered into message entities; if Telegram
+// rejects the formatting, the message is sent as plain text instead.
 func (s *MessageSender) SendRichText(text string, parseMode string) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -89,40 +180,109 @@ func (s *MessageSender) SendRichText(text string, parseMode string) error {
 		}
 	}
 
-	if s.messageID == 0 {
-		// First message - send a new message
-		msg := tgbotapi.NewMessage(s.chatID, text)
-		if parseMode != "" {
-			msg.ParseMode = parseMode
+	parts := renderMessage(text, parseMode)
+	messageIDs := s.replyMessageIDs()
+
+	for i, part := range parts {
+		if i < len(s.sentParts) && s.sentParts[i].equal(part) {
+			continue
 		}
 
-		sent, err := s.client.Send(msg)
-		if err != nil {
-			return fmt.Errorf("failed to send message: %w", err)
+		// Only the last message of the reply shows the keyboard
+		var keyboard *tgbotapi.InlineKeyboardMarkup
+		if i == len(parts)-1 {
+			keyboard = s.keyboard
 		}
 
-		s.messageID = sent.MessageID
-		s.lastUpdateTime = time.Now()
-		return nil
+		if i < len(messageIDs) {
+			// Update existing message
+			if err := s.editPart(messageIDs[i], part, keyboard); err != nil {
+				return err
+			}
+		} else {
+			// Send a new message, continuing the reply
+			sent, err := s.sendPart(part, keyboard)
+			if err != nil {
+				return err
+			}
+			if i == 0 {
+				s.messageID = sent.MessageID
+			} else {
+				s.continuationIDs = append(s.continuationIDs, sent.MessageID)
+			}
+			messageIDs = append(messageIDs, sent.MessageID)
+		}
+
+		if i < len(s.sentParts) {
+			s.sentParts[i] = part
+		} else {
+			s.sentParts = append(s.sentParts, part)
+		}
 	}
 
-	// Update existing message
-	edit := tgbotapi.NewEditMessageText(s.chatID, s.messageID, text)
-	if parseMode != "" {
-		edit.ParseMode = parseMode
+	// Remove continuation messages left over from a longer previous text
+	if len(messageIDs) > len(parts) {
+		if err := s.deleteMessages(messageIDs[len(parts):]); err != nil {
+			return err
+		}
+		s.continuationIDs = s.continuationIDs[:len(parts)-1]
+		s.sentParts = s.sentParts[:len(parts)]
 	}
 
-	_, err := s.client.Send(edit)
+	s.lastUpdateTime = time.Now()
+	return nil
+}
+
+// sendPart sends one message of a reply, falling back to plain text if the formatting is rejected
+func (s *MessageSender) sendPart(part messagePart, keyboard *tgbotapi.InlineKeyboardMarkup) (tgbotapi.Message, error) {
+	msg := tgbotapi.NewMessage(s.chatID, part.text)
+	msg.ParseMode = part.parseMode
+	msg.Entities = part.entities
+	if keyboard != nil {
+		msg.ReplyMarkup = *keyboard
+	}
+
+	sent, err := s.client.Send(msg)
+	if err != nil && part.formatted() && isFormattingError(err) {
+		msg.ParseMode = ""
+		msg.Entities = nil
+		sent, err = s.client.Send(msg)
+	}
 	if err != nil {
-		// If edit fails (e.g., message is too old or identical), ignore the error
-		// This is common in streaming scenarios
-		return nil
+		return tgbotapi.Message{}, fmt.Errorf("failed to send message: %w", err)
 	}
+	return sent, nil
+}
 
-	s.lastUpdateTime = time.Now()
+// editPart updates one message of a reply, falling back to plain text if the formatting is rejected
+func (s *MessageSender) editPart(messageID int, part messagePart, keyboard *tgbotapi.InlineKeyboardMarkup) error {
+	edit := tgbotapi.NewEditMessageText(s.chatID, messageID, part.text)
+	edit.ParseMode = part.parseMode
+	edit.Entities = part.entities
+	edit.ReplyMarkup = keyboard
+
+	_, err := s.client.Send(edit)
+	if err != nil && part.formatted() && isFormattingError(err) {
+		edit.ParseMode = ""
+		edit.Entities = nil
+		_, err = s.client.Send(edit)
+	}
+	if err != nil && !isMessageNotModified(err) {
+		return fmt.Errorf("failed to edit message: %w", err)
+	}
 	return nil
 }
 
+// isFormattingError reports whether Telegram rejected the parse mode markup or the entities of a message
+func isFormattingError(err error) bool {
+	return strings.Contains(strings.ToLower(err.Error()), "entit")
+}
+
+// isMessageNotModified reports whether an edit failed because the text did not change
+func isMessageNotModified(err error) bool {
+	return strings.Contains(err.Error(), "message is not modified")
+}
+
 // SendPhoto sends a photo message
 func (s *MessageSender) SendPhoto(photoURL string) error {
 	return s.SendPhotoWithCaption(photoURL, "")
@@ -154,7 +314,7 @@ func (s *MessageSender) SendPhotoWithCaption(photoURL string, caption string) er
 	}
 
 	// Store the message ID in case we need it later
-	s.messageID = sent.MessageID
+	s.setMessage(sent.MessageID)
 	return nil
 }
 
@@ -177,10 +337,66 @@ func (s *MessageSender) SendPhotoBytes(photoData []byte, caption string) error {
 		return fmt.Errorf("failed to send photo bytes: %w", err)
 	}
 
-	s.messageID = sent.MessageID
+	s.setMessage(sent.MessageID)
 	return nil
 }
 
+// maxMediaGroupSize is the maximum number of items Telegram accepts in one media group
+const maxMediaGroupSize = 10
+
+// maxCaptionLength is the maximum caption length Telegram accepts for media
+const maxCaptionLength = 1024
+
+// SendMediaGroup sends photos as a single album, with the caption attached to the first photo.
+// A single photo is sent as a regular photo message.
+func (s *MessageSender) SendMediaGroup(photos []tgbotapi.RequestFileData, caption string) ([]tgbotapi.Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(photos) == 0 {
+		return nil, fmt.Errorf("no photos to send")
+	}
+	if len(photos) > maxMediaGroupSize {
+		return nil, fmt.Errorf("too many photos for a media group: %d (max %d)", len(photos), maxMediaGroupSize)
+	}
+
+	if runes := []rune(caption); len(runes) > maxCaptionLength {
+		caption = string(runes[:maxCaptionLength-1]) + "…"
+	}
+
+	if len(photos) == 1 {
+		msg := tgbotapi.NewPhoto(s.chatID, photos[0])
+		msg.Caption = caption
+
+		sent, err := s.client.Send(msg)
+		if err != nil {
+			return nil, fmt.Errorf("failed to send photo: %w", err)
+		}
+
+		s.setMessage(sent.MessageID)
+		return []tgbotapi.Message{sent}, nil
+	}
+
+	media := make([]interface{}, 0, len(photos))
+	for i, photo := range photos {
+		item := tgbotapi.NewInputMediaPhoto(photo)
+		if i == 0 {
+			item.Caption = caption
+		}
+		media = append(media, item)
+	}
+
+	messages, err := s.client.SendMediaGroup(tgbotapi.NewMediaGroup(s.chatID, media))
+	if err != nil {
+		return nil, fmt.Errorf("failed to send media group: %w", err)
+	}
+
+	if len(messages) > 0 {
+		s.setMessage(messages[len(messages)-1].MessageID)
+	}
+	return messages, nil
+}
+
 // SendRawMessage sends a raw Telegram message config
 func (s *MessageSender) SendRawMessage(config tgbotapi.Chattable) (tgbotapi.Message, error) {
 	s.mu.Lock()
@@ -191,7 +407,7 @@ func (s *MessageSender) SendRawMessage(config tgbotapi.Chattable) (tgbotapi.Mess
 		return tgbotapi.Message{}, fmt.Errorf("failed to send raw message: %w", err)
 	}
 
-	s.messageID = sent.MessageID
+	s.setMessage(sent.MessageID)
 	return sent, nil
 }
 
@@ -211,7 +427,7 @@ func (s *MessageSender) SendMessageWithKeyboard(text string, keyboard tgbotapi.I
 		return fmt.Errorf("failed to send message with keyboard: %w", err)
 	}
 
-	s.messageID = sent.MessageID
+	s.setMessage(sent.MessageID)
 	return nil
 }
 
@@ -231,7 +447,7 @@ func (s *MessageSender) SendMessageWithReplyKeyboard(text string, keyboard tgbot
 		return fmt.Errorf("failed to send message with reply keyboard: %w", err)
 	}
 
-	s.messageID = sent.MessageID
+	s.setMessage(sent.MessageID)
 	return nil
 }
 
@@ -251,7 +467,7 @@ func (s *MessageSender) SendMessageWithReplyKeyboardRemove(text string, parseMod
 		return fmt.Errorf("failed to send message with keyboard removal: %w", err)
 	}
 
-	s.messageID = sent.MessageID
+	s.setMessage(sent.MessageID)
 	return nil
 }
 
@@ -278,7 +494,7 @@ func (s *MessageSender) EditMessageReplyMarkup(keyboard tgbotapi.InlineKeyboardM
 	return nil
 }
 
-// DeleteMessage deletes the current message
+// DeleteMessage deletes the current message, including the continuation messages of a long reply
 func (s *MessageSender) DeleteMessage() error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -287,22 +503,40 @@ func (s *MessageSender) DeleteMessage() error {
 		return fmt.Errorf("no message to delete")
 	}
 
-	deleteConfig := tgbotapi.NewDeleteMessage(s.chatID, s.messageID)
-	_, err := s.client.Request(deleteConfig)
-	if err != nil {
-		return fmt.Errorf("failed to delete message: %w", err)
+	if err := s.deleteMessages(s.replyMessageIDs()); err != nil {
+		return err
 	}
 
-	s.messageID = 0
+	s.setMessage(0)
 	return nil
 }
 
+// DeleteMessages deletes the given messages of the chat, e.g. all parts of a previous reply
+func (s *MessageSender) DeleteMessages(messageIDs []int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.deleteMessages(messageIDs)
+}
+
+// deleteMessages deletes every message, returning the first error
+func (s *MessageSender) deleteMessages(messageIDs []int) error {
+	var firstErr error
+	for _, messageID := range messageIDs {
+		deleteConfig := tgbotapi.NewDeleteMessage(s.chatID, messageID)
+		if _, err := s.client.Request(deleteConfig); err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("failed to delete message: %w", err)
+		}
+	}
+	return firstErr
+}
+
 // Reset resets the sender state (clears message ID and context)
 func (s *MessageSender) Reset() {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	s.messageID = 0
+	s.setMessage(0)
+	s.keyboard = nil
 	s.context = make(map[string]interface{})
 	s.lastUpdateTime = time.Time{}
 }
@@ -1,11 +1,14 @@
 package sender
 
 import (
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 	"github.com/tbxark/ChatGPT-Telegram-Workers/go_version/internal/telegram/api"
 )
 
@@ -144,3 +147,183 @@ func TestMessageSender_StreamIntervalRespected(t *testing.T) {
 		t.Error("lastUpdateTime changed unexpectedly")
 	}
 }
+
+func TestMessageSender_SendMediaGroup(t *testing.T) {
+	var methods []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		methods = append(methods, r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:])
+		w.WriteHeader(http.StatusOK)
+		if strings.HasSuffix(r.URL.Path, "/sendMediaGroup") {
+			w.Write([]byte(`{"ok":true,"result":[{"message_id":10,"chat":{"id":12345}},{"message_id":11,"chat":{"id":12345}}]}`))
+			return
+		}
+		w.Write([]byte(`{"ok":true,"result":{"message_id":20,"chat":{"id":12345}}}`))
+	}))
+	t.Cleanup(server.Close)
+
+	client, err := api.NewClient("123456:ABC-DEF1234ghIkl-zyx57W2v1u123ew11", server.URL)
+	if err != nil {
+		t.Fatalf("Failed to create mock client: %v", err)
+	}
+	sender := NewMessageSender(client, 12345)
+
+	// Multiple photos are sent as an album
+	photos := []tgbotapi.RequestFileData{
+		tgbotapi.FileURL("https://example.com/1.png"),
+		tgbotapi.FileURL("https://example.com/2.png"),
+	}
+	messages, err := sender.SendMediaGroup(photos, "revised prompt")
+	if err != nil {
+		t.Fatalf("SendMediaGroup() error = %v", err)
+	}
+	if len(messages) != 2 {
+		t.Errorf("SendMediaGroup() returned %d messages, want 2", len(messages))
+	}
+	if sender.GetMessageID() != 11 {
+		t.Errorf("messageID = %v, want 11", sender.GetMessageID())
+	}
+
+	// A single photo is sent as a regular photo
+	if _, err := sender.SendMediaGroup(photos[:1], ""); err != nil {
+		t.Fatalf("SendMediaGroup() error = %v", err)
+	}
+
+	if len(methods) != 2 || methods[0] != "sendMediaGroup" || methods[1] != "sendPhoto" {
+		t.Errorf("API methods called = %v, want [sendMediaGroup sendPhoto]", methods)
+	}
+
+	// Empty and oversized groups are rejected
+	if _, err := sender.SendMediaGroup(nil, ""); err == nil {
+		t.Error("SendMediaGroup() with no photos should return an error")
+	}
+	tooMany := make([]tgbotapi.RequestFileData, maxMediaGroupSize+1)
+	for i := range tooMany {
+		tooMany[i] = tgbotapi.FileURL("https://example.com/x.png")
+	}
+	if _, err := sender.SendMediaGroup(tooMany, ""); err == nil {
+		t.Error("SendMediaGroup() with too many photos should return an error")
+	}
+}
+
+func TestMessageSender_SendRichTextSplitsLongText(t *testing.T) {
+	var calls []string
+	nextMessageID := 100
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		method := r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]
+		calls = append(calls, method+":"+r.Form.Get("message_id"))
+		w.WriteHeader(http.StatusOK)
+		switch method {
+		case "sendMessage":
+			nextMessageID++
+			w.Write([]byte(fmt.Sprintf(`{"ok":true,"result":{"message_id":%d,"chat":{"id":12345}}}`, nextMessageID)))
+		case "editMessageText":
+			w.Write([]byte(fmt.Sprintf(`{"ok":true,"result":{"message_id":%s,"chat":{"id":12345}}}`, r.Form.Get("message_id"))))
+		default:
+			w.Write([]byte(`{"ok":true,"result":true}`))
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	client, err := api.NewClient("123456:ABC-DEF1234ghIkl-zyx57W2v1u123ew11", server.URL)
+	if err != nil {
+		t.Fatalf("Failed to create mock client: %v", err)
+	}
+	sender := NewMessageSender(client, 12345)
+
+	paragraph := strings.Repeat("a", 3000)
+
+	// Short text is a single message
+	if err := sender.SendRichText(paragraph, ""); err != nil {
+		t.Fatalf("SendRichText() error = %v", err)
+	}
+	// Growing beyond the limit continues in a new message without editing the first one
+	if err := sender.SendRichText(paragraph+"\n\n"+paragraph, ""); err != nil {
+		t.Fatalf("SendRichText() error = %v", err)
+	}
+	// Only the changed message is edited
+	if err := sender.SendRichText(paragraph+"\n\n"+paragraph+" more", ""); err != nil {
+		t.Fatalf("SendRichText() error = %v", err)
+	}
+
+	want := []string{"sendMessage:", "sendMessage:", "editMessageText:102"}
+	if strings.Join(calls, ",") != strings.Join(want, ",") {
+		t.Errorf("API calls = %v, want %v", calls, want)
+	}
+	if ids := sender.MessageIDs(); len(ids) != 2 || ids[0] != 101 || ids[1] != 102 {
+		t.Errorf("MessageIDs() = %v, want [101 102]", ids)
+	}
+
+	// Deleting removes the whole reply
+	calls = nil
+	if err := sender.DeleteMessage(); err != nil {
+		t.Fatalf("DeleteMessage() error = %v", err)
+	}
+	want = []string{"deleteMessage:101", "deleteMessage:102"}
+	if strings.Join(calls, ",") != strings.Join(want, ",") {
+		t.Errorf("API calls = %v, want %v", calls, want)
+	}
+	if ids := sender.MessageIDs(); len(ids) != 0 {
+		t.Errorf("MessageIDs() after DeleteMessage() = %v, want none", ids)
+	}
+}
+
+func TestMessageSender_KeyboardOnLastMessage(t *testing.T) {
+	var calls []string
+	nextMessageID := 100
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		method := r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]
+		markup := ""
+		if r.Form.Get("reply_markup") != "" {
+			markup = "+keyboard"
+		}
+		calls = append(calls, method+":"+r.Form.Get("message_id")+markup)
+		w.WriteHeader(http.StatusOK)
+		switch method {
+		case "sendMessage":
+			nextMessageID++
+			w.Write([]byte(fmt.Sprintf(`{"ok":true,"result":{"message_id":%d,"chat":{"id":12345}}}`, nextMessageID)))
+		default:
+			w.Write([]byte(`{"ok":true,"result":{"message_id":1,"chat":{"id":12345}}}`))
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	client, err := api.NewClient("123456:ABC-DEF1234ghIkl-zyx57W2v1u123ew11", server.URL)
+	if err != nil {
+		t.Fatalf("Failed to create mock client: %v", err)
+	}
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("🔄", "rg:"),
+	))
+	paragraph := strings.Repeat("a", 3000)
+
+	// The keyboard is attached to the last message of a sent reply
+	sender := NewMessageSender(client, 12345)
+	if err := sender.SendRichText(paragraph+"\n\n"+paragraph, ""); err != nil {
+		t.Fatalf("SendRichText() error = %v", err)
+	}
+	if err := sender.AttachKeyboard(keyboard); err != nil {
+		t.Fatalf("AttachKeyboard() error = %v", err)
+	}
+
+	// A resumed reply is edited in place, the keyboard following its new last message
+	resumed := NewMessageSender(client, 12345)
+	resumed.Resume(sender.MessageIDs())
+	resumed.SetKeyboard(&keyboard)
+	if err := resumed.SendRichText("short", ""); err != nil {
+		t.Fatalf("SendRichText() error = %v", err)
+	}
+
+	want := []string{
+		"sendMessage:", "sendMessage:", "editMessageReplyMarkup:102+keyboard",
+		"editMessageText:101+keyboard", "deleteMessage:102",
+	}
+	if strings.Join(calls, ",") != strings.Join(want, ",") {
+		t.Errorf("API calls = %v, want %v", calls, want)
+	}
+	if ids := resumed.MessageIDs(); len(ids) != 1 || ids[0] != 101 {
+		t.Errorf("MessageIDs() = %v, want [101]", ids)
+	}
+}
@@ -0,0 +1,289 @@
+package sender
+
+import (
+	"regexp"
+	"strings"
+	"unicode/utf16"
+)
+
+// MaxMessageLength is the maximum length of a Telegram text message, in UTF-16 code units
+const MaxMessageLength = 4096
+
+// codeFence starts and ends a Markdown code block
+const codeFence = "```"
+
+// htmlTagPattern matches an opening or closing HTML tag
+var htmlTagPattern = regexp.MustCompile(`<(/?)([a-zA-Z][a-zA-Z0-9-]*)[^>]*>`)
+
+// Units of text, from the coarsest to the finest; a unit that does not fit is split into units of the next kind
+const (
+	unitText  = iota
+	unitBlock // Paragraph or code block
+	unitLine
+	unitWord
+	unitRune
+)
+
+// SplitMessage splits text into chunks that each fit in a single Telegram message.
+// Chunks are cut at paragraph and code block boundaries where possible, then at
+// line breaks, then at whitespace. Markup is kept balanced for the parse mode:
+// a Markdown code block cut in two is closed and reopened with the same fence,
+// and open HTML tags are closed at the end of a chunk and reopened in the next.
+// An unterminated code block or tag at the end of the text is closed as well,
+// so partial text can be sent while streaming.
+func SplitMessage(text string, parseMode string, limit int) []string {
+	if text == "" {
+		return []string{text}
+	}
+
+	s := &splitter{
+		html:      parseMode == "HTML",
+		markdown:  strings.HasPrefix(parseMode, "Markdown"),
+		limit:     limit,
+		lineStart: true,
+	}
+	s.add(text, unitText)
+	s.flush()
+
+	if len(s.chunks) == 0 {
+		return []string{text}
+	}
+	return s.chunks
+}
+
+// splitter packs units of text into chunks, tracking the markup left open at the end of the current chunk
+type splitter struct {
+	html     bool
+	markdown bool
+	limit    int
+	chunks   []string
+
+	current    strings.Builder
+	currentLen int      // Length of current in UTF-16 code units
+	prefix     string   // Markup reopened at the start of current
+	fence      string   // Opening line of the code block open at the end of current
+	tags       []string // HTML tags open at the end of current
+	lineStart  bool     // Whether current ends at the start of a line
+}
+
+// add appends unit to the current chunk, starting new chunks and splitting
+// the unit further when it does not fit
+func (s *splitter) add(unit string, level int) {
+	if unit == "" {
+		return
+	}
+	if s.fits(unit) {
+		s.write(unit)
+		return
+	}
+	if s.currentLen > utf16Len(s.prefix) {
+		s.flush()
+		if s.fits(unit) {
+			s.write(unit)
+			return
+		}
+	}
+	if level >= unitRune {
+		// A single rune that does not fit even in an empty chunk
+		s.write(unit)
+		return
+	}
+	for _, part := range s.subdivide(unit, level) {
+		s.add(part, level+1)
+	}
+}
+
+// subdivide splits unit into units of the next finer kind
+func (s *splitter) subdivide(unit string, level int) []string {
+	switch level {
+	case unitText:
+		return s.splitBlocks(unit)
+	case unitBlock:
+		return strings.SplitAfter(unit, "\n")
+	case unitLine:
+		return s.splitWords(unit)
+	default:
+		return strings.Split(unit, "")
+	}
+}
+
+// splitBlocks splits text after blank lines and after code blocks
+func (s *splitter) splitBlocks(text string) []string {
+	var blocks []string
+	var block strings.Builder
+	inFence := s.fence != ""
+	for _, line := range strings.SplitAfter(text, "\n") {
+		block.WriteString(line)
+		boundary := false
+		if s.markdown && isFenceLine(line) {
+			inFence = !inFence
+			boundary = !inFence
+		} else if !inFence && strings.TrimSpace(line) == "" {
+			boundary = true
+		}
+		if boundary {
+			blocks = append(blocks, block.String())
+			block.Reset()
+		}
+	}
+	if block.Len() > 0 {
+		blocks = append(blocks, block.String())
+	}
+	return blocks
+}
+
+// splitWords splits a line after whitespace, keeping HTML tags whole
+func (s *splitter) splitWords(line string) []string {
+	var words []string
+	var word strings.Builder
+	runes := []rune(line)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		if s.html && r == '<' {
+			if end := strings.IndexRune(string(runes[i:]), '>'); end > 0 {
+				if word.Len() > 0 {
+					words = append(words, word.String())
+					word.Reset()
+				}
+				tag := string(runes[i:])[:end+1]
+				words = append(words, tag)
+				i += len([]rune(tag)) - 1
+				continue
+			}
+		}
+		word.WriteRune(r)
+		if r == ' ' || r == '\t' || r == '\n' {
+			words = append(words, word.String())
+			word.Reset()
+		}
+	}
+	if word.Len() > 0 {
+		words = append(words, word.String())
+	}
+	return words
+}
+
+// fits reports whether unit can be appended to the current chunk, including the markup needed to close it
+func (s *splitter) fits(unit string) bool {
+	fence, tags, _ := s.stateAfter(unit)
+	return s.currentLen+utf16Len(unit)+utf16Len(closingMarkup(fence, tags)) <= s.limit
+}
+
+// write appends unit to the current chunk
+func (s *splitter) write(unit string) {
+	s.fence, s.tags, s.lineStart = s.stateAfter(unit)
+	s.current.WriteString(unit)
+	s.currentLen += utf16Len(unit)
+}
+
+// flush closes the current chunk and starts a new one that reopens the open markup
+func (s *splitter) flush() {
+	body := strings.TrimRight(s.current.String(), " \t\n")
+	if body != "" && body != strings.TrimRight(s.prefix, "\n") {
+		s.chunks = append(s.chunks, body+closingMarkup(s.fence, s.tags))
+	}
+
+	s.prefix = openingMarkup(s.fence, s.tags)
+	s.current.Reset()
+	s.current.WriteString(s.prefix)
+	s.currentLen = utf16Len(s.prefix)
+	s.lineStart = true
+}
+
+// stateAfter returns the open code block, the open HTML tags and whether
+// a line starts after appending unit to the current chunk
+func (s *splitter) stateAfter(unit string) (string, []string, bool) {
+	fence := s.fence
+	tags := s.tags
+	lineStart := s.lineStart
+
+	if s.markdown {
+		for _, line := range strings.SplitAfter(unit, "\n") {
+			if line == "" {
+				continue
+			}
+			if lineStart && isFenceLine(line) {
+				if fence == "" {
+					fence = strings.TrimSpace(line)
+				} else {
+					fence = ""
+				}
+			}
+			lineStart = strings.HasSuffix(line, "\n")
+		}
+	} else {
+		lineStart = strings.HasSuffix(unit, "\n")
+	}
+
+	if s.html {
+		matches := htmlTagPattern.FindAllStringSubmatch(unit, -1)
+		if len(matches) > 0 {
+			tags = append([]string(nil), tags...)
+		}
+		for _, match := range matches {
+			if match[1] == "" {
+				tags = append(tags, match[0])
+				continue
+			}
+			for i := len(tags) - 1; i >= 0; i-- {
+				if htmlTagName(tags[i]) == strings.ToLower(match[2]) {
+					tags = append(tags[:i], tags[i+1:]...)
+					break
+				}
+			}
+		}
+	}
+
+	return fence, tags, lineStart
+}
+
+// openingMarkup returns the markup that reopens a code block and HTML tags in a new chunk
+func openingMarkup(fence string, tags []string) string {
+	var sb strings.Builder
+	for _, tag := range tags {
+		sb.WriteString(tag)
+	}
+	if fence != "" {
+		sb.WriteString(fence)
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
+// closingMarkup returns the markup that closes a code block and HTML tags at the end of a chunk
+func closingMarkup(fence string, tags []string) string {
+	var sb strings.Builder
+	if fence != "" {
+		sb.WriteString("\n")
+		sb.WriteString(codeFence)
+	}
+	for i := len(tags) - 1; i >= 0; i-- {
+		sb.WriteString("</")
+		sb.WriteString(htmlTagName(tags[i]))
+		sb.WriteString(">")
+	}
+	return sb.String()
+}
+
+// isFenceLine reports whether a line opens or closes a Markdown code block
+func isFenceLine(line string) bool {
+	return strings.HasPrefix(strings.TrimSpace(line), codeFence)
+}
+
+// htmlTagName returns the lowercase name of an opening HTML tag
+func htmlTagName(tag string) string {
+	match := htmlTagPattern.FindStringSubmatch(tag)
+	if match == nil {
+		return ""
+	}
+	return strings.ToLower(match[2])
+}
+
+// utf16Len returns the length of text in UTF-16 code units, as counted by Telegram
+func utf16Len(text string) int {
+	n := 0
+	for _, r := range text {
+		n += utf16.RuneLen(r)
+	}
+	return n
+}
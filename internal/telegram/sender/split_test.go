@@ -0,0 +1,121 @@
+package sender
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSplitMessage_ShortText(t *testing.T) {
+	tests := []struct {
+		name      string
+		text      string
+		parseMode string
+		want      string
+	}{
+		{"plain", "hello world", "", "hello world"},
+		{"empty", "", "Markdown", ""},
+		{"closed code block", "```go\nfmt.Println()\n```", "Markdown", "```go\nfmt.Println()\n```"},
+		{"unterminated code block", "look:\n```go\nfmt.Pri", "Markdown", "look:\n```go\nfmt.Pri\n```"},
+		{"unterminated HTML tag", "<b>bold <i>text", "HTML", "<b>bold <i>text</i></b>"},
+		{"fences are plain text in HTML", "```go\ncode", "HTML", "```go\ncode"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chunks := SplitMessage(tt.text, tt.parseMode, MaxMessageLength)
+			if len(chunks) != 1 || chunks[0] != tt.want {
+				t.Errorf("SplitMessage() = %q, want [%q]", chunks, tt.want)
+			}
+		})
+	}
+}
+
+func TestSplitMessage_ParagraphBoundaries(t *testing.T) {
+	paragraph := strings.Repeat("word ", 15) // 75 characters
+	text := paragraph + "\n\n" + paragraph + "\n\n" + paragraph
+
+	chunks := SplitMessage(text, "", 160)
+	if len(chunks) != 2 {
+		t.Fatalf("SplitMessage() returned %d chunks, want 2: %q", len(chunks), chunks)
+	}
+	if chunks[0] != strings.TrimSpace(paragraph+"\n\n"+paragraph) {
+		t.Errorf("first chunk = %q, want the first two paragraphs", chunks[0])
+	}
+	if chunks[1] != strings.TrimSpace(paragraph) {
+		t.Errorf("second chunk = %q, want the last paragraph", chunks[1])
+	}
+}
+
+func TestSplitMessage_CodeBlockAcrossChunks(t *testing.T) {
+	var code strings.Builder
+	for i := 0; i < 20; i++ {
+		code.WriteString("fmt.Println(\"line\")\n")
+	}
+	text := "Example:\n\n```go\n" + code.String() + "```\nDone."
+
+	chunks := SplitMessage(text, "Markdown", 200)
+	if len(chunks) < 3 {
+		t.Fatalf("SplitMessage() returned %d chunks, want at least 3", len(chunks))
+	}
+	if chunks[0] != "Example:" {
+		t.Errorf("first chunk = %q, want the paragraph before the code block", chunks[0])
+	}
+
+	var joined strings.Builder
+	for i, chunk := range chunks {
+		if n := utf16Len(chunk); n > 200 {
+			t.Errorf("chunk %d has length %d, want <= 200", i, n)
+		}
+		if strings.Count(chunk, codeFence)%2 != 0 {
+			t.Errorf("chunk %d has unbalanced code fences: %q", i, chunk)
+		}
+		if i > 0 && i < len(chunks)-1 && !strings.HasPrefix(chunk, "```go\n") {
+			t.Errorf("chunk %d does not reopen the code block: %q", i, chunk)
+		}
+		joined.WriteString(chunk)
+	}
+	if got := strings.Count(joined.String(), "fmt.Println"); got != 20 {
+		t.Errorf("chunks contain %d code lines, want 20", got)
+	}
+	if !strings.HasSuffix(chunks[len(chunks)-1], "Done.") {
+		t.Errorf("last chunk = %q, want it to end with the text after the code block", chunks[len(chunks)-1])
+	}
+}
+
+func TestSplitMessage_HTMLTagsAcrossChunks(t *testing.T) {
+	text := `<blockquote><a href="https://example.com">` + strings.Repeat("quoted text ", 30) + "</a></blockquote>"
+
+	chunks := SplitMessage(text, "HTML", 150)
+	if len(chunks) < 2 {
+		t.Fatalf("SplitMessage() returned %d chunks, want at least 2", len(chunks))
+	}
+	for i, chunk := range chunks {
+		if n := utf16Len(chunk); n > 150 {
+			t.Errorf("chunk %d has length %d, want <= 150", i, n)
+		}
+		if !strings.HasPrefix(chunk, `<blockquote><a href="https://example.com">`) {
+			t.Errorf("chunk %d does not open the tags: %q", i, chunk)
+		}
+		if !strings.HasSuffix(chunk, "</a></blockquote>") {
+			t.Errorf("chunk %d does not close the tags: %q", i, chunk)
+		}
+	}
+}
+
+func TestSplitMessage_LongWord(t *testing.T) {
+	// Emoji are two UTF-16 code units each
+	text := strings.Repeat("😀", 150)
+
+	chunks := SplitMessage(text, "", 100)
+	if len(chunks) != 3 {
+		t.Fatalf("SplitMessage() returned %d chunks, want 3", len(chunks))
+	}
+	if strings.Join(chunks, "") != text {
+		t.Error("chunks do not add up to the original text")
+	}
+	for i, chunk := range chunks {
+		if n := utf16Len(chunk); n > 100 {
+			t.Errorf("chunk %d has length %d, want <= 100", i, n)
+		}
+	}
+}
@@ -0,0 +1,280 @@
+package testutil
+
+import (
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/tbxark/ChatGPT-Telegram-Workers/go_version/internal/config"
+	"github.com/tbxark/ChatGPT-Telegram-Workers/go_version/internal/i18n"
+	"github.com/tbxark/ChatGPT-Telegram-Workers/go_version/internal/storage"
+	"github.com/tbxark/ChatGPT-Telegram-Workers/go_version/internal/telegram/api"
+	"github.com/tbxark/ChatGPT-Telegram-Workers/go_version/internal/telegram/command"
+	"github.com/tbxark/ChatGPT-Telegram-Workers/go_version/internal/telegram/handler"
+)
+
+// harnessDBCounter gives each harness its own in-memory SQLite database
+var harnessDBCounter atomic.Int64
+
+// TestBotToken is the bot token used by the harness (bot ID 123456)
+const TestBotToken = "123456:TEST-TOKEN"
+
+// Harness drives the real update handler chain offline: updates go through
+// UpdateHandlerChain, chat completions are served by a FakeLLMServer and
+// Bot API calls are recorded by a FakeBotAPI. Storage is a fresh in-memory SQLite database.
+type Harness struct {
+	T        testing.TB
+	Config   *config.Config
+	DB       storage.Storage
+	LLM      *FakeLLMServer
+	Bot      *FakeBotAPI
+	Client   *api.Client
+	Registry *command.Registry
+	Chain    *handler.UpdateHandlerChain
+
+	share         config.ShareContext
+	permChecker   config.PermissionChecker
+	nextUpdateID  int
+	nextMessageID int
+}
+
+// NewHarness creates a harness using the OpenAI-compatible fake provider.
+// env overrides configuration variables (e.g. "STREAM_MODE": "false"); the configuration
+// is loaded through config.LoadConfig, so defaults match production.
+func NewHarness(t testing.TB, env map[string]string) *Harness {
+	t.Helper()
+
+	llm := NewFakeLLMServer()
+	t.Cleanup(llm.Close)
+	bot := NewFakeBotAPI()
+	t.Cleanup(bot.Close)
+
+	vars := map[string]string{
+		"TELEGRAM_AVAILABLE_TOKENS": TestBotToken,
+		"TELEGRAM_API_DOMAIN":       bot.URL,
+		"AI_PROVIDER":               "openai",
+		"OPENAI_API_KEY":            "sk-test",
+		"OPENAI_API_BASE":           llm.APIBase(),
+		"OPENAI_CHAT_MODEL":         "gpt-4o-mini",
+		"ANTHROPIC_API_KEY":         "sk-ant-test",
+		"ANTHROPIC_API_BASE":        llm.APIBase(),
+		"LANGUAGE":                  "en",
+		"I_AM_A_GENEROUS_PERSON":    "true",
+		"MANAGER_ENABLED":           "false",
+		"TELEGRAPH_ENABLED":         "false",
+		"DSN":                       "",
+		"DB_PATH":                   fmt.Sprintf("file:harness%d?mode=memory&cache=shared", harnessDBCounter.Add(1)),
+	}
+	for key, value := range env {
+		vars[key] = value
+	}
+	for key, value := range vars {
+		setenv(t, key, value)
+	}
+
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		t.Fatalf("failed to load config: %v", err)
+	}
+
+	db, err := storage.NewStorage(cfg.DSN, cfg.DBPath)
+	if err != nil {
+		t.Fatalf("failed to create storage: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	client, err := api.NewClient(TestBotToken, cfg.TelegramAPIDomain)
+	if err != nil {
+		t.Fatalf("failed to create Telegram client: %v", err)
+	}
+
+	share, err := config.NewShareContext(TestBotToken)
+	if err != nil {
+		t.Fatalf("failed to create share context: %v", err)
+	}
+
+	i18nInstance := i18n.LoadI18n(cfg.Language)
+	permChecker := config.NewDefaultPermissionChecker(cfg, command.IsGroupAdmin)
+	registry := command.BuildCommandRegistry(cfg, i18nInstance)
+	registry.SetPermissionChecker(permChecker)
+
+	return &Harness{
+		T:             t,
+		Config:        cfg,
+		DB:            db,
+		LLM:           llm,
+		Bot:           bot,
+		Client:        client,
+		Registry:      registry,
+		Chain:         handler.BuildUpdateHandlerChain(cfg, i18nInstance, registry),
+		share:         *share,
+		permChecker:   permChecker,
+		nextUpdateID:  1,
+		nextMessageID: 1,
+	}
+}
+
+// setenv sets an environment variable for the duration of the test
+func setenv(t testing.TB, key, value string) {
+	if tt, ok := t.(interface{ Setenv(key, value string) }); ok {
+		tt.Setenv(key, value)
+		return
+	}
+	t.Fatalf("harness requires a testing.T or testing.B to set %s", key)
+}
+
+// BotID returns the bot ID derived from TestBotToken
+func (h *Harness) BotID() int64 {
+	return h.share.BotID
+}
+
+// Dispatch runs an update through the handler chain with a fresh worker context
+func (h *Harness) Dispatch(update *tgbotapi.Update) error {
+	ctx := config.NewWorkerContextWithPermission(h.share, h.DB, h.Config, h.permChecker)
+	ctx.Bot = h.Client
+	return h.Chain.Handle(update, ctx)
+}
+
+// PrivateMessage builds an update with a text message in a private chat with userID
+func (h *Harness) PrivateMessage(userID int64, text string) *tgbotapi.Update {
+	chat := &tgbotapi.Chat{ID: userID, Type: "private"}
+	return h.messageUpdate(chat, userID, text)
+}
+
+// GroupMessage builds an update with a text message from userID in a group chat
+func (h *Harness) GroupMessage(chatID, userID int64, text string) *tgbotapi.Update {
+	chat := &tgbotapi.Chat{ID: chatID, Type: "supergroup", Title: "Test Group"}
+	return h.messageUpdate(chat, userID, text)
+}
+
+// TopicMessage builds an update with a text message from userID in a forum topic of a group chat
+func (h *Harness) TopicMessage(chatID int64, threadID int, userID int64, text string) *tgbotapi.Update {
+	chat := &tgbotapi.Chat{ID: chatID, Type: "supergroup", Title: "Test Forum"}
+	update := h.messageUpdate(chat, userID, text)
+	api.SetMessageThreadID(update.Message, threadID)
+	return update
+}
+
+// PhotoMessage builds an update with a photo from userID in a private chat;
+// photos of the same album share a mediaGroupID
+func (h *Harness) PhotoMessage(userID int64, fileID, caption, mediaGroupID string) *tgbotapi.Update {
+	chat := &tgbotapi.Chat{ID: userID, Type: "private"}
+	update := h.messageUpdate(chat, userID, "")
+	update.Message.Photo = []tgbotapi.PhotoSize{{FileID: fileID, FileUniqueID: fileID, Width: 1280, Height: 960}}
+	update.Message.Caption = caption
+	update.Message.MediaGroupID = mediaGroupID
+	return update
+}
+
+// InlineQuery builds an inline query update (@bot query) from userID
+func (h *Harness) InlineQuery(userID int64, query string) *tgbotapi.Update {
+	update := &tgbotapi.Update{
+		UpdateID: h.nextUpdateID,
+		InlineQuery: &tgbotapi.InlineQuery{
+			ID:    fmt.Sprintf("query%d", h.nextUpdateID),
+			From:  &tgbotapi.User{ID: userID, FirstName: fmt.Sprintf("User%d", userID), LanguageCode: "en"},
+			Query: query,
+		},
+	}
+	h.nextUpdateID++
+	return update
+}
+
+// EditMessage builds an edited_message update changing the text of the message of a previous update
+func (h *Harness) EditMessage(original *tgbotapi.Update, text string) *tgbotapi.Update {
+	edited := *original.Message
+	edited.Text = text
+	edited.EditDate = int(time.Now().Unix())
+	if api.MessageThreadID(original.Message) != 0 {
+		api.SetMessageThreadID(&edited, api.MessageThreadID(original.Message))
+	}
+
+	update := &tgbotapi.Update{UpdateID: h.nextUpdateID, EditedMessage: &edited}
+	h.nextUpdateID++
+	return update
+}
+
+// CallbackQuery builds a callback query update of userID pressing a button of a message sent by the bot
+func (h *Harness) CallbackQuery(msg SentMessage, userID int64, data string) *tgbotapi.Update {
+	chatType := "private"
+	if msg.ChatID < 0 {
+		chatType = "supergroup"
+	}
+	message := &tgbotapi.Message{
+		MessageID: msg.MessageID,
+		From:      &tgbotapi.User{ID: 1, IsBot: true, FirstName: "Test Bot", UserName: "test_bot"},
+		Chat:      &tgbotapi.Chat{ID: msg.ChatID, Type: chatType},
+		Date:      int(time.Now().Unix()),
+		Text:      msg.Text,
+	}
+	if msg.ThreadID != 0 {
+		api.SetMessageThreadID(message, msg.ThreadID)
+	}
+
+	update := &tgbotapi.Update{
+		UpdateID: h.nextUpdateID,
+		CallbackQuery: &tgbotapi.CallbackQuery{
+			ID:      fmt.Sprintf("callback%d", h.nextUpdateID),
+			From:    &tgbotapi.User{ID: userID, FirstName: fmt.Sprintf("User%d", userID), LanguageCode: "en"},
+			Message: message,
+			Data:    data,
+		},
+	}
+	h.nextUpdateID++
+	return update
+}
+
+// messageUpdate builds a message update, marking a leading /command as a bot_command entity
+func (h *Harness) messageUpdate(chat *tgbotapi.Chat, userID int64, text string) *tgbotapi.Update {
+	message := &tgbotapi.Message{
+		MessageID: h.nextMessageID,
+		From:      &tgbotapi.User{ID: userID, FirstName: fmt.Sprintf("User%d", userID), LanguageCode: "en"},
+		Chat:      chat,
+		Date:      int(time.Now().Unix()),
+		Text:      text,
+	}
+	if strings.HasPrefix(text, "/") {
+		length := strings.IndexAny(text, " \n")
+		if length < 0 {
+			length = len(text)
+		}
+		message.Entities = []tgbotapi.MessageEntity{{Type: "bot_command", Offset: 0, Length: length}}
+	}
+
+	update := &tgbotapi.Update{UpdateID: h.nextUpdateID, Message: message}
+	h.nextUpdateID++
+	h.nextMessageID++
+	return update
+}
+
+// Send dispatches a private text message from userID and fails the test on error
+func (h *Harness) Send(userID int64, text string) {
+	h.T.Helper()
+	if err := h.Dispatch(h.PrivateMessage(userID, text)); err != nil {
+		h.T.Fatalf("failed to handle %q: %v", text, err)
+	}
+}
+
+// History returns the stored chat history of a private chat
+func (h *Harness) History(chatID int64) []storage.HistoryItem {
+	h.T.Helper()
+	sessionCtx := config.NewSessionContextFromChat(chatID, h.BotID(), false, h.Config.GroupChatBotShareMode, nil, nil)
+	history, err := h.DB.GetChatHistory(sessionCtx)
+	if err != nil {
+		h.T.Fatalf("failed to load history: %v", err)
+	}
+	return history
+}
+
+// TopicHistory returns the stored chat history of a forum topic in share mode
+func (h *Harness) TopicHistory(chatID int64, threadID int) []storage.HistoryItem {
+	h.T.Helper()
+	history, err := h.DB.GetChatHistory(config.TopicSessionContext(chatID, h.BotID(), int64(threadID)))
+	if err != nil {
+		h.T.Fatalf("failed to load history: %v", err)
+	}
+	return history
+}
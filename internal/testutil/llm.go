@@ -0,0 +1,242 @@
+package testutil
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FakeLLMReply is a scripted response of the fake LLM server
+type FakeLLMReply struct {
+	Text   string        // Full reply text
+	Chunks []string      // Streamed deltas (defaults to Text as a single chunk)
+	Status int           // HTTP status; anything but 200 returns an API error
+	Delay  time.Duration // Time to wait before responding, to keep the request in flight
+}
+
+// FakeLLMRequest is a request received by the fake LLM server
+type FakeLLMRequest struct {
+	Path   string
+	Header http.Header
+	Body   map[string]interface{}
+}
+
+// Stream reports whether the request asked for a streaming response
+func (r FakeLLMRequest) Stream() bool {
+	stream, _ := r.Body["stream"].(bool)
+	return stream
+}
+
+// Messages returns the chat messages of the request
+func (r FakeLLMRequest) Messages() []map[string]interface{} {
+	raw, _ := r.Body["messages"].([]interface{})
+	messages := make([]map[string]interface{}, 0, len(raw))
+	for _, item := range raw {
+		if msg, ok := item.(map[string]interface{}); ok {
+			messages = append(messages, msg)
+		}
+	}
+	return messages
+}
+
+// FakeLLMServer is an in-process OpenAI and Anthropic compatible chat API.
+// Replies are served from a FIFO script; an unscripted request fails with HTTP 500
+// so that tests notice unexpected LLM calls.
+//
+// OpenAI-compatible endpoints: <URL>/v1/chat/completions
+// Anthropic endpoint:          <URL>/v1/messages
+type FakeLLMServer struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	replies  []FakeLLMReply
+	requests []FakeLLMRequest
+}
+
+// NewFakeLLMServer starts a fake LLM server; call Close when done
+func NewFakeLLMServer() *FakeLLMServer {
+	s := &FakeLLMServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	return s
+}
+
+// APIBase returns the API base URL to use as OPENAI_API_BASE or ANTHROPIC_API_BASE
+func (s *FakeLLMServer) APIBase() string {
+	return s.URL + "/v1"
+}
+
+// Reply scripts plain text replies, served in order
+func (s *FakeLLMServer) Reply(texts ...string) {
+	for _, text := range texts {
+		s.Enqueue(FakeLLMReply{Text: text})
+	}
+}
+
+// Enqueue scripts replies, served in order
+func (s *FakeLLMServer) Enqueue(replies ...FakeLLMReply) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.replies = append(s.replies, replies...)
+}
+
+// Requests returns all requests received so far
+func (s *FakeLLMServer) Requests() []FakeLLMRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]FakeLLMRequest(nil), s.requests...)
+}
+
+// LastRequest returns the most recent request, or false if none was received
+func (s *FakeLLMServer) LastRequest() (FakeLLMRequest, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.requests) == 0 {
+		return FakeLLMRequest{}, false
+	}
+	return s.requests[len(s.requests)-1], true
+}
+
+// Pending returns the number of scripted replies not yet served
+func (s *FakeLLMServer) Pending() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.replies)
+}
+
+func (s *FakeLLMServer) handle(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var payload map[string]interface{}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		http.Error(w, "invalid JSON body", http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	req := FakeLLMRequest{Path: r.URL.Path, Header: r.Header.Clone(), Body: payload}
+	s.requests = append(s.requests, req)
+	var reply FakeLLMReply
+	scripted := len(s.replies) > 0
+	if scripted {
+		reply = s.replies[0]
+		s.replies = s.replies[1:]
+	}
+	s.mu.Unlock()
+
+	if !scripted {
+		http.Error(w, `{"error":{"message":"no scripted reply"}}`, http.StatusInternalServerError)
+		return
+	}
+	time.Sleep(reply.Delay)
+	if reply.Status != 0 && reply.Status != http.StatusOK {
+		http.Error(w, fmt.Sprintf(`{"error":{"message":"scripted error %d"}}`, reply.Status), reply.Status)
+		return
+	}
+
+	chunks := reply.Chunks
+	if len(chunks) == 0 {
+		chunks = []string{reply.Text}
+	}
+	text := reply.Text
+	if text == "" {
+		text = strings.Join(chunks, "")
+	}
+
+	switch {
+	case strings.HasSuffix(r.URL.Path, "/chat/completions"):
+		if req.Stream() {
+			writeOpenAIStream(w, chunks)
+		} else {
+			writeJSON(w, map[string]interface{}{
+				"id":     "chatcmpl-fake",
+				"object": "chat.completion",
+				"model":  payload["model"],
+				"choices": []map[string]interface{}{
+					{
+						"index":         0,
+						"message":       map[string]interface{}{"role": "assistant", "content": text},
+						"finish_reason": "stop",
+					},
+				},
+			})
+		}
+	case strings.HasSuffix(r.URL.Path, "/messages"):
+		if req.Stream() {
+			writeAnthropicStream(w, chunks)
+		} else {
+			writeJSON(w, map[string]interface{}{
+				"id":          "msg_fake",
+				"type":        "message",
+				"role":        "assistant",
+				"model":       payload["model"],
+				"content":     []map[string]interface{}{{"type": "text", "text": text}},
+				"stop_reason": "end_turn",
+			})
+		}
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// writeOpenAIStream writes chunks as OpenAI chat.completion.chunk server-sent events
+func writeOpenAIStream(w http.ResponseWriter, chunks []string) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	for _, chunk := range chunks {
+		writeEvent(w, "", map[string]interface{}{
+			"object": "chat.completion.chunk",
+			"choices": []map[string]interface{}{
+				{"index": 0, "delta": map[string]interface{}{"content": chunk}},
+			},
+		})
+	}
+	fmt.Fprint(w, "data: [DONE]\n\n")
+}
+
+// writeAnthropicStream writes chunks as Anthropic Messages API server-sent events
+func writeAnthropicStream(w http.ResponseWriter, chunks []string) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	writeEvent(w, "message_start", map[string]interface{}{
+		"type":    "message_start",
+		"message": map[string]interface{}{"id": "msg_fake", "role": "assistant", "content": []interface{}{}},
+	})
+	writeEvent(w, "content_block_start", map[string]interface{}{
+		"type":          "content_block_start",
+		"index":         0,
+		"content_block": map[string]interface{}{"type": "text", "text": ""},
+	})
+	for _, chunk := range chunks {
+		writeEvent(w, "content_block_delta", map[string]interface{}{
+			"type":  "content_block_delta",
+			"index": 0,
+			"delta": map[string]interface{}{"type": "text_delta", "text": chunk},
+		})
+	}
+	writeEvent(w, "content_block_stop", map[string]interface{}{"type": "content_block_stop", "index": 0})
+	writeEvent(w, "message_stop", map[string]interface{}{"type": "message_stop"})
+}
+
+// writeEvent writes a single server-sent event and flushes it
+func writeEvent(w http.ResponseWriter, event string, data interface{}) {
+	encoded, _ := json.Marshal(data)
+	if event != "" {
+		fmt.Fprintf(w, "event: %s\n", event)
+	}
+	fmt.Fprintf(w, "data: %s\n\n", encoded)
+	if flusher, ok := w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// writeJSON writes a JSON response body
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
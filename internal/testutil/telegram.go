@@ -0,0 +1,292 @@
+package testutil
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// BotAPICall is a Bot API method call received by the fake Bot API
+type BotAPICall struct {
+	Method string
+	Params map[string]string
+}
+
+// ChatID returns the chat_id parameter of the call
+func (c BotAPICall) ChatID() int64 {
+	id, _ := strconv.ParseInt(c.Params["chat_id"], 10, 64)
+	return id
+}
+
+// SentMessage is a message sent by the bot, with edits applied
+type SentMessage struct {
+	ChatID      int64
+	MessageID   int
+	ThreadID    int
+	Text        string
+	ParseMode   string
+	Entities    string // Raw JSON of the entities parameter
+	ReplyMarkup string // Raw JSON of the reply_markup parameter
+	Edits       int    // Number of editMessageText calls applied
+}
+
+// botAPIError is a scripted error response
+type botAPIError struct {
+	code        int
+	description string
+	retryAfter  int
+}
+
+// FakeBotAPI is an in-process Telegram Bot API that records every call.
+// Sent messages get increasing message IDs and edits are applied to them,
+// so tests can assert on what a user would finally see.
+// Use URL as TELEGRAM_API_DOMAIN.
+type FakeBotAPI struct {
+	*httptest.Server
+
+	mu            sync.Mutex
+	calls         []BotAPICall
+	messages      map[int64]map[int]*SentMessage
+	nextMessageID int
+	admins        map[int64][]int64
+	failures      map[string][]botAPIError
+}
+
+// NewFakeBotAPI starts a fake Bot API; call Close when done
+func NewFakeBotAPI() *FakeBotAPI {
+	b := &FakeBotAPI{
+		messages:      make(map[int64]map[int]*SentMessage),
+		nextMessageID: 1000,
+		admins:        make(map[int64][]int64),
+		failures:      make(map[string][]botAPIError),
+	}
+	b.Server = httptest.NewServer(http.HandlerFunc(b.handle))
+	return b
+}
+
+// SetChatAdministrators sets the administrators returned by getChatAdministrators
+func (b *FakeBotAPI) SetChatAdministrators(chatID int64, userIDs ...int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.admins[chatID] = userIDs
+}
+
+// FailNext makes the next call of method fail with the given error code.
+// A retryAfter greater than zero is reported as parameters.retry_after (for 429 responses).
+func (b *FakeBotAPI) FailNext(method string, code int, description string, retryAfter int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures[method] = append(b.failures[method], botAPIError{code: code, description: description, retryAfter: retryAfter})
+}
+
+// Calls returns the recorded calls, optionally filtered by method name
+func (b *FakeBotAPI) Calls(methods ...string) []BotAPICall {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var result []BotAPICall
+	for _, call := range b.calls {
+		if len(methods) == 0 || containsMethod(methods, call.Method) {
+			result = append(result, call)
+		}
+	}
+	return result
+}
+
+// Messages returns the messages sent to a chat, in the order they were sent
+func (b *FakeBotAPI) Messages(chatID int64) []SentMessage {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	result := make([]SentMessage, 0, len(b.messages[chatID]))
+	for _, msg := range b.messages[chatID] {
+		result = append(result, *msg)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].MessageID < result[j].MessageID })
+	return result
+}
+
+// LastMessage returns the most recent message sent to a chat, or false if there is none
+func (b *FakeBotAPI) LastMessage(chatID int64) (SentMessage, bool) {
+	messages := b.Messages(chatID)
+	if len(messages) == 0 {
+		return SentMessage{}, false
+	}
+	return messages[len(messages)-1], true
+}
+
+// Reset clears recorded calls and messages
+func (b *FakeBotAPI) Reset() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.calls = nil
+	b.messages = make(map[int64]map[int]*SentMessage)
+}
+
+func (b *FakeBotAPI) handle(w http.ResponseWriter, r *http.Request) {
+	// Path format: /bot<token>/<method>
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(parts) != 2 || !strings.HasPrefix(parts[0], "bot") {
+		http.NotFound(w, r)
+		return
+	}
+	method := parts[1]
+
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/") {
+		r.ParseMultipartForm(32 << 20)
+	} else {
+		r.ParseForm()
+	}
+	params := make(map[string]string, len(r.Form))
+	for key := range r.Form {
+		params[key] = r.Form.Get(key)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.calls = append(b.calls, BotAPICall{Method: method, Params: params})
+
+	if failures := b.failures[method]; len(failures) > 0 {
+		b.failures[method] = failures[1:]
+		writeBotAPIError(w, failures[0])
+		return
+	}
+
+	chatID, _ := strconv.ParseInt(params["chat_id"], 10, 64)
+
+	switch method {
+	case "getMe":
+		writeBotAPIResult(w, map[string]interface{}{"id": 1, "is_bot": true, "first_name": "Test Bot", "username": "test_bot"})
+	case "sendMessage":
+		msg := b.storeMessage(chatID, params)
+		writeBotAPIResult(w, b.messageResult(msg))
+	case "editMessageText":
+		messageID, _ := strconv.Atoi(params["message_id"])
+		msg, ok := b.messages[chatID][messageID]
+		if !ok {
+			writeBotAPIError(w, botAPIError{code: 400, description: "Bad Request: message to edit not found"})
+			return
+		}
+		if msg.Text == params["text"] && msg.ReplyMarkup == params["reply_markup"] {
+			writeBotAPIError(w, botAPIError{code: 400, description: "Bad Request: message is not modified"})
+			return
+		}
+		msg.Text = params["text"]
+		msg.ParseMode = params["parse_mode"]
+		msg.Entities = params["entities"]
+		if markup, ok := params["reply_markup"]; ok {
+			msg.ReplyMarkup = markup
+		}
+		msg.Edits++
+		writeBotAPIResult(w, b.messageResult(msg))
+	case "editMessageReplyMarkup":
+		messageID, _ := strconv.Atoi(params["message_id"])
+		msg, ok := b.messages[chatID][messageID]
+		if !ok {
+			writeBotAPIError(w, botAPIError{code: 400, description: "Bad Request: message to edit not found"})
+			return
+		}
+		msg.ReplyMarkup = params["reply_markup"]
+		writeBotAPIResult(w, b.messageResult(msg))
+	case "sendPhoto":
+		msg := b.storeMessage(chatID, map[string]string{"text": params["caption"], "message_thread_id": params["message_thread_id"]})
+		writeBotAPIResult(w, b.messageResult(msg))
+	case "sendMediaGroup":
+		var media []map[string]interface{}
+		json.Unmarshal([]byte(params["media"]), &media)
+		results := make([]map[string]interface{}, 0, len(media))
+		for _, item := range media {
+			caption, _ := item["caption"].(string)
+			msg := b.storeMessage(chatID, map[string]string{"text": caption, "message_thread_id": params["message_thread_id"]})
+			results = append(results, b.messageResult(msg))
+		}
+		writeBotAPIResult(w, results)
+	case "getFile":
+		fileID := params["file_id"]
+		writeBotAPIResult(w, map[string]interface{}{"file_id": fileID, "file_unique_id": fileID, "file_path": "photos/" + fileID + ".jpg"})
+	case "deleteMessage":
+		messageID, _ := strconv.Atoi(params["message_id"])
+		delete(b.messages[chatID], messageID)
+		writeBotAPIResult(w, true)
+	case "getChatAdministrators":
+		members := make([]map[string]interface{}, 0, len(b.admins[chatID]))
+		for _, userID := range b.admins[chatID] {
+			members = append(members, map[string]interface{}{
+				"user":   map[string]interface{}{"id": userID, "is_bot": false, "first_name": "Admin"},
+				"status": "administrator",
+			})
+		}
+		writeBotAPIResult(w, members)
+	default:
+		// sendChatAction, answerCallbackQuery, setMyCommands, ...
+		writeBotAPIResult(w, true)
+	}
+}
+
+// storeMessage records a new message sent by the bot
+func (b *FakeBotAPI) storeMessage(chatID int64, params map[string]string) *SentMessage {
+	b.nextMessageID++
+	threadID, _ := strconv.Atoi(params["message_thread_id"])
+	msg := &SentMessage{
+		ChatID:      chatID,
+		MessageID:   b.nextMessageID,
+		ThreadID:    threadID,
+		Text:        params["text"],
+		ParseMode:   params["parse_mode"],
+		Entities:    params["entities"],
+		ReplyMarkup: params["reply_markup"],
+	}
+	if b.messages[chatID] == nil {
+		b.messages[chatID] = make(map[int]*SentMessage)
+	}
+	b.messages[chatID][msg.MessageID] = msg
+	return msg
+}
+
+// messageResult builds the Bot API Message object for a sent message
+func (b *FakeBotAPI) messageResult(msg *SentMessage) map[string]interface{} {
+	result := map[string]interface{}{
+		"message_id": msg.MessageID,
+		"date":       time.Now().Unix(),
+		"chat":       map[string]interface{}{"id": msg.ChatID, "type": "private"},
+		"from":       map[string]interface{}{"id": 1, "is_bot": true, "first_name": "Test Bot", "username": "test_bot"},
+		"text":       msg.Text,
+	}
+	if msg.ThreadID != 0 {
+		result["message_thread_id"] = msg.ThreadID
+	}
+	return result
+}
+
+func writeBotAPIResult(w http.ResponseWriter, result interface{}) {
+	writeJSON(w, map[string]interface{}{"ok": true, "result": result})
+}
+
+func writeBotAPIError(w http.ResponseWriter, apiErr botAPIError) {
+	body := map[string]interface{}{
+		"ok":          false,
+		"error_code":  apiErr.code,
+		"description": apiErr.description,
+	}
+	if apiErr.retryAfter > 0 {
+		body["parameters"] = map[string]interface{}{"retry_after": apiErr.retryAfter}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(apiErr.code)
+	json.NewEncoder(w).Encode(body)
+}
+
+func containsMethod(methods []string, method string) bool {
+	for _, m := range methods {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}